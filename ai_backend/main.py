@@ -5,6 +5,7 @@ Executes workflow configurations from the frontend and returns AI responses.
 
 import os
 import logging
+import tempfile
 from contextlib import asynccontextmanager
 from typing import Any, Dict, List, Optional
 from datetime import datetime
@@ -13,10 +14,11 @@ from fastapi import FastAPI, HTTPException, Header, Depends
 from fastapi.responses import StreamingResponse
 from fastapi.middleware.cors import CORSMiddleware
 from pydantic import BaseModel, Field
+import httpx
 from dotenv import load_dotenv
 from openai import OpenAI
 
-from workflow_executor import WorkflowExecutor, DocumentEmbeddingService
+from workflow_executor import WorkflowExecutor, DocumentEmbeddingService, load_documents_from_directory
 
 # Load environment variables
 load_dotenv()
@@ -282,11 +284,25 @@ async def text_to_speech(request: TTSRequest):
 # Document Embedding Endpoints
 # =============================================================================
 
+class DocumentURL(BaseModel):
+    """A document to download before embedding."""
+    id: str
+    name: str  # stored file name, used as the document's source
+    url: str
+
+
 class EmbedDocumentsRequest(BaseModel):
-    """Request to embed documents from a directory."""
-    documents_path: str
+    """Request to embed documents from a directory or from download links.
+
+    The Go backend sends documents_path when documents are on a shared disk
+    and document_urls when they live in an object store.
+    """
+    documents_path: Optional[str] = None
+    document_urls: Optional[List[DocumentURL]] = None
     user_id: str
     project_id: str
+    # Only re-embed these documents (file names without extension)
+    document_ids: Optional[List[str]] = None
 
 
 class EmbedDocumentsResponse(BaseModel):
@@ -319,6 +335,13 @@ class DeleteIndexRequest(BaseModel):
     project_id: str
 
 
+class DeleteDocumentsRequest(BaseModel):
+    """Request to remove some documents' vectors from an index."""
+    user_id: str
+    project_id: str
+    document_ids: List[str]
+
+
 @app.post("/embed-documents", response_model=EmbedDocumentsResponse)
 async def embed_documents(request: EmbedDocumentsRequest):
     """
@@ -328,14 +351,33 @@ async def embed_documents(request: EmbedDocumentsRequest):
     """
     if embedding_service is None:
         raise HTTPException(status_code=503, detail="Service not initialized")
+    if request.documents_path is None and request.document_urls is None:
+        raise HTTPException(status_code=400, detail="documents_path or document_urls is required")
     
     try:
-        result = embedding_service.embed_documents(
-            documents_path=request.documents_path,
-            user_id=request.user_id,
-            project_id=request.project_id,
-        )
-        return EmbedDocumentsResponse(**result)
+        if request.document_urls is None:
+            result = embedding_service.embed_documents(
+                documents_path=request.documents_path,
+                user_id=request.user_id,
+                project_id=request.project_id,
+                document_ids=request.document_ids,
+            )
+            return EmbedDocumentsResponse(**result)
+
+        with tempfile.TemporaryDirectory() as tmp:
+            async with httpx.AsyncClient(timeout=60) as client:
+                for doc in request.document_urls:
+                    resp = await client.get(doc.url)
+                    resp.raise_for_status()
+                    with open(os.path.join(tmp, os.path.basename(doc.name)), "wb") as f:
+                        f.write(resp.content)
+            result = embedding_service.embed_documents(
+                documents_path=tmp,
+                user_id=request.user_id,
+                project_id=request.project_id,
+                document_ids=request.document_ids,
+            )
+            return EmbedDocumentsResponse(**result)
     except Exception as e:
         logger.exception("Error embedding documents")
         raise HTTPException(status_code=500, detail=str(e))
@@ -381,6 +423,80 @@ async def delete_index(request: DeleteIndexRequest):
         raise HTTPException(status_code=500, detail=str(e))
 
 
+@app.post("/delete-documents")
+async def delete_documents(request: DeleteDocumentsRequest):
+    """
+    Remove the vectors of deleted documents from a project's FAISS index.
+    """
+    if embedding_service is None:
+        raise HTTPException(status_code=503, detail="Service not initialized")
+    
+    try:
+        result = embedding_service.delete_documents(
+            user_id=request.user_id,
+            project_id=request.project_id,
+            document_ids=request.document_ids,
+        )
+        if not result.get("success"):
+            raise HTTPException(status_code=500, detail=result.get("error"))
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.exception("Error deleting document vectors")
+        raise HTTPException(status_code=500, detail=str(e))
+
+
+
+class ExtractTextRequest(BaseModel):
+    """Request to extract the text of one document, by path or download link."""
+    document_path: Optional[str] = None
+    document_url: Optional[DocumentURL] = None
+    max_chars: int = 65536
+
+
+class ExtractTextResponse(BaseModel):
+    """Text extracted from a document, as embedding would load it."""
+    success: bool
+    text: str = ""
+    truncated: bool = False
+
+
+def _extract_text(path: str, max_chars: int) -> ExtractTextResponse:
+    documents = load_documents_from_directory(path)
+    text = "\n\n".join(doc.page_content for doc in documents)
+    return ExtractTextResponse(success=True, text=text[:max_chars], truncated=len(text) > max_chars)
+
+
+@app.post("/extract-text", response_model=ExtractTextResponse)
+async def extract_text(request: ExtractTextRequest):
+    """
+    Extract the text of a PDF, Word or text document for previews.
+    """
+    if request.document_path is None and request.document_url is None:
+        raise HTTPException(status_code=400, detail="document_path or document_url is required")
+
+    try:
+        if request.document_url is None:
+            if not os.path.isfile(request.document_path):
+                raise HTTPException(status_code=404, detail="Document not found")
+            return _extract_text(request.document_path, request.max_chars)
+
+        with tempfile.TemporaryDirectory() as tmp:
+            path = os.path.join(tmp, os.path.basename(request.document_url.name))
+            async with httpx.AsyncClient(timeout=60) as client:
+                resp = await client.get(request.document_url.url)
+                resp.raise_for_status()
+                with open(path, "wb") as f:
+                    f.write(resp.content)
+            return _extract_text(path, request.max_chars)
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.exception("Error extracting document text")
+        raise HTTPException(status_code=500, detail=str(e))
+
+
 if __name__ == "__main__":
     import uvicorn
     
@@ -26,6 +26,7 @@ try:
         PyPDFLoader,
         TextLoader,
         Docx2txtLoader,
+        CSVLoader,
     )
     from langchain_text_splitters import RecursiveCharacterTextSplitter
     FAISS_AVAILABLE = True
@@ -126,7 +127,7 @@ class WorkflowState(TypedDict):
 # =============================================================================
 
 def load_documents_from_directory(directory_path: str) -> List:
-    """Load documents from a directory, supporting PDF, DOCX, and TXT files."""
+    """Load documents from a directory (or a single file), supporting PDF, DOCX, TXT, Markdown and CSV files."""
     documents = []
     path = Path(directory_path)
     
@@ -134,7 +135,8 @@ def load_documents_from_directory(directory_path: str) -> List:
         logger.warning(f"Directory not found: {directory_path}")
         return documents
     
-    for file_path in path.iterdir():
+    files = [path] if path.is_file() else path.iterdir()
+    for file_path in files:
         if file_path.is_file():
             try:
                 ext = file_path.suffix.lower()
@@ -144,6 +146,12 @@ def load_documents_from_directory(directory_path: str) -> List:
                 elif ext == ".txt":
                     loader = TextLoader(str(file_path))
                     documents.extend(loader.load())
+                elif ext == ".md":
+                    loader = TextLoader(str(file_path), encoding="utf-8")
+                    documents.extend(loader.load())
+                elif ext == ".csv":
+                    loader = CSVLoader(str(file_path), encoding="utf-8")
+                    documents.extend(loader.load())
                 elif ext in [".docx", ".doc"]:
                     loader = Docx2txtLoader(str(file_path))
                     documents.extend(loader.load())
@@ -160,6 +168,15 @@ def load_documents_from_directory(directory_path: str) -> List:
 # Document Embedding Service
 # =============================================================================
 
+def _is_document_source(source: str, document_ids: List[str]) -> bool:
+    """Whether a chunk's source file belongs to one of the documents.
+    
+    Uploads are stored as "<document id>_<timestamp>.<ext>".
+    """
+    stem = Path(source).stem
+    return any(stem == d or stem.startswith(f"{d}_") for d in document_ids)
+
+
 class DocumentEmbeddingService:
     """Service for embedding documents into FAISS vector store."""
     
@@ -176,14 +193,19 @@ class DocumentEmbeddingService:
         documents_path: str,
         user_id: str,
         project_id: str,
+        document_ids: Optional[List[str]] = None,
     ) -> Dict[str, Any]:
         """
         Embed documents from a directory into a FAISS index.
         
         Args:
-            documents_path: Path to the directory containing documents
+            documents_path: Path to the directory containing documents, or to a
+                single document file when document_ids is given
             user_id: User ID for organizing indexes
             project_id: Project ID for organizing indexes
+            document_ids: When set, only these documents are (re-)embedded into
+                the existing index; their old vectors are replaced. Otherwise
+                the index is rebuilt from every document.
             
         Returns:
             Dict with status and number of documents embedded
@@ -207,12 +229,28 @@ class DocumentEmbeddingService:
             )
             splits = text_splitter.split_documents(documents)
             
-            # Create FAISS index
-            vectorstore = FAISS.from_documents(splits, self.embeddings)
-            
-            # Save index
             index_base = os.getenv("FAISS_INDEX_PATH", "./faiss_indexes")
             index_path = Path(index_base) / user_id / project_id
+            
+            if document_ids and (index_path / "index.faiss").exists():
+                # Replace only the vectors of the given documents
+                vectorstore = FAISS.load_local(
+                    str(index_path),
+                    self.embeddings,
+                    allow_dangerous_deserialization=True
+                )
+                stale = [
+                    doc_id for doc_id, doc in vectorstore.docstore._dict.items()
+                    if _is_document_source(doc.metadata.get("source", ""), document_ids)
+                ]
+                if stale:
+                    vectorstore.delete(stale)
+                vectorstore.add_documents(splits)
+            else:
+                # Create FAISS index
+                vectorstore = FAISS.from_documents(splits, self.embeddings)
+            
+            # Save index
             index_path.mkdir(parents=True, exist_ok=True)
             vectorstore.save_local(str(index_path))
             
@@ -285,6 +323,44 @@ class DocumentEmbeddingService:
             logger.exception("Error querying documents")
             return {"success": False, "error": str(e)}
     
+    def delete_documents(self, user_id: str, project_id: str, document_ids: List[str]) -> Dict[str, Any]:
+        """Remove the vectors of some documents from a project's FAISS index."""
+        if not FAISS_AVAILABLE:
+            return {"success": False, "error": "FAISS not available"}
+        
+        if not self.embeddings:
+            return {"success": False, "error": "OpenAI API key not configured"}
+        
+        try:
+            index_base = os.getenv("FAISS_INDEX_PATH", "./faiss_indexes")
+            index_path = Path(index_base) / user_id / project_id
+            
+            if not (index_path / "index.faiss").exists():
+                return {"success": True, "deleted_chunks": 0}
+            
+            vectorstore = FAISS.load_local(
+                str(index_path),
+                self.embeddings,
+                allow_dangerous_deserialization=True
+            )
+            removed = [
+                doc_id for doc_id, doc in vectorstore.docstore._dict.items()
+                if _is_document_source(doc.metadata.get("source", ""), document_ids)
+            ]
+            if removed:
+                if len(removed) == len(vectorstore.docstore._dict):
+                    # FAISS cannot save an empty index; drop it instead
+                    return {**self.delete_index(user_id, project_id), "deleted_chunks": len(removed)}
+                vectorstore.delete(removed)
+                vectorstore.save_local(str(index_path))
+            
+            logger.info(f"Deleted {len(removed)} chunks of {document_ids} from {index_path}")
+            return {"success": True, "deleted_chunks": len(removed)}
+            
+        except Exception as e:
+            logger.exception("Error deleting document vectors")
+            return {"success": False, "error": str(e)}
+    
     def delete_index(self, user_id: str, project_id: str) -> Dict[str, Any]:
         """Delete a FAISS index for a project."""
         try:
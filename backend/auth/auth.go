@@ -3,25 +3,39 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
-
+	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"manju/backend/config"
 	"manju/backend/config/database"
+	"manju/backend/mailer"
+	"manju/backend/middleware"
+	"manju/backend/models/response"
 	"manju/backend/repository"
+	"manju/backend/services"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/google"
+	sheets "google.golang.org/api/sheets/v4"
 	"gorm.io/datatypes"
 )
 
-var googleOAuthConfig *oauth2.Config
+var (
+	googleOAuthConfig *oauth2.Config
+	githubOAuthConfig *oauth2.Config
+)
 
 func init() {
 	// Prefer REDIRECT_URI (from .env) for consistency with the project file,
@@ -39,6 +53,7 @@ func init() {
 		RedirectURL:  redirect,
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
+		// Google Sheets access is asked for separately, by ConnectGoogleSheets
 		Scopes: []string{
 			"https://www.googleapis.com/auth/userinfo.email",
 			"https://www.googleapis.com/auth/userinfo.profile",
@@ -52,6 +67,26 @@ func init() {
 		masked = cid[:4] + "..." + cid[len(cid)-4:]
 	}
 	log.Printf("OAuth CLIENT_ID=%s REDIRECT=%s", masked, redirect)
+
+	githubRedirect := strings.TrimSpace(os.Getenv("GITHUB_REDIRECT_URI"))
+	if githubRedirect == "" {
+		githubRedirect = "http://localhost:8080/auth/callback/github"
+	}
+	githubOAuthConfig = &oauth2.Config{
+		RedirectURL:  githubRedirect,
+		ClientID:     strings.TrimSpace(os.Getenv("GITHUB_CLIENT_ID")),
+		ClientSecret: strings.TrimSpace(os.Getenv("GITHUB_CLIENT_SECRET")),
+		Scopes:       []string{"read:user", "user:email"},
+		Endpoint:     github.Endpoint,
+	}
+}
+
+// oauthConfig returns the OAuth2 config of a provider
+func oauthConfig(provider repository.AuthProvider) *oauth2.Config {
+	if provider == repository.ProviderGitHub {
+		return githubOAuthConfig
+	}
+	return googleOAuthConfig
 }
 
 func generateState(c *fiber.Ctx) (string, error) {
@@ -70,6 +105,26 @@ func generateState(c *fiber.Ctx) (string, error) {
 	return state, nil
 }
 
+// generatePKCE creates a PKCE code verifier, keeps it in a short-lived
+// HttpOnly cookie for the callback and returns its S256 code challenge
+func generatePKCE(c *fiber.Ctx) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// 32 random bytes encode to a 43-character verifier, the shortest RFC 7636 allows
+	verifier := base64.RawURLEncoding.EncodeToString(b)
+	c.Cookie(&fiber.Cookie{
+		Name:     "oauthpkce",
+		Value:    verifier,
+		Expires:  time.Now().Add(10 * time.Minute),
+		HTTPOnly: true,
+		Path:     "/",
+	})
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
 // Login starts the OAuth2 flow and redirects the user to Google's consent screen.
 func Login(c *fiber.Ctx) error {
 	// Diagnostic logging: log request header and cookie size to help debug 431 errors
@@ -79,6 +134,85 @@ func Login(c *fiber.Ctx) error {
 		totalHeaderLen += len(k) + len(v)
 	})
 	log.Printf("Auth Login request headers total bytes=%d cookieHeaderBytes=%d", totalHeaderLen, len(cookieHeader))
+	clearRequestCookies(c)
+
+	state, err := generateState(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to generate oauth state")
+	}
+	challenge, err := generatePKCE(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to generate pkce challenge")
+	}
+	url := googleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		// Keep scopes granted earlier, like Google Sheets, on the new token
+		oauth2.SetAuthURLParam("include_granted_scopes", "true"),
+	)
+	// Log the generated auth URL with client_id masked for diagnosis
+	// mask client_id value in the URL
+	maskedUrl := url
+	if cid := os.Getenv("CLIENT_ID"); cid != "" {
+		maskedCid := cid
+		if len(cid) > 8 {
+			maskedCid = cid[:4] + "..." + cid[len(cid)-4:]
+		}
+		maskedUrl = strings.ReplaceAll(maskedUrl, cid, maskedCid)
+	}
+	log.Printf("Auth URL: %s", maskedUrl)
+	return c.Redirect(url, fiber.StatusTemporaryRedirect)
+}
+
+// googleConnectCookie marks an OAuth flow started by ConnectGoogleSheets, so
+// the Google callback adds the grant to the signed-in account instead of
+// signing someone in
+const googleConnectCookie = "oauthconnect"
+
+// ConnectGoogleSheets asks the signed-in user for access to their Google
+// spreadsheets, which Google Sheets nodes read and write as the project owner.
+// Google adds the grant to the ones given at sign-in.
+func ConnectGoogleSheets(c *fiber.Ctx) error {
+	state, err := generateState(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to generate oauth state")
+	}
+	challenge, err := generatePKCE(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to generate pkce challenge")
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     googleConnectCookie,
+		Value:    "sheets",
+		Expires:  time.Now().Add(10 * time.Minute),
+		HTTPOnly: true,
+		Path:     "/",
+	})
+	url := googleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("scope", sheets.SpreadsheetsScope),
+		oauth2.SetAuthURLParam("include_granted_scopes", "true"),
+		// Google only sends a refresh token for the wider grant on consent
+		oauth2.SetAuthURLParam("prompt", "consent"),
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	return c.Redirect(url, fiber.StatusTemporaryRedirect)
+}
+
+// LoginGitHub starts the OAuth2 flow and redirects the user to GitHub's consent screen.
+func LoginGitHub(c *fiber.Ctx) error {
+	clearRequestCookies(c)
+
+	state, err := generateState(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to generate oauth state")
+	}
+	return c.Redirect(githubOAuthConfig.AuthCodeURL(state), fiber.StatusTemporaryRedirect)
+}
+
+// clearRequestCookies clears every cookie sent with the request
+func clearRequestCookies(c *fiber.Ctx) {
+	cookieHeader := c.Get("Cookie")
 
 	// Clear existing cookies sent by the browser to avoid oversized Cookie header
 	// which can cause 431 errors when redirecting to external providers.
@@ -104,41 +238,55 @@ func Login(c *fiber.Ctx) error {
 			log.Printf("Cleared cookies before OAuth login: %v", cleared)
 		}
 	}
+}
 
-	state, err := generateState(c)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("failed to generate oauth state")
-	}
-	url := googleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
-	// Log the generated auth URL with client_id masked for diagnosis
-	// mask client_id value in the URL
-	maskedUrl := url
-	if cid := os.Getenv("CLIENT_ID"); cid != "" {
-		maskedCid := cid
-		if len(cid) > 8 {
-			maskedCid = cid[:4] + "..." + cid[len(cid)-4:]
-		}
-		maskedUrl = strings.ReplaceAll(maskedUrl, cid, maskedCid)
-	}
-	log.Printf("Auth URL: %s", maskedUrl)
-	return c.Redirect(url, fiber.StatusTemporaryRedirect)
+// oauthProfile is the subset of a provider's user info needed to sign someone in
+type oauthProfile struct {
+	ID    string
+	Email string
+	// EmailVerified is whether the provider verified the user owns Email.
+	// Only a verified email is matched against existing accounts.
+	EmailVerified bool
+	Name          string
+	Picture       string
+	Info          map[string]interface{}
 }
 
-// Callback handles the OAuth2 callback from Google, exchanges the code for a token
-// and fetches basic user info. It returns the user info and token as JSON.
-func Callback(c *fiber.Ctx) error {
+// verifyCallback checks the OAuth state cookie and returns the authorization code
+func verifyCallback(c *fiber.Ctx) (string, error) {
 	state := c.Query("state")
 	cookieState := c.Cookies("oauthstate")
 	if state == "" || cookieState == "" || state != cookieState {
-		return c.Status(fiber.StatusBadRequest).SendString("invalid oauth state")
+		middleware.AuthFailed(c)
+		return "", c.Status(fiber.StatusBadRequest).SendString("invalid oauth state")
 	}
 	code := c.Query("code")
 	if code == "" {
-		return c.Status(fiber.StatusBadRequest).SendString("code not found")
+		middleware.AuthFailed(c)
+		return "", c.Status(fiber.StatusBadRequest).SendString("code not found")
 	}
+	return code, nil
+}
 
-	token, err := googleOAuthConfig.Exchange(context.Background(), code)
+// Callback handles the OAuth2 callback from Google, exchanges the code for a token
+// with the PKCE verifier set by Login and fetches basic user info before signing
+// the user in.
+func Callback(c *fiber.Ctx) error {
+	code, err := verifyCallback(c)
+	if code == "" {
+		return err
+	}
+
+	verifier := c.Cookies("oauthpkce")
+	if verifier == "" {
+		middleware.AuthFailed(c)
+		return c.Status(fiber.StatusBadRequest).SendString("pkce verifier not found")
+	}
+
+	token, err := googleOAuthConfig.Exchange(context.Background(), code, oauth2.SetAuthURLParam("code_verifier", verifier))
 	if err != nil {
+		// Mostly an invalid or replayed code
+		middleware.AuthFailed(c)
 		return c.Status(fiber.StatusInternalServerError).SendString("failed to exchange token")
 	}
 
@@ -158,51 +306,294 @@ func Callback(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).SendString("failed to parse userinfo")
 	}
 
-	// Persist user (create if not exists)
-	email, _ := gu["email"].(string)
-	name, _ := gu["name"].(string)
-	infoBytes, _ := json.Marshal(gu)
+	profile := oauthProfile{Info: gu}
+	profile.ID, _ = gu["id"].(string)
+	profile.Email, _ = gu["email"].(string)
+	profile.EmailVerified, _ = gu["verified_email"].(bool)
+	profile.Name, _ = gu["name"].(string)
+	profile.Picture, _ = gu["picture"].(string)
+
+	if c.Cookies(googleConnectCookie) != "" {
+		return completeConnect(c, token, profile)
+	}
+	return completeLogin(c, repository.ProviderGoogle, token, profile)
+}
+
+// CallbackGitHub handles the OAuth2 callback from GitHub. GitHub only includes
+// a public email in the profile, so the user's emails are looked up to check
+// it is verified, or to use the primary verified email when there is none.
+func CallbackGitHub(c *fiber.Ctx) error {
+	code, err := verifyCallback(c)
+	if code == "" {
+		return err
+	}
+
+	token, err := githubOAuthConfig.Exchange(context.Background(), code)
+	if err != nil {
+		// Mostly an invalid or replayed code
+		middleware.AuthFailed(c)
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to exchange token")
+	}
+
+	client := githubOAuthConfig.Client(context.Background(), token)
+	var gu map[string]interface{}
+	if err := getJSON(client, "https://api.github.com/user", &gu); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get userinfo")
+	}
 
+	profile := oauthProfile{Info: gu}
+	if id, ok := gu["id"].(float64); ok {
+		profile.ID = fmt.Sprintf("%.0f", id)
+	}
+	profile.Email, _ = gu["email"].(string)
+	profile.Name, _ = gu["name"].(string)
+	if profile.Name == "" {
+		profile.Name, _ = gu["login"].(string)
+	}
+	profile.Picture, _ = gu["avatar_url"].(string)
+	gu["picture"] = profile.Picture
+
+	// The public email isn't necessarily verified, so it is checked against
+	// the user's verified emails
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(client, "https://api.github.com/user/emails", &emails); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get user emails")
+	}
+	for _, e := range emails {
+		if profile.Email == "" && e.Primary && e.Verified {
+			profile.Email = e.Email
+			gu["email"] = e.Email
+		}
+		if e.Verified && strings.EqualFold(e.Email, profile.Email) {
+			profile.EmailVerified = true
+		}
+	}
+
+	return completeLogin(c, repository.ProviderGitHub, token, profile)
+}
+
+// getJSON fetches url with an authenticated client and decodes the JSON response
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// resolveUser finds the account for a provider login. A linked identity wins;
+// otherwise the account with the same email in tenantID (the tenant the login
+// page was served for, if any) is linked, or a new one is created there.
+func resolveUser(ctx context.Context, provider repository.AuthProvider, token *oauth2.Token, profile oauthProfile, tenantID *uuid.UUID) (*repository.User, error) {
 	userRepo := repository.New(database.Database)
-	user, err := userRepo.GetByEmail(email)
+	identityRepo := repository.NewUserIdentity(database.Database)
+
+	identity, err := identityRepo.GetByProvider(provider, profile.ID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("db error")
+		return nil, err
 	}
-	if user == nil {
-		newUser := &repository.User{
-			Email:  email,
-			Name:   name,
-			Info:   datatypes.JSON(infoBytes),
-			Status: repository.StatusActive,
+	if identity != nil {
+		if err := setIdentityTokens(identity, token); err != nil {
+			return nil, err
 		}
-		created, err := userRepo.Create(newUser)
+		if err := identityRepo.UpdateTokens(identity); err != nil {
+			log.Printf("failed to update %s tokens for user %s: %v", provider, identity.UserID, err)
+		}
+		user, err := userRepo.GetByID(identity.UserID.String())
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("failed to create user")
+			return nil, err
+		}
+		if user != nil {
+			return user, nil
+		}
+		return nil, errors.New("identity is linked to a missing user")
+	}
+
+	// An unverified email could belong to someone else's account
+	if profile.Email == "" || !profile.EmailVerified {
+		return nil, errors.New("provider did not return a verified email")
+	}
+
+	// Accounts of other tenants with the same email are never linked
+	scope := uuid.Nil
+	if tenantID != nil {
+		scope = *tenantID
+	}
+	user, err := userRepo.WithContext(repository.WithTenant(ctx, scope)).GetByEmail(profile.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		infoBytes, _ := json.Marshal(profile.Info)
+		created, err := userRepo.Create(&repository.User{
+			Email:    profile.Email,
+			Name:     profile.Name,
+			Info:     datatypes.JSON(infoBytes),
+			Status:   repository.StatusActive,
+			TenantID: tenantID,
+		})
+		if err != nil {
+			return nil, err
 		}
 		user = created
+
+		// Welcome only brand-new accounts; don't hold up the redirect for SMTP
+		go mailer.SendWelcome(created.Email, created.Name)
+	} else {
+		log.Printf("linking %s identity to existing account %s", provider, user.Email)
+	}
+
+	identity = &repository.UserIdentity{UserID: user.ID, Provider: provider, ProviderUserID: profile.ID}
+	if err := setIdentityTokens(identity, token); err != nil {
+		return nil, err
+	}
+	if _, err := identityRepo.Create(identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// setIdentityTokens stores the tokens of a provider login on an identity,
+// encrypted with the current key
+func setIdentityTokens(identity *repository.UserIdentity, token *oauth2.Token) error {
+	accessToken, keyVersion, err := services.EncryptRefreshToken(token.AccessToken)
+	if err != nil {
+		return err
+	}
+	var refreshToken string
+	if token.RefreshToken != "" {
+		if refreshToken, _, err = services.EncryptRefreshToken(token.RefreshToken); err != nil {
+			return err
+		}
+	}
+	identity.AccessTokenEncrypted = accessToken
+	identity.RefreshTokenEncrypted = refreshToken
+	identity.EncryptionKeyVersion = keyVersion
+	identity.ExpiresAt = nil
+	if !token.Expiry.IsZero() {
+		t := token.Expiry
+		identity.ExpiresAt = &t
+	}
+	return nil
+}
+
+// grantedScope reports whether a token response grants scope
+func grantedScope(token *oauth2.Token, scope string) bool {
+	granted, _ := token.Extra("scope").(string)
+	for _, s := range strings.Fields(granted) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// completeConnect stores the tokens of a ConnectGoogleSheets grant on the
+// signed-in user's Google identity, linking the Google account if it isn't
+// yet, and sends the user back to the frontend with google_sheets=connected
+// or google_sheets=denied.
+func completeConnect(c *fiber.Ctx, token *oauth2.Token, profile oauthProfile) error {
+	c.ClearCookie("oauthstate", "oauthpkce", googleConnectCookie)
+	if profile.ID == "" {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to parse userinfo")
+	}
+
+	sid := c.Cookies("manju_session")
+	if _, err := uuid.Parse(sid); err != nil {
+		return c.Status(fiber.StatusUnauthorized).SendString("unauthenticated")
+	}
+	sess, err := repository.Sessions().Get(sid)
+	if err != nil || sess == nil {
+		return c.Status(fiber.StatusUnauthorized).SendString("unauthenticated")
+	}
+	if !grantedScope(token, sheets.SpreadsheetsScope) {
+		return c.Redirect(config.FrontendURL()+"?google_sheets=denied", fiber.StatusTemporaryRedirect)
+	}
+
+	identityRepo := repository.NewUserIdentity(database.Database)
+	identity, err := identityRepo.GetByProvider(repository.ProviderGoogle, profile.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("db error")
+	}
+	if identity != nil && identity.UserID != sess.UserID {
+		return c.Status(fiber.StatusConflict).SendString("this Google account is linked to another user")
+	}
+	if identity == nil {
+		identity = &repository.UserIdentity{UserID: sess.UserID, Provider: repository.ProviderGoogle, ProviderUserID: profile.ID}
+	}
+	if err := setIdentityTokens(identity, token); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to store google tokens")
+	}
+	if identity.ID == uuid.Nil {
+		_, err = identityRepo.Create(identity)
+	} else {
+		err = identityRepo.UpdateTokens(identity)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to store google tokens")
+	}
+	return c.Redirect(config.FrontendURL()+"?google_sheets=connected", fiber.StatusTemporaryRedirect)
+}
+
+// completeLogin signs in the user behind a provider profile: it resolves or
+// creates the account, opens a session and sets the session cookies.
+func completeLogin(c *fiber.Ctx, provider repository.AuthProvider, token *oauth2.Token, profile oauthProfile) error {
+	if profile.ID == "" {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to parse userinfo")
+	}
+
+	var tenantID *uuid.UUID
+	if id, ok := c.Locals("tenantID").(uuid.UUID); ok {
+		tenantID = &id
+	}
+	user, err := resolveUser(c.UserContext(), provider, token, profile, tenantID)
+	if err != nil {
+		log.Printf("%s login failed: %v", provider, err)
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to sign in")
+	}
+
+	// Accept any project invites sent to this email before the account existed
+	if n, err := repository.NewProjectMember(database.Database).ResolvePendingInvites(user.Email, user.ID); err != nil {
+		log.Printf("failed to resolve pending invites for %s: %v", user.Email, err)
+	} else if n > 0 {
+		log.Printf("resolved %d pending project invites for %s", n, user.Email)
 	}
 
 	// Create server-side session and persist refresh token if provided
-	sessionRepo := repository.NewSession(database.Database)
 	var expires *time.Time
 	if !token.Expiry.IsZero() {
 		t := token.Expiry
 		expires = &t
 	}
+	refreshToken, keyVersion, err := services.EncryptRefreshToken(token.RefreshToken)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to create session")
+	}
 	session := &repository.Session{
-		UserID:       user.ID,
-		RefreshToken: token.RefreshToken,
-		ExpiresAt:    expires,
+		UserID:               user.ID,
+		RefreshToken:         refreshToken,
+		EncryptionKeyVersion: keyVersion,
+		Provider:             provider,
+		UserAgent:            truncate(c.Get(fiber.HeaderUserAgent), 512),
+		TenantID:             user.TenantID,
+		ExpiresAt:            expires,
 	}
-	createdSession, err := sessionRepo.Create(session)
-	if err != nil {
+	if err := repository.Sessions().Set(session); err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString("failed to create session")
 	}
 
 	// Set httpOnly session cookie (do not expose tokens in URL)
 	cookie := &fiber.Cookie{
 		Name:     "manju_session",
-		Value:    createdSession.ID.String(),
+		Value:    session.ID.String(),
 		Expires:  time.Now().Add(7 * 24 * time.Hour),
 		HTTPOnly: true,
 		Secure:   false, // set true in production with HTTPS
@@ -216,8 +607,8 @@ func Callback(c *fiber.Ctx) error {
 		"id":            user.ID,
 		"email":         user.Email,
 		"name":          user.Name,
-		"picture":       gu["picture"],  // ดึงรูปจาก Google
-		"regist_source": "google_oauth", // ค่าที่เพิ่มเอง
+		"picture":       profile.Picture,             // ดึงรูปจาก provider
+		"regist_source": string(provider) + "_oauth", // ค่าที่เพิ่มเอง
 	}
 
 	// 2. ดึงค่าจาก Cookie เดิม (เช่น pref_lang) มาใส่
@@ -244,48 +635,85 @@ func Callback(c *fiber.Ctx) error {
 
 	// -------------------------------------------------------------
 	// clear oauth state
-	c.ClearCookie("oauthstate")
+	c.ClearCookie("oauthstate", "oauthpkce")
+	middleware.AuthSucceeded(c)
 
-	frontend := strings.TrimSpace(os.Getenv("FRONTEND_URL"))
-	if frontend == "" {
-		frontend = "http://localhost:5173"
-	}
-	return c.Redirect(frontend, fiber.StatusTemporaryRedirect)
+	return c.Redirect(config.FrontendURL(), fiber.StatusTemporaryRedirect)
 }
 
 // Me returns the authenticated user's basic info based on session cookie
 func Me(c *fiber.Ctx) error {
 	sid := c.Cookies("manju_session")
 	if sid == "" {
-		return c.Status(fiber.StatusUnauthorized).SendString("unauthenticated")
+		return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthenticated", nil)
+	}
+	if _, err := uuid.Parse(sid); err != nil {
+		middleware.AuthFailed(c)
+		return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthenticated", nil)
 	}
-	sessionRepo := repository.NewSession(database.Database)
-	sess, err := sessionRepo.GetByID(sid)
+	// A well-formed session that is unknown is most likely one that expired
+	// or was revoked, not a guess, so it isn't counted as a failed attempt
+	sess, err := repository.Sessions().Get(sid)
 	if err != nil || sess == nil {
-		return c.Status(fiber.StatusUnauthorized).SendString("unauthenticated")
+		return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthenticated", nil)
 	}
 	userRepo := repository.New(database.Database)
 	user, err := userRepo.GetByID(sess.UserID.String())
 	if err != nil || user == nil {
-		return c.Status(fiber.StatusUnauthorized).SendString("unauthenticated")
+		return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthenticated", nil)
 	}
-	return c.JSON(fiber.Map{"id": user.ID, "email": user.Email, "name": user.Name})
+
+	identities, err := repository.NewUserIdentity(database.Database).ListByUser(user.ID.String())
+	if err != nil {
+		return response.Error(c, fiber.StatusInternalServerError, response.ErrCodeInternal, "failed to load identities", nil)
+	}
+	linked := make([]fiber.Map, 0, len(identities))
+	for _, i := range identities {
+		linked = append(linked, fiber.Map{"provider": i.Provider, "linked_at": i.CreatedAt})
+	}
+	return c.JSON(fiber.Map{"id": user.ID, "email": user.Email, "name": user.Name, "identities": linked})
 }
 
 // RequireAuth is a middleware that ensures the request has a valid session.
-// It sets `userID` in `c.Locals` for downstream handlers.
+// It sets `userID` in `c.Locals` for downstream handlers. Suspended and
+// inactive users are refused even with a valid session.
 func RequireAuth(c *fiber.Ctx) error {
 	sid := c.Cookies("manju_session")
 	if sid == "" {
-		return c.Status(fiber.StatusUnauthorized).SendString("unauthenticated")
+		return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthenticated", nil)
+	}
+	if _, err := uuid.Parse(sid); err != nil {
+		middleware.AuthFailed(c)
+		return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthenticated", nil)
 	}
-	sessionRepo := repository.NewSession(database.Database)
-	sess, err := sessionRepo.GetByID(sid)
+	// A well-formed session that is unknown is most likely one that expired
+	// or was revoked, not a guess, so it isn't counted as a failed attempt
+	sess, err := repository.Sessions().Get(sid)
 	if err != nil || sess == nil {
-		return c.Status(fiber.StatusUnauthorized).SendString("unauthenticated")
+		return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthenticated", nil)
+	}
+	user, err := repository.New(database.Database).GetByID(sess.UserID.String())
+	if err != nil {
+		return response.Error(c, fiber.StatusInternalServerError, response.ErrCodeInternal, "failed to load user", nil)
+	}
+	if user == nil {
+		return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthenticated", nil)
+	}
+	if user.Status.Blocked() {
+		return response.Error(c, fiber.StatusForbidden, response.ErrCodeAccountSuspended, "account is "+string(user.Status), nil)
 	}
 	// Set userID for handlers
 	c.Locals("userID", sess.UserID.String())
+	c.Locals("sessionID", sess.ID.String())
+
+	// The session's tenant always wins over a tenant named by the request
+	if sess.TenantID != nil {
+		c.Locals("tenantID", *sess.TenantID)
+		c.SetUserContext(repository.WithTenant(c.UserContext(), *sess.TenantID))
+	} else {
+		c.Locals("tenantID", nil)
+		c.SetUserContext(repository.WithTenant(c.UserContext(), uuid.Nil))
+	}
 	return c.Next()
 }
 
@@ -293,8 +721,7 @@ func Logout(c *fiber.Ctx) error {
 	// 1. ลบ Session ใน Database (ถ้ามี)
 	sid := c.Cookies("manju_session")
 	if sid != "" {
-		sessionRepo := repository.NewSession(database.Database)
-		_ = sessionRepo.DeleteByID(sid)
+		_ = repository.Sessions().Delete(sid)
 	}
 
 	// 2. สร้าง Cookie "manju_session" ใหม่เพื่อสั่งลบตัวเก่า
@@ -331,3 +758,17 @@ func Logout(c *fiber.Ctx) error {
 		"message": "Logged out successfully",
 	})
 }
+
+// TokenSource returns an OAuth2 token source for a session, using the provider
+// the session was opened with. The stored refresh token is decrypted only here,
+// right before it is handed to oauth2.
+func TokenSource(ctx context.Context, sess *repository.Session) (oauth2.TokenSource, error) {
+	refreshToken, err := services.DecryptRefreshToken(sess)
+	if err != nil {
+		return nil, err
+	}
+	if refreshToken == "" {
+		return nil, errors.New("session has no refresh token")
+	}
+	return oauthConfig(sess.Provider).TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}), nil
+}
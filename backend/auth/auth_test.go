@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"manju/backend/middleware"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/repository/repotest"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestUnauthenticatedEnvelope(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("requestID", "req-1")
+		return c.Next()
+	})
+	app.Get("/me", Me)
+	app.Get("/protected", RequireAuth, func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+
+	tests := []struct {
+		name    string
+		path    string
+		session string
+	}{
+		{name: "me without a session", path: "/me"},
+		{name: "me with a malformed session", path: "/me", session: "not-a-uuid"},
+		{name: "protected route without a session", path: "/protected"},
+		{name: "protected route with a malformed session", path: "/protected", session: "not-a-uuid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.session != "" {
+				req.AddCookie(&http.Cookie{Name: "manju_session", Value: tt.session})
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("status %d, want 401", resp.StatusCode)
+			}
+			var body response.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("body is not an error envelope: %v", err)
+			}
+			if body.Code != response.ErrCodeUnauthorized || body.RequestID != "req-1" {
+				t.Errorf("body %+v, want code %q with the request id", body, response.ErrCodeUnauthorized)
+			}
+		})
+	}
+}
+
+func TestCallbackWithoutVerifierCountsAsFailure(t *testing.T) {
+	const maxAttempts = 3
+	app := fiber.New()
+	app.Get("/auth/google/callback", middleware.BruteForceProtect(maxAttempts, time.Minute), Callback)
+
+	// The state matches, but the PKCE verifier cookie set by Login is missing
+	callback := func() *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?state=s1&code=c1", nil)
+		req.AddCookie(&http.Cookie{Name: "oauthstate", Value: "s1"})
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	for i := 0; i < maxAttempts; i++ {
+		if resp := callback(); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("callback %d: status %d, want 400", i+1, resp.StatusCode)
+		}
+	}
+	resp := callback()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status %d after %d callbacks without a verifier, want 429", resp.StatusCode, maxAttempts)
+	}
+	var body response.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code != response.ErrCodeRateLimited {
+		t.Errorf("body %+v (%v), want code %q", body, err, response.ErrCodeRateLimited)
+	}
+}
+
+func TestStaleSessionsDontLockOutSignIn(t *testing.T) {
+	const maxAttempts = 3
+	prev := repository.GetDB()
+	repository.SetDB(repotest.OpenDB(t, "manju", &repository.Session{}))
+	t.Cleanup(func() { repository.SetDB(prev) })
+
+	// Attempts are counted per IP across tests, so this test uses its own
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor, Immutable: true})
+	app.Get("/auth/google/callback", middleware.BruteForceProtect(maxAttempts, time.Minute), Callback)
+	app.Get("/api/projects", middleware.SessionBruteForceProtect(maxAttempts, time.Minute), RequireAuth, func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+	get := func(path, session string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, "203.0.113.7")
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: "manju_session", Value: session})
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	// An expired session cookie sent over and over is not a guess
+	expired := uuid.NewString()
+	for i := 0; i < 2*maxAttempts; i++ {
+		if status := get("/api/projects", expired); status != http.StatusUnauthorized {
+			t.Fatalf("request %d with an expired session: status %d, want 401", i+1, status)
+		}
+	}
+
+	// Malformed sessions block the API, but not signing in
+	for i := 0; i < maxAttempts; i++ {
+		get("/api/projects", "not-a-uuid")
+	}
+	if status := get("/api/projects", "not-a-uuid"); status != http.StatusTooManyRequests {
+		t.Fatalf("status %d after %d malformed sessions, want 429", status, maxAttempts)
+	}
+	if status := get("/auth/google/callback?state=s1&code=c1", ""); status == http.StatusTooManyRequests {
+		t.Errorf("sign-in blocked by failed session checks")
+	}
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"manju/backend/models/response"
+	"strings"
+
+	"manju/backend/config/database"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// userAgentBrowsers and userAgentSystems are matched in order, so more
+// specific tokens (Edge, Android) come before the ones they contain
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	userAgentSystems = []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// maskUserAgent reduces a user agent to "<browser> on <os>" so the session list
+// identifies devices without exposing full version fingerprints
+func maskUserAgent(ua string) string {
+	if ua == "" {
+		return ""
+	}
+	browser, system := "Unknown browser", "unknown OS"
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range userAgentSystems {
+		if strings.Contains(ua, s.token) {
+			system = s.name
+			break
+		}
+	}
+	return browser + " on " + system
+}
+
+// truncate cuts s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// ListSessions returns the authenticated user's active sessions
+func ListSessions(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+	current, _ := c.Locals("sessionID").(string)
+
+	sessions, err := repository.NewSession(database.Database).ListByUserID(userID)
+	if err != nil {
+		return response.Error(c, fiber.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	out := make([]fiber.Map, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, fiber.Map{
+			"id":         s.ID,
+			"provider":   s.Provider,
+			"user_agent": maskUserAgent(s.UserAgent),
+			"created_at": s.CreatedAt,
+			"expires_at": s.ExpiresAt,
+			"current":    s.ID.String() == current,
+		})
+	}
+	return c.JSON(out)
+}
+
+// RevokeSession signs out one of the authenticated user's sessions
+func RevokeSession(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+	store := repository.Sessions()
+
+	sess, err := store.Get(c.Params("sessionId"))
+	if err != nil || sess == nil || sess.UserID.String() != userID {
+		return response.Error(c, fiber.StatusNotFound, response.ErrCodeNotFound, "session not found", nil)
+	}
+	if err := store.Delete(sess.ID.String()); err != nil {
+		return response.Error(c, fiber.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(fiber.Map{"message": "session revoked"})
+}
+
+// RevokeAllSessions signs out every session of the authenticated user. With
+// ?keep_current=true the session making the request stays signed in.
+func RevokeAllSessions(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+	except := ""
+	if c.QueryBool("keep_current") {
+		except, _ = c.Locals("sessionID").(string)
+	}
+
+	sessions, err := repository.NewSession(database.Database).ListByUserID(userID)
+	if err != nil {
+		return response.Error(c, fiber.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	// Delete one by one through the store so cached copies are evicted too
+	store := repository.Sessions()
+	revoked := 0
+	for _, s := range sessions {
+		if s.ID.String() == except {
+			continue
+		}
+		if err := store.Delete(s.ID.String()); err != nil {
+			return response.Error(c, fiber.StatusInternalServerError, response.ErrCodeInternal, err.Error(), fiber.Map{"revoked": revoked})
+		}
+		revoked++
+	}
+	return c.JSON(fiber.Map{"message": "sessions revoked", "revoked": revoked})
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"time"
+	"strings"
 
 	"manju/backend/repository"
 
@@ -16,15 +16,8 @@ import (
 var Database *gorm.DB
 
 func Connect() {
-	// New logger for detailed SQL logging
-	newLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-		logger.Config{
-			SlowThreshold: time.Second, // Slow SQL threshold
-			LogLevel:      logger.Info, // Log level
-			Colorful:      true,        // Enable color
-		},
-	)
+	// SQL logging, configured by DB_LOG_LEVEL, DB_SLOW_QUERY_MS and DB_LOG_ALL_QUERIES
+	newLogger := newQueryLogger()
 
 	dbHost := os.Getenv("DB_HOST")
 	if dbHost == "" {
@@ -58,13 +51,72 @@ func Connect() {
 		Logger: newLogger,
 	})
 
-	// Auto-migrate core models (User, Session, Project, UserAPIKey)
-	if err := Database.AutoMigrate(&repository.User{}, &repository.Session{}, &repository.Project{}, &repository.UserAPIKey{}); err != nil {
+	// Auto-migrate core models
+	if err := Database.AutoMigrate(
+		&repository.Tenant{},
+		&repository.User{},
+		&repository.Session{},
+		&repository.Project{},
+		&repository.UserAPIKey{},
+		&repository.AuditLog{},
+		&repository.ProjectTemplate{},
+		&repository.ProjectMember{},
+		&repository.Execution{},
+		&repository.Schedule{},
+		&repository.Webhook{},
+		&repository.UserIdentity{},
+		&repository.ProjectVersion{},
+		&repository.ProjectFavorite{},
+		&repository.EmbeddingJob{},
+		&repository.Document{},
+		&repository.DocumentVersion{},
+		&repository.DocumentUpload{},
+		&repository.Team{},
+		&repository.TeamMember{},
+	); err != nil {
 		log.Printf("AutoMigrate error: %v", err)
 	}
 
 	// Set the database reference for the repository package
 	repository.SetDB(Database)
+	repository.SetSessionStore(repository.NewSessionStoreFromEnv(Database))
+
+	// Record query errors on the active trace span
+	repository.RegisterTracingCallbacks(Database)
+
+	// Limit queries to the request's tenant
+	repository.RegisterTenantCallbacks(Database)
+
+	// Optional read replicas for list/search/aggregate queries
+	connectReplicas(newLogger)
 
 	fmt.Println("Database connected")
 }
+
+// connectReplicas opens the comma-separated DB_REPLICA_DSNS connections and
+// registers them with the repository package. Unreachable replicas are skipped.
+func connectReplicas(gormLogger logger.Interface) {
+	raw := strings.TrimSpace(os.Getenv("DB_REPLICA_DSNS"))
+	if raw == "" {
+		return
+	}
+
+	var replicas []*gorm.DB
+	for _, dsn := range strings.Split(raw, ",") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			continue
+		}
+		replica, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: gormLogger})
+		if err != nil {
+			log.Printf("Replica connection error: %v", err)
+			continue
+		}
+		repository.RegisterTenantCallbacks(replica)
+		replicas = append(replicas, replica)
+	}
+
+	repository.RegisterPrimaryPinCallbacks(Database)
+	repository.SetReplicas(replicas)
+	fmt.Printf("Read replicas connected: %d\n", len(replicas))
+}
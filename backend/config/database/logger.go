@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"manju/backend/logging"
+	"manju/backend/repository"
+
+	"gorm.io/gorm/logger"
+)
+
+// defaultSlowQuery is the slow query threshold when DB_SLOW_QUERY_MS is unset
+const defaultSlowQuery = time.Second
+
+// logLevels maps the DB_LOG_LEVEL values to gorm's log levels
+var logLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent,
+	"error":  logger.Error,
+	"warn":   logger.Warn,
+	"info":   logger.Info,
+}
+
+// queryLogger logs the queries of a connection. Errors and, at the info
+// level, every statement are logged by gorm's logger. Queries slower than
+// slowThreshold are written to the structured logger as WARN records with the
+// query, rows, latency_ms and request_id fields, and with logAll every query
+// as a DEBUG record.
+type queryLogger struct {
+	logger.Interface
+	log           *slog.Logger
+	level         logger.LogLevel
+	slowThreshold time.Duration
+	logAll        bool
+}
+
+// newQueryLogger builds the query logger configured by DB_LOG_LEVEL
+// (silent|error|warn|info, default info), DB_SLOW_QUERY_MS (default 1000)
+// and DB_LOG_ALL_QUERIES
+func newQueryLogger() logger.Interface {
+	structured := logging.Logger()
+	level := logger.Info
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("DB_LOG_LEVEL"))); v != "" {
+		if l, ok := logLevels[v]; ok {
+			level = l
+		} else {
+			structured.Warn("unknown DB_LOG_LEVEL, using info", "value", v)
+		}
+	}
+	slowThreshold := defaultSlowQuery
+	if v := strings.TrimSpace(os.Getenv("DB_SLOW_QUERY_MS")); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms > 0 {
+			slowThreshold = time.Duration(ms) * time.Millisecond
+		} else {
+			structured.Warn("invalid DB_SLOW_QUERY_MS, using the default", "value", v, "default_ms", defaultSlowQuery.Milliseconds())
+		}
+	}
+
+	return &queryLogger{
+		// Slow queries are logged by Trace, so gorm's own threshold is off
+		Interface: logger.New(
+			log.New(os.Stdout, "\r\n", log.LstdFlags),
+			logger.Config{LogLevel: level, Colorful: true},
+		),
+		log:           structured,
+		level:         level,
+		slowThreshold: slowThreshold,
+		logAll:        strings.ToLower(strings.TrimSpace(os.Getenv("DB_LOG_ALL_QUERIES"))) == "true",
+	}
+}
+
+// LogMode returns a copy of the logger at level
+func (l *queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copied := *l
+	copied.Interface = l.Interface.LogMode(level)
+	copied.level = level
+	return &copied
+}
+
+// Trace logs a finished query
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	l.Interface.Trace(ctx, begin, fc, err)
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	slow := l.level >= logger.Warn && elapsed > l.slowThreshold
+	if !slow && !l.logAll {
+		return
+	}
+	sql, rows := fc()
+	fields := []any{
+		"query", sql,
+		"rows", rows,
+		"latency_ms", elapsed.Milliseconds(),
+		"request_id", repository.RequestIDFromContext(ctx),
+	}
+	if slow {
+		l.log.WarnContext(ctx, "slow query", fields...)
+	} else {
+		l.log.DebugContext(ctx, "query", fields...)
+	}
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"manju/backend/logging"
+	"manju/backend/repository"
+
+	"gorm.io/gorm/logger"
+)
+
+func TestQueryLoggerSlowThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     logger.LogLevel
+		threshold time.Duration
+		elapsed   time.Duration
+		logAll    bool
+		want      string // level of the record, "" for none
+	}{
+		{name: "under the threshold", level: logger.Info, threshold: 200 * time.Millisecond, elapsed: 50 * time.Millisecond},
+		{name: "over the threshold", level: logger.Info, threshold: 200 * time.Millisecond, elapsed: 300 * time.Millisecond, want: "WARN"},
+		{name: "over a lowered threshold", level: logger.Warn, threshold: 10 * time.Millisecond, elapsed: 50 * time.Millisecond, want: "WARN"},
+		{name: "slow query at the error level", level: logger.Error, threshold: 10 * time.Millisecond, elapsed: 50 * time.Millisecond},
+		{name: "silent", level: logger.Silent, threshold: 10 * time.Millisecond, elapsed: 50 * time.Millisecond, logAll: true},
+		{name: "every query", level: logger.Info, threshold: time.Second, elapsed: time.Millisecond, logAll: true, want: "DEBUG"},
+		{name: "slow query with every query logged", level: logger.Info, threshold: 10 * time.Millisecond, elapsed: 50 * time.Millisecond, logAll: true, want: "WARN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := &queryLogger{
+				Interface:     logger.Discard,
+				log:           logging.New(&buf),
+				level:         tt.level,
+				slowThreshold: tt.threshold,
+				logAll:        tt.logAll,
+			}
+			ctx := repository.WithRequestID(context.Background(), "req-1")
+			l.Trace(ctx, time.Now().Add(-tt.elapsed), func() (string, int64) {
+				return "SELECT * FROM projects", 3
+			}, nil)
+
+			if tt.want == "" {
+				if buf.Len() != 0 {
+					t.Fatalf("logged %s, want nothing", buf.String())
+				}
+				return
+			}
+			var record struct {
+				Level     string `json:"level"`
+				Query     string `json:"query"`
+				Rows      int64  `json:"rows"`
+				LatencyMs int64  `json:"latency_ms"`
+				RequestID string `json:"request_id"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("record %q is not JSON: %v", buf.String(), err)
+			}
+			if record.Level != tt.want || record.Query != "SELECT * FROM projects" || record.Rows != 3 || record.RequestID != "req-1" {
+				t.Errorf("record %+v, want a %s record of the query", record, tt.want)
+			}
+			if record.LatencyMs < tt.elapsed.Milliseconds() {
+				t.Errorf("latency_ms %d, want at least %d", record.LatencyMs, tt.elapsed.Milliseconds())
+			}
+		})
+	}
+}
+
+func TestNewQueryLoggerConfig(t *testing.T) {
+	tests := []struct {
+		name, level, slowMs string
+		wantLevel           logger.LogLevel
+		wantThreshold       time.Duration
+	}{
+		{name: "defaults", wantLevel: logger.Info, wantThreshold: time.Second},
+		{name: "configured", level: "WARN", slowMs: "250", wantLevel: logger.Warn, wantThreshold: 250 * time.Millisecond},
+		{name: "invalid values", level: "loud", slowMs: "-5", wantLevel: logger.Info, wantThreshold: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_LOG_LEVEL", tt.level)
+			t.Setenv("DB_SLOW_QUERY_MS", tt.slowMs)
+			l := newQueryLogger().(*queryLogger)
+			if l.level != tt.wantLevel || l.slowThreshold != tt.wantThreshold {
+				t.Errorf("level %v threshold %v, want %v and %v", l.level, l.slowThreshold, tt.wantLevel, tt.wantThreshold)
+			}
+		})
+	}
+}
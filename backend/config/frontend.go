@@ -0,0 +1,38 @@
+// Package config reads settings shared by several packages from the
+// environment.
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultFrontendURL is where the frontend runs in local development
+const defaultFrontendURL = "http://localhost:5173"
+
+// FrontendURLs returns the origins the frontend is served from, read from
+// FRONTEND_URL as a comma-separated list. Entries may use a wildcard
+// subdomain such as https://*.example.com for CORS.
+func FrontendURLs() []string {
+	var urls []string
+	for _, u := range strings.Split(os.Getenv("FRONTEND_URL"), ",") {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return []string{defaultFrontendURL}
+	}
+	return urls
+}
+
+// FrontendURL returns the frontend's primary URL, the first FRONTEND_URL
+// entry without a wildcard, used for redirects and links in emails
+func FrontendURL() string {
+	for _, u := range FrontendURLs() {
+		if !strings.Contains(u, "*") {
+			return u
+		}
+	}
+	return defaultFrontendURL
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFrontendURLs(t *testing.T) {
+	tests := []struct {
+		env         string
+		wantURLs    []string
+		wantPrimary string
+	}{
+		{env: "", wantURLs: []string{"http://localhost:5173"}, wantPrimary: "http://localhost:5173"},
+		{env: "https://app.example.com/", wantURLs: []string{"https://app.example.com"}, wantPrimary: "https://app.example.com"},
+		{
+			env:         " https://*.preview.example.com , https://app.example.com,,",
+			wantURLs:    []string{"https://*.preview.example.com", "https://app.example.com"},
+			wantPrimary: "https://app.example.com",
+		},
+		{env: "https://*.preview.example.com", wantURLs: []string{"https://*.preview.example.com"}, wantPrimary: "http://localhost:5173"},
+		{env: " , ", wantURLs: []string{"http://localhost:5173"}, wantPrimary: "http://localhost:5173"},
+	}
+	for _, tt := range tests {
+		t.Setenv("FRONTEND_URL", tt.env)
+		if got := FrontendURLs(); !reflect.DeepEqual(got, tt.wantURLs) {
+			t.Errorf("FRONTEND_URL=%q: FrontendURLs() = %v, want %v", tt.env, got, tt.wantURLs)
+		}
+		if got := FrontendURL(); got != tt.wantPrimary {
+			t.Errorf("FRONTEND_URL=%q: FrontendURL() = %q, want %q", tt.env, got, tt.wantPrimary)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultMaintenanceLockFile is where the maintenance lock is kept unless
+// MAINTENANCE_LOCK_FILE says otherwise
+const defaultMaintenanceLockFile = "maintenance.lock"
+
+// MaintenanceLockFile returns the file whose presence puts the server in
+// maintenance mode, read from MAINTENANCE_LOCK_FILE
+func MaintenanceLockFile() string {
+	if path := strings.TrimSpace(os.Getenv("MAINTENANCE_LOCK_FILE")); path != "" {
+		return path
+	}
+	return defaultMaintenanceLockFile
+}
+
+// MaintenanceForced reports whether MAINTENANCE_MODE=true keeps the server
+// in maintenance mode regardless of the lock file
+func MaintenanceForced() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("MAINTENANCE_MODE")), "true")
+}
+
+// MaintenanceActive reports whether the server is in maintenance mode:
+// MAINTENANCE_MODE=true or the lock file exists
+func MaintenanceActive() bool {
+	if MaintenanceForced() {
+		return true
+	}
+	_, err := os.Stat(MaintenanceLockFile())
+	return err == nil
+}
+
+// SetMaintenance creates or removes the lock file. Every replica sharing the
+// file enters or leaves maintenance mode with it.
+func SetMaintenance(on bool) error {
+	path := MaintenanceLockFile()
+	if !on {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644)
+}
+
+// MaintenanceBypassKey returns the X-Maintenance-Override value that lets a
+// request through during maintenance, read from MAINTENANCE_BYPASS_KEY; empty
+// when bypassing is disabled
+func MaintenanceBypassKey() string {
+	return strings.TrimSpace(os.Getenv("MAINTENANCE_BYPASS_KEY"))
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// TenantBaseDomain returns the domain tenant subdomains live under, read
+// from TENANT_BASE_DOMAIN (e.g. "manju.app" serves tenant "acme" on
+// acme.manju.app). Without it tenants are only found by custom domain.
+func TenantBaseDomain() string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(os.Getenv("TENANT_BASE_DOMAIN"))), ".")
+}
+
+// TenantHeaderTrusted reports whether the X-Tenant-ID header of a request
+// from ip may be believed: ip must be one of the comma-separated addresses
+// or CIDR ranges of TENANT_HEADER_TRUSTED_PROXIES, such as the edge proxy
+// that maps domains to tenants. Nothing is trusted when it is unset.
+func TenantHeaderTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, entry := range strings.Split(os.Getenv("TENANT_HEADER_TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if trusted := net.ParseIP(entry); trusted != nil && trusted.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
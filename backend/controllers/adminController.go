@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"manju/backend/repository"
+	"manju/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminController handles admin-only HTTP requests
+type AdminController struct {
+	auditRepo   *repository.AuditLogRepository
+	sessionRepo *repository.SessionRepository
+	tenantRepo  *repository.TenantRepository
+	projectRepo *repository.ProjectRepository
+}
+
+// NewAdminController creates a new AdminController
+func NewAdminController(auditRepo *repository.AuditLogRepository, sessionRepo *repository.SessionRepository, tenantRepo *repository.TenantRepository, projectRepo *repository.ProjectRepository) *AdminController {
+	return &AdminController{auditRepo: auditRepo, sessionRepo: sessionRepo, tenantRepo: tenantRepo, projectRepo: projectRepo}
+}
+
+// ListAuditLogs handles GET /admin/audit-logs
+// @Summary List audit log entries
+// @Description ListAuditLogs returns audit records filtered by resource_type, user_id, from and to
+// @Tags admin
+// @Produce json
+// @Param resource_type query string false "Resource type"
+// @Param user_id query string false "User id"
+// @Param limit query integer false "Limit"
+// @Param from query string false "From"
+// @Param to query string false "To"
+// @Success 200 {array} repository.AuditLog
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/admin/audit-logs [get]
+func (ctrl *AdminController) ListAuditLogs(c *fiber.Ctx) error {
+	return services.ListAuditLogs(c, ctrl.auditRepo)
+}
+
+// ReencryptSessions handles POST /admin/reencrypt-sessions
+// @Summary Re-encrypt stored sessions with the current key
+// @Description ReencryptSessions re-encrypts every stored refresh token that was not encrypted with the current key, after ENCRYPTION_KEY has been rotated.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} services.ReencryptSessionsResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/admin/reencrypt-sessions [post]
+func (ctrl *AdminController) ReencryptSessions(c *fiber.Ctx) error {
+	return services.ReencryptSessions(c, ctrl.sessionRepo)
+}
+
+// CreateTenant handles POST /admin/tenants
+// @Summary Create a tenant
+// @Description CreateTenant creates a tenant
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param body body services.CreateTenantPayload true "Request body"
+// @Success 201 {object} repository.Tenant
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/admin/tenants [post]
+func (ctrl *AdminController) CreateTenant(c *fiber.Ctx) error {
+	return services.CreateTenant(c, ctrl.tenantRepo)
+}
+
+// ListTenants handles GET /admin/tenants
+// @Summary List tenants
+// @Description ListTenants returns every tenant
+// @Tags admin
+// @Produce json
+// @Success 200 {array} repository.Tenant
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/admin/tenants [get]
+func (ctrl *AdminController) ListTenants(c *fiber.Ctx) error {
+	return services.ListTenants(c, ctrl.tenantRepo)
+}
+
+// EnableMaintenance handles POST /admin/maintenance/enable
+// @Summary Enter maintenance mode
+// @Description EnableMaintenance puts the server in maintenance mode by creating the maintenance lock file
+// @Tags admin
+// @Produce json
+// @Success 200 {object} services.MaintenanceResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/admin/maintenance/enable [post]
+func (ctrl *AdminController) EnableMaintenance(c *fiber.Ctx) error {
+	return services.EnableMaintenance(c)
+}
+
+// DisableMaintenance handles POST /admin/maintenance/disable
+// @Summary Leave maintenance mode
+// @Description DisableMaintenance ends maintenance mode by removing the maintenance lock file. It fails with 409 while MAINTENANCE_MODE=true holds the server in it.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} services.MaintenanceResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/admin/maintenance/disable [post]
+func (ctrl *AdminController) DisableMaintenance(c *fiber.Ctx) error {
+	return services.DisableMaintenance(c)
+}
+
+// ListProjects handles GET /admin/projects
+// @Summary List all projects
+// @Description ListAdminProjects returns a page of the projects of every user in the admin's tenant with their owners, filterable by ?user_id, ?status, ?tag and a ?from/?to creation range
+// @Tags admin
+// @Produce json
+// @Param status query string false "Status"
+// @Param tag query string false "Tag"
+// @Param user_id query string false "User id"
+// @Param limit query integer false "Limit"
+// @Param offset query integer false "Offset"
+// @Param from query string false "From"
+// @Param to query string false "To"
+// @Success 200 {object} services.AdminProjectsResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/admin/projects [get]
+func (ctrl *AdminController) ListProjects(c *fiber.Ctx) error {
+	return services.ListAdminProjects(c, ctrl.projectRepo.WithContext(c.UserContext()))
+}
@@ -19,18 +19,61 @@ func NewAPIKeyController() *APIKeyController {
 	return &APIKeyController{repo: repo}
 }
 
+// @Summary List the API keys of a user
+// @Description ListAPIKeys returns all API keys for a user (masked)
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {array} repository.UserAPIKey
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/api-keys [get]
 func (c *APIKeyController) ListAPIKeys(ctx *fiber.Ctx) error {
 	return services.ListAPIKeys(ctx, c.repo)
 }
 
+// @Summary Add an API key
+// @Description AddAPIKey adds a new API key for a user
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param body body services.AddAPIKeyPayload true "Request body"
+// @Success 201 {object} repository.UserAPIKey
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure 502 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/api-keys [post]
 func (c *APIKeyController) AddAPIKey(ctx *fiber.Ctx) error {
 	return services.AddAPIKey(ctx, c.repo)
 }
 
+// @Summary Delete an API key
+// @Description DeleteAPIKey removes an API key
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "User ID"
+// @Param keyId path string true "API key ID"
+// @Success 204
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/api-keys/{keyId} [delete]
 func (c *APIKeyController) DeleteAPIKey(ctx *fiber.Ctx) error {
 	return services.DeleteAPIKey(ctx, c.repo)
 }
 
+// @Summary Make an API key the default
+// @Description SetDefaultAPIKey sets a key as the default
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "User ID"
+// @Param keyId path string true "API key ID"
+// @Success 200 {object} response.MessageResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/api-keys/{keyId}/default [put]
 func (c *APIKeyController) SetDefaultAPIKey(ctx *fiber.Ctx) error {
 	return services.SetDefaultAPIKey(ctx, c.repo)
 }
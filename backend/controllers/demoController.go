@@ -18,21 +18,161 @@ func NewDemoController(repo *repository.ProjectRepository) *DemoController {
 }
 
 // DemoProject handles POST /projects/:id/demo
+// @Summary Run a project's workflow on a message
+// @Description DemoProject handles the demo chat request for a project
+// @Tags demo
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.DemoRequest true "Request body"
+// @Success 200 {object} services.DemoChatResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 402 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/demo [post]
 func (ctrl *DemoController) DemoProject(c *fiber.Ctx) error {
-	return services.DemoProject(c, ctrl.repo)
+	return services.DemoProject(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// DemoProjectStream handles POST /projects/:id/demo/stream
+// @Summary Run a project's workflow and stream the reply
+// @Description DemoProjectStream runs a project's workflow like DemoProject but streams
+// @Description the reply as server-sent events: token events as it is generated, then a
+// @Description done event with the DemoChatResponse, or an error event. If the client
+// @Description disconnects the AI service request is cancelled.
+// @Tags demo
+// @Accept json
+// @Produce text/event-stream
+// @Param id path string true "Project ID"
+// @Param body body services.DemoRequest true "Request body"
+// @Success 200 {string} string "event stream"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 402 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/demo/stream [post]
+func (ctrl *DemoController) DemoProjectStream(c *fiber.Ctx) error {
+	return services.DemoProjectStream(c, ctrl.repo.WithContext(c.UserContext()))
 }
 
 // ValidateWorkflow handles POST /projects/:id/validate
+// @Summary Validate a project's workflow
+// @Description ValidateWorkflow validates a project's workflow configuration
+// @Tags demo
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.WorkflowValidation
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/validate [post]
 func (ctrl *DemoController) ValidateWorkflow(c *fiber.Ctx) error {
-	return services.ValidateWorkflow(c, ctrl.repo)
+	return services.ValidateWorkflow(c, ctrl.repo.WithContext(c.UserContext()))
 }
 
 // GetWorkflowType handles GET /projects/:id/workflow-type
+// @Summary Detect the type of a project's workflow
+// @Description GetWorkflowType detects the workflow input/output modalities
+// @Tags demo
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.WorkflowTypeResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/workflow-type [get]
 func (ctrl *DemoController) GetWorkflowType(c *fiber.Ctx) error {
-	return services.GetWorkflowType(c, ctrl.repo)
+	return services.GetWorkflowType(c, ctrl.repo.WithContext(c.UserContext()))
 }
 
 // GenerateTTS handles POST /projects/:id/tts
+// @Summary Turn text into speech
+// @Description GenerateTTS proxies the TTS request to the AI service and streams the response
+// @Tags demo
+// @Accept json
+// @Produce octet-stream
+// @Param id path string true "Project ID"
+// @Param body body services.TTSRequest true "Request body"
+// @Success 200 {file} file
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure 503 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/tts [post]
 func (ctrl *DemoController) GenerateTTS(c *fiber.Ctx) error {
-	return services.GenerateTTS(c, ctrl.repo)
+	return services.GenerateTTS(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// ListExecutions handles GET /projects/:id/executions
+// @Summary List the runs of a project
+// @Description ListExecutions returns a page of the workflow runs of a project, newest first. Pass the returned next_cursor as ?cursor= to get the next page.
+// @Tags demo
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param limit query integer false "Limit"
+// @Param cursor query string false "Cursor"
+// @Success 200 {object} services.ExecutionsPage
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/executions [get]
+func (ctrl *DemoController) ListExecutions(c *fiber.Ctx) error {
+	return services.ListExecutions(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// ReadSheet handles POST /projects/:id/sheets/read
+// @Summary Read a range of a Google spreadsheet
+// @Description ReadSheet returns the values of a range of a spreadsheet as a 2D array, read with the project owner's Google account
+// @Tags sheets
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.SheetsReadRequest true "Request body"
+// @Success 200 {array} []interface{}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure 502 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/sheets/read [post]
+func (ctrl *DemoController) ReadSheet(c *fiber.Ctx) error {
+	return services.ReadSheet(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// WriteSheet handles POST /projects/:id/sheets/write
+// @Summary Write a range of a Google spreadsheet
+// @Description WriteSheet overwrites a range of a spreadsheet with the project owner's Google account
+// @Tags sheets
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.SheetsWriteRequest true "Request body"
+// @Success 200 {object} services.SheetsWriteResult
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure 502 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/sheets/write [post]
+func (ctrl *DemoController) WriteSheet(c *fiber.Ctx) error {
+	return services.WriteSheet(c, ctrl.repo.WithContext(c.UserContext()))
 }
@@ -18,31 +18,494 @@ func NewDocumentController(repo *repository.ProjectRepository) *DocumentControll
 }
 
 // UploadDocument handles POST /projects/:id/documents
+// @Summary Upload a document
+// @Description UploadDocument handles document upload for a project. An optional nodeId form field limits the file types to those the node's type takes.
+// @Tags documents
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param file formData file true "File to upload"
+// @Param nodeId formData string false "Node the document is for"
+// @Success 201 {object} services.DocumentInfo
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents [post]
 func (ctrl *DocumentController) UploadDocument(c *fiber.Ctx) error {
-	return services.UploadDocument(c, ctrl.repo)
+	return services.UploadDocument(c, ctrl.repo.WithContext(c.UserContext()))
 }
 
 // DeleteDocument handles DELETE /projects/:id/documents/:docId
+// @Summary Delete a document or move it to the trash
+// @Description DeleteDocument handles document deletion for a project
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Param permanent query boolean false "Permanent"
+// @Success 200 {object} services.DocumentDeleted
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId} [delete]
 func (ctrl *DocumentController) DeleteDocument(c *fiber.Ctx) error {
-	return services.DeleteDocument(c, ctrl.repo)
+	return services.DeleteDocument(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// GetDocumentSignedURL handles GET /projects/:id/documents/:docId/signed-url
+// @Summary Get a signed download URL for a document
+// @Description GetDocumentSignedURL returns a time-limited link to a document that works without a login
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Success 200 {object} services.SignedURL
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/signed-url [get]
+func (ctrl *DocumentController) GetDocumentSignedURL(c *fiber.Ctx) error {
+	return services.GetDocumentSignedURL(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// ServeSignedFile handles GET /api/files/:token
+// @Summary Download a document by signed URL
+// @Description ServeSignedFile serves the document named by a file token. Tampered and expired tokens are refused with 403.
+// @Tags public
+// @Produce octet-stream
+// @Param token path string true "Signed URL token"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 416 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/files/{token} [get]
+func (ctrl *DocumentController) ServeSignedFile(c *fiber.Ctx) error {
+	return services.ServeSignedFile(c)
+}
+
+// DeleteAllDocuments handles DELETE /projects/:id/documents
+// @Summary Delete all documents of a project
+// @Description DeleteAllDocuments permanently deletes every document of a project, in the trash or not, with its earlier versions, empties its rag-documents node and drops its embedding index on the AI service. It returns how many files and bytes were removed.
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.DocumentsPurged
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents [delete]
+func (ctrl *DocumentController) DeleteAllDocuments(c *fiber.Ctx) error {
+	return services.DeleteAllDocuments(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// UpdateDocument handles PATCH /projects/:id/documents/:docId
+// @Summary Rename a document
+// @Description UpdateDocument renames a document or changes its status. Stored files are named after the document ID, not its display name, so nothing is renamed on disk.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Param body body services.UpdateDocumentPayload true "Request body"
+// @Success 200 {object} services.DocumentInfo
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId} [patch]
+func (ctrl *DocumentController) UpdateDocument(c *fiber.Ctx) error {
+	return services.UpdateDocument(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// RestoreDocument handles POST /projects/:id/documents/:docId/restore
+// @Summary Restore a document from the trash
+// @Description RestoreDocument moves a document out of the trash
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Success 200 {object} services.DocumentInfo
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/restore [post]
+func (ctrl *DocumentController) RestoreDocument(c *fiber.Ctx) error {
+	return services.RestoreDocument(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// ListDocumentVersions handles GET /projects/:id/documents/:docId/versions
+// @Summary List the earlier versions of a document
+// @Description ListDocumentVersions lists every version of a document, newest first
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Success 200 {object} services.DocumentVersions
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/versions [get]
+func (ctrl *DocumentController) ListDocumentVersions(c *fiber.Ctx) error {
+	return services.ListDocumentVersions(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// UploadDocumentVersion handles POST /projects/:id/documents/:docId/versions
+// @Summary Upload a new version of a document
+// @Description UploadDocumentVersion stores the uploaded "file" as the next version of an existing document
+// @Tags documents
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Param file formData file true "File to upload"
+// @Success 201 {object} services.DocumentInfo
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/versions [post]
+func (ctrl *DocumentController) UploadDocumentVersion(c *fiber.Ctx) error {
+	return services.UploadDocumentVersion(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// RestoreDocumentVersion handles POST /projects/:id/documents/:docId/versions/:version/restore
+// @Summary Restore an earlier version of a document
+// @Description RestoreDocumentVersion makes an earlier version of a document the latest one again: its file is copied into a new version, so the version it replaces is kept as well
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Param version path string true "Document version"
+// @Success 200 {object} services.DocumentInfo
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/versions/{version}/restore [post]
+func (ctrl *DocumentController) RestoreDocumentVersion(c *fiber.Ctx) error {
+	return services.RestoreDocumentVersion(c, ctrl.repo.WithContext(c.UserContext()))
 }
 
 // ListDocuments handles GET /projects/:id/documents
+// @Summary List the documents of a project
+// @Description ListDocuments lists all documents for a project
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {array} services.DocumentInfo
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents [get]
 func (ctrl *DocumentController) ListDocuments(c *fiber.Ctx) error {
-	return services.ListDocuments(c, ctrl.repo)
+	return services.ListDocuments(c, ctrl.repo.WithContext(c.UserContext()))
 }
 
 // GetDocumentFile handles GET /projects/:id/documents/:docId/file
+// @Summary Get the file of a document
+// @Description GetDocumentFile serves a document file for the AI service; ?download=true sends it as an attachment and ?version= serves an earlier version
+// @Tags documents
+// @Produce octet-stream
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Param download query boolean false "Download"
+// @Param version query string false "Version"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 416 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/file [get]
 func (ctrl *DocumentController) GetDocumentFile(c *fiber.Ctx) error {
-	return services.GetDocumentFile(c, ctrl.repo)
+	return services.GetDocumentFile(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// DownloadDocument handles GET and HEAD /projects/:id/documents/:docId/download
+// @Summary Download a document
+// @Description DownloadDocument serves a document as an attachment under its original file name, or an earlier version given by ?version=. Registered with Get, so HEAD returns the same headers without the body.
+// @Tags documents
+// @Produce octet-stream
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Param version query string false "Version"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 416 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/download [get]
+// @Router /api/v1/projects/{id}/documents/{docId}/download [head]
+func (ctrl *DocumentController) DownloadDocument(c *fiber.Ctx) error {
+	return services.DownloadDocument(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// PreviewDocument handles GET /projects/:id/documents/:docId/preview
+// @Summary Preview the text of a document
+// @Description PreviewDocument returns the first ?kb= kilobytes (default 4, at most 64) of the text extracted from a document. When a PDF or Word file can't be extracted because the AI service is down, it answers with available set to false instead of failing.
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Param kb query integer false "Kb"
+// @Success 200 {object} services.DocumentPreview
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure 502 {object} response.ErrorResponse
+// @Failure 503 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/preview [get]
+func (ctrl *DocumentController) PreviewDocument(c *fiber.Ctx) error {
+	return services.PreviewDocument(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// GetDocumentRows handles GET /projects/:id/documents/:docId/rows
+// @Summary Get rows of a CSV or spreadsheet document
+// @Description GetDocumentRows returns the columns and a page of the rows (?limit=, default 50, and ?offset=) of a CSV or spreadsheet document
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Param limit query integer false "Limit"
+// @Param offset query integer false "Offset"
+// @Success 200 {object} services.DocumentRows
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/rows [get]
+func (ctrl *DocumentController) GetDocumentRows(c *fiber.Ctx) error {
+	return services.GetDocumentRows(c, ctrl.repo.WithContext(c.UserContext()))
 }
 
 // GetProjectDocumentsPath handles GET /projects/:id/documents-path
+// @Summary Get the document directory of a project
+// @Description GetProjectDocumentsPath returns the path to project documents (for AI service)
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.DocumentsPath
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents-path [get]
 func (ctrl *DocumentController) GetProjectDocumentsPath(c *fiber.Ctx) error {
-	return services.GetProjectDocumentsPath(c, ctrl.repo)
+	return services.GetProjectDocumentsPath(c, ctrl.repo.WithContext(c.UserContext()))
 }
 
 // EmbedDocuments handles POST /projects/:id/documents/embed
+// @Summary Queue embedding of all documents of a project
+// @Description EmbedProjectDocuments queues embedding all documents in a project and returns 202 with the job to poll; the AI call runs on the worker pool.
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 202 {object} services.EmbeddingQueued
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure 503 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/embed [post]
 func (ctrl *DocumentController) EmbedDocuments(c *fiber.Ctx) error {
-	return services.EmbedProjectDocuments(c, ctrl.repo)
+	return services.EmbedProjectDocuments(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// GetEmbeddingJob handles GET /projects/:id/embeddings/:jobId and /projects/:id/documents/embed/:jobId
+// @Summary Get an embedding job
+// @Description GetEmbeddingJob returns the status of an embedding job of a project
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param jobId path string true "Embedding job ID"
+// @Success 200 {object} repository.EmbeddingJob
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/embed/{jobId} [get]
+// @Router /api/v1/projects/{id}/embeddings/{jobId} [get]
+func (ctrl *DocumentController) GetEmbeddingJob(c *fiber.Ctx) error {
+	return services.GetEmbeddingJob(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// EmbedDocument handles POST /projects/:id/documents/:docId/embed
+// @Summary Queue embedding of one document
+// @Description EmbedDocument queues re-embedding a single document of a project and returns 202 with the job to poll
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param docId path string true "Document ID"
+// @Success 202 {object} services.EmbeddingQueued
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure 503 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/{docId}/embed [post]
+func (ctrl *DocumentController) EmbedDocument(c *fiber.Ctx) error {
+	return services.EmbedDocument(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// GetDocumentLimits handles GET /projects/document-limits
+// @Summary Get the document upload limits
+// @Description GetDocumentLimits returns the upload limits so the editor can validate files before sending them
+// @Tags documents
+// @Produce json
+// @Success 200 {object} services.DocumentLimits
+// @Failure 401 {object} response.ErrorResponse
+// @Router /api/v1/projects/document-limits [get]
+func (ctrl *DocumentController) GetDocumentLimits(c *fiber.Ctx) error {
+	return services.GetDocumentLimits(c)
+}
+
+// CreateDocumentUpload handles POST /projects/:id/documents/uploads
+// @Summary Start a chunked document upload
+// @Description CreateDocumentUpload starts a resumable upload of one document
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.CreateUploadPayload true "Request body"
+// @Success 201 {object} services.UploadView
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/uploads [post]
+func (ctrl *DocumentController) CreateDocumentUpload(c *fiber.Ctx) error {
+	return services.CreateDocumentUpload(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// GetDocumentUpload handles GET /projects/:id/documents/uploads/:uploadId
+// @Summary Get a chunked document upload
+// @Description GetDocumentUpload returns an upload with the chunks still missing, so an interrupted client knows what to resend
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param uploadId path string true "Upload ID"
+// @Success 200 {object} services.UploadView
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 410 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/uploads/{uploadId} [get]
+func (ctrl *DocumentController) GetDocumentUpload(c *fiber.Ctx) error {
+	return services.GetDocumentUpload(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// PutDocumentUploadChunk handles PUT /projects/:id/documents/uploads/:uploadId/chunks/:n
+// @Summary Upload a chunk of a document
+// @Description PutDocumentUploadChunk stores chunk :n of an upload from the raw request body. Resending a chunk replaces it. An optional X-Chunk-SHA256 header is checked against the body.
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param uploadId path string true "Upload ID"
+// @Param n path string true "Chunk number"
+// @Success 200 {object} services.UploadChunkStored
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 410 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/uploads/{uploadId}/chunks/{n} [put]
+func (ctrl *DocumentController) PutDocumentUploadChunk(c *fiber.Ctx) error {
+	return services.PutDocumentUploadChunk(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// CompleteDocumentUpload handles POST /projects/:id/documents/uploads/:uploadId/complete
+// @Summary Complete a chunked document upload
+// @Description CompleteDocumentUpload assembles the chunks of an upload, checks its hash and stores it as a document like a normal upload
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param uploadId path string true "Upload ID"
+// @Success 201 {object} services.DocumentInfo
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 410 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/uploads/{uploadId}/complete [post]
+func (ctrl *DocumentController) CompleteDocumentUpload(c *fiber.Ctx) error {
+	return services.CompleteDocumentUpload(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// AbortDocumentUpload handles DELETE /projects/:id/documents/uploads/:uploadId
+// @Summary Abort a chunked document upload
+// @Description AbortDocumentUpload discards an upload and its chunks
+// @Tags documents
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param uploadId path string true "Upload ID"
+// @Success 204
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 410 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/documents/uploads/{uploadId} [delete]
+func (ctrl *DocumentController) AbortDocumentUpload(c *fiber.Ctx) error {
+	return services.AbortDocumentUpload(c, ctrl.repo.WithContext(c.UserContext()))
 }
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"manju/backend/repository"
+	"manju/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MemberController handles project collaborator HTTP requests
+type MemberController struct {
+	repo       *repository.ProjectRepository
+	memberRepo *repository.ProjectMemberRepository
+	userRepo   *repository.UserRepository
+}
+
+// NewMemberController creates a new MemberController
+func NewMemberController(repo *repository.ProjectRepository, memberRepo *repository.ProjectMemberRepository, userRepo *repository.UserRepository) *MemberController {
+	return &MemberController{repo: repo, memberRepo: memberRepo, userRepo: userRepo}
+}
+
+// ListMembers handles GET /projects/:id/members
+// @Summary List the collaborators of a project
+// @Description ListMembers returns the collaborators and pending invites of a project
+// @Tags members
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.ProjectMembers
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/members [get]
+func (mc *MemberController) ListMembers(c *fiber.Ctx) error {
+	return services.ListMembers(c, mc.repo.WithContext(c.UserContext()), mc.memberRepo)
+}
+
+// InviteMember handles POST /projects/:id/members
+// @Summary Invite a collaborator to a project
+// @Description InviteMember adds a collaborator by email. Emails without an account are stored as pending invites and linked when that user first logs in.
+// @Tags members
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.InviteMemberPayload true "Request body"
+// @Success 201 {object} repository.ProjectMember
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/members [post]
+func (mc *MemberController) InviteMember(c *fiber.Ctx) error {
+	return services.InviteMember(c, mc.repo.WithContext(c.UserContext()), mc.memberRepo, mc.userRepo.WithContext(c.UserContext()))
+}
+
+// UpdateMember handles PUT /projects/:id/members/:memberId
+// @Summary Change the role of a collaborator
+// @Description UpdateMember changes a collaborator's role
+// @Tags members
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param memberId path string true "Member ID"
+// @Param body body services.UpdateMemberPayload true "Request body"
+// @Success 200 {object} repository.ProjectMember
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/members/{memberId} [put]
+func (mc *MemberController) UpdateMember(c *fiber.Ctx) error {
+	return services.UpdateMember(c, mc.repo.WithContext(c.UserContext()), mc.memberRepo)
+}
+
+// RemoveMember handles DELETE /projects/:id/members/:memberId
+// @Summary Remove a collaborator from a project
+// @Description RemoveMember removes a collaborator or cancels a pending invite
+// @Tags members
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param memberId path string true "Member ID"
+// @Success 200 {object} response.MessageResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/members/{memberId} [delete]
+func (mc *MemberController) RemoveMember(c *fiber.Ctx) error {
+	return services.RemoveMember(c, mc.repo.WithContext(c.UserContext()), mc.memberRepo)
+}
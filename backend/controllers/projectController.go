@@ -15,22 +15,566 @@ func NewProjectController(repo *repository.ProjectRepository) *ProjectController
 	return &ProjectController{repo: repo}
 }
 
+// @Summary Create a project
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param skip_validation query boolean false "Skip validation"
+// @Param body body services.CreateProjectPayload true "Request body"
+// @Success 201 {object} repository.Project
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects [post]
 func (pc *ProjectController) CreateProject(c *fiber.Ctx) error {
-	return services.CreateProject(c, pc.repo)
+	return services.CreateProject(c, pc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary List the projects the caller can access
+// @Tags projects
+// @Produce json
+// @Param status query string false "Status"
+// @Param tag query string false "Tag"
+// @Param include query string false "Include"
+// @Param favorites query boolean false "Favorites"
+// @Success 200 {array} repository.Project
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects [get]
 func (pc *ProjectController) ListProjects(c *fiber.Ctx) error {
-	return services.ListProjects(c, pc.repo)
+	return services.ListProjects(c, pc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Get a project
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} repository.Project
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id} [get]
 func (pc *ProjectController) GetProject(c *fiber.Ctx) error {
-	return services.GetProject(c, pc.repo)
+	return services.GetProject(c, pc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Update a project
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param skip_validation query boolean false "Skip validation"
+// @Param body body services.UpdateProjectPayload true "Request body"
+// @Success 200 {object} repository.Project
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id} [put]
 func (pc *ProjectController) UpdateProject(c *fiber.Ctx) error {
-	return services.UpdateProject(c, pc.repo)
+	return services.UpdateProject(c, pc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Delete a project
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} response.MessageResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id} [delete]
 func (pc *ProjectController) DeleteProject(c *fiber.Ctx) error {
-	return services.DeleteProject(c, pc.repo)
+	return services.DeleteProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Export a project as a bundle
+// @Description ExportProject returns a project as a portable bundle, in JSON or, with ?format=yaml, YAML
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param format query string false "Format"
+// @Param include_documents query boolean false "Include documents"
+// @Success 200 {object} services.ProjectBundle
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/export [get]
+func (pc *ProjectController) ExportProject(c *fiber.Ctx) error {
+	return services.ExportProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Import a project bundle
+// @Description ImportProject creates a new project for the caller from an export bundle. It accepts either a JSON or YAML body (by Content-Type) or a multipart form with a "bundle" field and optional "documents" files.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param body body services.ProjectBundle true "Request body"
+// @Success 201 {object} services.ImportResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/import [post]
+func (pc *ProjectController) ImportProject(c *fiber.Ctx) error {
+	return services.ImportProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Duplicate a project with its documents
+// @Description DuplicateProject copies a project the caller may view into a new draft owned by the caller, named by the optional "name" field or "<name> (copy)". The workflow gets fresh node IDs and the documents are copied with it.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.DuplicateProjectPayload true "Request body"
+// @Success 201 {object} repository.Project
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/duplicate [post]
+func (pc *ProjectController) DuplicateProject(c *fiber.Ctx) error {
+	return services.DuplicateProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Check whether a project name is available
+// @Description CheckProjectName reports whether a project name is still available for the caller. An optional exclude_id ignores the project being renamed.
+// @Tags projects
+// @Produce json
+// @Param name query string false "Name"
+// @Param exclude_id query string false "Exclude id"
+// @Success 200 {object} services.ProjectNameAvailability
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/check-name [get]
+func (pc *ProjectController) CheckProjectName(c *fiber.Ctx) error {
+	return services.CheckProjectName(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Patch the data of a workflow node
+// @Description PatchNode merges a partial data object into a single workflow node. Keys set to null are removed from the node's data. The update runs under a row lock so concurrent patches to different nodes do not overwrite each other.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param nodeId path string true "Node ID"
+// @Param body body services.NodePatch true "Request body"
+// @Success 200 {object} repository.Project
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/nodes/{nodeId} [patch]
+func (pc *ProjectController) PatchNode(c *fiber.Ctx) error {
+	return services.PatchNode(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Archive a project
+// @Description ArchiveProject moves a project to the archived status. With ?cleanup_documents=true its documents are also moved to archive storage.
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param cleanup_documents query boolean false "Cleanup documents"
+// @Success 200 {object} repository.Project
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/archive [post]
+func (pc *ProjectController) ArchiveProject(c *fiber.Ctx) error {
+	return services.ArchiveProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Unarchive a project
+// @Description UnarchiveProject moves an archived project back to draft. With ?restore_documents=true documents moved to archive storage are brought back.
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param restore_documents query boolean false "Restore documents"
+// @Success 200 {object} repository.Project
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/unarchive [post]
+func (pc *ProjectController) UnarchiveProject(c *fiber.Ctx) error {
+	return services.UnarchiveProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary List the tags of the caller's projects
+// @Description ListProjectTags returns the caller's distinct project tags with usage counts
+// @Tags projects
+// @Produce json
+// @Success 200 {array} repository.TagCount
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/tags [get]
+func (pc *ProjectController) ListProjectTags(c *fiber.Ctx) error {
+	return services.ListProjectTags(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Get the stats of a project
+// @Description GetProjectStats returns node, document and run statistics for a project
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.ProjectStats
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/stats [get]
+func (pc *ProjectController) GetProjectStats(c *fiber.Ctx) error {
+	return services.GetProjectStats(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Get the token usage of a project per day
+// @Description GetTokenUsage returns the tokens a project's executions used per day between ?from= and ?to= (RFC 3339 or YYYY-MM-DD; a date-only to includes that day), with their cost
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param from query string false "From"
+// @Param to query string false "To"
+// @Success 200 {array} services.TokenUsageDay
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/token-usage [get]
+func (pc *ProjectController) GetTokenUsage(c *fiber.Ctx) error {
+	return services.GetTokenUsage(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Reset the tokens a project has used
+// @Description ResetTokenUsage zeroes the tokens a project has used against its budget
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.TokenUsageReset
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/reset-token-usage [post]
+func (pc *ProjectController) ResetTokenUsage(c *fiber.Ctx) error {
+	return services.ResetTokenUsage(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Get the complexity of a project's workflow
+// @Description GetProjectComplexity analyses a project's graph and returns its complexity report. It is computed locally, without the AI service.
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.ComplexityReport
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/complexity [get]
+func (pc *ProjectController) GetProjectComplexity(c *fiber.Ctx) error {
+	return services.GetProjectComplexity(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Delete several projects
+// @Description BulkDeleteProjects deletes every listed project owned by the caller. IDs that don't exist or belong to someone else are reported as skipped instead of failing the whole batch.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param body body services.BulkDeletePayload true "Request body"
+// @Success 200 {object} services.BulkDeleteResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/bulk-delete [post]
+func (pc *ProjectController) BulkDeleteProjects(c *fiber.Ctx) error {
+	return services.BulkDeleteProjects(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Upload the thumbnail of a project
+// @Description UploadThumbnail stores a JPEG or PNG preview image for a project, cropped and resized to 640x360
+// @Tags projects
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param thumbnail formData file true "File to upload"
+// @Success 200 {object} services.ThumbnailUploaded
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/thumbnail [put]
+func (pc *ProjectController) UploadThumbnail(c *fiber.Ctx) error {
+	return services.UploadThumbnail(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Get the thumbnail of a project
+// @Description GetThumbnail serves the thumbnail of a project
+// @Tags projects
+// @Produce octet-stream
+// @Param id path string true "Project ID"
+// @Success 200 {file} file
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/thumbnail [get]
+func (pc *ProjectController) GetThumbnail(c *fiber.Ctx) error {
+	return services.GetThumbnail(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Render a preview image of a workflow
+// @Description GenerateWorkflowPreview renders the preview image of a project's workflow and returns where it is served
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.WorkflowPreview
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/preview [post]
+func (pc *ProjectController) GenerateWorkflowPreview(c *fiber.Ctx) error {
+	return services.GenerateWorkflowPreview(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Get the preview image of a workflow
+// @Description GetWorkflowPreview serves the preview image of a project
+// @Tags projects
+// @Produce octet-stream
+// @Param id path string true "Project ID"
+// @Success 200 {file} file
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/preview [get]
+func (pc *ProjectController) GetWorkflowPreview(c *fiber.Ctx) error {
+	return services.GetWorkflowPreview(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Delete the thumbnail of a project
+// @Description DeleteThumbnail removes the thumbnail of a project
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} response.MessageResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/thumbnail [delete]
+func (pc *ProjectController) DeleteThumbnail(c *fiber.Ctx) error {
+	return services.DeleteThumbnail(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Mark a project as a favorite
+// @Description FavoriteProject pins a project the caller can view; favoriting twice is harmless
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.FavoriteResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/favorite [post]
+func (pc *ProjectController) FavoriteProject(c *fiber.Ctx) error {
+	return services.FavoriteProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Remove a project from the favorites
+// @Description UnfavoriteProject unpins a project; unfavoriting a project that isn't pinned is harmless
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} services.FavoriteResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/favorite [delete]
+func (pc *ProjectController) UnfavoriteProject(c *fiber.Ctx) error {
+	return services.UnfavoriteProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Publish a project as a public bot
+// @Description PublishProject publishes the current version of a project so the public endpoint runs it; later edits don't change the bot until it is republished
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} repository.Project
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/publish [post]
+func (pc *ProjectController) PublishProject(c *fiber.Ctx) error {
+	return services.PublishProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Unpublish a project
+// @Description UnpublishProject takes a published project offline
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} repository.Project
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/unpublish [post]
+func (pc *ProjectController) UnpublishProject(c *fiber.Ctx) error {
+	return services.UnpublishProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Chat with a published bot
+// @Description PublicChat runs the published snapshot of the project behind :slug. It needs no login; the run is billed to and recorded for the project owner.
+// @Tags public
+// @Accept json
+// @Produce json
+// @Param slug path string true "Public slug of the bot"
+// @Param body body services.DemoRequest true "Request body"
+// @Success 200 {object} services.PublicChatResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure 502 {object} response.ErrorResponse
+// @Router /public/bots/{slug}/chat [post]
+func (pc *ProjectController) PublicChat(c *fiber.Ctx) error {
+	return services.PublicChat(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Run a project from its signed inbound webhook
+// @Description TriggerProjectWebhook verifies a signed inbound webhook and starts a run of the project with the body's message, as the project owner. It answers 202 with the execution ID without waiting for the AI service.
+// @Tags public
+// @Accept json
+// @Produce json
+// @Param projectId path string true "Project ID"
+// @Param body body services.WebhookTriggerRequest true "Request body"
+// @Success 202 {object} services.WebhookTriggered
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 429 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /webhooks/trigger/{projectId} [post]
+func (pc *ProjectController) TriggerWebhook(c *fiber.Ctx) error {
+	return services.TriggerProjectWebhook(c)
+}
+
+// VerifyWebhook checks the signature of an inbound webhook before
+// TriggerWebhook, and before its rate limit
+func (pc *ProjectController) VerifyWebhook(c *fiber.Ctx) error {
+	return services.VerifyProjectWebhook(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Record that the caller opened a project
+// @Description OpenProject records that the caller opened a project, for the recently opened list. Kept separate from GET so prefetching doesn't count as opening.
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 204
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/open [post]
+func (pc *ProjectController) OpenProject(c *fiber.Ctx) error {
+	return services.OpenProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary List the projects the caller opened last
+// @Description ListRecentProjects returns the projects the caller opened most recently
+// @Tags projects
+// @Produce json
+// @Param limit query integer false "Limit"
+// @Success 200 {array} repository.Project
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/recent [get]
+func (pc *ProjectController) ListRecentProjects(c *fiber.Ctx) error {
+	return services.ListRecentProjects(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Get the settings of a project
+// @Description GetProjectSettings returns the project-wide model defaults
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {object} repository.ProjectSettings
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/settings [get]
+func (pc *ProjectController) GetProjectSettings(c *fiber.Ctx) error {
+	return services.GetProjectSettings(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Update the settings of a project
+// @Description UpdateProjectSettings replaces the project-wide model defaults
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body repository.ProjectSettings true "Request body"
+// @Success 200 {object} repository.ProjectSettings
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/settings [put]
+func (pc *ProjectController) UpdateProjectSettings(c *fiber.Ctx) error {
+	return services.UpdateProjectSettings(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Autosave a project's workflow
+// @Description AutosaveProject saves the editor's workflow, merging it node by node with changes saved since base_version. Nodes changed on only one side are taken from that side; nodes changed on both sides are returned as a 409 so the editor can resolve them.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.AutosavePayload true "Request body"
+// @Success 200 {object} services.AutosaveResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/autosave [put]
+func (pc *ProjectController) AutosaveProject(c *fiber.Ctx) error {
+	return services.AutosaveProject(c, pc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Compare two versions of a workflow
+// @Description DiffProjectVersions returns the structural diff between versions :a and :b of a project; the current version is read from the project itself
+// @Tags projects
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param a path string true "Version to compare from"
+// @Param b path string true "Version to compare to"
+// @Success 200 {object} services.WorkflowDiff
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/versions/{a}/diff/{b} [get]
+func (pc *ProjectController) DiffProjectVersions(c *fiber.Ctx) error {
+	return services.DiffProjectVersions(c, pc.repo.WithContext(c.UserContext()))
 }
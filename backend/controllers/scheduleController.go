@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"manju/backend/repository"
+	"manju/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ScheduleController handles project schedule HTTP requests
+type ScheduleController struct {
+	repo         *repository.ProjectRepository
+	scheduleRepo *repository.ScheduleRepository
+}
+
+// NewScheduleController creates a new ScheduleController
+func NewScheduleController(repo *repository.ProjectRepository, scheduleRepo *repository.ScheduleRepository) *ScheduleController {
+	return &ScheduleController{repo: repo, scheduleRepo: scheduleRepo}
+}
+
+// CreateSchedule handles POST /projects/:id/schedules
+// @Summary Schedule runs of a project
+// @Description CreateSchedule adds a cron schedule to a project
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.SchedulePayload true "Request body"
+// @Success 201 {object} repository.Schedule
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/schedules [post]
+func (sc *ScheduleController) CreateSchedule(c *fiber.Ctx) error {
+	return services.CreateSchedule(c, sc.repo.WithContext(c.UserContext()), sc.scheduleRepo)
+}
+
+// ListSchedules handles GET /projects/:id/schedules
+// @Summary List the schedules of a project
+// @Description ListSchedules returns the schedules of a project
+// @Tags schedules
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {array} repository.Schedule
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/schedules [get]
+func (sc *ScheduleController) ListSchedules(c *fiber.Ctx) error {
+	return services.ListSchedules(c, sc.repo.WithContext(c.UserContext()), sc.scheduleRepo)
+}
+
+// UpdateSchedule handles PUT /projects/:id/schedules/:schedId
+// @Summary Update a schedule
+// @Description UpdateSchedule changes a schedule's expression, message or enabled flag
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param schedId path string true "Schedule ID"
+// @Param body body services.SchedulePayload true "Request body"
+// @Success 200 {object} repository.Schedule
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/schedules/{schedId} [put]
+func (sc *ScheduleController) UpdateSchedule(c *fiber.Ctx) error {
+	return services.UpdateSchedule(c, sc.repo.WithContext(c.UserContext()), sc.scheduleRepo)
+}
+
+// DeleteSchedule handles DELETE /projects/:id/schedules/:schedId
+// @Summary Delete a schedule
+// @Description DeleteSchedule removes a schedule from a project
+// @Tags schedules
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param schedId path string true "Schedule ID"
+// @Success 200 {object} response.MessageResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/schedules/{schedId} [delete]
+func (sc *ScheduleController) DeleteSchedule(c *fiber.Ctx) error {
+	return services.DeleteSchedule(c, sc.repo.WithContext(c.UserContext()), sc.scheduleRepo)
+}
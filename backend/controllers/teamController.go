@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"manju/backend/repository"
+	"manju/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TeamController handles team HTTP requests
+type TeamController struct {
+	repo     *repository.TeamRepository
+	userRepo *repository.UserRepository
+}
+
+// NewTeamController creates a new TeamController
+func NewTeamController(repo *repository.TeamRepository, userRepo *repository.UserRepository) *TeamController {
+	return &TeamController{repo: repo, userRepo: userRepo}
+}
+
+// CreateTeam handles POST /teams
+// @Summary Create a team
+// @Description CreateTeam creates a team with the caller as its owner
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param body body services.TeamPayload true "Request body"
+// @Success 201 {object} repository.Team
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/teams [post]
+func (ctrl *TeamController) CreateTeam(c *fiber.Ctx) error {
+	return services.CreateTeam(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// ListTeams handles GET /teams
+// @Summary List the caller's teams
+// @Description ListTeams returns the teams the caller belongs to, with their role in each
+// @Tags teams
+// @Produce json
+// @Success 200 {array} repository.Team
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/teams [get]
+func (ctrl *TeamController) ListTeams(c *fiber.Ctx) error {
+	return services.ListTeams(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// GetTeam handles GET /teams/:id
+// @Summary Get a team
+// @Description GetTeam returns a team the caller belongs to
+// @Tags teams
+// @Produce json
+// @Param id path string true "Team ID"
+// @Success 200 {object} repository.Team
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/teams/{id} [get]
+func (ctrl *TeamController) GetTeam(c *fiber.Ctx) error {
+	return services.GetTeam(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// UpdateTeam handles PUT /teams/:id
+// @Summary Rename a team
+// @Description UpdateTeam renames a team. Owner only.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param body body services.TeamPayload true "Request body"
+// @Success 200 {object} repository.Team
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/teams/{id} [put]
+func (ctrl *TeamController) UpdateTeam(c *fiber.Ctx) error {
+	return services.UpdateTeam(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// DeleteTeam handles DELETE /teams/:id
+// @Summary Delete a team
+// @Description DeleteTeam deletes a team. Its projects stay with their owners. Owner only.
+// @Tags teams
+// @Produce json
+// @Param id path string true "Team ID"
+// @Success 200 {object} response.MessageResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/teams/{id} [delete]
+func (ctrl *TeamController) DeleteTeam(c *fiber.Ctx) error {
+	return services.DeleteTeam(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// ListTeamMembers handles GET /teams/:id/members
+// @Summary List the members of a team
+// @Description ListTeamMembers returns the members of a team
+// @Tags teams
+// @Produce json
+// @Param id path string true "Team ID"
+// @Success 200 {array} repository.TeamMember
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/teams/{id}/members [get]
+func (ctrl *TeamController) ListTeamMembers(c *fiber.Ctx) error {
+	return services.ListTeamMembers(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// AddTeamMember handles POST /teams/:id/members
+// @Summary Add a member to a team
+// @Description AddTeamMember adds an existing user to a team. Owner only.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param body body services.AddTeamMemberPayload true "Request body"
+// @Success 201 {object} repository.TeamMember
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/teams/{id}/members [post]
+func (ctrl *TeamController) AddTeamMember(c *fiber.Ctx) error {
+	return services.AddTeamMember(c, ctrl.repo.WithContext(c.UserContext()), ctrl.userRepo.WithContext(c.UserContext()))
+}
+
+// UpdateTeamMember handles PUT /teams/:id/members/:userId
+// @Summary Change the role of a team member
+// @Description UpdateTeamMember changes a member's role. Owner only; the last owner cannot be demoted.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param userId path string true "User ID"
+// @Param body body services.UpdateTeamMemberPayload true "Request body"
+// @Success 200 {object} services.TeamMemberRole
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/teams/{id}/members/{userId} [put]
+func (ctrl *TeamController) UpdateTeamMember(c *fiber.Ctx) error {
+	return services.UpdateTeamMember(c, ctrl.repo.WithContext(c.UserContext()))
+}
+
+// RemoveTeamMember handles DELETE /teams/:id/members/:userId
+// @Summary Remove a member from a team
+// @Description RemoveTeamMember removes a member from a team. Owners can remove anyone; other members can only leave. The last owner cannot leave.
+// @Tags teams
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param userId path string true "User ID"
+// @Success 200 {object} response.MessageResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/teams/{id}/members/{userId} [delete]
+func (ctrl *TeamController) RemoveTeamMember(c *fiber.Ctx) error {
+	return services.RemoveTeamMember(c, ctrl.repo.WithContext(c.UserContext()))
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"manju/backend/repository"
+	"manju/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TemplateController handles project template HTTP requests
+type TemplateController struct {
+	repo        *repository.ProjectTemplateRepository
+	projectRepo *repository.ProjectRepository
+}
+
+// NewTemplateController creates a new TemplateController
+func NewTemplateController(repo *repository.ProjectTemplateRepository, projectRepo *repository.ProjectRepository) *TemplateController {
+	return &TemplateController{repo: repo, projectRepo: projectRepo}
+}
+
+// ListTemplates handles GET /templates
+// @Summary List project templates
+// @Description ListTemplates returns all available project templates
+// @Tags templates
+// @Produce json
+// @Param category query string false "Category"
+// @Success 200 {array} repository.ProjectTemplate
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/templates [get]
+func (ctrl *TemplateController) ListTemplates(c *fiber.Ctx) error {
+	return services.ListTemplates(c, ctrl.repo)
+}
+
+// CreateProjectFromTemplate handles POST /projects/from-template/:templateId
+// @Summary Create a project from a template
+// @Description CreateProjectFromTemplate instantiates a template into a new project owned by the caller
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param templateId path string true "Template ID"
+// @Param body body services.FromTemplatePayload true "Request body"
+// @Success 201 {object} repository.Project
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/from-template/{templateId} [post]
+func (ctrl *TemplateController) CreateProjectFromTemplate(c *fiber.Ctx) error {
+	return services.CreateProjectFromTemplate(c, ctrl.projectRepo.WithContext(c.UserContext()), ctrl.repo)
+}
+
+// CreateTemplateFromProject handles POST /admin/templates/from-project/:id
+// @Summary Publish a project as a template
+// @Description CreateTemplateFromProject lets an admin publish an existing project as a template
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.TemplatePayload true "Request body"
+// @Success 201 {object} repository.ProjectTemplate
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/admin/templates/from-project/{id} [post]
+func (ctrl *TemplateController) CreateTemplateFromProject(c *fiber.Ctx) error {
+	return services.CreateTemplateFromProject(c, ctrl.projectRepo.WithContext(c.UserContext()), ctrl.repo)
+}
@@ -8,37 +8,202 @@ import (
 )
 
 type UserController struct {
-	repo *repository.UserRepository
+	repo          *repository.UserRepository
+	dashboardRepo *repository.UserDashboardRepository
 }
 
-func NewUserController(repo *repository.UserRepository) *UserController {
-	return &UserController{repo: repo}
+func NewUserController(repo *repository.UserRepository, dashboardRepo *repository.UserDashboardRepository) *UserController {
+	return &UserController{repo: repo, dashboardRepo: dashboardRepo}
 }
 
+// @Summary Create a user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body request.CreateUserPayload true "Request body"
+// @Success 201 {object} repository.User
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users [post]
 func (uc *UserController) CreateUser(c *fiber.Ctx) error {
-	return services.CreateUser(c, uc.repo)
+	return services.CreateUser(c, uc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary List users
+// @Tags users
+// @Produce json
+// @Success 200 {array} repository.User
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users [get]
 func (uc *UserController) ListUsers(c *fiber.Ctx) error {
-	return services.ListUsers(c, uc.repo)
+	return services.ListUsers(c, uc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Get a user
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} repository.User
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id} [get]
 func (uc *UserController) GetUser(c *fiber.Ctx) error {
-	return services.GetUser(c, uc.repo)
+	return services.GetUser(c, uc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Update a user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param body body request.CreateUserPayload true "Request body"
+// @Success 200 {object} repository.User
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id} [put]
 func (uc *UserController) UpdateUser(c *fiber.Ctx) error {
-	return services.UpdateUser(c, uc.repo)
+	return services.UpdateUser(c, uc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Suspend or reactivate a user
+// @Description UpdateUserStatus sets a user's status and the reason for it. Admins can't change their own status, so they can't lock themselves out.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param body body request.UpdateUserStatusPayload true "Request body"
+// @Success 200 {object} repository.User
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/status [put]
+func (uc *UserController) UpdateUserStatus(c *fiber.Ctx) error {
+	return services.UpdateUserStatus(c, uc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary List users by status
+// @Description ListUsersByStatus lists the users with the status given by ?status=
+// @Tags admin
+// @Produce json
+// @Param status query string false "Status"
+// @Success 200 {array} repository.User
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/admin/users [get]
+func (uc *UserController) ListUsersByStatus(c *fiber.Ctx) error {
+	return services.ListUsersByStatus(c, uc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Delete a user
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id} [delete]
 func (uc *UserController) DeleteUser(c *fiber.Ctx) error {
-	return services.DeleteUser(c, uc.repo)
+	return services.DeleteUser(c, uc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Save the OpenAI API key of a user
+// @Description SaveAPIKey encrypts and stores a user's API key
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param body body services.SaveAPIKeyPayload true "Request body"
+// @Success 200 {object} services.SaveAPIKeyResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Failure 502 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/api-key [put]
 func (uc *UserController) SaveAPIKey(c *fiber.Ctx) error {
-	return services.SaveAPIKey(c, uc.repo)
+	return services.SaveAPIKey(c, uc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Get the masked OpenAI API key of a user
+// @Description GetAPIKey returns a masked version of the user's API key
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} services.APIKeyStatus
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/api-key [get]
 func (uc *UserController) GetAPIKey(c *fiber.Ctx) error {
-	return services.GetAPIKey(c, uc.repo)
+	return services.GetAPIKey(c, uc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Upload the avatar of a user
+// @Description UploadAvatar stores a JPEG or PNG profile picture for a user, cropped to a square and resized to 256x256. Users may only change their own avatar unless they are an admin.
+// @Tags users
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "User ID"
+// @Param avatar formData file true "File to upload"
+// @Success 200 {object} repository.User
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/avatar [put]
+func (uc *UserController) UploadAvatar(c *fiber.Ctx) error {
+	return services.UploadAvatar(c, uc.repo.WithContext(c.UserContext()))
+}
+
+// @Summary Get the dashboard stats of a user
+// @Description GetUserDashboard returns the aggregate stats of the caller's own account
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} repository.UserStats
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/dashboard [get]
+func (uc *UserController) GetUserDashboard(c *fiber.Ctx) error {
+	return services.GetUserDashboard(c, uc.dashboardRepo.WithContext(c.UserContext()))
+}
+
+// @Summary Get the document storage used by a user
+// @Description GetUserStorage returns how much document storage the caller uses, how much of it is saved by sharing identical uploads, how it compares to the quota and how it is split across projects
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} services.UserStorage
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/storage [get]
+func (uc *UserController) GetUserStorage(c *fiber.Ctx) error {
+	return services.GetUserStorage(c)
+}
+
+// @Summary Get the avatar of a user
+// @Description GetAvatar serves a user's uploaded avatar. Users without one are redirected to the picture from their Google profile when available.
+// @Tags users
+// @Produce octet-stream
+// @Param id path string true "User ID"
+// @Success 200 {file} file
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/users/{id}/avatar [get]
+func (uc *UserController) GetAvatar(c *fiber.Ctx) error {
+	return services.GetAvatar(c, uc.repo.WithContext(c.UserContext()))
 }
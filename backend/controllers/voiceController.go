@@ -15,22 +15,65 @@ func NewVoiceController(repo *repository.VoiceRepository) *VoiceController {
 	return &VoiceController{repo: repo}
 }
 
+// @Summary Create a voice
+// @Tags voices
+// @Accept json
+// @Produce json
+// @Param body body request.CreateVoicePayload true "Request body"
+// @Success 201 {object} repository.Voice
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/voices [post]
 func (vc *VoiceController) CreateVoice(c *fiber.Ctx) error {
-	return services.CreateVoice(c, vc.repo)
+	return services.CreateVoice(c, vc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary List voices
+// @Tags voices
+// @Produce json
+// @Success 200 {array} repository.Voice
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/voices [get]
 func (vc *VoiceController) ListVoices(c *fiber.Ctx) error {
-	return services.ListVoices(c, vc.repo)
+	return services.ListVoices(c, vc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary List the voices of a user
+// @Tags voices
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Success 200 {array} repository.Voice
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/voices/user/{user_id} [get]
 func (vc *VoiceController) ListVoicesByUser(c *fiber.Ctx) error {
-	return services.ListVoicesByUser(c, vc.repo)
+	return services.ListVoicesByUser(c, vc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Get a voice
+// @Tags voices
+// @Produce json
+// @Param id path string true "Voice ID"
+// @Success 200 {object} repository.Voice
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/voices/{id} [get]
 func (vc *VoiceController) GetVoice(c *fiber.Ctx) error {
-	return services.GetVoice(c, vc.repo)
+	return services.GetVoice(c, vc.repo.WithContext(c.UserContext()))
 }
 
+// @Summary Delete a voice
+// @Tags voices
+// @Produce json
+// @Param id path string true "Voice ID"
+// @Success 204
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/voices/{id} [delete]
 func (vc *VoiceController) DeleteVoice(c *fiber.Ctx) error {
-	return services.DeleteVoice(c, vc.repo)
+	return services.DeleteVoice(c, vc.repo.WithContext(c.UserContext()))
 }
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"manju/backend/repository"
+	"manju/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WebhookController handles project webhook HTTP requests
+type WebhookController struct {
+	repo        *repository.ProjectRepository
+	webhookRepo *repository.WebhookRepository
+}
+
+// NewWebhookController creates a new WebhookController
+func NewWebhookController(repo *repository.ProjectRepository, webhookRepo *repository.WebhookRepository) *WebhookController {
+	return &WebhookController{repo: repo, webhookRepo: webhookRepo}
+}
+
+// CreateWebhook handles POST /projects/:id/webhooks
+// @Summary Create an outbound webhook
+// @Description CreateWebhook registers a webhook on a project. The signing secret is returned only in this response; it is generated when not provided.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param body body services.WebhookPayload true "Request body"
+// @Success 201 {object} services.WebhookCreated
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/webhooks [post]
+func (wc *WebhookController) CreateWebhook(c *fiber.Ctx) error {
+	return services.CreateWebhook(c, wc.repo.WithContext(c.UserContext()), wc.webhookRepo)
+}
+
+// ListWebhooks handles GET /projects/:id/webhooks
+// @Summary List the outbound webhooks of a project
+// @Description ListWebhooks returns the webhooks of a project
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Project ID"
+// @Success 200 {array} repository.Webhook
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/webhooks [get]
+func (wc *WebhookController) ListWebhooks(c *fiber.Ctx) error {
+	return services.ListWebhooks(c, wc.repo.WithContext(c.UserContext()), wc.webhookRepo)
+}
+
+// UpdateWebhook handles PUT /projects/:id/webhooks/:webhookId
+// @Summary Update an outbound webhook
+// @Description UpdateWebhook changes a webhook's URL, secret, events or enabled flag
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param webhookId path string true "Webhook ID"
+// @Param body body services.WebhookPayload true "Request body"
+// @Success 200 {object} repository.Webhook
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/webhooks/{webhookId} [put]
+func (wc *WebhookController) UpdateWebhook(c *fiber.Ctx) error {
+	return services.UpdateWebhook(c, wc.repo.WithContext(c.UserContext()), wc.webhookRepo)
+}
+
+// DeleteWebhook handles DELETE /projects/:id/webhooks/:webhookId
+// @Summary Delete an outbound webhook
+// @Description DeleteWebhook removes a webhook from a project
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Project ID"
+// @Param webhookId path string true "Webhook ID"
+// @Success 200 {object} response.MessageResponse
+// @Failure 401 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /api/v1/projects/{id}/webhooks/{webhookId} [delete]
+func (wc *WebhookController) DeleteWebhook(c *fiber.Ctx) error {
+	return services.DeleteWebhook(c, wc.repo.WithContext(c.UserContext()), wc.webhookRepo)
+}
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"manju/backend/metrics"
+)
+
+// Mode selects how a consumer is invoked
+type Mode int
+
+const (
+	// Sync consumers run in the publisher's goroutine, in registration order
+	Sync Mode = iota
+	// Async consumers run on the bus worker pool
+	Async
+)
+
+type subscription struct {
+	name    string
+	mode    Mode
+	handler func(Event)
+}
+
+type job struct {
+	sub   subscription
+	event Event
+}
+
+// Bus dispatches events to registered consumers
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string][]subscription
+	jobs chan job
+}
+
+// NewBus creates a bus with the given number of async workers
+func NewBus(workers, queueSize int) *Bus {
+	b := &Bus{
+		subs: map[string][]subscription{},
+		jobs: make(chan job, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go b.work()
+	}
+	return b
+}
+
+// Default is the process-wide bus used by the services
+var Default = NewBus(4, 1024)
+
+// Subscribe registers a typed consumer on the default bus
+func Subscribe[T Event](mode Mode, name string, fn func(T)) {
+	SubscribeOn(Default, mode, name, fn)
+}
+
+// SubscribeOn registers a typed consumer on bus b
+func SubscribeOn[T Event](b *Bus, mode Mode, name string, fn func(T)) {
+	var zero T
+	eventType := zero.EventType()
+	handler := func(e Event) {
+		if typed, ok := e.(T); ok {
+			fn(typed)
+		}
+	}
+
+	b.mu.Lock()
+	b.subs[eventType] = append(b.subs[eventType], subscription{name: name, mode: mode, handler: handler})
+	b.mu.Unlock()
+}
+
+// Publish sends an event on the default bus
+func Publish(e Event) {
+	Default.Publish(e)
+}
+
+// Publish runs sync consumers in order and queues async ones. A panicking
+// consumer is logged and counted without affecting the others.
+func (b *Bus) Publish(e Event) {
+	eventType := e.EventType()
+	metrics.Inc("events_published_" + eventType)
+
+	b.mu.RLock()
+	subs := b.subs[eventType]
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		if sub.mode == Sync {
+			b.dispatch(sub, e)
+			continue
+		}
+		select {
+		case b.jobs <- job{sub: sub, event: e}:
+		default:
+			log.Printf("[events] queue full, dropping %s for consumer %s", eventType, sub.name)
+			metrics.Inc("events_dropped_" + eventType)
+		}
+	}
+}
+
+func (b *Bus) work() {
+	for j := range b.jobs {
+		b.dispatch(j.sub, j.event)
+	}
+}
+
+// dispatch invokes a single consumer with panic isolation
+func (b *Bus) dispatch(sub subscription, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[events] consumer %s panicked on %s: %v\n%s", sub.name, e.EventType(), r, debug.Stack())
+			metrics.Inc("events_consumer_panics_" + e.EventType())
+		}
+	}()
+	sub.handler(e)
+	metrics.Inc("events_consumed_" + e.EventType())
+}
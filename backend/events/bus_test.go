@@ -0,0 +1,89 @@
+package events
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"manju/backend/metrics"
+)
+
+func TestPublish(t *testing.T) {
+	tests := []struct {
+		name string
+		// consumers are registered in order; a name ending in "!" panics
+		consumers []string
+		mode      Mode
+		want      []string
+	}{
+		{name: "sync consumers run in registration order", consumers: []string{"a", "b", "c"}, mode: Sync, want: []string{"a", "b", "c"}},
+		{name: "a panicking sync consumer doesn't stop the rest", consumers: []string{"a", "b!", "c"}, mode: Sync, want: []string{"a", "c"}},
+		{name: "a panicking async consumer doesn't stop the rest", consumers: []string{"a!", "b", "c!", "d"}, mode: Async, want: []string{"b", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One worker runs the async consumers in order too
+			b := NewBus(1, 16)
+			var mu sync.Mutex
+			var got []string
+			for _, name := range tt.consumers {
+				SubscribeOn(b, tt.mode, name, func(ProjectSaved) {
+					if name[len(name)-1] == '!' {
+						panic("consumer " + name + " failed")
+					}
+					mu.Lock()
+					got = append(got, name)
+					mu.Unlock()
+				})
+			}
+			// The last consumer runs once every earlier one has been dispatched
+			done := make(chan struct{})
+			SubscribeOn(b, tt.mode, "last", func(ProjectSaved) { close(done) })
+			SubscribeOn(b, Sync, "other", func(UserSuspended) {
+				t.Error("consumer of another event type was called")
+			})
+
+			panics := metrics.Get("events_consumer_panics_project.saved")
+			b.Publish(ProjectSaved{ProjectID: "p1", At: time.Now()})
+
+			if tt.mode == Sync {
+				// Sync consumers have all run when Publish returns
+				mu.Lock()
+				ran := len(got)
+				mu.Unlock()
+				if ran != len(tt.want) {
+					t.Fatalf("%d consumers ran before Publish returned, want %d", ran, len(tt.want))
+				}
+			}
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("consumers did not all run")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("consumers ran %v, want %v", got, tt.want)
+			}
+			wantPanics := int64(len(tt.consumers) - len(tt.want))
+			if n := metrics.Get("events_consumer_panics_project.saved") - panics; n != wantPanics {
+				t.Errorf("counted %d panics, want %d", n, wantPanics)
+			}
+		})
+	}
+}
+
+func TestPublishDropsWhenQueueIsFull(t *testing.T) {
+	// No workers, so the queue is never drained
+	b := NewBus(0, 1)
+	SubscribeOn(b, Async, "slow", func(DemoCompleted) {})
+
+	dropped := metrics.Get("events_dropped_demo.completed")
+	b.Publish(DemoCompleted{ProjectID: "p1"})
+	b.Publish(DemoCompleted{ProjectID: "p1"})
+	if n := metrics.Get("events_dropped_demo.completed") - dropped; n != 1 {
+		t.Errorf("dropped %d events, want 1", n)
+	}
+}
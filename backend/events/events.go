@@ -0,0 +1,53 @@
+package events
+
+import "time"
+
+// Event is a domain event published by the services
+type Event interface {
+	EventType() string
+}
+
+// ProjectSaved is published after a project is created or updated
+type ProjectSaved struct {
+	ProjectID string
+	UserID    string
+	Created   bool
+	At        time.Time
+}
+
+func (ProjectSaved) EventType() string { return "project.saved" }
+
+// DocumentUploaded is published after a document is stored for a project
+type DocumentUploaded struct {
+	ProjectID  string
+	UserID     string
+	DocumentID string
+	Name       string
+	Size       int64
+	At         time.Time
+}
+
+func (DocumentUploaded) EventType() string { return "document.uploaded" }
+
+// DemoCompleted is published after a workflow execution returns
+type DemoCompleted struct {
+	ProjectID        string
+	UserID           string
+	ExecutionID      string
+	Response         string
+	ModelUsed        string
+	ProcessingTimeMs float64
+	NodesExecuted    []string
+	At               time.Time
+}
+
+func (DemoCompleted) EventType() string { return "demo.completed" }
+
+// UserSuspended is published when a user's status changes to suspended
+type UserSuspended struct {
+	UserID string
+	Reason string
+	At     time.Time
+}
+
+func (UserSuspended) EventType() string { return "user.suspended" }
@@ -0,0 +1,22 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// logger writes the process's structured log records to stdout
+var logger = New(os.Stdout)
+
+// New returns a logger writing one JSON object per record to w, with the
+// time, level and msg of the record and its fields. Every level is written;
+// callers decide what is worth logging.
+func New(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// Logger returns the structured logger
+func Logger() *slog.Logger {
+	return logger
+}
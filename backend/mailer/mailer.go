@@ -0,0 +1,109 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+
+	appconfig "manju/backend/config"
+	"manju/backend/templates"
+)
+
+// welcomeTemplate renders the first-login email
+var welcomeTemplate = template.Must(template.New("welcome").Parse(templates.WelcomeEmail))
+
+// config holds the SMTP settings read from the environment
+type config struct {
+	host     string
+	port     string
+	user     string
+	pass     string
+	from     string
+	fromName string
+}
+
+// Enabled reports whether outgoing email is turned on (SMTP_ENABLED=true)
+func Enabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("SMTP_ENABLED"))) == "true"
+}
+
+// loadConfig reads SMTP_* and EMAIL_FROM* variables
+func loadConfig() (config, error) {
+	cfg := config{
+		host:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		port:     strings.TrimSpace(os.Getenv("SMTP_PORT")),
+		user:     os.Getenv("SMTP_USER"),
+		pass:     os.Getenv("SMTP_PASS"),
+		from:     strings.TrimSpace(os.Getenv("EMAIL_FROM")),
+		fromName: os.Getenv("EMAIL_FROM_NAME"),
+	}
+	if cfg.port == "" {
+		cfg.port = "587"
+	}
+	if cfg.host == "" || cfg.from == "" {
+		return cfg, fmt.Errorf("SMTP_HOST and EMAIL_FROM are required")
+	}
+	return cfg, nil
+}
+
+// send delivers an HTML email to a single recipient
+func send(to, subject, htmlBody string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	from := mail.Address{Name: cfg.fromName, Address: cfg.from}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(htmlBody)
+
+	var auth smtp.Auth
+	if cfg.user != "" {
+		auth = smtp.PlainAuth("", cfg.user, cfg.pass, cfg.host)
+	}
+	return smtp.SendMail(net.JoinHostPort(cfg.host, cfg.port), auth, cfg.from, []string{to}, msg.Bytes())
+}
+
+// SendWelcome emails a newly registered user. It is a no-op unless
+// SMTP_ENABLED=true, and only logs failures so callers can run it in a goroutine.
+func SendWelcome(email, name string) {
+	if !Enabled() || email == "" {
+		return
+	}
+
+	appURL := appconfig.FrontendURL()
+	if name == "" {
+		name = email
+	}
+
+	var body bytes.Buffer
+	err := welcomeTemplate.Execute(&body, map[string]string{
+		"AppName": "MANJU",
+		"AppURL":  appURL,
+		"Name":    name,
+		"Email":   email,
+	})
+	if err != nil {
+		log.Printf("[mailer] failed to render welcome email: %v", err)
+		return
+	}
+
+	if err := send(email, "Welcome to MANJU", body.String()); err != nil {
+		log.Printf("[mailer] failed to send welcome email to %s: %v", email, err)
+		return
+	}
+	log.Printf("[mailer] welcome email sent to %s", email)
+}
@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
 	"log"
 	"manju/backend/auth"
+	"manju/backend/config"
 	"manju/backend/config/database"
+	_ "manju/backend/docs" // registers the generated OpenAPI spec served at /api/docs
+	"manju/backend/metrics"
 	mid "manju/backend/middleware"
 	"manju/backend/repository"
+	"manju/backend/services"
+	"manju/backend/tracing"
 	"os"
 	"strings"
+	"time"
 
 	routes "manju/backend/routes"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/swagger"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/gomniauth"
@@ -20,9 +28,20 @@ import (
 	"github.com/stretchr/signature"
 )
 
+// @title Manju API
+// @version v1
+// @description Manju backend API. Routes under /api need the manju_session cookie set by signing in through /auth/login/google or /auth/login/github.
+// @BasePath /
 func main() {
 	// Load .env (if present) so env vars from the project file are available during local development
 	_ = godotenv.Load()
+	services.LoadAITimeouts()
+	if err := services.InitDocumentStorage(); err != nil {
+		log.Fatalf("document storage: %v", err)
+	}
+	if err := services.InitDocumentScanner(); err != nil {
+		log.Fatalf("document scanner: %v", err)
+	}
 
 	// ensure redirect URI is consistent and trimmed
 	redirect := strings.TrimSpace(os.Getenv("REDIRECT_URI"))
@@ -30,24 +49,56 @@ func main() {
 		redirect = "http://localhost:8000/auth/callback/google"
 	}
 
+	// Tracing is exported only when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing := tracing.Init(context.Background())
+	defer shutdownTracing(context.Background())
+
 	database.Connect()
-	app := fiber.New()
+	services.SeedBuiltinTemplates(repository.NewProjectTemplate(database.Database))
+	services.RegisterEventHandlers()
+	services.ReconcileDocuments(repository.NewDocument(database.Database), repository.NewProject(database.Database))
 
-	// CORS: allow frontend origin and enable credentials (so cookies are sent)
-	frontend := strings.TrimSpace(os.Getenv("FRONTEND_URL"))
-	if frontend == "" {
-		frontend = "http://localhost:5173"
-	}
+	// Run queued embedding jobs in the background
+	services.StartEmbeddingWorkers(repository.NewEmbeddingJob(database.Database))
+
+	// Run scheduled workflows in the background
+	go services.RunScheduler(repository.NewSchedule(database.Database), repository.NewProject(database.Database), time.Minute)
+
+	// Purge documents that have been in the trash past the retention period
+	go services.RunTrashCleaner(repository.NewDocument(database.Database), repository.NewProject(database.Database), time.Hour)
+
+	// Don't buffer bodies larger than the biggest payload any endpoint accepts
+	app := fiber.New(fiber.Config{BodyLimit: services.MaxRequestBodyBytes()})
+
+	// Tag every request with an X-Request-ID (kept when the client sends one),
+	// echoed in error responses as request_id and logged with slow queries
+	app.Use(requestid.New(requestid.Config{ContextKey: "requestID"}))
+	app.Use(mid.RequestIDContext())
+
+	// CORS: allow the frontend origins (comma-separated FRONTEND_URL, with
+	// optional *.domain wildcards) and enable credentials (so cookies are sent)
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     frontend,
+		AllowOriginsFunc: mid.AllowOrigins(config.FrontendURLs()),
 		AllowCredentials: true,
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-API-Key",
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-API-Key, traceparent, tracestate, X-Tenant-ID, X-Request-ID, X-Maintenance-Override",
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
 	}))
 
+	// Answer 503 while the server is in maintenance mode (MAINTENANCE_MODE or the lock file)
+	app.Use(mid.MaintenanceMode())
+
+	// Start a span per request, continuing any incoming traceparent
+	app.Use(mid.Tracing())
+
 	// API Key Security Layer
 	app.Use(mid.APIKeyGuard())
 
+	// Route reads after a write in the same request to the primary database
+	app.Use(mid.ReadYourWrites())
+
+	// Identify the tenant from X-Tenant-ID or the Host (replaced by the session's tenant once authenticated)
+	app.Use(mid.ResolveTenant())
+
 	// Dev helper: disable auth checks and inject a developer user into context
 	if strings.ToLower(strings.TrimSpace(os.Getenv("DISABLE_AUTH"))) == "true" {
 		devID := strings.TrimSpace(os.Getenv("DEV_USER_ID"))
@@ -82,22 +133,52 @@ func main() {
 	)
 
 	routes.AuthRoutes(app)
+	routes.PublicRoutes(app)
 
 	api := app.Group("/api")
 
 	// Apply RequireAuth middleware to all /api/* routes (except when DISABLE_AUTH is true)
 	if strings.ToLower(strings.TrimSpace(os.Getenv("DISABLE_AUTH"))) != "true" {
-		api.Use(auth.RequireAuth)
+		api.Use(mid.SessionBruteForceProtect(10, 15*time.Minute), auth.RequireAuth)
 	}
 
-	api.Get("/docs/*", swagger.HandlerDefault) // default swagger UI
+	api.Get("/docs/*", swagger.HandlerDefault) // swagger UI for the spec in docs/, generated by swag
 	api.Get("/health", func(c *fiber.Ctx) error {
 		return c.SendString("OK")
 	})
+	api.Get("/health/ai", services.AIHealth)
+	api.Get("/metrics", metrics.Handler)
+
+	// Versioned API: the routes from before /api/v1 and those added since
+	v1 := api.Group("/v1")
+	registerLegacyRoutes(v1)
+	registerAPIRoutes(v1)
 
-	routes.UserRoutes(api)
-	routes.VoiceRoutes(api)
-	routes.ProjectRoutes(api)
+	// The routes from before /api/v1 without a version, for older clients,
+	// until API_LEGACY_DEADLINE; then they answer 410 Gone
+	registerLegacyRoutes(api.Group("", mid.LegacyAPI(mid.LegacyAPIDeadline())))
 
 	log.Fatal(app.Listen(":8080"))
 }
+
+// registerLegacyRoutes mounts the API resources that existed before
+// /api/v1, served both with and without the version. This set is frozen:
+// new routes go in registerAPIRoutes.
+func registerLegacyRoutes(router fiber.Router) {
+	router.Get("/cache/stats", mid.RequireAdmin(), services.CacheStats)
+
+	routes.UserRoutes(router)
+	routes.VoiceRoutes(router)
+	routes.ProjectRoutes(router)
+	routes.TemplateRoutes(router)
+	routes.TeamRoutes(router)
+	routes.AdminRoutes(router)
+}
+
+// registerAPIRoutes mounts the API resources added since /api/v1, which
+// are only served on the versioned group
+func registerAPIRoutes(router fiber.Router) {
+	routes.UserV1Routes(router)
+	routes.ProjectV1Routes(router)
+	routes.AdminV1Routes(router)
+}
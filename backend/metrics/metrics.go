@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// counters holds named monotonically increasing counters
+var counters sync.Map
+
+// Inc increments the named counter by one
+func Inc(name string) {
+	Add(name, 1)
+}
+
+// Add increments the named counter by delta
+func Add(name string, delta int64) {
+	v, _ := counters.LoadOrStore(name, new(int64))
+	atomic.AddInt64(v.(*int64), delta)
+}
+
+// Get returns the current value of the named counter
+func Get(name string) int64 {
+	if v, ok := counters.Load(name); ok {
+		return atomic.LoadInt64(v.(*int64))
+	}
+	return 0
+}
+
+// Snapshot returns a copy of all counters
+func Snapshot() map[string]int64 {
+	out := map[string]int64{}
+	counters.Range(func(k, v interface{}) bool {
+		out[k.(string)] = atomic.LoadInt64(v.(*int64))
+		return true
+	})
+	return out
+}
+
+// Handler serves the current counters as JSON
+func Handler(c *fiber.Ctx) error {
+	return c.JSON(Snapshot())
+}
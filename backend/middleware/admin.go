@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireAdmin only lets through requests whose authenticated user has the admin role
+func RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("userID").(string)
+		if !ok || userID == "" {
+			return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+		}
+
+		user, err := repository.New(repository.GetDB()).WithContext(c.UserContext()).GetByID(userID)
+		if err != nil || user == nil || user.Role != repository.RoleAdmin {
+			return response.Error(c, fiber.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+		}
+		return c.Next()
+	}
+}
+
+// RequireSuperAdmin only lets through admins that belong to no tenant, who
+// manage the deployment as a whole (e.g. the tenants themselves)
+func RequireSuperAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("userID").(string)
+		if !ok || userID == "" {
+			return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+		}
+
+		user, err := repository.New(repository.GetDB()).WithContext(c.UserContext()).GetByID(userID)
+		if err != nil || user == nil || user.Role != repository.RoleAdmin || user.TenantID != nil {
+			return response.Error(c, fiber.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+		}
+		return c.Next()
+	}
+}
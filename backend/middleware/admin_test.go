@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"manju/backend/repository"
+	"manju/backend/repository/repotest"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	db := repotest.OpenDB(t, "manju", &repository.User{})
+	prev := repository.GetDB()
+	repository.SetDB(db)
+	t.Cleanup(func() { repository.SetDB(prev) })
+
+	tenant := uuid.New()
+	users := map[string]*repository.User{
+		"admin":        {Email: "admin@example.com", Name: "Admin", Role: repository.RoleAdmin},
+		"tenant admin": {Email: "tenant-admin@example.com", Name: "Tenant admin", Role: repository.RoleAdmin, TenantID: &tenant},
+		"user":         {Email: "user@example.com", Name: "User", Role: repository.RoleUser},
+	}
+	for _, user := range users {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("create %s: %v", user.Email, err)
+		}
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if userID := c.Get("X-Test-User"); userID != "" {
+			c.Locals("userID", userID)
+		}
+		return c.Next()
+	})
+	app.Get("/admin/projects", RequireAdmin(), func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+	app.Get("/admin/tenants", RequireAdmin(), RequireSuperAdmin(), func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+
+	tests := []struct {
+		name string
+		user string // a key of users, "unknown" or "" for no login
+		path string
+		want int
+	}{
+		{name: "admin", user: "admin", path: "/admin/projects", want: http.StatusNoContent},
+		{name: "tenant admin", user: "tenant admin", path: "/admin/projects", want: http.StatusNoContent},
+		{name: "non-admin", user: "user", path: "/admin/projects", want: http.StatusForbidden},
+		{name: "unknown user", user: "unknown", path: "/admin/projects", want: http.StatusForbidden},
+		{name: "not logged in", path: "/admin/projects", want: http.StatusUnauthorized},
+		{name: "admin outside any tenant", user: "admin", path: "/admin/tenants", want: http.StatusNoContent},
+		{name: "tenant admin on a deployment-wide route", user: "tenant admin", path: "/admin/tenants", want: http.StatusForbidden},
+		{name: "non-admin on a deployment-wide route", user: "user", path: "/admin/tenants", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			switch {
+			case tt.user == "unknown":
+				req.Header.Set("X-Test-User", uuid.NewString())
+			case tt.user != "":
+				req.Header.Set("X-Test-User", users[tt.user].ID.String())
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"log"
+	"manju/backend/models/response"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Defaults of BruteForceProtect
+const (
+	defaultMaxAuthAttempts   = 10
+	defaultAuthAttemptWindow = 15 * time.Minute
+)
+
+// Locals keys handlers set to report the outcome of an authentication attempt
+const (
+	authFailedKey    = "authFailed"
+	authSucceededKey = "authSucceeded"
+)
+
+// attemptCounter counts the failed authentication attempts of each client IP
+type attemptCounter struct {
+	attempts sync.Map // ip -> *authAttempt
+	// sweep drops expired counters now and then so the map doesn't grow
+	// with every IP that ever failed
+	sweep sync.Once
+}
+
+type authAttempt struct {
+	mu           sync.Mutex
+	failures     int
+	windowEnd    time.Time // failures are counted until then
+	blockedUntil time.Time
+}
+
+// loginAttempts is shared by every BruteForceProtect, so failures on any
+// auth endpoint count towards one limit. sessionAttempts, used by
+// SessionBruteForceProtect, is kept apart so that requests to the API with a
+// bad session cookie can't lock a client out of signing in again.
+var loginAttempts, sessionAttempts attemptCounter
+
+// AuthFailed records that the request failed to authenticate (invalid OAuth
+// state or code, malformed session), for BruteForceProtect to count
+func AuthFailed(c *fiber.Ctx) {
+	c.Locals(authFailedKey, true)
+}
+
+// AuthSucceeded records that the request completed a sign-in, which clears
+// the client's failed attempts
+func AuthSucceeded(c *fiber.Ctx) {
+	c.Locals(authSucceededKey, true)
+}
+
+// BruteForceProtect blocks a client IP with 429 once it has failed to
+// authenticate maxAttempts times (default 10) within window (default 15
+// minutes), for window. Handlers report failures with AuthFailed and
+// successful sign-ins, which reset the count, with AuthSucceeded.
+func BruteForceProtect(maxAttempts int, window time.Duration) fiber.Handler {
+	return bruteForceProtect(&loginAttempts, maxAttempts, window)
+}
+
+// SessionBruteForceProtect is BruteForceProtect for routes behind session
+// authentication. It counts failures separately from sign-in attempts.
+func SessionBruteForceProtect(maxAttempts int, window time.Duration) fiber.Handler {
+	return bruteForceProtect(&sessionAttempts, maxAttempts, window)
+}
+
+func bruteForceProtect(counter *attemptCounter, maxAttempts int, window time.Duration) fiber.Handler {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAuthAttempts
+	}
+	if window <= 0 {
+		window = defaultAuthAttemptWindow
+	}
+	counter.sweep.Do(func() {
+		go func() {
+			for range time.Tick(time.Minute) {
+				now := time.Now()
+				counter.attempts.Range(func(ip, v interface{}) bool {
+					a := v.(*authAttempt)
+					a.mu.Lock()
+					expired := now.After(a.windowEnd) && now.After(a.blockedUntil)
+					a.mu.Unlock()
+					if expired {
+						counter.attempts.Delete(ip)
+					}
+					return true
+				})
+			}
+		}()
+	})
+
+	return func(c *fiber.Ctx) error {
+		ip := c.IP()
+		if v, ok := counter.attempts.Load(ip); ok {
+			a := v.(*authAttempt)
+			a.mu.Lock()
+			retryAfter := time.Until(a.blockedUntil)
+			a.mu.Unlock()
+			if retryAfter > 0 {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())+1))
+				return response.Error(c, fiber.StatusTooManyRequests, response.ErrCodeRateLimited, "too many failed sign-in attempts", nil)
+			}
+		}
+
+		err := c.Next()
+
+		if succeeded, _ := c.Locals(authSucceededKey).(bool); succeeded {
+			counter.attempts.Delete(ip)
+		} else if failed, _ := c.Locals(authFailedKey).(bool); failed {
+			counter.recordFailure(c, ip, maxAttempts, window)
+		}
+		return err
+	}
+}
+
+// recordFailure counts a failed attempt of ip and blocks it once it reaches
+// maxAttempts within window
+func (counter *attemptCounter) recordFailure(c *fiber.Ctx, ip string, maxAttempts int, window time.Duration) {
+	v, _ := counter.attempts.LoadOrStore(ip, &authAttempt{})
+	a := v.(*authAttempt)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if now.After(a.windowEnd) {
+		a.failures, a.windowEnd = 0, now.Add(window)
+	}
+	a.failures++
+	if a.failures < maxAttempts {
+		return
+	}
+	a.blockedUntil = now.Add(window)
+	a.failures, a.windowEnd = 0, time.Time{}
+	requestID, _ := c.Locals("requestID").(string)
+	log.Printf("[auth] WARN blocking %s for %s after %d failed sign-in attempts (request %s)", ip, window, maxAttempts, requestID)
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import "strings"
+
+// AllowOrigins returns a CORS AllowOriginsFunc accepting the origins listed
+// in allowed. An entry is either an exact origin (https://app.example.com) or
+// has a wildcard subdomain (https://*.example.com, or *.example.com for any
+// scheme). Origins compare case-insensitively.
+func AllowOrigins(allowed []string) func(origin string) bool {
+	patterns := make([]string, len(allowed))
+	for i, a := range allowed {
+		patterns[i] = strings.ToLower(strings.TrimRight(strings.TrimSpace(a), "/"))
+	}
+	return func(origin string) bool {
+		origin = strings.ToLower(origin)
+		for _, p := range patterns {
+			if originMatches(p, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// originMatches reports whether origin matches pattern. The wildcard stands
+// for one or more subdomain labels, never for a scheme, port or path.
+func originMatches(pattern, origin string) bool {
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+	if !strings.Contains(prefix, "://") {
+		// No scheme in the pattern: match the host of any scheme
+		if _, host, ok := strings.Cut(origin, "://"); ok {
+			origin = host
+		}
+	}
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(sub, "/:@") && !strings.HasPrefix(sub, ".") && !strings.HasSuffix(sub, ".")
+}
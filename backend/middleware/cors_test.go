@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+func TestAllowOrigins(t *testing.T) {
+	allow := AllowOrigins([]string{"https://app.example.com/", " http://localhost:5173", "https://*.preview.example.com", "*.Staging.example.com"})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		// Exact entries
+		{origin: "https://app.example.com", want: true},
+		{origin: "HTTPS://App.Example.com", want: true},
+		{origin: "http://localhost:5173", want: true},
+		{origin: "http://app.example.com", want: false},
+		{origin: "https://app.example.com:8443", want: false},
+		{origin: "http://localhost:3000", want: false},
+		{origin: "https://app.example.com.evil.com", want: false},
+		// Wildcard with a scheme
+		{origin: "https://pr-42.preview.example.com", want: true},
+		{origin: "https://a.b.preview.example.com", want: true},
+		{origin: "http://pr-42.preview.example.com", want: false},
+		{origin: "https://preview.example.com", want: false},
+		{origin: "https://.preview.example.com", want: false},
+		{origin: "https://evil.com/.preview.example.com", want: false},
+		{origin: "https://evil.com:1@x.preview.example.com", want: false},
+		{origin: "https://pr-42.preview.example.com.evil.com", want: false},
+		{origin: "https://evilpreview.example.com", want: false},
+		// Wildcard for any scheme
+		{origin: "https://qa.staging.example.com", want: true},
+		{origin: "http://qa.staging.example.com", want: true},
+		{origin: "https://qa.staging.example.com:8080", want: false},
+		{origin: "https://staging.example.com", want: false},
+		// Blocked
+		{origin: "https://evil.com", want: false},
+		{origin: "null", want: false},
+		{origin: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := allow(tt.origin); got != tt.want {
+			t.Errorf("allow(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	if AllowOrigins(nil)("http://localhost:5173") {
+		t.Error("an empty list allows an origin")
+	}
+}
+
+func TestAllowOriginsHeaders(t *testing.T) {
+	app := fiber.New()
+	app.Use(cors.New(cors.Config{
+		AllowOriginsFunc: AllowOrigins([]string{"https://app.example.com", "https://*.preview.example.com"}),
+		AllowCredentials: true,
+	}))
+	app.Get("/api/v1/projects", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+
+	tests := []struct {
+		name   string
+		method string
+		origin string
+		want   string
+	}{
+		{name: "exact origin", method: http.MethodGet, origin: "https://app.example.com", want: "https://app.example.com"},
+		{name: "wildcard subdomain", method: http.MethodGet, origin: "https://pr-7.preview.example.com", want: "https://pr-7.preview.example.com"},
+		{name: "preflight", method: http.MethodOptions, origin: "https://pr-7.preview.example.com", want: "https://pr-7.preview.example.com"},
+		{name: "blocked origin", method: http.MethodGet, origin: "https://evil.com"},
+		{name: "blocked preflight", method: http.MethodOptions, origin: "https://evil.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/projects", nil)
+			req.Header.Set(fiber.HeaderOrigin, tt.origin)
+			if tt.method == http.MethodOptions {
+				req.Header.Set(fiber.HeaderAccessControlRequestMethod, http.MethodGet)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The allowed origin is echoed, never *, so cookies are sent
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != tt.want {
+				t.Errorf("Access-Control-Allow-Origin %q, want %q", got, tt.want)
+			}
+			wantCredentials := ""
+			if tt.want != "" {
+				wantCredentials = "true"
+			}
+			if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials); got != wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials %q, want %q", got, wantCredentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"log"
+	"manju/backend/models/response"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultLegacyAPIDeadline is when the unversioned /api routes stop working
+// unless API_LEGACY_DEADLINE says otherwise
+var defaultLegacyAPIDeadline = time.Date(2027, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// LegacyAPIDeadline returns the end of the unversioned /api routes, read
+// from API_LEGACY_DEADLINE as a date (2006-01-02) or RFC 3339 time
+func LegacyAPIDeadline() time.Time {
+	raw := strings.TrimSpace(os.Getenv("API_LEGACY_DEADLINE"))
+	if raw == "" {
+		return defaultLegacyAPIDeadline
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t
+		}
+	}
+	log.Printf("[api] invalid API_LEGACY_DEADLINE %q, using %s", raw, defaultLegacyAPIDeadline.Format("2006-01-02"))
+	return defaultLegacyAPIDeadline
+}
+
+// LegacyAPI guards the unversioned /api routes kept for old clients. Until
+// deadline it marks responses deprecated and points at the /api/v1
+// successor; afterwards it answers 410 Gone.
+func LegacyAPI(deadline time.Time) fiber.Handler {
+	sunset := deadline.UTC().Format(http.TimeFormat)
+	return func(c *fiber.Ctx) error {
+		if strings.HasPrefix(c.Path(), "/api/v1/") {
+			return c.Next()
+		}
+		if !time.Now().Before(deadline) {
+			return response.Error(c, fiber.StatusGone, response.ErrCodeGone, "use /api/v1", nil)
+		}
+		c.Set("Deprecation", "true")
+		c.Set("Sunset", sunset)
+		c.Set(fiber.HeaderLink, "</api/v1"+strings.TrimPrefix(c.Path(), "/api")+">; rel=\"successor-version\"")
+		return c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"manju/backend/config"
+	"manju/backend/models/response"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maintenanceRetryAfter is how long clients are told to wait during
+// maintenance, in seconds
+const maintenanceRetryAfter = 300
+
+// MaintenanceMode answers every request with 503 while the server is in
+// maintenance mode (see config.MaintenanceActive). GET /api/health stays up
+// for load balancers, the admin endpoints that toggle maintenance stay up so
+// it can be ended, and requests whose X-Maintenance-Override header matches
+// MAINTENANCE_BYPASS_KEY go through.
+func MaintenanceMode() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !config.MaintenanceActive() {
+			return c.Next()
+		}
+		path := strings.TrimSuffix(c.Path(), "/")
+		if c.Method() == fiber.MethodGet && path == "/api/health" {
+			return c.Next()
+		}
+		if strings.HasPrefix(path, "/api/v1/admin/maintenance/") {
+			return c.Next()
+		}
+		if key := config.MaintenanceBypassKey(); key != "" {
+			if subtle.ConstantTimeCompare([]byte(c.Get("X-Maintenance-Override")), []byte(key)) == 1 {
+				return c.Next()
+			}
+		}
+
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(maintenanceRetryAfter))
+		return response.Error(c, fiber.StatusServiceUnavailable, response.ErrCodeMaintenance, "down for maintenance, back soon", fiber.Map{
+			"retry_after_seconds": maintenanceRetryAfter,
+		})
+	}
+}
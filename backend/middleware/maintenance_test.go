@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"manju/backend/models/response"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	t.Setenv("MAINTENANCE_MODE", "true")
+	t.Setenv("MAINTENANCE_BYPASS_KEY", "let-me-in")
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("requestID", "req-1")
+		return c.Next()
+	})
+	app.Use(MaintenanceMode())
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		override string
+		want     int
+	}{
+		{name: "api request", method: http.MethodGet, path: "/api/v1/projects", want: http.StatusServiceUnavailable},
+		{name: "health check", method: http.MethodGet, path: "/api/health", want: http.StatusNoContent},
+		{name: "ending maintenance", method: http.MethodPost, path: "/api/v1/admin/maintenance/disable", want: http.StatusNoContent},
+		{name: "legacy maintenance path", method: http.MethodPost, path: "/api/admin/maintenance/disable", want: http.StatusServiceUnavailable},
+		{name: "bypass key", method: http.MethodGet, path: "/api/v1/projects", override: "let-me-in", want: http.StatusNoContent},
+		{name: "wrong bypass key", method: http.MethodGet, path: "/api/v1/projects", override: "guess", want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.override != "" {
+				req.Header.Set("X-Maintenance-Override", tt.override)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want != http.StatusServiceUnavailable {
+				return
+			}
+			if got := resp.Header.Get(fiber.HeaderRetryAfter); got != "300" {
+				t.Errorf("Retry-After %q, want 300", got)
+			}
+			var body response.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != response.ErrCodeMaintenance || body.RequestID != "req-1" {
+				t.Errorf("body %+v, want code %q with the request id", body, response.ErrCodeMaintenance)
+			}
+		})
+	}
+}
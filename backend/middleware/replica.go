@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReadYourWrites attaches a primary-pin scope to the request context so that
+// reads issued after a write in the same request go to the primary database
+func ReadYourWrites() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(repository.WithPrimaryPin(c.UserContext()))
+		return c.Next()
+	}
+}
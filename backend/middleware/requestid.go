@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestIDContext copies the request's X-Request-ID into its context so the
+// queries it runs are logged with it. It runs after the requestid middleware.
+func RequestIDContext() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if requestID, _ := c.Locals("requestID").(string); requestID != "" {
+			c.SetUserContext(repository.WithRequestID(c.UserContext(), requestID))
+		}
+		return c.Next()
+	}
+}
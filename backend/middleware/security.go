@@ -2,12 +2,19 @@ package middleware
 
 import (
 	"log"
+	"manju/backend/models/response"
 	"os"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// apiKeyExemptPaths are the path prefixes APIKeyGuard lets through: OAuth
+// login and callback (browser redirects), published bots (called by
+// anonymous visitors), inbound webhooks (authenticated by their HMAC
+// signature) and signed file URLs (the signed token is the credential)
+var apiKeyExemptPaths = []string{"/auth/", "/public/", "/webhooks/", "/api/files/"}
+
 // APIKeyGuard is a middleware that validates the X-API-Key header
 func APIKeyGuard() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -16,10 +23,12 @@ func APIKeyGuard() fiber.Handler {
 			return c.Next()
 		}
 
-		// Skip for auth routes (OAuth login/callback are browser redirects)
+		// Skip for routes that are public or carry their own credentials
 		path := c.Path()
-		if strings.HasPrefix(path, "/auth/") {
-			return c.Next()
+		for _, prefix := range apiKeyExemptPaths {
+			if strings.HasPrefix(path, prefix) {
+				return c.Next()
+			}
 		}
 
 		apiKey := strings.TrimSpace(os.Getenv("MANJU_API_KEY"))
@@ -35,9 +44,7 @@ func APIKeyGuard() fiber.Handler {
 		log.Printf("[APIKeyGuard] Path: %s, Expected Key: %s, Received Key: %s", path, apiKey, clientKey)
 
 		if clientKey == "" || clientKey != apiKey {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "unauthorized: missing or invalid API Key",
-			})
+			return response.Error(c, fiber.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized: missing or invalid API Key", nil)
 		}
 
 		return c.Next()
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"log"
+	"manju/backend/config"
+	"manju/backend/models/response"
+	"strings"
+	"time"
+
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// Host lookups are cached so that every request doesn't hit the database.
+// The Host header is chosen by the client, so the caches are bounded and
+// hosts of no tenant are only remembered briefly, so a new tenant is picked
+// up soon after it is created.
+const (
+	tenantCacheSize    = 1000
+	tenantCacheTTL     = time.Minute
+	tenantMissCacheTTL = 5 * time.Second
+)
+
+var (
+	// tenantHosts maps hosts to the tenant they serve
+	tenantHosts = expirable.NewLRU[string, uuid.UUID](tenantCacheSize, nil, tenantCacheTTL)
+	// tenantMissingHosts holds hosts that serve no tenant
+	tenantMissingHosts = expirable.NewLRU[string, struct{}](tenantCacheSize, nil, tenantMissCacheTTL)
+)
+
+// ResolveTenant identifies the tenant a request is for, from the Host header
+// (custom domain or subdomain of TENANT_BASE_DOMAIN) or, for requests from a
+// TENANT_HEADER_TRUSTED_PROXIES address, the X-Tenant-ID header, and stores
+// it in c.Locals("tenantID") and the request context. Clients can't pick a
+// tenant themselves: the header is ignored from anywhere else. Requests that
+// match no tenant pass through unscoped. RequireAuth later replaces the
+// tenant with the one of the authenticated session.
+func ResolveTenant() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var tenantID uuid.UUID
+		header := strings.TrimSpace(c.Get("X-Tenant-ID"))
+		if header != "" && config.TenantHeaderTrusted(c.Context().RemoteIP()) {
+			id, err := uuid.Parse(header)
+			if err != nil {
+				return response.Error(c, fiber.StatusBadRequest, response.ErrCodeBadRequest, "invalid X-Tenant-ID", nil)
+			}
+			tenant, err := repository.NewTenant(repository.GetDB()).GetByID(id.String())
+			if err != nil {
+				return response.Error(c, fiber.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+			}
+			if tenant == nil {
+				return response.Error(c, fiber.StatusNotFound, response.ErrCodeNotFound, "tenant not found", nil)
+			}
+			tenantID = tenant.ID
+		} else if host := c.Hostname(); host != "" {
+			tenantID = tenantForHost(host)
+		}
+
+		if tenantID != uuid.Nil {
+			c.Locals("tenantID", tenantID)
+			c.SetUserContext(repository.WithTenant(c.UserContext(), tenantID))
+		}
+		return c.Next()
+	}
+}
+
+// tenantForHost returns the tenant serving host, or uuid.Nil if there is none
+func tenantForHost(host string) uuid.UUID {
+	host = strings.ToLower(host)
+	if i := strings.LastIndex(host, ":"); i > 0 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	if tenantID, ok := tenantHosts.Get(host); ok {
+		return tenantID
+	}
+	if _, ok := tenantMissingHosts.Get(host); ok {
+		return uuid.Nil
+	}
+
+	tenant, err := repository.NewTenant(repository.GetDB()).GetByHost(host, config.TenantBaseDomain())
+	if err != nil {
+		// Don't cache failures; the next request retries the lookup
+		log.Printf("[tenants] failed to resolve host %s: %v", host, err)
+		return uuid.Nil
+	}
+	if tenant == nil {
+		tenantMissingHosts.Add(host, struct{}{})
+		return uuid.Nil
+	}
+	tenantHosts.Add(host, tenant.ID)
+	return tenant.ID
+}
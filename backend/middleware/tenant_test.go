@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"manju/backend/repository"
+	"manju/backend/repository/repotest"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+func TestTenantForHost(t *testing.T) {
+	db := repotest.OpenDB(t, "manju", &repository.Tenant{})
+	prev := repository.GetDB()
+	repository.SetDB(db)
+	t.Cleanup(func() { repository.SetDB(prev) })
+	t.Setenv("TENANT_BASE_DOMAIN", "example.com")
+
+	// Small caches with a short miss TTL, so the test needn't wait long
+	const size, missTTL = 10, 50 * time.Millisecond
+	prevHosts, prevMissing := tenantHosts, tenantMissingHosts
+	tenantHosts = expirable.NewLRU[string, uuid.UUID](size, nil, time.Minute)
+	tenantMissingHosts = expirable.NewLRU[string, struct{}](size, nil, missTTL)
+	t.Cleanup(func() { tenantHosts, tenantMissingHosts = prevHosts, prevMissing })
+
+	if id := tenantForHost("acme.example.com"); id != uuid.Nil {
+		t.Fatalf("tenant %s for a host of no tenant", id)
+	}
+	acme := repository.Tenant{Name: "Acme", Slug: "acme"}
+	if err := db.Create(&acme).Error; err != nil {
+		t.Fatal(err)
+	}
+	// A new tenant is picked up once the miss expires
+	time.Sleep(2 * missTTL)
+	if id := tenantForHost("ACME.example.com:443"); id != acme.ID {
+		t.Fatalf("tenant %s after creating acme, want %s", id, acme.ID)
+	}
+
+	// Made-up Host headers don't grow the caches past their size
+	for i := 0; i < 5*size; i++ {
+		if id := tenantForHost(fmt.Sprintf("made-up-%d.invalid", i)); id != uuid.Nil {
+			t.Fatalf("tenant %s for a made-up host", id)
+		}
+	}
+	if n := tenantMissingHosts.Len(); n > size {
+		t.Errorf("%d missing hosts cached, want at most %d", n, size)
+	}
+	if id := tenantForHost("acme.example.com"); id != acme.ID {
+		t.Errorf("tenant %s for acme after the made-up hosts, want %s", id, acme.ID)
+	}
+}
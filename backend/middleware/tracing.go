@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"manju/backend/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fiberHeaderCarrier adapts fiber request headers for trace context extraction
+type fiberHeaderCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h fiberHeaderCarrier) Get(key string) string { return h.c.Get(key) }
+func (h fiberHeaderCarrier) Set(key, value string) { h.c.Request().Header.Set(key, value) }
+func (h fiberHeaderCarrier) Keys() []string {
+	keys := []string{}
+	h.c.Request().Header.VisitAll(func(k, _ []byte) {
+		keys = append(keys, string(k))
+	})
+	return keys
+}
+
+var _ propagation.TextMapCarrier = fiberHeaderCarrier{}
+
+// Tracing starts a server span per request, continuing any W3C traceparent
+// sent by the caller. The span is stored in c.Locals("span") and its context
+// becomes the request's user context so handlers can create child spans.
+func Tracing() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), fiberHeaderCarrier{c})
+		ctx, span := tracing.Tracer().Start(ctx, fmt.Sprintf("%s %s", c.Method(), c.Path()),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Method()),
+				attribute.String("url.path", c.Path()),
+			),
+		)
+		defer span.End()
+
+		c.Locals("span", span)
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		// Name the span after the matched route to keep cardinality low
+		span.SetName(fmt.Sprintf("%s %s", c.Method(), c.Route().Path))
+		status := c.Response().StatusCode()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if err != nil {
+			span.RecordError(err)
+		}
+		if err != nil || status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+		}
+		return err
+	}
+}
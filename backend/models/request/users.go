@@ -9,3 +9,9 @@ type CreateUserPayload struct {
 	Info   map[string]interface{} `json:"info,omitempty"`
 	Status repository.Status      `json:"status,omitempty"`
 }
+
+// UpdateUserStatusPayload is the body of PUT /users/:id/status
+type UpdateUserStatusPayload struct {
+	Status repository.Status `json:"status"`
+	Reason string            `json:"reason,omitempty"`
+}
@@ -0,0 +1,107 @@
+package response
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Code      string      `json:"code"`    // one of the ErrCode constants
+	Message   string      `json:"message"` // human-readable, may change
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// Error codes shared by every status they are used with
+const (
+	ErrCodeBadRequest           = "bad_request"
+	ErrCodeUnauthorized         = "unauthorized"
+	ErrCodeForbidden            = "forbidden"
+	ErrCodeNotFound             = "not_found"
+	ErrCodeConflict             = "conflict"
+	ErrCodeGone                 = "gone"
+	ErrCodePreconditionFailed   = "precondition_failed"
+	ErrCodePayloadTooLarge      = "payload_too_large"
+	ErrCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrCodeRangeNotSatisfiable  = "range_not_satisfiable"
+	ErrCodeValidation           = "validation_failed"
+	ErrCodeRateLimited          = "rate_limited"
+	ErrCodeInternal             = "internal_error"
+	ErrCodeUpstream             = "upstream_error"
+	ErrCodeUnavailable          = "service_unavailable"
+)
+
+// Error codes for specific failures clients handle
+const (
+	ErrCodeAccountSuspended         = "account_suspended"
+	ErrCodeAPIKeyInvalid            = "invalid_api_key"
+	ErrCodeAPIKeyValidationFailed   = "api_key_validation_failed"
+	ErrCodeArchiveTooLarge          = "archive_too_large"
+	ErrCodeBaseVersionUnavailable   = "base_version_unavailable"
+	ErrCodeChunkHashMismatch        = "chunk_hash_mismatch"
+	ErrCodeChunkSizeMismatch        = "chunk_size_mismatch"
+	ErrCodeContentMismatch          = "content_mismatch"
+	ErrCodeEmbeddingInProgress      = "embedding_in_progress"
+	ErrCodeFileTooLarge             = "file_too_large"
+	ErrCodeGoogleAccountNotLinked   = "google_account_not_linked"
+	ErrCodeGoogleSheetsNotConnected = "google_sheets_not_connected"
+	ErrCodeHashMismatch             = "hash_mismatch"
+	ErrCodeInvalidStatusTransition  = "invalid_status_transition"
+	ErrCodeInvalidWorkflow          = "invalid_workflow"
+	ErrCodeMaintenance              = "maintenance"
+	ErrCodeMalwareDetected          = "malware_detected"
+	ErrCodeMergeConflict            = "merge_conflict"
+	ErrCodeMissingChunks            = "missing_chunks"
+	ErrCodeProjectNameTaken         = "project_name_taken"
+	ErrCodeStorageQuotaExceeded     = "storage_quota_exceeded"
+	ErrCodeTokenBudgetExceeded      = "token_budget_exceeded"
+	ErrCodeUnsupportedFileType      = "unsupported_file_type"
+	ErrCodeWorkflowTooLarge         = "workflow_too_large"
+)
+
+// statusCodes is the default error code of each status
+var statusCodes = map[int]string{
+	http.StatusBadRequest:                   ErrCodeBadRequest,
+	http.StatusUnauthorized:                 ErrCodeUnauthorized,
+	http.StatusForbidden:                    ErrCodeForbidden,
+	http.StatusNotFound:                     ErrCodeNotFound,
+	http.StatusConflict:                     ErrCodeConflict,
+	http.StatusGone:                         ErrCodeGone,
+	http.StatusPreconditionFailed:           ErrCodePreconditionFailed,
+	http.StatusRequestEntityTooLarge:        ErrCodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:         ErrCodeUnsupportedMediaType,
+	http.StatusRequestedRangeNotSatisfiable: ErrCodeRangeNotSatisfiable,
+	http.StatusUnprocessableEntity:          ErrCodeValidation,
+	http.StatusTooManyRequests:              ErrCodeRateLimited,
+	http.StatusInternalServerError:          ErrCodeInternal,
+	http.StatusBadGateway:                   ErrCodeUpstream,
+	http.StatusServiceUnavailable:           ErrCodeUnavailable,
+}
+
+// CodeForStatus returns the default error code of an HTTP status
+func CodeForStatus(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return ErrCodeInternal
+	}
+	return ErrCodeBadRequest
+}
+
+// NewError builds an error body, with the request ID when the request-ID
+// middleware is active
+func NewError(c *fiber.Ctx, code, message string, details interface{}) ErrorResponse {
+	requestID, _ := c.Locals("requestID").(string)
+	return ErrorResponse{Code: code, Message: message, Details: details, RequestID: requestID}
+}
+
+// Error writes an error response. An empty code uses the status's default.
+func Error(c *fiber.Ctx, status int, code, message string, details interface{}) error {
+	if code == "" {
+		code = CodeForStatus(status)
+	}
+	return c.Status(status).JSON(NewError(c, code, message, details))
+}
@@ -0,0 +1,74 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		code      string
+		requestID string
+		details   interface{}
+		want      ErrorResponse
+	}{
+		{
+			name:   "explicit code",
+			status: http.StatusConflict, code: ErrCodeProjectNameTaken,
+			want: ErrorResponse{Code: ErrCodeProjectNameTaken, Message: "failed"},
+		},
+		{
+			name:   "empty code uses the status default",
+			status: http.StatusNotFound,
+			want:   ErrorResponse{Code: ErrCodeNotFound, Message: "failed"},
+		},
+		{
+			name:   "unmapped client status",
+			status: http.StatusTeapot,
+			want:   ErrorResponse{Code: ErrCodeBadRequest, Message: "failed"},
+		},
+		{
+			name:   "unmapped server status",
+			status: http.StatusGatewayTimeout,
+			want:   ErrorResponse{Code: ErrCodeInternal, Message: "failed"},
+		},
+		{
+			name:   "request id and details",
+			status: http.StatusUnprocessableEntity, requestID: "req-1", details: map[string]interface{}{"field": "name"},
+			want: ErrorResponse{Code: ErrCodeValidation, Message: "failed", Details: map[string]interface{}{"field": "name"}, RequestID: "req-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				if tt.requestID != "" {
+					c.Locals("requestID", tt.requestID)
+				}
+				return Error(c, tt.status, tt.code, "failed", tt.details)
+			})
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			var got ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("body %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package response
+
+// MessageResponse is the body of a successful response that has nothing to
+// return but a confirmation
+type MessageResponse struct {
+	Message string `json:"message"`
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -40,6 +41,11 @@ func NewUserAPIKeyRepository(db *gorm.DB) *UserAPIKeyRepository {
 	return &UserAPIKeyRepository{db: db}
 }
 
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *UserAPIKeyRepository) WithContext(ctx context.Context) *UserAPIKeyRepository {
+	return &UserAPIKeyRepository{db: r.db.WithContext(ctx)}
+}
+
 // Create adds a new API key
 func (r *UserAPIKeyRepository) Create(key *UserAPIKey) (*UserAPIKey, error) {
 	if err := r.db.Create(key).Error; err != nil {
@@ -51,7 +57,7 @@ func (r *UserAPIKeyRepository) Create(key *UserAPIKey) (*UserAPIKey, error) {
 // ListByUserID returns all API keys for a user
 func (r *UserAPIKeyRepository) ListByUserID(userID string) ([]UserAPIKey, error) {
 	var keys []UserAPIKey
-	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+	if err := readDB(r.db).Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
 		return nil, err
 	}
 	return keys, nil
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// AuditLog records a single data mutation for security review
+type AuditLog struct {
+	ID           uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID       *uuid.UUID     `gorm:"type:uuid;index" json:"user_id"`
+	Action       string         `gorm:"not null;index" json:"action"`
+	ResourceType string         `gorm:"not null;index" json:"resource_type"`
+	ResourceID   string         `gorm:"index" json:"resource_id"`
+	Diff         datatypes.JSON `gorm:"type:jsonb" json:"diff"`
+	IP           string         `json:"ip"`
+	UserAgent    string         `json:"user_agent"`
+	CreatedAt    time.Time      `gorm:"default:now();index" json:"created_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (a *AuditLog) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// AuditLogFilter narrows an audit log listing
+type AuditLogFilter struct {
+	ResourceType string
+	UserID       string
+	From         *time.Time
+	To           *time.Time
+	Limit        int
+}
+
+// AuditLogRepository handles audit log database operations
+type AuditLogRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditLog creates a new AuditLogRepository
+func NewAuditLog(db *gorm.DB) *AuditLogRepository {
+	return &AuditLogRepository{db}
+}
+
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *AuditLogRepository) WithContext(ctx context.Context) *AuditLogRepository {
+	return &AuditLogRepository{r.db.WithContext(ctx)}
+}
+
+// Create inserts an audit record
+func (r *AuditLogRepository) Create(a *AuditLog) (*AuditLog, error) {
+	if err := r.db.Create(a).Error; err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// List returns audit records matching the filter, newest first
+func (r *AuditLogRepository) List(filter AuditLogFilter) ([]AuditLog, error) {
+	q := readDB(r.db).Model(&AuditLog{})
+	if filter.ResourceType != "" {
+		q = q.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.UserID != "" {
+		q = q.Where("user_id = ?", filter.UserID)
+	}
+	if filter.From != nil {
+		q = q.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		q = q.Where("created_at <= ?", *filter.To)
+	}
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 100
+	}
+
+	var logs []AuditLog
+	if err := q.Order("created_at DESC").Limit(filter.Limit).Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
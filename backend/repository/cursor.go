@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a listing ordered by created_at DESC, id DESC.
+// Unlike an offset it does not drift when new rows are inserted while a
+// client pages through.
+type Cursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// Encode returns the cursor as an opaque URL-safe token
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token made by Encode. An empty token is the start of
+// the listing and decodes to nil.
+func DecodeCursor(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keysetPage orders q by table's (created_at, id), newest first, and starts
+// after cursor. One row more than limit is fetched so the caller can tell
+// whether there is a next page; see nextCursor.
+func keysetPage(q *gorm.DB, table string, cursor *Cursor, limit int) *gorm.DB {
+	if cursor != nil {
+		q = q.Where("("+table+".created_at, "+table+".id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+	return q.Order(table + ".created_at DESC, " + table + ".id DESC").Limit(limit + 1)
+}
+
+// nextCursor trims a keysetPage result of n rows to limit and returns the
+// cursor of the next page, or nil when this is the last one. key returns the
+// created_at and id of row i.
+func nextCursor(n, limit int, key func(i int) (time.Time, uuid.UUID)) (int, *Cursor) {
+	if n <= limit {
+		return n, nil
+	}
+	createdAt, id := key(limit - 1)
+	return limit, &Cursor{CreatedAt: createdAt, ID: id}
+}
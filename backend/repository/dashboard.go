@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserStats are the aggregate counts shown on a user's dashboard. Documents
+// are stored on disk rather than in the database, so TotalDocuments and
+// TotalStorageBytes are left for the caller to fill in.
+type UserStats struct {
+	ProjectCountByStatus      map[ProjectStatus]int64 `json:"project_count_by_status"`
+	TotalExecutionsLast30Days int64                   `json:"total_executions_last_30_days"`
+	TotalDocuments            int64                   `json:"total_documents"`
+	TotalStorageBytes         int64                   `json:"total_storage_bytes"`
+	TotalVoices               int64                   `json:"total_voices"`
+	APIKeysCount              int64                   `json:"api_keys_count"`
+	HasDefaultKey             bool                    `json:"has_default_key"`
+}
+
+// userStatsRow is the single row returned by the dashboard query
+type userStatsRow struct {
+	DraftProjects    int64
+	ActiveProjects   int64
+	ArchivedProjects int64
+	Executions       int64
+	Voices           int64
+	APIKeys          int64
+	HasDefaultKey    bool
+}
+
+// userStatsQuery computes every dashboard count in one round trip. Projects
+// without a status predate the status column and count as drafts.
+const userStatsQuery = `
+SELECT
+	p.draft_projects,
+	p.active_projects,
+	p.archived_projects,
+	(SELECT COUNT(*) FROM executions WHERE user_id = @user AND created_at >= @since) AS executions,
+	(SELECT COUNT(*) FROM voices WHERE user_id = @user) AS voices,
+	(SELECT COUNT(*) FROM user_api_keys WHERE user_id = @user) AS api_keys,
+	EXISTS (SELECT 1 FROM user_api_keys WHERE user_id = @user AND is_default) AS has_default_key
+FROM (
+	SELECT
+		COUNT(CASE WHEN status IS NULL OR status = '' OR status = 'draft' THEN 1 END) AS draft_projects,
+		COUNT(CASE WHEN status = 'active' THEN 1 END) AS active_projects,
+		COUNT(CASE WHEN status = 'archived' THEN 1 END) AS archived_projects
+	FROM projects
+	WHERE user_id = @user
+) p`
+
+// UserDashboardRepository computes per-user aggregate statistics
+type UserDashboardRepository struct {
+	db *gorm.DB
+}
+
+// NewUserDashboard creates a new UserDashboardRepository
+func NewUserDashboard(db *gorm.DB) *UserDashboardRepository {
+	return &UserDashboardRepository{db}
+}
+
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *UserDashboardRepository) WithContext(ctx context.Context) *UserDashboardRepository {
+	return &UserDashboardRepository{r.db.WithContext(ctx)}
+}
+
+// GetStats returns the dashboard counts of a user
+func (r *UserDashboardRepository) GetStats(userID string) (*UserStats, error) {
+	db, span := startSpan(r.db, "UserDashboardRepository.GetStats")
+	defer span.End()
+
+	var row userStatsRow
+	err := readDB(db).Raw(userStatsQuery, map[string]interface{}{
+		"user":  userID,
+		"since": time.Now().AddDate(0, 0, -30),
+	}).Scan(&row).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserStats{
+		ProjectCountByStatus: map[ProjectStatus]int64{
+			ProjectStatusDraft:    row.DraftProjects,
+			ProjectStatusActive:   row.ActiveProjects,
+			ProjectStatusArchived: row.ArchivedProjects,
+		},
+		TotalExecutionsLast30Days: row.Executions,
+		TotalVoices:               row.Voices,
+		APIKeysCount:              row.APIKeys,
+		HasDefaultKey:             row.HasDefaultKey,
+	}, nil
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Document embedding statuses
+const (
+	DocumentEmbeddingPending = "pending"  // not embedded since it was uploaded or restored
+	DocumentEmbedded         = "embedded" // its vectors are in the project's index
+	DocumentEmbeddingFailed  = "failed"   // the last embedding run that covered it failed
+	DocumentEmbeddingStale   = "stale"    // re-uploaded since it was embedded
+)
+
+// Document is a file uploaded to a project for retrieval. IDs are chosen by
+// the editor ("doc-..."), so they are only unique within a project.
+type Document struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	ProjectID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"project_id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`      // uploader
+	NodeID      string    `gorm:"not null;default:''" json:"node_id,omitempty"` // workflow node the upload was for, if any
+	Name        string    `gorm:"not null" json:"name"`                         // original file name
+	StoredPath  string    `gorm:"not null" json:"-"`
+	Size        int64     `gorm:"not null;default:0" json:"size"`
+	ContentType string    `gorm:"not null;default:''" json:"content_type"`
+	Status      string    `gorm:"not null;default:'ready'" json:"status"`
+	ContentHash string    `gorm:"index" json:"content_hash,omitempty"` // hex SHA-256 of the file
+	UploadedAt  time.Time `gorm:"default:now()" json:"uploaded_at"`
+	// Version counts the uploads under this ID; earlier files are kept as
+	// DocumentVersions
+	Version int `gorm:"not null;default:1" json:"version"`
+	// EmbeddingStatus is one of the DocumentEmbedding* statuses
+	EmbeddingStatus string `gorm:"not null;default:'pending'" json:"embedding_status"`
+	// Deduplicated is set when the stored file is a hard link to an identical
+	// upload of the same user, so it takes no extra space
+	Deduplicated bool `gorm:"not null;default:false" json:"deduplicated"`
+	// DeletedAt is set while the document is in the project's trash
+	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	// Columns, RowCount and ParseErrors describe a CSV or spreadsheet: its
+	// header names, data rows and the first rows that could not be parsed
+	Columns     datatypes.JSON `gorm:"type:jsonb" json:"columns,omitempty"`
+	RowCount    int            `gorm:"not null;default:0" json:"row_count,omitempty"`
+	ParseErrors datatypes.JSON `gorm:"type:jsonb" json:"parse_errors,omitempty"`
+}
+
+// BeforeCreate hook to ensure the upload time
+func (d *Document) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.UploadedAt.IsZero() {
+		d.UploadedAt = time.Now()
+	}
+	return nil
+}
+
+// DocumentRepository handles project document database operations
+type DocumentRepository struct {
+	db *gorm.DB
+}
+
+// NewDocument creates a new DocumentRepository
+func NewDocument(db *gorm.DB) *DocumentRepository {
+	return &DocumentRepository{db}
+}
+
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *DocumentRepository) WithContext(ctx context.Context) *DocumentRepository {
+	return &DocumentRepository{r.db.WithContext(ctx)}
+}
+
+// Create stores a new document, replacing the row of a re-uploaded ID
+func (r *DocumentRepository) Create(d *Document) (*Document, error) {
+	if err := r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(d).Error; err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// CreateMissing stores documents whose IDs are not yet known, leaving
+// existing rows untouched
+func (r *DocumentRepository) CreateMissing(docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&docs).Error
+}
+
+// ListByProject returns the documents of a project, oldest first
+func (r *DocumentRepository) ListByProject(projectID string) ([]Document, error) {
+	var docs []Document
+	if err := readDB(r.db).Where("project_id = ?", projectID).Order("uploaded_at ASC, id ASC").Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Get returns a document of a project, or nil if it does not exist
+func (r *DocumentRepository) Get(projectID, id string) (*Document, error) {
+	var d Document
+	if err := r.db.Where("project_id = ? AND id = ?", projectID, id).First(&d).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetByHash returns a document of a project, not in the trash, whose file
+// has the given content hash, or nil if there is none
+func (r *DocumentRepository) GetByHash(projectID, hash string) (*Document, error) {
+	var d Document
+	err := r.db.Where("project_id = ? AND content_hash = ? AND deleted_at IS NULL", projectID, hash).
+		Order("uploaded_at ASC").First(&d).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetByUserHash returns a document uploaded by userID to any project, not in
+// the trash, whose file has the given content hash, or nil if there is none
+func (r *DocumentRepository) GetByUserHash(userID, hash string) (*Document, error) {
+	var d Document
+	err := r.db.Where("user_id = ? AND content_hash = ? AND deleted_at IS NULL", userID, hash).
+		Order("uploaded_at ASC").First(&d).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// DocumentStorage is how much document storage a user takes up
+type DocumentStorage struct {
+	Documents         int64 `json:"documents"`
+	TotalBytes        int64 `json:"total_bytes"`        // size of all documents
+	DeduplicatedBytes int64 `json:"deduplicated_bytes"` // of which shared with an identical upload
+	StoredBytes       int64 `json:"stored_bytes"`       // actually used on disk
+	TrashBytes        int64 `json:"trash_bytes"`        // of which in the trash, not counted against the quota
+}
+
+// documentStorageColumns sums a set of documents into a DocumentStorage
+const documentStorageColumns = "COUNT(*) AS documents, COALESCE(SUM(size), 0) AS total_bytes, " +
+	"COALESCE(SUM(CASE WHEN deduplicated THEN size ELSE 0 END), 0) AS deduplicated_bytes, " +
+	"COALESCE(SUM(CASE WHEN deleted_at IS NOT NULL AND NOT deduplicated THEN size ELSE 0 END), 0) AS trash_bytes"
+
+// StorageByUser sums the documents uploaded by userID, including those in
+// the trash
+func (r *DocumentRepository) StorageByUser(userID string) (*DocumentStorage, error) {
+	var s DocumentStorage
+	err := readDB(r.db).Model(&Document{}).Select(documentStorageColumns).
+		Where("user_id = ?", userID).Scan(&s).Error
+	if err != nil {
+		return nil, err
+	}
+	s.StoredBytes = s.TotalBytes - s.DeduplicatedBytes
+	return &s, nil
+}
+
+// ProjectStorage is how much document storage a user takes up in one project
+type ProjectStorage struct {
+	ProjectID   uuid.UUID `json:"project_id"`
+	ProjectName string    `json:"project_name"`
+	DocumentStorage
+}
+
+// StorageByUserProjects sums the documents uploaded by userID per project,
+// largest first
+func (r *DocumentRepository) StorageByUserProjects(userID string) ([]ProjectStorage, error) {
+	projects := []ProjectStorage{}
+	err := readDB(r.db).Model(&Document{}).
+		Select("documents.project_id, COALESCE(MAX(projects.name), '') AS project_name, "+documentStorageColumns).
+		Joins("LEFT JOIN projects ON projects.id = documents.project_id").
+		Where("documents.user_id = ?", userID).
+		Group("documents.project_id").
+		Order("total_bytes DESC").
+		Scan(&projects).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range projects {
+		projects[i].StoredBytes = projects[i].TotalBytes - projects[i].DeduplicatedBytes
+	}
+	return projects, nil
+}
+
+// UpdateMetadata saves a document's name and status
+func (r *DocumentRepository) UpdateMetadata(d *Document) error {
+	return r.db.Model(&Document{}).Where("project_id = ? AND id = ?", d.ProjectID, d.ID).
+		Updates(map[string]interface{}{"name": d.Name, "status": d.Status}).Error
+}
+
+// UpdateStorage saves where a document's file is stored and its status, as
+// changed when it is moved to or restored from the trash
+func (r *DocumentRepository) UpdateStorage(d *Document) error {
+	return r.db.Model(&Document{}).Where("project_id = ? AND id = ?", d.ProjectID, d.ID).
+		Updates(map[string]interface{}{
+			"stored_path":      d.StoredPath,
+			"status":           d.Status,
+			"deleted_at":       d.DeletedAt,
+			"embedding_status": d.EmbeddingStatus,
+		}).Error
+}
+
+// SetEmbeddingStatus records the outcome of an embedding run on the documents
+// of a project that were uploaded before it started and are not in the trash.
+// A non-empty documentID limits it to that document.
+func (r *DocumentRepository) SetEmbeddingStatus(projectID, documentID string, uploadedBefore time.Time, status string) error {
+	q := r.db.Model(&Document{}).Where("project_id = ? AND deleted_at IS NULL AND uploaded_at <= ?", projectID, uploadedBefore)
+	if documentID != "" {
+		q = q.Where("id = ?", documentID)
+	}
+	return q.Update("embedding_status", status).Error
+}
+
+// ListTrashedBefore returns documents moved to the trash before cutoff
+func (r *DocumentRepository) ListTrashedBefore(cutoff time.Time) ([]Document, error) {
+	var docs []Document
+	if err := r.db.Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Delete removes a document row
+func (r *DocumentRepository) Delete(projectID, id string) error {
+	return r.db.Where("project_id = ? AND id = ?", projectID, id).Delete(&Document{}).Error
+}
+
+// DeleteByProject removes every document row of a project, including those
+// in the trash, and the rows of their earlier versions
+func (r *DocumentRepository) DeleteByProject(projectID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ?", projectID).Delete(&DocumentVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("project_id = ?", projectID).Delete(&Document{}).Error
+	})
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"manju/backend/repository/repotest"
+
+	"github.com/google/uuid"
+)
+
+func TestDocumentRepository(t *testing.T) {
+	db := repotest.OpenDB(t, "primary", &Document{}, &DocumentVersion{})
+	repo := NewDocument(db)
+	projectID, otherProjectID, userID := uuid.New(), uuid.New(), uuid.New()
+	day := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	trashed := day.Add(time.Hour)
+	docs := []Document{
+		{ID: "doc-ab12cd34", ProjectID: projectID, Name: "Handbook.pdf", StoredPath: "/docs/doc-ab12cd34_20240101120000.pdf", ContentHash: "h1", UploadedAt: day.Add(2 * time.Minute)},
+		{ID: "doc-ef56ab78", ProjectID: projectID, Name: "notes.md", StoredPath: "/docs/doc-ef56ab78_20240101120100.md", ContentHash: "h2", UploadedAt: day.Add(time.Minute)},
+		{ID: "doc-trashed", ProjectID: projectID, Name: "old.txt", StoredPath: "/trash/doc-trashed.txt", ContentHash: "h3", UploadedAt: day, DeletedAt: &trashed},
+		// IDs are only unique within a project
+		{ID: "doc-ab12cd34", ProjectID: otherProjectID, Name: "Other.pdf", StoredPath: "/other/doc-ab12cd34.pdf", ContentHash: "h3", UploadedAt: day},
+	}
+	for i := range docs {
+		docs[i].UserID, docs[i].Status, docs[i].Version, docs[i].EmbeddingStatus = userID, "ready", 1, DocumentEmbeddingPending
+		if _, err := repo.Create(&docs[i]); err != nil {
+			t.Fatalf("create %s: %v", docs[i].ID, err)
+		}
+	}
+
+	t.Run("list is scoped to the project, oldest first", func(t *testing.T) {
+		list, err := repo.ListByProject(projectID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range list {
+			got = append(got, d.ID+" "+d.Name)
+		}
+		want := []string{"doc-trashed old.txt", "doc-ef56ab78 notes.md", "doc-ab12cd34 Handbook.pdf"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("listed %v, want %v", got, want)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			projectID uuid.UUID
+			id        string
+			wantName  string
+		}{
+			{name: "keeps the original file name", projectID: projectID, id: "doc-ab12cd34", wantName: "Handbook.pdf"},
+			{name: "same ID in another project", projectID: otherProjectID, id: "doc-ab12cd34", wantName: "Other.pdf"},
+			{name: "unknown ID", projectID: projectID, id: "doc-missing"},
+			{name: "ID of another project only", projectID: otherProjectID, id: "doc-ef56ab78"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				doc, err := repo.Get(tt.projectID.String(), tt.id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				switch {
+				case tt.wantName == "" && doc != nil:
+					t.Errorf("got %s, want none", doc.Name)
+				case tt.wantName != "" && (doc == nil || doc.Name != tt.wantName):
+					t.Errorf("got %+v, want %s", doc, tt.wantName)
+				}
+			})
+		}
+	})
+
+	t.Run("get by hash", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			projectID uuid.UUID
+			hash      string
+			wantID    string
+		}{
+			{name: "matching content", projectID: projectID, hash: "h2", wantID: "doc-ef56ab78"},
+			{name: "documents in the trash don't match", projectID: projectID, hash: "h3"},
+			{name: "other projects' documents don't match", projectID: otherProjectID, hash: "h1"},
+			{name: "same content in the other project", projectID: otherProjectID, hash: "h3", wantID: "doc-ab12cd34"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				doc, err := repo.GetByHash(tt.projectID.String(), tt.hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := ""
+				if doc != nil {
+					got = doc.ID
+				}
+				if got != tt.wantID {
+					t.Errorf("got %q, want %q", got, tt.wantID)
+				}
+			})
+		}
+	})
+
+	t.Run("re-upload replaces the row", func(t *testing.T) {
+		reupload := docs[0]
+		reupload.Name, reupload.Version, reupload.Size = "Handbook v2.pdf", 2, 42
+		if _, err := repo.Create(&reupload); err != nil {
+			t.Fatal(err)
+		}
+		doc, err := repo.Get(projectID.String(), "doc-ab12cd34")
+		if err != nil || doc == nil {
+			t.Fatalf("get: %v, %v", doc, err)
+		}
+		if doc.Name != "Handbook v2.pdf" || doc.Version != 2 || doc.Size != 42 {
+			t.Errorf("stored %s v%d of %d bytes, want the re-upload", doc.Name, doc.Version, doc.Size)
+		}
+		other, _ := repo.Get(otherProjectID.String(), "doc-ab12cd34")
+		if other == nil || other.Name != "Other.pdf" {
+			t.Errorf("the other project's document became %+v", other)
+		}
+	})
+
+	t.Run("create missing leaves existing rows", func(t *testing.T) {
+		backfill := []Document{
+			{ID: "doc-ef56ab78", ProjectID: projectID, UserID: userID, Name: "doc-ef56ab78_20240101120100.md", StoredPath: "/docs/doc-ef56ab78_20240101120100.md", UploadedAt: day},
+			{ID: "doc-backfill", ProjectID: projectID, UserID: userID, Name: "doc-backfill.txt", StoredPath: "/docs/doc-backfill.txt", UploadedAt: day},
+		}
+		if err := repo.CreateMissing(backfill); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.CreateMissing(nil); err != nil {
+			t.Errorf("nothing to backfill: %v", err)
+		}
+		kept, _ := repo.Get(projectID.String(), "doc-ef56ab78")
+		if kept == nil || kept.Name != "notes.md" {
+			t.Errorf("existing row became %+v, want it untouched", kept)
+		}
+		added, _ := repo.Get(projectID.String(), "doc-backfill")
+		if added == nil {
+			t.Error("missing row was not added")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := repo.Delete(projectID.String(), "doc-ab12cd34"); err != nil {
+			t.Fatal(err)
+		}
+		if doc, _ := repo.Get(projectID.String(), "doc-ab12cd34"); doc != nil {
+			t.Error("document still stored")
+		}
+		if doc, _ := repo.Get(otherProjectID.String(), "doc-ab12cd34"); doc == nil {
+			t.Error("deleted the document of the same ID in another project")
+		}
+
+		if err := repo.DeleteByProject(projectID.String()); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ := repo.ListByProject(projectID.String()); len(list) != 0 {
+			t.Errorf("%d documents left after deleting the project's", len(list))
+		}
+		if list, _ := repo.ListByProject(otherProjectID.String()); len(list) != 1 {
+			t.Errorf("other project has %d documents, want 1", len(list))
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DocumentVersion is an earlier file of a re-uploaded document. The document
+// row always describes the latest version; the files it replaced are kept
+// until the document is deleted for good.
+type DocumentVersion struct {
+	ProjectID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	DocumentID   string    `gorm:"primaryKey" json:"document_id"`
+	Version      int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"` // uploader
+	Name         string    `gorm:"not null" json:"name"`
+	StoredPath   string    `gorm:"not null" json:"-"`
+	Size         int64     `gorm:"not null;default:0" json:"size"`
+	ContentType  string    `gorm:"not null;default:''" json:"content_type"`
+	ContentHash  string    `json:"content_hash,omitempty"`
+	Deduplicated bool      `gorm:"not null;default:false" json:"deduplicated"`
+	UploadedAt   time.Time `json:"uploaded_at"`
+}
+
+// CreateVersion stores an earlier file of a document
+func (r *DocumentRepository) CreateVersion(v *DocumentVersion) error {
+	return r.db.Create(v).Error
+}
+
+// ListVersions returns the earlier files of a document, newest first
+func (r *DocumentRepository) ListVersions(projectID, documentID string) ([]DocumentVersion, error) {
+	versions := []DocumentVersion{}
+	err := readDB(r.db).Where("project_id = ? AND document_id = ?", projectID, documentID).
+		Order("version DESC").Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// ListProjectVersions returns the earlier files of every document of a project
+func (r *DocumentRepository) ListProjectVersions(projectID string) ([]DocumentVersion, error) {
+	var versions []DocumentVersion
+	if err := r.db.Where("project_id = ?", projectID).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetVersion returns an earlier file of a document, or nil if there is none
+func (r *DocumentRepository) GetVersion(projectID, documentID string, version int) (*DocumentVersion, error) {
+	var v DocumentVersion
+	err := r.db.Where("project_id = ? AND document_id = ? AND version = ?", projectID, documentID, version).First(&v).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+// UpdateVersionPath saves where an earlier file of a document is stored
+func (r *DocumentRepository) UpdateVersionPath(v *DocumentVersion) error {
+	return r.db.Model(&DocumentVersion{}).
+		Where("project_id = ? AND document_id = ? AND version = ?", v.ProjectID, v.DocumentID, v.Version).
+		Update("stored_path", v.StoredPath).Error
+}
+
+// DeleteVersions removes the rows of every earlier file of a document
+func (r *DocumentRepository) DeleteVersions(projectID, documentID string) error {
+	return r.db.Where("project_id = ? AND document_id = ?", projectID, documentID).Delete(&DocumentVersion{}).Error
+}
+
+// VersionBytesByUser sums the earlier files uploaded by userID that take up
+// space of their own
+func (r *DocumentRepository) VersionBytesByUser(userID string) (int64, error) {
+	var total int64
+	err := readDB(r.db).Model(&DocumentVersion{}).Select("COALESCE(SUM(size), 0)").
+		Where("user_id = ? AND NOT deduplicated", userID).Scan(&total).Error
+	return total, err
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EmbeddingStatus is the state of an embedding job
+type EmbeddingStatus string
+
+const (
+	EmbeddingPending EmbeddingStatus = "pending"
+	EmbeddingRunning EmbeddingStatus = "running"
+	EmbeddingDone    EmbeddingStatus = "done"
+	EmbeddingFailed  EmbeddingStatus = "failed"
+)
+
+// EmbeddingJob tracks one request to embed a project's documents, or a
+// single document of it, on the AI service
+type EmbeddingJob struct {
+	ID          uuid.UUID       `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID   uuid.UUID       `gorm:"type:uuid;not null;index" json:"project_id"`
+	DocumentID  string          `gorm:"not null;default:''" json:"document_id,omitempty"` // Empty for the whole project
+	UserID      uuid.UUID       `gorm:"type:uuid;not null;index" json:"user_id"`
+	Status      EmbeddingStatus `gorm:"not null;default:'pending'" json:"status"`
+	Error       string          `gorm:"type:text" json:"error,omitempty"`
+	StartedAt   *time.Time      `json:"started_at"`
+	CompletedAt *time.Time      `json:"completed_at"`
+	CreatedAt   time.Time       `gorm:"default:now()" json:"created_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (j *EmbeddingJob) BeforeCreate(tx *gorm.DB) (err error) {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	if j.Status == "" {
+		j.Status = EmbeddingPending
+	}
+	if j.CreatedAt.IsZero() {
+		j.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// Finished reports whether the job has stopped, successfully or not
+func (j *EmbeddingJob) Finished() bool {
+	return j.Status == EmbeddingDone || j.Status == EmbeddingFailed
+}
+
+// EmbeddingJobRepository handles embedding job database operations
+type EmbeddingJobRepository struct {
+	db *gorm.DB
+}
+
+// NewEmbeddingJob creates a new EmbeddingJobRepository
+func NewEmbeddingJob(db *gorm.DB) *EmbeddingJobRepository {
+	return &EmbeddingJobRepository{db}
+}
+
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *EmbeddingJobRepository) WithContext(ctx context.Context) *EmbeddingJobRepository {
+	return &EmbeddingJobRepository{r.db.WithContext(ctx)}
+}
+
+// Create stores a new job
+func (r *EmbeddingJobRepository) Create(j *EmbeddingJob) (*EmbeddingJob, error) {
+	if err := r.db.Create(j).Error; err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// ErrEmbeddingInProgress is returned by CreateIfIdle when the project already
+// has an unfinished job
+var ErrEmbeddingInProgress = errors.New("embedding_in_progress")
+
+// CreateIfIdle stores a new job unless its project already has a pending or
+// running one, in which case that job is returned with ErrEmbeddingInProgress.
+// The project row is locked so concurrent requests cannot both get through.
+func (r *EmbeddingJobRepository) CreateIfIdle(j *EmbeddingJob) (*EmbeddingJob, error) {
+	var active *EmbeddingJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var project Project
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", j.ProjectID).Take(&project).Error; err != nil {
+			return err
+		}
+
+		var existing EmbeddingJob
+		err := tx.Where("project_id = ? AND status IN ?", j.ProjectID, []EmbeddingStatus{EmbeddingPending, EmbeddingRunning}).
+			Order("created_at ASC").First(&existing).Error
+		if err == nil {
+			active = &existing
+			return ErrEmbeddingInProgress
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(j).Error
+	})
+	if active != nil {
+		return active, ErrEmbeddingInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// ResetUnfinished moves jobs that were running back to pending and returns
+// every pending job, oldest first, so they can be queued again
+func (r *EmbeddingJobRepository) ResetUnfinished() ([]EmbeddingJob, error) {
+	err := r.db.Model(&EmbeddingJob{}).Where("status = ?", EmbeddingRunning).
+		Updates(map[string]interface{}{"status": EmbeddingPending, "started_at": nil}).Error
+	if err != nil {
+		return nil, err
+	}
+	var jobs []EmbeddingJob
+	if err := r.db.Where("status = ?", EmbeddingPending).Order("created_at ASC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetByID retrieves a job of a project, returning nil if it does not exist
+func (r *EmbeddingJobRepository) GetByID(projectID, id string) (*EmbeddingJob, error) {
+	var j EmbeddingJob
+	if err := r.db.Where("project_id = ? AND id = ?", projectID, id).First(&j).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &j, nil
+}
+
+// MarkRunning records that the AI service has started on a job
+func (r *EmbeddingJobRepository) MarkRunning(id uuid.UUID) error {
+	return r.db.Model(&EmbeddingJob{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": EmbeddingRunning, "started_at": time.Now()}).Error
+}
+
+// Finish records the outcome of a job; a nil jobErr means it succeeded
+func (r *EmbeddingJobRepository) Finish(id uuid.UUID, jobErr error) error {
+	updates := map[string]interface{}{"status": EmbeddingDone, "error": "", "completed_at": time.Now()}
+	if jobErr != nil {
+		updates["status"] = EmbeddingFailed
+		updates["error"] = jobErr.Error()
+	}
+	return r.db.Model(&EmbeddingJob{}).Where("id = ?", id).Updates(updates).Error
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Execution triggers
+const (
+	TriggerManual   = "manual"
+	TriggerSchedule = "schedule"
+	TriggerPublic   = "public"
+	TriggerWebhook  = "webhook"
+)
+
+// Execution statuses
+const (
+	ExecutionRunning   = "running"
+	ExecutionSucceeded = "succeeded"
+	ExecutionFailed    = "failed"
+)
+
+// Execution records a single run of a project's workflow
+type Execution struct {
+	ID               uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID        uuid.UUID      `gorm:"type:uuid;not null;index" json:"project_id"`
+	UserID           uuid.UUID      `gorm:"type:uuid;index" json:"user_id"`
+	ScheduleID       *uuid.UUID     `gorm:"type:uuid;index" json:"schedule_id,omitempty"`
+	Trigger          string         `gorm:"not null;default:'manual'" json:"trigger"` // manual, schedule, public, webhook
+	Status           string         `gorm:"not null" json:"status"`                   // running, succeeded, failed
+	Input            string         `gorm:"type:text" json:"input"`
+	Response         string         `gorm:"type:text" json:"response"`
+	Error            string         `gorm:"type:text" json:"error,omitempty"`
+	ModelUsed        string         `json:"model_used"`
+	ProcessingTimeMs float64        `json:"processing_time_ms"`
+	PromptTokens     int            `gorm:"not null;default:0" json:"prompt_tokens"`
+	CompletionTokens int            `gorm:"not null;default:0" json:"completion_tokens"`
+	TotalTokens      int            `gorm:"not null;default:0" json:"total_tokens"`
+	NodesExecuted    datatypes.JSON `gorm:"type:jsonb" json:"nodes_executed"`
+	NodeTraces       datatypes.JSON `gorm:"type:jsonb" json:"node_traces,omitempty"` // Per-node timings, when the AI service reports them
+	CreatedAt        time.Time      `gorm:"default:now();index" json:"created_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (e *Execution) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// ExecutionRepository handles execution database operations
+type ExecutionRepository struct {
+	db *gorm.DB
+}
+
+// NewExecution creates a new ExecutionRepository
+func NewExecution(db *gorm.DB) *ExecutionRepository {
+	return &ExecutionRepository{db}
+}
+
+// Create stores an execution
+func (r *ExecutionRepository) Create(e *Execution) (*Execution, error) {
+	if err := r.db.Create(e).Error; err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Update saves the outcome of an execution that was stored while running
+func (r *ExecutionRepository) Update(e *Execution) (*Execution, error) {
+	if err := r.db.Save(e).Error; err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ListByProject returns up to limit executions of a project after cursor
+// (nil for the most recent), with the cursor of the next page or nil when
+// there are no more
+func (r *ExecutionRepository) ListByProject(projectID string, cursor *Cursor, limit int) ([]Execution, *Cursor, error) {
+	var executions []Execution
+	q := keysetPage(readDB(r.db).Where("project_id = ?", projectID), "executions", cursor, limit)
+	if err := q.Find(&executions).Error; err != nil {
+		return nil, nil, err
+	}
+	n, next := nextCursor(len(executions), limit, func(i int) (time.Time, uuid.UUID) {
+		return executions[i].CreatedAt, executions[i].ID
+	})
+	return executions[:n], next, nil
+}
+
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *ExecutionRepository) WithContext(ctx context.Context) *ExecutionRepository {
+	return &ExecutionRepository{r.db.WithContext(ctx)}
+}
+
+// LastByProject returns the most recent execution of a project, or nil if it never ran
+func (r *ExecutionRepository) LastByProject(projectID string) (*Execution, error) {
+	var e Execution
+	if err := readDB(r.db).Where("project_id = ?", projectID).Order("created_at DESC").First(&e).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+// TokenUsage is the tokens a project's executions used with one model on one
+// day (UTC)
+type TokenUsage struct {
+	Day         string // YYYY-MM-DD
+	ModelUsed   string
+	TotalTokens int64
+}
+
+// TokenUsageByDay sums the tokens of a project's executions created between
+// from and to (either may be nil) per day and model, oldest day first
+func (r *ExecutionRepository) TokenUsageByDay(projectID string, from, to *time.Time) ([]TokenUsage, error) {
+	usage := []TokenUsage{}
+	q := readDB(r.db).Model(&Execution{}).
+		Select("to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, model_used, SUM(total_tokens) AS total_tokens").
+		Where("project_id = ? AND total_tokens > 0", projectID)
+	if from != nil {
+		q = q.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		q = q.Where("created_at < ?", *to)
+	}
+	if err := q.Group("day, model_used").Order("day ASC, model_used ASC").Scan(&usage).Error; err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
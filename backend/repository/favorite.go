@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProjectFavorite marks a project as pinned by a user. It is a join table
+// rather than a project column because members can favorite shared projects.
+type ProjectFavorite struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"project_id"`
+	CreatedAt time.Time `gorm:"default:now()" json:"created_at"`
+}
+
+// favoritedBy selects the IDs of the projects userID has favorited
+func favoritedBy(db *gorm.DB, userID string) *gorm.DB {
+	return db.Model(&ProjectFavorite{}).Select("project_id").Where("user_id = ?", userID)
+}
+
+// withFavoriteFlag selects columns together with whether userID has favorited the project
+func withFavoriteFlag(q *gorm.DB, columns, userID string) *gorm.DB {
+	return q.Select(columns+", EXISTS (SELECT 1 FROM project_favorites f WHERE f.project_id = projects.id AND f.user_id = ?) AS is_favorite", userID)
+}
+
+// AddFavorite favorites a project for userID; favoriting twice is a no-op
+func (r *ProjectRepository) AddFavorite(projectID, userID uuid.UUID) error {
+	db, span := startSpan(r.db, "ProjectRepository.AddFavorite")
+	defer span.End()
+
+	fav := ProjectFavorite{UserID: userID, ProjectID: projectID, CreatedAt: time.Now()}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&fav).Error
+}
+
+// RemoveFavorite unfavorites a project for userID; removing a missing favorite is a no-op
+func (r *ProjectRepository) RemoveFavorite(projectID, userID uuid.UUID) error {
+	db, span := startSpan(r.db, "ProjectRepository.RemoveFavorite")
+	defer span.End()
+
+	return db.Delete(&ProjectFavorite{}, "project_id = ? AND user_id = ?", projectID, userID).Error
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuthProvider is an OAuth provider a user can sign in with
+type AuthProvider string
+
+const (
+	ProviderGoogle AuthProvider = "google"
+	ProviderGitHub AuthProvider = "github"
+)
+
+// UserIdentity links a user to an account at an OAuth provider. A user can have
+// one identity per provider; tokens are stored encrypted like session tokens.
+type UserIdentity struct {
+	ID                    uuid.UUID    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID                uuid.UUID    `gorm:"type:uuid;not null;index" json:"user_id"`
+	Provider              AuthProvider `gorm:"not null;uniqueIndex:idx_identity_provider_user" json:"provider"`
+	ProviderUserID        string       `gorm:"not null;uniqueIndex:idx_identity_provider_user" json:"provider_user_id"`
+	AccessTokenEncrypted  string       `gorm:"type:text" json:"-"`
+	RefreshTokenEncrypted string       `gorm:"type:text" json:"-"`
+	EncryptionKeyVersion  int          `gorm:"not null;default:0" json:"-"`
+	ExpiresAt             *time.Time   `json:"expires_at"`
+	CreatedAt             time.Time    `gorm:"default:now()" json:"created_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	if i.CreatedAt.IsZero() {
+		i.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// UserIdentityRepository handles linked OAuth identities
+type UserIdentityRepository struct {
+	db *gorm.DB
+}
+
+// NewUserIdentity creates a new UserIdentityRepository
+func NewUserIdentity(db *gorm.DB) *UserIdentityRepository {
+	return &UserIdentityRepository{db}
+}
+
+// GetByProvider returns the identity for a provider account, or nil if it isn't linked
+func (r *UserIdentityRepository) GetByProvider(provider AuthProvider, providerUserID string) (*UserIdentity, error) {
+	var i UserIdentity
+	if err := r.db.Where("provider = ? AND provider_user_id = ?", provider, providerUserID).First(&i).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+// ListByUser returns every identity linked to a user
+func (r *UserIdentityRepository) ListByUser(userID string) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	if err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Create links a new identity
+func (r *UserIdentityRepository) Create(i *UserIdentity) (*UserIdentity, error) {
+	if err := r.db.Create(i).Error; err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// UpdateTokens stores fresh encrypted tokens for an identity. An empty refresh
+// token keeps the stored one, as providers only send it on first consent.
+func (r *UserIdentityRepository) UpdateTokens(i *UserIdentity) error {
+	updates := map[string]interface{}{
+		"access_token_encrypted": i.AccessTokenEncrypted,
+		"encryption_key_version": i.EncryptionKeyVersion,
+		"expires_at":             i.ExpiresAt,
+	}
+	if i.RefreshTokenEncrypted != "" {
+		updates["refresh_token_encrypted"] = i.RefreshTokenEncrypted
+	}
+	return r.db.Model(&UserIdentity{}).Where("id = ?", i.ID).Updates(updates).Error
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MemberRole is the access level a collaborator has on a project
+type MemberRole string
+
+const (
+	MemberViewer MemberRole = "viewer" // can view the project and run the demo
+	MemberEditor MemberRole = "editor" // can also update the workflow and documents
+)
+
+// Valid reports whether r is a known member role
+func (r MemberRole) Valid() bool {
+	return r == MemberViewer || r == MemberEditor
+}
+
+// ProjectMember grants a user access to a project owned by someone else.
+// Invites for emails without an account have no UserID until first login.
+type ProjectMember struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID  uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_project_member_email" json:"project_id"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	Email      string     `gorm:"not null;uniqueIndex:idx_project_member_email;index" json:"email"`
+	Role       MemberRole `gorm:"not null;default:'viewer'" json:"role"`
+	InvitedBy  uuid.UUID  `gorm:"type:uuid" json:"invited_by"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	CreatedAt  time.Time  `gorm:"default:now()" json:"created_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (m *ProjectMember) BeforeCreate(tx *gorm.DB) (err error) {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// Pending reports whether the invite has not been linked to an account yet
+func (m *ProjectMember) Pending() bool {
+	return m.UserID == nil
+}
+
+// ProjectMemberRepository handles project member database operations
+type ProjectMemberRepository struct {
+	db *gorm.DB
+}
+
+// NewProjectMember creates a new ProjectMemberRepository
+func NewProjectMember(db *gorm.DB) *ProjectMemberRepository {
+	return &ProjectMemberRepository{db}
+}
+
+// Create adds a member to a project
+func (r *ProjectMemberRepository) Create(m *ProjectMember) (*ProjectMember, error) {
+	if err := r.db.Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ListByProject returns all members and pending invites of a project
+func (r *ProjectMemberRepository) ListByProject(projectID string) ([]ProjectMember, error) {
+	var members []ProjectMember
+	if err := readDB(r.db).Where("project_id = ?", projectID).Order("created_at ASC").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// GetByID retrieves a member of a project by member ID
+func (r *ProjectMemberRepository) GetByID(projectID, id string) (*ProjectMember, error) {
+	var m ProjectMember
+	if err := r.db.Where("project_id = ? AND id = ?", projectID, id).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetByProjectAndEmail returns the member invited with email, or nil if none
+func (r *ProjectMemberRepository) GetByProjectAndEmail(projectID, email string) (*ProjectMember, error) {
+	var m ProjectMember
+	if err := r.db.Where("project_id = ? AND lower(email) = lower(?)", projectID, email).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// UpdateRole changes a member's role
+func (r *ProjectMemberRepository) UpdateRole(m *ProjectMember, role MemberRole) error {
+	m.Role = role
+	return r.db.Model(m).Update("role", role).Error
+}
+
+// Delete removes a member from a project
+func (r *ProjectMemberRepository) Delete(projectID, id string) error {
+	return r.db.Delete(&ProjectMember{}, "project_id = ? AND id = ?", projectID, id).Error
+}
+
+// ResolvePendingInvites links every pending invite for email to userID and
+// returns the number of invites accepted.
+func (r *ProjectMemberRepository) ResolvePendingInvites(email string, userID uuid.UUID) (int64, error) {
+	now := time.Now()
+	res := r.db.Model(&ProjectMember{}).
+		Where("user_id IS NULL AND lower(email) = lower(?)", email).
+		Updates(map[string]interface{}{"user_id": userID, "accepted_at": now})
+	return res.RowsAffected, res.Error
+}
@@ -1,24 +1,128 @@
 package repository
 
 import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ProjectStatus is the lifecycle state of a project
+type ProjectStatus string
+
+const (
+	ProjectStatusDraft    ProjectStatus = "draft"
+	ProjectStatusActive   ProjectStatus = "active"
+	ProjectStatusArchived ProjectStatus = "archived"
+)
+
+// projectStatusTransitions lists the statuses each status may move to
+var projectStatusTransitions = map[ProjectStatus][]ProjectStatus{
+	ProjectStatusDraft:    {ProjectStatusActive, ProjectStatusArchived},
+	ProjectStatusActive:   {ProjectStatusDraft, ProjectStatusArchived},
+	ProjectStatusArchived: {ProjectStatusDraft},
+}
+
+// Valid reports whether s is a known project status
+func (s ProjectStatus) Valid() bool {
+	_, ok := projectStatusTransitions[s]
+	return ok
+}
+
+// ProjectSettings are project-wide defaults for ai-model nodes. Zero values
+// mean "not set"; Temperature is a pointer because 0 is a valid temperature.
+type ProjectSettings struct {
+	DefaultModel string   `json:"default_model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	MaxTokens    int      `json:"max_tokens,omitempty"`
+	SystemPrompt string   `json:"system_prompt,omitempty"`
+}
+
+// Value stores the settings as JSON
+func (s ProjectSettings) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads the settings from JSON; NULL yields empty settings
+func (s *ProjectSettings) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = ProjectSettings{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	}
+	return fmt.Errorf("unsupported project settings value %T", value)
+}
+
+// CanTransitionTo reports whether a project in status s may move to status to.
+// Keeping the current status is always allowed; an empty status counts as draft.
+func (s ProjectStatus) CanTransitionTo(to ProjectStatus) bool {
+	if s == "" {
+		s = ProjectStatusDraft
+	}
+	if s == to {
+		return true
+	}
+	for _, allowed := range projectStatusTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
 // Project represents a workflow project owned by a user
 type Project struct {
-	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	UserID      uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
-	Name        string         `gorm:"not null" json:"name"`
-	Description string         `json:"description"`
-	Nodes       datatypes.JSON `gorm:"type:jsonb" json:"nodes"`       // Workflow nodes as JSON
-	Connections datatypes.JSON `gorm:"type:jsonb" json:"connections"` // Workflow connections as JSON
-	Status      string         `gorm:"default:'draft'" json:"status"` // draft, active, archived
-	CreatedAt   time.Time      `gorm:"default:now()" json:"created_at"`
-	UpdatedAt   *time.Time     `json:"updated_at"`
+	ID               uuid.UUID                   `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID           uuid.UUID                   `gorm:"type:uuid;not null;index" json:"user_id"`
+	TenantID         *uuid.UUID                  `gorm:"type:uuid;index" json:"tenant_id,omitempty"`
+	TeamID           *uuid.UUID                  `gorm:"type:uuid;index" json:"team_id,omitempty"` // Shared with the team's members
+	Name             string                      `gorm:"not null" json:"name"`
+	Description      string                      `json:"description"`
+	Nodes            datatypes.JSON              `gorm:"type:jsonb" json:"nodes"`       // Workflow nodes as JSON
+	Connections      datatypes.JSON              `gorm:"type:jsonb" json:"connections"` // Workflow connections as JSON
+	Status           ProjectStatus               `gorm:"default:'draft'" json:"status"` // draft, active, archived
+	Tags             datatypes.JSONSlice[string] `gorm:"type:jsonb;default:'[]'" json:"tags"`
+	Thumbnail        string                      `json:"-"`                                // Path of the stored thumbnail image
+	ThumbURL         string                      `gorm:"-" json:"thumbnail_url,omitempty"` // Computed, not stored
+	PreviewURL       string                      `json:"preview_url,omitempty"`            // Set once a workflow preview is rendered
+	Settings         ProjectSettings             `gorm:"type:jsonb" json:"settings"`
+	DefaultAPIKeyID  *uuid.UUID                  `gorm:"type:uuid" json:"default_api_key_id"` // Key used when running the project
+	Version          int                         `gorm:"not null;default:1" json:"version"`   // Bumped on every save
+	LastOpened       *time.Time                  `gorm:"column:last_opened_at;index" json:"last_opened_at"`
+	PublishedAt      *time.Time                  `json:"published_at"`
+	PublishedVersion *int                        `json:"published_version"`                             // Version the public endpoint runs
+	PublicSlug       *string                     `gorm:"uniqueIndex" json:"public_slug,omitempty"`      // Assigned on first publish
+	WebhookEnabled   bool                        `gorm:"not null;default:false" json:"webhook_enabled"` // Runs on signed POST /webhooks/trigger/:projectId
+	WebhookSecret    string                      `json:"-"`                                             // Encrypted signing secret of the inbound webhook
+	NewWebhookSecret string                      `gorm:"-" json:"webhook_secret,omitempty"`             // Only in the response that generated the secret
+	TokenBudget      *int64                      `json:"token_budget"`                                  // Tokens runs may use in total; nil is unlimited
+	TokensUsed       int64                       `gorm:"<-:create;default:0" json:"tokens_used"`        // Changed only by AddTokensUsed and ResetTokensUsed
+	IsFavorite       bool                        `gorm:"->;-:migration" json:"is_favorite"`             // For the listing caller, not stored
+	CreatedAt        time.Time                   `gorm:"default:now()" json:"created_at"`
+	UpdatedAt        *time.Time                  `json:"updated_at"`
+}
+
+// AfterFind hook to expose the thumbnail endpoint when a thumbnail is stored
+func (p *Project) AfterFind(tx *gorm.DB) (err error) {
+	if p.Thumbnail != "" {
+		p.ThumbURL = "/api/v1/projects/" + p.ID.String() + "/thumbnail"
+	}
+	return nil
 }
 
 // BeforeCreate hook to ensure UUID
@@ -26,6 +130,9 @@ func (p *Project) BeforeCreate(tx *gorm.DB) (err error) {
 	if p.ID == uuid.Nil {
 		p.ID = uuid.New()
 	}
+	if p.Version == 0 {
+		p.Version = 1
+	}
 	if p.CreatedAt.IsZero() {
 		p.CreatedAt = time.Now()
 	}
@@ -49,18 +156,74 @@ func NewProject(db *gorm.DB) *ProjectRepository {
 	return &ProjectRepository{db}
 }
 
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *ProjectRepository) WithContext(ctx context.Context) *ProjectRepository {
+	return &ProjectRepository{r.db.WithContext(ctx)}
+}
+
 // Create creates a new project
 func (r *ProjectRepository) Create(p *Project) (*Project, error) {
-	if err := r.db.Create(p).Error; err != nil {
+	db, span := startSpan(r.db, "ProjectRepository.Create")
+	defer span.End()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(p).Error; err != nil {
+			return err
+		}
+		return saveVersion(tx, p)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return p, nil
 }
 
-// GetByID retrieves a project by ID
+// GetByID retrieves a project by ID, from the project cache when possible
 func (r *ProjectRepository) GetByID(id string) (*Project, error) {
+	db, span := startSpan(r.db, "ProjectRepository.GetByID")
+	defer span.End()
+
+	cache := cachedProjects()
+	if p, ok := cache.Get(id); ok && sameTenant(db, p.TenantID) {
+		projectCacheHits.Add(1)
+		return cloneProject(p), nil
+	}
+	projectCacheMiss.Add(1)
+
+	gen := projectGeneration(id)
+	var p Project
+	if err := db.Where("id = ?", id).First(&p).Error; err != nil {
+		return nil, err
+	}
+	cacheProject(id, *cloneProject(p), gen)
+	return &p, nil
+}
+
+// sameTenant reports whether a row of tenantID is visible to db, which the
+// tenant callbacks would otherwise check in the query. A scope of no tenant
+// only sees rows without one.
+func sameTenant(db *gorm.DB, tenantID *uuid.UUID) bool {
+	want, ok := tenantScopeFromContext(db.Statement.Context)
+	if !ok {
+		return true
+	}
+	if want == uuid.Nil {
+		return tenantID == nil
+	}
+	return tenantID != nil && *tenantID == want
+}
+
+// GetByUserIDAndName retrieves a user's project by name (case-insensitive).
+// It returns nil when no such project exists.
+func (r *ProjectRepository) GetByUserIDAndName(userID, name string) (*Project, error) {
+	db, span := startSpan(r.db, "ProjectRepository.GetByUserIDAndName")
+	defer span.End()
+
 	var p Project
-	if err := r.db.Where("id = ?", id).First(&p).Error; err != nil {
+	if err := db.Where("user_id = ? AND lower(name) = lower(?)", userID, name).First(&p).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return &p, nil
@@ -68,36 +231,405 @@ func (r *ProjectRepository) GetByID(id string) (*Project, error) {
 
 // GetByUserID retrieves all projects for a user
 func (r *ProjectRepository) GetByUserID(userID string) ([]Project, error) {
+	db, span := startSpan(r.db, "ProjectRepository.GetByUserID")
+	defer span.End()
+
 	var projects []Project
-	if err := r.db.Where("user_id = ?", userID).Order("updated_at DESC, created_at DESC").Find(&projects).Error; err != nil {
+	if err := readDB(db).Where("user_id = ?", userID).Order(projectListOrder).Find(&projects).Error; err != nil {
 		return nil, err
 	}
 	return projects, nil
 }
 
-// ListAll returns all projects (ordered) -- used when auth is not required
-func (r *ProjectRepository) ListAll() ([]Project, error) {
+// PageByUserID is GetByUserID one page at a time: up to limit projects after
+// cursor (nil for the newest), by creation time, with the cursor of the next
+// page or nil when there are no more
+func (r *ProjectRepository) PageByUserID(userID string, cursor *Cursor, limit int) ([]Project, *Cursor, error) {
+	db, span := startSpan(r.db, "ProjectRepository.PageByUserID")
+	defer span.End()
+
 	var projects []Project
-	if err := r.db.Order("updated_at DESC, created_at DESC").Find(&projects).Error; err != nil {
+	q := keysetPage(readDB(db).Where("projects.user_id = ?", userID), "projects", cursor, limit)
+	if err := q.Find(&projects).Error; err != nil {
+		return nil, nil, err
+	}
+	n, next := nextCursor(len(projects), limit, func(i int) (time.Time, uuid.UUID) {
+		return projects[i].CreatedAt, projects[i].ID
+	})
+	return projects[:n], next, nil
+}
+
+// projectListOrder sorts listings by last save, newest first. Untouched
+// projects have a NULL updated_at, so their creation time stands in; id breaks
+// ties so pages are stable.
+const projectListOrder = "COALESCE(projects.updated_at, projects.created_at) DESC, projects.id DESC"
+
+// ProjectFilter narrows project listings
+type ProjectFilter struct {
+	Status      ProjectStatus // empty means every status except archived
+	Tag         string        // only projects carrying this tag
+	FavoritesOf string        // only projects favorited by this user
+}
+
+// apply adds the filter conditions to q
+func (f ProjectFilter) apply(q *gorm.DB) *gorm.DB {
+	if f.Status == "" {
+		q = q.Where("projects.status IS NULL OR projects.status <> ?", ProjectStatusArchived)
+	} else {
+		q = q.Where("projects.status = ?", f.Status)
+	}
+	if f.Tag != "" {
+		q = q.Where("projects.tags @> ?", datatypes.JSONSlice[string]{f.Tag})
+	}
+	if f.FavoritesOf != "" {
+		q = q.Where("projects.id IN (?)", favoritedBy(q.Session(&gorm.Session{NewDB: true}), f.FavoritesOf))
+	}
+	return q
+}
+
+// accessibleBy limits q to projects userID owns, is a member of or shares
+// through a team
+func accessibleBy(db, q *gorm.DB, userID string) *gorm.DB {
+	members := db.Model(&ProjectMember{}).Select("project_id").Where("user_id = ?", userID)
+	teams := db.Model(&TeamMember{}).Select("team_id").Where("user_id = ?", userID)
+	return q.Where("projects.user_id = ? OR projects.id IN (?) OR projects.team_id IN (?)", userID, members, teams)
+}
+
+// GetAccessibleByUserID retrieves the projects a user owns or has been added to as a member,
+// with the user's favorites first. Archived projects are only returned when the filter asks for them.
+func (r *ProjectRepository) GetAccessibleByUserID(userID string, filter ProjectFilter) ([]Project, error) {
+	db, span := startSpan(r.db, "ProjectRepository.GetAccessibleByUserID")
+	defer span.End()
+
+	var projects []Project
+	q := withFavoriteFlag(accessibleBy(db, readDB(db), userID), "projects.*", userID)
+	if err := filter.apply(q).Order("is_favorite DESC, " + projectListOrder).Find(&projects).Error; err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+// MarkOpened records that userID opened a project in a single UPDATE. It
+// reports false when the project doesn't exist or the user can't access it.
+func (r *ProjectRepository) MarkOpened(id, userID string) (bool, error) {
+	db, span := startSpan(r.db, "ProjectRepository.MarkOpened")
+	defer span.End()
+
+	defer evictProject(id)
+	q := accessibleBy(db, db.Model(&Project{}).Where("id = ?", id), userID)
+	res := q.UpdateColumn("last_opened_at", time.Now())
+	return res.RowsAffected > 0, res.Error
+}
+
+// RecentByUserID returns the accessible, non-archived projects a user opened
+// most recently
+func (r *ProjectRepository) RecentByUserID(userID string, limit int) ([]Project, error) {
+	db, span := startSpan(r.db, "ProjectRepository.RecentByUserID")
+	defer span.End()
+
+	var projects []Project
+	q := ProjectFilter{}.apply(accessibleBy(db, readDB(db), userID))
+	if err := q.Where("last_opened_at IS NOT NULL").Order("last_opened_at DESC").Limit(limit).Find(&projects).Error; err != nil {
 		return nil, err
 	}
 	return projects, nil
 }
 
-// Update updates an existing project
+// TagCount is a tag and the number of projects carrying it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// TagCountsByUserID returns the distinct tags on the non-archived projects a
+// user can access, most used first
+func (r *ProjectRepository) TagCountsByUserID(userID string) ([]TagCount, error) {
+	db, span := startSpan(r.db, "ProjectRepository.TagCountsByUserID")
+	defer span.End()
+
+	var counts []TagCount
+	q := readDB(db).Table("projects, jsonb_array_elements_text(projects.tags) AS tag").
+		Select("tag, count(*) AS count")
+	q = ProjectFilter{}.apply(accessibleBy(db, q, userID))
+	if err := q.Group("tag").Order("count DESC, tag ASC").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// MemberRole returns the role userID holds on a project as a collaborator,
+// or an empty role when the user is not a member.
+func (r *ProjectRepository) MemberRole(projectID, userID string) (MemberRole, error) {
+	db, span := startSpan(r.db, "ProjectRepository.MemberRole")
+	defer span.End()
+
+	var m ProjectMember
+	if err := db.Where("project_id = ? AND user_id = ?", projectID, userID).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return m.Role, nil
+}
+
+// TeamRole returns the role userID holds in the team a project is shared
+// with, or an empty role when the user is not a member
+func (r *ProjectRepository) TeamRole(teamID, userID string) (TeamRole, error) {
+	db, span := startSpan(r.db, "ProjectRepository.TeamRole")
+	defer span.End()
+
+	return NewTeam(db).MemberRole(teamID, userID)
+}
+
+// ProjectSummary is the listing view of a project: everything but the workflow graph
+type ProjectSummary struct {
+	ID          uuid.UUID                   `json:"id"`
+	Name        string                      `json:"name"`
+	Description string                      `json:"description"`
+	Status      ProjectStatus               `json:"status"`
+	Tags        datatypes.JSONSlice[string] `json:"tags"`
+	NodeCount   int                         `json:"node_count"`
+	IsFavorite  bool                        `json:"is_favorite"`
+	CreatedAt   time.Time                   `json:"created_at"`
+	UpdatedAt   *time.Time                  `json:"updated_at"`
+}
+
+// projectSummaryColumns selects a ProjectSummary; node_count is computed in
+// SQL so the nodes and connections blobs are never sent to the application
+const projectSummaryColumns = "projects.id, projects.name, projects.description, projects.status, projects.tags, " +
+	"COALESCE(jsonb_array_length(CASE WHEN jsonb_typeof(projects.nodes) = 'array' THEN projects.nodes END), 0) AS node_count, " +
+	"projects.created_at, projects.updated_at"
+
+// SummariesAccessibleByUserID is GetAccessibleByUserID returning summaries
+func (r *ProjectRepository) SummariesAccessibleByUserID(userID string, filter ProjectFilter) ([]ProjectSummary, error) {
+	db, span := startSpan(r.db, "ProjectRepository.SummariesAccessibleByUserID")
+	defer span.End()
+
+	var summaries []ProjectSummary
+	q := withFavoriteFlag(accessibleBy(db, readDB(db).Model(&Project{}), userID), projectSummaryColumns, userID)
+	if err := filter.apply(q).Order("is_favorite DESC, " + projectListOrder).Find(&summaries).Error; err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// AdminProjectFilter narrows the admin listing of every user's projects
+type AdminProjectFilter struct {
+	ProjectFilter
+	UserID string     // only projects owned by this user
+	From   *time.Time // created at or after
+	To     *time.Time // created at or before
+	Limit  int
+	Offset int
+}
+
+// AdminProjectSummary is a ProjectSummary with its owner
+type AdminProjectSummary struct {
+	ProjectSummary
+	UserID     uuid.UUID `json:"user_id"`
+	OwnerEmail string    `json:"owner_email"`
+	OwnerName  string    `json:"owner_name"`
+}
+
+// ListForAdmin returns a page of every user's projects joined with their
+// owners, and the total number of projects matching the filter
+func (r *ProjectRepository) ListForAdmin(filter AdminProjectFilter) ([]AdminProjectSummary, int64, error) {
+	db, span := startSpan(r.db, "ProjectRepository.ListForAdmin")
+	defer span.End()
+
+	q := filter.apply(readDB(db).Model(&Project{}).Joins("JOIN users ON users.id = projects.user_id"))
+	if filter.UserID != "" {
+		q = q.Where("projects.user_id = ?", filter.UserID)
+	}
+	if filter.From != nil {
+		q = q.Where("projects.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		q = q.Where("projects.created_at <= ?", *filter.To)
+	}
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	var total int64
+	if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var summaries []AdminProjectSummary
+	err := q.Select(projectSummaryColumns + ", projects.user_id, users.email AS owner_email, users.name AS owner_name").
+		Order(projectListOrder).Limit(filter.Limit).Offset(filter.Offset).Find(&summaries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return summaries, total, nil
+}
+
+// Update updates an existing project, bumping its version
 func (r *ProjectRepository) Update(p *Project) (*Project, error) {
-	if err := r.db.Save(p).Error; err != nil {
+	db, span := startSpan(r.db, "ProjectRepository.Update")
+	defer span.End()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return saveWithVersion(tx, p)
+	})
+	evictProject(p.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ErrVersionConflict is returned by UpdateVersion when the project was saved
+// since it was loaded
+var ErrVersionConflict = errors.New("version_conflict")
+
+// UpdateVersion updates a project like Update, but only if it is still at
+// version, the version it was loaded at. Otherwise nothing is changed and it
+// fails with ErrVersionConflict.
+func (r *ProjectRepository) UpdateVersion(p *Project, version int) (*Project, error) {
+	db, span := startSpan(r.db, "ProjectRepository.UpdateVersion")
+	defer span.End()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		p.Version = version + 1
+		res := tx.Model(p).Where("version = ?", version).Select("*").Updates(p)
+		if res.Error == nil && res.RowsAffected == 0 {
+			res.Error = ErrVersionConflict
+		}
+		if res.Error != nil {
+			p.Version = version
+			return res.Error
+		}
+		return saveVersion(tx, p)
+	})
+	evictProject(p.ID.String())
+	if err != nil {
 		return nil, err
 	}
 	return p, nil
 }
 
-// Delete deletes a project by ID
+// saveWithVersion bumps the version of p, saves it and snapshots the workflow
+func saveWithVersion(tx *gorm.DB, p *Project) error {
+	p.Version++
+	if err := tx.Save(p).Error; err != nil {
+		p.Version--
+		return err
+	}
+	return saveVersion(tx, p)
+}
+
+// UpdateLocked loads a project with a row lock, applies fn and saves the result
+// in one transaction, so concurrent partial updates are serialized instead of
+// overwriting each other. Returning an error from fn aborts the update.
+func (r *ProjectRepository) UpdateLocked(id string, fn func(p *Project) error) (*Project, error) {
+	db, span := startSpan(r.db, "ProjectRepository.UpdateLocked")
+	defer span.End()
+
+	var p Project
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&p).Error; err != nil {
+			return err
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+		return saveWithVersion(tx, &p)
+	})
+	evictProject(id)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Delete deletes a project by ID along with its members, favorites, schedules, webhooks, executions, versions, embedding jobs, documents and uploads
 func (r *ProjectRepository) Delete(id string) error {
-	return r.db.Delete(&Project{}, "id = ?", id).Error
+	db, span := startSpan(r.db, "ProjectRepository.Delete")
+	defer span.End()
+
+	defer evictProject(id)
+	return db.Transaction(func(tx *gorm.DB) error {
+		return deleteProjectRows(tx, []string{id})
+	})
+}
+
+// deleteProjectRows deletes projects together with the rows that belong to
+// them. It must run inside a transaction.
+func deleteProjectRows(tx *gorm.DB, ids []string) error {
+	for _, child := range []interface{}{&ProjectMember{}, &ProjectFavorite{}, &Schedule{}, &Webhook{}, &Execution{}, &ProjectVersion{}, &EmbeddingJob{}, &Document{}, &DocumentVersion{}, &DocumentUpload{}} {
+		if err := tx.Delete(child, "project_id IN ?", ids).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&Project{}, "id IN ?", ids).Error
+}
+
+// SetThumbnail stores the thumbnail path of a project; an empty path clears it
+func (r *ProjectRepository) SetThumbnail(id, path string) error {
+	db, span := startSpan(r.db, "ProjectRepository.SetThumbnail")
+	defer span.End()
+
+	defer evictProject(id)
+	return db.Model(&Project{}).Where("id = ?", id).Update("thumbnail", path).Error
+}
+
+// SetPreviewURL records where a project's workflow preview is served
+func (r *ProjectRepository) SetPreviewURL(id, url string) error {
+	db, span := startSpan(r.db, "ProjectRepository.SetPreviewURL")
+	defer span.End()
+
+	defer evictProject(id)
+	return db.Model(&Project{}).Where("id = ?", id).Update("preview_url", url).Error
+}
+
+// AddTokensUsed adds the tokens of a run to a project's usage in place, so
+// concurrent runs and saves don't lose counts
+func (r *ProjectRepository) AddTokensUsed(id string, tokens int64) error {
+	db, span := startSpan(r.db, "ProjectRepository.AddTokensUsed")
+	defer span.End()
+
+	defer evictProject(id)
+	return tokensUsedColumn(db, id).UpdateColumn("tokens_used", gorm.Expr("tokens_used + ?", tokens)).Error
+}
+
+// ResetTokensUsed zeroes a project's token usage
+func (r *ProjectRepository) ResetTokensUsed(id string) error {
+	db, span := startSpan(r.db, "ProjectRepository.ResetTokensUsed")
+	defer span.End()
+
+	defer evictProject(id)
+	return tokensUsedColumn(db, id).UpdateColumn("tokens_used", 0).Error
+}
+
+// tokensUsedColumn targets the tokens_used column of a project by table
+// name: the field is create-only on Project, so updates through the model
+// would leave it out
+func tokensUsedColumn(db *gorm.DB, id string) *gorm.DB {
+	return db.Table("projects").Where("id = ?", id)
+}
+
+// DeleteMany deletes several projects and their child rows in one transaction
+func (r *ProjectRepository) DeleteMany(ids []string) error {
+	db, span := startSpan(r.db, "ProjectRepository.DeleteMany")
+	defer span.End()
+
+	defer evictProject(ids...)
+	return db.Transaction(func(tx *gorm.DB) error {
+		return deleteProjectRows(tx, ids)
+	})
 }
 
 // DeleteByUserID deletes all projects for a user
 func (r *ProjectRepository) DeleteByUserID(userID string) error {
-	return r.db.Delete(&Project{}, "user_id = ?", userID).Error
+	db, span := startSpan(r.db, "ProjectRepository.DeleteByUserID")
+	defer span.End()
+
+	defer purgeProjectCache()
+	return db.Delete(&Project{}, "user_id = ?", userID).Error
 }
@@ -0,0 +1,363 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"manju/backend/repository/repotest"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+func TestUpdateVersionConcurrentEdits(t *testing.T) {
+	db := repotest.OpenDB(t, "primary", &Project{}, &ProjectVersion{})
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1) // SQLite allows one writer at a time
+	repo := NewProject(db)
+
+	project := &Project{UserID: uuid.New(), Name: "original", Status: ProjectStatusDraft}
+	if err := db.Create(project).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	loaded := project.Version
+
+	// Every tab loaded the same version and saves its own name
+	const tabs = 5
+	errs := make([]error, tabs)
+	var wg sync.WaitGroup
+	for i := 0; i < tabs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			edit := *project
+			edit.Name = "tab " + string(rune('a'+i))
+			_, errs[i] = repo.UpdateVersion(&edit, loaded)
+		}(i)
+	}
+	wg.Wait()
+
+	var winner string
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if winner != "" {
+				t.Fatalf("%s and tab %d both saved version %d", winner, i, loaded)
+			}
+			winner = "tab " + string(rune('a'+i))
+		case !errors.Is(err, ErrVersionConflict):
+			t.Fatalf("tab %d: %v, want ErrVersionConflict", i, err)
+		}
+	}
+	if winner == "" {
+		t.Fatal("no tab saved the project")
+	}
+
+	var saved Project
+	if err := db.First(&saved, "id = ?", project.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.Name != winner || saved.Version != loaded+1 {
+		t.Fatalf("saved %q at version %d, want %q at version %d", saved.Name, saved.Version, winner, loaded+1)
+	}
+}
+
+func TestUpdateVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version func(current int) int
+		wantErr error
+	}{
+		{name: "current version saves", version: func(current int) int { return current }},
+		{name: "stale version conflicts", version: func(current int) int { return current - 1 }, wantErr: ErrVersionConflict},
+		{name: "future version conflicts", version: func(current int) int { return current + 1 }, wantErr: ErrVersionConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := repotest.OpenDB(t, "primary", &Project{}, &ProjectVersion{})
+			repo := NewProject(db)
+			project := &Project{UserID: uuid.New(), Name: "original", Status: ProjectStatusDraft, Version: 3}
+			if err := db.Create(project).Error; err != nil {
+				t.Fatalf("create: %v", err)
+			}
+
+			edit := *project
+			edit.Name = "edited"
+			version := tt.version(project.Version)
+			_, err := repo.UpdateVersion(&edit, version)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateVersion: %v, want %v", err, tt.wantErr)
+			}
+
+			var saved Project
+			if err := db.First(&saved, "id = ?", project.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			wantName, wantVersion := "edited", version+1
+			if tt.wantErr != nil {
+				wantName, wantVersion = "original", project.Version
+				if edit.Version != version {
+					t.Errorf("failed update left the version at %d, want %d", edit.Version, version)
+				}
+			}
+			if saved.Name != wantName || saved.Version != wantVersion {
+				t.Errorf("saved %q at version %d, want %q at version %d", saved.Name, saved.Version, wantName, wantVersion)
+			}
+		})
+	}
+}
+
+func TestProjectStatusTransitions(t *testing.T) {
+	statuses := []ProjectStatus{ProjectStatusDraft, ProjectStatusActive, ProjectStatusArchived}
+	tests := []struct {
+		from ProjectStatus
+		// allowed are the statuses from may move to
+		allowed []ProjectStatus
+	}{
+		{from: "", allowed: []ProjectStatus{ProjectStatusDraft, ProjectStatusActive, ProjectStatusArchived}},
+		{from: ProjectStatusDraft, allowed: []ProjectStatus{ProjectStatusDraft, ProjectStatusActive, ProjectStatusArchived}},
+		{from: ProjectStatusActive, allowed: []ProjectStatus{ProjectStatusDraft, ProjectStatusActive, ProjectStatusArchived}},
+		{from: ProjectStatusArchived, allowed: []ProjectStatus{ProjectStatusDraft, ProjectStatusArchived}},
+	}
+	for _, tt := range tests {
+		for _, to := range statuses {
+			want := false
+			for _, s := range tt.allowed {
+				want = want || s == to
+			}
+			if got := tt.from.CanTransitionTo(to); got != want {
+				t.Errorf("%q -> %q allowed = %v, want %v", tt.from, to, got, want)
+			}
+		}
+		if tt.from.CanTransitionTo("banana") {
+			t.Errorf("%q -> banana is allowed", tt.from)
+		}
+	}
+
+	for _, s := range statuses {
+		if !s.Valid() {
+			t.Errorf("%q is not valid", s)
+		}
+	}
+	for _, s := range []ProjectStatus{"", "banana", "Archived"} {
+		if s.Valid() {
+			t.Errorf("%q is valid", s)
+		}
+	}
+}
+
+func TestProjectListingFilters(t *testing.T) {
+	userID := uuid.NewString()
+	tests := []struct {
+		name   string
+		filter AdminProjectFilter
+		// want are fragments every listing statement must contain
+		want []string
+		// wantPage are fragments only the page statement contains
+		wantPage []string
+	}{
+		{
+			name:     "default listing hides archived projects",
+			filter:   AdminProjectFilter{},
+			want:     []string{`projects.status IS NULL OR projects.status <> 'archived'`},
+			wantPage: []string{"LIMIT 50"},
+		},
+		{
+			name:     "tag filter on a later page",
+			filter:   AdminProjectFilter{ProjectFilter: ProjectFilter{Tag: "support"}, Limit: 2, Offset: 2},
+			want:     []string{`projects.tags @> '["support"]'`, `projects.status <> 'archived'`},
+			wantPage: []string{"LIMIT 2 OFFSET 2"},
+		},
+		{
+			name:     "tag filter with a status",
+			filter:   AdminProjectFilter{ProjectFilter: ProjectFilter{Status: ProjectStatusArchived, Tag: "internal"}, Limit: 10},
+			want:     []string{`projects.tags @> '["internal"]'`, `projects.status = 'archived'`},
+			wantPage: []string{"LIMIT 10"},
+		},
+		{
+			name:     "owner filter with an oversized page",
+			filter:   AdminProjectFilter{ProjectFilter: ProjectFilter{Tag: "experiment"}, UserID: userID, Limit: 1000, Offset: -5},
+			want:     []string{`projects.tags @> '["experiment"]'`, "projects.user_id = '" + userID + "'"},
+			wantPage: []string{"LIMIT 50"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := repotest.PostgresDryRun(t)
+			if _, _, err := NewProject(db).ListForAdmin(tt.filter); err != nil {
+				t.Fatalf("ListForAdmin: %v", err)
+			}
+			if len(*statements) != 2 {
+				t.Fatalf("ran %d statements, want the count and the page: %q", len(*statements), *statements)
+			}
+			count, page := (*statements)[0], (*statements)[1]
+			for _, fragment := range tt.want {
+				if !strings.Contains(count, fragment) {
+					t.Errorf("count statement is missing %s:\n%s", fragment, count)
+				}
+				if !strings.Contains(page, fragment) {
+					t.Errorf("page statement is missing %s:\n%s", fragment, page)
+				}
+			}
+			for _, fragment := range tt.wantPage {
+				if !strings.Contains(page, fragment) {
+					t.Errorf("page statement is missing %s:\n%s", fragment, page)
+				}
+			}
+			if strings.Contains(count, "LIMIT") {
+				t.Errorf("count statement is paged:\n%s", count)
+			}
+			if tt.filter.Offset <= 0 && strings.Contains(page, "OFFSET") {
+				t.Errorf("first page has an offset:\n%s", page)
+			}
+		})
+	}
+}
+
+func TestAccessibleProjectsTagFilter(t *testing.T) {
+	db, statements := repotest.PostgresDryRun(t)
+	userID := uuid.NewString()
+	if _, err := NewProject(db).SummariesAccessibleByUserID(userID, ProjectFilter{Tag: "support"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*statements) != 1 {
+		t.Fatalf("ran %d statements, want 1: %q", len(*statements), *statements)
+	}
+	for _, fragment := range []string{`projects.tags @> '["support"]'`, "projects.user_id = '" + userID + "'", "projects.status <> 'archived'"} {
+		if !strings.Contains((*statements)[0], fragment) {
+			t.Errorf("statement is missing %s:\n%s", fragment, (*statements)[0])
+		}
+	}
+}
+
+func TestProjectSummaries(t *testing.T) {
+	db, statements := repotest.PostgresDryRun(t)
+	userID := uuid.NewString()
+	if _, err := NewProject(db).SummariesAccessibleByUserID(userID, ProjectFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*statements) != 1 {
+		t.Fatalf("ran %d statements, want 1: %q", len(*statements), *statements)
+	}
+	stmt := (*statements)[0]
+	if !strings.Contains(stmt, "jsonb_array_length(CASE WHEN jsonb_typeof(projects.nodes) = 'array' THEN projects.nodes END), 0) AS node_count") {
+		t.Errorf("node_count is not computed in SQL:\n%s", stmt)
+	}
+	// The blobs are only read by the database, never selected
+	selected := stmt[:strings.Index(stmt, " FROM ")]
+	for _, column := range []string{"projects.*", "projects.connections", "projects.nodes,", "projects.settings"} {
+		if strings.Contains(selected, column) {
+			t.Errorf("summary selects %s:\n%s", column, stmt)
+		}
+	}
+}
+
+func TestProjectSummaryPayload(t *testing.T) {
+	nodes := make([]string, 50)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf(`{"id":"node-%d","type":"ai-model","position":{"x":%d,"y":0},"data":{"modelName":"gpt-4o-mini","systemPrompt":%q}}`, i, i*200, strings.Repeat("Answer questions about the HR handbook. ", 20))
+	}
+	connections := make([]string, len(nodes)-1)
+	for i := range connections {
+		connections[i] = fmt.Sprintf(`{"id":"c%d","sourceNodeId":"node-%d","targetNodeId":"node-%d"}`, i, i, i+1)
+	}
+	project := Project{
+		ID:          uuid.New(),
+		UserID:      uuid.New(),
+		Name:        "HR assistant",
+		Description: "Answers leave and benefits questions",
+		Status:      ProjectStatusActive,
+		Tags:        []string{"hr", "internal"},
+		Nodes:       datatypes.JSON("[" + strings.Join(nodes, ",") + "]"),
+		Connections: datatypes.JSON("[" + strings.Join(connections, ",") + "]"),
+	}
+	summary := ProjectSummary{
+		ID:          project.ID,
+		Name:        project.Name,
+		Description: project.Description,
+		Status:      project.Status,
+		Tags:        project.Tags,
+		NodeCount:   len(nodes),
+	}
+
+	full, err := json.Marshal(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("a %d-node project lists as %d bytes, %d with ?include=graph", len(nodes), len(short), len(full))
+	if len(short)*20 > len(full) {
+		t.Errorf("summary is %d bytes, want under 5%% of the %d-byte project", len(short), len(full))
+	}
+}
+
+func TestProjectListOrder(t *testing.T) {
+	db := repotest.OpenDB(t, "primary", &Project{})
+	userID := uuid.New()
+	base := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(hours int) *time.Time {
+		ts := base.Add(time.Duration(hours) * time.Hour)
+		return &ts
+	}
+	// Each project was created at created hours past base and, unless
+	// updated is nil, last saved at updated hours past base
+	projects := []struct {
+		name    string
+		id      string
+		created int
+		updated *time.Time
+	}{
+		{name: "old, edited last", id: "00000000-0000-0000-0000-00000000000a", created: 0, updated: at(10)},
+		{name: "new, untouched", id: "00000000-0000-0000-0000-00000000000b", created: 8},
+		{name: "old, edited early", id: "00000000-0000-0000-0000-00000000000c", created: 1, updated: at(3)},
+		{name: "untouched, same time as an edit", id: "00000000-0000-0000-0000-00000000000d", created: 5},
+		{name: "edited, same time as a creation", id: "00000000-0000-0000-0000-00000000000e", created: 2, updated: at(5)},
+		{name: "oldest, untouched", id: "00000000-0000-0000-0000-00000000000f", created: -1},
+	}
+	for _, p := range projects {
+		row := &Project{ID: uuid.MustParse(p.id), UserID: userID, Name: p.name, Version: 1, CreatedAt: *at(p.created)}
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("create %s: %v", p.name, err)
+		}
+		// Creating sets updated_at, so untouched projects are cleared after
+		if err := db.Model(row).UpdateColumn("updated_at", p.updated).Error; err != nil {
+			t.Fatalf("set updated_at of %s: %v", p.name, err)
+		}
+	}
+	// Someone else's project is never listed
+	if err := db.Create(&Project{ID: uuid.New(), UserID: uuid.New(), Name: "foreign", Version: 1, CreatedAt: *at(20)}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewProject(db).GetByUserID(userID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range got {
+		names = append(names, p.Name)
+	}
+	want := []string{
+		"old, edited last",
+		"new, untouched",
+		"edited, same time as a creation", // ties are broken by id, highest first
+		"untouched, same time as an edit",
+		"old, edited early",
+		"oldest, untouched",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("GetByUserID order = %q, want %q", names, want)
+	}
+}
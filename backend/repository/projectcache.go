@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"bytes"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// projectCache keeps recently read projects by ID so repeated GetByID calls
+// for the same project skip the database. Every write through
+// ProjectRepository evicts the project; the TTL bounds how stale an entry can
+// get when another replica writes it.
+var (
+	projectCache     *expirable.LRU[string, Project]
+	projectCacheSize int
+	projectCacheOnce sync.Once
+	projectCacheHits atomic.Int64
+	projectCacheMiss atomic.Int64
+)
+
+// cachedProjects returns the project cache, sized from PROJECT_CACHE_SIZE
+// (default 200) and PROJECT_CACHE_TTL_SEC (default 30) on first use
+func cachedProjects() *expirable.LRU[string, Project] {
+	projectCacheOnce.Do(func() {
+		size := 200
+		if v, err := strconv.Atoi(os.Getenv("PROJECT_CACHE_SIZE")); err == nil && v > 0 {
+			size = v
+		}
+		ttl := 30 * time.Second
+		if v, err := strconv.Atoi(os.Getenv("PROJECT_CACHE_TTL_SEC")); err == nil && v > 0 {
+			ttl = time.Duration(v) * time.Second
+		}
+		projectCache, projectCacheSize = expirable.NewLRU[string, Project](size, nil, ttl), size
+	})
+	return projectCache
+}
+
+// ProjectCacheStats reports how well the project cache is doing
+type ProjectCacheStats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Size     int   `json:"size"`
+	Capacity int   `json:"capacity"`
+}
+
+// GetProjectCacheStats returns the hit and miss counts since startup and the
+// current number of cached projects
+func GetProjectCacheStats() ProjectCacheStats {
+	cache := cachedProjects()
+	return ProjectCacheStats{
+		Hits:     projectCacheHits.Load(),
+		Misses:   projectCacheMiss.Load(),
+		Size:     cache.Len(),
+		Capacity: projectCacheSize,
+	}
+}
+
+// cloneProject copies p so callers can modify the result without touching
+// the cached entry
+func cloneProject(p Project) *Project {
+	p.Nodes = bytes.Clone(p.Nodes)
+	p.Connections = bytes.Clone(p.Connections)
+	p.Tags = append(p.Tags[:0:0], p.Tags...)
+	p.Settings.Temperature = clonePtr(p.Settings.Temperature)
+	p.TenantID = clonePtr(p.TenantID)
+	p.TeamID = clonePtr(p.TeamID)
+	p.DefaultAPIKeyID = clonePtr(p.DefaultAPIKeyID)
+	p.LastOpened = clonePtr(p.LastOpened)
+	p.PublishedAt = clonePtr(p.PublishedAt)
+	p.PublishedVersion = clonePtr(p.PublishedVersion)
+	p.PublicSlug = clonePtr(p.PublicSlug)
+	p.TokenBudget = clonePtr(p.TokenBudget)
+	p.UpdatedAt = clonePtr(p.UpdatedAt)
+	return &p
+}
+
+// clonePtr returns a pointer to a copy of *v, or nil
+func clonePtr[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+// projectGenerations count the evictions of projects, striped by a hash of
+// their ID so the counters stay bounded. A read is only cached when its
+// project was not evicted while it ran, so a write that commits between the
+// read and filling the cache is not undone; a shared stripe only costs a
+// cache fill. projectGenerationMu also makes the check and the fill atomic
+// with respect to evictions.
+var (
+	projectGenerationMu sync.Mutex
+	projectGenerations  [256]uint64
+)
+
+// projectStripe returns the generation counter of a project ID
+func projectStripe(id string) *uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &projectGenerations[h.Sum32()%uint32(len(projectGenerations))]
+}
+
+// projectGeneration returns the eviction count of a project, to take before
+// reading it for cacheProject
+func projectGeneration(id string) uint64 {
+	projectGenerationMu.Lock()
+	defer projectGenerationMu.Unlock()
+	return *projectStripe(id)
+}
+
+// cacheProject caches p under id, read after its generation was gen, unless
+// the project was evicted since
+func cacheProject(id string, p Project, gen uint64) {
+	projectGenerationMu.Lock()
+	defer projectGenerationMu.Unlock()
+	if *projectStripe(id) == gen {
+		cachedProjects().Add(id, p)
+	}
+}
+
+// evictProject removes projects from the cache
+func evictProject(ids ...string) {
+	cache := cachedProjects()
+	projectGenerationMu.Lock()
+	defer projectGenerationMu.Unlock()
+	for _, id := range ids {
+		*projectStripe(id)++
+		cache.Remove(id)
+	}
+}
+
+// purgeProjectCache empties the cache, for writes that touch projects by
+// something other than their ID
+func purgeProjectCache() {
+	projectGenerationMu.Lock()
+	defer projectGenerationMu.Unlock()
+	for i := range projectGenerations {
+		projectGenerations[i]++
+	}
+	cachedProjects().Purge()
+}
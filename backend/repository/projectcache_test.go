@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"manju/backend/repository/repotest"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestCloneProjectSharesNoPointers(t *testing.T) {
+	id, temperature, version, slug, budget, now := uuid.New(), 0.7, 3, "bot", int64(1000), time.Now()
+	p := Project{
+		ID:               uuid.New(),
+		TenantID:         &id,
+		TeamID:           &id,
+		DefaultAPIKeyID:  &id,
+		Nodes:            []byte(`[]`),
+		Connections:      []byte(`[]`),
+		Tags:             []string{"a"},
+		Settings:         ProjectSettings{Temperature: &temperature},
+		LastOpened:       &now,
+		PublishedAt:      &now,
+		PublishedVersion: &version,
+		PublicSlug:       &slug,
+		TokenBudget:      &budget,
+		UpdatedAt:        &now,
+	}
+	clone := cloneProject(p)
+
+	if clone.Settings.Temperature == p.Settings.Temperature {
+		t.Error("Settings.Temperature is shared with the cached project")
+	}
+	orig, copied := reflect.ValueOf(p), reflect.ValueOf(*clone)
+	for i := 0; i < orig.NumField(); i++ {
+		field := orig.Type().Field(i)
+		if field.Type.Kind() != reflect.Pointer || orig.Field(i).IsNil() {
+			continue
+		}
+		if orig.Field(i).Pointer() == copied.Field(i).Pointer() {
+			t.Errorf("%s is shared with the cached project", field.Name)
+		}
+	}
+
+	*clone.Settings.Temperature = 0.1
+	clone.Tags[0] = "b"
+	if temperature != 0.7 || p.Tags[0] != "a" {
+		t.Error("changing the clone changed the cached project")
+	}
+}
+
+func TestProjectCacheTenantScope(t *testing.T) {
+	db := repotest.OpenDB(t, "primary", &Project{})
+	RegisterTenantCallbacks(db)
+	purgeProjectCache()
+	t.Cleanup(purgeProjectCache)
+
+	tenantA, tenantB := uuid.New(), uuid.New()
+	owned := Project{ID: uuid.New(), UserID: uuid.New(), TenantID: &tenantA, Name: "owned", Status: ProjectStatusDraft}
+	shared := Project{ID: uuid.New(), UserID: uuid.New(), Name: "shared", Status: ProjectStatusDraft}
+	for _, p := range []*Project{&owned, &shared} {
+		if err := db.Create(p).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first scope that may see a project reads it into the cache; the
+	// scopes after it must still only get it when they may see it
+	scopes := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"tenant A", WithTenant(context.Background(), tenantA)},
+		{"no tenant", WithTenant(context.Background(), uuid.Nil)},
+		{"tenant B", WithTenant(context.Background(), tenantB)},
+		{"unscoped", context.Background()},
+	}
+	tests := []struct {
+		project *Project
+		visible map[string]bool
+	}{
+		{&owned, map[string]bool{"tenant A": true, "unscoped": true}},
+		{&shared, map[string]bool{"no tenant": true, "unscoped": true}},
+	}
+	for _, tt := range tests {
+		for _, scope := range scopes {
+			p, err := NewProject(db).WithContext(scope.ctx).GetByID(tt.project.ID.String())
+			if got := err == nil && p != nil && p.ID == tt.project.ID; got != tt.visible[scope.name] {
+				t.Errorf("%s project read by %s: found %v, want %v", tt.project.Name, scope.name, got, tt.visible[scope.name])
+			}
+		}
+	}
+}
+
+func TestProjectCacheReadRacingWrite(t *testing.T) {
+	db := repotest.OpenDB(t, "primary", &Project{})
+	purgeProjectCache()
+	t.Cleanup(purgeProjectCache)
+	repo := NewProject(db)
+
+	project := Project{ID: uuid.New(), UserID: uuid.New(), Name: "racy", Status: ProjectStatusDraft}
+	if err := db.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	id := project.ID.String()
+
+	// Count tokens right after GetByID has read the row, before it fills the
+	// cache
+	var raced bool
+	err := db.Callback().Query().After("gorm:query").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "projects" {
+			return
+		}
+		raced = true
+		if err := repo.AddTokensUsed(id, 100); err != nil {
+			t.Errorf("add tokens: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The racing read returns the row from before the write...
+	p, err := repo.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !raced || p.TokensUsed != 0 {
+		t.Fatalf("racing read: raced %v, tokens used %d, want the row before the write", raced, p.TokensUsed)
+	}
+	// ...but doesn't cache it over the write
+	for i := 0; i < 2; i++ {
+		if p, err = repo.GetByID(id); err != nil {
+			t.Fatal(err)
+		}
+		if p.TokensUsed != 100 {
+			t.Fatalf("read %d after the write: tokens used %d, want 100", i+1, p.TokensUsed)
+		}
+	}
+	if stats := GetProjectCacheStats(); stats.Size != 1 {
+		t.Errorf("%d projects cached, want the fresh read", stats.Size)
+	}
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Publish marks the current version of a project as the published one that
+// public endpoints run, snapshotting the workflow if that version has no
+// snapshot yet. The public slug is assigned on first publish and then kept, so
+// republishing doesn't change the bot's URL. Publishing is not an edit and
+// doesn't bump the project version.
+func (r *ProjectRepository) Publish(id, slug string) (*Project, error) {
+	db, span := startSpan(r.db, "ProjectRepository.Publish")
+	defer span.End()
+
+	var p Project
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&p).Error; err != nil {
+			return err
+		}
+
+		// Only one version is published at a time; the previous one may be pruned again
+		if err := tx.Model(&ProjectVersion{}).Where("project_id = ? AND published", p.ID).Update("published", false).Error; err != nil {
+			return err
+		}
+		snapshot := ProjectVersion{
+			ProjectID:   p.ID,
+			Version:     p.Version,
+			Nodes:       p.Nodes,
+			Connections: p.Connections,
+			Published:   true,
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "project_id"}, {Name: "version"}},
+			DoUpdates: clause.AssignmentColumns([]string{"published"}),
+		}).Create(&snapshot).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		p.PublishedAt = &now
+		p.PublishedVersion = &p.Version
+		if p.PublicSlug == nil {
+			p.PublicSlug = &slug
+		}
+		return tx.Model(&p).UpdateColumns(map[string]interface{}{
+			"published_at":      p.PublishedAt,
+			"published_version": p.PublishedVersion,
+			"public_slug":       p.PublicSlug,
+		}).Error
+	})
+	evictProject(id)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Unpublish takes a project offline; its slug is kept for a later republish
+func (r *ProjectRepository) Unpublish(id string) (*Project, error) {
+	db, span := startSpan(r.db, "ProjectRepository.Unpublish")
+	defer span.End()
+
+	var p Project
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&p).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&ProjectVersion{}).Where("project_id = ? AND published", p.ID).Update("published", false).Error; err != nil {
+			return err
+		}
+		p.PublishedAt = nil
+		p.PublishedVersion = nil
+		return tx.Model(&p).UpdateColumns(map[string]interface{}{"published_at": nil, "published_version": nil}).Error
+	})
+	evictProject(id)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPublishedBySlug returns a published project and the snapshot it serves,
+// or nils when no published project has that slug
+func (r *ProjectRepository) GetPublishedBySlug(slug string) (*Project, *ProjectVersion, error) {
+	db, span := startSpan(r.db, "ProjectRepository.GetPublishedBySlug")
+	defer span.End()
+
+	var p Project
+	if err := db.Where("public_slug = ? AND published_at IS NOT NULL", slug).First(&p).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	var v ProjectVersion
+	if err := db.Where("project_id = ? AND published", p.ID).First(&v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	return &p, &v, nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"manju/backend/metrics"
+
+	"gorm.io/gorm"
+)
+
+// replica is a read-only connection with its last known health
+type replica struct {
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+var (
+	replicasMu  sync.RWMutex
+	replicas    []*replica
+	replicaNext uint32
+)
+
+// SetReplicas registers read-replica connections used by read-only repository
+// methods and starts a background health check for them.
+func SetReplicas(dbs []*gorm.DB) {
+	list := make([]*replica, 0, len(dbs))
+	for _, d := range dbs {
+		r := &replica{db: d}
+		r.healthy.Store(true)
+		list = append(list, r)
+	}
+
+	replicasMu.Lock()
+	replicas = list
+	replicasMu.Unlock()
+
+	if len(list) > 0 {
+		go checkReplicas(list, 15*time.Second)
+	}
+}
+
+// checkReplicas periodically pings every replica and records its health
+func checkReplicas(list []*replica, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for i, r := range list {
+			sqlDB, err := r.db.DB()
+			ok := err == nil && sqlDB.Ping() == nil
+			if r.healthy.Swap(ok) != ok {
+				log.Printf("[replica] replica %d healthy=%v", i, ok)
+			}
+		}
+	}
+}
+
+// primaryPinKey is the context key holding a request's primaryPin
+type primaryPinKey struct{}
+
+// primaryPin records whether a request has written to the primary
+type primaryPin struct {
+	written atomic.Bool
+}
+
+// WithPrimaryPin returns a context that tracks writes so that later reads in
+// the same request are served by the primary (read-your-writes).
+func WithPrimaryPin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryPinKey{}, &primaryPin{})
+}
+
+// isPinned reports whether the context has seen a write
+func isPinned(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	pin, ok := ctx.Value(primaryPinKey{}).(*primaryPin)
+	return ok && pin.written.Load()
+}
+
+// RegisterPrimaryPinCallbacks marks the request context as pinned after every
+// successful write executed through a context-aware repository.
+func RegisterPrimaryPinCallbacks(primary *gorm.DB) {
+	mark := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Context == nil {
+			return
+		}
+		if pin, ok := tx.Statement.Context.Value(primaryPinKey{}).(*primaryPin); ok {
+			pin.written.Store(true)
+		}
+	}
+	primary.Callback().Create().After("gorm:create").Register("replica:pin_create", mark)
+	primary.Callback().Update().After("gorm:update").Register("replica:pin_update", mark)
+	primary.Callback().Delete().After("gorm:delete").Register("replica:pin_delete", mark)
+}
+
+// readDB picks the connection for a read-only query: a healthy replica when
+// one is configured and the request has not written yet, otherwise primary.
+func readDB(primary *gorm.DB) *gorm.DB {
+	replicasMu.RLock()
+	list := replicas
+	replicasMu.RUnlock()
+	if len(list) == 0 {
+		return primary
+	}
+
+	ctx := primary.Statement.Context
+	if isPinned(ctx) {
+		metrics.Inc("db_replica_pinned_reads")
+		return primary
+	}
+
+	start := atomic.AddUint32(&replicaNext, 1)
+	for i := 0; i < len(list); i++ {
+		r := list[(int(start)+i)%len(list)]
+		if r.healthy.Load() {
+			metrics.Inc("db_replica_reads")
+			if ctx != nil {
+				return r.db.WithContext(ctx)
+			}
+			return r.db
+		}
+	}
+
+	log.Printf("[replica] WARN no healthy replica available, falling back to primary")
+	metrics.Inc("db_replica_fallbacks")
+	return primary
+}
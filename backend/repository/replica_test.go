@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"manju/backend/repository/repotest"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// labels returns the labels of keys in the order they were listed
+func labels(keys []UserAPIKey) []string {
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = k.Label
+	}
+	return out
+}
+
+func TestReplicaRouting(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name string
+		// healthy is the replica's health; nil configures no replica
+		healthy *bool
+		// write creates a key through the request context before the read
+		write bool
+		want  []string
+	}{
+		{name: "no replica reads from the primary", want: []string{"primary"}},
+		{name: "read-only query goes to the replica", healthy: ptr(true), want: []string{"replica"}},
+		{name: "read after a write is pinned to the primary", healthy: ptr(true), write: true, want: []string{"written", "primary"}},
+		{name: "unhealthy replica falls back to the primary", healthy: ptr(false), want: []string{"primary"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := repotest.OpenDB(t, "primary", &UserAPIKey{})
+			replicaDB := repotest.OpenDB(t, "replica", &UserAPIKey{})
+			RegisterPrimaryPinCallbacks(primary)
+
+			seed := func(db *gorm.DB, label string) {
+				key := UserAPIKey{UserID: userID, Label: label, EncryptedKey: "x"}
+				if err := db.Create(&key).Error; err != nil {
+					t.Fatalf("seed %s: %v", label, err)
+				}
+			}
+			seed(primary, "primary")
+			seed(replicaDB, "replica")
+
+			t.Cleanup(func() { SetReplicas(nil) })
+			if tt.healthy != nil {
+				SetReplicas([]*gorm.DB{replicaDB})
+				replicas[0].healthy.Store(*tt.healthy)
+			}
+
+			ctx := WithPrimaryPin(context.Background())
+			repo := NewUserAPIKeyRepository(primary).WithContext(ctx)
+			if tt.write {
+				if _, err := repo.Create(&UserAPIKey{UserID: userID, Label: "written", EncryptedKey: "x"}); err != nil {
+					t.Fatalf("create: %v", err)
+				}
+			}
+
+			keys, err := repo.ListByUserID(userID.String())
+			if err != nil {
+				t.Fatalf("ListByUserID: %v", err)
+			}
+			got := labels(keys)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ListByUserID read %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("ListByUserID read %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplicaPinIsPerRequest(t *testing.T) {
+	userID := uuid.New()
+	primary := repotest.OpenDB(t, "primary", &UserAPIKey{})
+	replicaDB := repotest.OpenDB(t, "replica", &UserAPIKey{})
+	RegisterPrimaryPinCallbacks(primary)
+	t.Cleanup(func() { SetReplicas(nil) })
+	SetReplicas([]*gorm.DB{replicaDB})
+
+	written := NewUserAPIKeyRepository(primary).WithContext(WithPrimaryPin(context.Background()))
+	key, err := written.Create(&UserAPIKey{UserID: userID, Label: "written", EncryptedKey: "x"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	// Another request hasn't written, so it still reads from the replica
+	other := NewUserAPIKeyRepository(primary).WithContext(WithPrimaryPin(context.Background()))
+	keys, err := other.ListByUserID(userID.String())
+	if err != nil {
+		t.Fatalf("ListByUserID: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("other request read %v, want the empty replica", labels(keys))
+	}
+
+	// Lookups that aren't read-only methods always use the primary
+	if _, err := other.GetByID(key.ID.String()); err != nil {
+		t.Fatalf("GetByID: %v, want the key from the primary", err)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
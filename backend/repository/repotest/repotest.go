@@ -0,0 +1,133 @@
+// Package repotest opens SQLite databases that stand in for Postgres in
+// tests of the repositories and of the services built on them, and Postgres
+// dry runs for the queries SQLite can't run.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// OpenDB opens a SQLite file standing in for a Postgres connection, with a
+// table for each of models. The models' Postgres defaults and column types
+// don't apply, so the tables are created from their fields, primary keys and
+// unique indexes alone.
+func OpenDB(t testing.TB, name string, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name+".db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	for _, model := range models {
+		if err := createTable(db, model); err != nil {
+			t.Fatalf("create table in %s: %v", name, err)
+		}
+	}
+	return db
+}
+
+// createTable creates the table of model with a SQLite column per field
+func createTable(db *gorm.DB, model interface{}) error {
+	s, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		return err
+	}
+	var columns, primaryKey []string
+	for _, dbName := range s.DBNames {
+		field := s.FieldsByDBName[dbName]
+		column := dbName + " " + sqliteType(field.FieldType)
+		if field.Unique {
+			column += " UNIQUE"
+		}
+		columns = append(columns, column)
+		if field.PrimaryKey {
+			primaryKey = append(primaryKey, dbName)
+		}
+	}
+	if len(primaryKey) > 0 {
+		columns = append(columns, "PRIMARY KEY ("+strings.Join(primaryKey, ", ")+")")
+	}
+	if err := db.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", s.Table, strings.Join(columns, ", "))).Error; err != nil {
+		return err
+	}
+
+	// Unique indexes back the ON CONFLICT clauses of upserts
+	for _, idx := range s.ParseIndexes() {
+		if idx.Class != "UNIQUE" {
+			continue
+		}
+		var fields []string
+		for _, f := range idx.Fields {
+			fields = append(fields, f.DBName)
+		}
+		stmt := fmt.Sprintf("CREATE UNIQUE INDEX %s_%s ON %s (%s)", s.Table, idx.Name, s.Table, strings.Join(fields, ", "))
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteType is the column type SQLite converts a field's values back from
+func sqliteType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return "DATETIME"
+	case t.Kind() == reflect.Bool:
+		return "BOOLEAN"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return "INTEGER"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+// PostgresDryRun returns a Postgres connection that only builds statements,
+// for queries SQLite can't run. Each statement is added to the returned
+// slice with its arguments inlined.
+func PostgresDryRun(t testing.TB) (*gorm.DB, *[]string) {
+	t.Helper()
+	statements := &[]string{}
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=dry-run"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               statementLogger{statements},
+	})
+	if err != nil {
+		t.Fatalf("open dry run: %v", err)
+	}
+	return db, statements
+}
+
+// statementLogger records the statements of a dry run
+type statementLogger struct {
+	statements *[]string
+}
+
+func (l statementLogger) LogMode(logger.LogLevel) logger.Interface      { return l }
+func (l statementLogger) Info(context.Context, string, ...interface{})  {}
+func (l statementLogger) Warn(context.Context, string, ...interface{})  {}
+func (l statementLogger) Error(context.Context, string, ...interface{}) {}
+
+func (l statementLogger) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	*l.statements = append(*l.statements, sql)
+}
@@ -0,0 +1,20 @@
+package repository
+
+import "context"
+
+// requestIDKey is the context key holding the ID of the request a query runs for
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose queries are logged with requestID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID bound to ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
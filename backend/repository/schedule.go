@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Schedule runs a project's workflow periodically according to a cron expression
+type Schedule struct {
+	ID             uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"project_id"`
+	CronExpression string     `gorm:"not null" json:"cron_expression"`
+	Enabled        bool       `gorm:"default:true" json:"enabled"`
+	InputMessage   string     `gorm:"type:text" json:"input_message"`
+	LastRunAt      *time.Time `json:"last_run_at"`
+	NextRunAt      *time.Time `gorm:"index" json:"next_run_at"`
+	CreatedAt      time.Time  `gorm:"default:now()" json:"created_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (s *Schedule) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// ScheduleRepository handles schedule database operations
+type ScheduleRepository struct {
+	db *gorm.DB
+}
+
+// NewSchedule creates a new ScheduleRepository
+func NewSchedule(db *gorm.DB) *ScheduleRepository {
+	return &ScheduleRepository{db}
+}
+
+// Create stores a schedule
+func (r *ScheduleRepository) Create(s *Schedule) (*Schedule, error) {
+	if err := r.db.Create(s).Error; err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ListByProject returns all schedules of a project
+func (r *ScheduleRepository) ListByProject(projectID string) ([]Schedule, error) {
+	var schedules []Schedule
+	if err := r.db.Where("project_id = ?", projectID).Order("created_at ASC").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// GetByID retrieves a schedule of a project
+func (r *ScheduleRepository) GetByID(projectID, id string) (*Schedule, error) {
+	var s Schedule
+	if err := r.db.Where("project_id = ? AND id = ?", projectID, id).First(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Update saves a schedule
+func (r *ScheduleRepository) Update(s *Schedule) (*Schedule, error) {
+	if err := r.db.Save(s).Error; err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Delete removes a schedule of a project
+func (r *ScheduleRepository) Delete(projectID, id string) error {
+	return r.db.Delete(&Schedule{}, "project_id = ? AND id = ?", projectID, id).Error
+}
+
+// ListDue returns enabled schedules whose next run is at or before now
+func (r *ScheduleRepository) ListDue(now time.Time) ([]Schedule, error) {
+	var schedules []Schedule
+	if err := r.db.Where("enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now).Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// Claim advances a due schedule to its next run. It only succeeds if the
+// schedule has not been advanced by someone else since it was loaded, so
+// several backend instances never run the same occurrence twice.
+func (r *ScheduleRepository) Claim(s *Schedule, ranAt, next time.Time) (bool, error) {
+	res := r.db.Model(&Schedule{}).
+		Where("id = ? AND next_run_at = ?", s.ID, s.NextRunAt).
+		Updates(map[string]interface{}{"last_run_at": ranAt, "next_run_at": next})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+	s.LastRunAt = &ranAt
+	s.NextRunAt = &next
+	return true, nil
+}
@@ -7,13 +7,19 @@ import (
 	"gorm.io/gorm"
 )
 
-// Session model stores server-side session and refresh token
+// Session model stores server-side session and refresh token.
+// RefreshToken holds the AES-GCM encrypted token; EncryptionKeyVersion records
+// which key encrypted it (0 means a legacy plaintext value).
 type Session struct {
-	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	UserID       uuid.UUID  `gorm:"type:uuid;not null" json:"user_id"`
-	RefreshToken string     `gorm:"type:text" json:"refresh_token"`
-	ExpiresAt    *time.Time `json:"expires_at"`
-	CreatedAt    time.Time  `gorm:"default:now()" json:"created_at"`
+	ID                   uuid.UUID    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID               uuid.UUID    `gorm:"type:uuid;not null" json:"user_id"`
+	RefreshToken         string       `gorm:"type:text" json:"-"` // Encrypted, never exposed
+	EncryptionKeyVersion int          `gorm:"not null;default:0" json:"-"`
+	Provider             AuthProvider `gorm:"not null;default:'google'" json:"provider"`
+	UserAgent            string       `gorm:"type:text" json:"-"`
+	TenantID             *uuid.UUID   `gorm:"type:uuid" json:"-"` // copied from the user at login
+	ExpiresAt            *time.Time   `json:"expires_at"`
+	CreatedAt            time.Time    `gorm:"default:now()" json:"created_at"`
 }
 
 type SessionRepository struct {
@@ -42,3 +48,22 @@ func (r *SessionRepository) GetByID(id string) (*Session, error) {
 func (r *SessionRepository) DeleteByID(id string) error {
 	return r.db.Delete(&Session{}, "id = ?", id).Error
 }
+
+// ListByUserID returns every session of a user, newest first
+func (r *SessionRepository) ListByUserID(userID string) ([]Session, error) {
+	var sessions []Session
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// FindStaleKeyVersion calls fn with batches of sessions holding a refresh token
+// that was not encrypted with keyVersion
+func (r *SessionRepository) FindStaleKeyVersion(keyVersion, batchSize int, fn func([]Session) error) error {
+	var batch []Session
+	return r.db.Where("encryption_key_version <> ? AND refresh_token IS NOT NULL AND refresh_token <> ''", keyVersion).
+		FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+			return fn(batch)
+		}).Error
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// SessionStore looks up sessions on every authenticated request
+type SessionStore interface {
+	Set(s *Session) error
+	Get(id string) (*Session, error)
+	Delete(id string) error
+}
+
+// sessionStore is the store selected by SESSION_STORE
+var sessionStore SessionStore
+
+// SetSessionStore sets the session store used by Sessions
+func SetSessionStore(store SessionStore) {
+	sessionStore = store
+}
+
+// Sessions returns the configured session store
+func Sessions() SessionStore {
+	if sessionStore == nil {
+		return NewPostgresSessionStore(db)
+	}
+	return sessionStore
+}
+
+// NewSessionStoreFromEnv returns the store selected by SESSION_STORE
+// (postgres, the default, or redis)
+func NewSessionStoreFromEnv(db *gorm.DB) SessionStore {
+	pg := NewPostgresSessionStore(db)
+	if strings.ToLower(strings.TrimSpace(os.Getenv("SESSION_STORE"))) != "redis" {
+		return pg
+	}
+
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		redisURL = "redis://localhost:6379/0"
+	}
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		log.Printf("[sessions] invalid REDIS_URL, falling back to postgres: %v", err)
+		return pg
+	}
+	log.Printf("[sessions] using redis session store at %s", opts.Addr)
+	return NewRedisSessionStore(redis.NewClient(opts), pg)
+}
+
+// PostgresSessionStore keeps sessions in the sessions table
+type PostgresSessionStore struct {
+	repo *SessionRepository
+}
+
+// NewPostgresSessionStore creates a PostgresSessionStore
+func NewPostgresSessionStore(db *gorm.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{NewSession(db)}
+}
+
+// Set creates or replaces a session
+func (s *PostgresSessionStore) Set(sess *Session) error {
+	if sess.ID == uuid.Nil {
+		_, err := s.repo.Create(sess)
+		return err
+	}
+	return s.repo.db.Save(sess).Error
+}
+
+// Get returns a session by ID
+func (s *PostgresSessionStore) Get(id string) (*Session, error) {
+	return s.repo.GetByID(id)
+}
+
+// Delete removes a session
+func (s *PostgresSessionStore) Delete(id string) error {
+	return s.repo.DeleteByID(id)
+}
+
+// defaultSessionTTL is used for sessions without an expiry, matching the session cookie
+const defaultSessionTTL = 7 * 24 * time.Hour
+
+// RedisSessionStore caches sessions in Redis in front of PostgreSQL. Writes go
+// to both, so sessions created before the switch (or evicted from Redis) are
+// still found in PostgreSQL and copied back into Redis on first use.
+type RedisSessionStore struct {
+	client   *redis.Client
+	fallback *PostgresSessionStore
+}
+
+// NewRedisSessionStore creates a RedisSessionStore backed by fallback
+func NewRedisSessionStore(client *redis.Client, fallback *PostgresSessionStore) *RedisSessionStore {
+	return &RedisSessionStore{client: client, fallback: fallback}
+}
+
+// redisSession is the JSON stored in Redis. Session hides the refresh token
+// from API responses, so it needs its own encoding here.
+type redisSession struct {
+	ID                   uuid.UUID    `json:"id"`
+	UserID               uuid.UUID    `json:"user_id"`
+	RefreshToken         string       `json:"refresh_token"`
+	EncryptionKeyVersion int          `json:"encryption_key_version"`
+	Provider             AuthProvider `json:"provider"`
+	UserAgent            string       `json:"user_agent"`
+	TenantID             *uuid.UUID   `json:"tenant_id"`
+	ExpiresAt            *time.Time   `json:"expires_at"`
+	CreatedAt            time.Time    `json:"created_at"`
+}
+
+func redisSessionKey(id string) string {
+	return "manju:session:" + id
+}
+
+// cache writes a session to Redis with a TTL matching its expiry
+func (s *RedisSessionStore) cache(sess *Session) error {
+	ttl := defaultSessionTTL
+	if sess.ExpiresAt != nil {
+		if until := time.Until(*sess.ExpiresAt); until > 0 {
+			ttl = until
+		}
+	}
+	data, err := json.Marshal(redisSession(*sess))
+	if err != nil {
+		return err
+	}
+	return s.client.SetEx(context.Background(), redisSessionKey(sess.ID.String()), data, ttl).Err()
+}
+
+// Set stores a session in PostgreSQL and Redis
+func (s *RedisSessionStore) Set(sess *Session) error {
+	if err := s.fallback.Set(sess); err != nil {
+		return err
+	}
+	if err := s.cache(sess); err != nil {
+		log.Printf("[sessions] failed to cache session %s in redis: %v", sess.ID, err)
+	}
+	return nil
+}
+
+// Get reads a session from Redis, falling back to PostgreSQL on a miss
+func (s *RedisSessionStore) Get(id string) (*Session, error) {
+	data, err := s.client.Get(context.Background(), redisSessionKey(id)).Bytes()
+	if err == nil {
+		var rs redisSession
+		if err := json.Unmarshal(data, &rs); err == nil {
+			sess := Session(rs)
+			return &sess, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("[sessions] redis get failed, using postgres: %v", err)
+	}
+
+	sess, err := s.fallback.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache(sess); err != nil {
+		log.Printf("[sessions] failed to cache session %s in redis: %v", sess.ID, err)
+	}
+	return sess, nil
+}
+
+// Delete removes a session from PostgreSQL, then evicts it from Redis. A
+// failed eviction is only logged: the session is already gone from the
+// source of truth and its cached copy expires with its TTL.
+func (s *RedisSessionStore) Delete(id string) error {
+	if err := s.fallback.Delete(id); err != nil {
+		return err
+	}
+	if err := s.client.Del(context.Background(), redisSessionKey(id)).Err(); err != nil {
+		log.Printf("[sessions] failed to evict session %s from redis: %v", id, err)
+	}
+	return nil
+}
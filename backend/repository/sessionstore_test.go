@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"manju/backend/repository/repotest"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisSessionStoreDeleteWithoutRedis(t *testing.T) {
+	db := repotest.OpenDB(t, "manju", &Session{})
+	// Nothing listens on port 1, so every Redis command fails
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: time.Second})
+	t.Cleanup(func() { client.Close() })
+	store := NewRedisSessionStore(client, NewPostgresSessionStore(db))
+
+	sess := &Session{ID: uuid.New(), UserID: uuid.New(), RefreshToken: "refresh"}
+	if err := store.Set(sess); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSession(db).GetByID(sess.ID.String()); err != nil {
+		t.Fatalf("session not stored in postgres: %v", err)
+	}
+	if err := store.Delete(sess.ID.String()); err != nil {
+		t.Fatalf("Delete with redis down: %v", err)
+	}
+	if got, err := NewSession(db).GetByID(sess.ID.String()); got != nil {
+		t.Errorf("session %s still in postgres after Delete (%v)", got.ID, err)
+	}
+}
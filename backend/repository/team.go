@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TeamRole is the access level a user has in a team, and through it on the
+// team's projects
+type TeamRole string
+
+const (
+	TeamOwner  TeamRole = "owner"  // manages the team and its members
+	TeamEditor TeamRole = "editor" // can update the team's projects
+	TeamViewer TeamRole = "viewer" // can view the team's projects
+)
+
+// Valid reports whether r is a known team role
+func (r TeamRole) Valid() bool {
+	return r == TeamOwner || r == TeamEditor || r == TeamViewer
+}
+
+// Team is a group of users sharing projects. Projects with a TeamID are
+// accessible to every member of the team according to their role.
+type Team struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name      string     `gorm:"not null" json:"name"`
+	CreatedBy uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	TenantID  *uuid.UUID `gorm:"type:uuid;index" json:"tenant_id,omitempty"`
+	CreatedAt time.Time  `gorm:"default:now()" json:"created_at"`
+	// Role is the requesting user's role, filled in by ListByUser
+	Role TeamRole `gorm:"->;-:migration" json:"role,omitempty"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (t *Team) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// TeamMember is a user's membership of a team
+type TeamMember struct {
+	TeamID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"team_id"`
+	UserID   uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	Role     TeamRole  `gorm:"not null;default:'viewer'" json:"role"`
+	JoinedAt time.Time `gorm:"default:now()" json:"joined_at"`
+	// Email and Name of the user, filled in by ListMembers
+	Email string `gorm:"->;-:migration" json:"email,omitempty"`
+	Name  string `gorm:"->;-:migration" json:"name,omitempty"`
+}
+
+// BeforeCreate hook to ensure the join time
+func (m *TeamMember) BeforeCreate(tx *gorm.DB) (err error) {
+	if m.JoinedAt.IsZero() {
+		m.JoinedAt = time.Now()
+	}
+	return nil
+}
+
+// ErrAlreadyTeamMember is returned when adding a user who is already in the team
+var ErrAlreadyTeamMember = errors.New("already_team_member")
+
+// TeamRepository handles team and team member database operations
+type TeamRepository struct {
+	db *gorm.DB
+}
+
+// NewTeam creates a new TeamRepository
+func NewTeam(db *gorm.DB) *TeamRepository {
+	return &TeamRepository{db}
+}
+
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *TeamRepository) WithContext(ctx context.Context) *TeamRepository {
+	return &TeamRepository{r.db.WithContext(ctx)}
+}
+
+// Create creates a team with its creator as owner
+func (r *TeamRepository) Create(t *Team) (*Team, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		return tx.Create(&TeamMember{TeamID: t.ID, UserID: t.CreatedBy, Role: TeamOwner}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.Role = TeamOwner
+	return t, nil
+}
+
+// ListByUser returns the teams userID belongs to, with the user's role
+func (r *TeamRepository) ListByUser(userID string) ([]Team, error) {
+	var teams []Team
+	err := readDB(r.db).Model(&Team{}).
+		Select("teams.*, team_members.role AS role").
+		Joins("JOIN team_members ON team_members.team_id = teams.id AND team_members.user_id = ?", userID).
+		Order("teams.name ASC").Find(&teams).Error
+	if err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+// GetByID retrieves a team by ID, returning nil if it does not exist
+func (r *TeamRepository) GetByID(id string) (*Team, error) {
+	var t Team
+	if err := r.db.Where("id = ?", id).First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Rename changes a team's name
+func (r *TeamRepository) Rename(t *Team, name string) error {
+	t.Name = name
+	return r.db.Model(t).Update("name", name).Error
+}
+
+// Delete removes a team and its memberships. Its projects stay with their
+// owners and are no longer shared.
+func (r *TeamRepository) Delete(id string) error {
+	defer purgeProjectCache()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Project{}).Where("team_id = ?", id).Update("team_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&TeamMember{}, "team_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Team{}, "id = ?", id).Error
+	})
+}
+
+// MemberRole returns the role userID holds in a team, or an empty role when
+// the user is not a member
+func (r *TeamRepository) MemberRole(teamID, userID string) (TeamRole, error) {
+	var m TeamMember
+	if err := r.db.Where("team_id = ? AND user_id = ?", teamID, userID).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return m.Role, nil
+}
+
+// ListMembers returns the members of a team with their email and name
+func (r *TeamRepository) ListMembers(teamID string) ([]TeamMember, error) {
+	var members []TeamMember
+	err := readDB(r.db).Model(&TeamMember{}).
+		Select("team_members.*, users.email AS email, users.name AS name").
+		Joins("JOIN users ON users.id = team_members.user_id").
+		Where("team_members.team_id = ?", teamID).
+		Order("team_members.joined_at ASC").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// AddMember adds a user to a team
+func (r *TeamRepository) AddMember(m *TeamMember) (*TeamMember, error) {
+	res := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrAlreadyTeamMember
+	}
+	return m, nil
+}
+
+// UpdateMemberRole changes a member's role
+func (r *TeamRepository) UpdateMemberRole(teamID, userID string, role TeamRole) error {
+	return r.db.Model(&TeamMember{}).Where("team_id = ? AND user_id = ?", teamID, userID).Update("role", role).Error
+}
+
+// RemoveMember removes a user from a team
+func (r *TeamRepository) RemoveMember(teamID, userID string) error {
+	return r.db.Delete(&TeamMember{}, "team_id = ? AND user_id = ?", teamID, userID).Error
+}
+
+// CountOwners returns the number of owners of a team
+func (r *TeamRepository) CountOwners(teamID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&TeamMember{}).Where("team_id = ? AND role = ?", teamID, TeamOwner).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ProjectTemplate is a reusable starting workflow
+type ProjectTemplate struct {
+	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name        string         `gorm:"not null" json:"name"`
+	Description string         `json:"description"`
+	Category    string         `gorm:"index" json:"category"`
+	Nodes       datatypes.JSON `gorm:"type:jsonb" json:"nodes"`
+	Connections datatypes.JSON `gorm:"type:jsonb" json:"connections"`
+	IsBuiltin   bool           `gorm:"default:false" json:"is_builtin"`
+	CreatedBy   *uuid.UUID     `gorm:"type:uuid" json:"created_by,omitempty"`
+	CreatedAt   time.Time      `gorm:"default:now()" json:"created_at"`
+	UpdatedAt   *time.Time     `json:"updated_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (t *ProjectTemplate) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// ProjectTemplateRepository handles project template database operations
+type ProjectTemplateRepository struct {
+	db *gorm.DB
+}
+
+// NewProjectTemplate creates a new ProjectTemplateRepository
+func NewProjectTemplate(db *gorm.DB) *ProjectTemplateRepository {
+	return &ProjectTemplateRepository{db}
+}
+
+// Create creates a new template
+func (r *ProjectTemplateRepository) Create(t *ProjectTemplate) (*ProjectTemplate, error) {
+	if err := r.db.Create(t).Error; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// List returns all templates, optionally filtered by category
+func (r *ProjectTemplateRepository) List(category string) ([]ProjectTemplate, error) {
+	var templates []ProjectTemplate
+	q := readDB(r.db)
+	if category != "" {
+		q = q.Where("category = ?", category)
+	}
+	if err := q.Order("is_builtin DESC, name ASC").Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// GetByID retrieves a template by ID
+func (r *ProjectTemplateRepository) GetByID(id string) (*ProjectTemplate, error) {
+	var t ProjectTemplate
+	if err := r.db.Where("id = ?", id).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UpsertBuiltin creates or refreshes a built-in template identified by its name
+func (r *ProjectTemplateRepository) UpsertBuiltin(t *ProjectTemplate) error {
+	var existing ProjectTemplate
+	err := r.db.Where("is_builtin = ? AND name = ?", true, t.Name).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		t.IsBuiltin = true
+		return r.db.Create(t).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return r.db.Model(&existing).Updates(map[string]interface{}{
+		"description": t.Description,
+		"category":    t.Category,
+		"nodes":       t.Nodes,
+		"connections": t.Connections,
+		"updated_at":  now,
+	}).Error
+}
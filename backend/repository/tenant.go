@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tenant is an isolated customer of a SaaS deployment. Users, projects and
+// voices belong to at most one tenant; rows without a tenant are only visible
+// to requests that carry no tenant (single-tenant deployments).
+type Tenant struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name      string    `gorm:"not null" json:"name"`
+	Slug      string    `gorm:"uniqueIndex;not null" json:"slug"`
+	Domain    *string   `gorm:"uniqueIndex" json:"domain,omitempty"` // custom domain, matched against Host
+	Plan      string    `gorm:"not null;default:'free'" json:"plan"`
+	CreatedAt time.Time `gorm:"default:now()" json:"created_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (t *Tenant) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// ErrTenantSlugTaken is returned when creating a tenant whose slug or domain is in use
+var ErrTenantSlugTaken = errors.New("tenant_slug_taken")
+
+// TenantRepository handles tenant database operations
+type TenantRepository struct {
+	db *gorm.DB
+}
+
+// NewTenant creates a new TenantRepository
+func NewTenant(db *gorm.DB) *TenantRepository {
+	return &TenantRepository{db}
+}
+
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *TenantRepository) WithContext(ctx context.Context) *TenantRepository {
+	return &TenantRepository{r.db.WithContext(ctx)}
+}
+
+// Create creates a new tenant
+func (r *TenantRepository) Create(t *Tenant) (*Tenant, error) {
+	var count int64
+	q := r.db.Model(&Tenant{}).Where("slug = ?", t.Slug)
+	if t.Domain != nil {
+		q = q.Or("domain = ?", *t.Domain)
+	}
+	if err := q.Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrTenantSlugTaken
+	}
+	if err := r.db.Create(t).Error; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// List returns every tenant ordered by name
+func (r *TenantRepository) List() ([]Tenant, error) {
+	var tenants []Tenant
+	if err := readDB(r.db).Order("name ASC").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// GetByID retrieves a tenant by ID, returning nil if it does not exist
+func (r *TenantRepository) GetByID(id string) (*Tenant, error) {
+	var t Tenant
+	if err := r.db.Where("id = ?", id).First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetByHost finds the tenant serving host, either by custom domain or, when
+// host is "<slug>.<baseDomain>", by slug. It returns nil if no tenant
+// matches. Without a baseDomain only custom domains are matched.
+func (r *TenantRepository) GetByHost(host, baseDomain string) (*Tenant, error) {
+	host = strings.ToLower(host)
+	q := r.db.Where("domain = ?", host)
+	if slug, ok := tenantSubdomain(host, baseDomain); ok {
+		q = q.Or("slug = ?", slug)
+	}
+
+	var t Tenant
+	err := q.Order(clause.OrderBy{Expression: clause.Expr{SQL: "domain = ? DESC", Vars: []interface{}{host}}}).
+		First(&t).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// tenantSubdomain returns the slug of host when it is a single label below
+// baseDomain
+func tenantSubdomain(host, baseDomain string) (string, bool) {
+	if baseDomain == "" {
+		return "", false
+	}
+	slug, ok := strings.CutSuffix(host, "."+baseDomain)
+	if !ok || slug == "" || strings.Contains(slug, ".") {
+		return "", false
+	}
+	return slug, true
+}
+
+// tenantKey is the context key holding the current request's tenant
+type tenantKey struct{}
+
+// WithTenant returns a context whose queries are limited to tenantID, or
+// with uuid.Nil to the rows that belong to no tenant
+func WithTenant(ctx context.Context, tenantID uuid.UUID) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant bound to ctx, if any
+func TenantFromContext(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := tenantScopeFromContext(ctx)
+	return id, ok && id != uuid.Nil
+}
+
+// tenantScopeFromContext returns the tenant ctx is limited to, uuid.Nil for
+// no tenant, and false when ctx isn't limited at all (background jobs)
+func tenantScopeFromContext(ctx context.Context) (uuid.UUID, bool) {
+	if ctx == nil {
+		return uuid.Nil, false
+	}
+	id, ok := ctx.Value(tenantKey{}).(uuid.UUID)
+	return id, ok
+}
+
+// TenantScope limits a query on a tenant-owned table to tenantID, or with
+// uuid.Nil to the rows without a tenant
+func TenantScope(tenantID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		column := clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}
+		if tenantID == uuid.Nil {
+			return db.Where(clause.Eq{Column: column, Value: nil})
+		}
+		return db.Where(clause.Eq{Column: column, Value: tenantID})
+	}
+}
+
+// RegisterTenantCallbacks applies TenantScope to every query, update and
+// delete on a model with a tenant_id column whose context is limited by
+// WithTenant, and stamps the tenant on created rows. Repositories must be
+// bound to the request context with WithContext for the scope to apply;
+// queries without one (background jobs) see every tenant.
+func RegisterTenantCallbacks(conn *gorm.DB) {
+	scope := func(tx *gorm.DB) {
+		tenantID, ok := tenantScopeFromContext(tx.Statement.Context)
+		if !ok || tx.Statement.Schema == nil || tx.Statement.Schema.LookUpField("tenant_id") == nil {
+			return
+		}
+		TenantScope(tenantID)(tx)
+	}
+	assign := func(tx *gorm.DB) {
+		tenantID, ok := TenantFromContext(tx.Statement.Context)
+		if !ok || tx.Statement.Schema == nil {
+			return
+		}
+		field := tx.Statement.Schema.LookUpField("tenant_id")
+		if field == nil {
+			return
+		}
+		set := func(rv reflect.Value) {
+			if _, zero := field.ValueOf(tx.Statement.Context, rv); zero {
+				id := tenantID
+				_ = field.Set(tx.Statement.Context, rv, &id)
+			}
+		}
+		rv := tx.Statement.ReflectValue
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				set(reflect.Indirect(rv.Index(i)))
+			}
+		case reflect.Struct:
+			set(rv)
+		}
+	}
+	conn.Callback().Query().Before("gorm:query").Register("tenant:query", scope)
+	conn.Callback().Update().Before("gorm:update").Register("tenant:update", scope)
+	conn.Callback().Delete().Before("gorm:delete").Register("tenant:delete", scope)
+	conn.Callback().Create().Before("gorm:create").Register("tenant:create", assign)
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"errors"
+	"manju/backend/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// startSpan begins a span for a repository method as a child of the context
+// bound to db, and returns a db carrying the span so queries stay linked to it.
+func startSpan(db *gorm.DB, name string) (*gorm.DB, trace.Span) {
+	ctx, span := tracing.Start(db.Statement.Context, name, attribute.String("db.system", "postgresql"))
+	return db.WithContext(ctx), span
+}
+
+// RegisterTracingCallbacks records query errors on the span of the statement's context
+func RegisterTracingCallbacks(primary *gorm.DB) {
+	record := func(tx *gorm.DB) {
+		if tx.Error == nil || errors.Is(tx.Error, gorm.ErrRecordNotFound) || tx.Statement.Context == nil {
+			return
+		}
+		tracing.RecordError(trace.SpanFromContext(tx.Statement.Context), tx.Error)
+	}
+	primary.Callback().Create().After("gorm:create").Register("tracing:create", record)
+	primary.Callback().Query().After("gorm:query").Register("tracing:query", record)
+	primary.Callback().Update().After("gorm:update").Register("tracing:update", record)
+	primary.Callback().Delete().After("gorm:delete").Register("tracing:delete", record)
+	primary.Callback().Row().After("gorm:row").Register("tracing:row", record)
+	primary.Callback().Raw().After("gorm:raw").Register("tracing:raw", record)
+}
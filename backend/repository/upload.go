@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DocumentUpload is a resumable document upload in progress. Its chunks are
+// stored one object per chunk until the upload is completed, so they may
+// arrive in any order and through any backend replica.
+type DocumentUpload struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID   uuid.UUID `gorm:"type:uuid;not null;index" json:"project_id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	DocumentID  string    `gorm:"not null;default:''" json:"document_id,omitempty"` // Replaced on completion; empty for a new document
+	FileName    string    `gorm:"not null" json:"file_name"`
+	Size        int64     `gorm:"not null" json:"size"`
+	ChunkSize   int64     `gorm:"not null" json:"chunk_size"`
+	ContentHash string    `gorm:"not null;default:''" json:"content_hash,omitempty"` // Expected hex SHA-256, checked on completion
+	CreatedAt   time.Time `gorm:"default:now()" json:"created_at"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (u *DocumentUpload) BeforeCreate(tx *gorm.DB) (err error) {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// ChunkCount returns how many chunks make up the upload
+func (u *DocumentUpload) ChunkCount() int {
+	return int((u.Size + u.ChunkSize - 1) / u.ChunkSize)
+}
+
+// ChunkLength returns the size chunk n must have; only the last chunk may be
+// shorter than ChunkSize
+func (u *DocumentUpload) ChunkLength(n int) int64 {
+	if n == u.ChunkCount()-1 {
+		return u.Size - int64(n)*u.ChunkSize
+	}
+	return u.ChunkSize
+}
+
+// DocumentUploadRepository handles resumable upload database operations
+type DocumentUploadRepository struct {
+	db *gorm.DB
+}
+
+// NewDocumentUpload creates a new DocumentUploadRepository
+func NewDocumentUpload(db *gorm.DB) *DocumentUploadRepository {
+	return &DocumentUploadRepository{db}
+}
+
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *DocumentUploadRepository) WithContext(ctx context.Context) *DocumentUploadRepository {
+	return &DocumentUploadRepository{r.db.WithContext(ctx)}
+}
+
+// Create starts an upload
+func (r *DocumentUploadRepository) Create(u *DocumentUpload) (*DocumentUpload, error) {
+	if err := r.db.Create(u).Error; err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Get returns an upload of a project, or nil if there is none. Expired
+// uploads are returned until they are purged, so callers can tell them apart.
+func (r *DocumentUploadRepository) Get(projectID, id string) (*DocumentUpload, error) {
+	var u DocumentUpload
+	err := r.db.Where("project_id = ? AND id = ?", projectID, id).First(&u).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// PendingBytesByUser sums the declared size of a user's unexpired uploads,
+// except the upload exceptID
+func (r *DocumentUploadRepository) PendingBytesByUser(userID, exceptID string) (int64, error) {
+	var total int64
+	q := r.db.Model(&DocumentUpload{}).Select("COALESCE(SUM(size), 0)").
+		Where("user_id = ? AND expires_at > ?", userID, time.Now())
+	if exceptID != "" {
+		q = q.Where("id <> ?", exceptID)
+	}
+	err := q.Scan(&total).Error
+	return total, err
+}
+
+// ListExpired returns uploads that expired before cutoff
+func (r *DocumentUploadRepository) ListExpired(cutoff time.Time) ([]DocumentUpload, error) {
+	var uploads []DocumentUpload
+	if err := r.db.Where("expires_at <= ?", cutoff).Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+// Delete removes an upload row
+func (r *DocumentUploadRepository) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(&DocumentUpload{}).Error
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -18,6 +19,24 @@ const (
 	StatusSuspended Status = "suspended"
 )
 
+// Valid reports whether s is one of the known statuses
+func (s Status) Valid() bool {
+	return s == StatusActive || s == StatusInactive || s == StatusSuspended
+}
+
+// Blocked reports whether users with status s may not use the API
+func (s Status) Blocked() bool {
+	return s == StatusInactive || s == StatusSuspended
+}
+
+// Role type
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
 // User model
 type User struct {
 	ID              uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
@@ -25,7 +44,11 @@ type User struct {
 	Name            string         `gorm:"not null" json:"name"`
 	Info            datatypes.JSON `gorm:"type:jsonb" json:"info"`
 	Status          Status         `json:"status"`
+	StatusReason    string         `json:"status_reason,omitempty"` // why an admin set the status
+	Role            Role           `gorm:"default:'user'" json:"role"`
 	EncryptedAPIKey string         `gorm:"type:text" json:"-"` // Never expose in JSON
+	AvatarURL       string         `json:"avatar_url"`
+	TenantID        *uuid.UUID     `gorm:"type:uuid;index" json:"tenant_id,omitempty"`
 	CreatedAt       time.Time      `gorm:"default:now()" json:"created_at"`
 	UpdatedAt       *time.Time     `json:"updated_at"`
 }
@@ -63,6 +86,11 @@ func New(db *gorm.DB) *UserRepository {
 	return &UserRepository{db}
 }
 
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *UserRepository) WithContext(ctx context.Context) *UserRepository {
+	return &UserRepository{r.db.WithContext(ctx)}
+}
+
 // Create user
 func (r *UserRepository) Create(u *User) (*User, error) {
 	// check unique email
@@ -80,7 +108,16 @@ func (r *UserRepository) Create(u *User) (*User, error) {
 // List users
 func (r *UserRepository) List() ([]User, error) {
 	var users []User
-	if err := r.db.Find(&users).Error; err != nil {
+	if err := readDB(r.db).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetByStatus lists the users with the given status
+func (r *UserRepository) GetByStatus(status Status) ([]User, error) {
+	var users []User
+	if err := readDB(r.db).Where("status = ?", status).Order("created_at").Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
@@ -147,3 +184,81 @@ func (r *UserRepository) Delete(id string) (bool, error) {
 	res := r.db.Delete(&User{}, "id = ?", id)
 	return res.RowsAffected > 0, res.Error
 }
+
+// DeletedCount is the number of rows removed from one table during a cascade
+type DeletedCount struct {
+	Resource string `json:"resource"`
+	Count    int64  `json:"count"`
+}
+
+// CascadeError reports the step at which a cascading delete failed
+type CascadeError struct {
+	Step string
+	Err  error
+}
+
+func (e *CascadeError) Error() string {
+	return "delete " + e.Step + ": " + e.Err.Error()
+}
+
+func (e *CascadeError) Unwrap() error {
+	return e.Err
+}
+
+// DeleteWithCascade removes a user and every row that belongs to them in a
+// single transaction: API keys, sessions, linked identities, voices, projects (with their
+// members, favorites, schedules, webhooks and executions) and finally the user. It
+// returns the counts of the steps that completed; on failure the transaction
+// is rolled back and the error is a *CascadeError.
+func (r *UserRepository) DeleteWithCascade(id string) ([]DeletedCount, error) {
+	defer purgeProjectCache()
+	var counts []DeletedCount
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		projectIDs := tx.Model(&Project{}).Select("id").Where("user_id = ?", id)
+		steps := []struct {
+			resource string
+			run      func() *gorm.DB
+		}{
+			{"api_keys", func() *gorm.DB { return tx.Delete(&UserAPIKey{}, "user_id = ?", id) }},
+			{"sessions", func() *gorm.DB { return tx.Delete(&Session{}, "user_id = ?", id) }},
+			{"identities", func() *gorm.DB { return tx.Delete(&UserIdentity{}, "user_id = ?", id) }},
+			{"voices", func() *gorm.DB { return tx.Delete(&Voice{}, "user_id = ?", id) }},
+			{"project_members", func() *gorm.DB {
+				return tx.Where("project_id IN (?) OR user_id = ?", projectIDs, id).Delete(&ProjectMember{})
+			}},
+			{"project_favorites", func() *gorm.DB {
+				return tx.Where("project_id IN (?) OR user_id = ?", projectIDs, id).Delete(&ProjectFavorite{})
+			}},
+			{"schedules", func() *gorm.DB { return tx.Where("project_id IN (?)", projectIDs).Delete(&Schedule{}) }},
+			{"webhooks", func() *gorm.DB { return tx.Where("project_id IN (?)", projectIDs).Delete(&Webhook{}) }},
+			{"executions", func() *gorm.DB {
+				return tx.Where("project_id IN (?) OR user_id = ?", projectIDs, id).Delete(&Execution{})
+			}},
+			{"project_versions", func() *gorm.DB { return tx.Where("project_id IN (?)", projectIDs).Delete(&ProjectVersion{}) }},
+			{"embedding_jobs", func() *gorm.DB {
+				return tx.Where("project_id IN (?) OR user_id = ?", projectIDs, id).Delete(&EmbeddingJob{})
+			}},
+			{"documents", func() *gorm.DB {
+				return tx.Where("project_id IN (?) OR user_id = ?", projectIDs, id).Delete(&Document{})
+			}},
+			{"document_versions", func() *gorm.DB {
+				return tx.Where("project_id IN (?) OR user_id = ?", projectIDs, id).Delete(&DocumentVersion{})
+			}},
+			{"document_uploads", func() *gorm.DB {
+				return tx.Where("project_id IN (?) OR user_id = ?", projectIDs, id).Delete(&DocumentUpload{})
+			}},
+			{"team_members", func() *gorm.DB { return tx.Where("user_id = ?", id).Delete(&TeamMember{}) }},
+			{"projects", func() *gorm.DB { return tx.Delete(&Project{}, "user_id = ?", id) }},
+			{"users", func() *gorm.DB { return tx.Delete(&User{}, "id = ?", id) }},
+		}
+		for _, step := range steps {
+			res := step.run()
+			if res.Error != nil {
+				return &CascadeError{Step: step.resource, Err: res.Error}
+			}
+			counts = append(counts, DeletedCount{Resource: step.resource, Count: res.RowsAffected})
+		}
+		return nil
+	})
+	return counts, err
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// maxProjectVersions is how many workflow snapshots are kept per project
+const maxProjectVersions = 50
+
+// ProjectVersion is a snapshot of a project's workflow at one version. The
+// latest snapshots are kept so concurrent edits can be merged against the
+// version an editor started from; the published snapshot is kept regardless.
+type ProjectVersion struct {
+	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID   uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_project_version" json:"project_id"`
+	Version     int            `gorm:"not null;uniqueIndex:idx_project_version" json:"version"`
+	Nodes       datatypes.JSON `gorm:"type:jsonb" json:"nodes"`
+	Connections datatypes.JSON `gorm:"type:jsonb" json:"connections"`
+	Published   bool           `gorm:"not null;default:false" json:"published"` // Served by the public endpoint
+	CreatedAt   time.Time      `gorm:"default:now()" json:"created_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (v *ProjectVersion) BeforeCreate(tx *gorm.DB) (err error) {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	if v.CreatedAt.IsZero() {
+		v.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// saveVersion snapshots the current workflow of p and prunes old snapshots.
+// It must run inside the transaction that saved p.
+func saveVersion(tx *gorm.DB, p *Project) error {
+	v := ProjectVersion{
+		ProjectID:   p.ID,
+		Version:     p.Version,
+		Nodes:       p.Nodes,
+		Connections: p.Connections,
+	}
+	if err := tx.Create(&v).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&ProjectVersion{}, "project_id = ? AND version <= ? AND NOT published", p.ID, p.Version-maxProjectVersions).Error
+}
+
+// GetVersion returns the snapshot of a project at version, or nil if it was pruned
+func (r *ProjectRepository) GetVersion(projectID string, version int) (*ProjectVersion, error) {
+	db, span := startSpan(r.db, "ProjectRepository.GetVersion")
+	defer span.End()
+
+	var v ProjectVersion
+	if err := db.Where("project_id = ? AND version = ?", projectID, version).First(&v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &v, nil
+}
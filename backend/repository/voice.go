@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +15,7 @@ type Voice struct {
 	VoiceURL  string     `gorm:"not null" json:"voice_url"`
 	RefText   string     `json:"ref_text"`
 	UserID    uuid.UUID  `gorm:"type:uuid;not null" json:"user_id"`
+	TenantID  *uuid.UUID `gorm:"type:uuid;index" json:"tenant_id,omitempty"`
 	CreatedAt time.Time  `gorm:"default:now()" json:"created_at"`
 	UpdatedAt *time.Time `json:"updated_at"`
 }
@@ -36,6 +38,11 @@ func NewVoice(db *gorm.DB) *VoiceRepository {
 	return &VoiceRepository{db}
 }
 
+// WithContext returns a repository bound to ctx (used for replica routing)
+func (r *VoiceRepository) WithContext(ctx context.Context) *VoiceRepository {
+	return &VoiceRepository{r.db.WithContext(ctx)}
+}
+
 func (r *VoiceRepository) Create(v *Voice) (*Voice, error) {
 	if err := r.db.Create(v).Error; err != nil {
 		return nil, err
@@ -45,7 +52,7 @@ func (r *VoiceRepository) Create(v *Voice) (*Voice, error) {
 
 func (r *VoiceRepository) List() ([]Voice, error) {
 	var voices []Voice
-	if err := r.db.Find(&voices).Error; err != nil {
+	if err := readDB(r.db).Find(&voices).Error; err != nil {
 		return nil, err
 	}
 	return voices, nil
@@ -64,7 +71,7 @@ func (r *VoiceRepository) GetByID(id string) (*Voice, error) {
 
 func (r *VoiceRepository) ListByUser(userID string) ([]Voice, error) {
 	var voices []Voice
-	if err := r.db.Where("user_id = ?", userID).Find(&voices).Error; err != nil {
+	if err := readDB(r.db).Where("user_id = ?", userID).Find(&voices).Error; err != nil {
 		return nil, err
 	}
 	return voices, nil
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Webhook delivers project events to an external HTTP endpoint
+type Webhook struct {
+	ID        uuid.UUID                   `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID                   `gorm:"type:uuid;not null;index" json:"project_id"`
+	URL       string                      `gorm:"not null" json:"url"`
+	Secret    string                      `gorm:"type:text;not null" json:"-"` // Encrypted, never exposed after creation
+	Events    datatypes.JSONSlice[string] `gorm:"type:jsonb" json:"events"`
+	Enabled   bool                        `gorm:"default:true" json:"enabled"`
+	CreatedAt time.Time                   `gorm:"default:now()" json:"created_at"`
+}
+
+// BeforeCreate hook to ensure UUID
+func (w *Webhook) BeforeCreate(tx *gorm.DB) (err error) {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// Subscribed reports whether the webhook wants event
+func (w *Webhook) Subscribed(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookRepository handles webhook database operations
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhook creates a new WebhookRepository
+func NewWebhook(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{db}
+}
+
+// Create stores a webhook
+func (r *WebhookRepository) Create(w *Webhook) (*Webhook, error) {
+	if err := r.db.Create(w).Error; err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// ListByProject returns all webhooks of a project
+func (r *WebhookRepository) ListByProject(projectID string) ([]Webhook, error) {
+	var webhooks []Webhook
+	if err := r.db.Where("project_id = ?", projectID).Order("created_at ASC").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// ListActiveByProject returns the enabled webhooks of a project
+func (r *WebhookRepository) ListActiveByProject(projectID string) ([]Webhook, error) {
+	var webhooks []Webhook
+	if err := r.db.Where("project_id = ? AND enabled = ?", projectID, true).Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetByID retrieves a webhook of a project
+func (r *WebhookRepository) GetByID(projectID, id string) (*Webhook, error) {
+	var w Webhook
+	if err := r.db.Where("project_id = ? AND id = ?", projectID, id).First(&w).Error; err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Update saves a webhook
+func (r *WebhookRepository) Update(w *Webhook) (*Webhook, error) {
+	if err := r.db.Save(w).Error; err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Delete removes a webhook of a project
+func (r *WebhookRepository) Delete(projectID, id string) error {
+	return r.db.Delete(&Webhook{}, "project_id = ? AND id = ?", projectID, id).Error
+}
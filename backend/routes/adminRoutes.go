@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"manju/backend/config/database"
+	"manju/backend/controllers"
+	mid "manju/backend/middleware"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AdminRoutes(app fiber.Router) {
+	ctrl := controllers.NewAdminController(repository.NewAuditLog(database.Database), repository.NewSession(database.Database), repository.NewTenant(database.Database), repository.NewProject(database.Database))
+	templateCtrl := controllers.NewTemplateController(repository.NewProjectTemplate(database.Database), repository.NewProject(database.Database))
+
+	router := app.Group("/admin", mid.RequireAdmin())
+	router.Get("/audit-logs", ctrl.ListAuditLogs)
+	router.Get("/projects", ctrl.ListProjects)
+	router.Post("/reencrypt-sessions", ctrl.ReencryptSessions)
+	router.Post("/templates/from-project/:id", templateCtrl.CreateTemplateFromProject)
+
+	// Tenant management is limited to admins outside any tenant
+	router.Post("/tenants", mid.RequireSuperAdmin(), ctrl.CreateTenant)
+	router.Get("/tenants", mid.RequireSuperAdmin(), ctrl.ListTenants)
+}
+
+// AdminV1Routes mounts the admin endpoints added since /api/v1, which are
+// not served on the unversioned /api routes
+func AdminV1Routes(app fiber.Router) {
+	ctrl := controllers.NewAdminController(repository.NewAuditLog(database.Database), repository.NewSession(database.Database), repository.NewTenant(database.Database), repository.NewProject(database.Database))
+	userCtrl := controllers.NewUserController(repository.New(database.Database), repository.NewUserDashboard(database.Database))
+
+	// Each route requires an admin itself: a middleware on this /admin group
+	// would run a second time for the routes of AdminRoutes
+	router := app.Group("/admin")
+	router.Get("/users", mid.RequireAdmin(), userCtrl.ListUsersByStatus)
+
+	// Maintenance mode is limited to admins outside any tenant
+	router.Post("/maintenance/enable", mid.RequireAdmin(), mid.RequireSuperAdmin(), ctrl.EnableMaintenance)
+	router.Post("/maintenance/disable", mid.RequireAdmin(), mid.RequireSuperAdmin(), ctrl.DisableMaintenance)
+}
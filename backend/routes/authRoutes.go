@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"time"
+
 	authpkg "manju/backend/auth"
+	mid "manju/backend/middleware"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -15,8 +18,19 @@ func AuthRoutes(app fiber.Router) {
 	router.Use(recover.New())
 	router.Use(logger.New())
 
+	// Block IPs that keep failing OAuth callbacks or presenting malformed sessions
+	router.Use(mid.BruteForceProtect(10, 15*time.Minute))
+
 	router.Get("/login/google", authpkg.Login)
 	router.Get("/callback/google", authpkg.Callback)
+	router.Get("/login/github", authpkg.LoginGitHub)
+	router.Get("/callback/github", authpkg.CallbackGitHub)
+	router.Get("/connect/google/sheets", authpkg.RequireAuth, authpkg.ConnectGoogleSheets)
 	router.Get("/me", authpkg.Me)
 	router.Get("/logout", authpkg.Logout)
+
+	// Session management
+	router.Get("/sessions", authpkg.RequireAuth, authpkg.ListSessions)
+	router.Delete("/sessions", authpkg.RequireAuth, authpkg.RevokeAllSessions)
+	router.Delete("/sessions/:sessionId", authpkg.RequireAuth, authpkg.RevokeSession)
 }
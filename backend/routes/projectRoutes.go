@@ -13,25 +13,114 @@ func ProjectRoutes(app fiber.Router) {
 	ctrl := controllers.NewProjectController(repo)
 	demoCtrl := controllers.NewDemoController(repo)
 	docCtrl := controllers.NewDocumentController(repo)
+	templateCtrl := controllers.NewTemplateController(repository.NewProjectTemplate(database.Database), repo)
+	scheduleCtrl := controllers.NewScheduleController(repo, repository.NewSchedule(database.Database))
+	webhookCtrl := controllers.NewWebhookController(repo, repository.NewWebhook(database.Database))
+	memberCtrl := controllers.NewMemberController(repo, repository.NewProjectMember(database.Database), repository.New(database.Database))
 
 	router := app.Group("/projects")
 	router.Post("/", ctrl.CreateProject)
 	router.Get("/", ctrl.ListProjects)
+	router.Get("/check-name", ctrl.CheckProjectName)
+	router.Get("/tags", ctrl.ListProjectTags)
+	router.Get("/recent", ctrl.ListRecentProjects)
+	router.Get("/document-limits", docCtrl.GetDocumentLimits)
+	router.Post("/import", ctrl.ImportProject)
+	router.Post("/bulk-delete", ctrl.BulkDeleteProjects)
+	router.Post("/from-template/:templateId", templateCtrl.CreateProjectFromTemplate)
 	router.Get("/:id", ctrl.GetProject)
 	router.Put("/:id", ctrl.UpdateProject)
+	router.Put("/:id/autosave", ctrl.AutosaveProject)
+	router.Get("/:id/versions/:a/diff/:b", ctrl.DiffProjectVersions)
 	router.Delete("/:id", ctrl.DeleteProject)
+	router.Get("/:id/export", ctrl.ExportProject)
+	router.Get("/:id/stats", ctrl.GetProjectStats)
+	router.Post("/:id/open", ctrl.OpenProject)
+	router.Post("/:id/favorite", ctrl.FavoriteProject)
+	router.Delete("/:id/favorite", ctrl.UnfavoriteProject)
+	router.Get("/:id/settings", ctrl.GetProjectSettings)
+	router.Put("/:id/settings", ctrl.UpdateProjectSettings)
+	router.Put("/:id/thumbnail", ctrl.UploadThumbnail)
+	router.Get("/:id/thumbnail", ctrl.GetThumbnail)
+	router.Delete("/:id/thumbnail", ctrl.DeleteThumbnail)
+	router.Patch("/:id/nodes/:nodeId", ctrl.PatchNode)
+	router.Post("/:id/archive", ctrl.ArchiveProject)
+	router.Post("/:id/publish", ctrl.PublishProject)
+	router.Post("/:id/unpublish", ctrl.UnpublishProject)
+	router.Post("/:id/unarchive", ctrl.UnarchiveProject)
+
+	// Collaborator endpoints
+	router.Get("/:id/members", memberCtrl.ListMembers)
+	router.Post("/:id/members", memberCtrl.InviteMember)
+	router.Put("/:id/members/:memberId", memberCtrl.UpdateMember)
+	router.Delete("/:id/members/:memberId", memberCtrl.RemoveMember)
 
 	// Demo and validation endpoints
 	router.Post("/:id/demo", demoCtrl.DemoProject)
 	router.Post("/:id/validate", demoCtrl.ValidateWorkflow)
 	router.Get("/:id/workflow-type", demoCtrl.GetWorkflowType)
 	router.Post("/:id/tts", demoCtrl.GenerateTTS)
+	router.Get("/:id/executions", demoCtrl.ListExecutions)
+
+	// Schedule endpoints
+	router.Post("/:id/schedules", scheduleCtrl.CreateSchedule)
+	router.Get("/:id/schedules", scheduleCtrl.ListSchedules)
+	router.Put("/:id/schedules/:schedId", scheduleCtrl.UpdateSchedule)
+	router.Delete("/:id/schedules/:schedId", scheduleCtrl.DeleteSchedule)
+
+	// Webhook endpoints
+	router.Post("/:id/webhooks", webhookCtrl.CreateWebhook)
+	router.Get("/:id/webhooks", webhookCtrl.ListWebhooks)
+	router.Put("/:id/webhooks/:webhookId", webhookCtrl.UpdateWebhook)
+	router.Delete("/:id/webhooks/:webhookId", webhookCtrl.DeleteWebhook)
 
 	// Document management endpoints
 	router.Post("/:id/documents", docCtrl.UploadDocument)
+	router.Post("/:id/documents/uploads", docCtrl.CreateDocumentUpload)
+	router.Get("/:id/documents/uploads/:uploadId", docCtrl.GetDocumentUpload)
+	router.Put("/:id/documents/uploads/:uploadId/chunks/:n", docCtrl.PutDocumentUploadChunk)
+	router.Post("/:id/documents/uploads/:uploadId/complete", docCtrl.CompleteDocumentUpload)
+	router.Delete("/:id/documents/uploads/:uploadId", docCtrl.AbortDocumentUpload)
 	router.Get("/:id/documents", docCtrl.ListDocuments)
+	router.Patch("/:id/documents/:docId", docCtrl.UpdateDocument)
 	router.Delete("/:id/documents/:docId", docCtrl.DeleteDocument)
+	router.Post("/:id/documents/:docId/restore", docCtrl.RestoreDocument)
+	router.Post("/:id/documents/:docId/embed", docCtrl.EmbedDocument)
 	router.Get("/:id/documents/:docId/file", docCtrl.GetDocumentFile)
+	router.Get("/:id/documents/:docId/download", docCtrl.DownloadDocument)
 	router.Get("/:id/documents-path", docCtrl.GetProjectDocumentsPath)
 	router.Post("/:id/documents/embed", docCtrl.EmbedDocuments)
+	router.Get("/:id/documents/embed/:jobId", docCtrl.GetEmbeddingJob)
+	router.Get("/:id/embeddings/:jobId", docCtrl.GetEmbeddingJob)
+}
+
+// ProjectV1Routes mounts the project endpoints added since /api/v1, which
+// are not served on the unversioned /api routes
+func ProjectV1Routes(app fiber.Router) {
+	repo := repository.NewProject(database.Database)
+	ctrl := controllers.NewProjectController(repo)
+	demoCtrl := controllers.NewDemoController(repo)
+	docCtrl := controllers.NewDocumentController(repo)
+
+	router := app.Group("/projects")
+	router.Post("/:id/duplicate", ctrl.DuplicateProject)
+	router.Get("/:id/token-usage", ctrl.GetTokenUsage)
+	router.Post("/:id/reset-token-usage", ctrl.ResetTokenUsage)
+	router.Get("/:id/complexity", ctrl.GetProjectComplexity)
+	router.Post("/:id/preview", ctrl.GenerateWorkflowPreview)
+	router.Get("/:id/preview", ctrl.GetWorkflowPreview)
+
+	// Demo endpoints
+	router.Post("/:id/demo/stream", demoCtrl.DemoProjectStream)
+	router.Post("/:id/sheets/read", demoCtrl.ReadSheet)
+	router.Post("/:id/sheets/write", demoCtrl.WriteSheet)
+
+	// Document management endpoints
+	router.Delete("/:id/documents", docCtrl.DeleteAllDocuments)
+	router.Get("/:id/documents/:docId/versions", docCtrl.ListDocumentVersions)
+	router.Post("/:id/documents/:docId/versions", docCtrl.UploadDocumentVersion)
+	router.Post("/:id/documents/:docId/versions/:version/restore", docCtrl.RestoreDocumentVersion)
+	router.Get("/:id/documents/:docId/preview", docCtrl.PreviewDocument)
+	router.Get("/:id/documents/:docId/rows", docCtrl.GetDocumentRows)
+	router.Get("/:id/documents/:docId/signed-url", docCtrl.GetDocumentSignedURL)
 }
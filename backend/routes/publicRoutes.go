@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"manju/backend/config/database"
+	"manju/backend/controllers"
+	"manju/backend/repository"
+	"manju/backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PublicRoutes are served without login, for published projects, signed
+// inbound webhooks and signed document URLs
+func PublicRoutes(app fiber.Router) {
+	ctrl := controllers.NewProjectController(repository.NewProject(database.Database))
+
+	router := app.Group("/public")
+	router.Post("/bots/:slug/chat", ctrl.PublicChat)
+
+	docCtrl := controllers.NewDocumentController(repository.NewProject(database.Database))
+	app.Get("/api/files/:token", docCtrl.ServeSignedFile)
+
+	webhooks := app.Group("/webhooks")
+	webhooks.Post("/trigger/:projectId", ctrl.VerifyWebhook, services.WebhookTriggerLimiter(), ctrl.TriggerWebhook)
+}
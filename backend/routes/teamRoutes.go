@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"manju/backend/config/database"
+	"manju/backend/controllers"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TeamRoutes(app fiber.Router) {
+	repo := repository.NewTeam(database.Database)
+	ctrl := controllers.NewTeamController(repo, repository.New(database.Database))
+
+	router := app.Group("/teams")
+	router.Get("/", ctrl.ListTeams)
+	router.Post("/", ctrl.CreateTeam)
+	router.Get("/:id", ctrl.GetTeam)
+	router.Put("/:id", ctrl.UpdateTeam)
+	router.Delete("/:id", ctrl.DeleteTeam)
+	router.Get("/:id/members", ctrl.ListTeamMembers)
+	router.Post("/:id/members", ctrl.AddTeamMember)
+	router.Put("/:id/members/:userId", ctrl.UpdateTeamMember)
+	router.Delete("/:id/members/:userId", ctrl.RemoveTeamMember)
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"manju/backend/config/database"
+	"manju/backend/controllers"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TemplateRoutes(app fiber.Router) {
+	repo := repository.NewProjectTemplate(database.Database)
+	ctrl := controllers.NewTemplateController(repo, repository.NewProject(database.Database))
+
+	router := app.Group("/templates")
+	router.Get("/", ctrl.ListTemplates)
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"manju/backend/config/database"
 	"manju/backend/controllers"
+	mid "manju/backend/middleware"
 	"manju/backend/repository"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,7 +11,7 @@ import (
 
 func UserRoutes(app fiber.Router) {
 	repo := repository.New(database.Database)
-	ctrl := controllers.NewUserController(repo)
+	ctrl := controllers.NewUserController(repo, repository.NewUserDashboard(database.Database))
 
 	router := app.Group("/users")
 	router.Post("/", ctrl.CreateUser)
@@ -18,6 +19,10 @@ func UserRoutes(app fiber.Router) {
 	router.Get("/:id", ctrl.GetUser)
 	router.Put("/:id", ctrl.UpdateUser)
 	router.Delete("/:id", ctrl.DeleteUser)
+	router.Put("/:id/avatar", ctrl.UploadAvatar)
+	router.Get("/:id/avatar", ctrl.GetAvatar)
+	router.Get("/:id/dashboard", ctrl.GetUserDashboard)
+	router.Get("/:id/storage", ctrl.GetUserStorage)
 
 	// Single API Key management (legacy)
 	router.Put("/:id/api-key", ctrl.SaveAPIKey)
@@ -30,3 +35,12 @@ func UserRoutes(app fiber.Router) {
 	router.Delete("/:id/api-keys/:keyId", apiKeyCtrl.DeleteAPIKey)
 	router.Put("/:id/api-keys/:keyId/default", apiKeyCtrl.SetDefaultAPIKey)
 }
+
+// UserV1Routes mounts the user endpoints added since /api/v1, which are not
+// served on the unversioned /api routes
+func UserV1Routes(app fiber.Router) {
+	ctrl := controllers.NewUserController(repository.New(database.Database), repository.NewUserDashboard(database.Database))
+
+	router := app.Group("/users")
+	router.Put("/:id/status", mid.RequireAdmin(), ctrl.UpdateUserStatus)
+}
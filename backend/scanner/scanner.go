@@ -0,0 +1,56 @@
+// Package scanner checks uploaded files for malware, with a clamd daemon or,
+// by default, not at all.
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is the verdict on a scanned file
+type Result struct {
+	Infected  bool
+	Signature string // name of the detected malware, when infected
+}
+
+// Scanner scans the content of a file. An error means the file could not be
+// scanned, not that it is infected.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Noop accepts every file without reading it
+type Noop struct{}
+
+// Scan reports r clean
+func (Noop) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+// FromEnv builds the scanner selected by SCANNER_BACKEND: "none" (the
+// default) or "clamd", which connects to CLAMD_ADDRESS (default
+// "localhost:3310", or "unix:/path/to/clamd.sock") and gives up after
+// CLAMD_TIMEOUT_SEC (default 60) seconds.
+func FromEnv() (Scanner, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("SCANNER_BACKEND"))); backend {
+	case "", "none":
+		return Noop{}, nil
+	case "clamd":
+		addr := strings.TrimSpace(os.Getenv("CLAMD_ADDRESS"))
+		if addr == "" {
+			addr = "localhost:3310"
+		}
+		timeout := 60 * time.Second
+		if v, err := strconv.Atoi(os.Getenv("CLAMD_TIMEOUT_SEC")); err == nil && v > 0 {
+			timeout = time.Duration(v) * time.Second
+		}
+		return NewClamd(addr, timeout), nil
+	default:
+		return nil, fmt.Errorf("scanner: unknown SCANNER_BACKEND %q", backend)
+	}
+}
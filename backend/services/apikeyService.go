@@ -1,20 +1,83 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"manju/backend/models/response"
 	"manju/backend/repository"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
+// ErrInvalidAPIKey is returned by ValidateAPIKey when the provider rejects a key
+var ErrInvalidAPIKey = errors.New("invalid_api_key")
+
+// apiKeyValidationClient makes the test calls of ValidateAPIKey
+var apiKeyValidationClient = &http.Client{Timeout: 10 * time.Second}
+
+// openAIModelsURL is a cheap authenticated OpenAI endpoint used to test keys
+const openAIModelsURL = "https://api.openai.com/v1/models"
+
+// ValidateAPIKey checks key with a lightweight call to provider's API. It
+// returns ErrInvalidAPIKey when the provider rejects the key, and another
+// error when the provider could not be reached. Keys of unknown providers,
+// and every key when SKIP_API_KEY_VALIDATION=true, are accepted as is.
+func ValidateAPIKey(provider, key string) error {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("SKIP_API_KEY_VALIDATION")), "true") {
+		return nil
+	}
+
+	switch provider {
+	case "openai":
+		req, err := http.NewRequest(http.MethodGet, openAIModelsURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := apiKeyValidationClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("validate %s key: %w", provider, err)
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return nil
+		case resp.StatusCode >= 500:
+			return fmt.Errorf("validate %s key: provider returned %d", provider, resp.StatusCode)
+		default:
+			return ErrInvalidAPIKey
+		}
+	default:
+		return nil
+	}
+}
+
+// checkAPIKey validates key and writes the error response if it is rejected.
+// It reports whether the caller may go on to store the key.
+func checkAPIKey(c *fiber.Ctx, provider, key string) (bool, error) {
+	err := ValidateAPIKey(provider, key)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrInvalidAPIKey):
+		return false, response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeAPIKeyInvalid, "the API key was rejected by the provider", fiber.Map{"provider": provider})
+	default:
+		return false, response.Error(c, http.StatusBadGateway, response.ErrCodeAPIKeyValidationFailed, "the API key could not be validated", fiber.Map{"provider": provider, "detail": err.Error()})
+	}
+}
+
 // ListAPIKeys returns all API keys for a user (masked)
 func ListAPIKeys(c *fiber.Ctx, repo *repository.UserAPIKeyRepository) error {
 	userID := c.Params("id")
 
-	keys, err := repo.ListByUserID(userID)
+	keys, err := repo.WithContext(c.UserContext()).ListByUserID(userID)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
 	// Mask the keys before returning
@@ -30,21 +93,24 @@ func ListAPIKeys(c *fiber.Ctx, repo *repository.UserAPIKeyRepository) error {
 	return c.JSON(keys)
 }
 
+// AddAPIKeyPayload is the body of POST /users/:id/api-keys
+type AddAPIKeyPayload struct {
+	Label    string `json:"label"`
+	APIKey   string `json:"api_key"`
+	Provider string `json:"provider"`
+}
+
 // AddAPIKey adds a new API key for a user
 func AddAPIKey(c *fiber.Ctx, repo *repository.UserAPIKeyRepository) error {
 	userID := c.Params("id")
 
-	var body struct {
-		Label    string `json:"label"`
-		APIKey   string `json:"api_key"`
-		Provider string `json:"provider"`
-	}
+	var body AddAPIKeyPayload
 	if err := c.BodyParser(&body); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
 	}
 
 	if body.APIKey == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "api_key is required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "api_key is required", nil)
 	}
 	if body.Label == "" {
 		body.Label = "Default Key"
@@ -53,15 +119,19 @@ func AddAPIKey(c *fiber.Ctx, repo *repository.UserAPIKeyRepository) error {
 		body.Provider = "openai"
 	}
 
+	if ok, err := checkAPIKey(c, body.Provider, body.APIKey); !ok {
+		return err
+	}
+
 	// Encrypt the API key
 	encrypted, err := EncryptAPIKey(body.APIKey)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to encrypt key"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to encrypt key", nil)
 	}
 
 	userUUID, err := uuid.Parse(userID)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user id", nil)
 	}
 
 	key := &repository.UserAPIKey{
@@ -79,12 +149,18 @@ func AddAPIKey(c *fiber.Ctx, repo *repository.UserAPIKeyRepository) error {
 
 	created, err := repo.Create(key)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
 	// Set masked key for response
 	created.MaskedKey = MaskAPIKey(body.APIKey)
 
+	RecordAudit(c, "api_key.create", "api_key", created.ID.String(), fiber.Map{
+		"label":      created.Label,
+		"provider":   created.Provider,
+		"masked_key": created.MaskedKey,
+	})
+
 	return c.Status(http.StatusCreated).JSON(created)
 }
 
@@ -94,9 +170,11 @@ func DeleteAPIKey(c *fiber.Ctx, repo *repository.UserAPIKeyRepository) error {
 	keyID := c.Params("keyId")
 
 	if err := repo.Delete(keyID, userID); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
+	RecordAudit(c, "api_key.delete", "api_key", keyID, nil)
+
 	return c.SendStatus(http.StatusNoContent)
 }
 
@@ -106,17 +184,27 @@ func SetDefaultAPIKey(c *fiber.Ctx, repo *repository.UserAPIKeyRepository) error
 	keyID := c.Params("keyId")
 
 	if err := repo.SetDefault(keyID, userID); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
-	return c.JSON(fiber.Map{"message": "default key updated"})
+	RecordAudit(c, "api_key.set_default", "api_key", keyID, nil)
+
+	return c.JSON(response.MessageResponse{Message: "default key updated"})
 }
 
-// GetDecryptedAPIKey retrieves and decrypts a specific API key (internal use)
-func GetDecryptedAPIKey(repo *repository.UserAPIKeyRepository, keyID string) (string, error) {
+// errAPIKeyNotOwned is returned when a key belongs to someone else than the
+// user whose key was asked for
+var errAPIKeyNotOwned = errors.New("api key belongs to another user")
+
+// GetDecryptedAPIKey retrieves and decrypts a specific API key of ownerID
+// (internal use). Keys of other users are refused with errAPIKeyNotOwned.
+func GetDecryptedAPIKey(repo *repository.UserAPIKeyRepository, keyID string, ownerID uuid.UUID) (string, error) {
 	key, err := repo.GetByID(keyID)
 	if err != nil {
 		return "", err
 	}
+	if key.UserID != ownerID {
+		return "", errAPIKeyNotOwned
+	}
 	return DecryptAPIKey(key.EncryptedKey)
 }
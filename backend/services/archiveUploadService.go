@@ -0,0 +1,181 @@
+package services
+
+import (
+	"archive/zip"
+	"io"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// A .zip uploaded as a single file is expanded into one document per file
+// it contains. Every file goes through the same checks as a normal upload.
+// The archive as a whole is rejected when it holds too many files or too
+// many uncompressed bytes, so a small zip can't expand into a disk-filling
+// one. The declared sizes come from the uploader, so they are checked
+// without adding up past the limits, and an entry is never read past its
+// declared size.
+
+// getMaxArchiveFiles returns how many files an uploaded archive may contain
+func getMaxArchiveFiles() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_ARCHIVE_FILES")); err == nil && v > 0 {
+		return v
+	}
+	return 100
+}
+
+// getMaxArchiveUncompressedSize returns how many bytes the files of an
+// uploaded archive may add up to once expanded
+func getMaxArchiveUncompressedSize() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("MAX_ARCHIVE_UNCOMPRESSED_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 200 << 20 // 200 MB
+}
+
+// archiveEntry is a file of an uploaded archive, named by its path inside it
+type archiveEntry struct {
+	Path string
+	File uploadedFile
+}
+
+// skippedEntry is a file of an uploaded archive that was not stored
+type skippedEntry struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// archiveUploadResult lists what an uploaded archive was expanded into
+type archiveUploadResult struct {
+	Archive   string         `json:"archive"`
+	Documents []DocumentInfo `json:"documents"`
+	Skipped   []skippedEntry `json:"skipped"`
+}
+
+// isHiddenArchivePath reports whether any part of a path inside an archive
+// starts with a dot, which includes macOS "._" resource forks
+func isHiddenArchivePath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveEntries lists the files of an archive to store, skipping
+// directories silently and hidden files and files over the document size
+// limit with a reason. It rejects archives over the file count or
+// uncompressed size limits.
+func archiveEntries(zr *zip.Reader) ([]archiveEntry, []skippedEntry, *uploadError) {
+	entries := []archiveEntry{}
+	skipped := []skippedEntry{}
+	maxTotal := uint64(getMaxArchiveUncompressedSize())
+	maxFile := uint64(getMaxDocumentSize())
+	var total uint64
+	for _, f := range zr.File {
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		if f.FileInfo().IsDir() || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if isHiddenArchivePath(name) {
+			skipped = append(skipped, skippedEntry{name, "hidden file"})
+			continue
+		}
+		// Compared with what is left so a forged size can't wrap the total
+		size := f.UncompressedSize64
+		if size > maxTotal-total {
+			expanded := total + size
+			if expanded < total {
+				expanded = math.MaxUint64
+			}
+			return nil, nil, &uploadError{http.StatusRequestEntityTooLarge, response.ErrCodeArchiveTooLarge, "archive expands to too many bytes", fiber.Map{
+				"uncompressed_bytes":     expanded,
+				"max_uncompressed_bytes": maxTotal,
+			}}
+		}
+		total += size
+		if size > maxFile {
+			skipped = append(skipped, skippedEntry{name, "file is too large"})
+			continue
+		}
+		entries = append(entries, archiveEntry{name, uploadedFile{
+			Name: path.Base(name),
+			Size: int64(size),
+			Open: func() (io.ReadCloser, error) {
+				r, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				return struct {
+					io.Reader
+					io.Closer
+				}{io.LimitReader(r, int64(size)), r}, nil
+			},
+		}})
+	}
+
+	if max := getMaxArchiveFiles(); len(entries) > max {
+		return nil, nil, &uploadError{http.StatusRequestEntityTooLarge, response.ErrCodeArchiveTooLarge, "archive has too many files", fiber.Map{
+			"files":     len(entries),
+			"max_files": max,
+		}}
+	}
+	return entries, skipped, nil
+}
+
+// uploadArchive expands an uploaded .zip into documents. Files that fail
+// validation are listed as skipped with the reason; the rag-documents node
+// is updated once for all stored documents.
+func uploadArchive(c *fiber.Ctx, repo *repository.ProjectRepository, docRepo *repository.DocumentRepository, project *repository.Project, userID uuid.UUID, file *multipart.FileHeader) error {
+	f, err := file.Open()
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "failed to read file", nil)
+	}
+	defer f.Close()
+	zr, err := zip.NewReader(f, file.Size)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid zip archive", nil)
+	}
+
+	entries, skipped, archiveErr := archiveEntries(zr)
+	if archiveErr != nil {
+		return archiveErr.respond(c)
+	}
+
+	result := archiveUploadResult{Archive: file.Filename, Documents: []DocumentInfo{}, Skipped: skipped}
+	var saved []*repository.Document
+	for _, entry := range entries {
+		doc, _, deduplicated, uploadErr := saveUploadedDocument(c, docRepo, project, userID, entry.File, "")
+		if uploadErr != nil {
+			result.Skipped = append(result.Skipped, skippedEntry{entry.Path, uploadErr.message})
+			continue
+		}
+		info := documentInfo(doc)
+		if deduplicated {
+			info.Status, info.Deduplicated = documentDeduplicated, true
+		} else {
+			saved = append(saved, doc)
+		}
+		result.Documents = append(result.Documents, info)
+	}
+
+	if len(result.Documents) == 0 {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeValidation, "archive contains no documents that can be uploaded", fiber.Map{
+			"skipped": result.Skipped,
+		})
+	}
+	if err := keepUploadedDocuments(c, repo, docRepo, project, saved, nil); err != nil {
+		return documentSyncError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(result)
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// zipArchive builds a zip of files; names ending in / are directories
+func zipArchive(t *testing.T, files ...testFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range files {
+		part, err := w.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(part, f.content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// zipBomb builds a zip of count text files of size zero bytes each, which
+// compress to almost nothing
+func zipBomb(t *testing.T, count int, size int64) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.BestSpeed)
+	})
+	zeros := make([]byte, 1<<20)
+	for i := range count {
+		part, err := w.Create("bomb/" + string(rune('a'+i)) + ".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for written := int64(0); written < size; written += int64(len(zeros)) {
+			part.Write(zeros[:min(int64(len(zeros)), size-written)])
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// lyingZip builds a zip of one text file whose header declares fewer bytes
+// than its data expands to
+func lyingZip(t *testing.T, content string, declared uint64) string {
+	t.Helper()
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+	io.WriteString(fw, content)
+	fw.Close()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	part, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "small.txt",
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE([]byte(content)),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: declared,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(compressed.Bytes())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// forgedZip builds a zip of one-byte text files, named a.txt, b.txt and so
+// on, whose headers declare the given sizes
+func forgedZip(t *testing.T, declared ...uint64) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i, size := range declared {
+		part, err := w.CreateRaw(&zip.FileHeader{
+			Name:               string(rune('a'+i)) + ".txt",
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE([]byte("x")),
+			CompressedSize64:   1,
+			UncompressedSize64: size,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(part, "x")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestUploadArchive(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		archive    func(t *testing.T) string
+		wantStatus int
+		wantCode   string
+		// wantDocs are the names of the stored documents
+		wantDocs []string
+		// wantSkipped maps each skipped entry to its reason
+		wantSkipped map[string]string
+		// wantDetails are error details to check
+		wantDetails map[string]float64
+	}{
+		{
+			name: "nested directories",
+			archive: func(t *testing.T) string {
+				return zipArchive(t,
+					testFile{"handbook/", ""},
+					testFile{"handbook/intro.md", "# Welcome"},
+					testFile{"handbook/policies/", ""},
+					testFile{"handbook/policies/leave.txt", "Annual leave is 20 days."},
+					testFile{"handbook/policies/holidays.csv", "date,name\n2024-04-13,Songkran\n"},
+					testFile{`handbook\windows\path.txt`, "backslashes"},
+					testFile{"handbook/.DS_Store", "junk"},
+					testFile{"__MACOSX/handbook/._intro.md", "resource fork"},
+					testFile{"handbook/.git/config", "[core]"},
+					testFile{"handbook/tools/setup.exe", "MZ"},
+				)
+			},
+			wantStatus: http.StatusCreated,
+			wantDocs:   []string{"holidays.csv", "intro.md", "leave.txt", "path.txt"},
+			wantSkipped: map[string]string{
+				"handbook/.DS_Store":           "hidden file",
+				"__MACOSX/handbook/._intro.md": "hidden file",
+				"handbook/.git/config":         "hidden file",
+				"handbook/tools/setup.exe":     "unsupported file type",
+			},
+		},
+		{
+			name: "nothing to store",
+			archive: func(t *testing.T) string {
+				return zipArchive(t, testFile{"setup.exe", "MZ"}, testFile{".hidden.txt", "x"})
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   response.ErrCodeValidation,
+		},
+		{
+			name:       "not a zip",
+			archive:    func(t *testing.T) string { return "PK but not really" },
+			wantStatus: http.StatusBadRequest,
+			wantCode:   response.ErrCodeBadRequest,
+		},
+		{
+			name: "too many files",
+			env:  map[string]string{"MAX_ARCHIVE_FILES": "3"},
+			archive: func(t *testing.T) string {
+				return zipArchive(t, testFile{"a.txt", "a"}, testFile{"b.txt", "b"}, testFile{"c.txt", "c"}, testFile{"d.txt", "d"})
+			},
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    response.ErrCodeArchiveTooLarge,
+			wantDetails: map[string]float64{"files": 4, "max_files": 3},
+		},
+		{
+			name: "hidden files and directories don't count towards the limit",
+			env:  map[string]string{"MAX_ARCHIVE_FILES": "3"},
+			archive: func(t *testing.T) string {
+				return zipArchive(t, testFile{"docs/", ""}, testFile{"docs/a.txt", "a"}, testFile{"docs/b.txt", "b"}, testFile{"docs/c.txt", "c"}, testFile{"docs/.DS_Store", "x"})
+			},
+			wantStatus:  http.StatusCreated,
+			wantDocs:    []string{"a.txt", "b.txt", "c.txt"},
+			wantSkipped: map[string]string{"docs/.DS_Store": "hidden file"},
+		},
+		{
+			name: "expands past the configured size",
+			env:  map[string]string{"MAX_ARCHIVE_UNCOMPRESSED_BYTES": "1048576"},
+			archive: func(t *testing.T) string {
+				return zipBomb(t, 2, 600<<10)
+			},
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    response.ErrCodeArchiveTooLarge,
+			wantDetails: map[string]float64{"uncompressed_bytes": 2 * 600 << 10, "max_uncompressed_bytes": 1 << 20},
+		},
+		{
+			// Well under a megabyte uploaded, over the default 200 MB expanded
+			name: "zip bomb",
+			archive: func(t *testing.T) string {
+				bomb := zipBomb(t, 3, 70<<20)
+				if len(bomb) > 1<<20 {
+					t.Fatalf("bomb is %d bytes compressed", len(bomb))
+				}
+				return bomb
+			},
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    response.ErrCodeArchiveTooLarge,
+			wantDetails: map[string]float64{"uncompressed_bytes": 3 * 70 << 20, "max_uncompressed_bytes": 200 << 20},
+		},
+		{
+			// The declared size passes the limits, but reading stops there
+			name:       "entry larger than declared",
+			env:        map[string]string{"MAX_ARCHIVE_UNCOMPRESSED_BYTES": "1024"},
+			archive:    func(t *testing.T) string { return lyingZip(t, string(make([]byte, 1<<20)), 10) },
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   response.ErrCodeValidation,
+		},
+		{
+			// Converted to int64 this size would be negative and pass every limit
+			name:        "forged entry size",
+			archive:     func(t *testing.T) string { return forgedZip(t, math.MaxUint64) },
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    response.ErrCodeArchiveTooLarge,
+			wantDetails: map[string]float64{"max_uncompressed_bytes": 200 << 20},
+		},
+		{
+			// Added up, these sizes wrap around to 5 bytes
+			name:        "forged sizes that wrap the total",
+			env:         map[string]string{"MAX_DOCUMENT_SIZE": strconv.FormatInt(math.MaxInt64, 10), "MAX_ARCHIVE_UNCOMPRESSED_BYTES": strconv.FormatInt(math.MaxInt64, 10)},
+			archive:     func(t *testing.T) string { return forgedZip(t, math.MaxInt64, math.MaxInt64, 7) },
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    response.ErrCodeArchiveTooLarge,
+			wantDetails: map[string]float64{"max_uncompressed_bytes": math.MaxInt64},
+		},
+		{
+			name: "entry over the document size limit",
+			env:  map[string]string{"MAX_DOCUMENT_SIZE": "1024"},
+			archive: func(t *testing.T) string {
+				return zipArchive(t, testFile{"small.txt", "small"}, testFile{"big.txt", strings.Repeat("x", 2048)})
+			},
+			wantStatus:  http.StatusCreated,
+			wantDocs:    []string{"small.txt"},
+			wantSkipped: map[string]string{"big.txt": "file is too large"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"MAX_ARCHIVE_FILES", "MAX_ARCHIVE_UNCOMPRESSED_BYTES", "MAX_DOCUMENT_SIZE"} {
+				t.Setenv(env, tt.env[env])
+			}
+			useTestDB(t, documentModels...)
+			useTestStorage(t)
+			project := createTestProject(t, uuid.New(), `[{"id":"docs","type":"rag-documents","position":{"x":0,"y":0},"data":{}}]`)
+
+			resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+				return UploadDocument(c, repository.NewProject(repository.GetDB()))
+			}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", nil, testFile{"handbook.zip", tt.archive(t)}))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			stored, err := repository.NewDocument(repository.GetDB()).ListByProject(project.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode != "" {
+				var errBody struct {
+					Code    string             `json:"code"`
+					Details map[string]float64 `json:"details"`
+				}
+				json.Unmarshal(body, &errBody)
+				if errBody.Code != tt.wantCode {
+					t.Errorf("code = %s, want %s", errBody.Code, tt.wantCode)
+				}
+				for k, want := range tt.wantDetails {
+					if got := errBody.Details[k]; got != want {
+						t.Errorf("details[%s] = %v, want %v", k, got, want)
+					}
+				}
+				if len(stored) != 0 {
+					t.Errorf("%d documents stored from a rejected archive", len(stored))
+				}
+				return
+			}
+
+			var result archiveUploadResult
+			if err := json.Unmarshal(body, &result); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, d := range result.Documents {
+				names = append(names, d.Name)
+			}
+			sort.Strings(names)
+			if result.Archive != "handbook.zip" || !reflect.DeepEqual(names, tt.wantDocs) {
+				t.Errorf("archive %s expanded into %v, want %v", result.Archive, names, tt.wantDocs)
+			}
+			if len(stored) != len(tt.wantDocs) {
+				t.Errorf("%d documents stored, want %d", len(stored), len(tt.wantDocs))
+			}
+			skipped := map[string]string{}
+			for _, s := range result.Skipped {
+				if s.Reason == "" {
+					t.Errorf("%s skipped without a reason", s.Name)
+				}
+				skipped[s.Name] = s.Reason
+			}
+			if len(skipped) != len(tt.wantSkipped) {
+				t.Errorf("skipped %v, want %v", skipped, tt.wantSkipped)
+			}
+			for name, reason := range tt.wantSkipped {
+				if got, ok := skipped[name]; !ok || (reason != "" && got != reason) {
+					t.Errorf("%s skipped with %q, want %q", name, got, reason)
+				}
+			}
+
+			// The rag-documents node lists the expanded documents of the
+			// types it takes
+			wantListed := 0
+			for _, name := range tt.wantDocs {
+				if slices.Contains(nodeDocumentTypes["rag-documents"], filepath.Ext(name)) {
+					wantListed++
+				}
+			}
+			project, _ = repository.NewProject(repository.GetDB()).GetByID(project.ID.String())
+			if listed, _ := nodeDataByID(project)["docs"]["documents"].([]interface{}); len(listed) != wantListed {
+				t.Errorf("node lists %d documents, want %d", len(listed), wantListed)
+			}
+		})
+	}
+}
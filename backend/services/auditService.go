@@ -0,0 +1,87 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// RecordAudit stores an audit record for a successful mutation using the
+// actor, IP and user agent of the current request. Failures are logged and
+// never affect the response.
+func RecordAudit(c *fiber.Ctx, action, resourceType, resourceID string, diff interface{}) {
+	entry := &repository.AuditLog{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		IP:           c.IP(),
+		UserAgent:    c.Get(fiber.HeaderUserAgent),
+	}
+
+	if userIDStr, ok := c.Locals("userID").(string); ok {
+		if uid, err := uuid.Parse(userIDStr); err == nil {
+			entry.UserID = &uid
+		}
+	}
+
+	if diff != nil {
+		if b, err := json.Marshal(diff); err == nil {
+			entry.Diff = datatypes.JSON(b)
+		}
+	}
+
+	if _, err := repository.NewAuditLog(repository.GetDB()).WithContext(c.UserContext()).Create(entry); err != nil {
+		log.Printf("[audit] failed to record %s %s/%s: %v", action, resourceType, resourceID, err)
+	}
+}
+
+// fieldChange is a single before/after pair in an audit diff
+type fieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// ListAuditLogs returns audit records filtered by resource_type, user_id, from and to
+func ListAuditLogs(c *fiber.Ctx, repo *repository.AuditLogRepository) error {
+	filter := repository.AuditLogFilter{
+		ResourceType: c.Query("resource_type"),
+		UserID:       c.Query("user_id"),
+		Limit:        c.QueryInt("limit", 100),
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseTimeParam(from)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid from", nil)
+		}
+		filter.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseTimeParam(to)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid to", nil)
+		}
+		filter.To = &t
+	}
+
+	logs, err := repo.WithContext(c.UserContext()).List(filter)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(logs)
+}
+
+// parseTimeParam accepts RFC3339 timestamps or plain YYYY-MM-DD dates
+func parseTimeParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+)
+
+// AutosavePayload is the editor's autosave request: the workflow as the user
+// sees it and the version it was loaded from
+type AutosavePayload struct {
+	BaseVersion int                      `json:"base_version"`
+	Nodes       []map[string]interface{} `json:"nodes"`
+	Connections []map[string]interface{} `json:"connections"`
+}
+
+// AutosaveResponse is the workflow as saved, after merging
+type AutosaveResponse struct {
+	Version     int            `json:"version"`
+	Merged      bool           `json:"merged"` // whether changes saved since base_version were merged in
+	Nodes       datatypes.JSON `json:"nodes"`
+	Connections datatypes.JSON `json:"connections"`
+}
+
+// nodeConflict is a node changed differently by the editor and by someone else
+type nodeConflict struct {
+	NodeID string                 `json:"node_id"`
+	Server map[string]interface{} `json:"server"` // nil when deleted on the server
+	Client map[string]interface{} `json:"client"` // nil when deleted in the editor
+}
+
+// mergeConflictError aborts an autosave whose edits overlap with newer changes
+type mergeConflictError struct {
+	version   int
+	conflicts []nodeConflict
+}
+
+func (e *mergeConflictError) Error() string {
+	return "merge conflict"
+}
+
+// errBaseVersionUnavailable is returned when the editor's base version was pruned
+var errBaseVersionUnavailable = errors.New("base version is no longer available")
+
+// AutosaveProject saves the editor's workflow, merging it node by node with
+// changes saved since base_version. Nodes changed on only one side are taken
+// from that side; nodes changed on both sides are returned as a 409 so the
+// editor can resolve them.
+func AutosaveProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	repo = repo.WithContext(c.UserContext())
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	var body AutosavePayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if body.BaseVersion < 1 {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "base_version is required", nil)
+	}
+	if body.Nodes == nil {
+		body.Nodes = []map[string]interface{}{}
+	}
+	if body.Connections == nil {
+		body.Connections = []map[string]interface{}{}
+	}
+	if issues := workflowSizeIssues(len(body.Nodes), len(body.Connections)); len(issues) > 0 {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeWorkflowTooLarge, "workflow is too large", fiber.Map{"issues": issues})
+	}
+
+	// Snapshots never change, so the base can be read outside the row lock
+	var base *repository.ProjectVersion
+	if body.BaseVersion != project.Version {
+		if base, err = repo.GetVersion(project.ID.String(), body.BaseVersion); err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+		}
+	}
+
+	merged := false
+	updated, err := repo.UpdateLocked(project.ID.String(), func(p *repository.Project) error {
+		nodes, connections := body.Nodes, body.Connections
+		if p.Version != body.BaseVersion {
+			if base == nil {
+				// Another save landed between loading the project and taking the lock
+				v, err := repo.GetVersion(p.ID.String(), body.BaseVersion)
+				if err != nil {
+					return err
+				}
+				if v == nil {
+					return errBaseVersionUnavailable
+				}
+				base = v
+			}
+			baseNodes, baseConns := parseWorkflow(&repository.Project{Nodes: base.Nodes, Connections: base.Connections})
+			serverNodes, serverConns := parseWorkflow(p)
+
+			var conflicts []nodeConflict
+			nodes, conflicts = mergeByID(baseNodes, serverNodes, body.Nodes)
+			if len(conflicts) > 0 {
+				return &mergeConflictError{version: p.Version, conflicts: conflicts}
+			}
+			// Connections carry no editable content, so overlapping edits are
+			// resolved in the editor's favour rather than reported
+			connections, _ = mergeByID(baseConns, serverConns, body.Connections)
+			connections = dropDanglingConnections(nodes, connections)
+			merged = true
+		}
+
+		nodesJSON, _ := json.Marshal(nodes)
+		connectionsJSON, _ := json.Marshal(connections)
+		p.Nodes = datatypes.JSON(nodesJSON)
+		p.Connections = datatypes.JSON(connectionsJSON)
+		return nil
+	})
+	if err != nil {
+		var conflict *mergeConflictError
+		switch {
+		case errors.As(err, &conflict):
+			return response.Error(c, http.StatusConflict, response.ErrCodeMergeConflict, "changes conflict with a newer version", fiber.Map{
+				"version":   conflict.version,
+				"conflicts": conflict.conflicts,
+			})
+		case errors.Is(err, errBaseVersionUnavailable):
+			return response.Error(c, http.StatusConflict, response.ErrCodeBaseVersionUnavailable, "base version is no longer available", fiber.Map{"version": project.Version})
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	return c.JSON(AutosaveResponse{
+		Version:     updated.Version,
+		Merged:      merged,
+		Nodes:       updated.Nodes,
+		Connections: updated.Connections,
+	})
+}
+
+// mergeByID three-way merges lists of items keyed by their "id". Items changed
+// (or added, or removed) on one side only are taken from that side; items
+// changed differently on both sides are reported as conflicts. The result
+// keeps the client's order, followed by items only the server has.
+func mergeByID(base, server, client []map[string]interface{}) ([]map[string]interface{}, []nodeConflict) {
+	baseByID, serverByID, clientByID := indexByID(base), indexByID(server), indexByID(client)
+
+	merged := []map[string]interface{}{}
+	var conflicts []nodeConflict
+	seen := map[string]bool{}
+
+	resolve := func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+
+		b, s, m := baseByID[id], serverByID[id], clientByID[id]
+		var result map[string]interface{}
+		switch {
+		case sameItem(m, b):
+			result = s
+		case sameItem(s, b), sameItem(s, m):
+			result = m
+		default:
+			conflicts = append(conflicts, nodeConflict{NodeID: id, Server: s, Client: m})
+			return
+		}
+		if result != nil {
+			merged = append(merged, result)
+		}
+	}
+
+	for _, item := range client {
+		if id, _ := item["id"].(string); id != "" {
+			resolve(id)
+		}
+	}
+	for _, item := range server {
+		if id, _ := item["id"].(string); id != "" {
+			resolve(id)
+		}
+	}
+	// Items deleted on both sides, or only present in base, need no action
+	return merged, conflicts
+}
+
+// indexByID maps items by their "id" field
+func indexByID(items []map[string]interface{}) map[string]map[string]interface{} {
+	byID := make(map[string]map[string]interface{}, len(items))
+	for _, item := range items {
+		if id, _ := item["id"].(string); id != "" {
+			byID[id] = item
+		}
+	}
+	return byID
+}
+
+// sameItem reports whether two versions of an item are identical; two missing
+// items are the same
+func sameItem(a, b map[string]interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// dropDanglingConnections removes connections whose endpoints no longer exist
+func dropDanglingConnections(nodes, connections []map[string]interface{}) []map[string]interface{} {
+	ids := indexByID(nodes)
+	kept := []map[string]interface{}{}
+	for _, conn := range connections {
+		source, target := connectionEndpoints(conn)
+		if ids[source] != nil && ids[target] != nil {
+			kept = append(kept, conn)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// testNode is a text-output node labelled label
+func testNode(id, label string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "type": "text-output", "data": map[string]interface{}{"label": label}}
+}
+
+func TestMergeByID(t *testing.T) {
+	a, b, c := testNode("a", "A"), testNode("b", "B"), testNode("c", "C")
+	tests := []struct {
+		name          string
+		base          []map[string]interface{}
+		server        []map[string]interface{}
+		client        []map[string]interface{}
+		want          []map[string]interface{}
+		wantConflicts []string
+	}{
+		{
+			name:   "nothing changed",
+			base:   []map[string]interface{}{a, b},
+			server: []map[string]interface{}{a, b},
+			client: []map[string]interface{}{a, b},
+			want:   []map[string]interface{}{a, b},
+		},
+		{
+			name:   "edits to different nodes are both kept",
+			base:   []map[string]interface{}{a, b},
+			server: []map[string]interface{}{a, testNode("b", "B2")},
+			client: []map[string]interface{}{testNode("a", "A2"), b},
+			want:   []map[string]interface{}{testNode("a", "A2"), testNode("b", "B2")},
+		},
+		{
+			name:   "the same edit on both sides",
+			base:   []map[string]interface{}{a},
+			server: []map[string]interface{}{testNode("a", "A2")},
+			client: []map[string]interface{}{testNode("a", "A2")},
+			want:   []map[string]interface{}{testNode("a", "A2")},
+		},
+		{
+			name:          "different edits to the same node conflict",
+			base:          []map[string]interface{}{a, b},
+			server:        []map[string]interface{}{testNode("a", "server"), testNode("b", "B2")},
+			client:        []map[string]interface{}{testNode("a", "client"), b},
+			wantConflicts: []string{"a"},
+		},
+		{
+			name:   "nodes added on both sides are kept, the server's after the client's",
+			base:   []map[string]interface{}{a},
+			server: []map[string]interface{}{a, c},
+			client: []map[string]interface{}{a, b},
+			want:   []map[string]interface{}{a, b, c},
+		},
+		{
+			name:   "a node deleted on the server and untouched in the editor",
+			base:   []map[string]interface{}{a, b},
+			server: []map[string]interface{}{a},
+			client: []map[string]interface{}{a, b},
+			want:   []map[string]interface{}{a},
+		},
+		{
+			name:   "a node deleted in the editor and untouched on the server",
+			base:   []map[string]interface{}{a, b},
+			server: []map[string]interface{}{a, b},
+			client: []map[string]interface{}{b},
+			want:   []map[string]interface{}{b},
+		},
+		{
+			name:   "a node deleted on both sides",
+			base:   []map[string]interface{}{a, b},
+			server: []map[string]interface{}{a},
+			client: []map[string]interface{}{a},
+			want:   []map[string]interface{}{a},
+		},
+		{
+			name:          "a node deleted on the server but edited in the editor conflicts",
+			base:          []map[string]interface{}{a, b},
+			server:        []map[string]interface{}{a},
+			client:        []map[string]interface{}{a, testNode("b", "B2")},
+			wantConflicts: []string{"b"},
+		},
+		{
+			name:          "a node edited on the server but deleted in the editor conflicts",
+			base:          []map[string]interface{}{a, b},
+			server:        []map[string]interface{}{a, testNode("b", "B2")},
+			client:        []map[string]interface{}{a},
+			wantConflicts: []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := mergeByID(tt.base, tt.server, tt.client)
+			var conflictIDs []string
+			for _, conflict := range conflicts {
+				conflictIDs = append(conflictIDs, conflict.NodeID)
+			}
+			if !reflect.DeepEqual(conflictIDs, tt.wantConflicts) {
+				t.Fatalf("conflicts on %v, want %v", conflictIDs, tt.wantConflicts)
+			}
+			if len(tt.wantConflicts) > 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeByID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutosaveProject(t *testing.T) {
+	const (
+		v1Nodes = `[{"id":"a","type":"text-input","data":{"label":"A"}},{"id":"b","type":"text-output","data":{"label":"B"}}]`
+		// Someone else saved version 2, relabelling b
+		v2Nodes     = `[{"id":"a","type":"text-input","data":{"label":"A"}},{"id":"b","type":"text-output","data":{"label":"B from server"}}]`
+		connections = `[{"id":"c1","sourceNodeId":"a","targetNodeId":"b"}]`
+	)
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantMerged bool
+		// wantLabels are the labels of a and b once saved
+		wantLabels    []string
+		wantConflicts []nodeConflict
+	}{
+		{
+			name:       "saving on top of the current version",
+			body:       `{"base_version":2,"nodes":[{"id":"a","type":"text-input","data":{"label":"A2"}},{"id":"b","type":"text-output","data":{"label":"B from server"}}],"connections":` + connections + `}`,
+			wantStatus: http.StatusOK,
+			wantLabels: []string{"A2", "B from server"},
+		},
+		{
+			name:       "edits to other nodes merge cleanly",
+			body:       `{"base_version":1,"nodes":[{"id":"a","type":"text-input","data":{"label":"A2"}},{"id":"b","type":"text-output","data":{"label":"B"}}],"connections":` + connections + `}`,
+			wantStatus: http.StatusOK,
+			wantMerged: true,
+			wantLabels: []string{"A2", "B from server"},
+		},
+		{
+			name:       "a conflicting edit to the same node",
+			body:       `{"base_version":1,"nodes":[{"id":"a","type":"text-input","data":{"label":"A2"}},{"id":"b","type":"text-output","data":{"label":"B from editor"}}],"connections":` + connections + `}`,
+			wantStatus: http.StatusConflict,
+			wantCode:   response.ErrCodeMergeConflict,
+			wantLabels: []string{"A", "B from server"},
+			wantConflicts: []nodeConflict{{
+				NodeID: "b",
+				Server: map[string]interface{}{"id": "b", "type": "text-output", "data": map[string]interface{}{"label": "B from server"}},
+				Client: map[string]interface{}{"id": "b", "type": "text-output", "data": map[string]interface{}{"label": "B from editor"}},
+			}},
+		},
+		{
+			name:       "a base version that was pruned",
+			body:       `{"base_version":99,"nodes":[],"connections":[]}`,
+			wantStatus: http.StatusConflict,
+			wantCode:   response.ErrCodeBaseVersionUnavailable,
+			wantLabels: []string{"A", "B from server"},
+		},
+		{
+			name:       "no base version",
+			body:       `{"nodes":[],"connections":[]}`,
+			wantStatus: http.StatusBadRequest,
+			wantLabels: []string{"A", "B from server"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			repo := repository.NewProject(db)
+			owner := uuid.New()
+			project := createTestProject(t, owner, v1Nodes)
+			if err := db.Model(project).Update("connections", datatypes.JSON(connections)).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Create(&repository.ProjectVersion{ProjectID: project.ID, Version: 1, Nodes: datatypes.JSON(v1Nodes), Connections: datatypes.JSON(connections)}).Error; err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.UpdateLocked(project.ID.String(), func(p *repository.Project) error {
+				p.Nodes = datatypes.JSON(v2Nodes)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			resp := serveAs(t, owner.String(), "/projects/:id/autosave", func(c *fiber.Ctx) error {
+				return AutosaveProject(c, repo)
+			}, newRequest("PUT", "/projects/"+project.ID.String()+"/autosave", "application/json", strings.NewReader(tt.body)))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			switch tt.wantStatus {
+			case http.StatusOK:
+				var saved struct {
+					Version int  `json:"version"`
+					Merged  bool `json:"merged"`
+				}
+				if err := json.Unmarshal(body, &saved); err != nil {
+					t.Fatalf("response %s: %v", body, err)
+				}
+				if saved.Version != 3 || saved.Merged != tt.wantMerged {
+					t.Errorf("saved version %d merged %v, want version 3 merged %v", saved.Version, saved.Merged, tt.wantMerged)
+				}
+			case http.StatusConflict:
+				var errResp struct {
+					Code    string `json:"code"`
+					Details struct {
+						Version   int            `json:"version"`
+						Conflicts []nodeConflict `json:"conflicts"`
+					} `json:"details"`
+				}
+				if err := json.Unmarshal(body, &errResp); err != nil {
+					t.Fatalf("response %s: %v", body, err)
+				}
+				if errResp.Code != tt.wantCode || errResp.Details.Version != 2 {
+					t.Errorf("code %s at version %d, want %s at version 2", errResp.Code, errResp.Details.Version, tt.wantCode)
+				}
+				if !reflect.DeepEqual(errResp.Details.Conflicts, tt.wantConflicts) {
+					t.Errorf("conflicts = %v, want %v", errResp.Details.Conflicts, tt.wantConflicts)
+				}
+			}
+
+			stored, err := repo.GetByID(project.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := nodeDataByID(stored)
+			if got := []string{data["a"]["label"].(string), data["b"]["label"].(string)}; !reflect.DeepEqual(got, tt.wantLabels) {
+				t.Errorf("stored labels = %v, want %v", got, tt.wantLabels)
+			}
+			if _, conns := parseWorkflow(stored); len(conns) != 1 {
+				t.Errorf("stored %d connections, want 1", len(conns))
+			}
+		})
+	}
+}
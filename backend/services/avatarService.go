@@ -0,0 +1,123 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	maxAvatarBytes = 2 << 20 // 2 MB
+	avatarSize     = 256
+)
+
+// getAvatarStoragePath returns the directory avatars are stored in
+func getAvatarStoragePath() string {
+	path := os.Getenv("AVATAR_STORAGE_PATH")
+	if path == "" {
+		path = "./uploads/avatars"
+	}
+	return path
+}
+
+// avatarPath returns where the avatar of userID is stored
+func avatarPath(userID string) string {
+	return filepath.Join(getAvatarStoragePath(), userID+".jpg")
+}
+
+// UploadAvatar stores a JPEG or PNG profile picture for a user, cropped to a
+// square and resized to 256x256. Users may only change their own avatar unless
+// they are an admin.
+func UploadAvatar(c *fiber.Ctx, repo *repository.UserRepository) error {
+	id := c.Params("id")
+	if _, err := uuid.Parse(id); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user id", nil)
+	}
+
+	if callerID, ok := c.Locals("userID").(string); ok && callerID != id {
+		caller, err := repo.GetByID(callerID)
+		if err != nil || caller == nil || caller.Role != repository.RoleAdmin {
+			return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+		}
+	}
+
+	user, err := repo.GetByID(id)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if user == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
+	}
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "no avatar uploaded", nil)
+	}
+	src, err := readUploadedImage(file, maxAvatarBytes)
+	if err != nil {
+		switch {
+		case errors.Is(err, errImageTooLarge):
+			return response.Error(c, http.StatusRequestEntityTooLarge, response.ErrCodePayloadTooLarge, "avatar must be at most 2 MB", nil)
+		case errors.Is(err, errImageFormat):
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "avatar must be a JPEG or PNG image", nil)
+		}
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "failed to read avatar", nil)
+	}
+
+	if err := os.MkdirAll(getAvatarStoragePath(), 0755); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if err := saveResizedJPEG(avatarPath(id), src, avatarSize, avatarSize); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to save avatar", nil)
+	}
+
+	avatarURL := fmt.Sprintf("/api/v1/users/%s/avatar", id)
+	updated, err := repo.Update(id, map[string]interface{}{"avatar_url": avatarURL})
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "user.avatar_upload", "user", id, nil)
+
+	return c.JSON(updated)
+}
+
+// GetAvatar serves a user's uploaded avatar. Users without one are redirected
+// to the picture from their Google profile when available.
+func GetAvatar(c *fiber.Ctx, repo *repository.UserRepository) error {
+	id := c.Params("id")
+	user, err := repo.GetByID(id)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if user == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+
+	if user.AvatarURL != "" {
+		path := avatarPath(user.ID.String())
+		if _, err := os.Stat(path); err == nil {
+			c.Type("jpg")
+			return c.SendFile(path)
+		}
+	}
+
+	var info map[string]interface{}
+	if len(user.Info) > 0 && json.Unmarshal(user.Info, &info) == nil {
+		if picture, ok := info["picture"].(string); ok && picture != "" {
+			return c.Redirect(picture, http.StatusFound)
+		}
+	}
+
+	return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "no avatar", nil)
+}
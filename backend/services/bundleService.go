@@ -0,0 +1,604 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"manju/backend/events"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/storage"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"gorm.io/datatypes"
+)
+
+// BundleSchemaVersion is the current version of the project export format
+const BundleSchemaVersion = 1
+
+// ProjectBundle is the portable export format of a project
+type ProjectBundle struct {
+	SchemaVersion int                      `json:"schema_version" yaml:"schema_version"`
+	ExportedAt    time.Time                `json:"exported_at" yaml:"exported_at"`
+	Name          string                   `json:"name" yaml:"name"`
+	Description   string                   `json:"description" yaml:"description"`
+	ProjectID     string                   `json:"project_id,omitempty" yaml:"project_id,omitempty"` // Documents are copied from it when missing
+	Nodes         []map[string]interface{} `json:"nodes" yaml:"nodes"`
+	Connections   []map[string]interface{} `json:"connections" yaml:"connections"`
+	Documents     []BundleDocument         `json:"documents,omitempty" yaml:"documents,omitempty"`
+}
+
+// BundleDocument is a document embedded in a project bundle
+type BundleDocument struct {
+	ID      string `json:"id" yaml:"id"`
+	Name    string `json:"name" yaml:"name"`
+	Type    string `json:"type" yaml:"type"`
+	Size    int64  `json:"size" yaml:"size"`
+	Content []byte `json:"content,omitempty" yaml:"content,omitempty"` // base64 in JSON and YAML
+}
+
+// yamlBundleDocument is BundleDocument as written to YAML, which would
+// otherwise list the content byte by byte
+type yamlBundleDocument struct {
+	ID      string `yaml:"id"`
+	Name    string `yaml:"name"`
+	Type    string `yaml:"type"`
+	Size    int64  `yaml:"size"`
+	Content string `yaml:"content,omitempty"`
+}
+
+// MarshalYAML writes the content base64-encoded, as in JSON
+func (d BundleDocument) MarshalYAML() (interface{}, error) {
+	return yamlBundleDocument{d.ID, d.Name, d.Type, d.Size, base64.StdEncoding.EncodeToString(d.Content)}, nil
+}
+
+// UnmarshalYAML reads base64-encoded content
+func (d *BundleDocument) UnmarshalYAML(value *yaml.Node) error {
+	var y yamlBundleDocument
+	if err := value.Decode(&y); err != nil {
+		return err
+	}
+	content, err := base64.StdEncoding.DecodeString(y.Content)
+	if err != nil {
+		return fmt.Errorf("document %q: content is not base64", y.Name)
+	}
+	*d = BundleDocument{ID: y.ID, Name: y.Name, Type: y.Type, Size: y.Size, Content: content}
+	return nil
+}
+
+// getMaxImportBundleBytes returns the maximum accepted bundle size
+func getMaxImportBundleBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("MAX_IMPORT_BUNDLE_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 20 * 1024 * 1024
+}
+
+// isYAMLContentType reports whether a Content-Type names a YAML document
+func isYAMLContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case "text/yaml", "application/yaml", "application/x-yaml", "text/x-yaml":
+		return true
+	}
+	return false
+}
+
+// unmarshalBundle decodes a bundle from YAML or JSON
+func unmarshalBundle(data []byte, isYAML bool, bundle *ProjectBundle) error {
+	if !isYAML {
+		return json.Unmarshal(data, bundle)
+	}
+	if err := yaml.Unmarshal(data, bundle); err != nil {
+		return err
+	}
+	// YAML decodes whole numbers as ints, but the workflow is validated and
+	// stored as JSON decodes it, with float64 numbers
+	for _, v := range []*[]map[string]interface{}{&bundle.Nodes, &bundle.Connections} {
+		raw, err := json.Marshal(*v)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(raw, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportProject returns a project as a portable bundle, in JSON or, with
+// ?format=yaml, YAML
+func ExportProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	project, err := repo.GetByID(c.Params("id"))
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	}
+
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+	}
+
+	format := strings.ToLower(c.Query("format", "json"))
+	if format != "json" && format != "yaml" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "format must be json or yaml", nil)
+	}
+
+	bundle, err := buildProjectBundle(project, c.QueryBool("include_documents"))
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"project-%s.%s\"", project.ID, format))
+	if format == "yaml" {
+		out, err := yaml.Marshal(bundle)
+		if err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+		}
+		c.Set(fiber.HeaderContentType, "text/yaml; charset=utf-8")
+		return c.Send(out)
+	}
+	return c.JSON(bundle)
+}
+
+// buildProjectBundle converts a project (and optionally its documents) into a bundle
+func buildProjectBundle(project *repository.Project, includeDocuments bool) (*ProjectBundle, error) {
+	nodes, connections := parseWorkflow(project)
+	bundle := &ProjectBundle{
+		SchemaVersion: BundleSchemaVersion,
+		ExportedAt:    time.Now(),
+		Name:          project.Name,
+		Description:   project.Description,
+		ProjectID:     project.ID.String(),
+		Nodes:         nodes,
+		Connections:   connections,
+	}
+
+	if !includeDocuments {
+		return bundle, nil
+	}
+
+	docs, err := repository.NewDocument(repository.GetDB()).ListByProject(project.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		if doc.DeletedAt != nil {
+			continue
+		}
+		content, err := readDocumentFile(doc.StoredPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read document %s: %w", doc.Name, err)
+		}
+		ext := filepath.Ext(doc.StoredPath)
+		bundle.Documents = append(bundle.Documents, BundleDocument{
+			ID:      doc.ID,
+			Name:    doc.Name,
+			Type:    strings.TrimPrefix(ext, "."),
+			Size:    int64(len(content)),
+			Content: content,
+		})
+	}
+	return bundle, nil
+}
+
+// readDocumentFile reads a stored document file into memory
+func readDocumentFile(key string) ([]byte, error) {
+	r, err := documentStorage.Open(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// ImportResponse is the response of POST /projects/import
+type ImportResponse struct {
+	Project  *repository.Project `json:"project"`
+	Warnings []string            `json:"warnings"`
+}
+
+// ImportProject creates a new project for the caller from an export bundle.
+// It accepts either a JSON or YAML body (by Content-Type) or a multipart form
+// with a "bundle" field and optional "documents" files.
+func ImportProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	userID, err := uuid.Parse(userIDStr.(string))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user id", nil)
+	}
+
+	maxBytes := getMaxImportBundleBytes()
+	if int64(len(c.Body())) > maxBytes {
+		return response.Error(c, http.StatusRequestEntityTooLarge, response.ErrCodePayloadTooLarge, "bundle too large", fiber.Map{
+			"max_bytes": maxBytes,
+		})
+	}
+
+	var bundle ProjectBundle
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		if err := parseMultipartBundle(c, &bundle); err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+		}
+	} else if err := unmarshalBundle(c.Body(), isYAMLContentType(c.Get(fiber.HeaderContentType)), &bundle); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid bundle", nil)
+	}
+
+	if errs := validateBundle(&bundle); len(errs) > 0 {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeValidation, "invalid bundle", fiber.Map{
+			"errors": errs,
+		})
+	}
+
+	// A bundle exported without its documents takes them from its project
+	var source *repository.Project
+	if len(bundle.Documents) == 0 && bundle.ProjectID != "" {
+		if p, err := repo.GetByID(bundle.ProjectID); err == nil && canAccess(repo, p, userID.String(), accessViewer) {
+			source = p
+		}
+	}
+
+	project, warnings, err := createProjectFromBundle(repo, userID, &bundle, source)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.import", "project", project.ID.String(), fiber.Map{"name": project.Name})
+	events.Publish(events.ProjectSaved{ProjectID: project.ID.String(), UserID: userID.String(), Created: true, At: time.Now()})
+
+	return c.Status(http.StatusCreated).JSON(ImportResponse{Project: project, Warnings: warnings})
+}
+
+// parseMultipartBundle reads the "bundle" field and attached "documents" files
+func parseMultipartBundle(c *fiber.Ctx, bundle *ProjectBundle) error {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return fmt.Errorf("invalid multipart form")
+	}
+
+	// A bundle file is YAML by its Content-Type or extension; a field by its content
+	var raw []byte
+	isYAML := false
+	if values := form.Value["bundle"]; len(values) > 0 {
+		raw = []byte(values[0])
+		isYAML = !json.Valid(raw)
+	} else if files := form.File["bundle"]; len(files) > 0 {
+		ext := strings.ToLower(filepath.Ext(files[0].Filename))
+		isYAML = isYAMLContentType(files[0].Header.Get(fiber.HeaderContentType)) || ext == ".yaml" || ext == ".yml"
+		f, err := files[0].Open()
+		if err != nil {
+			return fmt.Errorf("failed to read bundle")
+		}
+		defer f.Close()
+		if raw, err = io.ReadAll(f); err != nil {
+			return fmt.Errorf("failed to read bundle")
+		}
+	} else {
+		return fmt.Errorf("bundle is required")
+	}
+
+	if err := unmarshalBundle(raw, isYAML, bundle); err != nil {
+		return fmt.Errorf("invalid bundle")
+	}
+
+	// Attached files fill in bundle documents by name, or are added as new documents
+	for _, fh := range form.File["documents"] {
+		f, err := fh.Open()
+		if err != nil {
+			return fmt.Errorf("failed to read document %s", fh.Filename)
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read document %s", fh.Filename)
+		}
+
+		matched := false
+		for i := range bundle.Documents {
+			if bundle.Documents[i].Name == fh.Filename && len(bundle.Documents[i].Content) == 0 {
+				bundle.Documents[i].Content = content
+				bundle.Documents[i].Size = int64(len(content))
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			bundle.Documents = append(bundle.Documents, BundleDocument{
+				ID:      fmt.Sprintf("doc-%s", uuid.New().String()[:8]),
+				Name:    fh.Filename,
+				Type:    strings.TrimPrefix(filepath.Ext(fh.Filename), "."),
+				Size:    int64(len(content)),
+				Content: content,
+			})
+		}
+	}
+	return nil
+}
+
+// validateBundle checks the schema version, workflow structure and document types
+func validateBundle(bundle *ProjectBundle) []ValidationError {
+	errs := []ValidationError{}
+
+	if bundle.SchemaVersion != BundleSchemaVersion {
+		errs = append(errs, ValidationError{
+			Path:    "schema_version",
+			Message: fmt.Sprintf("unsupported schema version %d (expected %d)", bundle.SchemaVersion, BundleSchemaVersion),
+		})
+	}
+	if strings.TrimSpace(bundle.Name) == "" {
+		errs = append(errs, ValidationError{Path: "name", Message: "name is required"})
+	}
+
+	for _, issue := range workflowSizeIssues(len(bundle.Nodes), len(bundle.Connections)) {
+		errs = append(errs, ValidationError{Path: "nodes", Message: issue})
+	}
+
+	errs = append(errs, workflowSchemaErrors(bundle.Nodes, bundle.Connections)...)
+
+	for i, doc := range bundle.Documents {
+		if !allowedDocumentExt("." + doc.Type) {
+			errs = append(errs, ValidationError{Path: fmt.Sprintf("documents[%d].type", i), Message: fmt.Sprintf("unsupported document type %q", doc.Type)})
+		}
+	}
+
+	return errs
+}
+
+// createProjectFromBundle stores a validated bundle as a new project owned by userID.
+// All node, connection and document IDs are regenerated. With a source
+// project, its documents are copied in place of the bundle's.
+func createProjectFromBundle(repo *repository.ProjectRepository, userID uuid.UUID, bundle *ProjectBundle, source *repository.Project) (*repository.Project, []string, error) {
+	warnings := []string{}
+	nodes := bundle.Nodes
+	connections := bundle.Connections
+	if nodes == nil {
+		nodes = []map[string]interface{}{}
+	}
+	if connections == nil {
+		connections = []map[string]interface{}{}
+	}
+	nodeIDs := regenerateWorkflowIDs(nodes, connections)
+
+	project := &repository.Project{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Name:        bundle.Name,
+		Description: bundle.Description,
+		Status:      repository.ProjectStatusDraft,
+	}
+
+	// Write documents first so the node data can reference the new IDs
+	docIDs := map[string]string{}
+	docDir := projectDocumentDir(project)
+	var docs []repository.Document
+	for _, doc := range bundle.Documents {
+		if len(doc.Content) == 0 {
+			warnings = append(warnings, fmt.Sprintf("document %q has no content and was skipped", doc.Name))
+			continue
+		}
+		newID := fmt.Sprintf("doc-%s", uuid.New().String()[:8])
+		ext := "." + strings.ToLower(doc.Type)
+		filename := documentFileName(newID, 1, ext)
+		if err := documentStorage.Save(context.Background(), filepath.Join(docDir, filename), bytes.NewReader(doc.Content), int64(len(doc.Content))); err != nil {
+			storage.DeletePrefix(context.Background(), documentStorage, docDir)
+			return nil, nil, fmt.Errorf("failed to write document %s: %w", doc.Name, err)
+		}
+		docIDs[doc.ID] = newID
+		docs = append(docs, repository.Document{
+			ID:          newID,
+			ProjectID:   project.ID,
+			UserID:      userID,
+			Name:        doc.Name,
+			StoredPath:  filepath.Join(docDir, filename),
+			Size:        int64(len(doc.Content)),
+			ContentType: documentMIMEType(ext),
+			Status:      "ready",
+			ContentHash: fmt.Sprintf("%x", sha256.Sum256(doc.Content)),
+		})
+	}
+
+	// Point rag-documents nodes at the new document IDs; copying the source
+	// project's documents does so once the project exists
+	if source == nil {
+		for _, oldID := range remapNodeDocuments(nodes, docIDs) {
+			warnings = append(warnings, fmt.Sprintf("document %q is referenced by a node but was not included", oldID))
+		}
+	}
+
+	nodesJSON, err := json.Marshal(nodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	connectionsJSON, err := json.Marshal(connections)
+	if err != nil {
+		return nil, nil, err
+	}
+	project.Nodes = datatypes.JSON(nodesJSON)
+	project.Connections = datatypes.JSON(connectionsJSON)
+
+	created, err := repo.Create(project)
+	if err != nil {
+		storage.DeletePrefix(context.Background(), documentStorage, docDir)
+		return nil, nil, err
+	}
+	if err := repository.NewDocument(repository.GetDB()).CreateMissing(docs); err != nil {
+		repo.Delete(created.ID.String())
+		storage.DeletePrefix(context.Background(), documentStorage, docDir)
+		return nil, nil, fmt.Errorf("failed to store documents: %w", err)
+	}
+	if source != nil {
+		if err := CopyProjectDocuments(source.UserID, source.ID, userID, created.ID, nodeIDs); err != nil {
+			repo.Delete(created.ID.String())
+			return nil, nil, fmt.Errorf("failed to copy documents: %w", err)
+		}
+		if created, err = repo.GetByID(created.ID.String()); err != nil {
+			return nil, nil, err
+		}
+	}
+	return created, warnings, nil
+}
+
+const (
+	bundleFetchTimeout  = 10 * time.Second
+	maxBundleFetchBytes = 5 << 20 // 5 MB
+)
+
+// errBundleURL is returned for source URLs that may not be fetched
+var errBundleURL = errors.New("source_url must be a public http(s) URL")
+
+// nonPublicNetworks are the IANA special-purpose ranges that are not
+// globally reachable, plus multicast and the IPv6 ranges that tunnel to IPv4
+// addresses. IPv4-mapped IPv6 addresses are checked as the IPv4 address.
+var nonPublicNetworks = func() []*net.IPNet {
+	cidrs := []string{
+		// IPv4
+		"0.0.0.0/8",       // this network
+		"10.0.0.0/8",      // private
+		"100.64.0.0/10",   // carrier-grade NAT
+		"127.0.0.0/8",     // loopback
+		"169.254.0.0/16",  // link local
+		"172.16.0.0/12",   // private
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // documentation
+		"192.88.99.0/24",  // 6to4 relay anycast
+		"192.168.0.0/16",  // private
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"224.0.0.0/4",     // multicast
+		"240.0.0.0/4",     // reserved, including broadcast
+		// IPv6
+		"::/96",          // unspecified, loopback and IPv4-compatible
+		"64:ff9b::/96",   // NAT64
+		"64:ff9b:1::/48", // local NAT64
+		"100::/64",       // discard
+		"2001::/23",      // IETF protocol assignments, including Teredo
+		"2001:db8::/32",  // documentation
+		"2002::/16",      // 6to4
+		"3fff::/20",      // documentation
+		"5f00::/16",      // segment routing
+		"fc00::/7",       // unique local
+		"fe80::/10",      // link local
+		"fec0::/10",      // site local
+		"ff00::/8",       // multicast
+	}
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}()
+
+// isPublicIP reports whether ip is routable on the public internet
+func isPublicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// errNonPublicAddress is returned by publicDialContext for hosts that resolve
+// to an address that is not public
+var errNonPublicAddress = errors.New("host does not resolve to a public address")
+
+// publicDialContext resolves the host itself and only connects to public
+// addresses. Dialing the checked IP (rather than the hostname) keeps a DNS
+// answer that changes between check and connect from reaching internal hosts.
+func publicDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip.IP) {
+			return nil, errNonPublicAddress
+		}
+	}
+	dialer := &net.Dialer{Timeout: bundleFetchTimeout}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+}
+
+// bundleFetchClient fetches workflow bundles from user-supplied URLs
+var bundleFetchClient = &http.Client{
+	Timeout:   bundleFetchTimeout,
+	Transport: &http.Transport{DialContext: publicDialContext, Proxy: nil},
+}
+
+// fetchBundleFromURL downloads a project bundle (JSON) from a public URL
+func fetchBundleFromURL(ctx context.Context, rawURL string) (*ProjectBundle, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errBundleURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errBundleURL
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := bundleFetchClient.Do(req)
+	if err != nil {
+		if errors.Is(err, errNonPublicAddress) {
+			return nil, errBundleURL
+		}
+		return nil, fmt.Errorf("failed to fetch source_url: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("source_url returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBundleFetchBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source_url: %w", err)
+	}
+	if len(data) > maxBundleFetchBytes {
+		return nil, fmt.Errorf("source_url response exceeds %d bytes", maxBundleFetchBytes)
+	}
+
+	var bundle ProjectBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("source_url did not return a valid bundle: %w", err)
+	}
+	return &bundle, nil
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	roundTripNodes = `[
+		{"id":"node-1","type":"text-input","position":{"x":0,"y":0},"data":{"label":"Question"}},
+		{"id":"node-2","type":"rag-documents","position":{"x":200,"y":0},"data":{"documents":[{"id":"doc-1","name":"handbook.txt"}]}},
+		{"id":"node-3","type":"ai-model","position":{"x":400,"y":0},"data":{"modelName":"gpt-4o-mini","temperature":0.2}}
+	]`
+	roundTripConnections = `[
+		{"id":"conn-1","sourceNodeId":"node-1","targetNodeId":"node-2"},
+		{"id":"conn-2","sourceNodeId":"node-2","targetNodeId":"node-3"}
+	]`
+)
+
+// workflowShape is a workflow with every generated ID replaced by its
+// position, so workflows differing only in IDs compare equal
+func workflowShape(t *testing.T, nodesJSON, connectionsJSON []byte, docNames map[string]string) ([]map[string]interface{}, []map[string]interface{}) {
+	t.Helper()
+	var nodes, connections []map[string]interface{}
+	if err := json.Unmarshal(nodesJSON, &nodes); err != nil {
+		t.Fatalf("nodes: %v", err)
+	}
+	if err := json.Unmarshal(connectionsJSON, &connections); err != nil {
+		t.Fatalf("connections: %v", err)
+	}
+	index := map[string]string{}
+	for i, node := range nodes {
+		index[node["id"].(string)] = "node-" + string(rune('a'+i))
+		node["id"] = index[node["id"].(string)]
+		if docs, ok := nodeData(node)["documents"].([]interface{}); ok {
+			for _, d := range docs {
+				doc := d.(map[string]interface{})
+				doc["id"] = docNames[doc["id"].(string)]
+			}
+		}
+	}
+	for _, conn := range connections {
+		source, target := connectionEndpoints(conn)
+		conn["id"] = ""
+		conn["sourceNodeId"], conn["targetNodeId"] = index[source], index[target]
+	}
+	return nodes, connections
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+	}{
+		{name: "JSON", query: "?include_documents=true", contentType: "application/json"},
+		{name: "YAML", query: "?include_documents=true&format=yaml", contentType: "text/yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, &repository.Project{}, &repository.ProjectVersion{}, &repository.Document{}, &repository.AuditLog{})
+			useTestStorage(t)
+
+			owner := uuid.New()
+			source := repository.Project{
+				ID:          uuid.New(),
+				UserID:      owner,
+				Name:        "Support bot",
+				Description: "Answers from the handbook",
+				Status:      repository.ProjectStatusDraft,
+				Nodes:       datatypes.JSON(roundTripNodes),
+				Connections: datatypes.JSON(roundTripConnections),
+			}
+			if err := db.Create(&source).Error; err != nil {
+				t.Fatalf("create project: %v", err)
+			}
+			content := []byte("Refunds are issued within 14 days.")
+			stored := filepath.Join(projectDocumentDir(&source), "doc-1_20260101000000.txt")
+			if err := os.MkdirAll(filepath.Dir(stored), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(stored, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Create(&repository.Document{ID: "doc-1", ProjectID: source.ID, UserID: owner, Name: "handbook.txt", StoredPath: stored, Size: int64(len(content))}).Error; err != nil {
+				t.Fatalf("create document: %v", err)
+			}
+
+			exported := serveAs(t, owner.String(), "/projects/:id/export", func(c *fiber.Ctx) error {
+				return ExportProject(c, repository.NewProject(db))
+			}, newRequest("GET", "/projects/"+source.ID.String()+"/export"+tt.query, "", nil))
+			if exported.StatusCode != http.StatusOK {
+				t.Fatalf("export status = %d: %s", exported.StatusCode, readBody(t, exported))
+			}
+			bundle := readBody(t, exported)
+
+			// Another user imports it, so the copy must not depend on the source
+			importer := uuid.New()
+			imported := serveAs(t, importer.String(), "/projects/import", func(c *fiber.Ctx) error {
+				return ImportProject(c, repository.NewProject(db))
+			}, newRequest("POST", "/projects/import", tt.contentType, bytes.NewReader(bundle)))
+			body := readBody(t, imported)
+			if imported.StatusCode != http.StatusCreated {
+				t.Fatalf("import status = %d: %s", imported.StatusCode, body)
+			}
+			var result struct {
+				Project  repository.Project `json:"project"`
+				Warnings []string           `json:"warnings"`
+			}
+			if err := json.Unmarshal(body, &result); err != nil {
+				t.Fatalf("import response: %v", err)
+			}
+			copied := result.Project
+			if len(result.Warnings) != 0 {
+				t.Errorf("warnings = %v, want none", result.Warnings)
+			}
+			if copied.ID == source.ID || copied.UserID != importer {
+				t.Errorf("imported project %s of %s, want a new project of the importer %s", copied.ID, copied.UserID, importer)
+			}
+			if copied.Name != source.Name || copied.Description != source.Description {
+				t.Errorf("imported %q %q, want %q %q", copied.Name, copied.Description, source.Name, source.Description)
+			}
+
+			docs, err := repository.NewDocument(db).ListByProject(copied.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(docs) != 1 {
+				t.Fatalf("imported %d documents, want 1", len(docs))
+			}
+			doc := docs[0]
+			if doc.ID == "doc-1" || doc.Name != "handbook.txt" || doc.UserID != importer {
+				t.Errorf("imported document %s %q of %s, want a new ID for handbook.txt of the importer", doc.ID, doc.Name, doc.UserID)
+			}
+			if !strings.HasPrefix(doc.StoredPath, projectDocumentDir(&copied)) {
+				t.Errorf("document stored at %s, want it under %s", doc.StoredPath, projectDocumentDir(&copied))
+			}
+			if got, err := os.ReadFile(doc.StoredPath); err != nil || !bytes.Equal(got, content) {
+				t.Errorf("document content = %q (%v), want %q", got, err, content)
+			}
+
+			// Every ID is new, and the workflow is otherwise the same
+			for _, id := range []string{"node-1", "node-2", "node-3", "conn-1", "conn-2", "doc-1"} {
+				if bytes.Contains(copied.Nodes, []byte(`"`+id+`"`)) || bytes.Contains(copied.Connections, []byte(`"`+id+`"`)) {
+					t.Errorf("imported workflow still uses the ID %s", id)
+				}
+			}
+			wantNodes, wantConnections := workflowShape(t, source.Nodes, source.Connections, map[string]string{"doc-1": "handbook.txt"})
+			gotNodes, gotConnections := workflowShape(t, copied.Nodes, copied.Connections, map[string]string{doc.ID: "handbook.txt"})
+			if !reflect.DeepEqual(gotNodes, wantNodes) {
+				t.Errorf("imported nodes = %v, want %v", gotNodes, wantNodes)
+			}
+			if !reflect.DeepEqual(gotConnections, wantConnections) {
+				t.Errorf("imported connections = %v, want %v", gotConnections, wantConnections)
+			}
+		})
+	}
+}
+
+func TestImportProjectRejectsInvalidBundles(t *testing.T) {
+	node := func(nodeType string) string {
+		return `{"id":"n1","type":"` + nodeType + `","position":{"x":0,"y":0},"data":{}}`
+	}
+	tests := []struct {
+		name       string
+		maxBytes   string
+		bundle     string
+		wantStatus int
+		wantPaths  []string
+	}{
+		{
+			name:       "unsupported schema version",
+			bundle:     `{"schema_version":2,"name":"p","nodes":[` + node("text-input") + `]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantPaths:  []string{"schema_version"},
+		},
+		{
+			name:       "unknown node type",
+			bundle:     `{"schema_version":1,"name":"p","nodes":[` + node("shell-command") + `]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantPaths:  []string{"nodes[0].type"},
+		},
+		{
+			name:       "every invalid item is reported",
+			bundle:     `{"schema_version":1,"name":"","nodes":[` + node("shell-command") + `],"documents":[{"id":"d","name":"x.exe","type":"exe","content":"eA=="}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantPaths:  []string{"name", "nodes[0].type", "documents[0].type"},
+		},
+		{
+			name:       "bundle over the size limit",
+			maxBytes:   "64",
+			bundle:     `{"schema_version":1,"name":"a project with a name long enough","nodes":[` + node("text-input") + `]}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "not a bundle",
+			bundle:     `[1, 2`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, &repository.Project{}, &repository.ProjectVersion{})
+			t.Setenv("MAX_IMPORT_BUNDLE_BYTES", tt.maxBytes)
+
+			resp := serveAs(t, uuid.NewString(), "/projects/import", func(c *fiber.Ctx) error {
+				return ImportProject(c, repository.NewProject(db))
+			}, newRequest("POST", "/projects/import", "application/json", strings.NewReader(tt.bundle)))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			var errResp struct {
+				Details struct {
+					Errors []ValidationError `json:"errors"`
+				} `json:"details"`
+			}
+			if err := json.Unmarshal(body, &errResp); err != nil {
+				t.Fatalf("error response: %v", err)
+			}
+			var paths []string
+			for _, e := range errResp.Details.Errors {
+				paths = append(paths, e.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("error paths = %v, want %v", paths, tt.wantPaths)
+			}
+
+			var count int64
+			db.Model(&repository.Project{}).Count(&count)
+			if count != 0 {
+				t.Errorf("%d projects created, want none", count)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"198.20.0.1", true},
+		{"223.255.255.255", true},
+		{"2606:4700:4700::1111", true},
+		{"::ffff:8.8.8.8", true},
+		{"0.0.0.0", false},
+		{"10.1.2.3", false},
+		{"100.64.0.1", false},       // carrier-grade NAT
+		{"100.127.255.255", false},  // carrier-grade NAT
+		{"127.0.0.1", false},        // loopback
+		{"169.254.169.254", false},  // cloud metadata
+		{"172.16.0.1", false},       // private
+		{"192.0.0.170", false},      // NAT64 discovery
+		{"192.0.2.1", false},        // documentation
+		{"192.168.1.1", false},      // private
+		{"198.18.0.1", false},       // benchmarking
+		{"198.19.255.255", false},   // benchmarking
+		{"203.0.113.9", false},      // documentation
+		{"224.0.0.1", false},        // multicast
+		{"240.0.0.1", false},        // reserved
+		{"255.255.255.255", false},  // broadcast
+		{"::", false},               // unspecified
+		{"::1", false},              // loopback
+		{"::ffff:127.0.0.1", false}, // IPv4-mapped loopback
+		{"::ffff:10.0.0.1", false},  // IPv4-mapped private
+		{"::7f00:1", false},         // IPv4-compatible loopback
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b:1::a00:1", false},
+		{"2001::1", false}, // Teredo
+		{"2001:db8::1", false},
+		{"2002:7f00:1::", false}, // 6to4 of 127.0.0.1
+		{"2002:a9fe:a9fe::", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"fe80::1", false},
+		{"ff02::1", false},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		if ip == nil {
+			t.Fatalf("bad test address %s", tt.ip)
+		}
+		if got := isPublicIP(ip); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			if got := isPublicIP(v4); got != tt.want {
+				t.Errorf("isPublicIP(%s as 4 bytes) = %v, want %v", tt.ip, got, tt.want)
+			}
+		}
+	}
+	if isPublicIP(nil) {
+		t.Error("isPublicIP(nil) = true, want false")
+	}
+}
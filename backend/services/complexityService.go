@@ -0,0 +1,162 @@
+package services
+
+import (
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ComplexityReport scores how hard a workflow is to follow and maintain
+type ComplexityReport struct {
+	NodeCount       int    `json:"node_count"`
+	ConnectionCount int    `json:"connection_count"`
+	MaxDepth        int    `json:"max_depth"`    // levels from an input node to the furthest node
+	BranchCount     int    `json:"branch_count"` // nodes with more than one outgoing connection
+	HasLoops        bool   `json:"has_loops"`
+	Score           int    `json:"score"`
+	Grade           string `json:"grade"` // "A" (simple) to "F"
+}
+
+// Weights of the complexity score
+const (
+	complexityNodeWeight   = 2
+	complexityDepthWeight  = 3
+	complexityBranchWeight = 5
+	complexityLoopPenalty  = 20
+)
+
+// complexityGrades maps the highest score of each grade; anything above the
+// last one is an F
+var complexityGrades = []struct {
+	maxScore int
+	grade    string
+}{
+	{30, "A"},
+	{60, "B"},
+	{90, "C"},
+	{120, "D"},
+}
+
+// GetProjectComplexity analyses a project's graph and returns its complexity
+// report. It is computed locally, without the AI service.
+func GetProjectComplexity(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+	nodes, connections := parseWorkflow(project)
+	return c.JSON(workflowComplexity(nodes, connections))
+}
+
+// workflowComplexity computes the complexity report of a workflow graph.
+// Connections to nodes that don't exist are ignored.
+func workflowComplexity(nodes, connections []map[string]interface{}) ComplexityReport {
+	report := ComplexityReport{NodeCount: len(nodes), ConnectionCount: len(connections)}
+
+	ids := make([]string, 0, len(nodes))
+	known := map[string]bool{}
+	var inputs []string
+	for _, node := range nodes {
+		id, _ := node["id"].(string)
+		nodeType, _ := node["type"].(string)
+		ids = append(ids, id)
+		known[id] = true
+		if isInputNodeType(nodeType) {
+			inputs = append(inputs, id)
+		}
+	}
+
+	outgoing := map[string][]string{}
+	hasIncoming := map[string]bool{}
+	for _, conn := range connections {
+		source, target := connectionEndpoints(conn)
+		if !known[source] || !known[target] {
+			continue
+		}
+		outgoing[source] = append(outgoing[source], target)
+		hasIncoming[target] = true
+	}
+	for _, targets := range outgoing {
+		if len(targets) > 1 {
+			report.BranchCount++
+		}
+	}
+
+	// Without input nodes, measure from the nodes nothing leads into
+	if len(inputs) == 0 {
+		for _, id := range ids {
+			if !hasIncoming[id] {
+				inputs = append(inputs, id)
+			}
+		}
+	}
+	report.MaxDepth = graphDepth(inputs, outgoing)
+	report.HasLoops = graphHasCycle(ids, outgoing)
+
+	report.Score = report.NodeCount*complexityNodeWeight +
+		report.MaxDepth*complexityDepthWeight +
+		report.BranchCount*complexityBranchWeight
+	if report.HasLoops {
+		report.Score += complexityLoopPenalty
+	}
+	report.Grade = "F"
+	for _, g := range complexityGrades {
+		if report.Score <= g.maxScore {
+			report.Grade = g.grade
+			break
+		}
+	}
+	return report
+}
+
+// graphDepth returns the number of BFS levels reachable from the start
+// nodes, counting the start nodes as the first level
+func graphDepth(start []string, edges map[string][]string) int {
+	depth := map[string]int{}
+	queue := []string{}
+	for _, id := range start {
+		if _, seen := depth[id]; !seen {
+			depth[id] = 1
+			queue = append(queue, id)
+		}
+	}
+	maxDepth := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if depth[id] > maxDepth {
+			maxDepth = depth[id]
+		}
+		for _, next := range edges[id] {
+			if _, seen := depth[next]; !seen {
+				depth[next] = depth[id] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	return maxDepth
+}
+
+// graphHasCycle reports whether following edges from any node can lead back
+// to it, by DFS keeping the nodes on the current path
+func graphHasCycle(ids []string, edges map[string][]string) bool {
+	visited := map[string]bool{}
+	onPath := map[string]bool{}
+	var visit func(id string) bool
+	visit = func(id string) bool {
+		visited[id], onPath[id] = true, true
+		for _, next := range edges[id] {
+			if onPath[next] || (!visited[next] && visit(next)) {
+				return true
+			}
+		}
+		onPath[id] = false
+		return false
+	}
+	for _, id := range ids {
+		if !visited[id] && visit(id) {
+			return true
+		}
+	}
+	return false
+}
@@ -8,10 +8,21 @@ import (
 	"errors"
 	"io"
 	"os"
+	"strconv"
 )
 
 var encryptionKey []byte
 
+// encryptionKeyVersion identifies encryptionKey. Bump ENCRYPTION_KEY_VERSION
+// together with ENCRYPTION_KEY when rotating so stored values can be migrated.
+var encryptionKeyVersion = 1
+
+// oldEncryptionKey is the previous key (OLD_ENCRYPTION_KEY), only set during a rotation
+var oldEncryptionKey []byte
+
+// errNoOldEncryptionKey is returned when old ciphertext is found but OLD_ENCRYPTION_KEY is unset
+var errNoOldEncryptionKey = errors.New("OLD_ENCRYPTION_KEY is not set")
+
 func init() {
 	// Load encryption key from environment
 	keyHex := os.Getenv("ENCRYPTION_KEY")
@@ -26,15 +37,47 @@ func init() {
 		// Fallback to a fixed key if parsing fails
 		encryptionKey = []byte("01234567890123456789012345678901")
 	}
+
+	if v, err := strconv.Atoi(os.Getenv("ENCRYPTION_KEY_VERSION")); err == nil && v > 0 {
+		encryptionKeyVersion = v
+	}
+	if oldHex := os.Getenv("OLD_ENCRYPTION_KEY"); oldHex != "" {
+		if key, err := hex.DecodeString(oldHex); err == nil && len(key) == 32 {
+			oldEncryptionKey = key
+		}
+	}
+}
+
+// EncryptionKeyVersion returns the version of the current encryption key
+func EncryptionKeyVersion() int {
+	return encryptionKeyVersion
 }
 
 // EncryptAPIKey encrypts an API key using AES-256-GCM
 func EncryptAPIKey(plaintext string) (string, error) {
+	return encryptWithKey(encryptionKey, plaintext)
+}
+
+// DecryptAPIKey decrypts an API key encrypted with EncryptAPIKey
+func DecryptAPIKey(ciphertextHex string) (string, error) {
+	return decryptWithKey(encryptionKey, ciphertextHex)
+}
+
+// DecryptWithOldKey decrypts a value encrypted before the last key rotation
+func DecryptWithOldKey(ciphertextHex string) (string, error) {
+	if oldEncryptionKey == nil {
+		return "", errNoOldEncryptionKey
+	}
+	return decryptWithKey(oldEncryptionKey, ciphertextHex)
+}
+
+// encryptWithKey encrypts plaintext with AES-256-GCM and returns nonce+ciphertext as hex
+func encryptWithKey(key []byte, plaintext string) (string, error) {
 	if plaintext == "" {
 		return "", nil
 	}
 
-	block, err := aes.NewCipher(encryptionKey)
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -53,8 +96,8 @@ func EncryptAPIKey(plaintext string) (string, error) {
 	return hex.EncodeToString(ciphertext), nil
 }
 
-// DecryptAPIKey decrypts an API key encrypted with EncryptAPIKey
-func DecryptAPIKey(ciphertextHex string) (string, error) {
+// decryptWithKey decrypts a value produced by encryptWithKey
+func decryptWithKey(key []byte, ciphertextHex string) (string, error) {
 	if ciphertextHex == "" {
 		return "", nil
 	}
@@ -64,7 +107,7 @@ func DecryptAPIKey(ciphertextHex string) (string, error) {
 		return "", err
 	}
 
-	block, err := aes.NewCipher(encryptionKey)
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetUserDashboard returns the aggregate stats of the caller's own account
+func GetUserDashboard(c *fiber.Ctx, repo *repository.UserDashboardRepository) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+	if c.Params("id") != userID {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+	}
+	// Reject malformed IDs before they reach the queries below
+	if _, err := uuid.Parse(userID); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user id", nil)
+	}
+
+	stats, err := repo.WithContext(c.UserContext()).GetStats(userID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	stats.TotalDocuments, stats.TotalStorageBytes, err = userDocumentUsage(userID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	return c.JSON(stats)
+}
+
+// UserStorage is a user's document storage, against their quota and per
+// project
+type UserStorage struct {
+	repository.DocumentStorage
+	UsedBytes  int64                       `json:"used_bytes"` // counted against the quota
+	QuotaBytes int64                       `json:"quota_bytes"`
+	Projects   []repository.ProjectStorage `json:"projects"`
+}
+
+// GetUserStorage returns how much document storage the caller uses, how
+// much of it is saved by sharing identical uploads, how it compares to the
+// quota and how it is split across projects
+func GetUserStorage(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+	if c.Params("id") != userID {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+	}
+
+	docRepo := documentRepo(c)
+	storage, err := docRepo.StorageByUser(userID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	projects, err := docRepo.StorageByUserProjects(userID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(UserStorage{
+		DocumentStorage: *storage,
+		UsedBytes:       storage.StoredBytes - storage.TrashBytes,
+		QuotaBytes:      getStorageQuota(),
+		Projects:        projects,
+	})
+}
+
+// userDocumentUsage counts the documents a user has uploaded across all of
+// their projects and the storage they take up
+func userDocumentUsage(userID string) (count, size int64, err error) {
+	usage, err := repository.NewDocument(repository.GetDB()).StorageByUser(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return usage.Documents, usage.StoredBytes, nil
+}
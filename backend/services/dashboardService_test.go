@@ -0,0 +1,74 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestGetUserStorage(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	owner := uuid.New()
+	alpha := createTestProject(t, owner, `[]`)
+	beta := createTestProject(t, owner, `[]`)
+	db := repository.GetDB()
+	db.Model(alpha).Update("name", "Alpha")
+	db.Model(beta).Update("name", "Beta")
+
+	uploadTestDocument(t, alpha, "a.txt", strings.Repeat("a", 30))
+	trashed := uploadTestDocument(t, alpha, "old.txt", strings.Repeat("o", 10))
+	uploadTestDocument(t, beta, "b.txt", strings.Repeat("b", 50))
+	// Shared with the copy in Alpha, so stored once
+	uploadTestDocument(t, beta, "a.txt", strings.Repeat("a", 30))
+	resp := serveAs(t, owner.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+		return DeleteDocument(c, repository.NewProject(db))
+	}, newRequest("DELETE", "/projects/"+alpha.ID.String()+"/documents/"+trashed.ID, "", nil))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete: status %d", resp.StatusCode)
+	}
+	// Other users' documents aren't counted
+	uploadTestDocument(t, createTestProject(t, uuid.New(), `[]`), "c.txt", "other user")
+
+	resp = serveAs(t, owner.String(), "/users/:id/storage", GetUserStorage, newRequest("GET", "/users/"+owner.String()+"/storage", "", nil))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	var usage UserStorage
+	if err := json.Unmarshal(body, &usage); err != nil {
+		t.Fatal(err)
+	}
+
+	wantTotal := repository.DocumentStorage{Documents: 4, TotalBytes: 120, DeduplicatedBytes: 30, StoredBytes: 90, TrashBytes: 10}
+	if usage.DocumentStorage != wantTotal || usage.UsedBytes != 80 || usage.QuotaBytes != getStorageQuota() {
+		t.Errorf("storage %+v used %d of %d, want %+v used 80", usage.DocumentStorage, usage.UsedBytes, usage.QuotaBytes, wantTotal)
+	}
+
+	// Largest project first
+	want := []repository.ProjectStorage{
+		{ProjectID: beta.ID, ProjectName: "Beta", DocumentStorage: repository.DocumentStorage{Documents: 2, TotalBytes: 80, DeduplicatedBytes: 30, StoredBytes: 50}},
+		{ProjectID: alpha.ID, ProjectName: "Alpha", DocumentStorage: repository.DocumentStorage{Documents: 2, TotalBytes: 40, StoredBytes: 40, TrashBytes: 10}},
+	}
+	if !reflect.DeepEqual(usage.Projects, want) {
+		t.Errorf("projects %+v, want %+v", usage.Projects, want)
+	}
+
+	t.Run("a user without documents", func(t *testing.T) {
+		userID := uuid.NewString()
+		resp := serveAs(t, userID, "/users/:id/storage", GetUserStorage, newRequest("GET", "/users/"+userID+"/storage", "", nil))
+		body := readBody(t, resp)
+		var usage UserStorage
+		json.Unmarshal(body, &usage)
+		if resp.StatusCode != http.StatusOK || usage.Documents != 0 || usage.UsedBytes != 0 || usage.Projects == nil {
+			t.Errorf("status %d: %s, want empty storage", resp.StatusCode, body)
+		}
+	})
+}
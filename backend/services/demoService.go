@@ -2,15 +2,27 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"manju/backend/events"
+	"manju/backend/models/response"
 	"manju/backend/repository"
+	"manju/backend/tracing"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/datatypes"
 )
 
 // DemoChatRequest represents the chat request to the AI service
@@ -20,6 +32,61 @@ type DemoChatRequest struct {
 	ConversationHistory []map[string]interface{} `json:"conversation_history"`
 	SessionID           string                   `json:"session_id,omitempty"`
 	OpenAIAPIKey        string                   `json:"openai_api_key,omitempty"`
+	// The model settings of the workflow's first ai-model node, so the AI
+	// service doesn't have to pick a default model itself
+	Model        string   `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	MaxTokens    int      `json:"max_tokens,omitempty"`
+	SystemPrompt string   `json:"system_prompt,omitempty"`
+}
+
+// AIModelNodeData is the configuration of an ai-model node, under the keys
+// the editor stores it with. Temperature is a pointer because 0 is a valid
+// temperature; MaxTokens is 0 when not set.
+type AIModelNodeData struct {
+	Model        string   `json:"modelName"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	MaxTokens    int      `json:"maxTokens,omitempty"`
+	SystemPrompt string   `json:"systemPrompt,omitempty"`
+}
+
+// Limits of an ai-model node's settings
+const (
+	maxAITemperature = 2
+	maxAITokens      = 128000
+)
+
+// ValidateAIModelNode checks the data of an ai-model node: the model must
+// be set, the temperature, if set, between 0 and 2 and the max tokens, if
+// set, between 1 and 128000
+func ValidateAIModelNode(data map[string]interface{}) error {
+	_, err := aiModelNodeConfig(data)
+	return err
+}
+
+// aiModelNodeConfig validates and decodes the data of an ai-model node
+func aiModelNodeConfig(data map[string]interface{}) (AIModelNodeData, error) {
+	var cfg AIModelNodeData
+	model, _ := data["modelName"].(string)
+	if cfg.Model = strings.TrimSpace(model); cfg.Model == "" {
+		return cfg, errors.New("model is required")
+	}
+	if v, ok := data["temperature"]; ok && v != nil {
+		t, ok := v.(float64)
+		if !ok || t < 0 || t > maxAITemperature {
+			return cfg, fmt.Errorf("temperature must be a number between 0 and %d", maxAITemperature)
+		}
+		cfg.Temperature = &t
+	}
+	if v, ok := data["maxTokens"]; ok && v != nil {
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) || n < 1 || n > maxAITokens {
+			return cfg, fmt.Errorf("max tokens must be a whole number between 1 and %d", maxAITokens)
+		}
+		cfg.MaxTokens = int(n)
+	}
+	cfg.SystemPrompt, _ = data["systemPrompt"].(string)
+	return cfg, nil
 }
 
 // WorkflowConfig represents the workflow configuration
@@ -34,6 +101,26 @@ type DemoChatResponse struct {
 	ModelUsed        string   `json:"model_used,omitempty"`
 	ProcessingTimeMs float64  `json:"processing_time_ms"`
 	NodesExecuted    []string `json:"nodes_executed"`
+	// Token counts are only sent by AI service versions that report usage
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+	TotalTokens      int `json:"total_tokens,omitempty"`
+	// NodeTraces is only sent by AI service versions that trace each node
+	NodeTraces []NodeTrace `json:"node_traces,omitempty"`
+	// TruncatedHistoryCount is how many of the oldest history messages were
+	// left out to stay within the history limits; set here, not by the AI service
+	TruncatedHistoryCount int `json:"truncated_history_count"`
+}
+
+// NodeTrace records the timing and payload sizes of one executed node
+type NodeTrace struct {
+	NodeID      string    `json:"node_id"`
+	NodeType    string    `json:"node_type"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	InputBytes  int64     `json:"input_bytes"`
+	OutputBytes int64     `json:"output_bytes"`
+	Error       string    `json:"error,omitempty"`
 }
 
 // DemoRequest is the request body from the frontend
@@ -43,6 +130,53 @@ type DemoRequest struct {
 	SessionID           string                   `json:"session_id,omitempty"`
 }
 
+// getMaxHistoryMessages returns how many conversation history messages are
+// forwarded to the AI service
+func getMaxHistoryMessages() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_HISTORY_MESSAGES")); err == nil && v > 0 {
+		return v
+	}
+	return 20
+}
+
+// getMaxHistoryBytes returns how large the forwarded conversation history
+// may be, measured as JSON
+func getMaxHistoryBytes() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_HISTORY_BYTES")); err == nil && v > 0 {
+		return v
+	}
+	return 50000
+}
+
+// truncateHistory drops the oldest messages of a conversation history until
+// it is within the message and byte limits, and returns what is left with
+// the number of messages dropped. A system prompt at index 0 is always kept.
+func truncateHistory(history []map[string]interface{}) ([]map[string]interface{}, int) {
+	sizes := make([]int, len(history))
+	total := 0
+	for i, message := range history {
+		b, _ := json.Marshal(message)
+		sizes[i] = len(b)
+		total += sizes[i]
+	}
+
+	first := 0
+	if len(history) > 0 && history[0]["role"] == "system" {
+		first = 1
+	}
+	drop := 0
+	maxMessages, maxBytes := getMaxHistoryMessages(), getMaxHistoryBytes()
+	for first+drop < len(history) && (len(history)-drop > maxMessages || total > maxBytes) {
+		total -= sizes[first+drop]
+		drop++
+	}
+	if drop == 0 {
+		return history, 0
+	}
+	kept := append(history[:first:first], history[first+drop:]...)
+	return kept, drop
+}
+
 // getAIServiceURL returns the AI service URL from environment or default
 func getAIServiceURL() string {
 	url := os.Getenv("AI_SERVICE_URL")
@@ -52,55 +186,215 @@ func getAIServiceURL() string {
 	return url
 }
 
+// aiTimeoutConfig holds the timeout of each kind of AI service call
+type aiTimeoutConfig struct {
+	Chat         time.Duration
+	Validate     time.Duration
+	Embed        time.Duration
+	WorkflowType time.Duration
+	TTS          time.Duration
+	Extract      time.Duration
+	Preview      time.Duration
+}
+
+// aiTimeouts is resolved from the environment by LoadAITimeouts at startup
+var aiTimeouts = aiTimeoutConfig{
+	Chat:         60 * time.Second,
+	Validate:     10 * time.Second,
+	Embed:        300 * time.Second,
+	WorkflowType: 10 * time.Second,
+	TTS:          30 * time.Second,
+	Extract:      30 * time.Second,
+	Preview:      15 * time.Second,
+}
+
+// LoadAITimeouts reads the AI_TIMEOUT_*_SEC overrides. It must run once from
+// main after the environment is loaded.
+func LoadAITimeouts() {
+	for _, t := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"AI_TIMEOUT_CHAT_SEC", &aiTimeouts.Chat},
+		{"AI_TIMEOUT_VALIDATE_SEC", &aiTimeouts.Validate},
+		{"AI_TIMEOUT_EMBED_SEC", &aiTimeouts.Embed},
+		{"AI_TIMEOUT_WORKFLOW_TYPE_SEC", &aiTimeouts.WorkflowType},
+		{"AI_TIMEOUT_TTS_SEC", &aiTimeouts.TTS},
+		{"AI_TIMEOUT_EXTRACT_SEC", &aiTimeouts.Extract},
+		{"AI_TIMEOUT_PREVIEW_SEC", &aiTimeouts.Preview},
+	} {
+		if v, err := strconv.Atoi(os.Getenv(t.env)); err == nil && v > 0 {
+			*t.dst = time.Duration(v) * time.Second
+		}
+	}
+}
+
+// AIHealth reports whether the AI service answers its health check, along
+// with the timeouts in effect, for operators
+func AIHealth(c *fiber.Ctx) error {
+	reachable := false
+	client := &http.Client{Timeout: 2 * time.Second}
+	req, err := http.NewRequestWithContext(c.UserContext(), http.MethodGet, getAIServiceURL()+"/health", nil)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to create request", nil)
+	}
+	if resp, err := client.Do(req); err == nil {
+		resp.Body.Close()
+		reachable = resp.StatusCode == http.StatusOK
+	}
+
+	return c.JSON(fiber.Map{
+		"url":       getAIServiceURL(),
+		"reachable": reachable,
+		"timeouts_sec": fiber.Map{
+			"chat":          aiTimeouts.Chat.Seconds(),
+			"validate":      aiTimeouts.Validate.Seconds(),
+			"embed":         aiTimeouts.Embed.Seconds(),
+			"workflow_type": aiTimeouts.WorkflowType.Seconds(),
+			"tts":           aiTimeouts.TTS.Seconds(),
+			"extract":       aiTimeouts.Extract.Seconds(),
+			"preview":       aiTimeouts.Preview.Seconds(),
+		},
+	})
+}
+
 // DemoProject handles the demo chat request for a project
 func DemoProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	ctx, span := tracing.Start(c.UserContext(), "DemoProject", attribute.String("project.id", c.Params("id")))
+	defer span.End()
+
+	run, err := prepareDemoRun(c, ctx, repo.WithContext(ctx))
+	if run == nil {
+		return err
+	}
+
+	// fasthttp doesn't cancel the request context when the client goes
+	// away, so the AI service call watches the connection itself
+	aiCtx, cancel := disconnectContext(c, ctx)
+	aiResponse, err := callAIChat(aiCtx, run.request)
+	gone := errors.Is(context.Cause(aiCtx), errClientGone)
+	cancel()
+	if err != nil {
+		var svcErr *aiServiceError
+		switch {
+		case gone:
+			log.Printf("[demo] client of project %s went away, AI service call cancelled", run.project.ID)
+			recordExecution(ctx, run.project, run.userID, repository.TriggerManual, nil, run.message, nil, errClientGone)
+			return nil
+		case errors.As(err, &svcErr):
+			recordExecution(ctx, run.project, run.userID, repository.TriggerManual, nil, run.message, nil, err)
+			return response.Error(c, svcErr.StatusCode, "", "AI service error", svcErr.Body)
+		case errors.Is(err, errAIUnavailable):
+			// If AI service is not available, return a mock response
+			return c.JSON(run.mockResponse())
+		default:
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+		}
+	}
+
+	execution := recordExecution(ctx, run.project, run.userID, repository.TriggerManual, nil, run.message, aiResponse, nil)
+	publishDemoCompleted(run.project, run.userID, execution, aiResponse)
+
+	aiResponse.TruncatedHistoryCount = run.truncated
+	return c.JSON(aiResponse)
+}
+
+// demoRun is a demo chat request checked and ready to send to the AI service
+type demoRun struct {
+	project   *repository.Project
+	userID    string
+	message   string
+	request   DemoChatRequest
+	truncated int // history messages left out of request
+}
+
+// mockResponse is the reply to a demo run while the AI service is down
+func (run *demoRun) mockResponse() *DemoChatResponse {
+	return &DemoChatResponse{
+		Response:              "[Demo Mode] AI service is not available. Message received: " + run.message,
+		ModelUsed:             "mock",
+		ProcessingTimeMs:      0,
+		NodesExecuted:         []string{"text-input", "text-output"},
+		TruncatedHistoryCount: run.truncated,
+	}
+}
+
+// prepareDemoRun checks that the user may run the project of a demo request
+// and builds the AI service request from its body. On failure it writes the
+// error response and returns nil.
+func prepareDemoRun(c *fiber.Ctx, ctx context.Context, repo *repository.ProjectRepository) (*demoRun, error) {
 	// Get user ID from context (set by auth middleware)
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return nil, response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	// Get project ID from params
 	projectID := c.Params("id")
 	if projectID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id required"})
+		return nil, response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id required", nil)
 	}
 
 	// Get project from database
 	project, err := repo.GetByID(projectID)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return nil, response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	// Verify ownership
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	// Verify access
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return nil, response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
+	}
+
+	if project.Status == repository.ProjectStatusArchived {
+		return nil, response.Error(c, http.StatusConflict, response.ErrCodeConflict, "project is archived", nil)
 	}
 
 	// Parse request body
 	var body DemoRequest
 	if err := c.BodyParser(&body); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		return nil, response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
 	}
 
 	if body.Message == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "message is required"})
+		return nil, response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "message is required", nil)
 	}
 
-	// Parse nodes and connections from project
-	var nodes []map[string]interface{}
-	var connections []map[string]interface{}
-
-	if err := json.Unmarshal(project.Nodes, &nodes); err != nil {
-		nodes = []map[string]interface{}{}
-	}
-	if err := json.Unmarshal(project.Connections, &connections); err != nil {
-		connections = []map[string]interface{}{}
+	// Build request to AI service
+	aiRequest, truncated, err := prepareChatRun(ctx, project, userIDStr.(string), body.Message, body.ConversationHistory, body.SessionID)
+	if err != nil {
+		var sheetsErr *sheetsError
+		var budgetErr *tokenBudgetError
+		switch {
+		case errors.As(err, &budgetErr):
+			return nil, budgetErr.respond(c)
+		case errors.Is(err, errGoogleNotLinked) || errors.As(err, &sheetsErr):
+			return nil, writeSheetsError(c, err)
+		}
+		return nil, response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
 	}
 
+	return &demoRun{
+		project:   project,
+		userID:    userIDStr.(string),
+		message:   body.Message,
+		request:   aiRequest,
+		truncated: truncated,
+	}, nil
+}
+
+// buildChatRequest prepares the AI service request for running project as
+// userID: it injects document locations into RAG nodes, the rows of Google
+// Sheets nodes and resolves the OpenAI key to use. It fails with errNoAPIKey
+// when no key is available.
+func buildChatRequest(ctx context.Context, project *repository.Project, userID, message string) (DemoChatRequest, error) {
+	nodes, connections := parseWorkflow(project)
+	applyProjectSettings(nodes, project.Settings)
+
 	// Inject userId and projectId into RAG nodes so AI executor can locate FAISS index
 	// Also check for selectedApiKeyId in AI model nodes
 	var selectedKeyID string
+	var modelConfig *AIModelNodeData
 	for i, node := range nodes {
 		nodeType, _ := node["type"].(string)
 
@@ -109,8 +403,9 @@ func DemoProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 			if !ok {
 				nodeData = map[string]interface{}{}
 			}
-			nodeData["userId"] = userIDStr.(string)
-			nodeData["projectId"] = projectID
+			// Documents live under the project owner's directory
+			nodeData["userId"] = project.UserID.String()
+			nodeData["projectId"] = project.ID.String()
 			nodes[i]["data"] = nodeData
 		}
 
@@ -121,25 +416,73 @@ func DemoProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 				if keyID, exists := nodeData["selectedApiKeyId"].(string); exists && keyID != "" {
 					selectedKeyID = keyID
 				}
+				if cfg, err := aiModelNodeConfig(nodeData); err == nil && modelConfig == nil {
+					modelConfig = &cfg
+				}
 			}
 		}
 	}
 
-	// Retrieve API key - prioritize:
-	// 1. Specifically selected key in the workflow node
-	// 2. User's designated "Default" key in the new system
-	// 3. (Legacy) User's single encrypted_api_key field
+	userAPIKey := resolveAPIKey(ctx, project, userID, selectedKeyID)
+	if userAPIKey == "" {
+		return DemoChatRequest{}, errNoAPIKey
+	}
+	if err := attachSheetValues(ctx, project, nodes); err != nil {
+		return DemoChatRequest{}, err
+	}
+
+	chatReq := DemoChatRequest{
+		Message: message,
+		Workflow: WorkflowConfig{
+			Nodes:       nodes,
+			Connections: connections,
+		},
+		ConversationHistory: []map[string]interface{}{},
+		OpenAIAPIKey:        userAPIKey,
+	}
+	if modelConfig != nil {
+		chatReq.Model = modelConfig.Model
+		chatReq.Temperature = modelConfig.Temperature
+		chatReq.MaxTokens = modelConfig.MaxTokens
+		chatReq.SystemPrompt = modelConfig.SystemPrompt
+	}
+	return chatReq, nil
+}
+
+// errNoAPIKey is returned when no usable API key is configured for a run
+var errNoAPIKey = errors.New("no API key configured: add an API key or set the project's default key")
+
+// resolveAPIKey returns the decrypted OpenAI key for running project as userID.
+// Keys are tried in order:
+// 1. Specifically selected key in the workflow node (one of the owner's keys)
+// 2. The project's default key (one of the owner's keys)
+// 3. User's designated "Default" key in the new system
+// 4. (Legacy) User's single encrypted_api_key field
+func resolveAPIKey(ctx context.Context, project *repository.Project, userID, selectedKeyID string) string {
 	var userAPIKey string
-	keyRepo := repository.NewUserAPIKeyRepository(repository.GetDB())
+	keyRepo := repository.NewUserAPIKeyRepository(repository.GetDB()).WithContext(ctx)
 
 	if selectedKeyID != "" {
-		// Use specifically selected key from workflow
-		userAPIKey, _ = GetDecryptedAPIKey(keyRepo, selectedKeyID)
+		// Use specifically selected key from workflow. Anyone who can edit the
+		// nodes can set it, so only the project owner's keys are accepted.
+		var err error
+		userAPIKey, err = GetDecryptedAPIKey(keyRepo, selectedKeyID, project.UserID)
+		if errors.Is(err, errAPIKeyNotOwned) {
+			log.Printf("[demo] project %s selects API key %s of another user, ignoring it", project.ID, selectedKeyID)
+		}
+	}
+
+	if userAPIKey == "" && project.DefaultAPIKeyID != nil {
+		var err error
+		userAPIKey, err = GetDecryptedAPIKey(keyRepo, project.DefaultAPIKeyID.String(), project.UserID)
+		if errors.Is(err, errAPIKeyNotOwned) {
+			log.Printf("[demo] project %s defaults to API key %s of another user, ignoring it", project.ID, project.DefaultAPIKeyID)
+		}
 	}
 
 	// If no specific key selected or failed to retrieve it, look for the user's default key in the new system
 	if userAPIKey == "" {
-		defaultKey, err := keyRepo.GetDefaultByUserID(userIDStr.(string))
+		defaultKey, err := keyRepo.GetDefaultByUserID(userID)
 		if err == nil && defaultKey != nil {
 			userAPIKey, _ = DecryptAPIKey(defaultKey.EncryptedKey)
 		}
@@ -147,77 +490,207 @@ func DemoProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 
 	// Last fallback: user's legacy single key field
 	if userAPIKey == "" {
-		userRepo := repository.New(repository.GetDB())
-		user, err := userRepo.GetByID(userIDStr.(string))
+		userRepo := repository.New(repository.GetDB()).WithContext(ctx)
+		user, err := userRepo.GetByID(userID)
 		if err == nil && user != nil && user.EncryptedAPIKey != "" {
 			userAPIKey, _ = DecryptAPIKey(user.EncryptedAPIKey)
 		}
 	}
 
-	// Build request to AI service
-	aiRequest := DemoChatRequest{
-		Message: body.Message,
-		Workflow: WorkflowConfig{
-			Nodes:       nodes,
-			Connections: connections,
-		},
-		ConversationHistory: body.ConversationHistory,
-		SessionID:           body.SessionID,
-		OpenAIAPIKey:        userAPIKey,
+	return userAPIKey
+}
+
+// errAIUnavailable is returned when the AI service cannot be reached
+var errAIUnavailable = errors.New("AI service is not available")
+
+// aiServiceError is returned when the AI service answers with a non-200 status
+type aiServiceError struct {
+	StatusCode int
+	Body       map[string]interface{}
+}
+
+func (e *aiServiceError) Error() string {
+	if detail, ok := e.Body["detail"].(string); ok {
+		return fmt.Sprintf("AI service error (%d): %s", e.StatusCode, detail)
 	}
+	return fmt.Sprintf("AI service error (%d)", e.StatusCode)
+}
+
+// callAIChat sends a chat request to the AI service
+func callAIChat(ctx context.Context, aiRequest DemoChatRequest) (resp *DemoChatResponse, err error) {
+	ctx, span := tracing.Start(ctx, "ai.chat")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
 
 	requestBody, err := json.Marshal(aiRequest)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to build request"})
+		return nil, fmt.Errorf("failed to build request: %w", err)
 	}
 
 	// Call AI service
 	aiServiceURL := getAIServiceURL() + "/chat"
 	log.Printf("[DEBUG] Calling AI service at: %s", aiServiceURL)
-	client := &http.Client{Timeout: 60 * time.Second}
+	client := &http.Client{Timeout: aiTimeouts.Chat}
 
-	req, err := http.NewRequest("POST", aiServiceURL, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", aiServiceURL, bytes.NewBuffer(requestBody))
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create request"})
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	req.Header.Set("Authorization", "Bearer "+aiRequest.OpenAIAPIKey)
+	tracing.Inject(ctx, req.Header)
 
-	resp, err := client.Do(req)
+	httpResp, err := client.Do(req)
 	if err != nil {
 		log.Printf("[ERROR] AI service call failed: %v", err)
-		// If AI service is not available, return a mock response
-		return c.JSON(DemoChatResponse{
-			Response:         "[Demo Mode] AI service is not available. Message received: " + body.Message,
-			ModelUsed:        "mock",
-			ProcessingTimeMs: 0,
-			NodesExecuted:    []string{"text-input", "text-output"},
-		})
+		return nil, errAIUnavailable
 	}
-	defer resp.Body.Close()
+	defer httpResp.Body.Close()
 
 	// Read response
-	responseBody, err := io.ReadAll(resp.Body)
+	responseBody, err := io.ReadAll(httpResp.Body)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to read AI response"})
+		return nil, fmt.Errorf("failed to read AI response: %w", err)
 	}
 
 	// Check for error response
-	if resp.StatusCode != http.StatusOK {
-		var errorResp map[string]interface{}
-		if err := json.Unmarshal(responseBody, &errorResp); err == nil {
-			return c.Status(resp.StatusCode).JSON(errorResp)
-		}
-		return c.Status(resp.StatusCode).JSON(fiber.Map{"error": "AI service error"})
+	if httpResp.StatusCode != http.StatusOK {
+		svcErr := &aiServiceError{StatusCode: httpResp.StatusCode}
+		_ = json.Unmarshal(responseBody, &svcErr.Body)
+		return nil, svcErr
 	}
 
-	// Parse and return response
 	var aiResponse DemoChatResponse
 	if err := json.Unmarshal(responseBody, &aiResponse); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to parse AI response"})
+		return nil, fmt.Errorf("failed to parse AI response: %w", err)
+	}
+	return &aiResponse, nil
+}
+
+// recordExecution persists the outcome of a workflow run and counts its
+// tokens against the project's budget. Failures to store the row are logged
+// only so they never fail the run itself.
+func recordExecution(ctx context.Context, project *repository.Project, userID, trigger string, scheduleID *uuid.UUID, input string, aiResponse *DemoChatResponse, runErr error) *repository.Execution {
+	execution := repository.Execution{
+		ProjectID:  project.ID,
+		Trigger:    trigger,
+		ScheduleID: scheduleID,
+		Input:      input,
+	}
+	if uid, err := uuid.Parse(userID); err == nil {
+		execution.UserID = uid
 	}
+	setExecutionOutcome(&execution, aiResponse, runErr)
 
-	return c.JSON(aiResponse)
+	addTokensUsed(ctx, project.ID, execution.TotalTokens)
+
+	created, err := repository.NewExecution(repository.GetDB()).WithContext(ctx).Create(&execution)
+	if err != nil {
+		log.Printf("[execution] failed to record execution for project %s: %v", project.ID, err)
+		return &execution
+	}
+	return created
+}
+
+// setExecutionOutcome fills in the status and AI response of a run
+func setExecutionOutcome(execution *repository.Execution, aiResponse *DemoChatResponse, runErr error) {
+	execution.Status = repository.ExecutionSucceeded
+	if runErr != nil {
+		execution.Status = repository.ExecutionFailed
+		execution.Error = runErr.Error()
+	}
+	if aiResponse != nil {
+		nodesJSON, _ := json.Marshal(aiResponse.NodesExecuted)
+		execution.Response = aiResponse.Response
+		execution.ModelUsed = aiResponse.ModelUsed
+		execution.ProcessingTimeMs = aiResponse.ProcessingTimeMs
+		execution.NodesExecuted = datatypes.JSON(nodesJSON)
+		execution.PromptTokens = aiResponse.PromptTokens
+		execution.CompletionTokens = aiResponse.CompletionTokens
+		execution.TotalTokens = aiResponse.TotalTokens
+		if execution.TotalTokens == 0 {
+			execution.TotalTokens = aiResponse.PromptTokens + aiResponse.CompletionTokens
+		}
+		if len(aiResponse.NodeTraces) > 0 {
+			tracesJSON, _ := json.Marshal(aiResponse.NodeTraces)
+			execution.NodeTraces = datatypes.JSON(tracesJSON)
+		}
+	}
+}
+
+// publishDemoCompleted announces a successful workflow run
+func publishDemoCompleted(project *repository.Project, userID string, execution *repository.Execution, aiResponse *DemoChatResponse) {
+	events.Publish(events.DemoCompleted{
+		ProjectID:        project.ID.String(),
+		UserID:           userID,
+		ExecutionID:      execution.ID.String(),
+		Response:         aiResponse.Response,
+		ModelUsed:        aiResponse.ModelUsed,
+		ProcessingTimeMs: aiResponse.ProcessingTimeMs,
+		NodesExecuted:    aiResponse.NodesExecuted,
+		At:               time.Now(),
+	})
+}
+
+// ExecutionsPage is a page of GET /projects/:id/executions
+type ExecutionsPage struct {
+	Executions []repository.Execution `json:"executions"`
+	NextCursor *string                `json:"next_cursor"` // null on the last page
+}
+
+// ListExecutions returns a page of the workflow runs of a project, newest
+// first. Pass the returned next_cursor as ?cursor= to get the next page.
+func ListExecutions(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	project, err := repo.GetByID(c.Params("id"))
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	}
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	cursor, err := repository.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid cursor", nil)
+	}
+
+	executions, next, err := repository.NewExecution(repository.GetDB()).WithContext(c.UserContext()).ListByProject(project.ID.String(), cursor, limit)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	var nextCursor *string
+	if next != nil {
+		token := next.Encode()
+		nextCursor = &token
+	}
+	return c.JSON(ExecutionsPage{Executions: executions, NextCursor: nextCursor})
+}
+
+// WorkflowValidation is the response of POST /projects/:id/validate. The AI
+// service's validation is passed through; this is the shape of the basic
+// validation done when the AI service can't be reached.
+type WorkflowValidation struct {
+	Valid           bool     `json:"valid"`
+	Issues          []string `json:"issues"` // errors and warnings in one list
+	Errors          []string `json:"errors"`
+	Warnings        []string `json:"warnings"`
+	NodeCount       int      `json:"node_count"`
+	ConnectionCount int      `json:"connection_count"`
+	NodeTypes       []string `json:"node_types"`
 }
 
 // ValidateWorkflow validates a project's workflow configuration
@@ -225,24 +698,24 @@ func ValidateWorkflow(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	// Get user ID from context
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	// Get project ID from params
 	projectID := c.Params("id")
 	if projectID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id required", nil)
 	}
 
 	// Get project from database
 	project, err := repo.GetByID(projectID)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	// Verify ownership
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	// Verify access
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
 	}
 
 	// Parse nodes and connections
@@ -264,19 +737,20 @@ func ValidateWorkflow(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 
 	requestBody, err := json.Marshal(workflow)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to build request"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to build request", nil)
 	}
 
 	// Call AI service validate endpoint
 	aiServiceURL := getAIServiceURL() + "/validate"
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := &http.Client{Timeout: aiTimeouts.Validate}
 
-	req, err := http.NewRequest("POST", aiServiceURL, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(c.UserContext(), "POST", aiServiceURL, bytes.NewBuffer(requestBody))
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create request"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to create request", nil)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	tracing.Inject(c.UserContext(), req.Header)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -292,23 +766,41 @@ func ValidateWorkflow(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 		hasOutput := contains(nodeTypes, "text-output") || contains(nodeTypes, "voice-output")
 		hasAI := contains(nodeTypes, "ai-model")
 
-		issues := []string{}
+		errs := workflowSizeIssues(len(nodes), len(connections))
 		if !hasInput {
-			issues = append(issues, "Workflow needs an input node")
+			errs = append(errs, "Workflow needs an input node")
 		}
 		if !hasOutput {
-			issues = append(issues, "Workflow needs an output node")
+			errs = append(errs, "Workflow needs an output node")
 		}
 		if !hasAI {
-			issues = append(issues, "Workflow needs an AI model node")
+			errs = append(errs, "Workflow needs an AI model node")
+		}
+
+		applyProjectSettings(nodes, project.Settings)
+		for _, node := range nodes {
+			if nodeType, _ := node["type"].(string); nodeType != "ai-model" {
+				continue
+			}
+			if err := ValidateAIModelNode(nodeData(node)); err != nil {
+				errs = append(errs, fmt.Sprintf("AI model node %q: %v", nodeLabel(node), err))
+			}
 		}
 
-		return c.JSON(fiber.Map{
-			"valid":            len(issues) == 0,
-			"issues":           issues,
-			"node_count":       len(nodes),
-			"connection_count": len(connections),
-			"node_types":       nodeTypes,
+		graphErrs, warnings := workflowGraphIssues(nodes, connections)
+		errs = append(errs, graphErrs...)
+
+		// issues keeps every finding in one list for existing clients
+		issues := append(append([]string{}, errs...), warnings...)
+
+		return c.JSON(WorkflowValidation{
+			Valid:           len(errs) == 0,
+			Issues:          issues,
+			Errors:          errs,
+			Warnings:        warnings,
+			NodeCount:       len(nodes),
+			ConnectionCount: len(connections),
+			NodeTypes:       nodeTypes,
 		})
 	}
 	defer resp.Body.Close()
@@ -316,12 +808,12 @@ func ValidateWorkflow(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	// Read and return response
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to read response"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to read response", nil)
 	}
 
 	var validationResponse map[string]interface{}
 	if err := json.Unmarshal(responseBody, &validationResponse); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to parse response"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to parse response", nil)
 	}
 
 	return c.JSON(validationResponse)
@@ -351,24 +843,24 @@ func GetWorkflowType(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	// Get user ID from context
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	// Get project ID from params
 	projectID := c.Params("id")
 	if projectID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id required", nil)
 	}
 
 	// Get project from database
 	project, err := repo.GetByID(projectID)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	// Verify ownership
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	// Verify access
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
 	}
 
 	// Parse nodes
@@ -390,19 +882,20 @@ func GetWorkflowType(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 
 	requestBody, err := json.Marshal(workflow)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to build request"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to build request", nil)
 	}
 
 	// Call AI service workflow-type endpoint
 	aiServiceURL := getAIServiceURL() + "/workflow-type"
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := &http.Client{Timeout: aiTimeouts.WorkflowType}
 
-	req, err := http.NewRequest("POST", aiServiceURL, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(c.UserContext(), "POST", aiServiceURL, bytes.NewBuffer(requestBody))
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create request"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to create request", nil)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	tracing.Inject(c.UserContext(), req.Header)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -441,12 +934,12 @@ func GetWorkflowType(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	// Read and return response
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to read response"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to read response", nil)
 	}
 
 	var workflowTypeResponse WorkflowTypeResponse
 	if err := json.Unmarshal(responseBody, &workflowTypeResponse); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to parse response"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to parse response", nil)
 	}
 
 	return c.JSON(workflowTypeResponse)
@@ -464,45 +957,36 @@ func GenerateTTS(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	// Get user ID from context
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	// Get project ID from params
 	projectID := c.Params("id")
 	if projectID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id required", nil)
 	}
 
 	// Get project from database
 	project, err := repo.GetByID(projectID)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	// Verify ownership
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	// Verify access
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
 	}
 
 	// Parse request body
 	var body TTSRequest
 	if err := c.BodyParser(&body); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
 	}
 
-	// Retrieve API key for TTS
-	var userAPIKey string
-	keyRepo := repository.NewUserAPIKeyRepository(repository.GetDB())
-	defaultKey, err := keyRepo.GetDefaultByUserID(userIDStr.(string))
-	if err == nil && defaultKey != nil {
-		userAPIKey, _ = DecryptAPIKey(defaultKey.EncryptedKey)
-	} else {
-		// Fallback to legacy key
-		userRepo := repository.New(repository.GetDB())
-		user, err := userRepo.GetByID(userIDStr.(string))
-		if err == nil && user != nil && user.EncryptedAPIKey != "" {
-			userAPIKey, _ = DecryptAPIKey(user.EncryptedAPIKey)
-		}
+	// Retrieve API key for TTS the same way as for a demo run
+	userAPIKey := resolveAPIKey(c.UserContext(), project, userIDStr.(string), "")
+	if userAPIKey == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, errNoAPIKey.Error(), nil)
 	}
 
 	// Add API key to request
@@ -518,23 +1002,24 @@ func GenerateTTS(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 
 	requestBody, err := json.Marshal(requestWithKey)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to build request"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to build request", nil)
 	}
 
 	// Call AI service TTS endpoint
 	aiServiceURL := getAIServiceURL() + "/tts"
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := &http.Client{Timeout: aiTimeouts.TTS}
 
-	req, err := http.NewRequest("POST", aiServiceURL, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(c.UserContext(), "POST", aiServiceURL, bytes.NewBuffer(requestBody))
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create request"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to create request", nil)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	tracing.Inject(c.UserContext(), req.Header)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "AI service unavailable"})
+		return response.Error(c, http.StatusServiceUnavailable, response.ErrCodeUnavailable, "AI service unavailable", nil)
 	}
 	// Note: We don't defer resp.Body.Close() here because we'll stream it
 
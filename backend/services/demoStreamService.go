@@ -0,0 +1,269 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/tracing"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// A streamed demo run is relayed to the client as server-sent events:
+//
+//	event: token  data: {"token": "..."}     a piece of the reply
+//	event: done   data: DemoChatResponse     the whole reply and its metadata
+//	event: error  data: {"code": "...", "message": "..."}
+//
+// The AI service's POST /chat/stream answers with the same events. AI
+// service versions without it get the reply from /chat, sent in chunks.
+
+// Events of a streamed demo run
+const (
+	sseEventToken = "token"
+	sseEventDone  = "done"
+	sseEventError = "error"
+)
+
+// errStreamClosed is the run error recorded when the client goes away
+// before the reply is complete
+var errStreamClosed = errors.New("client closed the stream")
+
+// demoStreamChunkWords is how many words of a whole reply go in one token
+// event when the AI service can't stream
+const demoStreamChunkWords = 4
+
+// DemoProjectStream runs a project's workflow like DemoProject but streams
+// the reply as server-sent events: token events as it is generated, then a
+// done event with the DemoChatResponse, or an error event. If the client
+// disconnects the AI service request is cancelled.
+func DemoProjectStream(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	ctx, span := tracing.Start(c.UserContext(), "DemoProjectStream", attribute.String("project.id", c.Params("id")))
+	// Once the stream writer takes over, the span ends when it has written
+	// the reply rather than when this handler returns
+	streaming := false
+	defer func() {
+		if !streaming {
+			span.End()
+		}
+	}()
+
+	run, err := prepareDemoRun(c, ctx, repo.WithContext(ctx))
+	if run == nil {
+		return err
+	}
+
+	// The stream outlives this handler, so the AI service request gets a
+	// context of its own, cancelled once the stream ends
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	upstream, err := openAIChatStream(streamCtx, run.request)
+	var whole *DemoChatResponse
+	if err == nil && upstream == nil {
+		whole, err = callAIChat(streamCtx, run.request)
+	}
+	mock := false
+	if err != nil {
+		cancel()
+		var svcErr *aiServiceError
+		switch {
+		case errors.As(err, &svcErr):
+			recordExecution(ctx, run.project, run.userID, repository.TriggerManual, nil, run.message, nil, err)
+			return response.Error(c, svcErr.StatusCode, "", "AI service error", svcErr.Body)
+		case errors.Is(err, errAIUnavailable):
+			// If AI service is not available, stream a mock response
+			whole, mock = run.mockResponse(), true
+		default:
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+		}
+	}
+
+	requestID, _ := c.Locals("requestID").(string)
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // keep reverse proxies from buffering the events
+	streaming = true
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer span.End()
+		defer cancel()
+		send := func(token string) error {
+			return writeSSE(w, sseEventToken, fiber.Map{"token": token})
+		}
+
+		aiResponse := whole
+		var err error
+		if upstream != nil {
+			defer upstream.Body.Close()
+			aiResponse, err = relayAIChatStream(upstream.Body, send)
+		} else {
+			err = sendInChunks(whole.Response, send)
+		}
+		if mock {
+			if err == nil {
+				writeSSE(w, sseEventDone, aiResponse)
+			}
+			return
+		}
+
+		execution := recordExecution(ctx, run.project, run.userID, repository.TriggerManual, nil, run.message, aiResponse, err)
+		var svcErr *aiServiceError
+		switch {
+		case err == nil:
+			publishDemoCompleted(run.project, run.userID, execution, aiResponse)
+			aiResponse.TruncatedHistoryCount = run.truncated
+			writeSSE(w, sseEventDone, aiResponse)
+		case errors.Is(err, errStreamClosed):
+			log.Printf("[demo] client closed the stream of project %s", run.project.ID)
+		case errors.As(err, &svcErr):
+			writeSSE(w, sseEventError, response.ErrorResponse{
+				Code:      response.CodeForStatus(svcErr.StatusCode),
+				Message:   "AI service error",
+				Details:   svcErr.Body,
+				RequestID: requestID,
+			})
+		default:
+			writeSSE(w, sseEventError, response.ErrorResponse{
+				Code:      response.ErrCodeInternal,
+				Message:   err.Error(),
+				RequestID: requestID,
+			})
+		}
+	})
+	return nil
+}
+
+// writeSSE writes one server-sent event and flushes it to the client. It
+// fails with errStreamClosed once the client has gone away.
+func writeSSE(w *bufio.Writer, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	if err := w.Flush(); err != nil {
+		return errStreamClosed
+	}
+	return nil
+}
+
+// sendInChunks passes a whole reply to send a few words at a time
+func sendInChunks(reply string, send func(token string) error) error {
+	words := strings.SplitAfter(reply, " ")
+	for i := 0; i < len(words); i += demoStreamChunkWords {
+		chunk := strings.Join(words[i:min(i+demoStreamChunkWords, len(words))], "")
+		if err := send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openAIChatStream starts a streamed chat at the AI service. It returns nil
+// without an error when the AI service has no streaming endpoint. The caller
+// closes the body of the response.
+func openAIChatStream(ctx context.Context, aiRequest DemoChatRequest) (*http.Response, error) {
+	requestBody, err := json.Marshal(aiRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", getAIServiceURL()+"/chat/stream", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	req.Header.Set("Authorization", "Bearer "+aiRequest.OpenAIAPIKey)
+	tracing.Inject(ctx, req.Header)
+
+	// A reply may stream for longer than the chat timeout, which only bounds
+	// the wait for it to start
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = aiTimeouts.Chat
+	httpResp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		log.Printf("[ERROR] AI service stream failed: %v", err)
+		return nil, errAIUnavailable
+	}
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+		return httpResp, nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		httpResp.Body.Close()
+		return nil, nil
+	default:
+		defer httpResp.Body.Close()
+		svcErr := &aiServiceError{StatusCode: httpResp.StatusCode}
+		responseBody, _ := io.ReadAll(httpResp.Body)
+		_ = json.Unmarshal(responseBody, &svcErr.Body)
+		return nil, svcErr
+	}
+}
+
+// relayAIChatStream reads the events of an AI service stream, passing each
+// token to send, and returns the response of its done event
+func relayAIChatStream(body io.Reader, send func(token string) error) (*DemoChatResponse, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			continue
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		case line != "":
+			continue // comments and fields we don't use
+		}
+		if len(data) == 0 {
+			event = ""
+			continue
+		}
+
+		payload := []byte(strings.Join(data, "\n"))
+		switch event {
+		case sseEventToken:
+			var t struct {
+				Token string `json:"token"`
+			}
+			if err := json.Unmarshal(payload, &t); err != nil {
+				return nil, fmt.Errorf("failed to parse AI stream: %w", err)
+			}
+			if err := send(t.Token); err != nil {
+				return nil, err
+			}
+		case sseEventDone:
+			var aiResponse DemoChatResponse
+			if err := json.Unmarshal(payload, &aiResponse); err != nil {
+				return nil, fmt.Errorf("failed to parse AI response: %w", err)
+			}
+			return &aiResponse, nil
+		case sseEventError:
+			svcErr := &aiServiceError{StatusCode: http.StatusBadGateway}
+			_ = json.Unmarshal(payload, &svcErr.Body)
+			return nil, svcErr
+		}
+		event, data = "", nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read AI stream: %w", err)
+	}
+	return nil, errors.New("AI stream ended without a reply")
+}
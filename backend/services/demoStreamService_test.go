@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"manju/backend/repository"
+	"manju/backend/repository/repotest"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDemoProjectStream(t *testing.T) {
+	tests := []struct {
+		name string
+		// stream is what the AI service's /chat/stream sends, one event per
+		// chunk; nil means it has no streaming endpoint
+		stream []string
+		// reply is what its /chat answers with
+		reply      string
+		wantTokens []string
+		wantReply  string
+	}{
+		{
+			name: "AI service streams the reply",
+			stream: []string{
+				"event: token\ndata: {\"token\":\"Hello\"}\n\n",
+				"event: token\ndata: {\"token\":\" there\"}\n\n",
+				"event: token\ndata: {\"token\":\" friend\"}\n\n",
+			},
+			wantTokens: []string{"Hello", " there", " friend"},
+			wantReply:  "Hello there friend",
+		},
+		{
+			name:       "AI service without streaming is sent in chunks",
+			reply:      "one two three four five six seven eight nine ten eleven twelve",
+			wantTokens: []string{"one two three four ", "five six seven eight ", "nine ten eleven twelve"},
+			wantReply:  "one two three four five six seven eight nine ten eleven twelve",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := repotest.OpenDB(t, "manju", &repository.Project{}, &repository.UserAPIKey{}, &repository.Execution{})
+			prevDB := repository.GetDB()
+			repository.SetDB(db)
+			t.Cleanup(func() { repository.SetDB(prevDB) })
+
+			recorder := tracetest.NewSpanRecorder()
+			prevProvider := otel.GetTracerProvider()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			t.Cleanup(func() { otel.SetTracerProvider(prevProvider) })
+
+			userID := uuid.New()
+			encrypted, err := EncryptAPIKey("sk-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Create(&repository.UserAPIKey{UserID: userID, Label: "Default", EncryptedKey: encrypted, IsDefault: true}).Error; err != nil {
+				t.Fatalf("create key: %v", err)
+			}
+			project := repository.Project{ID: uuid.New(), UserID: userID, Name: "demo", Status: repository.ProjectStatusDraft}
+			if err := db.Create(&project).Error; err != nil {
+				t.Fatalf("create project: %v", err)
+			}
+
+			// The last chunk waits a moment so the reply is still being
+			// streamed after the handler has returned
+			finished := make(chan time.Time, 1)
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+					t.Errorf("AI service got Authorization %q, want the user's key", got)
+				}
+				switch {
+				case r.URL.Path == "/chat/stream" && tt.stream == nil:
+					http.NotFound(w, r)
+				case r.URL.Path == "/chat/stream":
+					w.Header().Set("Content-Type", "text/event-stream")
+					for i, chunk := range tt.stream {
+						if i == len(tt.stream)-1 {
+							time.Sleep(50 * time.Millisecond)
+						}
+						io.WriteString(w, chunk)
+						w.(http.Flusher).Flush()
+					}
+					done, _ := json.Marshal(DemoChatResponse{Response: tt.wantReply})
+					fmt.Fprintf(w, "event: done\ndata: %s\n\n", done)
+					finished <- time.Now()
+				default:
+					json.NewEncoder(w).Encode(DemoChatResponse{Response: tt.reply})
+					finished <- time.Now()
+				}
+			}))
+			defer upstream.Close()
+			t.Setenv("AI_SERVICE_URL", upstream.URL)
+
+			app := fiber.New()
+			app.Post("/projects/:id/demo/stream", func(c *fiber.Ctx) error {
+				c.Locals("userID", userID.String())
+				return DemoProjectStream(c, repository.NewProject(db))
+			})
+			req := httptest.NewRequest("POST", "/projects/"+project.ID.String()+"/demo/stream", strings.NewReader(`{"message":"hi"}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Fatalf("Content-Type = %q, want text/event-stream", got)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every event is an event line and a data line ending in a blank line
+			frames := strings.SplitAfter(string(body), "\n\n")
+			if frames[len(frames)-1] != "" {
+				t.Fatalf("stream doesn't end with a complete event: %q", body)
+			}
+			frames = frames[:len(frames)-1]
+			if len(frames) != len(tt.wantTokens)+1 {
+				t.Fatalf("got %d events, want %d tokens and done: %q", len(frames), len(tt.wantTokens), body)
+			}
+			for i, token := range tt.wantTokens {
+				data, _ := json.Marshal(fiber.Map{"token": token})
+				if want := fmt.Sprintf("event: token\ndata: %s\n\n", data); frames[i] != want {
+					t.Errorf("event %d = %q, want %q", i, frames[i], want)
+				}
+			}
+			done, ok := strings.CutPrefix(frames[len(frames)-1], "event: done\ndata: ")
+			if !ok {
+				t.Fatalf("last event = %q, want done", frames[len(frames)-1])
+			}
+			var reply DemoChatResponse
+			if err := json.Unmarshal([]byte(done), &reply); err != nil {
+				t.Fatalf("done data: %v", err)
+			}
+			if reply.Response != tt.wantReply {
+				t.Errorf("done reply = %q, want %q", reply.Response, tt.wantReply)
+			}
+
+			var execution repository.Execution
+			if err := db.Where("project_id = ?", project.ID).First(&execution).Error; err != nil {
+				t.Fatalf("execution not recorded: %v", err)
+			}
+			if execution.Status != repository.ExecutionSucceeded || execution.Response != tt.wantReply {
+				t.Errorf("execution = %s %q, want succeeded %q", execution.Status, execution.Response, tt.wantReply)
+			}
+
+			var span sdktrace.ReadOnlySpan
+			for _, s := range recorder.Ended() {
+				if s.Name() == "DemoProjectStream" {
+					span = s
+				}
+			}
+			if span == nil {
+				t.Fatal("DemoProjectStream span not ended")
+			}
+			if at := <-finished; span.EndTime().Before(at) {
+				t.Errorf("span ended %v before the AI service finished the reply", at.Sub(span.EndTime()))
+			}
+		})
+	}
+}
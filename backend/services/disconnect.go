@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errClientGone is the cause of a disconnectContext cancelled because the
+// client closed its connection
+var errClientGone = errors.New("client closed the connection")
+
+// clientGonePollInterval is how often disconnectContext checks the connection
+const clientGonePollInterval = 250 * time.Millisecond
+
+// disconnectContext returns a copy of ctx that is cancelled with
+// errClientGone when the client of c closes its connection. fasthttp only
+// notices a closed connection when it writes the response, like writeSSE
+// does for a stream, so a handler waiting on the AI service uses it to cancel
+// that call. The caller calls cancel once it is done waiting.
+func disconnectContext(c *fiber.Ctx, ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancelCause := context.WithCancelCause(ctx)
+	cancel := func() { cancelCause(nil) }
+
+	conn, ok := c.Context().Conn().(syscall.Conn)
+	if !ok {
+		return ctx, cancel
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return ctx, cancel
+	}
+	go func() {
+		ticker := time.NewTicker(clientGonePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if connClosed(raw) {
+					cancelCause(errClientGone)
+					return
+				}
+			}
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package services
+
+import "syscall"
+
+// connClosed can't tell whether the client is gone on this platform, so AI
+// service calls run to completion
+func connClosed(raw syscall.RawConn) bool {
+	return false
+}
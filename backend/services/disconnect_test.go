@@ -0,0 +1,64 @@
+package services
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDisconnectContextCancelsAIServiceCall(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the call being cancelled once the body is read
+		io.Copy(io.Discard, r.Body)
+		close(started)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+	t.Setenv("AI_SERVICE_URL", upstream.URL)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Post("/demo", func(c *fiber.Ctx) error {
+		ctx, cancel := disconnectContext(c, c.UserContext())
+		defer cancel()
+		_, err := callAIChat(ctx, DemoChatRequest{Message: "hi"})
+		return err
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("POST /demo HTTP/1.1\r\nHost: test\r\nContent-Length: 0\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AI service call was not made")
+	}
+	conn.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AI service call was not cancelled after the client disconnected")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package services
+
+import "syscall"
+
+// connClosed reports whether the peer of a connection has closed it. It
+// peeks at the socket, so a request the client pipelines is left for the
+// server to read.
+func connClosed(raw syscall.RawConn) bool {
+	closed := false
+	err := raw.Read(func(fd uintptr) bool {
+		var buf [1]byte
+		n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK)
+		switch {
+		case err == nil:
+			closed = n == 0
+		case err != syscall.EAGAIN && err != syscall.EWOULDBLOCK && err != syscall.EINTR:
+			closed = true
+		}
+		return true // never wait for data
+	})
+	return closed || err != nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"manju/backend/repository"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// CopyProjectDocuments copies the documents of one project into another, so
+// a duplicated or imported project keeps its knowledge base. Each file is
+// copied in document storage under a new document ID, the destination's
+// rag-documents nodes are pointed at the copies and an embedding job is
+// queued for them. nodeIDs maps the source's node IDs to the destination's,
+// so each copy stays with the node it was uploaded for. Trashed documents and
+// earlier versions are not copied. If a step fails, the files and rows copied
+// so far are removed.
+func CopyProjectDocuments(srcUserID, srcProjectID, dstUserID, dstProjectID uuid.UUID, nodeIDs map[string]string) error {
+	ctx := context.Background()
+	projectRepo := repository.NewProject(repository.GetDB())
+	docRepo := repository.NewDocument(repository.GetDB())
+
+	src, err := projectRepo.GetByID(srcProjectID.String())
+	if err != nil {
+		return fmt.Errorf("source project %s: %w", srcProjectID, err)
+	}
+	if src.UserID != srcUserID {
+		return fmt.Errorf("source project %s is not owned by user %s", srcProjectID, srcUserID)
+	}
+	dst, err := projectRepo.GetByID(dstProjectID.String())
+	if err != nil {
+		return fmt.Errorf("destination project %s: %w", dstProjectID, err)
+	}
+	if dst.UserID != dstUserID {
+		return fmt.Errorf("destination project %s is not owned by user %s", dstProjectID, dstUserID)
+	}
+
+	docs, err := docRepo.ListByProject(src.ID.String())
+	if err != nil {
+		return err
+	}
+	var size int64
+	live := docs[:0]
+	for _, doc := range docs {
+		if doc.DeletedAt == nil {
+			live = append(live, doc)
+			size += doc.Size
+		}
+	}
+	if len(live) == 0 {
+		return nil
+	}
+	if quotaErr := checkStorageQuota(docRepo, dstUserID.String(), size); quotaErr != nil {
+		return errors.New(quotaErr.message)
+	}
+
+	copies, ids, err := copyDocumentFiles(ctx, live, dst, nodeIDs)
+	if err != nil {
+		return err
+	}
+	if err := docRepo.CreateMissing(copies); err != nil {
+		removeCopiedDocuments(ctx, nil, copies)
+		return fmt.Errorf("failed to store documents: %w", err)
+	}
+
+	if err := pointNodesAtCopies(projectRepo, dst, ids); err != nil {
+		removeCopiedDocuments(ctx, docRepo, copies)
+		return err
+	}
+
+	job := &repository.EmbeddingJob{ProjectID: dst.ID, UserID: dstUserID}
+	if _, err := enqueueEmbeddingJob(ctx, job, dst.UserID.String(), projectDocumentDir(dst)); err != nil {
+		log.Printf("[documents] failed to queue embedding of copied documents of project %s: %v", dst.ID, err)
+	}
+	return nil
+}
+
+// copyDocumentFiles copies the files of docs into dst's document directory
+// and returns the rows of the copies, with new IDs and nodes mapped by
+// nodeIDs, and the new ID of each original. On failure the files copied so
+// far are removed.
+func copyDocumentFiles(ctx context.Context, docs []repository.Document, dst *repository.Project, nodeIDs map[string]string) ([]repository.Document, map[string]string, error) {
+	docDir := projectDocumentDir(dst)
+	copies := make([]repository.Document, 0, len(docs))
+	ids := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		newID := fmt.Sprintf("doc-%s", uuid.New().String()[:8])
+		ext := strings.ToLower(filepath.Ext(doc.StoredPath))
+		key := filepath.Join(docDir, documentFileName(newID, 1, ext))
+		if err := copyDocumentFile(ctx, doc.StoredPath, key, doc.Size); err != nil {
+			removeCopiedDocuments(ctx, nil, copies)
+			return nil, nil, fmt.Errorf("failed to copy document %s: %w", doc.Name, err)
+		}
+		ids[doc.ID] = newID
+		copies = append(copies, repository.Document{
+			ID:          newID,
+			ProjectID:   dst.ID,
+			UserID:      dst.UserID,
+			NodeID:      nodeIDs[doc.NodeID],
+			Name:        doc.Name,
+			StoredPath:  key,
+			Size:        doc.Size,
+			ContentType: doc.ContentType,
+			Status:      doc.Status,
+			ContentHash: doc.ContentHash,
+			Columns:     doc.Columns,
+			RowCount:    doc.RowCount,
+			ParseErrors: doc.ParseErrors,
+		})
+	}
+	return copies, ids, nil
+}
+
+// removeCopiedDocuments deletes the files of copied documents and, with a
+// docRepo, their rows
+func removeCopiedDocuments(ctx context.Context, docRepo *repository.DocumentRepository, copies []repository.Document) {
+	for _, doc := range copies {
+		if docRepo != nil {
+			if err := docRepo.Delete(doc.ProjectID.String(), doc.ID); err != nil {
+				log.Printf("[documents] failed to remove copied document %s: %v", doc.ID, err)
+			}
+		}
+		if err := documentStorage.Delete(ctx, doc.StoredPath); err != nil {
+			log.Printf("[documents] failed to remove copied file %s: %v", doc.StoredPath, err)
+		}
+	}
+}
+
+// pointNodesAtCopies rewrites the document references of project's
+// rag-documents nodes by ids and saves the project
+func pointNodesAtCopies(repo *repository.ProjectRepository, project *repository.Project, ids map[string]string) error {
+	var nodes []map[string]interface{}
+	if len(project.Nodes) > 0 {
+		if err := json.Unmarshal(project.Nodes, &nodes); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidNodes, err)
+		}
+	}
+	if nodes == nil {
+		nodes = []map[string]interface{}{}
+	}
+	remapNodeDocuments(nodes, ids)
+	nodesJSON, err := json.Marshal(nodes)
+	if err != nil {
+		return err
+	}
+	project.Nodes = datatypes.JSON(nodesJSON)
+	if _, err := repo.Update(project); err != nil {
+		return fmt.Errorf("failed to update project: %w", err)
+	}
+	return nil
+}
+
+// remapNodeDocuments points the document references of rag-documents nodes
+// at new IDs. References missing from ids are dropped and their old IDs
+// returned.
+func remapNodeDocuments(nodes []map[string]interface{}, ids map[string]string) []string {
+	var dropped []string
+	for _, node := range nodes {
+		if t, _ := node["type"].(string); t != "rag-documents" {
+			continue
+		}
+		data := nodeData(node)
+		docs, ok := data["documents"].([]interface{})
+		if !ok {
+			continue
+		}
+		kept := make([]interface{}, 0, len(docs))
+		for _, d := range docs {
+			doc, ok := d.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			oldID, _ := doc["id"].(string)
+			newID, exists := ids[oldID]
+			if !exists {
+				dropped = append(dropped, oldID)
+				continue
+			}
+			doc["id"] = newID
+			kept = append(kept, doc)
+		}
+		data["documents"] = kept
+	}
+	return dropped
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestDuplicateProjectCopiesDocuments(t *testing.T) {
+	db := useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[
+		{"id":"docs","type":"rag-documents","position":{"x":0,"y":0},"data":{}},
+		{"id":"sheet","type":"google-sheets","position":{"x":200,"y":0},"data":{}}
+	]`)
+	upload := func(nodeID string, file testFile) {
+		t.Helper()
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+			return UploadDocument(c, repository.NewProject(db))
+		}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", map[string]string{"nodeId": nodeID}, file))
+		if body := readBody(t, resp); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("upload %s: status %d: %s", file.name, resp.StatusCode, body)
+		}
+	}
+	upload("docs", testFile{"notes.txt", "leave policy\n"})
+	upload("sheet", testFile{"holidays.csv", "date,name\n2024-04-13,Songkran\n"})
+
+	docRepo := repository.NewDocument(db)
+	originals, err := docRepo.ListByProject(project.ID.String())
+	if err != nil || len(originals) != 2 {
+		t.Fatalf("source documents %v: %v", originals, err)
+	}
+
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/duplicate", func(c *fiber.Ctx) error {
+		return DuplicateProject(c, repository.NewProject(db))
+	}, newRequest("POST", "/projects/"+project.ID.String()+"/duplicate", "application/json", strings.NewReader(`{}`)))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("duplicate: status %d: %s", resp.StatusCode, body)
+	}
+	var duplicate repository.Project
+	if err := json.Unmarshal(body, &duplicate); err != nil {
+		t.Fatalf("duplicate response %s: %v", body, err)
+	}
+
+	copies, err := docRepo.ListByProject(duplicate.ID.String())
+	if err != nil || len(copies) != len(originals) {
+		t.Fatalf("copied documents %v: %v, want %d", copies, err, len(originals))
+	}
+	originalIDs := map[string]bool{}
+	for _, doc := range originals {
+		originalIDs[doc.ID] = true
+	}
+	nodes, _ := parseWorkflow(&duplicate)
+	nodeTypes := map[string]string{}
+	for _, node := range nodes {
+		id, _ := node["id"].(string)
+		nodeTypes[id], _ = node["type"].(string)
+	}
+	copyIDs := map[string]repository.Document{}
+	for _, doc := range copies {
+		copyIDs[doc.ID] = doc
+		if originalIDs[doc.ID] {
+			t.Errorf("copy kept the original ID %s", doc.ID)
+		}
+		// Each copy stays with the duplicate's counterpart of its node
+		if nodeType, ok := nodeTypes[doc.NodeID]; !ok || !nodeTakesDocument(nodeType, &doc) {
+			t.Errorf("copy %s (%s) belongs to node %q, want a node of the duplicate that takes it", doc.ID, doc.Name, doc.NodeID)
+		}
+		content, err := os.ReadFile(doc.StoredPath)
+		if err != nil || !strings.HasPrefix(doc.StoredPath, projectDocumentDir(&duplicate)) {
+			t.Errorf("copy %s stored at %s: %v", doc.ID, doc.StoredPath, err)
+		} else if (doc.Name == "notes.txt") != (string(content) == "leave policy\n") {
+			t.Errorf("copy %s (%s) reads %q", doc.ID, doc.Name, content)
+		}
+	}
+
+	// The duplicate's rag-documents node lists the copied rows, not the originals
+	var listed []string
+	for _, node := range nodes {
+		if node["type"] != "rag-documents" {
+			continue
+		}
+		documents, _ := nodeData(node)["documents"].([]interface{})
+		for _, d := range documents {
+			doc, _ := d.(map[string]interface{})
+			id, _ := doc["id"].(string)
+			listed = append(listed, id)
+			if copied, ok := copyIDs[id]; !ok {
+				t.Errorf("duplicate node lists %s, which is not a copied document", id)
+			} else if doc["name"] != copied.Name {
+				t.Errorf("duplicate node lists %s as %v, want %s", id, doc["name"], copied.Name)
+			}
+		}
+	}
+	if len(listed) != 1 {
+		t.Errorf("duplicate rag-documents nodes list %v, want the copy of notes.txt", listed)
+	}
+
+	// The source project still lists its own documents
+	source, err := repository.NewProject(db).GetByID(project.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceDocs, _ := nodeDataByID(source)["docs"]["documents"].([]interface{})
+	if len(sourceDocs) != 1 || !originalIDs[sourceDocs[0].(map[string]interface{})["id"].(string)] {
+		t.Errorf("source node lists %v after duplicating, want its original document", sourceDocs)
+	}
+}
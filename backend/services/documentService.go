@@ -2,17 +2,36 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"manju/backend/events"
+	"manju/backend/metrics"
+	"manju/backend/models/response"
 	"manju/backend/repository"
+	"manju/backend/scanner"
+	"manju/backend/storage"
+	"manju/backend/tracing"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // DocumentInfo represents uploaded document metadata
@@ -23,10 +42,307 @@ type DocumentInfo struct {
 	Size       int64     `json:"size"`
 	UploadedAt time.Time `json:"uploadedAt"`
 	Status     string    `json:"status"`
+	Version    int       `json:"version"`
 	FilePath   string    `json:"filePath,omitempty"`
+	// ContentHash is the hex SHA-256 of the file, used to skip duplicate uploads
+	ContentHash string `json:"contentHash,omitempty"`
+	// Deduplicated is set when the upload was identical to one already
+	// stored and no second copy was written
+	Deduplicated bool `json:"deduplicated,omitempty"`
+	// EmbeddingStatus is whether the document's vectors are in the project's
+	// index: pending, embedded, failed or stale
+	EmbeddingStatus string `json:"embedding_status,omitempty"`
+	// Columns, RowCount and ParseErrors are set for CSV and spreadsheet
+	// documents
+	Columns     []string        `json:"columns,omitempty"`
+	RowCount    int             `json:"rowCount,omitempty"`
+	ParseErrors []RowParseError `json:"parseErrors,omitempty"`
 }
 
-// getDocumentsStoragePath returns the base path for document storage
+// defaultDocumentTypes lists the file extensions accepted for upload unless
+// ALLOWED_DOCUMENT_TYPES overrides them
+const defaultDocumentTypes = ".pdf,.docx,.txt,.doc,.md,.csv,.xlsx"
+
+// getAllowedDocumentTypes returns the file extensions accepted for upload,
+// read from ALLOWED_DOCUMENT_TYPES (comma separated, leading dot optional)
+func getAllowedDocumentTypes() []string {
+	list := os.Getenv("ALLOWED_DOCUMENT_TYPES")
+	if strings.TrimSpace(list) == "" {
+		list = defaultDocumentTypes
+	}
+	var types []string
+	for _, t := range strings.Split(list, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if !strings.HasPrefix(t, ".") {
+			t = "." + t
+		}
+		types = append(types, t)
+	}
+	return types
+}
+
+// allowedDocumentExt reports whether files with extension ext may be uploaded
+func allowedDocumentExt(ext string) bool {
+	ext = strings.ToLower(ext)
+	for _, t := range getAllowedDocumentTypes() {
+		if t == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeDocumentTypes lists the file extensions each node type takes when an
+// upload names the node it is for. Node types missing here take no documents.
+var nodeDocumentTypes = map[string][]string{
+	"rag-documents": {".pdf", ".docx", ".doc", ".txt", ".md"},
+	"google-sheets": {".csv", ".xlsx"},
+}
+
+// uploadDocumentTypes returns the file extensions an upload for nodeID may
+// have: those of the node's type that the global allowlist also permits, or
+// without a node the global allowlist.
+func uploadDocumentTypes(project *repository.Project, nodeID string) ([]string, *uploadError) {
+	if nodeID == "" {
+		return getAllowedDocumentTypes(), nil
+	}
+	var nodes []map[string]interface{}
+	if len(project.Nodes) > 0 {
+		if err := json.Unmarshal(project.Nodes, &nodes); err != nil {
+			return nil, &uploadError{http.StatusUnprocessableEntity, response.ErrCodeInvalidWorkflow, "project nodes are not valid JSON", nil}
+		}
+	}
+	for _, node := range nodes {
+		if id, _ := node["id"].(string); id != nodeID {
+			continue
+		}
+		nodeType, _ := node["type"].(string)
+		nodeTypes, ok := nodeDocumentTypes[nodeType]
+		if !ok {
+			return nil, &uploadError{http.StatusBadRequest, response.ErrCodeBadRequest, "node does not take documents", fiber.Map{
+				"node_id":   nodeID,
+				"node_type": nodeType,
+			}}
+		}
+		types := []string{}
+		for _, t := range nodeTypes {
+			if allowedDocumentExt(t) {
+				types = append(types, t)
+			}
+		}
+		return types, nil
+	}
+	return nil, &uploadError{http.StatusNotFound, response.ErrCodeNotFound, "node not found", fiber.Map{"node_id": nodeID}}
+}
+
+// nodeTakesDocument reports whether nodes of nodeType take the file type of doc
+func nodeTakesDocument(nodeType string, doc *repository.Document) bool {
+	return slices.Contains(nodeDocumentTypes[nodeType], strings.ToLower(filepath.Ext(doc.StoredPath)))
+}
+
+// documentSignatures are the leading bytes of binary document formats
+var documentSignatures = map[string][]byte{
+	".pdf":  []byte("%PDF-"),
+	".docx": []byte("PK\x03\x04"), // Office Open XML is a zip archive
+	".xlsx": []byte("PK\x03\x04"),
+	".doc":  {0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, // OLE compound file
+}
+
+// documentTextExts are formats that must sniff as text
+var documentTextExts = map[string]bool{".txt": true, ".md": true, ".csv": true}
+
+// documentContentMatches reports whether the leading bytes of a file are
+// plausible for its extension, so a renamed binary is not accepted as a
+// document. Extensions without a known format are not checked.
+func documentContentMatches(head []byte, ext string) bool {
+	if sig, ok := documentSignatures[ext]; ok {
+		return bytes.HasPrefix(head, sig)
+	}
+	if documentTextExts[ext] {
+		return len(head) == 0 || strings.HasPrefix(http.DetectContentType(head), "text/")
+	}
+	return true
+}
+
+// uploadedFile is the content of one upload: a multipart form file, or the
+// assembled chunks of a resumable upload
+type uploadedFile struct {
+	Name string
+	Size int64
+	Open func() (io.ReadCloser, error)
+}
+
+// multipartFile adapts a multipart form file
+func multipartFile(file *multipart.FileHeader) uploadedFile {
+	return uploadedFile{file.Filename, file.Size, func() (io.ReadCloser, error) { return file.Open() }}
+}
+
+// sniffDocument reads the first bytes of an uploaded file and checks them
+// against its extension
+func sniffDocument(file uploadedFile, ext string) (bool, error) {
+	f, err := file.Open()
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return documentContentMatches(head[:n], ext), nil
+}
+
+// getMaxDocumentSize returns the largest document that may be uploaded, in bytes
+func getMaxDocumentSize() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("MAX_DOCUMENT_SIZE"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 25 << 20 // 25 MB
+}
+
+// getStorageQuota returns how many bytes of documents, outside the trash,
+// a user may store
+func getStorageQuota() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("STORAGE_QUOTA_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 1 << 30 // 1 GB
+}
+
+// storageQuotaUsed returns the bytes a user's documents count against the
+// quota: those stored on disk that are not in the trash, and the earlier
+// versions of re-uploaded documents
+func storageQuotaUsed(docRepo *repository.DocumentRepository, userID string) (int64, error) {
+	usage, err := docRepo.StorageByUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	versions, err := docRepo.VersionBytesByUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	return usage.StoredBytes - usage.TrashBytes + versions, nil
+}
+
+// checkStorageQuota fails when storing size more bytes would take a user
+// over the quota
+func checkStorageQuota(docRepo *repository.DocumentRepository, userID string, size int64) *uploadError {
+	used, err := storageQuotaUsed(docRepo, userID)
+	if err != nil {
+		return &uploadError{http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil}
+	}
+	if quota := getStorageQuota(); used+size > quota {
+		return &uploadError{http.StatusRequestEntityTooLarge, response.ErrCodeStorageQuotaExceeded, "storage quota exceeded", fiber.Map{
+			"size":        size,
+			"used_bytes":  used,
+			"quota_bytes": quota,
+		}}
+	}
+	return nil
+}
+
+// documentContentTypes maps document extensions to the Content-Type they are
+// served with, so browsers preview them instead of downloading octet-streams
+var documentContentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".txt":  "text/plain; charset=utf-8",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".doc":  "application/msword",
+	".md":   "text/markdown; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// documentMIMEType returns the MIME type reported for a document extension
+func documentMIMEType(ext string) string {
+	ext = strings.ToLower(ext)
+	if contentType, ok := documentContentTypes[ext]; ok {
+		mime, _, _ := strings.Cut(contentType, ";")
+		return mime
+	}
+	return strings.TrimPrefix(ext, ".")
+}
+
+// documentArchived is the status of documents moved to archive storage along
+// with their archived project
+const documentArchived = "archived"
+
+// documentStatuses lists the states a document can be set to
+var documentStatuses = map[string]bool{"ready": true, "processing": true, "embedding": true, "error": true}
+
+// documentStorage holds document files; see InitDocumentStorage
+var documentStorage storage.Storage = storage.NewLocal()
+
+// InitDocumentStorage selects the document storage backend from the
+// environment (STORAGE_BACKEND, see storage.FromEnv)
+func InitDocumentStorage() error {
+	s, err := storage.FromEnv()
+	if err != nil {
+		return err
+	}
+	documentStorage = s
+	return nil
+}
+
+// documentScanner checks uploads for malware; see InitDocumentScanner
+var documentScanner scanner.Scanner = scanner.Noop{}
+
+// InitDocumentScanner selects the malware scanner from the environment
+// (SCANNER_BACKEND, see scanner.FromEnv)
+func InitDocumentScanner() error {
+	s, err := scanner.FromEnv()
+	if err != nil {
+		return err
+	}
+	documentScanner = s
+	return nil
+}
+
+// scanFailOpen reports whether uploads are accepted unscanned when the
+// scanner can't be reached (SCANNER_FAIL_MODE=open) instead of refused
+func scanFailOpen() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("SCANNER_FAIL_MODE")), "open")
+}
+
+// scanUploadedFile runs an upload through the malware scanner. Infected
+// files are refused and recorded in the activity log.
+func scanUploadedFile(c *fiber.Ctx, project *repository.Project, file uploadedFile) *uploadError {
+	f, err := file.Open()
+	if err != nil {
+		return &uploadError{http.StatusBadRequest, response.ErrCodeBadRequest, "failed to read file", nil}
+	}
+	defer f.Close()
+
+	result, err := documentScanner.Scan(c.UserContext(), f)
+	if err != nil {
+		metrics.Inc("document_scan_failures")
+		if scanFailOpen() {
+			log.Printf("[documents] accepting %s unscanned: %v", file.Name, err)
+			return nil
+		}
+		log.Printf("[documents] failed to scan %s: %v", file.Name, err)
+		return &uploadError{http.StatusServiceUnavailable, response.ErrCodeUnavailable, "malware scanner is unavailable, try again later", nil}
+	}
+	if result.Infected {
+		metrics.Inc("documents_infected")
+		RecordAudit(c, "document.malware_detected", "project", project.ID.String(), fiber.Map{
+			"name":      file.Name,
+			"signature": result.Signature,
+		})
+		return &uploadError{http.StatusUnprocessableEntity, response.ErrCodeMalwareDetected, "file contains malware", fiber.Map{
+			"signature": result.Signature,
+		}}
+	}
+	return nil
+}
+
+// getDocumentsStoragePath returns the base path for document storage. With
+// an object store it is the key prefix of document objects.
 func getDocumentsStoragePath() string {
 	path := os.Getenv("DOCUMENTS_STORAGE_PATH")
 	if path == "" {
@@ -47,399 +363,1753 @@ func ensureUserDocumentDir(userID, projectID string) (string, error) {
 	return userPath, nil
 }
 
-// triggerEmbedding calls the AI service to embed documents
-func triggerEmbedding(userID, projectID, documentsPath string) error {
-	aiServiceURL := getAIServiceURL()
+// projectDocumentDir returns the document directory of a project without creating it
+func projectDocumentDir(project *repository.Project) string {
+	return filepath.Join(getDocumentsStoragePath(), project.UserID.String(), project.ID.String())
+}
 
-	// Get absolute path
-	absPath, err := filepath.Abs(documentsPath)
+// getArchiveStoragePath returns the base path archived projects' documents
+// are moved to
+func getArchiveStoragePath() string {
+	path := os.Getenv("ARCHIVE_STORAGE_PATH")
+	if path == "" {
+		path = "./uploads/archive"
+	}
+	return path
+}
+
+// projectArchiveDir returns where a project's documents are kept while it is archived
+func projectArchiveDir(project *repository.Project) string {
+	return filepath.Join(getArchiveStoragePath(), project.UserID.String(), project.ID.String())
+}
+
+// moveProjectDocuments moves the files of a project's documents from the
+// directory src to dst, repoints their stored paths and sets the status of
+// those not in the trash. The rag-documents node of project is updated; the
+// caller saves the project.
+func moveProjectDocuments(docRepo *repository.DocumentRepository, project *repository.Project, src, dst, status string) error {
+	docs, err := docRepo.ListByProject(project.ID.String())
+	if err != nil {
+		return err
+	}
+	for i := range docs {
+		doc := &docs[i]
+		if !withinDir(src, doc.StoredPath) {
+			continue
+		}
+		rel, _ := filepath.Rel(src, doc.StoredPath)
+		moved := filepath.Join(dst, rel)
+		if err := storage.Move(context.Background(), documentStorage, doc.StoredPath, moved); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		removeDocumentPreview(context.Background(), doc.StoredPath)
+		doc.StoredPath = moved
+		if doc.DeletedAt == nil {
+			doc.Status = status
+		}
+		if err := docRepo.UpdateStorage(doc); err != nil {
+			return err
+		}
+	}
+	if err := moveDocumentVersions(docRepo, project.ID.String(), src, dst); err != nil {
+		return err
+	}
+	return setNodeDocuments(project, docs)
+}
+
+// deleteEmbeddingIndex asks the AI service to drop a project's document index
+func deleteEmbeddingIndex(ctx context.Context, userID, projectID string) (err error) {
+	ctx, span := tracing.Start(ctx, "ai.delete-index")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	jsonBody, _ := json.Marshal(map[string]string{
+		"user_id":    userID,
+		"project_id": projectID,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", getAIServiceURL()+"/delete-index", bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	tracing.Inject(ctx, req.Header)
+
+	client := &http.Client{Timeout: aiTimeouts.Embed}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call AI service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("AI service error: %s", string(body))
+	}
+	return nil
+}
+
+// cleanupProjectData removes everything a deleted project left outside the
+// database: its document files, thumbnail, cached stats and, best-effort,
+// its embedding index on the AI service.
+func cleanupProjectData(project *repository.Project) {
+	projectID := project.ID.String()
+	for _, dir := range []string{projectDocumentDir(project), projectArchiveDir(project)} {
+		if err := storage.DeletePrefix(context.Background(), documentStorage, dir); err != nil {
+			log.Printf("[cleanup] failed to remove documents of project %s: %v", projectID, err)
+		}
+	}
+	removeThumbnail(projectID)
+	removeWorkflowPreview(projectID)
+	invalidateProjectStats(projectID)
+
+	go func() {
+		if err := deleteEmbeddingIndex(context.Background(), project.UserID.String(), projectID); err != nil {
+			log.Printf("[cleanup] failed to delete embedding index of project %s: %v", projectID, err)
+		}
+	}()
+}
+
+// triggerEmbedding calls the AI service to embed documents. documentsPath is
+// the project's document directory, or a single file when documentIDs limits
+// the run to those documents.
+func triggerEmbedding(ctx context.Context, userID, projectID, documentsPath string, documentIDs []string) (err error) {
+	ctx, span := tracing.Start(ctx, "ai.embed-documents")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	aiServiceURL := getAIServiceURL()
 
 	// Create request body
-	reqBody := map[string]string{
-		"documents_path": absPath,
-		"user_id":        userID,
-		"project_id":     projectID,
+	reqBody := map[string]interface{}{
+		"user_id":    userID,
+		"project_id": projectID,
+	}
+	if len(documentIDs) > 0 {
+		reqBody["document_ids"] = documentIDs
+	}
+	if _, ok := storage.LocalPath(documentStorage, documentsPath); ok && !deliverDocumentsByURL() {
+		// Get absolute path
+		absPath, err := filepath.Abs(documentsPath)
+		if err != nil {
+			return err
+		}
+		reqBody["documents_path"] = absPath
+	} else {
+		// The AI service can't see the files; hand it download links
+		urls, err := documentURLs(ctx, projectID, documentIDs)
+		if err != nil {
+			return err
+		}
+		reqBody["document_urls"] = urls
 	}
 	jsonBody, _ := json.Marshal(reqBody)
 
 	// Make request to AI service
-	resp, err := http.Post(
-		aiServiceURL+"/embed-documents",
-		"application/json",
-		bytes.NewBuffer(jsonBody),
-	)
+	req, err := http.NewRequestWithContext(ctx, "POST", aiServiceURL+"/embed-documents", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	tracing.Inject(ctx, req.Header)
+
+	client := &http.Client{Timeout: aiTimeouts.Embed}
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to call AI service: %w", err)
 	}
-	defer resp.Body.Close()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("AI service error: %s", string(body))
+	}
+
+	// Failures inside the AI service are reported with a 200 and success=false
+	var result struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && !result.Success {
+		return fmt.Errorf("AI service error: %s", result.Error)
+	}
+
+	return nil
+}
+
+// documentURLTTL is how long the AI service has to download a document
+const documentURLTTL = 15 * time.Minute
+
+// documentURLs returns download links for the documents of a project not in
+// the trash, limited to documentIDs when given
+func documentURLs(ctx context.Context, projectID string, documentIDs []string) ([]map[string]string, error) {
+	docs, err := repository.NewDocument(repository.GetDB()).WithContext(ctx).ListByProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	wanted := map[string]bool{}
+	for _, id := range documentIDs {
+		wanted[id] = true
+	}
+	urls := []map[string]string{}
+	for _, doc := range docs {
+		if doc.DeletedAt != nil || (len(wanted) > 0 && !wanted[doc.ID]) || !nodeTakesDocument("rag-documents", &doc) {
+			continue
+		}
+		url, err := documentDownloadURL(ctx, &doc)
+		if err != nil {
+			return nil, err
+		}
+		// The AI service identifies documents by their stored file name
+		urls = append(urls, map[string]string{"id": doc.ID, "name": filepath.Base(doc.StoredPath), "url": url})
+	}
+	return urls, nil
+}
+
+// deleteDocumentVectors asks the AI service to remove documents from a
+// project's index
+func deleteDocumentVectors(ctx context.Context, userID, projectID string, documentIDs []string) (err error) {
+	ctx, span := tracing.Start(ctx, "ai.delete-documents")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"user_id":      userID,
+		"project_id":   projectID,
+		"document_ids": documentIDs,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", getAIServiceURL()+"/delete-documents", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	tracing.Inject(ctx, req.Header)
+
+	client := &http.Client{Timeout: aiTimeouts.Embed}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call AI service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("AI service error: %s", string(body))
+	}
+	return nil
+}
+
+// EmbeddingQueued is the response of the embed endpoints: the job to poll
+type EmbeddingQueued struct {
+	JobID      uuid.UUID                  `json:"job_id"`
+	DocumentID string                     `json:"document_id,omitempty"` // empty for the whole project
+	Status     repository.EmbeddingStatus `json:"status"`
+}
+
+// EmbedProjectDocuments queues embedding all documents in a project and
+// returns 202 with the job to poll; the AI call runs on the worker pool.
+func EmbedProjectDocuments(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	ctx, span := tracing.Start(c.UserContext(), "EmbedProjectDocuments", attribute.String("project.id", c.Params("id")))
+	defer span.End()
+	repo = repo.WithContext(ctx)
+
+	// Get user ID from context
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	// Get project ID from params
+	projectID := c.Params("id")
+	if projectID == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id required", nil)
+	}
+
+	// Verify project exists and the user may access it
+	project, err := repo.GetByID(projectID)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	}
+
+	if !canAccess(repo, project, userIDStr.(string), accessEditor) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
+	}
+
+	// Get documents path
+	docDir := projectDocumentDir(project)
+
+	job, err := queueEmbeddingJob(c, ctx, &repository.EmbeddingJob{
+		ProjectID: project.ID,
+		UserID:    uuid.MustParse(userIDStr.(string)),
+	}, project.UserID.String(), docDir)
+	if job == nil {
+		return err
+	}
+
+	return c.Status(http.StatusAccepted).JSON(EmbeddingQueued{JobID: job.ID, Status: job.Status})
+}
+
+// runEmbeddingJob calls the AI service for a job and records the outcome.
+// path is the document directory, or the document's file for a job scoped to
+// a single document.
+func runEmbeddingJob(ctx context.Context, jobRepo *repository.EmbeddingJobRepository, job *repository.EmbeddingJob, ownerID, path string) {
+	if err := jobRepo.MarkRunning(job.ID); err != nil {
+		log.Printf("[embedding] failed to mark job %s running: %v", job.ID, err)
+	}
+	startedAt := time.Now()
+
+	var documentIDs []string
+	if job.DocumentID != "" {
+		documentIDs = []string{job.DocumentID}
+	}
+	embedErr := triggerEmbedding(ctx, ownerID, job.ProjectID.String(), path, documentIDs)
+	if embedErr != nil {
+		log.Printf("[embedding] job %s for project %s failed: %v", job.ID, job.ProjectID, embedErr)
+	}
+	if err := jobRepo.Finish(job.ID, embedErr); err != nil {
+		log.Printf("[embedding] failed to record outcome of job %s: %v", job.ID, err)
+	}
+
+	// Documents uploaded while the job ran were not part of it
+	status := repository.DocumentEmbedded
+	if embedErr != nil {
+		status = repository.DocumentEmbeddingFailed
+	}
+	docRepo := repository.NewDocument(repository.GetDB()).WithContext(ctx)
+	if err := docRepo.SetEmbeddingStatus(job.ProjectID.String(), job.DocumentID, startedAt, status); err != nil {
+		log.Printf("[embedding] failed to record document status of job %s: %v", job.ID, err)
+		return
+	}
+	refreshDocumentNodes(ctx, docRepo, job.ProjectID.String())
+}
+
+// refreshDocumentNodes updates a project's rag-documents node from the
+// documents table outside of a request, locking the project so a concurrent
+// save is not overwritten
+func refreshDocumentNodes(ctx context.Context, docRepo *repository.DocumentRepository, projectID string) {
+	docs, err := docRepo.ListByProject(projectID)
+	if err != nil {
+		log.Printf("[documents] failed to list documents of project %s: %v", projectID, err)
+		return
+	}
+	_, err = repository.NewProject(repository.GetDB()).WithContext(ctx).UpdateLocked(projectID, func(p *repository.Project) error {
+		return setNodeDocuments(p, docs)
+	})
+	if err != nil {
+		log.Printf("[documents] failed to update documents node of project %s: %v", projectID, err)
+	}
+}
+
+// EmbedDocument queues re-embedding a single document of a project and
+// returns 202 with the job to poll
+func EmbedDocument(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	doc, err := loadDocument(c, documentRepo(c), project)
+	if doc == nil {
+		return err
+	}
+	if doc.DeletedAt != nil {
+		return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "document is deleted", nil)
+	}
+
+	job, err := queueEmbeddingJob(c, c.UserContext(), &repository.EmbeddingJob{
+		ProjectID:  project.ID,
+		UserID:     uuid.MustParse(c.Locals("userID").(string)),
+		DocumentID: doc.ID,
+	}, project.UserID.String(), doc.StoredPath)
+	if job == nil {
+		return err
+	}
+
+	return c.Status(http.StatusAccepted).JSON(EmbeddingQueued{JobID: job.ID, DocumentID: doc.ID, Status: job.Status})
+}
+
+// documentRepo returns the document repository bound to the request
+func documentRepo(c *fiber.Ctx) *repository.DocumentRepository {
+	return repository.NewDocument(repository.GetDB()).WithContext(c.UserContext())
+}
+
+// documentIDPattern is what a document ID may look like. IDs become part of
+// stored file names, so they can't contain separators or dots.
+var documentIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,127}$`)
+
+// invalidDocumentParams checks the :id and (when routed) :docId params before
+// they get near a storage path. It returns the problem, or "" when both are fine.
+func invalidDocumentParams(c *fiber.Ctx) string {
+	if _, err := uuid.Parse(c.Params("id")); err != nil {
+		return "invalid project id"
+	}
+	if docID := c.Params("docId"); docID != "" && !documentIDPattern.MatchString(docID) {
+		return "invalid document id"
+	}
+	return ""
+}
+
+// withinDir reports whether path, once cleaned, is dir or below it
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && !filepath.IsAbs(rel) && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// withinDocumentStorage reports whether path is under the document or
+// archive storage root
+func withinDocumentStorage(path string) bool {
+	return withinDir(getDocumentsStoragePath(), path) || withinDir(getArchiveStoragePath(), path)
+}
+
+// loadDocument returns the document :docId of project. On failure it writes
+// the error response and returns a nil document.
+func loadDocument(c *fiber.Ctx, docRepo *repository.DocumentRepository, project *repository.Project) (*repository.Document, error) {
+	doc, err := docRepo.Get(project.ID.String(), c.Params("docId"))
+	if err != nil {
+		return nil, response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if doc == nil {
+		return nil, response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document not found", nil)
+	}
+	return doc, nil
+}
+
+// documentInfo is the API view of a stored document
+func documentInfo(d *repository.Document) DocumentInfo {
+	info := DocumentInfo{
+		ID:              d.ID,
+		Name:            d.Name,
+		Type:            d.ContentType,
+		Size:            d.Size,
+		UploadedAt:      d.UploadedAt,
+		Status:          d.Status,
+		Version:         d.Version,
+		ContentHash:     d.ContentHash,
+		EmbeddingStatus: d.EmbeddingStatus,
+		Deduplicated:    d.Deduplicated,
+		RowCount:        d.RowCount,
+	}
+	_ = json.Unmarshal(d.Columns, &info.Columns)
+	_ = json.Unmarshal(d.ParseErrors, &info.ParseErrors)
+	return info
+}
+
+// documentDeduplicated is the status reported for an upload whose content
+// was already stored in the project
+const documentDeduplicated = "deduplicated"
+
+// uploadedFileHash returns the hex SHA-256 of an uploaded file
+func uploadedFileHash(file uploadedFile) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// documentFileName returns the name a version of a document is stored under,
+// "<id>_v<version>_<yyyymmddhhmmss><ext>". The version keeps a re-upload
+// within the same second from overwriting the file it replaces.
+func documentFileName(documentID string, version int, ext string) string {
+	return fmt.Sprintf("%s_v%d_%s%s", documentID, version, time.Now().Format("20060102150405"), ext)
+}
+
+// documentVersionSuffix matches the "_v<version>" a stored file name has
+// after the document ID
+var documentVersionSuffix = regexp.MustCompile(`_v[0-9]+$`)
+
+// documentIDFromFileName recovers the document ID from a stored file name,
+// "<id>_v<version>_<yyyymmddhhmmss><ext>" or "<id>_<yyyymmddhhmmss><ext>"
+// for files stored before versions were part of the name
+func documentIDFromFileName(name string) string {
+	id := strings.TrimSuffix(name, filepath.Ext(name))
+	if i := strings.LastIndex(id, "_"); i > 0 && len(id)-i-1 == len("20060102150405") {
+		if _, err := time.Parse("20060102150405", id[i+1:]); err == nil {
+			return documentVersionSuffix.ReplaceAllString(id[:i], "")
+		}
+	}
+	return id
+}
+
+// GetEmbeddingJob returns the status of an embedding job of a project
+func GetEmbeddingJob(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+
+	jobID := c.Params("jobId")
+	if _, err := uuid.Parse(jobID); err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "job not found", nil)
+	}
+
+	job, err := repository.NewEmbeddingJob(repository.GetDB()).WithContext(c.UserContext()).GetByID(project.ID.String(), jobID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if job == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "job not found", nil)
+	}
+	return c.JSON(job)
+}
+
+// UploadDocument handles document upload for a project. An optional nodeId
+// form field limits the file types to those the node's type takes.
+func UploadDocument(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	ctx, span := tracing.Start(c.UserContext(), "UploadDocument", attribute.String("project.id", c.Params("id")))
+	defer span.End()
+	repo = repo.WithContext(ctx)
+
+	// Get user ID from context
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	// Get project ID from params
+	projectID := c.Params("id")
+	if projectID == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id required", nil)
+	}
+
+	// Verify project exists and the user may access it
+	project, err := repo.GetByID(projectID)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	}
+
+	if !canAccess(repo, project, userIDStr.(string), accessEditor) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
+	}
+
+	userID := uuid.MustParse(userIDStr.(string))
+	docRepo := documentRepo(c)
+
+	// Several files may be sent under "files"; "file" uploads a single one
+	if form, err := c.MultipartForm(); err == nil && len(form.File["files"]) > 0 {
+		return uploadDocuments(c, repo, docRepo, project, userID, form)
+	}
+
+	// Get the uploaded file
+	file, err := c.FormFile("file")
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "no file uploaded", nil)
+	}
+	if strings.EqualFold(filepath.Ext(file.Filename), ".zip") {
+		return uploadArchive(c, repo, docRepo, project, userID, file)
+	}
+
+	// Get document ID from form (or generate new one)
+	doc, previous, deduplicated, uploadErr := saveUploadedDocument(c, docRepo, project, userID, multipartFile(file), c.FormValue("documentId"))
+	if uploadErr != nil {
+		return uploadErr.respond(c)
+	}
+	return respondUploadedDocument(c, repo, docRepo, project, doc, previous, deduplicated)
+}
+
+// respondUploadedDocument keeps a document stored by saveUploadedDocument:
+// it updates the rag-documents node, keeps the replaced file as an earlier
+// version and responds with the document
+func respondUploadedDocument(c *fiber.Ctx, repo *repository.ProjectRepository, docRepo *repository.DocumentRepository, project *repository.Project, doc, previous *repository.Document, deduplicated bool) error {
+	// Update project's document list in nodes
+	if err := syncProjectDocuments(repo, docRepo, project); err != nil {
+		// Clean up uploaded file on error
+		if !deduplicated {
+			discardUploadedDocument(docRepo, doc)
+		}
+		return documentSyncError(c, err)
+	}
+	if previous != nil {
+		keepReplacedDocument(c.UserContext(), docRepo, previous)
+	}
+
+	docInfo := documentInfo(doc)
+	docInfo.FilePath = doc.StoredPath
+	if deduplicated {
+		docInfo.Status, docInfo.Deduplicated = documentDeduplicated, true
+		return c.JSON(docInfo)
+	}
+	publishDocumentUploaded(doc)
+
+	return c.Status(http.StatusCreated).JSON(docInfo)
+}
+
+// uploadResult is the outcome of one file of a multi-file upload
+type uploadResult struct {
+	Name     string                  `json:"name"`
+	Status   int                     `json:"status"`
+	Document *DocumentInfo           `json:"document,omitempty"`
+	Error    *response.ErrorResponse `json:"error,omitempty"`
+}
+
+// uploadDocuments stores every file of a multi-file upload. Files that are
+// rejected are reported in their result without aborting the others; the
+// rag-documents node is updated once for all of them. Optional "documentIds"
+// values give the IDs of the files in order.
+func uploadDocuments(c *fiber.Ctx, repo *repository.ProjectRepository, docRepo *repository.DocumentRepository, project *repository.Project, userID uuid.UUID, form *multipart.Form) error {
+	files := form.File["files"]
+	ids := form.Value["documentIds"]
+
+	results := make([]uploadResult, len(files))
+	var saved, replaced []*repository.Document
+	updated := false
+	for i, file := range files {
+		documentID := ""
+		if i < len(ids) {
+			documentID = ids[i]
+		}
+		results[i].Name = file.Filename
+
+		doc, previous, deduplicated, uploadErr := saveUploadedDocument(c, docRepo, project, userID, multipartFile(file), documentID)
+		if uploadErr != nil {
+			body := response.NewError(c, uploadErr.code, uploadErr.message, uploadErr.details)
+			results[i].Status, results[i].Error = uploadErr.status, &body
+			continue
+		}
+		info := documentInfo(doc)
+		updated = true
+		if deduplicated {
+			info.Status, info.Deduplicated = documentDeduplicated, true
+			results[i].Status, results[i].Document = http.StatusOK, &info
+			continue
+		}
+		results[i].Status, results[i].Document = http.StatusCreated, &info
+		saved = append(saved, doc)
+		if previous != nil {
+			replaced = append(replaced, previous)
+		}
+	}
+
+	if updated {
+		if err := keepUploadedDocuments(c, repo, docRepo, project, saved, replaced); err != nil {
+			return documentSyncError(c, err)
+		}
+	}
+
+	status := http.StatusCreated
+	for _, result := range results {
+		if result.Error != nil {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+	return c.Status(status).JSON(results)
+}
+
+// keepUploadedDocuments keeps a batch of documents stored by
+// saveUploadedDocument: it updates the rag-documents node once, keeps the
+// replaced files as earlier versions and announces the new documents. When the project can't be
+// updated the new files are discarded instead.
+func keepUploadedDocuments(c *fiber.Ctx, repo *repository.ProjectRepository, docRepo *repository.DocumentRepository, project *repository.Project, saved, replaced []*repository.Document) error {
+	if err := syncProjectDocuments(repo, docRepo, project); err != nil {
+		for _, doc := range saved {
+			discardUploadedDocument(docRepo, doc)
+		}
+		return err
+	}
+	for _, previous := range replaced {
+		keepReplacedDocument(c.UserContext(), docRepo, previous)
+	}
+	for _, doc := range saved {
+		publishDocumentUploaded(doc)
+	}
+	return nil
+}
+
+// uploadError is why an uploaded file was rejected: the status and contents
+// of the error response
+type uploadError struct {
+	status  int
+	code    string
+	message string
+	details fiber.Map
+}
+
+// respond writes the error response of a rejected upload
+func (e *uploadError) respond(c *fiber.Ctx) error {
+	return response.Error(c, e.status, e.code, e.message, e.details)
+}
+
+// saveUploadedDocument validates one uploaded file and stores it as
+// documentID (a new ID when empty). It returns the stored document and the
+// one it replaced, whose file the caller keeps as an earlier version once the
+// upload is kept.
+// When the project already has a document with the same content nothing is
+// written and that document is returned with deduplicated set. Content the
+// user already uploaded to another project is hard-linked instead of copied.
+func saveUploadedDocument(c *fiber.Ctx, docRepo *repository.DocumentRepository, project *repository.Project, userID uuid.UUID, file uploadedFile, documentID string) (doc, previous *repository.Document, deduplicated bool, uploadErr *uploadError) {
+	if documentID == "" {
+		documentID = fmt.Sprintf("doc-%s", uuid.New().String()[:8])
+	} else if !documentIDPattern.MatchString(documentID) {
+		return nil, nil, false, &uploadError{http.StatusBadRequest, response.ErrCodeBadRequest, "invalid document id", nil}
+	}
+
+	// Validate size and type before anything is written to disk
+	if max := getMaxDocumentSize(); file.Size > max {
+		return nil, nil, false, &uploadError{http.StatusRequestEntityTooLarge, response.ErrCodeFileTooLarge, "file is too large", fiber.Map{
+			"size":      file.Size,
+			"max_bytes": max,
+		}}
+	}
+	// A re-upload under the same ID becomes its next version, for the node
+	// the document was uploaded for unless the upload names another
+	previous, _ = docRepo.Get(project.ID.String(), documentID)
+	nodeID := strings.TrimSpace(c.FormValue("nodeId"))
+	if nodeID == "" && previous != nil {
+		nodeID = previous.NodeID
+	}
+	allowed, uploadErr := uploadDocumentTypes(project, nodeID)
+	if uploadErr != nil {
+		return nil, nil, false, uploadErr
+	}
+	ext := strings.ToLower(filepath.Ext(file.Name))
+	if !slices.Contains(allowed, ext) {
+		return nil, nil, false, &uploadError{http.StatusUnsupportedMediaType, response.ErrCodeUnsupportedFileType, "unsupported file type", fiber.Map{
+			"type":          ext,
+			"allowed_types": allowed,
+		}}
+	}
+	if ok, err := sniffDocument(file, ext); err != nil {
+		return nil, nil, false, &uploadError{http.StatusBadRequest, response.ErrCodeBadRequest, "failed to read file", nil}
+	} else if !ok {
+		return nil, nil, false, &uploadError{http.StatusUnsupportedMediaType, response.ErrCodeContentMismatch, "file content does not match its extension", fiber.Map{
+			"type": ext,
+		}}
+	}
+	if scanErr := scanUploadedFile(c, project, file); scanErr != nil {
+		return nil, nil, false, scanErr
+	}
+
+	hash, err := uploadedFileHash(file)
+	if err != nil {
+		return nil, nil, false, &uploadError{http.StatusBadRequest, response.ErrCodeBadRequest, "failed to read file", nil}
+	}
+	existing, err := docRepo.GetByHash(project.ID.String(), hash)
+	if err != nil {
+		return nil, nil, false, &uploadError{http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil}
+	}
+	if existing != nil {
+		return existing, nil, true, nil
+	}
+
+	// The old vectors of a re-upload stay in the index until it is embedded
+	// again
+	version := 1
+	if previous != nil {
+		version = previous.Version + 1
+	}
+
+	// Create unique filename
+	filePath := filepath.Join(projectDocumentDir(project), documentFileName(documentID, version, ext))
+	if !withinDir(projectDocumentDir(project), filePath) {
+		return nil, nil, false, &uploadError{http.StatusBadRequest, response.ErrCodeBadRequest, "invalid document id", nil}
+	}
+
+	// Share the file of an identical upload in another project, or save it
+	linked := false
+	if linker, ok := documentStorage.(storage.Linker); ok {
+		if source, err := docRepo.GetByUserHash(userID.String(), hash); err == nil && source != nil {
+			linked = linker.Link(c.UserContext(), source.StoredPath, filePath) == nil
+		}
+	}
+	if !linked {
+		if quotaErr := checkStorageQuota(docRepo, userID.String(), file.Size); quotaErr != nil {
+			return nil, nil, false, quotaErr
+		}
+		if err := saveDocumentFile(c.UserContext(), file, filePath); err != nil {
+			return nil, nil, false, &uploadError{http.StatusInternalServerError, response.ErrCodeInternal, "failed to save file", nil}
+		}
+	}
+
+	embeddingStatus := repository.DocumentEmbeddingPending
+	if previous != nil && previous.DeletedAt == nil && previous.EmbeddingStatus != repository.DocumentEmbeddingPending {
+		embeddingStatus = repository.DocumentEmbeddingStale
+	}
+
+	doc = &repository.Document{
+		ID:              documentID,
+		ProjectID:       project.ID,
+		UserID:          userID,
+		NodeID:          nodeID,
+		Name:            file.Name,
+		StoredPath:      filePath,
+		Size:            file.Size,
+		ContentType:     documentMIMEType(ext),
+		Status:          "ready",
+		ContentHash:     hash,
+		Version:         version,
+		EmbeddingStatus: embeddingStatus,
+		Deduplicated:    linked,
+		UploadedAt:      time.Now(),
+	}
+	setTabularMetadata(doc, file, ext)
+	doc, err = docRepo.Create(doc)
+	if err != nil {
+		documentStorage.Delete(c.UserContext(), filePath)
+		return nil, nil, false, &uploadError{http.StatusInternalServerError, response.ErrCodeInternal, "failed to save document", nil}
+	}
+	return doc, previous, false, nil
+}
+
+// saveDocumentFile stores an uploaded file under key
+func saveDocumentFile(ctx context.Context, file uploadedFile, key string) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return documentStorage.Save(ctx, key, f, file.Size)
+}
+
+// discardUploadedDocument undoes saveUploadedDocument
+func discardUploadedDocument(docRepo *repository.DocumentRepository, doc *repository.Document) {
+	docRepo.Delete(doc.ProjectID.String(), doc.ID)
+	documentStorage.Delete(context.Background(), doc.StoredPath)
+}
+
+// publishDocumentUploaded announces a stored upload
+func publishDocumentUploaded(doc *repository.Document) {
+	events.Publish(events.DocumentUploaded{
+		ProjectID:  doc.ProjectID.String(),
+		UserID:     doc.UserID.String(),
+		DocumentID: doc.ID,
+		Name:       doc.Name,
+		Size:       doc.Size,
+		At:         doc.UploadedAt,
+	})
+}
+
+// DocumentDeleted is the response of DELETE /projects/:id/documents/:docId
+type DocumentDeleted struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// DeleteDocument handles document deletion for a project
+func DeleteDocument(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	// Get user ID from context
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	// Get project ID and document ID from params
+	projectID := c.Params("id")
+	documentID := c.Params("docId")
+	if projectID == "" || documentID == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id and document id required", nil)
+	}
+
+	// Verify project exists and the user may access it
+	project, err := repo.GetByID(projectID)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	}
+
+	if !canAccess(repo, project, userIDStr.(string), accessEditor) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
+	}
+
+	docRepo := documentRepo(c)
+	doc, err := docRepo.Get(projectID, documentID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	// Documents go to the trash first; ?permanent=true deletes the file
+	permanent := c.QueryBool("permanent")
+	if doc != nil {
+		if doc.DeletedAt == nil {
+			// Stop retrieval from returning the document's chunks
+			// The request context is recycled once the handler returns, so
+			// take it before starting
+			go func(ctx context.Context, ownerID, projectID, documentID string) {
+				if err := deleteDocumentVectors(ctx, ownerID, projectID, []string{documentID}); err != nil {
+					log.Printf("[documents] failed to delete vectors of document %s in project %s: %v", documentID, projectID, err)
+				}
+			}(context.WithoutCancel(c.UserContext()), project.UserID.String(), projectID, doc.ID)
+		}
+		if permanent {
+			err = purgeDocument(docRepo, doc)
+		} else if doc.DeletedAt == nil {
+			err = trashDocument(docRepo, doc)
+		}
+		if err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+		}
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("AI service error: %s", string(body))
+	// Update project's document list
+	syncProjectDocuments(repo, docRepo, project)
+
+	if !permanent {
+		return c.JSON(DocumentDeleted{Success: true, Message: "document moved to trash"})
 	}
+	return c.JSON(DocumentDeleted{Success: true, Message: "document deleted"})
+}
 
-	return nil
+// DocumentsPurged is the response of DELETE /projects/:id/documents
+type DocumentsPurged struct {
+	FilesRemoved int   `json:"files_removed"`
+	BytesRemoved int64 `json:"bytes_removed"`
 }
 
-// EmbedProjectDocuments triggers embedding for all documents in a project
-func EmbedProjectDocuments(c *fiber.Ctx, repo *repository.ProjectRepository) error {
-	// Get user ID from context
-	userIDStr := c.Locals("userID")
-	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+// DeleteAllDocuments permanently deletes every document of a project, in
+// the trash or not, with its earlier versions, empties its rag-documents node and drops its embedding
+// index on the AI service. It returns how many files and bytes were removed.
+func DeleteAllDocuments(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
 	}
 
-	// Get project ID from params
-	projectID := c.Params("id")
-	if projectID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id required"})
+	docRepo := documentRepo(c)
+	docs, err := docRepo.ListByProject(project.ID.String())
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
-
-	// Verify project exists and belongs to user
-	project, err := repo.GetByID(projectID)
+	versions, err := docRepo.ListProjectVersions(project.ID.String())
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
-
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	if err := docRepo.DeleteByProject(project.ID.String()); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
-
-	// Get documents path
-	docDir, err := ensureUserDocumentDir(userIDStr.(string), projectID)
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := setNodeDocuments(project, nil); err != nil {
+		return documentSyncError(c, err)
+	}
+	if _, err := repo.Update(project); err != nil {
+		return documentSyncError(c, err)
 	}
 
-	// Trigger embedding
-	if err := triggerEmbedding(userIDStr.(string), projectID, docDir); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "embedding failed",
-			"details": err.Error(),
-		})
+	var bytesRemoved int64
+	for _, doc := range docs {
+		bytesRemoved += doc.Size
+		if !withinDocumentStorage(doc.StoredPath) {
+			log.Printf("[documents] not removing %s: outside document storage", doc.StoredPath)
+			continue
+		}
+		if err := documentStorage.Delete(c.UserContext(), doc.StoredPath); err != nil {
+			log.Printf("[documents] failed to remove %s: %v", doc.StoredPath, err)
+		}
+		removeDocumentPreview(c.UserContext(), doc.StoredPath)
+	}
+	for _, v := range versions {
+		bytesRemoved += v.Size
+		removeVersionFile(c.UserContext(), v)
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Documents embedded successfully",
+	go func(ownerID, projectID string) {
+		if err := deleteEmbeddingIndex(context.Background(), ownerID, projectID); err != nil {
+			log.Printf("[documents] failed to delete embedding index of project %s: %v", projectID, err)
+		}
+	}(project.UserID.String(), project.ID.String())
+
+	return c.JSON(DocumentsPurged{
+		FilesRemoved: len(docs) + len(versions),
+		BytesRemoved: bytesRemoved,
 	})
 }
 
-// UploadDocument handles document upload for a project
-func UploadDocument(c *fiber.Ctx, repo *repository.ProjectRepository) error {
-	// Get user ID from context
-	userIDStr := c.Locals("userID")
-	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+// RestoreDocument moves a document out of the trash
+func RestoreDocument(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
 	}
 
-	// Get project ID from params
-	projectID := c.Params("id")
-	if projectID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id required"})
+	docRepo := documentRepo(c)
+	doc, err := loadDocument(c, docRepo, project)
+	if doc == nil {
+		return err
+	}
+	if doc.DeletedAt == nil {
+		return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "document is not deleted", nil)
+	}
+	if !doc.Deduplicated {
+		if quotaErr := checkStorageQuota(docRepo, doc.UserID.String(), doc.Size); quotaErr != nil {
+			return quotaErr.respond(c)
+		}
 	}
 
-	// Verify project exists and belongs to user
-	project, err := repo.GetByID(projectID)
-	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+	restored := filepath.Join(filepath.Dir(filepath.Dir(doc.StoredPath)), filepath.Base(doc.StoredPath))
+	if err := storage.Move(c.UserContext(), documentStorage, doc.StoredPath, restored); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to restore file", nil)
+	}
+	trashed := doc.StoredPath
+	doc.StoredPath, doc.Status, doc.DeletedAt = restored, "ready", nil
+	if err := docRepo.UpdateStorage(doc); err != nil {
+		storage.Move(c.UserContext(), documentStorage, restored, trashed)
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
+	if err := syncProjectDocuments(repo, docRepo, project); err != nil {
+		return documentSyncError(c, err)
+	}
+	return c.JSON(documentInfo(doc))
+}
 
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+// documentTrashDir is the subdirectory of a project's document directory
+// holding deleted documents until they are restored or purged
+const documentTrashDir = ".trash"
+
+// trashDocument moves a document's file into the trash and marks it deleted
+func trashDocument(docRepo *repository.DocumentRepository, doc *repository.Document) error {
+	trashed := filepath.Join(filepath.Dir(doc.StoredPath), documentTrashDir, filepath.Base(doc.StoredPath))
+	if err := storage.Move(context.Background(), documentStorage, doc.StoredPath, trashed); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
 	}
+	removeDocumentPreview(context.Background(), doc.StoredPath)
 
-	// Get the uploaded file
-	file, err := c.FormFile("file")
-	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "no file uploaded"})
+	now := time.Now()
+	doc.StoredPath, doc.Status, doc.DeletedAt = trashed, "deleted", &now
+	doc.EmbeddingStatus = repository.DocumentEmbeddingPending
+	return docRepo.UpdateStorage(doc)
+}
+
+// purgeDocument deletes a document's file and row, and its earlier versions
+func purgeDocument(docRepo *repository.DocumentRepository, doc *repository.Document) error {
+	if err := docRepo.Delete(doc.ProjectID.String(), doc.ID); err != nil {
+		return err
+	}
+	if err := purgeDocumentVersions(context.Background(), docRepo, doc.ProjectID.String(), doc.ID); err != nil {
+		log.Printf("[documents] failed to remove versions of document %s: %v", doc.ID, err)
+	}
+	if !withinDocumentStorage(doc.StoredPath) {
+		log.Printf("[documents] not removing %s: outside document storage", doc.StoredPath)
+		return nil
 	}
+	if err := documentStorage.Delete(context.Background(), doc.StoredPath); err != nil {
+		log.Printf("[documents] failed to remove %s: %v", doc.StoredPath, err)
+	}
+	removeDocumentPreview(context.Background(), doc.StoredPath)
+	return nil
+}
 
-	// Get document ID from form (or generate new one)
-	documentID := c.FormValue("documentId")
-	if documentID == "" {
-		documentID = fmt.Sprintf("doc-%s", uuid.New().String()[:8])
+// getTrashRetention returns how long deleted documents are kept in the trash
+func getTrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
 	}
+	return time.Duration(days) * 24 * time.Hour
+}
 
-	// Validate file type
-	ext := filepath.Ext(file.Filename)
-	allowedExts := map[string]bool{".pdf": true, ".docx": true, ".txt": true, ".doc": true}
-	if !allowedExts[ext] {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "unsupported file type"})
+// RunTrashCleaner permanently deletes documents that have been in the trash
+// longer than TRASH_RETENTION_DAYS and resumable uploads that expired
+// unfinished, checking every interval. It is started once from main and runs
+// for the lifetime of the process.
+func RunTrashCleaner(docRepo *repository.DocumentRepository, projectRepo *repository.ProjectRepository, interval time.Duration) {
+	uploads := repository.NewDocumentUpload(repository.GetDB())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		emptyTrash(docRepo, projectRepo, time.Now().Add(-getTrashRetention()))
+		purgeExpiredUploads(uploads, projectRepo)
 	}
+}
 
-	// Create user document directory
-	docDir, err := ensureUserDocumentDir(userIDStr.(string), projectID)
+// emptyTrash purges documents trashed before cutoff and resyncs the
+// rag-documents nodes of their projects
+func emptyTrash(docRepo *repository.DocumentRepository, projectRepo *repository.ProjectRepository, cutoff time.Time) {
+	docs, err := docRepo.ListTrashedBefore(cutoff)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		log.Printf("[documents] failed to list trashed documents: %v", err)
+		return
 	}
 
-	// Create unique filename
-	safeFilename := fmt.Sprintf("%s_%s%s", documentID, time.Now().Format("20060102150405"), ext)
-	filePath := filepath.Join(docDir, safeFilename)
-
-	// Save the file
-	if err := c.SaveFile(file, filePath); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save file"})
+	projects := map[string]bool{}
+	for i := range docs {
+		if err := purgeDocument(docRepo, &docs[i]); err != nil {
+			log.Printf("[documents] failed to purge document %s of project %s: %v", docs[i].ID, docs[i].ProjectID, err)
+			continue
+		}
+		projects[docs[i].ProjectID.String()] = true
 	}
-
-	// Create document info
-	docInfo := DocumentInfo{
-		ID:         documentID,
-		Name:       file.Filename,
-		Type:       ext[1:], // Remove the dot
-		Size:       file.Size,
-		UploadedAt: time.Now(),
-		Status:     "ready",
-		FilePath:   filePath,
+	for projectID := range projects {
+		project, err := projectRepo.GetByID(projectID)
+		if err != nil {
+			continue
+		}
+		if err := syncProjectDocuments(projectRepo, docRepo, project); err != nil {
+			log.Printf("[documents] failed to update documents of project %s: %v", projectID, err)
+		}
 	}
+}
 
-	// Update project's document list in nodes
-	if err := updateProjectDocuments(repo, project, docInfo, "add"); err != nil {
-		// Clean up uploaded file on error
-		os.Remove(filePath)
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update project"})
-	}
+// DocumentLimits is the response of GET /projects/document-limits
+type DocumentLimits struct {
+	MaxBytes                    int64    `json:"max_bytes"`
+	AllowedTypes                []string `json:"allowed_types"`
+	ArchiveTypes                []string `json:"archive_types"`
+	MaxArchiveFiles             int      `json:"max_archive_files"`
+	MaxArchiveUncompressedBytes int64    `json:"max_archive_uncompressed_bytes"`
+	StorageQuotaBytes           int64    `json:"storage_quota_bytes"`
+}
 
-	return c.Status(http.StatusCreated).JSON(docInfo)
+// GetDocumentLimits returns the upload limits so the editor can validate
+// files before sending them
+func GetDocumentLimits(c *fiber.Ctx) error {
+	return c.JSON(DocumentLimits{
+		MaxBytes:                    getMaxDocumentSize(),
+		AllowedTypes:                getAllowedDocumentTypes(),
+		ArchiveTypes:                []string{".zip"},
+		MaxArchiveFiles:             getMaxArchiveFiles(),
+		MaxArchiveUncompressedBytes: getMaxArchiveUncompressedSize(),
+		StorageQuotaBytes:           getStorageQuota(),
+	})
 }
 
-// DeleteDocument handles document deletion for a project
-func DeleteDocument(c *fiber.Ctx, repo *repository.ProjectRepository) error {
-	// Get user ID from context
-	userIDStr := c.Locals("userID")
-	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
-	}
+// UpdateDocumentPayload is the body of PATCH /projects/:id/documents/:docId.
+// Fields left out are not changed.
+type UpdateDocumentPayload struct {
+	Name   *string `json:"name"`
+	Status *string `json:"status"`
+}
 
-	// Get project ID and document ID from params
-	projectID := c.Params("id")
-	documentID := c.Params("docId")
-	if projectID == "" || documentID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id and document id required"})
+// UpdateDocument renames a document or changes its status. Stored files are
+// named after the document ID, not its display name, so nothing is renamed
+// on disk.
+func UpdateDocument(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
 	}
 
-	// Verify project exists and belongs to user
-	project, err := repo.GetByID(projectID)
-	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+	var body UpdateDocumentPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid request body", nil)
 	}
 
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	docRepo := documentRepo(c)
+	doc, err := loadDocument(c, docRepo, project)
+	if doc == nil {
+		return err
 	}
 
-	// Find and delete the file
-	docDir, _ := ensureUserDocumentDir(userIDStr.(string), projectID)
-	files, _ := os.ReadDir(docDir)
-	for _, f := range files {
-		if !f.IsDir() && len(f.Name()) > len(documentID) && f.Name()[:len(documentID)] == documentID {
-			os.Remove(filepath.Join(docDir, f.Name()))
-			break
+	if body.Name != nil {
+		name := strings.TrimSpace(*body.Name)
+		if name == "" {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "name must not be empty", nil)
 		}
+		if !strings.EqualFold(filepath.Ext(name), filepath.Ext(doc.Name)) {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, fmt.Sprintf("name must keep the %s extension", filepath.Ext(doc.Name)), nil)
+		}
+		doc.Name = name
+	}
+	if body.Status != nil {
+		if !documentStatuses[*body.Status] {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid status", nil)
+		}
+		doc.Status = *body.Status
 	}
 
-	// Update project's document list
-	updateProjectDocuments(repo, project, DocumentInfo{ID: documentID}, "remove")
-
-	return c.JSON(fiber.Map{"success": true, "message": "document deleted"})
+	if err := docRepo.UpdateMetadata(doc); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if err := syncProjectDocuments(repo, docRepo, project); err != nil {
+		return documentSyncError(c, err)
+	}
+	return c.JSON(documentInfo(doc))
 }
 
 // ListDocuments lists all documents for a project
 func ListDocuments(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
 	// Get user ID from context
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	// Get project ID from params
 	projectID := c.Params("id")
 	if projectID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id required", nil)
 	}
 
-	// Verify project exists and belongs to user
+	// Verify project exists and the user may access it
 	project, err := repo.GetByID(projectID)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
 	}
 
-	// Get document directory
-	docDir, _ := ensureUserDocumentDir(userIDStr.(string), projectID)
-
-	// List files
-	files, err := os.ReadDir(docDir)
+	docs, err := documentRepo(c).ListByProject(projectID)
 	if err != nil {
-		return c.JSON([]DocumentInfo{})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
-	documents := make([]DocumentInfo, 0)
-	for _, f := range files {
-		if !f.IsDir() {
-			info, _ := f.Info()
-			ext := filepath.Ext(f.Name())
-			documents = append(documents, DocumentInfo{
-				ID:         f.Name()[:len(f.Name())-len(ext)],
-				Name:       f.Name(),
-				Type:       ext[1:],
-				Size:       info.Size(),
-				UploadedAt: info.ModTime(),
-				Status:     "ready",
-			})
-		}
+	documents := make([]DocumentInfo, 0, len(docs))
+	for i := range docs {
+		documents = append(documents, documentInfo(&docs[i]))
 	}
 
 	return c.JSON(documents)
 }
 
-// GetDocumentFile serves a document file for the AI service
+// GetDocumentFile serves a document file for the AI service; ?download=true
+// sends it as an attachment and ?version= serves an earlier version
 func GetDocumentFile(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
 	// Get user ID from context
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	// Get project ID and document ID from params
 	projectID := c.Params("id")
 	documentID := c.Params("docId")
 	if projectID == "" || documentID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id and document id required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id and document id required", nil)
 	}
 
-	// Verify project exists and belongs to user
+	// Verify project exists and the user may access it
 	project, err := repo.GetByID(projectID)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
 	}
 
 	// Find the file
-	docDir, _ := ensureUserDocumentDir(userIDStr.(string), projectID)
-	files, _ := os.ReadDir(docDir)
-	for _, f := range files {
-		if !f.IsDir() && len(f.Name()) > len(documentID) && f.Name()[:len(documentID)] == documentID {
-			return c.SendFile(filepath.Join(docDir, f.Name()))
+	docRepo := documentRepo(c)
+	doc, err := loadDocument(c, docRepo, project)
+	if doc == nil {
+		return err
+	}
+	if doc.DeletedAt != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document is in the trash", nil)
+	}
+	if doc, err = documentAtVersion(c, docRepo, doc); doc == nil {
+		return err
+	}
+	if c.QueryBool("download") {
+		c.Attachment(doc.Name)
+	}
+	// Attachment guesses the type from the name; use the stored file's
+	if contentType, ok := documentContentTypes[strings.ToLower(filepath.Ext(doc.StoredPath))]; ok {
+		c.Set(fiber.HeaderContentType, contentType)
+	} else {
+		c.Type(filepath.Ext(doc.StoredPath))
+	}
+	return sendDocumentFile(c, doc)
+}
+
+// DownloadDocument serves a document as an attachment under its original
+// file name, or an earlier version given by ?version=. Registered with Get,
+// so HEAD returns the same headers without the body.
+func DownloadDocument(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+	docRepo := documentRepo(c)
+	doc, err := loadDocument(c, docRepo, project)
+	if doc == nil {
+		return err
+	}
+	if doc.DeletedAt != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document is in the trash", nil)
+	}
+	if doc, err = documentAtVersion(c, docRepo, doc); doc == nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentDisposition, contentDisposition(doc.Name))
+	contentType, ok := documentContentTypes[strings.ToLower(filepath.Ext(doc.StoredPath))]
+	if !ok {
+		contentType = fiber.MIMEOctetStream
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	return sendDocumentFile(c, doc)
+}
+
+// sendDocumentFile writes a document's file as the response body. A single
+// byte range asked for with Range is answered with 206 Partial Content, so
+// viewers can jump around a large PDF without fetching all of it; a request
+// for several ranges gets the first one. If-Range compares against the
+// file's Last-Modified. Callers set the content headers first; an error
+// response drops the attachment header so it isn't saved as the file.
+func sendDocumentFile(c *fiber.Ctx, doc *repository.Document) error {
+	if !withinDocumentStorage(doc.StoredPath) {
+		return documentFileError(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid document path", nil)
+	}
+	info, err := documentStorage.Stat(c.UserContext(), doc.StoredPath)
+	if err != nil {
+		return documentFileError(c, http.StatusNotFound, response.ErrCodeNotFound, "document file not found", nil)
+	}
+
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	var lastModified string
+	if !info.ModTime.IsZero() {
+		lastModified = info.ModTime.UTC().Format(http.TimeFormat)
+		c.Set(fiber.HeaderLastModified, lastModified)
+	}
+	offset, length := int64(0), info.Size
+	header := c.Get(fiber.HeaderRange)
+	if ifRange := c.Get(fiber.HeaderIfRange); ifRange != "" && ifRange != lastModified {
+		header = ""
+	}
+	if header != "" {
+		r, ok, err := parseByteRange(header, info.Size)
+		if err != nil {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", info.Size))
+			return documentFileError(c, http.StatusRequestedRangeNotSatisfiable, response.ErrCodeRangeNotSatisfiable, err.Error(), fiber.Map{"size": info.Size})
+		}
+		if ok {
+			offset, length = r.offset, r.length
+			c.Status(http.StatusPartialContent)
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, info.Size))
+		}
+	}
+
+	r, err := storage.OpenRange(c.UserContext(), documentStorage, doc.StoredPath, offset, length)
+	if err != nil {
+		return documentFileError(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to open document file", nil)
+	}
+	return c.SendStream(r, int(length))
+}
+
+// documentFileError writes an error response in place of a document file
+func documentFileError(c *fiber.Ctx, status int, code, message string, details interface{}) error {
+	c.Response().Header.Del(fiber.HeaderContentDisposition)
+	return response.Error(c, status, code, message, details)
+}
+
+// byteRange is a part of a file asked for with a Range header
+type byteRange struct {
+	offset, length int64
+}
+
+// errRangeNotSatisfiable is returned when no range of a Range header lies
+// within the file
+var errRangeNotSatisfiable = errors.New("requested range is not satisfiable")
+
+// parseByteRange parses a Range header for a file of size bytes and returns
+// the first range that lies within it. ok is false when the header should be
+// ignored and the whole file sent: it is malformed or not in bytes.
+func parseByteRange(header string, size int64) (r byteRange, ok bool, err error) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !found {
+		return byteRange{}, false, nil
+	}
+	var ranges []byteRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, found := strings.Cut(part, "-")
+		if !found {
+			return byteRange{}, false, nil
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		if first == "" {
+			// A suffix range: the last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return byteRange{}, false, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			ranges = append(ranges, byteRange{size - n, n})
+			continue
+		}
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return byteRange{}, false, nil
+		}
+		end := size - 1
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return byteRange{}, false, nil
+			}
+			end = min(end, size-1)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, byteRange{start, end - start + 1})
+	}
+	if len(ranges) == 0 {
+		return byteRange{}, false, errRangeNotSatisfiable
+	}
+	return ranges[0], true, nil
+}
+
+// contentDisposition builds an attachment header for name. Browsers that
+// understand RFC 5987 use the UTF-8 filename*; the plain filename is an ASCII
+// fallback for those that do not.
+func contentDisposition(name string) string {
+	var fallback, encoded strings.Builder
+	for _, r := range name {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			continue
+		case r > 0x7e, r == '"', r == '\\':
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+	for _, b := range []byte(name) {
+		if isRFC5987AttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
 		}
 	}
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback.String(), encoded.String())
+}
+
+// isRFC5987AttrChar reports whether b may appear unescaped in an RFC 5987
+// extended parameter value
+func isRFC5987AttrChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
 
-	return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "document not found"})
+// DocumentsPath is the response of GET /projects/:id/documents-path
+type DocumentsPath struct {
+	Path      string `json:"path"`
+	ProjectID string `json:"projectId"`
+	UserID    string `json:"userId"`
 }
 
 // GetProjectDocumentsPath returns the path to project documents (for AI service)
 func GetProjectDocumentsPath(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
 	// Get user ID from context
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	// Get project ID from params
 	projectID := c.Params("id")
 	if projectID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "project id required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "project id required", nil)
 	}
 
-	// Verify project exists and belongs to user
+	// Verify project exists and the user may access it
 	project, err := repo.GetByID(projectID)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "access denied", nil)
 	}
 
 	// Get document directory path
-	docDir, _ := ensureUserDocumentDir(userIDStr.(string), projectID)
+	docDir := projectDocumentDir(project)
 
 	// Get absolute path
 	absPath, _ := filepath.Abs(docDir)
 
-	return c.JSON(fiber.Map{
-		"path":      absPath,
-		"projectId": projectID,
-		"userId":    userIDStr,
+	return c.JSON(DocumentsPath{
+		Path:      absPath,
+		ProjectID: projectID,
+		UserID:    project.UserID.String(),
 	})
 }
 
-// updateProjectDocuments updates the document list in the project's RAG node
-func updateProjectDocuments(repo *repository.ProjectRepository, project *repository.Project, doc DocumentInfo, action string) error {
-	// Parse existing nodes
-	var nodes []map[string]interface{}
-	if err := json.Unmarshal(project.Nodes, &nodes); err != nil {
-		nodes = []map[string]interface{}{}
+// ragDocumentNames maps the document IDs listed in rag-documents nodes to
+// their original file names
+func ragDocumentNames(nodes []map[string]interface{}) map[string]string {
+	names := map[string]string{}
+	for _, node := range nodes {
+		if t, _ := node["type"].(string); t != "rag-documents" {
+			continue
+		}
+		if docs, ok := nodeData(node)["documents"].([]interface{}); ok {
+			for _, d := range docs {
+				if doc, ok := d.(map[string]interface{}); ok {
+					id, _ := doc["id"].(string)
+					name, _ := doc["name"].(string)
+					names[id] = name
+				}
+			}
+		}
 	}
+	return names
+}
 
-	// Find RAG documents node and update its data
-	for i, node := range nodes {
-		if nodeType, ok := node["type"].(string); ok && nodeType == "rag-documents" {
-			nodeData, ok := node["data"].(map[string]interface{})
-			if !ok {
-				nodeData = map[string]interface{}{}
+// ReconcileDocuments backfills document rows for files uploaded before
+// documents were stored in the database. Only missing rows are added, so it
+// is safe to run on every start; files of deleted projects are skipped.
+func ReconcileDocuments(docRepo *repository.DocumentRepository, projectRepo *repository.ProjectRepository) {
+	// Object stores were only supported once every upload had a row
+	if _, ok := storage.LocalPath(documentStorage, ""); !ok {
+		return
+	}
+	base := getDocumentsStoragePath()
+	userDirs, err := os.ReadDir(base)
+	if err != nil {
+		return // nothing uploaded yet
+	}
+
+	for _, userDir := range userDirs {
+		if !userDir.IsDir() {
+			continue
+		}
+		projectDirs, _ := os.ReadDir(filepath.Join(base, userDir.Name()))
+		for _, projectDir := range projectDirs {
+			if !projectDir.IsDir() {
+				continue
+			}
+			project, err := projectRepo.GetByID(projectDir.Name())
+			if err != nil {
+				continue
 			}
 
-			// Get existing documents
-			var documents []map[string]interface{}
-			if existingDocs, ok := nodeData["documents"].([]interface{}); ok {
-				for _, d := range existingDocs {
-					if docMap, ok := d.(map[string]interface{}); ok {
-						documents = append(documents, docMap)
-					}
+			nodes, _ := parseWorkflow(project)
+			names := ragDocumentNames(nodes)
+			dir := filepath.Join(base, userDir.Name(), projectDir.Name())
+			files, _ := os.ReadDir(dir)
+
+			var docs []repository.Document
+			for _, f := range files {
+				info, err := f.Info()
+				if f.IsDir() || err != nil {
+					continue
+				}
+				id := documentIDFromFileName(f.Name())
+				name := names[id]
+				if name == "" {
+					name = f.Name()
 				}
+				docs = append(docs, repository.Document{
+					ID:          id,
+					ProjectID:   project.ID,
+					UserID:      project.UserID,
+					Name:        name,
+					StoredPath:  filepath.Join(dir, f.Name()),
+					Size:        info.Size(),
+					ContentType: documentMIMEType(filepath.Ext(f.Name())),
+					Status:      "ready",
+					UploadedAt:  info.ModTime(),
+				})
+			}
+			if err := docRepo.CreateMissing(docs); err != nil {
+				log.Printf("[documents] failed to backfill documents of project %s: %v", project.ID, err)
 			}
+		}
+	}
+}
 
-			if action == "add" {
-				// Add new document
-				documents = append(documents, map[string]interface{}{
-					"id":         doc.ID,
-					"name":       doc.Name,
-					"type":       doc.Type,
-					"size":       doc.Size,
-					"uploadedAt": doc.UploadedAt.Format(time.RFC3339),
-					"status":     doc.Status,
-				})
-			} else if action == "remove" {
-				// Remove document
-				newDocs := make([]map[string]interface{}, 0)
-				for _, d := range documents {
-					if id, ok := d["id"].(string); ok && id != doc.ID {
-						newDocs = append(newDocs, d)
-					}
-				}
-				documents = newDocs
+// syncProjectDocuments rewrites the document list of the project's
+// rag-documents node from the documents table
+func syncProjectDocuments(repo *repository.ProjectRepository, docRepo *repository.DocumentRepository, project *repository.Project) error {
+	docs, err := docRepo.ListByProject(project.ID.String())
+	if err != nil {
+		return err
+	}
+	if err := setNodeDocuments(project, docs); err != nil {
+		return err
+	}
+	_, err = repo.Update(project)
+	return err
+}
+
+// errInvalidNodes is returned when a project's stored nodes can't be parsed
+var errInvalidNodes = errors.New("project nodes are not valid JSON")
+
+// documentSyncError writes the response for a failed update of a project's
+// rag-documents node
+func documentSyncError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errInvalidNodes) {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeInvalidWorkflow, "project nodes are not valid JSON", nil)
+	}
+	return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to update project", nil)
+}
+
+// newRAGDocumentsNode returns a rag-documents node with the editor's
+// defaults, placed below the lowest of nodes
+func newRAGDocumentsNode(nodes []map[string]interface{}) map[string]interface{} {
+	y := 100.0
+	for _, node := range nodes {
+		if position, ok := node["position"].(map[string]interface{}); ok {
+			if nodeY, ok := position["y"].(float64); ok && nodeY+150 > y {
+				y = nodeY + 150
+			}
+		}
+	}
+	return map[string]interface{}{
+		"id":       fmt.Sprintf("node-%s", uuid.New().String()[:8]),
+		"type":     "rag-documents",
+		"position": map[string]interface{}{"x": 100.0, "y": y},
+		"data": map[string]interface{}{
+			"documents":      []interface{}{},
+			"chunkSize":      512,
+			"chunkOverlap":   50,
+			"embeddingModel": "text-embedding-3-small",
+		},
+		"inputs": []interface{}{},
+		"outputs": []interface{}{
+			map[string]interface{}{"id": "context-out", "type": "output", "position": "right", "label": "Context"},
+		},
+	}
+}
+
+// setNodeDocuments replaces the document lists of project's rag-documents
+// nodes. Only the file types rag-documents takes are listed, so documents
+// uploaded for other nodes are not embedded. A document is listed by the node
+// it was uploaded for, or by the first rag-documents node when it names none
+// or its node was removed. A project with such documents but no
+// rag-documents node gets one added, so uploads always show up in the
+// editor. It fails with errInvalidNodes when the stored nodes can't be
+// parsed, instead of overwriting them.
+func setNodeDocuments(project *repository.Project, docs []repository.Document) error {
+	// Parse existing nodes
+	var nodes []map[string]interface{}
+	if len(project.Nodes) > 0 {
+		if err := json.Unmarshal(project.Nodes, &nodes); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidNodes, err)
+		}
+	}
+
+	ragNodes := map[string]bool{}
+	firstID := ""
+	for _, node := range nodes {
+		if nodeType, _ := node["type"].(string); nodeType == "rag-documents" {
+			id, _ := node["id"].(string)
+			ragNodes[id] = true
+			if firstID == "" {
+				firstID = id
 			}
+		}
+	}
 
-			nodeData["documents"] = documents
-			nodes[i]["data"] = nodeData
-			break
+	// Documents go to the node they were uploaded for, or the first one
+	targets := make([]string, len(docs))
+	for i := range docs {
+		switch {
+		case !nodeTakesDocument("rag-documents", &docs[i]):
+			continue
+		case ragNodes[docs[i].NodeID]:
+			targets[i] = docs[i].NodeID
+		default:
+			if firstID == "" {
+				node := newRAGDocumentsNode(nodes)
+				nodes = append(nodes, node)
+				firstID = node["id"].(string)
+				ragNodes[firstID] = true
+			}
+			targets[i] = firstID
+		}
+	}
+
+	lists := map[string][]map[string]interface{}{}
+	for i, d := range docs {
+		if targets[i] == "" {
+			continue
 		}
+		document := map[string]interface{}{
+			"id":         d.ID,
+			"name":       d.Name,
+			"type":       d.ContentType,
+			"size":       d.Size,
+			"uploadedAt": d.UploadedAt.Format(time.RFC3339),
+			"status":     d.Status,
+		}
+		if d.EmbeddingStatus != "" {
+			document["embeddingStatus"] = d.EmbeddingStatus
+		}
+		if d.ContentHash != "" {
+			document["contentHash"] = d.ContentHash
+		}
+		lists[targets[i]] = append(lists[targets[i]], document)
+	}
+	for i, node := range nodes {
+		if nodeType, _ := node["type"].(string); nodeType != "rag-documents" {
+			continue
+		}
+		id, _ := node["id"].(string)
+		documents := lists[id]
+		if documents == nil {
+			documents = []map[string]interface{}{}
+		}
+		nodeData(nodes[i])["documents"] = documents
+	}
+	if nodes == nil {
+		nodes = []map[string]interface{}{}
 	}
 
-	// Marshal and update
+	// Marshal the updated nodes
 	nodesJSON, err := json.Marshal(nodes)
 	if err != nil {
 		return err
 	}
 
 	project.Nodes = nodesJSON
-	_, err = repo.Update(project)
-	return err
+	return nil
 }
 
 // ProxyDocumentToAI proxies document to AI service for processing
 func ProxyDocumentToAI(userID, projectID string) (string, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return "", fmt.Errorf("invalid user id %q", userID)
+	}
+	if _, err := uuid.Parse(projectID); err != nil {
+		return "", fmt.Errorf("invalid project id %q", projectID)
+	}
 	basePath := getDocumentsStoragePath()
 	docPath := filepath.Join(basePath, userID, projectID)
 	absPath, err := filepath.Abs(docPath)
@@ -449,18 +2119,72 @@ func ProxyDocumentToAI(userID, projectID string) (string, error) {
 	return absPath, nil
 }
 
-// CopyDocumentContent reads document content (for text files)
-func CopyDocumentContent(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+// CopyDocumentContent reads the content of the stored file key as plain
+// text: text and markdown as UTF-8, CSV rows and spreadsheet cells as
+// tab-separated lines
+func CopyDocumentContent(ctx context.Context, key string) (string, error) {
+	file, err := documentStorage.Open(ctx, key)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
+	switch strings.ToLower(filepath.Ext(key)) {
+	case ".csv":
+		return csvDocumentText(file)
+	case ".xlsx":
+		return spreadsheetDocumentText(file)
+	}
+
 	content, err := io.ReadAll(file)
 	if err != nil {
 		return "", err
 	}
 
-	return string(content), nil
+	return strings.ToValidUTF8(string(content), "\uFFFD"), nil
+}
+
+// csvDocumentText reads a CSV file into tab-separated lines
+func csvDocumentText(file io.Reader) (string, error) {
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1 // rows may have differing widths
+	r.LazyQuotes = true
+
+	var sb strings.Builder
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(strings.Join(row, "\t"))
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// spreadsheetDocumentText reads the cells of every sheet of an .xlsx file
+// into tab-separated lines, each sheet headed by its name
+func spreadsheetDocumentText(file io.Reader) (string, error) {
+	f, err := excelize.OpenReader(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "# %s\n", sheet)
+		for _, row := range rows {
+			sb.WriteString(strings.Join(row, "\t"))
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String(), nil
 }
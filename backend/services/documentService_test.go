@@ -0,0 +1,1824 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/scanner"
+	"manju/backend/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// documentModels are the tables the document handlers use
+var documentModels = append([]interface{}{
+	&repository.Document{}, &repository.DocumentVersion{}, &repository.EmbeddingJob{},
+}, projectListModels...)
+
+// testPDF is the content of a small PDF file
+const testPDF = "%PDF-1.4\n1 0 obj <<>> endobj\ntrailer <<>>\n%%EOF\n"
+
+// testFile is a file of a test upload
+type testFile struct {
+	name, content string
+}
+
+// uploadRequest builds a multipart upload of files under field, with the
+// given form values
+func uploadRequest(t *testing.T, target, field string, values map[string]string, files ...testFile) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, value := range values {
+		if err := w.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range files {
+		part, err := w.CreateFormFile(field, file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(file.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return newRequest("POST", target, w.FormDataContentType(), &body)
+}
+
+// uploadTestDocument uploads one file to project as its owner and returns
+// the stored document
+func uploadTestDocument(t *testing.T, project *repository.Project, name, content string) DocumentInfo {
+	t.Helper()
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+		return UploadDocument(c, repository.NewProject(repository.GetDB()))
+	}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", nil, testFile{name, content}))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload %s: status %d: %s", name, resp.StatusCode, body)
+	}
+	var info DocumentInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		t.Fatalf("upload response: %v", err)
+	}
+	return info
+}
+
+func TestDocumentMetadataRows(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	owner := uuid.New()
+	project := createTestProject(t, owner, `[{"id":"docs","type":"rag-documents","position":{"x":0,"y":0},"data":{}}]`)
+	projectRepo := repository.NewProject(repository.GetDB())
+	docRepo := repository.NewDocument(repository.GetDB())
+	base := "/projects/" + project.ID.String() + "/documents"
+
+	uploaded := uploadTestDocument(t, project, "Quarterly Report (final).pdf", testPDF)
+
+	// The row keeps the original name; the file is stored under the ID
+	doc, err := docRepo.Get(project.ID.String(), uploaded.ID)
+	if err != nil || doc == nil {
+		t.Fatalf("document row: %v, %v", doc, err)
+	}
+	if doc.Name != "Quarterly Report (final).pdf" || doc.Size != int64(len(testPDF)) || doc.ContentType != "application/pdf" || doc.UserID != owner {
+		t.Errorf("stored %s of %d bytes, type %s by %s", doc.Name, doc.Size, doc.ContentType, doc.UserID)
+	}
+	if filepath.Dir(doc.StoredPath) != projectDocumentDir(project) || !strings.HasPrefix(filepath.Base(doc.StoredPath), uploaded.ID+"_") {
+		t.Errorf("stored at %s, want %s/%s_v1_<time>.pdf", doc.StoredPath, projectDocumentDir(project), uploaded.ID)
+	}
+	if got := documentIDFromFileName(filepath.Base(doc.StoredPath)); got != uploaded.ID {
+		t.Errorf("stored file name gives ID %q, want %q", got, uploaded.ID)
+	}
+
+	// The rag-documents node is written from the table
+	stored, err := projectRepo.GetByID(project.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, _ := nodeDataByID(stored)["docs"]["documents"].([]interface{})
+	if len(listed) != 1 || listed[0].(map[string]interface{})["name"] != doc.Name {
+		t.Errorf("rag-documents node lists %v, want the uploaded document", listed)
+	}
+
+	t.Run("list reads the rows", func(t *testing.T) {
+		resp := serveAs(t, owner.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+			return ListDocuments(c, projectRepo)
+		}, newRequest("GET", base, "", nil))
+		body := readBody(t, resp)
+		var docs []DocumentInfo
+		if err := json.Unmarshal(body, &docs); err != nil {
+			t.Fatalf("list %s: %v", body, err)
+		}
+		if len(docs) != 1 || docs[0].ID != uploaded.ID || docs[0].Name != doc.Name || docs[0].Status != "ready" {
+			t.Errorf("listed %+v, want the uploaded document", docs)
+		}
+	})
+
+	t.Run("file is found through the row", func(t *testing.T) {
+		resp := serveAs(t, owner.String(), "/projects/:id/documents/:docId/file", func(c *fiber.Ctx) error {
+			return GetDocumentFile(c, projectRepo)
+		}, newRequest("GET", base+"/"+uploaded.ID+"/file?download=true", "", nil))
+		body := readBody(t, resp)
+		if resp.StatusCode != http.StatusOK || string(body) != testPDF {
+			t.Fatalf("status %d: %q", resp.StatusCode, body)
+		}
+		if disposition := resp.Header.Get(fiber.HeaderContentDisposition); !strings.HasPrefix(disposition, "attachment") || !strings.Contains(disposition, "Quarterly") {
+			t.Errorf("Content-Disposition = %q, want an attachment under the original name", disposition)
+		}
+	})
+
+	t.Run("unknown document", func(t *testing.T) {
+		resp := serveAs(t, owner.String(), "/projects/:id/documents/:docId/file", func(c *fiber.Ctx) error {
+			return GetDocumentFile(c, projectRepo)
+		}, newRequest("GET", base+"/doc-missing/file", "", nil))
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", resp.StatusCode)
+		}
+	})
+
+	t.Run("delete goes through the row", func(t *testing.T) {
+		del := func(query string) {
+			resp := serveAs(t, owner.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+				return DeleteDocument(c, projectRepo)
+			}, newRequest("DELETE", base+"/"+uploaded.ID+query, "", nil))
+			if body := readBody(t, resp); resp.StatusCode != http.StatusOK {
+				t.Fatalf("delete%s: status %d: %s", query, resp.StatusCode, body)
+			}
+		}
+
+		del("")
+		trashed, _ := docRepo.Get(project.ID.String(), uploaded.ID)
+		if trashed == nil || trashed.DeletedAt == nil {
+			t.Fatalf("trashed document row is %+v, want it kept with deleted_at", trashed)
+		}
+		if _, err := os.Stat(doc.StoredPath); !os.IsNotExist(err) {
+			t.Errorf("file still at %s after moving to the trash", doc.StoredPath)
+		}
+
+		del("?permanent=true")
+		if gone, _ := docRepo.Get(project.ID.String(), uploaded.ID); gone != nil {
+			t.Errorf("row still stored after permanent delete: %+v", gone)
+		}
+		if _, err := os.Stat(trashed.StoredPath); !os.IsNotExist(err) {
+			t.Errorf("file still at %s after permanent delete", trashed.StoredPath)
+		}
+		stored, _ := projectRepo.GetByID(project.ID.String())
+		if listed, _ := nodeDataByID(stored)["docs"]["documents"].([]interface{}); len(listed) != 0 {
+			t.Errorf("rag-documents node still lists %v", listed)
+		}
+	})
+}
+
+func TestReconcileDocuments(t *testing.T) {
+	useTestDB(t, documentModels...)
+	base := useTestStorage(t)
+	owner := uuid.New()
+	project := createTestProject(t, owner, `[{"id":"docs","type":"rag-documents","position":{"x":0,"y":0},"data":{"documents":[
+		{"id":"doc-ab12cd34","name":"Employee Handbook.pdf"}
+	]}}]`)
+	projectRepo := repository.NewProject(repository.GetDB())
+	docRepo := repository.NewDocument(repository.GetDB())
+
+	// Files uploaded before documents had rows, one of a deleted project
+	dir := projectDocumentDir(project)
+	files := map[string]string{
+		filepath.Join(dir, "doc-ab12cd34_20240101120000.pdf"):                   testPDF,
+		filepath.Join(dir, "doc-ef56ab78_20240102120000.txt"):                   "notes",
+		filepath.Join(dir, "doc-kept_20240103120000.md"):                        "# kept",
+		filepath.Join(base, owner.String(), uuid.NewString(), "doc-gone_1.txt"): "deleted project",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A row that already exists is left as it is
+	if _, err := docRepo.Create(&repository.Document{
+		ID: "doc-kept", ProjectID: project.ID, UserID: owner, Name: "Kept.md",
+		StoredPath: filepath.Join(dir, "doc-kept_20240103120000.md"), Status: "processing", Version: 1,
+		EmbeddingStatus: repository.DocumentEmbedded, UploadedAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Running it again at the next start changes nothing
+	ReconcileDocuments(docRepo, projectRepo)
+	ReconcileDocuments(docRepo, projectRepo)
+
+	docs, err := docRepo.ListByProject(project.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]repository.Document{}
+	for _, d := range docs {
+		got[d.ID] = d
+	}
+	tests := []struct {
+		id         string
+		wantName   string
+		wantStatus string
+		wantSize   int64
+	}{
+		{id: "doc-ab12cd34", wantName: "Employee Handbook.pdf", wantStatus: "ready", wantSize: int64(len(testPDF))},
+		{id: "doc-ef56ab78", wantName: "doc-ef56ab78_20240102120000.txt", wantStatus: "ready", wantSize: 5},
+		{id: "doc-kept", wantName: "Kept.md", wantStatus: "processing"},
+	}
+	if len(got) != len(tests) {
+		t.Errorf("backfilled %d documents, want %d: %v", len(got), len(tests), got)
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			d, ok := got[tt.id]
+			if !ok {
+				t.Fatal("no row")
+			}
+			if d.Name != tt.wantName || d.Status != tt.wantStatus || d.Size != tt.wantSize {
+				t.Errorf("row %s %s of %d bytes, want %s %s of %d bytes", d.Name, d.Status, d.Size, tt.wantName, tt.wantStatus, tt.wantSize)
+			}
+			if d.UserID != owner || !strings.HasPrefix(d.StoredPath, dir) {
+				t.Errorf("row by %s at %s, want by the owner under %s", d.UserID, d.StoredPath, dir)
+			}
+		})
+	}
+}
+
+func TestDocumentIDFromFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "doc-ab12cd34_v3_20240101120000.pdf", want: "doc-ab12cd34"},
+		{name: "doc-ab12cd34_20240101120000.pdf", want: "doc-ab12cd34"},
+		{name: "doc-ab12cd34_20240101.pdf", want: "doc-ab12cd34_20240101"},
+		{name: "my_doc_20240101120000.docx", want: "my_doc"},
+		{name: "doc-ab12cd34.pdf", want: "doc-ab12cd34"},
+		{name: "doc-ab12cd34_20241399999999.pdf", want: "doc-ab12cd34_20241399999999"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := documentIDFromFileName(tt.name); got != tt.want {
+				t.Errorf("documentIDFromFileName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadDocumentLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		file        string
+		content     string
+		wantStatus  int
+		wantCode    string
+		wantDetails map[string]interface{}
+	}{
+		{
+			name:       "at the size limit",
+			env:        map[string]string{"MAX_DOCUMENT_SIZE": "16"},
+			file:       "notes.txt",
+			content:    strings.Repeat("a", 16),
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:        "oversized file",
+			env:         map[string]string{"MAX_DOCUMENT_SIZE": "16"},
+			file:        "notes.txt",
+			content:     strings.Repeat("a", 17),
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    response.ErrCodeFileTooLarge,
+			wantDetails: map[string]interface{}{"size": float64(17), "max_bytes": float64(16)},
+		},
+		{
+			name:        "disallowed extension",
+			file:        "setup.exe",
+			content:     "MZ",
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantCode:    response.ErrCodeUnsupportedFileType,
+			wantDetails: map[string]interface{}{"type": ".exe", "allowed_types": []interface{}{".pdf", ".docx", ".txt", ".doc", ".md", ".csv", ".xlsx"}},
+		},
+		{
+			name:        "extension missing from a configured list",
+			env:         map[string]string{"ALLOWED_DOCUMENT_TYPES": "pdf, .MD"},
+			file:        "notes.txt",
+			content:     "notes",
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantCode:    response.ErrCodeUnsupportedFileType,
+			wantDetails: map[string]interface{}{"type": ".txt", "allowed_types": []interface{}{".pdf", ".md"}},
+		},
+		{
+			name:       "extension in a configured list",
+			env:        map[string]string{"ALLOWED_DOCUMENT_TYPES": "pdf, .MD"},
+			file:       "README.md",
+			content:    "# notes",
+			wantStatus: http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"MAX_DOCUMENT_SIZE", "ALLOWED_DOCUMENT_TYPES"} {
+				t.Setenv(env, tt.env[env])
+			}
+			useTestDB(t, documentModels...)
+			useTestStorage(t)
+			project := createTestProject(t, uuid.New(), `[]`)
+
+			resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+				return UploadDocument(c, repository.NewProject(repository.GetDB()))
+			}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", nil, testFile{tt.file, tt.content}))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+
+			var errResp struct {
+				Code    string                 `json:"code"`
+				Details map[string]interface{} `json:"details"`
+			}
+			if err := json.Unmarshal(body, &errResp); err != nil {
+				t.Fatalf("error response %s: %v", body, err)
+			}
+			if errResp.Code != tt.wantCode || !reflect.DeepEqual(errResp.Details, tt.wantDetails) {
+				t.Errorf("got %s %v, want %s %v", errResp.Code, errResp.Details, tt.wantCode, tt.wantDetails)
+			}
+			// Rejected files never reach the disk or the table
+			if entries, _ := os.ReadDir(projectDocumentDir(project)); len(entries) != 0 {
+				t.Errorf("%d files stored for a rejected upload", len(entries))
+			}
+			if docs, _ := repository.NewDocument(repository.GetDB()).ListByProject(project.ID.String()); len(docs) != 0 {
+				t.Errorf("%d document rows for a rejected upload", len(docs))
+			}
+		})
+	}
+}
+
+func TestUploadForNode(t *testing.T) {
+	const csv = "date,name\n2024-04-13,Songkran\n"
+	tests := []struct {
+		name       string
+		nodes      string
+		nodeID     string
+		file       testFile
+		wantStatus int
+		wantCode   string
+		// wantListed is how many documents the rag-documents node lists after
+		// the upload; -1 when the project has no such node
+		wantListed int
+	}{
+		{
+			name:       "CSV for a rag-documents node",
+			nodes:      `[{"id":"docs","type":"rag-documents","data":{}},{"id":"sheet","type":"google-sheets","data":{}}]`,
+			nodeID:     "docs",
+			file:       testFile{"holidays.csv", csv},
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantCode:   response.ErrCodeUnsupportedFileType,
+			wantListed: 0,
+		},
+		{
+			name:       "CSV for a google-sheets node",
+			nodes:      `[{"id":"docs","type":"rag-documents","data":{}},{"id":"sheet","type":"google-sheets","data":{}}]`,
+			nodeID:     "sheet",
+			file:       testFile{"holidays.csv", csv},
+			wantStatus: http.StatusCreated,
+			wantListed: 0,
+		},
+		{
+			name:       "CSV for a google-sheets node adds no rag-documents node",
+			nodes:      `[{"id":"sheet","type":"google-sheets","data":{}}]`,
+			nodeID:     "sheet",
+			file:       testFile{"holidays.csv", csv},
+			wantStatus: http.StatusCreated,
+			wantListed: -1,
+		},
+		{
+			name:       "text file for a rag-documents node",
+			nodes:      `[{"id":"docs","type":"rag-documents","data":{}},{"id":"sheet","type":"google-sheets","data":{}}]`,
+			nodeID:     "docs",
+			file:       testFile{"notes.txt", "notes"},
+			wantStatus: http.StatusCreated,
+			wantListed: 1,
+		},
+		{
+			name:       "unknown node",
+			nodes:      `[{"id":"docs","type":"rag-documents","data":{}}]`,
+			nodeID:     "gone",
+			file:       testFile{"notes.txt", "notes"},
+			wantStatus: http.StatusNotFound,
+			wantCode:   response.ErrCodeNotFound,
+			wantListed: 0,
+		},
+		{
+			name:       "corrupt nodes",
+			nodes:      `[{"id":"docs"`,
+			nodeID:     "docs",
+			file:       testFile{"notes.txt", "notes"},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   response.ErrCodeInvalidWorkflow,
+			wantListed: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t, documentModels...)
+			useTestStorage(t)
+			project := createTestProject(t, uuid.New(), tt.nodes)
+
+			resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+				return UploadDocument(c, repository.NewProject(repository.GetDB()))
+			}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", map[string]string{"nodeId": tt.nodeID}, tt.file))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, body); code != tt.wantCode {
+					t.Errorf("code = %s, want %s", code, tt.wantCode)
+				}
+			} else {
+				var info DocumentInfo
+				json.Unmarshal(body, &info)
+				doc, _ := repository.NewDocument(repository.GetDB()).Get(project.ID.String(), info.ID)
+				if doc == nil || doc.NodeID != tt.nodeID {
+					t.Errorf("stored document %+v, want it for node %s", doc, tt.nodeID)
+				}
+			}
+
+			stored, err := repository.NewProject(repository.GetDB()).GetByID(project.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode == response.ErrCodeInvalidWorkflow {
+				if string(stored.Nodes) != tt.nodes {
+					t.Errorf("nodes rewritten to %s", stored.Nodes)
+				}
+				return
+			}
+			listed := -1
+			nodes, _ := parseWorkflow(stored)
+			for _, node := range nodes {
+				if node["type"] == "rag-documents" {
+					docs, _ := nodeData(node)["documents"].([]interface{})
+					listed = len(docs)
+				}
+			}
+			if listed != tt.wantListed {
+				t.Errorf("rag-documents node lists %d documents, want %d", listed, tt.wantListed)
+			}
+		})
+	}
+}
+
+func TestGetDocumentLimits(t *testing.T) {
+	t.Setenv("MAX_DOCUMENT_SIZE", "1048576")
+	t.Setenv("ALLOWED_DOCUMENT_TYPES", "PDF,,.txt ")
+
+	resp := serveAs(t, uuid.NewString(), "/projects/document-limits", GetDocumentLimits, newRequest("GET", "/projects/document-limits", "", nil))
+	var limits struct {
+		MaxBytes     int64    `json:"max_bytes"`
+		AllowedTypes []string `json:"allowed_types"`
+	}
+	if err := json.Unmarshal(readBody(t, resp), &limits); err != nil {
+		t.Fatal(err)
+	}
+	if limits.MaxBytes != 1<<20 || !reflect.DeepEqual(limits.AllowedTypes, []string{".pdf", ".txt"}) {
+		t.Errorf("limits %d %v, want %d [.pdf .txt]", limits.MaxBytes, limits.AllowedTypes, 1<<20)
+	}
+}
+
+func TestDocumentContentMatches(t *testing.T) {
+	tests := []struct {
+		fixture string
+		// ext is the extension the file is uploaded under, when not its own
+		ext  string
+		want bool
+	}{
+		{fixture: "report.pdf", want: true},
+		{fixture: "report.docx", want: true},
+		{fixture: "sheet.xlsx", want: true},
+		{fixture: "legacy.doc", want: true},
+		{fixture: "notes.txt", want: true},
+		{fixture: "readme.md", want: true},
+		{fixture: "data.csv", want: true},
+		{fixture: "setup.exe.pdf", want: false},
+		{fixture: "setup.exe.docx", want: false},
+		{fixture: "setup.exe.txt", want: false},
+		{fixture: "report.docx", ext: ".pdf", want: false},
+		{fixture: "report.pdf", ext: ".docx", want: false},
+		{fixture: "legacy.doc", ext: ".txt", want: false},
+		{fixture: "sheet.xlsx", ext: ".csv", want: false},
+	}
+	for _, tt := range tests {
+		ext := tt.ext
+		if ext == "" {
+			ext = filepath.Ext(tt.fixture)
+		}
+		t.Run(tt.fixture+" as "+ext, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", "documents", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := documentContentMatches(content, ext); got != tt.want {
+				t.Errorf("documentContentMatches(%s, %s) = %v, want %v", tt.fixture, ext, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("empty text file", func(t *testing.T) {
+		if !documentContentMatches(nil, ".txt") {
+			t.Error("empty .txt rejected")
+		}
+	})
+}
+
+func TestUploadDisguisedBinary(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	exe, err := os.ReadFile(filepath.Join("testdata", "documents", "setup.exe.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+		return UploadDocument(c, repository.NewProject(repository.GetDB()))
+	}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", nil, testFile{"invoice.pdf", string(exe)}))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusUnsupportedMediaType || errorCode(t, body) != response.ErrCodeContentMismatch {
+		t.Fatalf("status %d: %s, want 415 %s", resp.StatusCode, body, response.ErrCodeContentMismatch)
+	}
+	if entries, _ := os.ReadDir(projectDocumentDir(project)); len(entries) != 0 {
+		t.Errorf("%d files stored for a disguised binary", len(entries))
+	}
+}
+
+func TestUploadDocuments(t *testing.T) {
+	const notes = "meeting notes"
+	tests := []struct {
+		name  string
+		files []testFile
+		// existing is uploaded before the request
+		existing   *testFile
+		wantStatus int
+		// wantResults are the per-file statuses, in order
+		wantResults []int
+		wantCodes   []string
+		wantStored  int
+	}{
+		{
+			name:        "all valid",
+			files:       []testFile{{"a.pdf", testPDF}, {"notes.txt", notes}},
+			wantStatus:  http.StatusCreated,
+			wantResults: []int{http.StatusCreated, http.StatusCreated},
+			wantCodes:   []string{"", ""},
+			wantStored:  2,
+		},
+		{
+			name: "failures don't abort the other files",
+			files: []testFile{
+				{"a.pdf", testPDF},
+				{"setup.exe", "MZ"},
+				{"big.txt", strings.Repeat("a", 65)},
+				{"invoice.pdf", "MZ not a pdf"},
+				{"notes.txt", notes},
+			},
+			wantStatus:  http.StatusMultiStatus,
+			wantResults: []int{http.StatusCreated, http.StatusUnsupportedMediaType, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusCreated},
+			wantCodes:   []string{"", response.ErrCodeUnsupportedFileType, response.ErrCodeFileTooLarge, response.ErrCodeContentMismatch, ""},
+			wantStored:  2,
+		},
+		{
+			name:        "content already in the project",
+			existing:    &testFile{"original.pdf", testPDF},
+			files:       []testFile{{"copy.pdf", testPDF}, {"notes.txt", notes}},
+			wantStatus:  http.StatusCreated,
+			wantResults: []int{http.StatusOK, http.StatusCreated},
+			wantCodes:   []string{"", ""},
+			wantStored:  2,
+		},
+		{
+			name:        "every file rejected",
+			files:       []testFile{{"setup.exe", "MZ"}, {"big.txt", strings.Repeat("a", 65)}},
+			wantStatus:  http.StatusMultiStatus,
+			wantResults: []int{http.StatusUnsupportedMediaType, http.StatusRequestEntityTooLarge},
+			wantCodes:   []string{response.ErrCodeUnsupportedFileType, response.ErrCodeFileTooLarge},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_DOCUMENT_SIZE", "64")
+			useTestDB(t, documentModels...)
+			useTestStorage(t)
+			project := createTestProject(t, uuid.New(), `[{"id":"docs","type":"rag-documents","position":{"x":0,"y":0},"data":{}}]`)
+			if tt.existing != nil {
+				uploadTestDocument(t, project, tt.existing.name, tt.existing.content)
+			}
+			projectRepo := repository.NewProject(repository.GetDB())
+			before, _ := projectRepo.GetByID(project.ID.String())
+
+			resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+				return UploadDocument(c, projectRepo)
+			}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "files", nil, tt.files...))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			var results []uploadResult
+			if err := json.Unmarshal(body, &results); err != nil {
+				t.Fatalf("results %s: %v", body, err)
+			}
+			var statuses []int
+			var codes []string
+			for i, result := range results {
+				if result.Name != tt.files[i].name {
+					t.Errorf("result %d is for %s, want %s", i, result.Name, tt.files[i].name)
+				}
+				statuses = append(statuses, result.Status)
+				code := ""
+				if result.Error != nil {
+					code = result.Error.Code
+				}
+				codes = append(codes, code)
+			}
+			if !reflect.DeepEqual(statuses, tt.wantResults) || !reflect.DeepEqual(codes, tt.wantCodes) {
+				t.Errorf("results %v %v, want %v %v", statuses, codes, tt.wantResults, tt.wantCodes)
+			}
+
+			entries, _ := os.ReadDir(projectDocumentDir(project))
+			if len(entries) != tt.wantStored {
+				t.Errorf("%d files stored, want %d", len(entries), tt.wantStored)
+			}
+			// The rag-documents node is written once for the whole request
+			after, _ := projectRepo.GetByID(project.ID.String())
+			listed, _ := nodeDataByID(after)["docs"]["documents"].([]interface{})
+			if len(listed) != tt.wantStored {
+				t.Errorf("rag-documents node lists %d documents, want %d", len(listed), tt.wantStored)
+			}
+			wantVersion := before.Version + 1
+			if tt.wantStored == 0 {
+				wantVersion = before.Version
+			}
+			if after.Version != wantVersion {
+				t.Errorf("project saved at version %d, want %d", after.Version, wantVersion)
+			}
+		})
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	const size = 100
+	tests := []struct {
+		name    string
+		header  string
+		want    byteRange
+		wantOK  bool
+		wantErr error
+	}{
+		{name: "closed range", header: "bytes=10-19", want: byteRange{10, 10}, wantOK: true},
+		{name: "suffix range", header: "bytes=-30", want: byteRange{70, 30}, wantOK: true},
+		{name: "suffix longer than the file", header: "bytes=-500", want: byteRange{0, size}, wantOK: true},
+		{name: "open-ended range", header: "bytes=90-", want: byteRange{90, 10}, wantOK: true},
+		{name: "end past EOF is clamped", header: "bytes=95-200", want: byteRange{95, 5}, wantOK: true},
+		{name: "start past EOF", header: "bytes=100-150", wantErr: errRangeNotSatisfiable},
+		{name: "empty suffix", header: "bytes=-0", wantErr: errRangeNotSatisfiable},
+		{name: "multi-range serves the first", header: "bytes=0-9, 50-59", want: byteRange{0, 10}, wantOK: true},
+		{name: "multi-range skips ranges past EOF", header: "bytes=200-300,40-49", want: byteRange{40, 10}, wantOK: true},
+		{name: "multi-range all past EOF", header: "bytes=200-300, 400-", wantErr: errRangeNotSatisfiable},
+		{name: "other unit", header: "items=0-9"},
+		{name: "end before start", header: "bytes=20-10"},
+		{name: "not a number", header: "bytes=a-b"},
+		{name: "missing dash", header: "bytes=10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := parseByteRange(tt.header, size)
+			if got != tt.want || ok != tt.wantOK || err != tt.wantErr {
+				t.Errorf("parseByteRange(%q) = %v, %v, %v, want %v, %v, %v", tt.header, got, ok, err, tt.want, tt.wantOK, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDocumentRangeRequests(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	fixture, err := os.ReadFile(filepath.Join("testdata", "documents", "legacy.doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := uploadTestDocument(t, project, "legacy.doc", string(fixture))
+	size := len(fixture)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantRange  string
+		wantBody   []byte
+		wantError  bool
+	}{
+		{
+			name:       "middle of the file",
+			header:     "bytes=100-199",
+			wantStatus: http.StatusPartialContent,
+			wantRange:  fmt.Sprintf("bytes 100-199/%d", size),
+			wantBody:   fixture[100:200],
+		},
+		{
+			name:       "suffix",
+			header:     "bytes=-16",
+			wantStatus: http.StatusPartialContent,
+			wantRange:  fmt.Sprintf("bytes %d-%d/%d", size-16, size-1, size),
+			wantBody:   fixture[size-16:],
+		},
+		{
+			name:       "past EOF",
+			header:     fmt.Sprintf("bytes=%d-", size),
+			wantStatus: http.StatusRequestedRangeNotSatisfiable,
+			wantRange:  fmt.Sprintf("bytes */%d", size),
+			wantError:  true,
+		},
+		{
+			name:       "no range",
+			wantStatus: http.StatusOK,
+			wantBody:   fixture,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest("GET", "/projects/"+project.ID.String()+"/documents/"+doc.ID+"/file", "", nil)
+			if tt.header != "" {
+				req.Header.Set(fiber.HeaderRange, tt.header)
+			}
+			resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId/file", func(c *fiber.Ctx) error {
+				return GetDocumentFile(c, repository.NewProject(repository.GetDB()))
+			}, req)
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentRange); got != tt.wantRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.wantRange)
+			}
+			if tt.wantError {
+				if code := errorCode(t, body); code != response.ErrCodeRangeNotSatisfiable {
+					t.Errorf("code = %s, want %s", code, response.ErrCodeRangeNotSatisfiable)
+				}
+				return
+			}
+			if !bytes.Equal(body, tt.wantBody) {
+				t.Errorf("body is %d bytes, want %d bytes of the fixture", len(body), len(tt.wantBody))
+			}
+			if got := resp.Header.Get(fiber.HeaderContentLength); got != strconv.Itoa(len(tt.wantBody)) {
+				t.Errorf("Content-Length = %s, want %d", got, len(tt.wantBody))
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{
+			name: "ASCII name",
+			file: "report.pdf",
+			want: `attachment; filename="report.pdf"; filename*=UTF-8''report.pdf`,
+		},
+		{
+			name: "Thai name",
+			file: "รายงาน.pdf",
+			want: `attachment; filename="______.pdf"; filename*=UTF-8''%E0%B8%A3%E0%B8%B2%E0%B8%A2%E0%B8%87%E0%B8%B2%E0%B8%99.pdf`,
+		},
+		{
+			name: "quotes, separators and percent signs",
+			file: `Q1 report; "final" 100%.pdf`,
+			want: `attachment; filename="Q1 report; _final_ 100%.pdf"; filename*=UTF-8''Q1%20report%3B%20%22final%22%20100%25.pdf`,
+		},
+		{
+			name: "backslash",
+			file: `a\b.pdf`,
+			want: `attachment; filename="a_b.pdf"; filename*=UTF-8''a%5Cb.pdf`,
+		},
+		{
+			name: "control characters can't split the header",
+			file: "a\r\nSet-Cookie: x.pdf",
+			want: `attachment; filename="aSet-Cookie: x.pdf"; filename*=UTF-8''a%0D%0ASet-Cookie%3A%20x.pdf`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := contentDisposition(tt.file)
+			if got != tt.want {
+				t.Errorf("contentDisposition(%q) =\n%s\nwant\n%s", tt.file, got, tt.want)
+			}
+			// Clients that read filename* get the name back as it was
+			_, params, err := mime.ParseMediaType(got)
+			if err != nil {
+				t.Fatalf("parse %s: %v", got, err)
+			}
+			if params["filename"] != tt.file {
+				t.Errorf("header decodes to %q, want %q", params["filename"], tt.file)
+			}
+		})
+	}
+}
+
+func TestDownloadDocument(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	projectRepo := repository.NewProject(repository.GetDB())
+	pdf := uploadTestDocument(t, project, "รายงาน.pdf", testPDF)
+	notes := uploadTestDocument(t, project, "notes.md", "# notes")
+	trashed := uploadTestDocument(t, project, "old.txt", "old")
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+		return DeleteDocument(c, projectRepo)
+	}, newRequest("DELETE", "/projects/"+project.ID.String()+"/documents/"+trashed.ID, "", nil))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("trash: status %d", resp.StatusCode)
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		docID           string
+		wantStatus      int
+		wantDisposition string
+		wantType        string
+		wantLength      int
+		wantBody        string
+	}{
+		{
+			name:            "original name and type",
+			method:          "GET",
+			docID:           pdf.ID,
+			wantStatus:      http.StatusOK,
+			wantDisposition: contentDisposition("รายงาน.pdf"),
+			wantType:        "application/pdf",
+			wantLength:      len(testPDF),
+			wantBody:        testPDF,
+		},
+		{
+			name:            "HEAD sends the headers alone",
+			method:          "HEAD",
+			docID:           pdf.ID,
+			wantStatus:      http.StatusOK,
+			wantDisposition: contentDisposition("รายงาน.pdf"),
+			wantType:        "application/pdf",
+			wantLength:      len(testPDF),
+		},
+		{
+			name:            "text type of a Markdown file",
+			method:          "GET",
+			docID:           notes.ID,
+			wantStatus:      http.StatusOK,
+			wantDisposition: contentDisposition("notes.md"),
+			wantType:        documentContentTypes[".md"],
+			wantLength:      len("# notes"),
+			wantBody:        "# notes",
+		},
+		{name: "document in the trash", method: "GET", docID: trashed.ID, wantStatus: http.StatusNotFound},
+		{name: "unknown document", method: "GET", docID: "doc-missing", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId/download", func(c *fiber.Ctx) error {
+				return DownloadDocument(c, projectRepo)
+			}, newRequest(tt.method, "/projects/"+project.ID.String()+"/documents/"+tt.docID+"/download", "", nil))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if disposition := resp.Header.Get(fiber.HeaderContentDisposition); disposition != "" {
+					t.Errorf("error response sent as attachment %q", disposition)
+				}
+				return
+			}
+			if got := resp.Header.Get(fiber.HeaderContentDisposition); got != tt.wantDisposition {
+				t.Errorf("Content-Disposition = %q, want %q", got, tt.wantDisposition)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentType); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentLength); got != strconv.Itoa(tt.wantLength) {
+				t.Errorf("Content-Length = %q, want %d", got, tt.wantLength)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUploadDeduplication(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	owner := uuid.New()
+	first := createTestProject(t, owner, `[]`)
+	second := createTestProject(t, owner, `[]`)
+	stranger := createTestProject(t, uuid.New(), `[]`)
+	handbook := testPDF + "% employee handbook\n"
+
+	// upload sends content to project and returns the response status and document
+	upload := func(t *testing.T, project *repository.Project, name, content string) (int, DocumentInfo) {
+		t.Helper()
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+			return UploadDocument(c, repository.NewProject(repository.GetDB()))
+		}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", nil, testFile{name, content}))
+		body := readBody(t, resp)
+		var info DocumentInfo
+		if err := json.Unmarshal(body, &info); err != nil {
+			t.Fatalf("upload response %s: %v", body, err)
+		}
+		return resp.StatusCode, info
+	}
+	files := func(project *repository.Project) []string {
+		entries, _ := os.ReadDir(projectDocumentDir(project))
+		var names []string
+		for _, e := range entries {
+			if !e.IsDir() {
+				names = append(names, e.Name())
+			}
+		}
+		return names
+	}
+
+	status, original := upload(t, first, "handbook.pdf", handbook)
+	if status != http.StatusCreated || original.Deduplicated {
+		t.Fatalf("first upload: status %d deduplicated %v, want 201 stored", status, original.Deduplicated)
+	}
+
+	steps := []struct {
+		name             string
+		project          *repository.Project
+		file             string
+		wantStatus       int
+		wantSameDocument bool
+		wantDeduplicated bool
+		// wantLinked is whether the file shares the original's on disk
+		wantLinked bool
+		wantFiles  int
+	}{
+		{name: "same bytes in the same project", project: first, file: "handbook copy.pdf", wantStatus: http.StatusOK, wantSameDocument: true, wantDeduplicated: true, wantFiles: 1},
+		{name: "same bytes in another project of the user", project: second, file: "handbook.pdf", wantStatus: http.StatusCreated, wantDeduplicated: true, wantLinked: true, wantFiles: 1},
+		{name: "same bytes from another user", project: stranger, file: "handbook.pdf", wantStatus: http.StatusCreated, wantFiles: 1},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			status, doc := upload(t, step.project, step.file, handbook)
+			if status != step.wantStatus {
+				t.Fatalf("status = %d, want %d", status, step.wantStatus)
+			}
+			if (doc.ID == original.ID && step.project == first) != step.wantSameDocument || doc.Deduplicated != step.wantDeduplicated {
+				t.Errorf("got %s deduplicated %v, want same document %v deduplicated %v", doc.ID, doc.Deduplicated, step.wantSameDocument, step.wantDeduplicated)
+			}
+			if doc.ContentHash != original.ContentHash {
+				t.Errorf("hash %s, want %s", doc.ContentHash, original.ContentHash)
+			}
+			if got := files(step.project); len(got) != step.wantFiles {
+				t.Errorf("project stores %v, want %d file(s)", got, step.wantFiles)
+			}
+			if step.project == first {
+				return
+			}
+			stored, _ := repository.NewDocument(repository.GetDB()).Get(step.project.ID.String(), doc.ID)
+			src, _ := os.Stat(original.FilePath)
+			dst, _ := os.Stat(stored.StoredPath)
+			if linked := src != nil && dst != nil && os.SameFile(src, dst); linked != step.wantLinked {
+				t.Errorf("file shared with the original: %v, want %v", linked, step.wantLinked)
+			}
+		})
+	}
+
+	t.Run("storage counts shared bytes once", func(t *testing.T) {
+		resp := serveAs(t, owner.String(), "/users/:id/storage", GetUserStorage, newRequest("GET", "/users/"+owner.String()+"/storage", "", nil))
+		var usage UserStorage
+		if err := json.Unmarshal(readBody(t, resp), &usage); err != nil {
+			t.Fatal(err)
+		}
+		size := int64(len(handbook))
+		if usage.Documents != 2 || usage.TotalBytes != 2*size || usage.DeduplicatedBytes != size || usage.StoredBytes != size || usage.UsedBytes != size {
+			t.Errorf("storage %+v, want 2 documents of %d bytes stored once", usage.DocumentStorage, size)
+		}
+		if len(usage.Projects) != 2 {
+			t.Errorf("storage split across %d projects, want 2", len(usage.Projects))
+		}
+	})
+
+	t.Run("documents in the trash don't match", func(t *testing.T) {
+		resp := serveAs(t, owner.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+			return DeleteDocument(c, repository.NewProject(repository.GetDB()))
+		}, newRequest("DELETE", "/projects/"+first.ID.String()+"/documents/"+original.ID, "", nil))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("trash: status %d", resp.StatusCode)
+		}
+		status, doc := upload(t, first, "handbook.pdf", handbook)
+		if status != http.StatusCreated || doc.ID == original.ID {
+			t.Errorf("upload after trashing: status %d document %s, want a new document", status, doc.ID)
+		}
+	})
+
+	t.Run("another user's storage is forbidden", func(t *testing.T) {
+		resp := serveAs(t, uuid.NewString(), "/users/:id/storage", GetUserStorage, newRequest("GET", "/users/"+owner.String()+"/storage", "", nil))
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", resp.StatusCode)
+		}
+	})
+}
+
+// memoryStorage is an object store kept in memory, standing in for S3
+type memoryStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// useMemoryStorage stores documents in memory until the test ends
+func useMemoryStorage(t *testing.T) *memoryStorage {
+	s := &memoryStorage{objects: map[string][]byte{}}
+	prev := documentStorage
+	documentStorage = s
+	t.Cleanup(func() { documentStorage = prev })
+	return s
+}
+
+func (s *memoryStorage) Save(ctx context.Context, key string, r io.Reader, size int64) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = b
+	return nil
+}
+
+func (s *memoryStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.objects[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s *memoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memoryStorage) Stat(ctx context.Context, key string) (storage.Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.objects[key]
+	if !ok {
+		return storage.Info{}, storage.ErrNotFound
+	}
+	return storage.Info{Size: int64(len(b)), ModTime: time.Now()}, nil
+}
+
+func (s *memoryStorage) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "https://objects.example/" + filepath.ToSlash(key) + "?expires=" + expiry.String(), nil
+}
+
+func TestDocumentsInObjectStorage(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	useEmbeddingWorkers()
+	objects := useMemoryStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	projectRepo := repository.NewProject(repository.GetDB())
+
+	uploaded := uploadTestDocument(t, project, "report.pdf", testPDF)
+	doc, _ := repository.NewDocument(repository.GetDB()).Get(project.ID.String(), uploaded.ID)
+	if got, _ := objects.Open(context.Background(), doc.StoredPath); got == nil {
+		t.Fatalf("upload not saved to the object store under %s", doc.StoredPath)
+	}
+	if _, err := os.Stat(doc.StoredPath); !os.IsNotExist(err) {
+		t.Errorf("upload written to the local disk too: %v", err)
+	}
+
+	t.Run("files are read back from the store", func(t *testing.T) {
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId/file", func(c *fiber.Ctx) error {
+			return GetDocumentFile(c, projectRepo)
+		}, newRequest("GET", "/projects/"+project.ID.String()+"/documents/"+uploaded.ID+"/file", "", nil))
+		if body := readBody(t, resp); resp.StatusCode != http.StatusOK || string(body) != testPDF {
+			t.Errorf("status %d: %q", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("the AI service gets signed URLs instead of a path", func(t *testing.T) {
+		started, release := fakeEmbeddingService(t, project.ID.String(), http.StatusOK)
+		current, _ := projectRepo.GetByID(project.ID.String())
+		resp, body := queueEmbedding(t, project, "")
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("embed: status %d: %s", resp.StatusCode, body)
+		}
+		req := <-started
+		close(release)
+		waitForEmbedding(t, project, current.Version)
+
+		want := []map[string]string{{
+			"id":   uploaded.ID,
+			"name": filepath.Base(doc.StoredPath),
+			"url":  "https://objects.example/" + filepath.ToSlash(doc.StoredPath) + "?expires=" + documentURLTTL.String(),
+		}}
+		if req.DocumentsPath != "" || !reflect.DeepEqual(req.DocumentURLs, want) {
+			t.Errorf("AI service got path %q and URLs %v, want URLs %v", req.DocumentsPath, req.DocumentURLs, want)
+		}
+	})
+
+	t.Run("permanent delete removes the object", func(t *testing.T) {
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+			return DeleteDocument(c, projectRepo)
+		}, newRequest("DELETE", "/projects/"+project.ID.String()+"/documents/"+uploaded.ID+"?permanent=true", "", nil))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("delete: status %d", resp.StatusCode)
+		}
+		objects.mu.Lock()
+		defer objects.mu.Unlock()
+		if len(objects.objects) != 0 {
+			t.Errorf("objects left after delete: %d", len(objects.objects))
+		}
+	})
+}
+
+func TestInvalidDocumentParams(t *testing.T) {
+	projectID := uuid.NewString()
+	tests := []struct {
+		name      string
+		projectID string
+		docID     string
+		want      string
+	}{
+		{name: "valid", projectID: projectID, docID: "doc-ab12cd34"},
+		{name: "no document", projectID: projectID},
+		{name: "parent directories", projectID: projectID, docID: "../../etc/passwd", want: "invalid document id"},
+		{name: "encoded parent directories", projectID: projectID, docID: "..%2F..%2Fetc", want: "invalid document id"},
+		{name: "dot", projectID: projectID, docID: "..", want: "invalid document id"},
+		{name: "hidden name", projectID: projectID, docID: ".trash", want: "invalid document id"},
+		{name: "extension", projectID: projectID, docID: "doc-a.pdf", want: "invalid document id"},
+		{name: "backslash", projectID: projectID, docID: `..\..\x`, want: "invalid document id"},
+		{name: "underscore that would split the stored name", projectID: projectID, docID: "doc_20240101120000", want: "invalid document id"},
+		{name: "leading dash", projectID: projectID, docID: "-rf", want: "invalid document id"},
+		{name: "too long", projectID: projectID, docID: strings.Repeat("a", 129), want: "invalid document id"},
+		{name: "longest", projectID: projectID, docID: strings.Repeat("a", 128)},
+		{name: "project id with parent directories", projectID: "..%2F..%2Fother-user", docID: "doc-a", want: "invalid project id"},
+		{name: "project id that is not a UUID", projectID: "project-1", want: "invalid project id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			var got string
+			handler := func(c *fiber.Ctx) error {
+				got = invalidDocumentParams(c)
+				return nil
+			}
+			app.Get("/projects/:id/documents", handler)
+			app.Get("/projects/:id/documents/:docId", handler)
+			target := "/projects/" + tt.projectID + "/documents"
+			if tt.docID != "" {
+				target += "/" + url.PathEscape(tt.docID)
+			}
+			if _, err := app.Test(newRequest("GET", target, "", nil)); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("invalidDocumentParams(%s) = %q, want %q", target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithinDir(t *testing.T) {
+	dir := filepath.Join("uploads", "documents")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: filepath.Join(dir, "user", "project", "doc.pdf"), want: true},
+		{path: dir, want: true},
+		{path: dir + string(filepath.Separator), want: true},
+		{path: filepath.Join(dir, "user", "..", "other", "doc.pdf"), want: true},
+		{path: filepath.Join(dir, "..", "documents-old", "doc.pdf")},
+		{path: dir + "-old"},
+		{path: filepath.Join(dir, "..", "..", "etc", "passwd")},
+		{path: "uploads/documents/../../etc/passwd"},
+		{path: filepath.Join(dir, "..")},
+		{path: "/etc/passwd"},
+		// "..file" is a file name, not a parent directory
+		{path: filepath.Join(dir, "..file"), want: true},
+	}
+	for _, tt := range tests {
+		if got := withinDir(dir, tt.path); got != tt.want {
+			t.Errorf("withinDir(%q, %q) = %v, want %v", dir, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDocumentTraversal(t *testing.T) {
+	useTestDB(t, documentModels...)
+	base := useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	projectRepo := repository.NewProject(repository.GetDB())
+
+	// A file outside the storage root that must never be read or removed
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// and a row pointing at it, as a tampered database would have
+	if _, err := repository.NewDocument(repository.GetDB()).Create(&repository.Document{
+		ID: "doc-tampered", ProjectID: project.ID, UserID: project.UserID, Name: "secret.txt",
+		StoredPath: outside, Status: "ready", Version: 1, EmbeddingStatus: repository.DocumentEmbeddingPending,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers := map[string]func(c *fiber.Ctx, repo *repository.ProjectRepository) error{
+		"GET":    GetDocumentFile,
+		"DELETE": DeleteDocument,
+	}
+	tests := []struct {
+		name       string
+		method     string
+		projectID  string
+		docID      string
+		wantStatus int
+	}{
+		{name: "get with parent directories", method: "GET", projectID: project.ID.String(), docID: "..%2F..%2Fsecret", wantStatus: http.StatusBadRequest},
+		{name: "delete with parent directories", method: "DELETE", projectID: project.ID.String(), docID: "..%2F..%2Fsecret", wantStatus: http.StatusBadRequest},
+		{name: "get with a dotted id", method: "GET", projectID: project.ID.String(), docID: "..", wantStatus: http.StatusBadRequest},
+		{name: "crafted project id", method: "GET", projectID: "..%2F" + project.UserID.String(), docID: "doc-a", wantStatus: http.StatusBadRequest},
+		{name: "stored path outside the storage root", method: "GET", projectID: project.ID.String(), docID: "doc-tampered", wantStatus: http.StatusBadRequest},
+		{name: "permanent delete of a path outside the storage root", method: "DELETE", projectID: project.ID.String(), docID: "doc-tampered?permanent=true", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := handlers[tt.method]
+			resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+				return handler(c, projectRepo)
+			}, newRequest(tt.method, "/projects/"+tt.projectID+"/documents/"+tt.docID, "", nil))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if strings.Contains(string(body), "secret") && tt.method == "GET" {
+				t.Errorf("served the file outside the storage root: %s", body)
+			}
+			if content, err := os.ReadFile(outside); err != nil || string(content) != "secret" {
+				t.Errorf("file outside the storage root changed: %q, %v", content, err)
+			}
+		})
+	}
+
+	t.Run("upload with a traversal document id", func(t *testing.T) {
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+			return UploadDocument(c, projectRepo)
+		}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", map[string]string{"documentId": "../../escape"}, testFile{"a.txt", "text"}))
+		if body := readBody(t, resp); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400: %s", resp.StatusCode, body)
+		}
+		err := filepath.Walk(filepath.Dir(base), func(path string, info os.FileInfo, err error) error {
+			if err == nil && strings.HasPrefix(info.Name(), "escape") {
+				t.Errorf("upload written to %s", path)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestStorageQuota(t *testing.T) {
+	t.Setenv("STORAGE_QUOTA_BYTES", "100")
+	useTestDB(t, uploadModels...)
+	useTestStorage(t)
+	owner := uuid.New()
+	first := createTestProject(t, owner, `[]`)
+	second := createTestProject(t, owner, `[]`)
+	projectRepo := repository.NewProject(repository.GetDB())
+
+	// send uploads files to project in the given form field as its owner
+	send := func(t *testing.T, project *repository.Project, field string, files ...testFile) (int, []byte) {
+		t.Helper()
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+			return UploadDocument(c, projectRepo)
+		}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", field, nil, files...))
+		return resp.StatusCode, readBody(t, resp)
+	}
+	// documentAction calls handler on a document of project
+	documentAction := func(t *testing.T, method, suffix string, handler func(c *fiber.Ctx, repo *repository.ProjectRepository) error, project *repository.Project, docID string) (int, []byte) {
+		t.Helper()
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId"+suffix, func(c *fiber.Ctx) error {
+			return handler(c, projectRepo)
+		}, newRequest(method, "/projects/"+project.ID.String()+"/documents/"+docID+suffix, "", nil))
+		return resp.StatusCode, readBody(t, resp)
+	}
+	// quotaError returns the code and details of an error response
+	quotaError := func(t *testing.T, body []byte) (string, map[string]float64) {
+		t.Helper()
+		var errBody struct {
+			Code    string             `json:"code"`
+			Details map[string]float64 `json:"details"`
+		}
+		json.Unmarshal(body, &errBody)
+		return errBody.Code, errBody.Details
+	}
+	var trashedID string
+
+	steps := []struct {
+		name       string
+		do         func(t *testing.T) (int, []byte)
+		wantStatus int
+		// wantQuotaError is set when the step is refused for the quota
+		wantQuotaError bool
+	}{
+		{
+			name: "under the quota",
+			do: func(t *testing.T) (int, []byte) {
+				return send(t, first, "file", testFile{"a.txt", strings.Repeat("a", 60)})
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "exactly at the quota",
+			do: func(t *testing.T) (int, []byte) {
+				status, body := send(t, second, "file", testFile{"b.txt", strings.Repeat("b", 40)})
+				var info DocumentInfo
+				json.Unmarshal(body, &info)
+				trashedID = info.ID
+				return status, body
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:           "one byte over",
+			do:             func(t *testing.T) (int, []byte) { return send(t, first, "file", testFile{"c.txt", "c"}) },
+			wantStatus:     http.StatusRequestEntityTooLarge,
+			wantQuotaError: true,
+		},
+		{
+			name: "identical content takes no more space",
+			do: func(t *testing.T) (int, []byte) {
+				return send(t, first, "file", testFile{"copy.txt", strings.Repeat("a", 60)})
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "identical content shared with another project",
+			do: func(t *testing.T) (int, []byte) {
+				return send(t, second, "file", testFile{"a.txt", strings.Repeat("a", 60)})
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "multi-file upload",
+			do: func(t *testing.T) (int, []byte) {
+				status, body := send(t, first, "files", testFile{"c.txt", "c"}, testFile{"d.txt", "d"})
+				var results []uploadResult
+				json.Unmarshal(body, &results)
+				for _, r := range results {
+					if r.Status != http.StatusRequestEntityTooLarge || r.Error == nil || r.Error.Code != response.ErrCodeStorageQuotaExceeded {
+						t.Errorf("%s: status %d error %+v, want the quota exceeded", r.Name, r.Status, r.Error)
+					}
+				}
+				return status, body
+			},
+			wantStatus: http.StatusMultiStatus,
+		},
+		{
+			name: "archive upload",
+			do: func(t *testing.T) (int, []byte) {
+				status, body := send(t, first, "file", testFile{"notes.zip", zipArchive(t, testFile{"c.txt", "c"})})
+				if !strings.Contains(string(body), "storage quota exceeded") {
+					t.Errorf("archive entry not skipped for the quota: %s", body)
+				}
+				return status, body
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "chunked upload",
+			do: func(t *testing.T) (int, []byte) {
+				return uploadClient{t, first, owner.String()}.create(`{"file_name":"c.txt","size":1}`)
+			},
+			wantStatus:     http.StatusRequestEntityTooLarge,
+			wantQuotaError: true,
+		},
+		{
+			name: "other users have their own quota",
+			do: func(t *testing.T) (int, []byte) {
+				return send(t, createTestProject(t, uuid.New(), `[]`), "file", testFile{"e.txt", strings.Repeat("e", 100)})
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "deleting reclaims the quota",
+			do: func(t *testing.T) (int, []byte) {
+				if status, body := documentAction(t, "DELETE", "", DeleteDocument, second, trashedID); status != http.StatusOK {
+					t.Fatalf("delete: status %d: %s", status, body)
+				}
+				return send(t, first, "file", testFile{"f.txt", strings.Repeat("f", 40)})
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "restoring needs room again",
+			do: func(t *testing.T) (int, []byte) {
+				return documentAction(t, "POST", "/restore", RestoreDocument, second, trashedID)
+			},
+			wantStatus:     http.StatusRequestEntityTooLarge,
+			wantQuotaError: true,
+		},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			status, body := step.do(t)
+			if status != step.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, step.wantStatus, body)
+			}
+			if !step.wantQuotaError {
+				return
+			}
+			code, details := quotaError(t, body)
+			if code != response.ErrCodeStorageQuotaExceeded || details["used_bytes"] != 100 || details["quota_bytes"] != 100 || details["size"] <= 0 {
+				t.Errorf("error %s %v, want the quota exceeded with 100 of 100 bytes used", code, details)
+			}
+		})
+	}
+}
+
+func TestDeleteAllDocuments(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[{"id":"docs","type":"rag-documents","position":{"x":0,"y":0},"data":{}},{"id":"llm","type":"llm","position":{"x":0,"y":0},"data":{"model":"gpt"}}]`)
+	other := createTestProject(t, project.UserID, `[]`)
+	projectRepo := repository.NewProject(repository.GetDB())
+	docRepo := repository.NewDocument(repository.GetDB())
+
+	deleted := make(chan string, 1)
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.ProjectID != project.ID.String() {
+			http.NotFound(w, r)
+			return
+		}
+		// Trashing one document drops only its vectors
+		if r.URL.Path == "/delete-index" {
+			deleted <- req.ProjectID
+		}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer ai.Close()
+	t.Setenv("AI_SERVICE_URL", ai.URL)
+
+	report := uploadTestDocument(t, project, "report.pdf", testPDF)
+	notes := uploadTestDocument(t, project, "notes.txt", "meeting notes")
+	trashed := uploadTestDocument(t, project, "old.txt", "old")
+	kept := uploadTestDocument(t, other, "kept.txt", "other project")
+	if status, _, body := getPreview(t, project, notes.ID, ""); status != http.StatusOK {
+		t.Fatalf("preview: status %d: %s", status, body)
+	}
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+		return DeleteDocument(c, projectRepo)
+	}, newRequest("DELETE", "/projects/"+project.ID.String()+"/documents/"+trashed.ID, "", nil))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("trash: status %d", resp.StatusCode)
+	}
+
+	deleteAll := func(t *testing.T, userID string) (int, []byte) {
+		t.Helper()
+		resp := serveAs(t, userID, "/projects/:id/documents", func(c *fiber.Ctx) error {
+			return DeleteAllDocuments(c, projectRepo)
+		}, newRequest("DELETE", "/projects/"+project.ID.String()+"/documents", "", nil))
+		return resp.StatusCode, readBody(t, resp)
+	}
+	// storedFiles counts the files left in the project's directory
+	storedFiles := func(t *testing.T) []string {
+		t.Helper()
+		var files []string
+		filepath.Walk(projectDocumentDir(project), func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		return files
+	}
+
+	t.Run("viewers may not", func(t *testing.T) {
+		viewer := uuid.New()
+		addTestMember(t, project, viewer, repository.MemberViewer)
+		if status, body := deleteAll(t, viewer.String()); status != http.StatusForbidden {
+			t.Errorf("status = %d, want 403: %s", status, body)
+		}
+		if files := storedFiles(t); len(files) != 4 {
+			t.Errorf("%d files after a refused delete, want 4", len(files))
+		}
+	})
+
+	t.Run("removes every document", func(t *testing.T) {
+		before, _ := projectRepo.GetByID(project.ID.String())
+		status, body := deleteAll(t, project.UserID.String())
+		if status != http.StatusOK {
+			t.Fatalf("status = %d: %s", status, body)
+		}
+		var removed struct {
+			Files int   `json:"files_removed"`
+			Bytes int64 `json:"bytes_removed"`
+		}
+		json.Unmarshal(body, &removed)
+		if want := report.Size + notes.Size + trashed.Size; removed.Files != 3 || removed.Bytes != want {
+			t.Errorf("removed %d files of %d bytes, want 3 of %d", removed.Files, removed.Bytes, want)
+		}
+
+		// Documents, the trash and cached previews are gone
+		if files := storedFiles(t); len(files) != 0 {
+			t.Errorf("files left: %v", files)
+		}
+		if docs, _ := docRepo.ListByProject(project.ID.String()); len(docs) != 0 {
+			t.Errorf("%d document rows left", len(docs))
+		}
+
+		// The node keeps an empty documents array; other nodes are untouched
+		stored, _ := projectRepo.GetByID(project.ID.String())
+		nodes := nodeDataByID(stored)
+		listed, ok := nodes["docs"]["documents"].([]interface{})
+		if !ok || len(listed) != 0 {
+			t.Errorf("rag-documents node lists %v, want an empty array", nodes["docs"]["documents"])
+		}
+		if nodes["llm"]["model"] != "gpt" {
+			t.Errorf("llm node became %v", nodes["llm"])
+		}
+		if stored.Version != before.Version+1 {
+			t.Errorf("project version %d, want %d: the node is cleared in one update", stored.Version, before.Version+1)
+		}
+
+		select {
+		case id := <-deleted:
+			if id != project.ID.String() {
+				t.Errorf("index of %s deleted", id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("embedding index was not deleted")
+		}
+	})
+
+	t.Run("other projects keep theirs", func(t *testing.T) {
+		doc, _ := docRepo.Get(other.ID.String(), kept.ID)
+		if doc == nil {
+			t.Fatal("document of another project deleted")
+		}
+		if _, err := os.Stat(doc.StoredPath); err != nil {
+			t.Errorf("file of another project: %v", err)
+		}
+	})
+
+	t.Run("nothing left to delete", func(t *testing.T) {
+		status, body := deleteAll(t, project.UserID.String())
+		if status != http.StatusOK || !strings.Contains(string(body), `"files_removed":0`) {
+			t.Errorf("status %d: %s, want nothing removed", status, body)
+		}
+		<-deleted
+	})
+}
+
+// eicar is the EICAR anti-virus test file
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// stubScanner flags files containing the EICAR test string, or fails every
+// scan with err
+type stubScanner struct {
+	err error
+}
+
+func (s stubScanner) Scan(ctx context.Context, r io.Reader) (scanner.Result, error) {
+	if s.err != nil {
+		return scanner.Result{}, s.err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return scanner.Result{}, err
+	}
+	if bytes.Contains(content, []byte(eicar)) {
+		return scanner.Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return scanner.Result{}, nil
+}
+
+func TestUploadMalwareScan(t *testing.T) {
+	tests := []struct {
+		name       string
+		scanner    stubScanner
+		failMode   string
+		content    string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "clean file", content: "leave policy", wantStatus: http.StatusCreated},
+		{name: "EICAR test file", content: "before\n" + eicar + "\nafter", wantStatus: http.StatusUnprocessableEntity, wantCode: response.ErrCodeMalwareDetected},
+		{name: "scanner down fails closed", scanner: stubScanner{errors.New("clamd: connection refused")}, content: "leave policy", wantStatus: http.StatusServiceUnavailable, wantCode: response.ErrCodeUnavailable},
+		{name: "scanner down fails open", scanner: stubScanner{errors.New("clamd: connection refused")}, failMode: "open", content: "leave policy", wantStatus: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := documentScanner
+			documentScanner = tt.scanner
+			t.Cleanup(func() { documentScanner = prev })
+			t.Setenv("SCANNER_FAIL_MODE", tt.failMode)
+			db := useTestDB(t, documentModels...)
+			useTestStorage(t)
+			project := createTestProject(t, uuid.New(), `[]`)
+
+			resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+				return UploadDocument(c, repository.NewProject(repository.GetDB()))
+			}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", nil, testFile{"policy.txt", tt.content}))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			entries, _ := os.ReadDir(projectDocumentDir(project))
+			docs, _ := repository.NewDocument(db).ListByProject(project.ID.String())
+			if tt.wantCode == "" {
+				if len(entries) != 1 || len(docs) != 1 {
+					t.Errorf("%d files and %d rows stored for an accepted upload, want 1 of each", len(entries), len(docs))
+				}
+				return
+			}
+			if code := errorCode(t, body); code != tt.wantCode {
+				t.Errorf("code = %s, want %s", code, tt.wantCode)
+			}
+			if len(entries) != 0 || len(docs) != 0 {
+				t.Errorf("%d files and %d rows stored for a refused upload", len(entries), len(docs))
+			}
+			var detected int64
+			db.Model(&repository.AuditLog{}).Where("action = ? AND resource_id = ?", "document.malware_detected", project.ID.String()).Count(&detected)
+			if want := tt.wantCode == response.ErrCodeMalwareDetected; (detected == 1) != want {
+				t.Errorf("%d malware_detected audit entries, want one: %v", detected, want)
+			}
+		})
+	}
+}
+
+func TestSetNodeDocuments(t *testing.T) {
+	docs := []repository.Document{
+		{ID: "doc-a", Name: "a.txt", StoredPath: "doc-a_v1.txt", ContentType: "text/plain", Status: "ready", NodeID: "removed"},
+		{ID: "doc-b", Name: "b.pdf", StoredPath: "doc-b_v1.pdf", ContentType: "application/pdf", Status: "ready"},
+	}
+	tests := []struct {
+		name    string
+		nodes   string
+		wantErr bool
+		wantIn  string // the rag-documents node listing the documents, "" for an added one
+	}{
+		{name: "no nodes", nodes: `[]`},
+		{name: "no rag-documents node", nodes: `[{"id":"model","type":"ai-model","position":{"x":0,"y":0},"data":{"modelName":"gpt-4o"}}]`},
+		{name: "target node removed", nodes: `[{"id":"docs","type":"rag-documents","position":{"x":0,"y":0},"data":{}}]`, wantIn: "docs"},
+		{name: "corrupt nodes", nodes: `[{"id":"model","type":`, wantErr: true},
+		{name: "nodes not a list", nodes: `{"id":"model"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := &repository.Project{ID: uuid.New(), Nodes: datatypes.JSON(tt.nodes)}
+			err := setNodeDocuments(project, docs)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidNodes) {
+					t.Fatalf("err = %v, want errInvalidNodes", err)
+				}
+				if string(project.Nodes) != tt.nodes {
+					t.Errorf("nodes rewritten to %s on error", project.Nodes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nodes, _ := parseWorkflow(project)
+			var listing []string
+			for _, node := range nodes {
+				if node["type"] != "rag-documents" {
+					continue
+				}
+				id, _ := node["id"].(string)
+				listing = append(listing, id)
+				documents, _ := nodeData(node)["documents"].([]interface{})
+				if len(documents) != len(docs) {
+					t.Errorf("node %s lists %d documents, want %d", id, len(documents), len(docs))
+				}
+			}
+			if len(listing) != 1 || (tt.wantIn != "" && listing[0] != tt.wantIn) {
+				t.Errorf("rag-documents nodes %v, want one listing the documents", listing)
+			}
+			var before []map[string]interface{}
+			json.Unmarshal([]byte(tt.nodes), &before)
+			wantAdded := 0
+			if tt.wantIn == "" {
+				wantAdded = 1
+			}
+			if added := len(nodes) - len(before); added != wantAdded {
+				t.Errorf("%d nodes added to %s, want %d", added, tt.nodes, wantAdded)
+			}
+		})
+	}
+}
+
+func TestUploadToCorruptWorkflow(t *testing.T) {
+	db := useTestDB(t, documentModels...)
+	useTestStorage(t)
+	const corrupt = `[{"id":"docs","type":"rag-documents",`
+	project := createTestProject(t, uuid.New(), corrupt)
+
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+		return UploadDocument(c, repository.NewProject(db))
+	}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", nil, testFile{"notes.txt", "hello"}))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusUnprocessableEntity || errorCode(t, body) != response.ErrCodeInvalidWorkflow {
+		t.Fatalf("status = %d: %s, want 422 %s", resp.StatusCode, body, response.ErrCodeInvalidWorkflow)
+	}
+
+	// The workflow is left as it was and the upload is not kept
+	var stored repository.Project
+	if err := db.Where("id = ?", project.ID).First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if string(stored.Nodes) != corrupt || stored.Version != project.Version {
+		t.Errorf("workflow changed to %s (version %d)", stored.Nodes, stored.Version)
+	}
+	entries, _ := os.ReadDir(projectDocumentDir(project))
+	docs, _ := repository.NewDocument(db).ListByProject(project.ID.String())
+	if len(entries) != 0 || len(docs) != 0 {
+		t.Errorf("%d files and %d rows kept after a failed upload", len(entries), len(docs))
+	}
+}
+
+func TestGetDocumentFileInTrash(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	doc := uploadTestDocument(t, project, "notes.txt", "leave policy\n")
+	target := "/projects/" + project.ID.String() + "/documents/" + doc.ID
+	getFile := func(query string) (int, []byte) {
+		t.Helper()
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId/file", func(c *fiber.Ctx) error {
+			return GetDocumentFile(c, repository.NewProject(repository.GetDB()))
+		}, newRequest("GET", target+"/file"+query, "", nil))
+		return resp.StatusCode, readBody(t, resp)
+	}
+	if status, body := getFile(""); status != http.StatusOK || string(body) != "leave policy\n" {
+		t.Fatalf("before trashing: status %d: %q", status, body)
+	}
+
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+		return DeleteDocument(c, repository.NewProject(repository.GetDB()))
+	}, newRequest("DELETE", target, "", nil))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("trash: status %d", resp.StatusCode)
+	}
+
+	for _, query := range []string{"", "?download=true", "?version=1"} {
+		status, body := getFile(query)
+		if status != http.StatusNotFound || errorCode(t, body) != response.ErrCodeNotFound {
+			t.Errorf("file%s of a trashed document: status %d: %s, want 404", query, status, body)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/storage"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// A document re-uploaded under its ID gets the next version number. The file
+// it replaces is moved into the .versions directory of the project and kept
+// as a DocumentVersion until the document is deleted for good, so an earlier
+// version can be downloaded or restored. Only the latest version is embedded.
+
+// documentVersionDir is the subdirectory of a project's document directory
+// holding the earlier files of re-uploaded documents
+const documentVersionDir = ".versions"
+
+// DocumentVersionInfo is the API view of one version of a document
+type DocumentVersionInfo struct {
+	Version     int       `json:"version"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Size        int64     `json:"size"`
+	ContentHash string    `json:"contentHash,omitempty"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+	Current     bool      `json:"current"` // the version served and embedded
+}
+
+// documentVersionKey returns where the file of a replaced document is kept.
+// A document replaced while in the trash keeps its version next to the others.
+func documentVersionKey(storedPath string) string {
+	dir := filepath.Dir(storedPath)
+	if filepath.Base(dir) == documentTrashDir {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Join(dir, documentVersionDir, filepath.Base(storedPath))
+}
+
+// keepDocumentVersion moves the file of a replaced document into the
+// .versions directory and records it as an earlier version
+func keepDocumentVersion(ctx context.Context, docRepo *repository.DocumentRepository, previous *repository.Document) error {
+	key := documentVersionKey(previous.StoredPath)
+	if err := storage.Move(ctx, documentStorage, previous.StoredPath, key); err != nil {
+		return err
+	}
+	removeDocumentPreview(ctx, previous.StoredPath)
+	err := docRepo.CreateVersion(&repository.DocumentVersion{
+		ProjectID:    previous.ProjectID,
+		DocumentID:   previous.ID,
+		Version:      max(previous.Version, 1),
+		UserID:       previous.UserID,
+		Name:         previous.Name,
+		StoredPath:   key,
+		Size:         previous.Size,
+		ContentType:  previous.ContentType,
+		ContentHash:  previous.ContentHash,
+		Deduplicated: previous.Deduplicated,
+		UploadedAt:   previous.UploadedAt,
+	})
+	if err != nil {
+		documentStorage.Delete(ctx, key)
+	}
+	return err
+}
+
+// keepReplacedDocument keeps the file a re-upload replaced as an earlier
+// version, deleting it when that fails
+func keepReplacedDocument(ctx context.Context, docRepo *repository.DocumentRepository, previous *repository.Document) {
+	if err := keepDocumentVersion(ctx, docRepo, previous); err != nil {
+		log.Printf("[documents] failed to keep version %d of document %s: %v", previous.Version, previous.ID, err)
+		documentStorage.Delete(ctx, previous.StoredPath)
+		removeDocumentPreview(ctx, previous.StoredPath)
+	}
+}
+
+// purgeDocumentVersions deletes the earlier files of a document and their rows
+func purgeDocumentVersions(ctx context.Context, docRepo *repository.DocumentRepository, projectID, documentID string) error {
+	versions, err := docRepo.ListVersions(projectID, documentID)
+	if err != nil {
+		return err
+	}
+	if err := docRepo.DeleteVersions(projectID, documentID); err != nil {
+		return err
+	}
+	for _, v := range versions {
+		removeVersionFile(ctx, v)
+	}
+	return nil
+}
+
+// removeVersionFile deletes the file of an earlier version of a document
+func removeVersionFile(ctx context.Context, v repository.DocumentVersion) {
+	if !withinDocumentStorage(v.StoredPath) {
+		log.Printf("[documents] not removing %s: outside document storage", v.StoredPath)
+		return
+	}
+	if err := documentStorage.Delete(ctx, v.StoredPath); err != nil {
+		log.Printf("[documents] failed to remove %s: %v", v.StoredPath, err)
+	}
+	removeDocumentPreview(ctx, v.StoredPath)
+}
+
+// moveDocumentVersions moves the earlier files of a project's documents from
+// the directory src to dst along with the documents themselves
+func moveDocumentVersions(docRepo *repository.DocumentRepository, projectID, src, dst string) error {
+	versions, err := docRepo.ListProjectVersions(projectID)
+	if err != nil {
+		return err
+	}
+	for i := range versions {
+		v := &versions[i]
+		if !withinDir(src, v.StoredPath) {
+			continue
+		}
+		rel, _ := filepath.Rel(src, v.StoredPath)
+		moved := filepath.Join(dst, rel)
+		if err := storage.Move(context.Background(), documentStorage, v.StoredPath, moved); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		removeDocumentPreview(context.Background(), v.StoredPath)
+		v.StoredPath = moved
+		if err := docRepo.UpdateVersionPath(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// documentAtVersion returns doc as it was at the ?version= query parameter,
+// or doc itself when no earlier version is asked for. On failure it writes
+// the error response and returns nil.
+func documentAtVersion(c *fiber.Ctx, docRepo *repository.DocumentRepository, doc *repository.Document) (*repository.Document, error) {
+	param := c.Query("version")
+	if param == "" {
+		return doc, nil
+	}
+	version, err := strconv.Atoi(param)
+	if err != nil || version < 1 {
+		return nil, response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "version must be a positive number", nil)
+	}
+	if version == doc.Version {
+		return doc, nil
+	}
+	v, err := docRepo.GetVersion(doc.ProjectID.String(), doc.ID, version)
+	if err != nil {
+		return nil, response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if v == nil {
+		return nil, response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "version not found", nil)
+	}
+	at := *doc
+	at.Version, at.Name, at.StoredPath, at.Size = v.Version, v.Name, v.StoredPath, v.Size
+	at.ContentType, at.ContentHash, at.UploadedAt = v.ContentType, v.ContentHash, v.UploadedAt
+	return &at, nil
+}
+
+// DocumentVersions is the response of GET /projects/:id/documents/:docId/versions
+type DocumentVersions struct {
+	DocumentID string                `json:"document_id"`
+	Versions   []DocumentVersionInfo `json:"versions"`
+}
+
+// ListDocumentVersions lists every version of a document, newest first
+func ListDocumentVersions(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+	docRepo := documentRepo(c)
+	doc, err := loadDocument(c, docRepo, project)
+	if doc == nil {
+		return err
+	}
+	versions, err := docRepo.ListVersions(project.ID.String(), doc.ID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	infos := make([]DocumentVersionInfo, 0, len(versions)+1)
+	infos = append(infos, DocumentVersionInfo{
+		Version:     doc.Version,
+		Name:        doc.Name,
+		Type:        doc.ContentType,
+		Size:        doc.Size,
+		ContentHash: doc.ContentHash,
+		UploadedAt:  doc.UploadedAt,
+		Current:     true,
+	})
+	for _, v := range versions {
+		infos = append(infos, DocumentVersionInfo{
+			Version:     v.Version,
+			Name:        v.Name,
+			Type:        v.ContentType,
+			Size:        v.Size,
+			ContentHash: v.ContentHash,
+			UploadedAt:  v.UploadedAt,
+		})
+	}
+	return c.JSON(DocumentVersions{DocumentID: doc.ID, Versions: infos})
+}
+
+// UploadDocumentVersion stores the uploaded "file" as the next version of
+// an existing document
+func UploadDocumentVersion(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+	docRepo := documentRepo(c)
+	current, err := loadDocument(c, docRepo, project)
+	if current == nil {
+		return err
+	}
+	if current.DeletedAt != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document is in the trash", nil)
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "no file uploaded", nil)
+	}
+
+	userID := uuid.MustParse(c.Locals("userID").(string))
+	doc, previous, deduplicated, uploadErr := saveUploadedDocument(c, docRepo, project, userID, multipartFile(file), current.ID)
+	if uploadErr != nil {
+		return uploadErr.respond(c)
+	}
+	return respondUploadedDocument(c, repo, docRepo, project, doc, previous, deduplicated)
+}
+
+// RestoreDocumentVersion makes an earlier version of a document the latest
+// one again: its file is copied into a new version, so the version it
+// replaces is kept as well
+func RestoreDocumentVersion(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil || version < 1 {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "version must be a positive number", nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+	docRepo := documentRepo(c)
+	previous, err := loadDocument(c, docRepo, project)
+	if previous == nil {
+		return err
+	}
+	if previous.DeletedAt != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document is in the trash", nil)
+	}
+	if version == previous.Version {
+		return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "version is already the current one", nil)
+	}
+	v, err := docRepo.GetVersion(project.ID.String(), previous.ID, version)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if v == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "version not found", nil)
+	}
+
+	ext := filepath.Ext(v.StoredPath)
+	key := filepath.Join(projectDocumentDir(project), documentFileName(previous.ID, previous.Version+1, ext))
+	linked := false
+	if linker, ok := documentStorage.(storage.Linker); ok {
+		linked = linker.Link(c.UserContext(), v.StoredPath, key) == nil
+	}
+	if !linked {
+		if quotaErr := checkStorageQuota(docRepo, v.UserID.String(), v.Size); quotaErr != nil {
+			return quotaErr.respond(c)
+		}
+		if err := copyDocumentFile(c.UserContext(), v.StoredPath, key, v.Size); err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to restore version", nil)
+		}
+	}
+
+	embeddingStatus := repository.DocumentEmbeddingPending
+	if previous.EmbeddingStatus != repository.DocumentEmbeddingPending {
+		embeddingStatus = repository.DocumentEmbeddingStale
+	}
+	doc := &repository.Document{
+		ID:              previous.ID,
+		ProjectID:       project.ID,
+		UserID:          v.UserID,
+		NodeID:          previous.NodeID,
+		Name:            v.Name,
+		StoredPath:      key,
+		Size:            v.Size,
+		ContentType:     v.ContentType,
+		Status:          previous.Status,
+		ContentHash:     v.ContentHash,
+		UploadedAt:      time.Now(),
+		Version:         previous.Version + 1,
+		EmbeddingStatus: embeddingStatus,
+		Deduplicated:    linked || v.Deduplicated,
+	}
+	setTabularMetadata(doc, uploadedFile{v.Name, v.Size, func() (io.ReadCloser, error) {
+		return documentStorage.Open(c.UserContext(), key)
+	}}, ext)
+	if _, err := docRepo.Create(doc); err != nil {
+		documentStorage.Delete(c.UserContext(), key)
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to save document", nil)
+	}
+	keepReplacedDocument(c.UserContext(), docRepo, previous)
+	if err := syncProjectDocuments(repo, docRepo, project); err != nil {
+		return documentSyncError(c, err)
+	}
+	RecordAudit(c, "document.version_restore", "project", project.ID.String(), fiber.Map{
+		"document_id": doc.ID,
+		"version":     version,
+		"new_version": doc.Version,
+	})
+
+	return c.JSON(documentInfo(doc))
+}
+
+// copyDocumentFile stores a copy of the file src under dst
+func copyDocumentFile(ctx context.Context, src, dst string, size int64) error {
+	r, err := documentStorage.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return documentStorage.Save(ctx, dst, r, size)
+}
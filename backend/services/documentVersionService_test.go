@@ -0,0 +1,123 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// listTestVersions lists the versions of a document as its project's owner
+func listTestVersions(t *testing.T, project *repository.Project, documentID string) []DocumentVersionInfo {
+	t.Helper()
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId/versions", func(c *fiber.Ctx) error {
+		return ListDocumentVersions(c, repository.NewProject(repository.GetDB()))
+	}, newRequest("GET", "/projects/"+project.ID.String()+"/documents/"+documentID+"/versions", "", nil))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list versions: status %d: %s", resp.StatusCode, body)
+	}
+	var listed struct {
+		Versions []DocumentVersionInfo `json:"versions"`
+	}
+	if err := json.Unmarshal(body, &listed); err != nil {
+		t.Fatalf("list versions %s: %v", body, err)
+	}
+	return listed.Versions
+}
+
+// testDocumentContent reads the current file of a document, or the given
+// earlier version of it
+func testDocumentContent(t *testing.T, project *repository.Project, documentID, version string) string {
+	t.Helper()
+	target := "/projects/" + project.ID.String() + "/documents/" + documentID + "/file"
+	if version != "" {
+		target += "?version=" + version
+	}
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId/file", func(c *fiber.Ctx) error {
+		return GetDocumentFile(c, repository.NewProject(repository.GetDB()))
+	}, newRequest("GET", target, "", nil))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("read %s version %q: status %d: %s", documentID, version, resp.StatusCode, body)
+	}
+	return string(body)
+}
+
+func TestDocumentVersionRoundTrip(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[{"id":"docs","type":"rag-documents","position":{"x":0,"y":0},"data":{}}]`)
+	docRepo := repository.NewDocument(repository.GetDB())
+	base := "/projects/" + project.ID.String() + "/documents"
+
+	first := uploadTestDocument(t, project, "notes.txt", "first draft\n")
+
+	// Re-uploaded right away, so within the same second as the first
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+		return UploadDocument(c, repository.NewProject(repository.GetDB()))
+	}, uploadRequest(t, base, "file", map[string]string{"documentId": first.ID}, testFile{"notes.txt", "second draft\n"}))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("re-upload: status %d: %s", resp.StatusCode, body)
+	}
+	var second DocumentInfo
+	if err := json.Unmarshal(body, &second); err != nil {
+		t.Fatalf("re-upload response: %v", err)
+	}
+	if second.ID != first.ID || second.Version != 2 {
+		t.Fatalf("re-upload stored %s version %d, want %s version 2", second.ID, second.Version, first.ID)
+	}
+
+	versions := listTestVersions(t, project, first.ID)
+	if len(versions) != 2 || versions[0].Version != 2 || !versions[0].Current || versions[1].Version != 1 || versions[1].Current {
+		t.Fatalf("versions %+v, want 2 (current) and 1", versions)
+	}
+	if got := testDocumentContent(t, project, first.ID, "1"); got != "first draft\n" {
+		t.Errorf("version 1 reads %q, want the first upload", got)
+	}
+	if got := testDocumentContent(t, project, first.ID, ""); got != "second draft\n" {
+		t.Errorf("current version reads %q, want the re-upload", got)
+	}
+
+	// Restoring version 1 makes it version 3 and keeps version 2
+	resp = serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId/versions/:version/restore", func(c *fiber.Ctx) error {
+		return RestoreDocumentVersion(c, repository.NewProject(repository.GetDB()))
+	}, newRequest("POST", base+"/"+first.ID+"/versions/1/restore", "", nil))
+	body = readBody(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore: status %d: %s", resp.StatusCode, body)
+	}
+	var restored DocumentInfo
+	if err := json.Unmarshal(body, &restored); err != nil {
+		t.Fatalf("restore response: %v", err)
+	}
+	if restored.Version != 3 {
+		t.Errorf("restored as version %d, want 3", restored.Version)
+	}
+	if got := testDocumentContent(t, project, first.ID, ""); got != "first draft\n" {
+		t.Errorf("after restore the document reads %q, want the first upload", got)
+	}
+	if got := testDocumentContent(t, project, first.ID, "2"); got != "second draft\n" {
+		t.Errorf("after restore version 2 reads %q, want the re-upload", got)
+	}
+	versions = listTestVersions(t, project, first.ID)
+	if len(versions) != 3 || versions[0].Version != 3 || versions[1].Version != 2 || versions[2].Version != 1 {
+		t.Errorf("versions after restore %+v, want 3, 2 and 1", versions)
+	}
+
+	// Every version has its own file
+	doc, _ := docRepo.Get(project.ID.String(), first.ID)
+	kept, _ := docRepo.ListVersions(project.ID.String(), first.ID)
+	paths := map[string]bool{doc.StoredPath: true}
+	for _, v := range kept {
+		paths[v.StoredPath] = true
+	}
+	if len(paths) != 3 {
+		t.Errorf("versions stored at %v, want three distinct files", paths)
+	}
+}
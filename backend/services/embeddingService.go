@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// embeddingQueueSize is how many embedding jobs may wait for a worker
+const embeddingQueueSize = 256
+
+// embeddingTask is an embedding job waiting for a worker
+type embeddingTask struct {
+	ctx     context.Context
+	jobRepo *repository.EmbeddingJobRepository
+	job     *repository.EmbeddingJob
+	ownerID string
+	path    string
+}
+
+// embeddingQueue feeds the workers started by StartEmbeddingWorkers
+var embeddingQueue chan embeddingTask
+
+// getEmbeddingWorkers returns how many embedding jobs run at once
+func getEmbeddingWorkers() int {
+	if v, err := strconv.Atoi(os.Getenv("EMBEDDING_WORKERS")); err == nil && v > 0 {
+		return v
+	}
+	return 3
+}
+
+// StartEmbeddingWorkers starts the pool that runs queued embedding jobs.
+// Jobs left pending or running by a previous run are queued again.
+func StartEmbeddingWorkers(jobRepo *repository.EmbeddingJobRepository) {
+	embeddingQueue = make(chan embeddingTask, embeddingQueueSize)
+	for i := 0; i < getEmbeddingWorkers(); i++ {
+		go func() {
+			for task := range embeddingQueue {
+				runEmbeddingJob(task.ctx, task.jobRepo, task.job, task.ownerID, task.path)
+			}
+		}()
+	}
+
+	jobs, err := jobRepo.ResetUnfinished()
+	if err != nil {
+		log.Printf("[embedding] failed to load unfinished jobs: %v", err)
+		return
+	}
+	if len(jobs) > 0 {
+		log.Printf("[embedding] requeueing %d unfinished job(s)", len(jobs))
+		go requeueEmbeddingJobs(jobRepo, jobs)
+	}
+}
+
+// requeueEmbeddingJobs hands jobs left over by a previous run to the
+// workers, waiting for room in the queue. A job whose project or document is
+// gone is marked failed.
+func requeueEmbeddingJobs(jobRepo *repository.EmbeddingJobRepository, jobs []repository.EmbeddingJob) {
+	projectRepo := repository.NewProject(repository.GetDB())
+	docRepo := repository.NewDocument(repository.GetDB())
+	for i := range jobs {
+		job := &jobs[i]
+		project, err := projectRepo.GetByID(job.ProjectID.String())
+		if err != nil {
+			finishRequeuedJob(jobRepo, job, errors.New("project no longer exists"))
+			continue
+		}
+		path := projectDocumentDir(project)
+		if job.DocumentID != "" {
+			doc, err := docRepo.Get(project.ID.String(), job.DocumentID)
+			if err != nil || doc == nil || doc.DeletedAt != nil {
+				finishRequeuedJob(jobRepo, job, errors.New("document no longer exists"))
+				continue
+			}
+			path = doc.StoredPath
+		}
+		embeddingQueue <- embeddingTask{ctx: context.Background(), jobRepo: jobRepo, job: job, ownerID: project.UserID.String(), path: path}
+	}
+}
+
+// finishRequeuedJob records why a leftover job could not be queued again
+func finishRequeuedJob(jobRepo *repository.EmbeddingJobRepository, job *repository.EmbeddingJob, jobErr error) {
+	if err := jobRepo.Finish(job.ID, jobErr); err != nil {
+		log.Printf("[embedding] failed to record outcome of job %s: %v", job.ID, err)
+	}
+}
+
+// errEmbeddingQueueFull is returned when no worker can take another job
+var errEmbeddingQueueFull = errors.New("embedding queue is full")
+
+// enqueueEmbeddingJob creates job and hands it to the worker pool. path is
+// passed on to runEmbeddingJob. A project runs one job at a time; while one
+// is unfinished it fails with repository.ErrEmbeddingInProgress and returns
+// that job.
+func enqueueEmbeddingJob(ctx context.Context, job *repository.EmbeddingJob, ownerID, path string) (*repository.EmbeddingJob, error) {
+	jobRepo := repository.NewEmbeddingJob(repository.GetDB())
+	created, err := jobRepo.WithContext(ctx).CreateIfIdle(job)
+	if err != nil {
+		return created, err
+	}
+
+	// Keep the trace but not the request's lifetime
+	task := embeddingTask{ctx: context.WithoutCancel(ctx), jobRepo: jobRepo, job: created, ownerID: ownerID, path: path}
+	select {
+	case embeddingQueue <- task:
+		return created, nil
+	default:
+		if err := jobRepo.Finish(created.ID, errEmbeddingQueueFull); err != nil {
+			log.Printf("[embedding] failed to record outcome of job %s: %v", created.ID, err)
+		}
+		return nil, errEmbeddingQueueFull
+	}
+}
+
+// queueEmbeddingJob queues job like enqueueEmbeddingJob. While another job
+// of the project is unfinished the response is 409 with that job. On failure
+// the error response is written and a nil job returned.
+func queueEmbeddingJob(c *fiber.Ctx, ctx context.Context, job *repository.EmbeddingJob, ownerID, path string) (*repository.EmbeddingJob, error) {
+	created, err := enqueueEmbeddingJob(ctx, job, ownerID, path)
+	switch {
+	case errors.Is(err, repository.ErrEmbeddingInProgress):
+		return nil, response.Error(c, http.StatusConflict, response.ErrCodeEmbeddingInProgress, "an embedding job is already running for this project", fiber.Map{
+			"job_id":      created.ID,
+			"document_id": created.DocumentID,
+			"status":      created.Status,
+		})
+	case errors.Is(err, errEmbeddingQueueFull):
+		return nil, response.Error(c, http.StatusServiceUnavailable, response.ErrCodeUnavailable, "embedding queue is full, try again later", nil)
+	case err != nil:
+		return nil, response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return created, nil
+}
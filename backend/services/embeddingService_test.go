@@ -0,0 +1,361 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// embeddingWorkersOnce starts the worker pool for every test of the package;
+// the workers take the repository of each job with it
+var embeddingWorkersOnce sync.Once
+
+func useEmbeddingWorkers() {
+	embeddingWorkersOnce.Do(func() {
+		StartEmbeddingWorkers(repository.NewEmbeddingJob(repository.GetDB()))
+	})
+}
+
+// embedRequest is what the AI service is asked to embed
+type embedRequest struct {
+	ProjectID     string   `json:"project_id"`
+	DocumentIDs   []string `json:"document_ids"`
+	DocumentsPath string   `json:"documents_path"`
+	// DocumentURLs are sent instead of the path when the files aren't on
+	// the local disk
+	DocumentURLs []map[string]string `json:"document_urls"`
+}
+
+// fakeEmbeddingService is an AI service that holds the /embed-documents
+// calls for projectID until release is closed and then answers with status.
+// Each call is sent on started first.
+func fakeEmbeddingService(t *testing.T, projectID string, status int) (started chan embedRequest, release chan struct{}) {
+	t.Helper()
+	started, release = make(chan embedRequest, 4), make(chan struct{})
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		// Background work of other tests may still call in
+		if r.URL.Path != "/embed-documents" || req.ProjectID != projectID {
+			http.NotFound(w, r)
+			return
+		}
+		started <- req
+		<-release
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"success":true}`))
+		} else {
+			w.Write([]byte(`index unavailable`))
+		}
+	}))
+	t.Cleanup(ai.Close)
+	t.Setenv("AI_SERVICE_URL", ai.URL)
+	return started, release
+}
+
+// waitForEmbedding waits for the embedding job to record its outcome in the
+// project, which it does last
+func waitForEmbedding(t *testing.T, project *repository.Project, version int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if p, err := repository.NewProject(repository.GetDB()).GetByID(project.ID.String()); err == nil && p.Version > version {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("embedding job did not finish")
+}
+
+// getEmbeddingJob polls the status of a job
+func getEmbeddingJob(t *testing.T, project *repository.Project, jobID string) repository.EmbeddingJob {
+	t.Helper()
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/embed/:jobId", func(c *fiber.Ctx) error {
+		return GetEmbeddingJob(c, repository.NewProject(repository.GetDB()))
+	}, newRequest("GET", "/projects/"+project.ID.String()+"/documents/embed/"+jobID, "", nil))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get job: status %d: %s", resp.StatusCode, body)
+	}
+	var job repository.EmbeddingJob
+	if err := json.Unmarshal(body, &job); err != nil {
+		t.Fatalf("job %s: %v", body, err)
+	}
+	return job
+}
+
+// queueEmbedding asks to embed the documents of project, or the document
+// docID, and returns the response
+func queueEmbedding(t *testing.T, project *repository.Project, docID string) (*http.Response, []byte) {
+	t.Helper()
+	target, route, handler := "/projects/"+project.ID.String()+"/documents/embed", "/projects/:id/documents/embed", EmbedProjectDocuments
+	if docID != "" {
+		target, route, handler = "/projects/"+project.ID.String()+"/documents/"+docID+"/embed", "/projects/:id/documents/:docId/embed", EmbedDocument
+	}
+	resp := serveAs(t, project.UserID.String(), route, func(c *fiber.Ctx) error {
+		return handler(c, repository.NewProject(repository.GetDB()))
+	}, newRequest("POST", target, "", nil))
+	return resp, readBody(t, resp)
+}
+
+func TestEmbeddingJobLifecycle(t *testing.T) {
+	tests := []struct {
+		name       string
+		aiStatus   int
+		wantStatus repository.EmbeddingStatus
+		wantError  bool
+	}{
+		{name: "succeeds", aiStatus: http.StatusOK, wantStatus: repository.EmbeddingDone},
+		{name: "fails", aiStatus: http.StatusInternalServerError, wantStatus: repository.EmbeddingFailed, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t, documentModels...)
+			useTestStorage(t)
+			useEmbeddingWorkers()
+			project := createTestProject(t, uuid.New(), `[]`)
+			started, release := fakeEmbeddingService(t, project.ID.String(), tt.aiStatus)
+
+			// The request returns before the AI service is done
+			resp, body := queueEmbedding(t, project, "")
+			if resp.StatusCode != http.StatusAccepted {
+				t.Fatalf("status = %d, want 202: %s", resp.StatusCode, body)
+			}
+			var queued struct {
+				JobID  string                     `json:"job_id"`
+				Status repository.EmbeddingStatus `json:"status"`
+			}
+			if err := json.Unmarshal(body, &queued); err != nil {
+				t.Fatal(err)
+			}
+			if queued.Status != repository.EmbeddingPending {
+				t.Errorf("queued job is %s, want pending", queued.Status)
+			}
+
+			select {
+			case req := <-started:
+				if req.DocumentsPath != projectDocumentDir(project) || len(req.DocumentIDs) != 0 {
+					t.Errorf("AI service asked to embed %s %v, want the project's directory", req.DocumentsPath, req.DocumentIDs)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("job was not started")
+			}
+			job := getEmbeddingJob(t, project, queued.JobID)
+			if job.Status != repository.EmbeddingRunning || job.StartedAt == nil || job.CompletedAt != nil {
+				t.Errorf("job while the AI service works: %s started %v completed %v, want running", job.Status, job.StartedAt, job.CompletedAt)
+			}
+
+			// A project runs one job at a time
+			resp, body = queueEmbedding(t, project, "")
+			if resp.StatusCode != http.StatusConflict || errorCode(t, body) != response.ErrCodeEmbeddingInProgress {
+				t.Errorf("second job: status %d: %s, want 409 %s", resp.StatusCode, body, response.ErrCodeEmbeddingInProgress)
+			}
+			var conflict struct {
+				Details struct {
+					JobID string `json:"job_id"`
+				} `json:"details"`
+			}
+			json.Unmarshal(body, &conflict)
+			if conflict.Details.JobID != queued.JobID {
+				t.Errorf("conflict names job %s, want the running %s", conflict.Details.JobID, queued.JobID)
+			}
+
+			version := project.Version
+			close(release)
+			waitForEmbedding(t, project, version)
+
+			job = getEmbeddingJob(t, project, queued.JobID)
+			if job.Status != tt.wantStatus || job.CompletedAt == nil || (job.Error != "") != tt.wantError {
+				t.Errorf("finished job: %s completed %v error %q, want %s", job.Status, job.CompletedAt, job.Error, tt.wantStatus)
+			}
+
+			// Once finished the project may queue another
+			started2, release2 := fakeEmbeddingService(t, project.ID.String(), http.StatusOK)
+			close(release2)
+			current, _ := repository.NewProject(repository.GetDB()).GetByID(project.ID.String())
+			resp, body = queueEmbedding(t, project, "")
+			if resp.StatusCode != http.StatusAccepted {
+				t.Fatalf("job after the first finished: status %d: %s", resp.StatusCode, body)
+			}
+			<-started2
+			waitForEmbedding(t, project, current.Version)
+		})
+	}
+}
+
+func TestGetEmbeddingJobNotFound(t *testing.T) {
+	useTestDB(t, documentModels...)
+	project := createTestProject(t, uuid.New(), `[]`)
+	other := createTestProject(t, uuid.New(), `[]`)
+	otherJob := repository.EmbeddingJob{ProjectID: other.ID, UserID: other.UserID}
+	if err := repository.GetDB().Create(&otherJob).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, jobID := range []string{uuid.NewString(), otherJob.ID.String(), "not-a-uuid"} {
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/embed/:jobId", func(c *fiber.Ctx) error {
+			return GetEmbeddingJob(c, repository.NewProject(repository.GetDB()))
+		}, newRequest("GET", "/projects/"+project.ID.String()+"/documents/embed/"+jobID, "", nil))
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("job %s: status %d, want 404", jobID, resp.StatusCode)
+		}
+	}
+}
+
+func TestDocumentEmbeddingStatus(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	useEmbeddingWorkers()
+	project := createTestProject(t, uuid.New(), `[{"id":"docs","type":"rag-documents","position":{"x":0,"y":0},"data":{}}]`)
+	docRepo := repository.NewDocument(repository.GetDB())
+
+	upload := func(t *testing.T, id, name, content string) {
+		t.Helper()
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+			return UploadDocument(c, repository.NewProject(repository.GetDB()))
+		}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", map[string]string{"documentId": id}, testFile{name, content}))
+		if body := readBody(t, resp); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("upload %s: status %d: %s", id, resp.StatusCode, body)
+		}
+	}
+	// embed runs an embedding job of the project, or of docID, against an AI
+	// service answering with status; during runs while the AI service works
+	embed := func(t *testing.T, docID string, status int, during func(t *testing.T)) embedRequest {
+		t.Helper()
+		started, release := fakeEmbeddingService(t, project.ID.String(), status)
+		current, _ := repository.NewProject(repository.GetDB()).GetByID(project.ID.String())
+		resp, body := queueEmbedding(t, project, docID)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("embed: status %d: %s", resp.StatusCode, body)
+		}
+		req := <-started
+		if during != nil {
+			during(t)
+			current, _ = repository.NewProject(repository.GetDB()).GetByID(project.ID.String())
+		}
+		close(release)
+		waitForEmbedding(t, project, current.Version)
+		return req
+	}
+
+	steps := []struct {
+		name string
+		do   func(t *testing.T)
+		// want is the embedding status of each document after the step
+		want map[string]string
+	}{
+		{
+			name: "uploads are pending",
+			do: func(t *testing.T) {
+				upload(t, "doc-a", "a.pdf", testPDF)
+				upload(t, "doc-b", "b.txt", "bee")
+			},
+			want: map[string]string{"doc-a": repository.DocumentEmbeddingPending, "doc-b": repository.DocumentEmbeddingPending},
+		},
+		{
+			name: "a project job embeds them",
+			do:   func(t *testing.T) { embed(t, "", http.StatusOK, nil) },
+			want: map[string]string{"doc-a": repository.DocumentEmbedded, "doc-b": repository.DocumentEmbedded},
+		},
+		{
+			name: "a re-upload goes stale",
+			do:   func(t *testing.T) { upload(t, "doc-a", "a.pdf", testPDF+"% v2\n") },
+			want: map[string]string{"doc-a": repository.DocumentEmbeddingStale, "doc-b": repository.DocumentEmbedded},
+		},
+		{
+			name: "a failed document job marks only that document",
+			do: func(t *testing.T) {
+				req := embed(t, "doc-a", http.StatusInternalServerError, nil)
+				doc, _ := docRepo.Get(project.ID.String(), "doc-a")
+				if len(req.DocumentIDs) != 1 || req.DocumentIDs[0] != "doc-a" || req.DocumentsPath != doc.StoredPath {
+					t.Errorf("AI service asked to embed %s %v, want doc-a's file", req.DocumentsPath, req.DocumentIDs)
+				}
+			},
+			want: map[string]string{"doc-a": repository.DocumentEmbeddingFailed, "doc-b": repository.DocumentEmbedded},
+		},
+		{
+			name: "uploads while a job runs aren't part of it",
+			do: func(t *testing.T) {
+				embed(t, "", http.StatusOK, func(t *testing.T) {
+					time.Sleep(10 * time.Millisecond) // past the job's start at the database's time resolution
+					upload(t, "doc-c", "c.md", "# sea")
+				})
+			},
+			want: map[string]string{"doc-a": repository.DocumentEmbedded, "doc-b": repository.DocumentEmbedded, "doc-c": repository.DocumentEmbeddingPending},
+		},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			step.do(t)
+
+			got := map[string]string{}
+			docs, err := docRepo.ListByProject(project.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range docs {
+				got[d.ID] = d.EmbeddingStatus
+			}
+			if !reflect.DeepEqual(got, step.want) {
+				t.Errorf("statuses %v, want %v", got, step.want)
+			}
+
+			// The node and the list show the same statuses
+			stored, _ := repository.NewProject(repository.GetDB()).GetByID(project.ID.String())
+			listed, _ := nodeDataByID(stored)["docs"]["documents"].([]interface{})
+			inNode := map[string]string{}
+			for _, d := range listed {
+				doc := d.(map[string]interface{})
+				inNode[doc["id"].(string)], _ = doc["embeddingStatus"].(string)
+			}
+			if !reflect.DeepEqual(inNode, step.want) {
+				t.Errorf("rag-documents node shows %v, want %v", inNode, step.want)
+			}
+		})
+	}
+
+	t.Run("deleting a document drops its vectors", func(t *testing.T) {
+		deleted := make(chan []string, 1)
+		ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req embedRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if r.URL.Path != "/delete-documents" || req.ProjectID != project.ID.String() {
+				http.NotFound(w, r)
+				return
+			}
+			deleted <- req.DocumentIDs
+			w.Write([]byte(`{"success":true}`))
+		}))
+		defer ai.Close()
+		t.Setenv("AI_SERVICE_URL", ai.URL)
+
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+			return DeleteDocument(c, repository.NewProject(repository.GetDB()))
+		}, newRequest("DELETE", "/projects/"+project.ID.String()+"/documents/doc-b", "", nil))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("delete: status %d", resp.StatusCode)
+		}
+		select {
+		case ids := <-deleted:
+			if !reflect.DeepEqual(ids, []string{"doc-b"}) {
+				t.Errorf("asked to delete the vectors of %v, want [doc-b]", ids)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("vectors were not deleted")
+		}
+		if doc, _ := docRepo.Get(project.ID.String(), "doc-b"); doc == nil || doc.EmbeddingStatus != repository.DocumentEmbeddingPending {
+			t.Errorf("trashed document is %+v, want pending so a restore embeds it again", doc)
+		}
+	})
+}
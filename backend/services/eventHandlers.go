@@ -0,0 +1,64 @@
+package services
+
+import (
+	"log"
+	"manju/backend/events"
+	"manju/backend/repository"
+	"sync"
+	"time"
+)
+
+// ProjectSummary is a precomputed overview of a project's workflow graph
+type ProjectSummary struct {
+	NodeCount       int            `json:"node_count"`
+	ConnectionCount int            `json:"connection_count"`
+	NodeTypes       map[string]int `json:"node_types"`
+	ComputedAt      time.Time      `json:"computed_at"`
+}
+
+// projectSummaries caches summaries by project ID
+var projectSummaries sync.Map
+
+// RegisterEventHandlers wires the domain event consumers. Call once at startup.
+func RegisterEventHandlers() {
+	events.Subscribe(events.Async, "project-summary", computeProjectSummary)
+	events.Subscribe(events.Async, "webhooks", dispatchExecutionWebhooks)
+	registerStatsInvalidation()
+}
+
+// computeProjectSummary refreshes the cached summary of a saved project
+func computeProjectSummary(e events.ProjectSaved) {
+	project, err := repository.NewProject(repository.GetDB()).GetByID(e.ProjectID)
+	if err != nil {
+		log.Printf("[events] summary: project %s not found: %v", e.ProjectID, err)
+		return
+	}
+	projectSummaries.Store(e.ProjectID, summarizeProject(project))
+}
+
+// summarizeProject counts nodes, connections and node types of a project
+func summarizeProject(project *repository.Project) ProjectSummary {
+	nodes, connections := parseWorkflow(project)
+	summary := ProjectSummary{
+		NodeCount:       len(nodes),
+		ConnectionCount: len(connections),
+		NodeTypes:       map[string]int{},
+		ComputedAt:      time.Now(),
+	}
+	for _, node := range nodes {
+		if t, ok := node["type"].(string); ok {
+			summary.NodeTypes[t]++
+		}
+	}
+	return summary
+}
+
+// GetProjectSummary returns the cached summary or computes it on demand
+func GetProjectSummary(project *repository.Project) ProjectSummary {
+	if v, ok := projectSummaries.Load(project.ID.String()); ok {
+		return v.(ProjectSummary)
+	}
+	summary := summarizeProject(project)
+	projectSummaries.Store(project.ID.String(), summary)
+	return summary
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/repository/repotest"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// TestMain keeps the files the services store, including from background
+// work that outlives a test, out of the source tree
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "manju-services-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for env, sub := range map[string]string{
+		"DOCUMENTS_STORAGE_PATH": "documents",
+		"ARCHIVE_STORAGE_PATH":   "archive",
+		"AVATAR_STORAGE_PATH":    "avatars",
+		"PREVIEW_STORAGE_PATH":   "previews",
+		"THUMBNAIL_STORAGE_PATH": "thumbnails",
+	} {
+		os.Setenv(env, filepath.Join(dir, sub))
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// useTestDB points the repositories at a SQLite database with a table for
+// each of models until the test ends
+func useTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db := repotest.OpenDB(t, "manju", models...)
+	prev := repository.GetDB()
+	repository.SetDB(db)
+	t.Cleanup(func() { repository.SetDB(prev) })
+	return db
+}
+
+// useTestStorage keeps the documents a test stores in its temp directory
+func useTestStorage(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("DOCUMENTS_STORAGE_PATH", dir)
+	return dir
+}
+
+// serveAs sends req to handler, mounted at route, as if userID had signed
+// in. An empty userID sends it unauthenticated.
+func serveAs(t *testing.T, userID, route string, handler fiber.Handler, req *http.Request) *http.Response {
+	t.Helper()
+	app := fiber.New()
+	app.All(route, func(c *fiber.Ctx) error {
+		if userID != "" {
+			c.Locals("userID", userID)
+		}
+		return handler(c)
+	})
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// readBody returns the body of resp
+func readBody(t *testing.T, resp *http.Response) []byte {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return body
+}
+
+// newRequest builds a request with a body of the given content type
+func newRequest(method, target, contentType string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	if contentType != "" {
+		req.Header.Set(fiber.HeaderContentType, contentType)
+	}
+	return req
+}
+
+// errorCode returns the code of an error response body
+func errorCode(t *testing.T, body []byte) string {
+	t.Helper()
+	var errResp response.ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		t.Fatalf("error response %s: %v", body, err)
+	}
+	return errResp.Code
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	_ "image/png" // register PNG decoding for uploaded images
+	"io"
+	"mime/multipart"
+	"os"
+
+	"golang.org/x/image/draw"
+)
+
+var (
+	errImageTooLarge = errors.New("image too large")
+	errImageFormat   = errors.New("image must be a JPEG or PNG")
+)
+
+// readUploadedImage decodes an uploaded JPEG or PNG of at most maxBytes
+func readUploadedImage(file *multipart.FileHeader, maxBytes int64) (image.Image, error) {
+	if file.Size > maxBytes {
+		return nil, errImageTooLarge
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, errImageTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil, errImageFormat
+	}
+	return img, nil
+}
+
+// saveResizedJPEG center-crops src to the aspect ratio of width x height,
+// scales it to that size and atomically writes it to path as JPEG
+func saveResizedJPEG(path string, src image.Image, width, height int) error {
+	b := src.Bounds()
+	cropW, cropH := b.Dx(), b.Dx()*height/width
+	if cropH > b.Dy() {
+		cropW, cropH = b.Dy()*width/height, b.Dy()
+	}
+	x0 := b.Min.X + (b.Dx()-cropW)/2
+	y0 := b.Min.Y + (b.Dy()-cropH)/2
+	crop := image.Rect(x0, y0, x0+cropW, y0+cropH)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(out, dst, &jpeg.Options{Quality: 90}); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"manju/backend/config"
+	"manju/backend/models/response"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaintenanceResponse is the response of the maintenance mode endpoints
+type MaintenanceResponse struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+// EnableMaintenance puts the server in maintenance mode by creating the
+// maintenance lock file
+func EnableMaintenance(c *fiber.Ctx) error {
+	if err := config.SetMaintenance(true); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to create maintenance lock file", nil)
+	}
+	RecordAudit(c, "maintenance.enable", "maintenance", "", fiber.Map{"lock_file": config.MaintenanceLockFile()})
+	return c.JSON(MaintenanceResponse{Maintenance: true})
+}
+
+// DisableMaintenance ends maintenance mode by removing the maintenance lock
+// file. It fails with 409 while MAINTENANCE_MODE=true holds the server in it.
+func DisableMaintenance(c *fiber.Ctx) error {
+	if err := config.SetMaintenance(false); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to remove maintenance lock file", nil)
+	}
+	RecordAudit(c, "maintenance.disable", "maintenance", "", fiber.Map{"lock_file": config.MaintenanceLockFile()})
+	if config.MaintenanceForced() {
+		return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "MAINTENANCE_MODE is set; unset it to leave maintenance mode", nil)
+	}
+	return c.JSON(MaintenanceResponse{Maintenance: false})
+}
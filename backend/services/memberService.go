@@ -0,0 +1,229 @@
+package services
+
+import (
+	"errors"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// projectAccess is the level of access a user needs for an operation on a project
+type projectAccess int
+
+const (
+	accessViewer projectAccess = iota + 1 // view the project and run the demo
+	accessEditor                          // update the workflow and documents
+	accessOwner                           // delete the project and manage members
+)
+
+// canAccess reports whether userID may perform an operation that requires need
+// on project. The owner can do everything; members, and members of the team
+// the project is shared with, are limited by their role.
+func canAccess(repo *repository.ProjectRepository, project *repository.Project, userID string, need projectAccess) bool {
+	if project.UserID.String() == userID {
+		return true
+	}
+	if need == accessOwner {
+		return false
+	}
+
+	role, err := repo.MemberRole(project.ID.String(), userID)
+	if err != nil {
+		return false
+	}
+	switch role {
+	case repository.MemberEditor:
+		return true
+	case repository.MemberViewer:
+		if need == accessViewer {
+			return true
+		}
+	}
+
+	if project.TeamID == nil {
+		return false
+	}
+	teamRole, err := repo.TeamRole(project.TeamID.String(), userID)
+	if err != nil {
+		return false
+	}
+	switch teamRole {
+	case repository.TeamOwner, repository.TeamEditor:
+		return true
+	case repository.TeamViewer:
+		return need == accessViewer
+	}
+	return false
+}
+
+// InviteMemberPayload is the request body for inviting a collaborator
+type InviteMemberPayload struct {
+	Email string                `json:"email"`
+	Role  repository.MemberRole `json:"role"`
+}
+
+// UpdateMemberPayload is the request body for changing a collaborator's role
+type UpdateMemberPayload struct {
+	Role repository.MemberRole `json:"role"`
+}
+
+// loadProjectForAccess loads the project in :id and checks the caller's access
+func loadProjectForAccess(c *fiber.Ctx, repo *repository.ProjectRepository, need projectAccess) (*repository.Project, error) {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return nil, response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	project, err := repo.GetByID(c.Params("id"))
+	if err != nil {
+		return nil, response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	}
+	if !canAccess(repo, project, userIDStr.(string), need) {
+		return nil, response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+	}
+	return project, nil
+}
+
+// ProjectMembers is the response of GET /projects/:id/members
+type ProjectMembers struct {
+	OwnerID uuid.UUID                  `json:"owner_id"`
+	Members []repository.ProjectMember `json:"members"`
+}
+
+// ListMembers returns the collaborators and pending invites of a project
+func ListMembers(c *fiber.Ctx, repo *repository.ProjectRepository, memberRepo *repository.ProjectMemberRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+
+	members, err := memberRepo.ListByProject(project.ID.String())
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(ProjectMembers{OwnerID: project.UserID, Members: members})
+}
+
+// InviteMember adds a collaborator by email. Emails without an account are
+// stored as pending invites and linked when that user first logs in.
+func InviteMember(c *fiber.Ctx, repo *repository.ProjectRepository, memberRepo *repository.ProjectMemberRepository, userRepo *repository.UserRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessOwner)
+	if project == nil {
+		return err
+	}
+
+	var body InviteMemberPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	body.Email = strings.TrimSpace(body.Email)
+	if body.Email == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "email is required", nil)
+	}
+	if body.Role == "" {
+		body.Role = repository.MemberViewer
+	}
+	if !body.Role.Valid() {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "role must be viewer or editor", nil)
+	}
+
+	existing, err := memberRepo.GetByProjectAndEmail(project.ID.String(), body.Email)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if existing != nil {
+		return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "already a member", nil)
+	}
+
+	member := repository.ProjectMember{
+		ProjectID: project.ID,
+		Email:     body.Email,
+		Role:      body.Role,
+		InvitedBy: uuid.MustParse(c.Locals("userID").(string)),
+	}
+
+	user, err := userRepo.GetByEmail(body.Email)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if user != nil {
+		if user.ID == project.UserID {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "owner cannot be invited", nil)
+		}
+		now := time.Now()
+		member.UserID = &user.ID
+		member.AcceptedAt = &now
+	}
+
+	created, err := memberRepo.Create(&member)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.member_invite", "project", project.ID.String(), fiber.Map{"email": created.Email, "role": created.Role, "pending": created.Pending()})
+
+	return c.Status(http.StatusCreated).JSON(created)
+}
+
+// UpdateMember changes a collaborator's role
+func UpdateMember(c *fiber.Ctx, repo *repository.ProjectRepository, memberRepo *repository.ProjectMemberRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessOwner)
+	if project == nil {
+		return err
+	}
+
+	var body UpdateMemberPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if !body.Role.Valid() {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "role must be viewer or editor", nil)
+	}
+
+	member, err := memberRepo.GetByID(project.ID.String(), c.Params("memberId"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "member not found", nil)
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	from := member.Role
+	if err := memberRepo.UpdateRole(member, body.Role); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.member_role_change", "project", project.ID.String(), fiber.Map{"email": member.Email, "role": fieldChange{From: from, To: body.Role}})
+
+	return c.JSON(member)
+}
+
+// RemoveMember removes a collaborator or cancels a pending invite
+func RemoveMember(c *fiber.Ctx, repo *repository.ProjectRepository, memberRepo *repository.ProjectMemberRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessOwner)
+	if project == nil {
+		return err
+	}
+
+	member, err := memberRepo.GetByID(project.ID.String(), c.Params("memberId"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "member not found", nil)
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	if err := memberRepo.Delete(project.ID.String(), member.ID.String()); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.member_remove", "project", project.ID.String(), fiber.Map{"email": member.Email})
+
+	return c.JSON(response.MessageResponse{Message: "member removed"})
+}
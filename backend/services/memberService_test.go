@@ -0,0 +1,115 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestProjectRoles(t *testing.T) {
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ai.Close()
+	t.Setenv("AI_SERVICE_URL", ai.URL)
+
+	// actions maps each action to the handler and request that performs it
+	actions := map[string]struct {
+		route   string
+		handler func(repo *repository.ProjectRepository) fiber.Handler
+		request func(id string) *http.Request
+		success int
+	}{
+		"update": {
+			route: "/projects/:id",
+			handler: func(repo *repository.ProjectRepository) fiber.Handler {
+				return func(c *fiber.Ctx) error { return UpdateProject(c, repo) }
+			},
+			request: func(id string) *http.Request {
+				return newRequest("PUT", "/projects/"+id, "application/json", strings.NewReader(`{"name":"renamed"}`))
+			},
+			success: http.StatusOK,
+		},
+		"delete": {
+			route: "/projects/:id",
+			handler: func(repo *repository.ProjectRepository) fiber.Handler {
+				return func(c *fiber.Ctx) error { return DeleteProject(c, repo) }
+			},
+			request: func(id string) *http.Request { return newRequest("DELETE", "/projects/"+id, "", nil) },
+			success: http.StatusOK,
+		},
+		"share": {
+			route: "/projects/:id/members",
+			handler: func(repo *repository.ProjectRepository) fiber.Handler {
+				return func(c *fiber.Ctx) error {
+					db := repository.GetDB()
+					return InviteMember(c, repo, repository.NewProjectMember(db), repository.New(db))
+				}
+			},
+			request: func(id string) *http.Request {
+				return newRequest("POST", "/projects/"+id+"/members", "application/json", strings.NewReader(`{"email":"friend@example.com","role":"viewer"}`))
+			},
+			success: http.StatusCreated,
+		},
+	}
+
+	tests := []struct {
+		role    string // "owner" or a member role
+		allowed map[string]bool
+	}{
+		{role: string(repository.MemberViewer), allowed: map[string]bool{}},
+		{role: string(repository.MemberEditor), allowed: map[string]bool{"update": true}},
+		{role: "owner", allowed: map[string]bool{"update": true, "delete": true, "share": true}},
+	}
+	for _, tt := range tests {
+		for name, action := range actions {
+			t.Run(tt.role+" "+name, func(t *testing.T) {
+				useTestStorage(t)
+				db := useTestDB(t, append(bulkDeleteModels, &repository.User{})...)
+				owner := uuid.New()
+				project := createTestProject(t, owner, `[]`)
+				userID := owner
+				if tt.role != "owner" {
+					userID = uuid.New()
+					addTestMember(t, project, userID, repository.MemberRole(tt.role))
+				}
+
+				resp := serveAs(t, userID.String(), action.route, action.handler(repository.NewProject(db)), action.request(project.ID.String()))
+				body := readBody(t, resp)
+				if !tt.allowed[name] {
+					if resp.StatusCode != http.StatusForbidden || errorCode(t, body) != response.ErrCodeForbidden {
+						t.Fatalf("status = %d: %s, want 403", resp.StatusCode, body)
+					}
+				} else if resp.StatusCode != action.success {
+					t.Fatalf("status = %d: %s, want %d", resp.StatusCode, body, action.success)
+				}
+
+				// A refused action leaves the project as it was
+				var stored repository.Project
+				err := db.Where("id = ?", project.ID).First(&stored).Error
+				switch {
+				case name == "delete" && tt.allowed[name]:
+					if err == nil {
+						t.Error("project still exists after delete")
+					}
+				case err != nil:
+					t.Fatalf("project gone: %v", err)
+				case name == "update" && (stored.Name == "renamed") != tt.allowed[name]:
+					t.Errorf("project name = %q after update by %s", stored.Name, tt.role)
+				}
+				if name == "share" {
+					var invited int64
+					db.Model(&repository.ProjectMember{}).Where("project_id = ? AND email = ?", project.ID, "friend@example.com").Count(&invited)
+					if (invited == 1) != tt.allowed[name] {
+						t.Errorf("%d invites stored after share by %s", invited, tt.role)
+					}
+				}
+			})
+		}
+	}
+}
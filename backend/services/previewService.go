@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/storage"
+	"manju/backend/tracing"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Document previews show the text that embedding will extract from a
+// document. Text, Markdown, CSV and spreadsheets are read here; PDFs and
+// Word files are extracted by the AI service. The extracted text is cached
+// in the .previews directory next to the document, named after its stored
+// file, so a re-upload gets a fresh preview.
+
+// documentPreviewDir is the directory of a project's cached previews
+const documentPreviewDir = ".previews"
+
+const (
+	defaultPreviewKB = 4
+	maxPreviewKB     = 64
+	// previewCacheBytes is one rune past the largest preview, so a cached
+	// preview still tells whether the text goes on
+	previewCacheBytes = maxPreviewKB<<10 + utf8.UTFMax
+)
+
+// DocumentPreview is the start of a document's extracted text
+type DocumentPreview struct {
+	DocumentID string `json:"document_id"`
+	Available  bool   `json:"available"`
+	Text       string `json:"text"`
+	Truncated  bool   `json:"truncated"`         // the text goes on past the preview
+	Cached     bool   `json:"cached"`            // served from the preview cache
+	Message    string `json:"message,omitempty"` // why the preview is unavailable
+}
+
+// documentPreviewKey returns the storage key of a document's cached preview
+func documentPreviewKey(storedPath string) string {
+	return filepath.Join(filepath.Dir(storedPath), documentPreviewDir, filepath.Base(storedPath)+".txt")
+}
+
+// removeDocumentPreview deletes the cached preview of a stored file, if any
+func removeDocumentPreview(ctx context.Context, storedPath string) {
+	if err := documentStorage.Delete(ctx, documentPreviewKey(storedPath)); err != nil {
+		log.Printf("[documents] failed to remove preview of %s: %v", storedPath, err)
+	}
+}
+
+// truncateText cuts s to at most n bytes without splitting a rune
+func truncateText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// PreviewDocument returns the first ?kb= kilobytes (default 4, at most 64)
+// of the text extracted from a document. When a PDF or Word file can't be
+// extracted because the AI service is down, it answers with available set to
+// false instead of failing.
+func PreviewDocument(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	kb := c.QueryInt("kb", defaultPreviewKB)
+	if kb < 1 || kb > maxPreviewKB {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, fmt.Sprintf("kb must be between 1 and %d", maxPreviewKB), nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+	doc, err := loadDocument(c, documentRepo(c), project)
+	if doc == nil {
+		return err
+	}
+	if doc.DeletedAt != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document is in the trash", nil)
+	}
+	if !withinDocumentStorage(doc.StoredPath) {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid document path", nil)
+	}
+
+	text, cached, err := documentPreviewText(c.UserContext(), doc)
+	var svcErr *aiServiceError
+	switch {
+	case errors.Is(err, errAIUnavailable) || (errors.As(err, &svcErr) && svcErr.StatusCode == http.StatusServiceUnavailable):
+		return c.JSON(DocumentPreview{DocumentID: doc.ID, Message: "preview unavailable: the text extraction service is not reachable"})
+	case errors.As(err, &svcErr):
+		return response.Error(c, http.StatusBadGateway, response.ErrCodeUpstream, "failed to extract text", nil)
+	case errors.Is(err, storage.ErrNotFound):
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document file not found", nil)
+	case err != nil:
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	preview := truncateText(text, kb<<10)
+	return c.JSON(DocumentPreview{
+		DocumentID: doc.ID,
+		Available:  true,
+		Text:       preview,
+		Truncated:  len(preview) < len(text),
+		Cached:     cached,
+	})
+}
+
+// documentPreviewText returns the start of a document's extracted text, at
+// most previewCacheBytes, from the preview cache or by extracting it and
+// caching the result
+func documentPreviewText(ctx context.Context, doc *repository.Document) (text string, cached bool, err error) {
+	key := documentPreviewKey(doc.StoredPath)
+	if r, err := documentStorage.Open(ctx, key); err == nil {
+		defer r.Close()
+		if data, err := io.ReadAll(io.LimitReader(r, previewCacheBytes)); err == nil {
+			return string(data), true, nil
+		}
+	}
+
+	text, err = extractDocumentText(ctx, doc)
+	if err != nil {
+		return "", false, err
+	}
+	text = truncateText(text, previewCacheBytes)
+	if err := documentStorage.Save(ctx, key, strings.NewReader(text), int64(len(text))); err != nil {
+		log.Printf("[documents] failed to cache preview of %s: %v", doc.StoredPath, err)
+	}
+	return text, false, nil
+}
+
+// extractDocumentText returns the text of a document as embedding sees it
+func extractDocumentText(ctx context.Context, doc *repository.Document) (string, error) {
+	switch strings.ToLower(filepath.Ext(doc.StoredPath)) {
+	case ".pdf", ".docx", ".doc":
+		return extractTextWithAI(ctx, doc)
+	}
+	return CopyDocumentContent(ctx, doc.StoredPath)
+}
+
+// extractTextWithAI asks the AI service for the text of a PDF or Word file,
+// passing the file's path, or a download link when it can't read the file
+func extractTextWithAI(ctx context.Context, doc *repository.Document) (text string, err error) {
+	ctx, span := tracing.Start(ctx, "ai.extract-text")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	reqBody := map[string]interface{}{"max_chars": previewCacheBytes}
+	if path, ok := storage.LocalPath(documentStorage, doc.StoredPath); ok && !deliverDocumentsByURL() {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		reqBody["document_path"] = absPath
+	} else {
+		url, err := documentDownloadURL(ctx, doc)
+		if err != nil {
+			return "", err
+		}
+		reqBody["document_url"] = map[string]string{"id": doc.ID, "name": filepath.Base(doc.StoredPath), "url": url}
+	}
+	jsonBody, _ := json.Marshal(reqBody)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", getAIServiceURL()+"/extract-text", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	tracing.Inject(ctx, req.Header)
+
+	client := &http.Client{Timeout: aiTimeouts.Extract}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("[documents] text extraction call failed: %v", err)
+		return "", errAIUnavailable
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		svcErr := &aiServiceError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(&svcErr.Body)
+		return "", svcErr
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse AI response: %w", err)
+	}
+	return strings.ToValidUTF8(result.Text, "\uFFFD"), nil
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// getPreview requests the preview of a document with the given query
+func getPreview(t *testing.T, project *repository.Project, docID, query string) (int, DocumentPreview, []byte) {
+	t.Helper()
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId/preview", func(c *fiber.Ctx) error {
+		return PreviewDocument(c, repository.NewProject(repository.GetDB()))
+	}, newRequest("GET", "/projects/"+project.ID.String()+"/documents/"+docID+"/preview"+query, "", nil))
+	body := readBody(t, resp)
+	var preview DocumentPreview
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(body, &preview); err != nil {
+			t.Fatalf("preview %s: %v", body, err)
+		}
+	}
+	return resp.StatusCode, preview, body
+}
+
+// fakeExtractionService is an AI service answering /extract-text with
+// status and text, counting the calls
+func fakeExtractionService(t *testing.T, status int, text string) *atomic.Int32 {
+	t.Helper()
+	var calls atomic.Int32
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			DocumentPath string `json:"document_path"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		// Background work of other tests may still call in
+		if r.URL.Path != "/extract-text" || req.DocumentPath == "" {
+			http.NotFound(w, r)
+			return
+		}
+		calls.Add(1)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"text": text, "detail": "extraction failed"})
+	}))
+	t.Cleanup(ai.Close)
+	t.Setenv("AI_SERVICE_URL", ai.URL)
+	return &calls
+}
+
+func TestPreviewTextDocument(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	// Text files never reach the AI service
+	calls := fakeExtractionService(t, http.StatusInternalServerError, "")
+
+	// A little over 2 KB, with a Thai word across the 1 KB boundary
+	content := strings.Repeat("a", 1023) + "สวัสดี" + strings.Repeat("b", 1024)
+	doc := uploadTestDocument(t, project, "notes.txt", content)
+
+	tests := []struct {
+		name          string
+		query         string
+		wantText      string
+		wantTruncated bool
+		wantCached    bool
+	}{
+		{name: "the whole text is extracted and cached", wantText: content, wantCached: false},
+		{name: "served from the cache", wantText: content, wantCached: true},
+		{name: "cut at a rune boundary", query: "?kb=1", wantText: strings.Repeat("a", 1023), wantTruncated: true, wantCached: true},
+		{name: "exactly the text", query: "?kb=3", wantText: content, wantCached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, preview, body := getPreview(t, project, doc.ID, tt.query)
+			if status != http.StatusOK {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			if !preview.Available || preview.Text != tt.wantText || preview.Truncated != tt.wantTruncated || preview.Cached != tt.wantCached {
+				t.Errorf("preview available %v, %d bytes, truncated %v, cached %v; want %d bytes, truncated %v, cached %v",
+					preview.Available, len(preview.Text), preview.Truncated, preview.Cached, len(tt.wantText), tt.wantTruncated, tt.wantCached)
+			}
+		})
+	}
+	if calls.Load() != 0 {
+		t.Errorf("AI service called %d times for a text file", calls.Load())
+	}
+
+	t.Run("a re-upload gets a fresh preview", func(t *testing.T) {
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/documents", func(c *fiber.Ctx) error {
+			return UploadDocument(c, repository.NewProject(repository.GetDB()))
+		}, uploadRequest(t, "/projects/"+project.ID.String()+"/documents", "file", map[string]string{"documentId": doc.ID}, testFile{"notes.txt", "version two"}))
+		if body := readBody(t, resp); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("re-upload: status %d: %s", resp.StatusCode, body)
+		}
+		_, preview, _ := getPreview(t, project, doc.ID, "")
+		if preview.Text != "version two" || preview.Cached {
+			t.Errorf("preview %q, cached %v, want the new text extracted", preview.Text, preview.Cached)
+		}
+	})
+}
+
+func TestPreviewExtractedDocument(t *testing.T) {
+	tests := []struct {
+		name          string
+		aiStatus      int
+		aiDown        bool
+		wantStatus    int
+		wantAvailable bool
+		wantCode      string
+	}{
+		{name: "extracted by the AI service", aiStatus: http.StatusOK, wantStatus: http.StatusOK, wantAvailable: true},
+		{name: "AI service down", aiDown: true, wantStatus: http.StatusOK},
+		{name: "AI service unavailable", aiStatus: http.StatusServiceUnavailable, wantStatus: http.StatusOK},
+		{name: "extraction fails", aiStatus: http.StatusInternalServerError, wantStatus: http.StatusBadGateway, wantCode: response.ErrCodeUpstream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t, documentModels...)
+			useTestStorage(t)
+			project := createTestProject(t, uuid.New(), `[]`)
+			doc := uploadTestDocument(t, project, "report.pdf", testPDF)
+
+			calls := fakeExtractionService(t, tt.aiStatus, "Quarterly revenue grew.")
+			if tt.aiDown {
+				ai := httptest.NewServer(http.NotFoundHandler())
+				ai.Close()
+				t.Setenv("AI_SERVICE_URL", ai.URL)
+			}
+
+			status, preview, body := getPreview(t, project, doc.ID, "")
+			if status != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", status, tt.wantStatus, body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, body); code != tt.wantCode {
+					t.Errorf("code = %s, want %s", code, tt.wantCode)
+				}
+				return
+			}
+			if preview.Available != tt.wantAvailable {
+				t.Fatalf("available = %v, want %v: %s", preview.Available, tt.wantAvailable, body)
+			}
+			if !tt.wantAvailable {
+				if preview.Message == "" || preview.Text != "" {
+					t.Errorf("unavailable preview %+v, want a message and no text", preview)
+				}
+				// Nothing is cached, so the preview works once the service is back
+				stored, _ := repository.NewDocument(repository.GetDB()).Get(project.ID.String(), doc.ID)
+				if _, err := os.Stat(documentPreviewKey(stored.StoredPath)); !os.IsNotExist(err) {
+					t.Errorf("unavailable preview cached: %v", err)
+				}
+				return
+			}
+			if preview.Text != "Quarterly revenue grew." {
+				t.Errorf("text %q, want the extracted text", preview.Text)
+			}
+			// The second request doesn't extract again
+			if _, preview, _ := getPreview(t, project, doc.ID, ""); !preview.Cached || calls.Load() != 1 {
+				t.Errorf("second preview cached %v after %d extractions, want one", preview.Cached, calls.Load())
+			}
+		})
+	}
+}
+
+func TestPreviewDocumentErrors(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	doc := uploadTestDocument(t, project, "notes.txt", "hello")
+	trashed := uploadTestDocument(t, project, "old.txt", "old")
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+		return DeleteDocument(c, repository.NewProject(repository.GetDB()))
+	}, newRequest("DELETE", "/projects/"+project.ID.String()+"/documents/"+trashed.ID, "", nil))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete: status %d", resp.StatusCode)
+	}
+
+	tests := []struct {
+		name       string
+		docID      string
+		query      string
+		wantStatus int
+	}{
+		{name: "kb too small", docID: doc.ID, query: "?kb=0", wantStatus: http.StatusBadRequest},
+		{name: "kb too large", docID: doc.ID, query: "?kb=65", wantStatus: http.StatusBadRequest},
+		{name: "largest preview", docID: doc.ID, query: "?kb=64", wantStatus: http.StatusOK},
+		{name: "unknown document", docID: "doc-missing", wantStatus: http.StatusNotFound},
+		{name: "document in the trash", docID: trashed.ID, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _, body := getPreview(t, project, tt.docID, tt.query); status != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", status, tt.wantStatus, body)
+			}
+		})
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "hello", n: 10, want: "hello"},
+		{s: "hello", n: 5, want: "hello"},
+		{s: "hello", n: 2, want: "he"},
+		{s: "héllo", n: 2, want: "h"},
+		{s: "héllo", n: 3, want: "hé"},
+		{s: "สวัสดี", n: 4, want: "ส"},
+		{s: "สวัสดี", n: 2, want: ""},
+		{s: "", n: 0, want: ""},
+	}
+	for _, tt := range tests {
+		if got := truncateText(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
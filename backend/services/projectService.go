@@ -1,65 +1,186 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"manju/backend/events"
+	"manju/backend/models/response"
 	"manju/backend/repository"
 	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // CreateProjectPayload represents the request body for creating a project
 type CreateProjectPayload struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	Nodes       interface{} `json:"nodes"`
-	Connections interface{} `json:"connections"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Nodes       json.RawMessage `json:"nodes"`
+	Connections json.RawMessage `json:"connections"`
+	Tags        []string        `json:"tags"`
+	// SourceURL imports nodes and connections from an exported bundle hosted at a public URL
+	SourceURL string `json:"source_url,omitempty"`
+	// TeamID shares the project with a team the creator can edit in
+	TeamID string `json:"team_id,omitempty"`
 }
 
 // UpdateProjectPayload represents the request body for updating a project
 type UpdateProjectPayload struct {
-	Name        *string     `json:"name,omitempty"`
-	Description *string     `json:"description,omitempty"`
-	Nodes       interface{} `json:"nodes,omitempty"`
-	Connections interface{} `json:"connections,omitempty"`
-	Status      *string     `json:"status,omitempty"`
+	Name        *string         `json:"name,omitempty"`
+	Description *string         `json:"description,omitempty"`
+	Nodes       json.RawMessage `json:"nodes,omitempty"`
+	Connections json.RawMessage `json:"connections,omitempty"`
+	Status      *string         `json:"status,omitempty"`
+	Tags        *[]string       `json:"tags,omitempty"`
+	// DefaultAPIKeyID selects the owner's API key used to run the project; "" clears it
+	DefaultAPIKeyID *string `json:"default_api_key_id,omitempty"`
+	// TeamID shares the project with a team; "" stops sharing it. Owner only.
+	TeamID *string `json:"team_id,omitempty"`
+	// WebhookEnabled turns the inbound webhook on or off. The signing secret is
+	// generated the first time it is enabled and returned only in that response.
+	// Owner only.
+	WebhookEnabled *bool `json:"webhook_enabled,omitempty"`
+	// TokenBudget caps the tokens the project's runs may use; null removes
+	// the cap. Owner only.
+	TokenBudget json.RawMessage `json:"token_budget,omitempty"`
+}
+
+const (
+	maxProjectTags   = 10
+	maxProjectTagLen = 30
+)
+
+// normalizeTags trims, lowercases and dedupes tags, dropping empty ones, and
+// enforces the per-project tag limits
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxProjectTagLen {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxProjectTagLen)
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) > maxProjectTags {
+		return nil, fmt.Errorf("a project can have at most %d tags", maxProjectTags)
+	}
+	return out, nil
+}
+
+// projectTeam resolves the team a project is shared with. userID must be an
+// owner or editor of the team; an empty teamID means no team.
+func projectTeam(repo *repository.ProjectRepository, teamID, userID string) (*uuid.UUID, error) {
+	if teamID == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(teamID)
+	if err != nil {
+		return nil, errors.New("invalid team_id")
+	}
+	role, err := repo.TeamRole(teamID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != repository.TeamOwner && role != repository.TeamEditor {
+		return nil, errors.New("team_id must be a team you can edit in")
+	}
+	return &id, nil
 }
 
 func CreateProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	// Get user ID from context (set by auth middleware)
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	userID, err := uuid.Parse(userIDStr.(string))
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user id", nil)
 	}
 
 	var body CreateProjectPayload
 	if err := c.BodyParser(&body); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+
+	if body.SourceURL != "" {
+		bundle, err := fetchBundleFromURL(c.UserContext(), body.SourceURL)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+		}
+		if errs := validateBundle(bundle); len(errs) > 0 {
+			return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeValidation, "invalid bundle", fiber.Map{"errors": errs})
+		}
+		regenerateWorkflowIDs(bundle.Nodes, bundle.Connections)
+		if body.Nodes, err = json.Marshal(bundle.Nodes); err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid nodes", nil)
+		}
+		if body.Connections, err = json.Marshal(bundle.Connections); err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid connections", nil)
+		}
+		if body.Name == "" {
+			body.Name = bundle.Name
+		}
+		if body.Description == "" {
+			body.Description = bundle.Description
+		}
 	}
 
 	if body.Name == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "name is required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "name is required", nil)
+	}
+
+	existing, err := repo.GetByUserIDAndName(userID.String(), body.Name)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if existing != nil {
+		return response.Error(c, http.StatusConflict, response.ErrCodeProjectNameTaken, "a project with this name already exists", nil)
+	}
+
+	tags, err := normalizeTags(body.Tags)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+	}
+
+	teamID, err := projectTeam(repo, body.TeamID, userID.String())
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
 	}
 
 	project := repository.Project{
 		UserID:      userID,
+		TeamID:      teamID,
 		Name:        body.Name,
 		Description: body.Description,
-		Status:      "draft",
+		Status:      repository.ProjectStatusDraft,
+		Tags:        tags,
+	}
+
+	if tooLarge := checkWorkflowPayloadSize(body.Nodes, body.Connections); tooLarge != nil {
+		return response.Error(c, http.StatusRequestEntityTooLarge, response.ErrCodePayloadTooLarge, "workflow payload is too large", tooLarge)
 	}
 
 	// Convert nodes to JSON
-	if body.Nodes != nil {
+	if hasJSON(body.Nodes) {
 		nodesJSON, err := json.Marshal(body.Nodes)
 		if err != nil {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid nodes"})
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid nodes", nil)
 		}
 		project.Nodes = datatypes.JSON(nodesJSON)
 	} else {
@@ -67,120 +188,366 @@ func CreateProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	}
 
 	// Convert connections to JSON
-	if body.Connections != nil {
+	if hasJSON(body.Connections) {
 		connectionsJSON, err := json.Marshal(body.Connections)
 		if err != nil {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid connections"})
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid connections", nil)
 		}
 		project.Connections = datatypes.JSON(connectionsJSON)
 	} else {
 		project.Connections = datatypes.JSON([]byte("[]"))
 	}
 
+	if tooLarge := checkWorkflowSize(&project); tooLarge != nil {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeWorkflowTooLarge, "workflow is too large", tooLarge)
+	}
+	// Drafts may be saved half-built with ?skip_validation=true
+	if !c.QueryBool("skip_validation") {
+		if invalid := checkWorkflowSchema(&project); invalid != nil {
+			return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeInvalidWorkflow, "invalid workflow", invalid)
+		}
+	}
+
 	created, err := repo.Create(&project)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
+	RecordAudit(c, "project.create", "project", created.ID.String(), fiber.Map{"name": created.Name})
+	events.Publish(events.ProjectSaved{ProjectID: created.ID.String(), UserID: userID.String(), Created: true, At: time.Now()})
+
 	return c.Status(http.StatusCreated).JSON(created)
 }
 
 func ListProjects(c *fiber.Ctx, repo *repository.ProjectRepository) error {
-	// Get user ID from context if available; if not, return all projects (no auth)
+	// Archived projects are hidden unless explicitly requested with ?status=archived
+	filter := repository.ProjectFilter{
+		Status: repository.ProjectStatus(c.Query("status")),
+		Tag:    strings.ToLower(strings.TrimSpace(c.Query("tag"))),
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid status", nil)
+	}
+
+	// Listings are summaries; the nodes and connections are only sent with ?include=graph
+	withGraph := c.Query("include") == "graph"
+	repo = repo.WithContext(c.UserContext())
+
+	// Every user's projects are only listed through GET /admin/projects
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		projects, err := repo.ListAll()
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(projects)
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	if c.QueryBool("favorites") {
+		filter.FavoritesOf = userIDStr.(string)
 	}
 
-	projects, err := repo.GetByUserID(userIDStr.(string))
+	var projects interface{}
+	var err error
+	if withGraph {
+		projects, err = repo.GetAccessibleByUserID(userIDStr.(string), filter)
+	} else {
+		projects, err = repo.SummariesAccessibleByUserID(userIDStr.(string), filter)
+	}
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
 	return c.JSON(projects)
 }
 
+// AdminProjectsResponse is a page of GET /admin/projects
+type AdminProjectsResponse struct {
+	Projects []repository.AdminProjectSummary `json:"projects"`
+	Total    int64                            `json:"total"`
+	Limit    int                              `json:"limit"`
+	Offset   int                              `json:"offset"`
+}
+
+// ListAdminProjects returns a page of the projects of every user in the
+// admin's tenant with their owners, filterable by ?user_id, ?status, ?tag and
+// a ?from/?to creation range
+func ListAdminProjects(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	filter := repository.AdminProjectFilter{
+		ProjectFilter: repository.ProjectFilter{
+			Status: repository.ProjectStatus(c.Query("status")),
+			Tag:    strings.ToLower(strings.TrimSpace(c.Query("tag"))),
+		},
+		UserID: c.Query("user_id"),
+		Limit:  c.QueryInt("limit", 50),
+		Offset: c.QueryInt("offset", 0),
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid status", nil)
+	}
+	if filter.UserID != "" {
+		if _, err := uuid.Parse(filter.UserID); err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user_id", nil)
+		}
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := parseTimeParam(from)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid from", nil)
+		}
+		filter.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseTimeParam(to)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid to", nil)
+		}
+		filter.To = &t
+	}
+
+	projects, total, err := repo.WithContext(c.UserContext()).ListForAdmin(filter)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(AdminProjectsResponse{
+		Projects: projects,
+		Total:    total,
+		Limit:    filter.Limit,
+		Offset:   filter.Offset,
+	})
+}
+
 func GetProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	id := c.Params("id")
 
 	// Get user ID from context for authorization
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	project, err := repo.GetByID(id)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	// Verify ownership
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+	// Verify access
+	if !canAccess(repo, project, userIDStr.(string), accessViewer) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
 	}
 
+	c.Set(fiber.HeaderETag, projectETag(project))
 	return c.JSON(project)
 }
 
+// projectLastSaved is the time a project was last written
+func projectLastSaved(p *repository.Project) time.Time {
+	if p.UpdatedAt != nil {
+		return *p.UpdatedAt
+	}
+	return p.CreatedAt
+}
+
+// projectETag identifies the saved state of a project. Postgres keeps
+// microseconds, so the time is truncated to match what a later read returns.
+func projectETag(p *repository.Project) string {
+	return fmt.Sprintf(`"%d"`, projectLastSaved(p).Truncate(time.Microsecond).UnixNano())
+}
+
+// ifMatchFails reports whether the request's If-Match header names a state
+// other than the project's current one. A missing header or * always passes.
+func ifMatchFails(c *fiber.Ctx, p *repository.Project) bool {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return false
+	}
+	current := projectETag(p)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == current || `"`+tag+`"` == current {
+			return false
+		}
+	}
+	return true
+}
+
+// projectChanged answers an edit based on a stale copy of project with 412
+func projectChanged(c *fiber.Ctx, project *repository.Project) error {
+	return response.Error(c, http.StatusPreconditionFailed, response.ErrCodeConflict, "project was changed since it was loaded", fiber.Map{
+		"current_updated_at": projectLastSaved(project),
+	})
+}
+
 func UpdateProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	id := c.Params("id")
 
 	// Get user ID from context
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	// Get existing project
 	project, err := repo.GetByID(id)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	// Verify ownership
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+	// Verify access
+	if !canAccess(repo, project, userIDStr.(string), accessEditor) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
 	}
 
+	// Reject edits based on a stale copy, e.g. from another tab
+	if ifMatchFails(c, project) {
+		return projectChanged(c, project)
+	}
+	loadedVersion := project.Version
+
 	var body UpdateProjectPayload
 	if err := c.BodyParser(&body); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+
+	if body.Name != nil {
+		existing, err := repo.GetByUserIDAndName(project.UserID.String(), *body.Name)
+		if err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+		}
+		if existing != nil && existing.ID != project.ID {
+			return response.Error(c, http.StatusConflict, response.ErrCodeProjectNameTaken, "a project with this name already exists", nil)
+		}
 	}
 
 	// Update fields
+	diff := map[string]fieldChange{}
 	if body.Name != nil {
+		diff["name"] = fieldChange{From: project.Name, To: *body.Name}
 		project.Name = *body.Name
 	}
 	if body.Description != nil {
+		diff["description"] = fieldChange{From: project.Description, To: *body.Description}
 		project.Description = *body.Description
 	}
 	if body.Status != nil {
-		project.Status = *body.Status
+		to := repository.ProjectStatus(*body.Status)
+		if !to.Valid() {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid status", nil)
+		}
+		if !project.Status.CanTransitionTo(to) {
+			return response.Error(c, http.StatusConflict, response.ErrCodeInvalidStatusTransition, "invalid status transition", fiber.Map{"from": project.Status, "to": to})
+		}
+		diff["status"] = fieldChange{From: project.Status, To: to}
+		project.Status = to
+	}
+	if body.Tags != nil {
+		tags, err := normalizeTags(*body.Tags)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+		}
+		diff["tags"] = fieldChange{From: project.Tags, To: tags}
+		project.Tags = tags
+	}
+	if body.DefaultAPIKeyID != nil {
+		var keyID *uuid.UUID
+		if *body.DefaultAPIKeyID != "" {
+			key, err := repository.NewUserAPIKeyRepository(repository.GetDB()).WithContext(c.UserContext()).GetByID(*body.DefaultAPIKeyID)
+			if err != nil || key.UserID != project.UserID {
+				return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "default_api_key_id must be one of the project owner's API keys", nil)
+			}
+			keyID = &key.ID
+		}
+		diff["default_api_key_id"] = fieldChange{From: project.DefaultAPIKeyID, To: keyID}
+		project.DefaultAPIKeyID = keyID
+	}
+	if body.TeamID != nil {
+		if project.UserID.String() != userIDStr.(string) {
+			return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "only the owner can change the team", nil)
+		}
+		teamID, err := projectTeam(repo, *body.TeamID, userIDStr.(string))
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+		}
+		diff["team_id"] = fieldChange{From: project.TeamID, To: teamID}
+		project.TeamID = teamID
 	}
-	if body.Nodes != nil {
+	if len(body.TokenBudget) > 0 {
+		if project.UserID.String() != userIDStr.(string) {
+			return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "only the owner can change the token budget", nil)
+		}
+		var budget *int64
+		if err := json.Unmarshal(body.TokenBudget, &budget); err != nil || (budget != nil && *budget < 0) {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "token_budget must be a non-negative whole number or null", nil)
+		}
+		diff["token_budget"] = fieldChange{From: project.TokenBudget, To: budget}
+		project.TokenBudget = budget
+	}
+	var webhookSecret string
+	if body.WebhookEnabled != nil {
+		if project.UserID.String() != userIDStr.(string) {
+			return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "only the owner can change the webhook", nil)
+		}
+		if *body.WebhookEnabled && project.WebhookSecret == "" {
+			if webhookSecret, err = generateWebhookSecret(); err != nil {
+				return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to generate secret", nil)
+			}
+			if project.WebhookSecret, err = EncryptAPIKey(webhookSecret); err != nil {
+				return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to encrypt secret", nil)
+			}
+		}
+		diff["webhook_enabled"] = fieldChange{From: project.WebhookEnabled, To: *body.WebhookEnabled}
+		project.WebhookEnabled = *body.WebhookEnabled
+	}
+	if tooLarge := checkWorkflowPayloadSize(body.Nodes, body.Connections); tooLarge != nil {
+		return response.Error(c, http.StatusRequestEntityTooLarge, response.ErrCodePayloadTooLarge, "workflow payload is too large", tooLarge)
+	}
+	if hasJSON(body.Nodes) {
+		diff["nodes"] = fieldChange{From: "changed", To: "changed"}
 		nodesJSON, err := json.Marshal(body.Nodes)
 		if err != nil {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid nodes"})
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid nodes", nil)
 		}
 		project.Nodes = datatypes.JSON(nodesJSON)
 	}
-	if body.Connections != nil {
+	if hasJSON(body.Connections) {
+		diff["connections"] = fieldChange{From: "changed", To: "changed"}
 		connectionsJSON, err := json.Marshal(body.Connections)
 		if err != nil {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid connections"})
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid connections", nil)
 		}
 		project.Connections = datatypes.JSON(connectionsJSON)
 	}
 
-	updated, err := repo.Update(project)
+	if tooLarge := checkWorkflowSize(project); tooLarge != nil {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeWorkflowTooLarge, "workflow is too large", tooLarge)
+	}
+	if (hasJSON(body.Nodes) || hasJSON(body.Connections)) && !c.QueryBool("skip_validation") {
+		if invalid := checkWorkflowSchema(project); invalid != nil {
+			return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeInvalidWorkflow, "invalid workflow", invalid)
+		}
+	}
+
+	var updated *repository.Project
+	if strings.TrimSpace(c.Get(fiber.HeaderIfMatch)) != "" {
+		// The project may have been saved since the If-Match check, so the
+		// update only applies to the version that was checked
+		updated, err = repo.UpdateVersion(project, loadedVersion)
+	} else {
+		updated, err = repo.Update(project)
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		if current, err := repo.GetByID(id); err == nil {
+			project = current
+		}
+		return projectChanged(c, project)
+	}
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
+	RecordAudit(c, "project.update", "project", updated.ID.String(), diff)
+	events.Publish(events.ProjectSaved{ProjectID: updated.ID.String(), UserID: updated.UserID.String(), At: time.Now()})
+
+	saved := *updated
+	go refreshWorkflowPreview(repo.WithContext(context.WithoutCancel(c.UserContext())), &saved)
+	updated.NewWebhookSecret = webhookSecret
+	c.Set(fiber.HeaderETag, projectETag(updated))
 	return c.JSON(updated)
 }
 
@@ -190,23 +557,447 @@ func DeleteProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
 	// Get user ID from context
 	userIDStr := c.Locals("userID")
 	if userIDStr == nil {
-		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
 	}
 
 	// Get existing project to verify ownership
 	project, err := repo.GetByID(id)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "project not found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
 	}
 
-	// Verify ownership
-	if project.UserID.String() != userIDStr.(string) {
-		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+	// Verify access
+	if !canAccess(repo, project, userIDStr.(string), accessOwner) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
 	}
 
 	if err := repo.Delete(id); err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	cleanupProjectData(project)
+
+	RecordAudit(c, "project.delete", "project", id, fiber.Map{"name": project.Name})
+
+	return c.JSON(response.MessageResponse{Message: "project deleted"})
+}
+
+// maxBulkDelete caps the number of IDs accepted by BulkDeleteProjects
+const maxBulkDelete = 100
+
+// BulkDeletePayload is the request body for deleting several projects
+type BulkDeletePayload struct {
+	IDs []string `json:"ids"`
+}
+
+// bulkDeleteSkip explains why a project was left out of a bulk delete
+type bulkDeleteSkip struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// BulkDeleteResponse is the response of POST /projects/bulk-delete
+type BulkDeleteResponse struct {
+	Deleted []string         `json:"deleted"`
+	Skipped []bulkDeleteSkip `json:"skipped"`
+}
+
+// BulkDeleteProjects deletes every listed project owned by the caller. IDs that
+// don't exist or belong to someone else are reported as skipped instead of
+// failing the whole batch.
+func BulkDeleteProjects(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	var body BulkDeletePayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if len(body.IDs) == 0 {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "ids is required", nil)
+	}
+	if len(body.IDs) > maxBulkDelete {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, fmt.Sprintf("at most %d ids per request", maxBulkDelete), nil)
 	}
 
-	return c.JSON(fiber.Map{"message": "project deleted"})
+	repo = repo.WithContext(c.UserContext())
+	deleted := []string{}
+	skipped := []bulkDeleteSkip{}
+	owned := make(map[string]*repository.Project)
+	seen := make(map[string]bool)
+	for _, id := range body.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if _, err := uuid.Parse(id); err != nil {
+			skipped = append(skipped, bulkDeleteSkip{ID: id, Reason: "invalid_id"})
+			continue
+		}
+		project, err := repo.GetByID(id)
+		if err != nil {
+			skipped = append(skipped, bulkDeleteSkip{ID: id, Reason: "not_found"})
+			continue
+		}
+		if !canAccess(repo, project, userIDStr.(string), accessOwner) {
+			skipped = append(skipped, bulkDeleteSkip{ID: id, Reason: "forbidden"})
+			continue
+		}
+		deleted = append(deleted, id)
+		owned[id] = project
+	}
+
+	if len(deleted) > 0 {
+		if err := repo.DeleteMany(deleted); err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+		}
+	}
+
+	for _, id := range deleted {
+		cleanupProjectData(owned[id])
+		RecordAudit(c, "project.delete", "project", id, fiber.Map{"name": owned[id].Name, "bulk": true})
+	}
+
+	return c.JSON(BulkDeleteResponse{Deleted: deleted, Skipped: skipped})
+}
+
+// OpenProject records that the caller opened a project, for the recently
+// opened list. Kept separate from GET so prefetching doesn't count as opening.
+func OpenProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	id := c.Params("id")
+	if _, err := uuid.Parse(id); err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	}
+
+	ok, err := repo.WithContext(c.UserContext()).MarkOpened(id, userIDStr.(string))
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if !ok {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// FavoriteResponse is the response of the favorite endpoints
+type FavoriteResponse struct {
+	ProjectID  uuid.UUID `json:"project_id"`
+	IsFavorite bool      `json:"is_favorite"`
+}
+
+// FavoriteProject pins a project the caller can view; favoriting twice is harmless
+func FavoriteProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	return setFavorite(c, repo, true)
+}
+
+// UnfavoriteProject unpins a project; unfavoriting a project that isn't pinned is harmless
+func UnfavoriteProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	return setFavorite(c, repo, false)
+}
+
+func setFavorite(c *fiber.Ctx, repo *repository.ProjectRepository, favorite bool) error {
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+
+	userID := uuid.MustParse(c.Locals("userID").(string))
+	if favorite {
+		err = repo.AddFavorite(project.ID, userID)
+	} else {
+		err = repo.RemoveFavorite(project.ID, userID)
+	}
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(FavoriteResponse{ProjectID: project.ID, IsFavorite: favorite})
+}
+
+// ListRecentProjects returns the projects the caller opened most recently
+func ListRecentProjects(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	limit := c.QueryInt("limit", 5)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 50 {
+		limit = 50
+	}
+
+	projects, err := repo.WithContext(c.UserContext()).RecentByUserID(userIDStr.(string), limit)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(projects)
+}
+
+// ProjectNameAvailability is the response of GET /projects/check-name
+type ProjectNameAvailability struct {
+	Available bool `json:"available"`
+}
+
+// CheckProjectName reports whether a project name is still available for the caller.
+// An optional exclude_id ignores the project being renamed.
+func CheckProjectName(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	name := c.Query("name")
+	if name == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "name is required", nil)
+	}
+
+	existing, err := repo.GetByUserIDAndName(userIDStr.(string), name)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	available := existing == nil || existing.ID.String() == c.Query("exclude_id")
+	return c.JSON(ProjectNameAvailability{Available: available})
+}
+
+// DuplicateProjectPayload is the optional body of POST /projects/:id/duplicate
+type DuplicateProjectPayload struct {
+	Name string `json:"name"`
+}
+
+// DuplicateProject copies a project the caller may view into a new draft
+// owned by the caller, named by the optional "name" field or "<name> (copy)".
+// The workflow gets fresh node IDs and the documents are copied with it.
+func DuplicateProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	source, err := loadProjectForAccess(c, repo, accessViewer)
+	if source == nil {
+		return err
+	}
+	userID, err := uuid.Parse(fmt.Sprint(c.Locals("userID")))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user id", nil)
+	}
+
+	var body DuplicateProjectPayload
+	_ = c.BodyParser(&body)
+	if body.Name == "" {
+		body.Name = source.Name + " (copy)"
+	}
+	existing, err := repo.GetByUserIDAndName(userID.String(), body.Name)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if existing != nil {
+		return response.Error(c, http.StatusConflict, response.ErrCodeProjectNameTaken, "a project with this name already exists", nil)
+	}
+
+	nodes, connections := parseWorkflow(source)
+	nodeIDs := regenerateWorkflowIDs(nodes, connections)
+	nodesJSON, _ := json.Marshal(nodes)
+	connectionsJSON, _ := json.Marshal(connections)
+
+	created, err := repo.Create(&repository.Project{
+		UserID:      userID,
+		Name:        body.Name,
+		Description: source.Description,
+		Nodes:       datatypes.JSON(nodesJSON),
+		Connections: datatypes.JSON(connectionsJSON),
+		Status:      repository.ProjectStatusDraft,
+		Tags:        source.Tags,
+		Settings:    source.Settings,
+	})
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if err := CopyProjectDocuments(source.UserID, source.ID, userID, created.ID, nodeIDs); err != nil {
+		if err := repo.Delete(created.ID.String()); err != nil {
+			log.Printf("[projects] failed to remove duplicate %s: %v", created.ID, err)
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to copy documents: "+err.Error(), nil)
+	}
+	if created, err = repo.GetByID(created.ID.String()); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.duplicate", "project", created.ID.String(), fiber.Map{"name": created.Name, "source_id": source.ID})
+	events.Publish(events.ProjectSaved{ProjectID: created.ID.String(), UserID: userID.String(), Created: true, At: time.Now()})
+
+	return c.Status(http.StatusCreated).JSON(created)
+}
+
+var (
+	// errForbidden aborts a locked update when the caller may not modify the project
+	errForbidden = errors.New("forbidden")
+	// errNodeNotFound is returned when a node ID does not exist in a project's workflow
+	errNodeNotFound = errors.New("node not found")
+)
+
+// NodePatch is the body of PATCH /projects/:id/nodes/:nodeId: the data keys
+// to set on the node, or null to remove them
+type NodePatch map[string]interface{}
+
+// PatchNode merges a partial data object into a single workflow node. Keys set
+// to null are removed from the node's data. The update runs under a row lock so
+// concurrent patches to different nodes do not overwrite each other.
+func PatchNode(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	id := c.Params("id")
+	nodeID := c.Params("nodeId")
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	var patch NodePatch
+	if err := json.Unmarshal(c.Body(), &patch); err != nil || patch == nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+
+	updated, err := repo.UpdateLocked(id, func(project *repository.Project) error {
+		if !canAccess(repo, project, userIDStr.(string), accessEditor) {
+			return errForbidden
+		}
+
+		nodes, _ := parseWorkflow(project)
+		var node map[string]interface{}
+		for _, n := range nodes {
+			if nid, _ := n["id"].(string); nid == nodeID {
+				node = n
+				break
+			}
+		}
+		if node == nil {
+			return errNodeNotFound
+		}
+
+		data := nodeData(node)
+		for k, v := range patch {
+			if v == nil {
+				delete(data, k)
+			} else {
+				data[k] = v
+			}
+		}
+
+		nodesJSON, err := json.Marshal(nodes)
+		if err != nil {
+			return err
+		}
+		project.Nodes = datatypes.JSON(nodesJSON)
+		return nil
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	case errors.Is(err, errForbidden):
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+	case errors.Is(err, errNodeNotFound):
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "node not found", nil)
+	case err != nil:
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.node_patch", "project", updated.ID.String(), fiber.Map{"node_id": nodeID, "keys": mapKeys(patch)})
+	events.Publish(events.ProjectSaved{ProjectID: updated.ID.String(), UserID: updated.UserID.String(), At: time.Now()})
+
+	return c.JSON(updated)
+}
+
+// mapKeys returns the keys of m
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// ArchiveProject moves a project to the archived status. With
+// ?cleanup_documents=true its documents are also moved to archive storage.
+func ArchiveProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	return setProjectStatus(c, repo, "", repository.ProjectStatusArchived, c.QueryBool("cleanup_documents"))
+}
+
+// UnarchiveProject moves an archived project back to draft. With
+// ?restore_documents=true documents moved to archive storage are brought back.
+func UnarchiveProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	return setProjectStatus(c, repo, repository.ProjectStatusArchived, repository.ProjectStatusDraft, c.QueryBool("restore_documents"))
+}
+
+// setProjectStatus applies a status transition for the archive endpoints.
+// When requireFrom is set the project must currently be in that status.
+// moveDocuments moves the document directory to archive storage when
+// archiving, and back when unarchiving.
+func setProjectStatus(c *fiber.Ctx, repo *repository.ProjectRepository, requireFrom, to repository.ProjectStatus, moveDocuments bool) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	from := project.Status
+	if from == to {
+		return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "project is already "+string(to), nil)
+	}
+	if requireFrom != "" && from != requireFrom {
+		return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "project is not "+string(requireFrom), nil)
+	}
+	if !from.CanTransitionTo(to) {
+		return response.Error(c, http.StatusConflict, response.ErrCodeInvalidStatusTransition, "invalid status transition", fiber.Map{"from": from, "to": to})
+	}
+
+	diff := map[string]interface{}{"status": fieldChange{From: from, To: to}}
+	var undoMove func()
+	if moveDocuments {
+		docRepo := documentRepo(c)
+		src, dst, status, undoStatus := projectDocumentDir(project), projectArchiveDir(project), documentArchived, "ready"
+		if to != repository.ProjectStatusArchived {
+			src, dst, status, undoStatus = dst, src, undoStatus, status
+		}
+		if err := moveProjectDocuments(docRepo, project, src, dst, status); err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to move documents: "+err.Error(), nil)
+		}
+		undoMove = func() {
+			if err := moveProjectDocuments(docRepo, project, dst, src, undoStatus); err != nil {
+				log.Printf("[archive] failed to move documents of project %s back: %v", project.ID, err)
+			}
+		}
+		diff["documents"] = fieldChange{From: src, To: dst}
+	}
+
+	project.Status = to
+	updated, err := repo.Update(project)
+	if err != nil {
+		if undoMove != nil {
+			undoMove()
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.update", "project", updated.ID.String(), diff)
+	events.Publish(events.ProjectSaved{ProjectID: updated.ID.String(), UserID: updated.UserID.String(), At: time.Now()})
+
+	return c.JSON(updated)
+}
+
+// ListProjectTags returns the caller's distinct project tags with usage counts
+func ListProjectTags(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	counts, err := repo.WithContext(c.UserContext()).TagCountsByUserID(userIDStr.(string))
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(counts)
 }
@@ -0,0 +1,1083 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/repository/repotest"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// createTestProject stores a project of owner with the given nodes
+func createTestProject(t *testing.T, owner uuid.UUID, nodes string) *repository.Project {
+	t.Helper()
+	project := &repository.Project{
+		ID:          uuid.New(),
+		UserID:      owner,
+		Name:        "project",
+		Status:      repository.ProjectStatusDraft,
+		Nodes:       datatypes.JSON(nodes),
+		Connections: datatypes.JSON(`[]`),
+		Version:     1,
+	}
+	if err := repository.GetDB().Create(project).Error; err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	return project
+}
+
+// nodeDataByID returns the data of every node of project, by node ID
+func nodeDataByID(project *repository.Project) map[string]map[string]interface{} {
+	nodes, _ := parseWorkflow(project)
+	out := map[string]map[string]interface{}{}
+	for _, node := range nodes {
+		id, _ := node["id"].(string)
+		out[id] = nodeData(node)
+	}
+	return out
+}
+
+const patchNodeNodes = `[
+	{"id":"n1","type":"ai-model","position":{"x":0,"y":0},"data":{"modelName":"gpt-4o","temperature":0.7,"tools":{"search":true}}},
+	{"id":"n2","type":"text-output","position":{"x":200,"y":0},"data":{"label":"Answer"}}
+]`
+
+func TestPatchNode(t *testing.T) {
+	owner := uuid.New()
+	tests := []struct {
+		name       string
+		userID     string
+		nodeID     string
+		patch      string
+		wantStatus int
+		// wantData is the data of n1 afterwards
+		wantData map[string]interface{}
+	}{
+		{
+			name:       "adds keys and keeps the others",
+			nodeID:     "n1",
+			patch:      `{"maxTokens":256}`,
+			wantStatus: http.StatusOK,
+			wantData:   map[string]interface{}{"modelName": "gpt-4o", "temperature": 0.7, "tools": map[string]interface{}{"search": true}, "maxTokens": 256.0},
+		},
+		{
+			name:       "overwrites a key",
+			nodeID:     "n1",
+			patch:      `{"temperature":0.2}`,
+			wantStatus: http.StatusOK,
+			wantData:   map[string]interface{}{"modelName": "gpt-4o", "temperature": 0.2, "tools": map[string]interface{}{"search": true}},
+		},
+		{
+			name:       "null removes a key",
+			nodeID:     "n1",
+			patch:      `{"temperature":null}`,
+			wantStatus: http.StatusOK,
+			wantData:   map[string]interface{}{"modelName": "gpt-4o", "tools": map[string]interface{}{"search": true}},
+		},
+		{
+			name:       "nested objects are replaced, not merged",
+			nodeID:     "n1",
+			patch:      `{"tools":{"code":true}}`,
+			wantStatus: http.StatusOK,
+			wantData:   map[string]interface{}{"modelName": "gpt-4o", "temperature": 0.7, "tools": map[string]interface{}{"code": true}},
+		},
+		{
+			name:       "unknown node",
+			nodeID:     "n9",
+			patch:      `{"temperature":0.2}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "payload is not an object",
+			nodeID:     "n1",
+			patch:      `["temperature"]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "caller without access",
+			userID:     uuid.NewString(),
+			nodeID:     "n1",
+			patch:      `{"temperature":0.2}`,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, &repository.Project{}, &repository.ProjectVersion{}, &repository.ProjectMember{}, &repository.AuditLog{})
+			project := createTestProject(t, owner, patchNodeNodes)
+			userID := tt.userID
+			if userID == "" {
+				userID = owner.String()
+			}
+
+			resp := serveAs(t, userID, "/projects/:id/nodes/:nodeId", func(c *fiber.Ctx) error {
+				return PatchNode(c, repository.NewProject(db))
+			}, newRequest("PATCH", "/projects/"+project.ID.String()+"/nodes/"+tt.nodeID, "application/json", strings.NewReader(tt.patch)))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			stored, err := repository.NewProject(db).GetByID(project.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !reflect.DeepEqual(nodeDataByID(stored), nodeDataByID(project)) {
+					t.Errorf("nodes changed to %s", stored.Nodes)
+				}
+				return
+			}
+			if stored.Version != project.Version+1 {
+				t.Errorf("version = %d, want %d", stored.Version, project.Version+1)
+			}
+			data := nodeDataByID(stored)
+			if !reflect.DeepEqual(data["n1"], tt.wantData) {
+				t.Errorf("n1 data = %v, want %v", data["n1"], tt.wantData)
+			}
+			if want := nodeDataByID(project)["n2"]; !reflect.DeepEqual(data["n2"], want) {
+				t.Errorf("n2 data = %v, want it untouched %v", data["n2"], want)
+			}
+		})
+	}
+}
+
+func TestPatchNodeConcurrentPatchesOfDifferentNodes(t *testing.T) {
+	db := useTestDB(t, &repository.Project{}, &repository.ProjectVersion{}, &repository.AuditLog{})
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQLite has no row locks; one connection serializes the transactions the
+	// way the row lock does in Postgres
+	sqlDB.SetMaxOpenConns(1)
+	owner := uuid.New()
+	project := createTestProject(t, owner, patchNodeNodes)
+
+	var wg sync.WaitGroup
+	for _, patch := range []struct{ nodeID, body string }{
+		{"n1", `{"temperature":0.1}`},
+		{"n2", `{"label":"Reply"}`},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := serveAs(t, owner.String(), "/projects/:id/nodes/:nodeId", func(c *fiber.Ctx) error {
+				return PatchNode(c, repository.NewProject(db))
+			}, newRequest("PATCH", "/projects/"+project.ID.String()+"/nodes/"+patch.nodeID, "application/json", strings.NewReader(patch.body)))
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("patch %s: status %d", patch.nodeID, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored, err := repository.NewProject(db).GetByID(project.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := nodeDataByID(stored)
+	if data["n1"]["temperature"] != 0.1 || data["n2"]["label"] != "Reply" {
+		nodes, _ := json.Marshal(data)
+		t.Errorf("nodes = %s, want both patches applied", nodes)
+	}
+	if stored.Version != project.Version+2 {
+		t.Errorf("version = %d, want %d", stored.Version, project.Version+2)
+	}
+}
+
+// projectListModels are the tables project listings and access checks read
+var projectListModels = []interface{}{
+	&repository.Project{}, &repository.ProjectVersion{}, &repository.ProjectMember{},
+	&repository.TeamMember{}, &repository.ProjectFavorite{}, &repository.AuditLog{},
+}
+
+// withStatus stores status on project
+func withStatus(t *testing.T, project *repository.Project, status repository.ProjectStatus) *repository.Project {
+	t.Helper()
+	project.Status = status
+	if err := repository.GetDB().Model(project).Update("status", status).Error; err != nil {
+		t.Fatalf("set status: %v", err)
+	}
+	return project
+}
+
+func TestUpdateProjectStatus(t *testing.T) {
+	const (
+		draft    = repository.ProjectStatusDraft
+		active   = repository.ProjectStatusActive
+		archived = repository.ProjectStatusArchived
+	)
+	tests := []struct {
+		from       repository.ProjectStatus
+		to         string
+		wantStatus int
+		wantCode   string
+	}{
+		{from: draft, to: "draft", wantStatus: http.StatusOK},
+		{from: draft, to: "active", wantStatus: http.StatusOK},
+		{from: draft, to: "archived", wantStatus: http.StatusOK},
+		{from: active, to: "draft", wantStatus: http.StatusOK},
+		{from: active, to: "active", wantStatus: http.StatusOK},
+		{from: active, to: "archived", wantStatus: http.StatusOK},
+		{from: archived, to: "draft", wantStatus: http.StatusOK},
+		{from: archived, to: "active", wantStatus: http.StatusConflict, wantCode: response.ErrCodeInvalidStatusTransition},
+		{from: archived, to: "archived", wantStatus: http.StatusOK},
+		{from: draft, to: "banana", wantStatus: http.StatusBadRequest, wantCode: response.ErrCodeBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+tt.to, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			owner := uuid.New()
+			project := withStatus(t, createTestProject(t, owner, `[]`), tt.from)
+
+			resp := serveAs(t, owner.String(), "/projects/:id", func(c *fiber.Ctx) error {
+				return UpdateProject(c, repository.NewProject(db))
+			}, newRequest("PUT", "/projects/"+project.ID.String(), "application/json", strings.NewReader(`{"status":"`+tt.to+`"}`)))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, body); code != tt.wantCode {
+					t.Errorf("code = %s, want %s", code, tt.wantCode)
+				}
+			}
+
+			want := tt.from
+			if tt.wantStatus == http.StatusOK {
+				want = repository.ProjectStatus(tt.to)
+			}
+			stored, err := repository.NewProject(db).GetByID(project.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != want {
+				t.Errorf("stored status = %s, want %s", stored.Status, want)
+			}
+		})
+	}
+}
+
+func TestArchiveEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		from       repository.ProjectStatus
+		handler    func(c *fiber.Ctx, repo *repository.ProjectRepository) error
+		wantStatus int
+		want       repository.ProjectStatus
+	}{
+		{name: "archive a draft", from: repository.ProjectStatusDraft, handler: ArchiveProject, wantStatus: http.StatusOK, want: repository.ProjectStatusArchived},
+		{name: "archive an active project", from: repository.ProjectStatusActive, handler: ArchiveProject, wantStatus: http.StatusOK, want: repository.ProjectStatusArchived},
+		{name: "archive an archived project", from: repository.ProjectStatusArchived, handler: ArchiveProject, wantStatus: http.StatusConflict, want: repository.ProjectStatusArchived},
+		{name: "unarchive an archived project", from: repository.ProjectStatusArchived, handler: UnarchiveProject, wantStatus: http.StatusOK, want: repository.ProjectStatusDraft},
+		{name: "unarchive a draft", from: repository.ProjectStatusDraft, handler: UnarchiveProject, wantStatus: http.StatusConflict, want: repository.ProjectStatusDraft},
+		{name: "unarchive an active project", from: repository.ProjectStatusActive, handler: UnarchiveProject, wantStatus: http.StatusConflict, want: repository.ProjectStatusActive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			owner := uuid.New()
+			project := withStatus(t, createTestProject(t, owner, `[]`), tt.from)
+
+			resp := serveAs(t, owner.String(), "/projects/:id/archive", func(c *fiber.Ctx) error {
+				return tt.handler(c, repository.NewProject(db))
+			}, newRequest("POST", "/projects/"+project.ID.String()+"/archive", "", nil))
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, readBody(t, resp))
+			}
+			stored, err := repository.NewProject(db).GetByID(project.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.want {
+				t.Errorf("stored status = %s, want %s", stored.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestListProjectsHidesArchived(t *testing.T) {
+	db := useTestDB(t, projectListModels...)
+	owner := uuid.New()
+	byID := map[uuid.UUID]repository.ProjectStatus{}
+	for _, status := range []repository.ProjectStatus{repository.ProjectStatusDraft, repository.ProjectStatusActive, repository.ProjectStatusArchived} {
+		p := withStatus(t, createTestProject(t, owner, `[]`), status)
+		byID[p.ID] = status
+	}
+
+	tests := []struct {
+		query string
+		want  []repository.ProjectStatus
+	}{
+		{query: "", want: []repository.ProjectStatus{repository.ProjectStatusDraft, repository.ProjectStatusActive}},
+		{query: "&status=archived", want: []repository.ProjectStatus{repository.ProjectStatusArchived}},
+		{query: "&status=active", want: []repository.ProjectStatus{repository.ProjectStatusActive}},
+	}
+	for _, tt := range tests {
+		t.Run("status="+strings.TrimPrefix(tt.query, "&status="), func(t *testing.T) {
+			resp := serveAs(t, owner.String(), "/projects", func(c *fiber.Ctx) error {
+				return ListProjects(c, repository.NewProject(db))
+			}, newRequest("GET", "/projects?include=graph"+tt.query, "", nil))
+			body := readBody(t, resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d: %s", resp.StatusCode, body)
+			}
+			var projects []repository.Project
+			if err := json.Unmarshal(body, &projects); err != nil {
+				t.Fatal(err)
+			}
+			got := map[repository.ProjectStatus]bool{}
+			for _, p := range projects {
+				got[byID[p.ID]] = true
+			}
+			if len(projects) != len(tt.want) {
+				t.Fatalf("listed %d projects, want %v", len(projects), tt.want)
+			}
+			for _, s := range tt.want {
+				if !got[s] {
+					t.Errorf("listing is missing the %s project", s)
+				}
+			}
+		})
+	}
+}
+
+func TestArchivedProjectRefusesDemoRuns(t *testing.T) {
+	for name, handler := range map[string]func(*fiber.Ctx, *repository.ProjectRepository) error{
+		"DemoProject":       DemoProject,
+		"DemoProjectStream": DemoProjectStream,
+	} {
+		t.Run(name, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			owner := uuid.New()
+			project := withStatus(t, createTestProject(t, owner, `[]`), repository.ProjectStatusArchived)
+
+			resp := serveAs(t, owner.String(), "/projects/:id/demo", func(c *fiber.Ctx) error {
+				return handler(c, repository.NewProject(db))
+			}, newRequest("POST", "/projects/"+project.ID.String()+"/demo", "application/json", strings.NewReader(`{"message":"hi"}`)))
+			if resp.StatusCode != http.StatusConflict {
+				t.Fatalf("status = %d, want 409: %s", resp.StatusCode, readBody(t, resp))
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "trims and lowercases", tags: []string{"  Support Bot ", "INTERNAL"}, want: []string{"support bot", "internal"}},
+		{name: "drops duplicates after normalizing", tags: []string{"Support", "support", " SUPPORT "}, want: []string{"support"}},
+		{name: "drops empty tags", tags: []string{"", "  ", "experiment"}, want: []string{"experiment"}},
+		{name: "no tags", tags: nil, want: []string{}},
+		{name: "ten tags", tags: strings.Split("a,b,c,d,e,f,g,h,i,j", ","), want: strings.Split("a,b,c,d,e,f,g,h,i,j", ",")},
+		{name: "eleven tags", tags: strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), wantErr: true},
+		{name: "eleven tags with a duplicate", tags: strings.Split("a,b,c,d,e,f,g,h,i,j,J", ","), want: strings.Split("a,b,c,d,e,f,g,h,i,j", ",")},
+		{name: "thirty characters", tags: []string{strings.Repeat("x", 30)}, want: []string{strings.Repeat("x", 30)}},
+		{name: "thirty-one characters", tags: []string{strings.Repeat("x", 31)}, wantErr: true},
+		{name: "length counts characters, not bytes", tags: []string{strings.Repeat("ก", 30)}, want: []string{strings.Repeat("ก", 30)}},
+		{name: "length is checked after trimming", tags: []string{"  " + strings.Repeat("x", 30) + "  "}, want: []string{strings.Repeat("x", 30)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeTags(tt.tags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeTags(%q) error = %v, want error %v", tt.tags, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTags(%q) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
+
+// bulkDeleteModels are the tables deleting a project clears
+var bulkDeleteModels = append([]interface{}{
+	&repository.Schedule{}, &repository.Webhook{}, &repository.Execution{}, &repository.EmbeddingJob{},
+	&repository.Document{}, &repository.DocumentVersion{}, &repository.DocumentUpload{},
+}, projectListModels...)
+
+func TestBulkDeleteProjects(t *testing.T) {
+	tooMany := make([]string, maxBulkDelete+1)
+	for i := range tooMany {
+		tooMany[i] = uuid.NewString()
+	}
+
+	tests := []struct {
+		name string
+		// ids builds the request from the caller's projects, a stranger's
+		// project and a project the caller edits but doesn't own
+		ids         func(mine []string, foreign, shared string) []string
+		wantStatus  int
+		wantDeleted func(mine []string) []string
+		wantSkipped func(foreign, shared string) []bulkDeleteSkip
+	}{
+		{
+			name: "owned, foreign, shared, missing and invalid IDs in one request",
+			ids: func(mine []string, foreign, shared string) []string {
+				return []string{mine[0], foreign, "00000000-0000-0000-0000-000000000001", mine[1], "not-a-uuid", shared, mine[0]}
+			},
+			wantStatus:  http.StatusOK,
+			wantDeleted: func(mine []string) []string { return mine },
+			wantSkipped: func(foreign, shared string) []bulkDeleteSkip {
+				return []bulkDeleteSkip{
+					{ID: foreign, Reason: "forbidden"},
+					{ID: "00000000-0000-0000-0000-000000000001", Reason: "not_found"},
+					{ID: "not-a-uuid", Reason: "invalid_id"},
+					{ID: shared, Reason: "forbidden"},
+				}
+			},
+		},
+		{
+			name:        "nothing deletable",
+			ids:         func(_ []string, foreign, _ string) []string { return []string{foreign, "not-a-uuid"} },
+			wantStatus:  http.StatusOK,
+			wantDeleted: func([]string) []string { return []string{} },
+			wantSkipped: func(foreign, _ string) []bulkDeleteSkip {
+				return []bulkDeleteSkip{{ID: foreign, Reason: "forbidden"}, {ID: "not-a-uuid", Reason: "invalid_id"}}
+			},
+		},
+		{
+			name:       "no IDs",
+			ids:        func([]string, string, string) []string { return []string{} },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "more IDs than allowed",
+			ids:        func([]string, string, string) []string { return tooMany },
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, bulkDeleteModels...)
+			owner, stranger := uuid.New(), uuid.New()
+			mine := []string{createTestProject(t, owner, `[]`).ID.String(), createTestProject(t, owner, `[]`).ID.String()}
+			foreign := createTestProject(t, stranger, `[]`).ID.String()
+			shared := createTestProject(t, stranger, `[]`)
+			addTestMember(t, shared, owner, repository.MemberEditor)
+			for _, id := range mine {
+				if err := db.Create(&repository.ProjectFavorite{ProjectID: uuid.MustParse(id), UserID: owner}).Error; err != nil {
+					t.Fatalf("create favorite: %v", err)
+				}
+			}
+
+			payload, _ := json.Marshal(BulkDeletePayload{IDs: tt.ids(mine, foreign, shared.ID.String())})
+			resp := serveAs(t, owner.String(), "/projects/bulk-delete", func(c *fiber.Ctx) error {
+				return BulkDeleteProjects(c, repository.NewProject(db))
+			}, newRequest("POST", "/projects/bulk-delete", "application/json", strings.NewReader(string(payload))))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			var got struct {
+				Deleted []string         `json:"deleted"`
+				Skipped []bulkDeleteSkip `json:"skipped"`
+			}
+			wantDeleted := []string{}
+			if tt.wantStatus == http.StatusOK {
+				if err := json.Unmarshal(body, &got); err != nil {
+					t.Fatalf("response %s: %v", body, err)
+				}
+				wantDeleted = tt.wantDeleted(mine)
+				if !reflect.DeepEqual(got.Deleted, wantDeleted) {
+					t.Errorf("deleted = %v, want %v", got.Deleted, wantDeleted)
+				}
+				if want := tt.wantSkipped(foreign, shared.ID.String()); !reflect.DeepEqual(got.Skipped, want) {
+					t.Errorf("skipped = %v, want %v", got.Skipped, want)
+				}
+			}
+
+			gone := map[string]bool{}
+			for _, id := range wantDeleted {
+				gone[id] = true
+			}
+			for _, id := range append(mine, foreign, shared.ID.String()) {
+				var n int64
+				db.Model(&repository.Project{}).Where("id = ?", id).Count(&n)
+				if exists := n == 1; exists == gone[id] {
+					t.Errorf("project %s exists = %v, want %v", id, exists, !gone[id])
+				}
+			}
+			var favorites int64
+			db.Model(&repository.ProjectFavorite{}).Count(&favorites)
+			if want := int64(len(mine) - len(wantDeleted)); favorites != want {
+				t.Errorf("%d favorites left, want %d", favorites, want)
+			}
+		})
+	}
+}
+
+func TestOpenProject(t *testing.T) {
+	owner, stranger, editor := uuid.New(), uuid.New(), uuid.New()
+	tests := []struct {
+		name       string
+		userID     string
+		projectID  func(project *repository.Project) string
+		wantStatus int
+	}{
+		{name: "owner", userID: owner.String(), projectID: projectIDOf, wantStatus: http.StatusNoContent},
+		{name: "editor member", userID: editor.String(), projectID: projectIDOf, wantStatus: http.StatusNoContent},
+		{name: "someone else's project", userID: stranger.String(), projectID: projectIDOf, wantStatus: http.StatusNotFound},
+		{name: "unknown project", userID: owner.String(), projectID: func(*repository.Project) string { return uuid.NewString() }, wantStatus: http.StatusNotFound},
+		{name: "invalid id", userID: owner.String(), projectID: func(*repository.Project) string { return "not-a-uuid" }, wantStatus: http.StatusNotFound},
+		{name: "unauthenticated", projectID: projectIDOf, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			project := createTestProject(t, owner, `[]`)
+			addTestMember(t, project, editor, repository.MemberEditor)
+
+			id := tt.projectID(project)
+			resp := serveAs(t, tt.userID, "/projects/:id/open", func(c *fiber.Ctx) error {
+				return OpenProject(c, repository.NewProject(db))
+			}, newRequest("POST", "/projects/"+id+"/open", "", nil))
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, readBody(t, resp))
+			}
+
+			stored, err := repository.NewProject(db).GetByID(project.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opened := stored.LastOpened != nil; opened != (tt.wantStatus == http.StatusNoContent) {
+				t.Errorf("project marked opened = %v after a %d", opened, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// projectIDOf returns the ID of project
+func projectIDOf(project *repository.Project) string {
+	return project.ID.String()
+}
+
+// addTestMember adds userID to project with role
+func addTestMember(t *testing.T, project *repository.Project, userID uuid.UUID, role repository.MemberRole) {
+	t.Helper()
+	now := time.Now()
+	if err := repository.GetDB().Create(&repository.ProjectMember{
+		ID:         uuid.New(),
+		ProjectID:  project.ID,
+		UserID:     &userID,
+		Email:      userID.String() + "@example.com",
+		Role:       role,
+		InvitedBy:  project.UserID,
+		AcceptedAt: &now,
+	}).Error; err != nil {
+		t.Fatalf("create member: %v", err)
+	}
+}
+
+func TestListRecentProjects(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		// opened are indexes into the caller's projects, in the order opened
+		opened []int
+		// want are indexes into the caller's projects, in the order listed
+		want []int
+	}{
+		{name: "most recently opened first", opened: []int{0, 1, 2}, want: []int{2, 1, 0}},
+		{name: "reopening moves a project up", opened: []int{0, 1, 2, 0}, want: []int{0, 2, 1}},
+		{name: "never opened projects are left out", opened: []int{1}, want: []int{1}},
+		{name: "limit", query: "?limit=2", opened: []int{0, 1, 2, 3}, want: []int{3, 2}},
+		{name: "archived projects are left out", opened: []int{0, 4, 1}, want: []int{1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			repo := repository.NewProject(db)
+			owner, stranger := uuid.New(), uuid.New()
+			var mine []*repository.Project
+			for i := 0; i < 4; i++ {
+				mine = append(mine, createTestProject(t, owner, `[]`))
+			}
+			mine = append(mine, withStatus(t, createTestProject(t, owner, `[]`), repository.ProjectStatusArchived))
+
+			// Someone else's recently opened project never shows up
+			foreign := createTestProject(t, stranger, `[]`)
+			if ok, err := repo.MarkOpened(foreign.ID.String(), stranger.String()); !ok || err != nil {
+				t.Fatalf("open foreign project: %v %v", ok, err)
+			}
+			for _, i := range tt.opened {
+				if ok, err := repo.MarkOpened(mine[i].ID.String(), owner.String()); !ok || err != nil {
+					t.Fatalf("open project %d: %v %v", i, ok, err)
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			resp := serveAs(t, owner.String(), "/projects/recent", func(c *fiber.Ctx) error {
+				return ListRecentProjects(c, repo)
+			}, newRequest("GET", "/projects/recent"+tt.query, "", nil))
+			body := readBody(t, resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d: %s", resp.StatusCode, body)
+			}
+			var projects []repository.Project
+			if err := json.Unmarshal(body, &projects); err != nil {
+				t.Fatalf("response %s: %v", body, err)
+			}
+			var got, want []string
+			for _, project := range projects {
+				got = append(got, project.ID.String())
+			}
+			for _, i := range tt.want {
+				want = append(want, mine[i].ID.String())
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("recent = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSaveProjectValidatesWorkflow(t *testing.T) {
+	const (
+		valid   = `"nodes":[{"id":"in","type":"text-input","position":{"x":0,"y":0},"data":{}}],"connections":[]`
+		invalid = `"nodes":[{"id":"in","type":"teleporter","position":{"x":0,"y":0},"data":{}}],"connections":[{"sourceNodeId":"in","targetNodeId":"gone"}]`
+	)
+	tests := []struct {
+		name       string
+		update     bool
+		query      string
+		body       string
+		wantStatus int
+	}{
+		{name: "create a valid workflow", body: `{"name":"bot",` + valid + `}`, wantStatus: http.StatusCreated},
+		{name: "create an invalid workflow", body: `{"name":"bot",` + invalid + `}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "create an invalid draft", query: "?skip_validation=true", body: `{"name":"bot",` + invalid + `}`, wantStatus: http.StatusCreated},
+		{name: "update to a valid workflow", update: true, body: `{` + valid + `}`, wantStatus: http.StatusOK},
+		{name: "update to an invalid workflow", update: true, body: `{` + invalid + `}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "update to an invalid draft", update: true, query: "?skip_validation=true", body: `{` + invalid + `}`, wantStatus: http.StatusOK},
+		{name: "update leaving the workflow alone", update: true, body: `{"name":"renamed"}`, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			owner := uuid.New()
+			var resp *http.Response
+			if tt.update {
+				// A stored workflow that no longer validates doesn't block
+				// saves that leave it alone
+				project := createTestProject(t, owner, `[{"id":"old","type":"retired-node"}]`)
+				resp = serveAs(t, owner.String(), "/projects/:id", func(c *fiber.Ctx) error {
+					return UpdateProject(c, repository.NewProject(db))
+				}, newRequest("PUT", "/projects/"+project.ID.String()+tt.query, "application/json", strings.NewReader(tt.body)))
+			} else {
+				resp = serveAs(t, owner.String(), "/projects", func(c *fiber.Ctx) error {
+					return CreateProject(c, repository.NewProject(db))
+				}, newRequest("POST", "/projects"+tt.query, "application/json", strings.NewReader(tt.body)))
+			}
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusUnprocessableEntity {
+				return
+			}
+
+			var errResp struct {
+				Code    string `json:"code"`
+				Details struct {
+					Errors []ValidationError `json:"errors"`
+				} `json:"details"`
+			}
+			if err := json.Unmarshal(body, &errResp); err != nil {
+				t.Fatalf("response %s: %v", body, err)
+			}
+			if errResp.Code != response.ErrCodeInvalidWorkflow {
+				t.Errorf("code = %s, want %s", errResp.Code, response.ErrCodeInvalidWorkflow)
+			}
+			want := []ValidationError{
+				{Path: "nodes[0].type", Message: `unknown node type "teleporter"`},
+				{Path: "connections[0].targetNodeId", Message: `unknown node "gone"`},
+			}
+			if !reflect.DeepEqual(errResp.Details.Errors, want) {
+				t.Errorf("errors = %v, want %v", errResp.Details.Errors, want)
+			}
+		})
+	}
+}
+
+func TestDeleteProjectCleansUp(t *testing.T) {
+	tests := []struct {
+		name       string
+		stranger   bool
+		aiStatus   int
+		wantStatus int
+	}{
+		{name: "owner", aiStatus: http.StatusOK, wantStatus: http.StatusOK},
+		{name: "the AI service failing doesn't stop the delete", aiStatus: http.StatusInternalServerError, wantStatus: http.StatusOK},
+		{name: "someone else's project is left alone", stranger: true, aiStatus: http.StatusOK, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deleted := make(chan map[string]string, 16)
+			ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Cleanup still running for earlier tests may call in too
+				if r.URL.Path != "/delete-index" {
+					http.NotFound(w, r)
+					return
+				}
+				var body map[string]string
+				json.NewDecoder(r.Body).Decode(&body)
+				deleted <- body
+				w.WriteHeader(tt.aiStatus)
+			}))
+			defer ai.Close()
+			t.Setenv("AI_SERVICE_URL", ai.URL)
+			useTestStorage(t)
+
+			db := useTestDB(t, bulkDeleteModels...)
+			owner := uuid.New()
+			project := createTestProject(t, owner, `[]`)
+			id := project.ID.String()
+			docDir := projectDocumentDir(project)
+			if err := os.MkdirAll(docDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(docDir, "handbook.txt"), []byte("leave policy"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range []interface{}{
+				&repository.ProjectVersion{ProjectID: project.ID, Version: 1, Nodes: datatypes.JSON(`[]`), Connections: datatypes.JSON(`[]`)},
+				&repository.ProjectFavorite{ProjectID: project.ID, UserID: owner},
+				&repository.Execution{ID: uuid.New(), ProjectID: project.ID, UserID: owner, Status: "succeeded"},
+				&repository.Document{ID: "handbook.txt", ProjectID: project.ID, UserID: owner, Name: "handbook.txt", StoredPath: filepath.Join(docDir, "handbook.txt")},
+			} {
+				if err := db.Create(row).Error; err != nil {
+					t.Fatalf("create %T: %v", row, err)
+				}
+			}
+			addTestMember(t, project, uuid.New(), repository.MemberEditor)
+
+			userID := owner
+			if tt.stranger {
+				userID = uuid.New()
+			}
+			resp := serveAs(t, userID.String(), "/projects/:id", func(c *fiber.Ctx) error {
+				return DeleteProject(c, repository.NewProject(db))
+			}, newRequest("DELETE", "/projects/"+id, "", nil))
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, readBody(t, resp))
+			}
+			wantGone := tt.wantStatus == http.StatusOK
+
+			if _, err := os.Stat(docDir); os.IsNotExist(err) != wantGone {
+				t.Errorf("document directory removed = %v, want %v", os.IsNotExist(err), wantGone)
+			}
+			for _, model := range []interface{}{&repository.ProjectVersion{}, &repository.ProjectFavorite{}, &repository.Execution{}, &repository.Document{}, &repository.ProjectMember{}} {
+				var n int64
+				db.Model(model).Where("project_id = ?", id).Count(&n)
+				if (n == 0) != wantGone {
+					t.Errorf("%d %T rows left", n, model)
+				}
+			}
+			var n int64
+			db.Model(&repository.Project{}).Where("id = ?", id).Count(&n)
+			if (n == 0) != wantGone {
+				t.Errorf("project row removed = %v, want %v", n == 0, wantGone)
+			}
+
+			wait := 50 * time.Millisecond
+			if wantGone {
+				wait = 5 * time.Second
+			}
+			timeout := time.After(wait)
+			for done := false; !done; {
+				select {
+				case body := <-deleted:
+					if body["project_id"] != id {
+						continue
+					}
+					done = true
+					if !wantGone {
+						t.Errorf("embedding index deleted for %v", body)
+					} else if body["user_id"] != owner.String() {
+						t.Errorf("embedding index deleted for user %s, want %s", body["user_id"], owner)
+					}
+				case <-timeout:
+					if wantGone {
+						t.Fatal("the AI service was not asked to delete the embedding index")
+					}
+					done = true
+				}
+			}
+		})
+	}
+}
+
+func TestFavoriteProject(t *testing.T) {
+	owner, viewer, stranger := uuid.New(), uuid.New(), uuid.New()
+	type handler = func(c *fiber.Ctx, repo *repository.ProjectRepository) error
+	favorite, unfavorite := FavoriteProject, UnfavoriteProject
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		// calls are made in order; every one should answer wantStatus
+		calls      []handler
+		wantStatus int
+		want       bool
+	}{
+		{name: "favorite", userID: owner, calls: []handler{favorite}, wantStatus: http.StatusOK, want: true},
+		{name: "favoriting twice", userID: owner, calls: []handler{favorite, favorite}, wantStatus: http.StatusOK, want: true},
+		{name: "unfavorite", userID: owner, calls: []handler{favorite, unfavorite}, wantStatus: http.StatusOK},
+		{name: "unfavoriting twice", userID: owner, calls: []handler{favorite, unfavorite, unfavorite}, wantStatus: http.StatusOK},
+		{name: "a project shared with the caller", userID: viewer, calls: []handler{favorite}, wantStatus: http.StatusOK, want: true},
+		{name: "someone else's project", userID: stranger, calls: []handler{favorite}, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			project := createTestProject(t, owner, `[]`)
+			addTestMember(t, project, viewer, repository.MemberViewer)
+
+			for _, call := range tt.calls {
+				resp := serveAs(t, tt.userID.String(), "/projects/:id/favorite", func(c *fiber.Ctx) error {
+					return call(c, repository.NewProject(db))
+				}, newRequest("POST", "/projects/"+project.ID.String()+"/favorite", "", nil))
+				if resp.StatusCode != tt.wantStatus {
+					t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, readBody(t, resp))
+				}
+			}
+
+			var rows int64
+			db.Model(&repository.ProjectFavorite{}).Where("project_id = ? AND user_id = ?", project.ID, tt.userID).Count(&rows)
+			if rows > 1 || (rows == 1) != tt.want {
+				t.Errorf("%d favorite rows, want favorited = %v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestListProjectsFavorites(t *testing.T) {
+	db := useTestDB(t, projectListModels...)
+	owner, other := uuid.New(), uuid.New()
+	plain := createTestProject(t, owner, `[]`)
+	pinned := createTestProject(t, owner, `[]`)
+	shared := createTestProject(t, other, `[]`)
+	addTestMember(t, shared, owner, repository.MemberViewer)
+	repo := repository.NewProject(db)
+	for _, p := range []*repository.Project{pinned, shared} {
+		if err := repo.AddFavorite(p.ID, owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Another user's favorite doesn't show up for the owner
+	if err := repo.AddFavorite(plain.ID, other); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  map[uuid.UUID]bool // listed projects and their is_favorite
+	}{
+		{query: "", want: map[uuid.UUID]bool{plain.ID: false, pinned.ID: true, shared.ID: true}},
+		{query: "&favorites=true", want: map[uuid.UUID]bool{pinned.ID: true, shared.ID: true}},
+	}
+	for _, tt := range tests {
+		t.Run("favorites="+strings.TrimPrefix(tt.query, "&favorites="), func(t *testing.T) {
+			resp := serveAs(t, owner.String(), "/projects", func(c *fiber.Ctx) error {
+				return ListProjects(c, repo)
+			}, newRequest("GET", "/projects?include=graph"+tt.query, "", nil))
+			body := readBody(t, resp)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d: %s", resp.StatusCode, body)
+			}
+			var projects []repository.Project
+			if err := json.Unmarshal(body, &projects); err != nil {
+				t.Fatal(err)
+			}
+			got := map[uuid.UUID]bool{}
+			for i, p := range projects {
+				got[p.ID] = p.IsFavorite
+				if i > 0 && p.IsFavorite && !projects[i-1].IsFavorite {
+					t.Errorf("favorite %s listed after a project that isn't", p.ID)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// nodesOfSize returns a nodes array of exactly size bytes
+func nodesOfSize(t *testing.T, size int) string {
+	t.Helper()
+	const head, tail = `[{"id":"n1","type":"text-input","position":{"x":0,"y":0},"data":{"label":"`, `"}}]`
+	if pad := size - len(head) - len(tail); pad >= 0 {
+		return head + strings.Repeat("x", pad) + tail
+	}
+	t.Fatalf("no nodes array is %d bytes", size)
+	return ""
+}
+
+func TestWorkflowPayloadSizeLimit(t *testing.T) {
+	const max = 200
+	tests := []struct {
+		name       string
+		update     bool
+		body       func(t *testing.T) string
+		wantStatus int
+		wantField  string
+		wantSize   int
+	}{
+		{
+			name:       "create with nodes at the limit",
+			body:       func(t *testing.T) string { return `{"name":"bot","nodes":` + nodesOfSize(t, max) + `}` },
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "create with nodes a byte over the limit",
+			body:       func(t *testing.T) string { return `{"name":"bot","nodes":` + nodesOfSize(t, max+1) + `}` },
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantField:  "nodes",
+			wantSize:   max + 1,
+		},
+		{
+			name: "create with connections over the limit",
+			body: func(t *testing.T) string {
+				return `{"name":"bot","nodes":[],"connections":[` + strings.TrimSuffix(strings.Repeat(`{"id":"c"},`, 20), ",") + `]}`
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantField:  "connections",
+			wantSize:   2 + 20*len(`{"id":"c"},`) - 1,
+		},
+		{
+			name:       "update with nodes at the limit",
+			update:     true,
+			body:       func(t *testing.T) string { return `{"nodes":` + nodesOfSize(t, max) + `}` },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "update with nodes a byte over the limit",
+			update:     true,
+			body:       func(t *testing.T) string { return `{"nodes":` + nodesOfSize(t, max+1) + `}` },
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantField:  "nodes",
+			wantSize:   max + 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_WORKFLOW_PAYLOAD_BYTES", strconv.Itoa(max))
+			db := useTestDB(t, projectListModels...)
+			owner := uuid.New()
+			body := strings.NewReader(tt.body(t))
+			var resp *http.Response
+			var project *repository.Project
+			if tt.update {
+				project = createTestProject(t, owner, `[]`)
+				resp = serveAs(t, owner.String(), "/projects/:id", func(c *fiber.Ctx) error {
+					return UpdateProject(c, repository.NewProject(db))
+				}, newRequest("PUT", "/projects/"+project.ID.String(), "application/json", body))
+			} else {
+				resp = serveAs(t, owner.String(), "/projects", func(c *fiber.Ctx) error {
+					return CreateProject(c, repository.NewProject(db))
+				}, newRequest("POST", "/projects", "application/json", body))
+			}
+			respBody := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, respBody)
+			}
+			if tt.wantStatus != http.StatusRequestEntityTooLarge {
+				return
+			}
+
+			var errResp struct {
+				Code    string `json:"code"`
+				Details struct {
+					Field    string `json:"field"`
+					Size     int    `json:"size"`
+					MaxBytes int    `json:"max_bytes"`
+				} `json:"details"`
+			}
+			if err := json.Unmarshal(respBody, &errResp); err != nil {
+				t.Fatalf("response %s: %v", respBody, err)
+			}
+			if errResp.Code != response.ErrCodePayloadTooLarge {
+				t.Errorf("code = %s, want %s", errResp.Code, response.ErrCodePayloadTooLarge)
+			}
+			if d := errResp.Details; d.Field != tt.wantField || d.Size != tt.wantSize || d.MaxBytes != max {
+				t.Errorf("details = %+v, want field %s size %d max_bytes %d", d, tt.wantField, tt.wantSize, max)
+			}
+
+			var stored int64
+			db.Model(&repository.Project{}).Where("nodes = ?", nodesOfSize(t, max+1)).Count(&stored)
+			if stored != 0 {
+				t.Error("the oversized workflow was stored")
+			}
+		})
+	}
+}
+
+func TestListAdminProjects(t *testing.T) {
+	owner := uuid.NewString()
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		// want are fragments of the page statement
+		want []string
+	}{
+		{name: "first page", query: "", wantStatus: http.StatusOK, want: []string{"JOIN users ON users.id = projects.user_id", "users.email AS owner_email", "LIMIT 50"}},
+		{name: "owner", query: "?user_id=" + owner, wantStatus: http.StatusOK, want: []string{"projects.user_id = '" + owner + "'"}},
+		{name: "status", query: "?status=archived", wantStatus: http.StatusOK, want: []string{"projects.status = 'archived'"}},
+		{name: "created range by date", query: "?from=2026-01-01&to=2026-02-01", wantStatus: http.StatusOK, want: []string{"projects.created_at >= '2026-01-01 00:00:00", "projects.created_at <= '2026-02-01 00:00:00"}},
+		{name: "created range by time", query: "?from=2026-01-01T08:30:00Z", wantStatus: http.StatusOK, want: []string{"projects.created_at >= '2026-01-01 08:30:00"}},
+		{name: "page", query: "?limit=20&offset=40", wantStatus: http.StatusOK, want: []string{"LIMIT 20 OFFSET 40"}},
+		{name: "invalid status", query: "?status=deleted", wantStatus: http.StatusBadRequest},
+		{name: "invalid owner", query: "?user_id=bob", wantStatus: http.StatusBadRequest},
+		{name: "invalid from", query: "?from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "invalid to", query: "?to=2026-13-01", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := repotest.PostgresDryRun(t)
+			resp := serveAs(t, uuid.NewString(), "/admin/projects", func(c *fiber.Ctx) error {
+				return ListAdminProjects(c, repository.NewProject(db))
+			}, newRequest("GET", "/admin/projects"+tt.query, "", nil))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if len(*statements) != 0 {
+					t.Errorf("ran %q for a rejected request", *statements)
+				}
+				return
+			}
+			if len(*statements) != 2 {
+				t.Fatalf("ran %d statements, want the count and the page: %q", len(*statements), *statements)
+			}
+			page := (*statements)[1]
+			for _, fragment := range tt.want {
+				if !strings.Contains(page, fragment) {
+					t.Errorf("page statement is missing %s:\n%s", fragment, page)
+				}
+			}
+		})
+	}
+}
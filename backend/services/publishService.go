@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// slugUnsafe matches runs of characters that can't appear in a public slug
+var slugUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// newPublicSlug builds a URL-safe slug from a project name with a random
+// suffix, e.g. "support-bot-3f9a1c". Names without ASCII letters or digits
+// get a random slug.
+func newPublicSlug(name string) (string, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	base := strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(base) > 40 {
+		base = strings.TrimRight(base[:40], "-")
+	}
+	if base == "" {
+		return "bot-" + hex.EncodeToString(suffix), nil
+	}
+	return base + "-" + hex.EncodeToString(suffix), nil
+}
+
+// PublishProject publishes the current version of a project so the public
+// endpoint runs it; later edits don't change the bot until it is republished
+func PublishProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessOwner)
+	if project == nil {
+		return err
+	}
+	if project.Status == repository.ProjectStatusArchived {
+		return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "project is archived", nil)
+	}
+	if invalid := checkWorkflowSchema(project); invalid != nil {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeInvalidWorkflow, "invalid workflow", invalid)
+	}
+
+	slug, err := newPublicSlug(project.Name)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	published, err := repo.Publish(project.ID.String(), slug)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.publish", "project", published.ID.String(), fiber.Map{"version": published.PublishedVersion, "slug": published.PublicSlug})
+
+	return c.JSON(published)
+}
+
+// UnpublishProject takes a published project offline
+func UnpublishProject(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessOwner)
+	if project == nil {
+		return err
+	}
+
+	unpublished, err := repo.Unpublish(project.ID.String())
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.unpublish", "project", unpublished.ID.String(), nil)
+
+	return c.JSON(unpublished)
+}
+
+// PublicChatResponse is the response of POST /public/bots/:slug/chat
+type PublicChatResponse struct {
+	Response              string `json:"response"`
+	SessionID             string `json:"session_id"`
+	TruncatedHistoryCount int    `json:"truncated_history_count"`
+}
+
+// PublicChat runs the published snapshot of the project behind :slug. It
+// needs no login; the run is billed to and recorded for the project owner.
+func PublicChat(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, snapshot, err := repo.GetPublishedBySlug(c.Params("slug"))
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if project == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "bot not found", nil)
+	}
+
+	var body DemoRequest
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if body.Message == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "message is required", nil)
+	}
+
+	// Run the published graph, never the live draft
+	published := *project
+	published.Nodes = snapshot.Nodes
+	published.Connections = snapshot.Connections
+
+	ownerID := project.UserID.String()
+	aiRequest, truncated, err := prepareChatRun(c.UserContext(), &published, ownerID, body.Message, body.ConversationHistory, body.SessionID)
+	if err != nil {
+		var budgetErr *tokenBudgetError
+		if errors.As(err, &budgetErr) {
+			return budgetErr.respond(c)
+		}
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+	}
+
+	aiResponse, err := callAIChat(c.UserContext(), aiRequest)
+	if err != nil {
+		recordExecution(c.UserContext(), project, ownerID, repository.TriggerPublic, nil, body.Message, nil, err)
+		var svcErr *aiServiceError
+		if errors.As(err, &svcErr) {
+			return response.Error(c, svcErr.StatusCode, "", "AI service error", nil)
+		}
+		return response.Error(c, http.StatusBadGateway, response.ErrCodeUpstream, "bot is unavailable", nil)
+	}
+
+	recordExecution(c.UserContext(), project, ownerID, repository.TriggerPublic, nil, body.Message, aiResponse, nil)
+
+	return c.JSON(PublicChatResponse{
+		Response:              aiResponse.Response,
+		SessionID:             aiRequest.SessionID,
+		TruncatedHistoryCount: truncated,
+	})
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// publishTestNodes is a workflow whose model is told to answer as prompt
+func publishTestNodes(prompt string) string {
+	return `[{"id":"in","type":"text-input","position":{"x":0,"y":0},"data":{}},` +
+		`{"id":"model","type":"ai-model","position":{"x":200,"y":0},"data":{"modelName":"gpt-4o-mini","systemPrompt":"` + prompt + `"}}]`
+}
+
+func TestPublishedSnapshot(t *testing.T) {
+	tests := []struct {
+		name string
+		// steps are "publish", "unpublish" or "edit", which saves the next
+		// numbered prompt: the project starts at v1
+		steps      []string
+		wantStatus int
+		wantPrompt string
+	}{
+		{name: "the published version is served", steps: []string{"publish"}, wantStatus: http.StatusOK, wantPrompt: "v1"},
+		{name: "edits after publishing aren't served", steps: []string{"publish", "edit", "edit"}, wantStatus: http.StatusOK, wantPrompt: "v1"},
+		{name: "republishing serves the edits", steps: []string{"publish", "edit", "publish", "edit"}, wantStatus: http.StatusOK, wantPrompt: "v2"},
+		{name: "an unpublished bot is gone", steps: []string{"publish", "unpublish"}, wantStatus: http.StatusNotFound},
+		{name: "a bot published again after unpublishing", steps: []string{"publish", "unpublish", "edit", "publish"}, wantStatus: http.StatusOK, wantPrompt: "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompts := make(chan string, 1)
+			ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/chat" {
+					http.NotFound(w, r)
+					return
+				}
+				var req DemoChatRequest
+				json.NewDecoder(r.Body).Decode(&req)
+				for _, node := range req.Workflow.Nodes {
+					if node["type"] == "ai-model" {
+						prompt, _ := nodeData(node)["systemPrompt"].(string)
+						prompts <- prompt
+					}
+				}
+				json.NewEncoder(w).Encode(DemoChatResponse{Response: "hello"})
+			}))
+			defer ai.Close()
+			t.Setenv("AI_SERVICE_URL", ai.URL)
+
+			db := useTestDB(t, append(projectListModels, &repository.UserAPIKey{}, &repository.Execution{})...)
+			repo := repository.NewProject(db)
+			owner := uuid.New()
+			encrypted, err := EncryptAPIKey("sk-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Create(&repository.UserAPIKey{UserID: owner, Label: "Default", EncryptedKey: encrypted, IsDefault: true}).Error; err != nil {
+				t.Fatalf("create key: %v", err)
+			}
+			project := createTestProject(t, owner, publishTestNodes("v1"))
+			id := project.ID.String()
+
+			var slug string
+			edits := 1
+			for _, step := range tt.steps {
+				var handler fiber.Handler
+				var req *http.Request
+				switch step {
+				case "publish":
+					handler = func(c *fiber.Ctx) error { return PublishProject(c, repo) }
+					req = newRequest("POST", "/projects/"+id, "", nil)
+				case "unpublish":
+					handler = func(c *fiber.Ctx) error { return UnpublishProject(c, repo) }
+					req = newRequest("POST", "/projects/"+id, "", nil)
+				case "edit":
+					edits++
+					handler = func(c *fiber.Ctx) error { return UpdateProject(c, repo) }
+					req = newRequest("PUT", "/projects/"+id, "application/json", strings.NewReader(`{"nodes":`+publishTestNodes(fmt.Sprintf("v%d", edits))+`}`))
+				}
+				resp := serveAs(t, owner.String(), "/projects/:id", handler, req)
+				body := readBody(t, resp)
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("%s: status = %d: %s", step, resp.StatusCode, body)
+				}
+				if step != "publish" {
+					continue
+				}
+				var published repository.Project
+				if err := json.Unmarshal(body, &published); err != nil {
+					t.Fatalf("publish response %s: %v", body, err)
+				}
+				if published.PublicSlug == nil || published.PublishedAt == nil || published.PublishedVersion == nil {
+					t.Fatalf("publish response %s is missing the deploy metadata", body)
+				}
+				if *published.PublishedVersion != published.Version {
+					t.Errorf("published version %d, want the current version %d", *published.PublishedVersion, published.Version)
+				}
+				// The bot keeps its URL when republished
+				if slug != "" && *published.PublicSlug != slug {
+					t.Errorf("republishing changed the slug from %s to %s", slug, *published.PublicSlug)
+				}
+				slug = *published.PublicSlug
+			}
+
+			resp := serveAs(t, "", "/public/bots/:slug/chat", func(c *fiber.Ctx) error {
+				return PublicChat(c, repo)
+			}, newRequest("POST", "/public/bots/"+slug+"/chat", "application/json", strings.NewReader(`{"message":"hi"}`)))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("public chat status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			select {
+			case prompt := <-prompts:
+				if prompt != tt.wantPrompt {
+					t.Errorf("public chat ran the %s workflow, want %s", prompt, tt.wantPrompt)
+				}
+			default:
+				t.Fatal("public chat didn't call the AI service")
+			}
+
+			// The run is recorded for the owner
+			var runs int64
+			db.Model(&repository.Execution{}).Where("project_id = ? AND user_id = ? AND trigger = ?", project.ID, owner, repository.TriggerPublic).Count(&runs)
+			if runs != 1 {
+				t.Errorf("recorded %d public runs, want 1", runs)
+			}
+		})
+	}
+}
+
+func TestNewPublicSlug(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // pattern of the slug
+	}{
+		{name: "Support Bot", want: `^support-bot-[0-9a-f]{6}$`},
+		{name: "  HR / Leave & Benefits!! ", want: `^hr-leave-benefits-[0-9a-f]{6}$`},
+		{name: "แชทบอท", want: `^bot-[0-9a-f]{6}$`},
+		{name: "", want: `^bot-[0-9a-f]{6}$`},
+		{name: strings.Repeat("a", 39) + " tail", want: `^a{39}-[0-9a-f]{6}$`},
+		{name: strings.Repeat("ab", 30), want: `^(ab){20}-[0-9a-f]{6}$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slug, err := newPublicSlug(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !regexp.MustCompile(tt.want).MatchString(slug) {
+				t.Errorf("newPublicSlug(%q) = %q, want it to match %s", tt.name, slug, tt.want)
+			}
+			if again, _ := newPublicSlug(tt.name); again == slug {
+				t.Errorf("newPublicSlug(%q) returned %q twice", tt.name, slug)
+			}
+		})
+	}
+}
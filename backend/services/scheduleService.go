@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/tracing"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// SchedulePayload is the request body for creating or updating a schedule
+type SchedulePayload struct {
+	CronExpression *string `json:"cron_expression"`
+	Enabled        *bool   `json:"enabled"`
+	InputMessage   *string `json:"input_message"`
+}
+
+// nextRun parses a standard 5-field cron expression (or a descriptor such as
+// @hourly) and returns its next occurrence after from, in UTC.
+func nextRun(expr string, from time.Time) (time.Time, error) {
+	sched, err := cron.ParseStandard(strings.TrimSpace(expr))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression: %w", err)
+	}
+	return sched.Next(from.UTC()), nil
+}
+
+// CreateSchedule adds a cron schedule to a project
+func CreateSchedule(c *fiber.Ctx, repo *repository.ProjectRepository, scheduleRepo *repository.ScheduleRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	var body SchedulePayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if body.CronExpression == nil || strings.TrimSpace(*body.CronExpression) == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "cron_expression is required", nil)
+	}
+	if body.InputMessage == nil || *body.InputMessage == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "input_message is required", nil)
+	}
+
+	next, err := nextRun(*body.CronExpression, time.Now())
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+	}
+
+	schedule := repository.Schedule{
+		ProjectID:      project.ID,
+		CronExpression: strings.TrimSpace(*body.CronExpression),
+		Enabled:        true,
+		InputMessage:   *body.InputMessage,
+		NextRunAt:      &next,
+	}
+	if body.Enabled != nil {
+		schedule.Enabled = *body.Enabled
+	}
+
+	created, err := scheduleRepo.Create(&schedule)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "schedule.create", "schedule", created.ID.String(), fiber.Map{"project_id": project.ID, "cron_expression": created.CronExpression})
+
+	return c.Status(http.StatusCreated).JSON(created)
+}
+
+// ListSchedules returns the schedules of a project
+func ListSchedules(c *fiber.Ctx, repo *repository.ProjectRepository, scheduleRepo *repository.ScheduleRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+
+	schedules, err := scheduleRepo.ListByProject(project.ID.String())
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(schedules)
+}
+
+// UpdateSchedule changes a schedule's expression, message or enabled flag
+func UpdateSchedule(c *fiber.Ctx, repo *repository.ProjectRepository, scheduleRepo *repository.ScheduleRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	schedule, err := scheduleRepo.GetByID(project.ID.String(), c.Params("schedId"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "schedule not found", nil)
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	var body SchedulePayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+
+	diff := map[string]fieldChange{}
+	if body.CronExpression != nil {
+		diff["cron_expression"] = fieldChange{From: schedule.CronExpression, To: *body.CronExpression}
+		schedule.CronExpression = strings.TrimSpace(*body.CronExpression)
+	}
+	if body.InputMessage != nil {
+		if *body.InputMessage == "" {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "input_message cannot be empty", nil)
+		}
+		schedule.InputMessage = *body.InputMessage
+	}
+	if body.Enabled != nil {
+		diff["enabled"] = fieldChange{From: schedule.Enabled, To: *body.Enabled}
+		schedule.Enabled = *body.Enabled
+	}
+
+	// Recompute the next run whenever the timing may have changed
+	next, err := nextRun(schedule.CronExpression, time.Now())
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+	}
+	schedule.NextRunAt = &next
+
+	updated, err := scheduleRepo.Update(schedule)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "schedule.update", "schedule", updated.ID.String(), diff)
+
+	return c.JSON(updated)
+}
+
+// DeleteSchedule removes a schedule from a project
+func DeleteSchedule(c *fiber.Ctx, repo *repository.ProjectRepository, scheduleRepo *repository.ScheduleRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	schedule, err := scheduleRepo.GetByID(project.ID.String(), c.Params("schedId"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "schedule not found", nil)
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	if err := scheduleRepo.Delete(project.ID.String(), schedule.ID.String()); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "schedule.delete", "schedule", schedule.ID.String(), fiber.Map{"project_id": project.ID})
+
+	return c.JSON(response.MessageResponse{Message: "schedule deleted"})
+}
+
+// RunScheduler checks for due schedules every interval and runs them. It is
+// started once from main and runs for the lifetime of the process.
+func RunScheduler(scheduleRepo *repository.ScheduleRepository, projectRepo *repository.ProjectRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		runDueSchedules(scheduleRepo, projectRepo, time.Now())
+	}
+}
+
+// runDueSchedules runs every schedule whose next run is at or before now
+func runDueSchedules(scheduleRepo *repository.ScheduleRepository, projectRepo *repository.ProjectRepository, now time.Time) {
+	due, err := scheduleRepo.ListDue(now)
+	if err != nil {
+		log.Printf("[scheduler] failed to list due schedules: %v", err)
+		return
+	}
+
+	for i := range due {
+		schedule := &due[i]
+
+		next, err := nextRun(schedule.CronExpression, now)
+		if err != nil {
+			log.Printf("[scheduler] schedule %s has an invalid expression, skipping: %v", schedule.ID, err)
+			continue
+		}
+
+		// Advance before running so a slow AI call is never picked up twice
+		claimed, err := scheduleRepo.Claim(schedule, now, next)
+		if err != nil {
+			log.Printf("[scheduler] failed to claim schedule %s: %v", schedule.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		go runSchedule(projectRepo, schedule)
+	}
+}
+
+// runSchedule executes one occurrence of a schedule as the project owner
+func runSchedule(projectRepo *repository.ProjectRepository, schedule *repository.Schedule) {
+	ctx, span := tracing.Start(context.Background(), "RunSchedule", attribute.String("schedule.id", schedule.ID.String()))
+	defer span.End()
+
+	project, err := projectRepo.WithContext(ctx).GetByID(schedule.ProjectID.String())
+	if err != nil {
+		log.Printf("[scheduler] project %s for schedule %s not found: %v", schedule.ProjectID, schedule.ID, err)
+		return
+	}
+	if project.Status == repository.ProjectStatusArchived {
+		log.Printf("[scheduler] project %s is archived, skipping schedule %s", project.ID, schedule.ID)
+		return
+	}
+
+	ownerID := project.UserID.String()
+	var aiResponse *DemoChatResponse
+	aiRequest, _, err := prepareChatRun(ctx, project, ownerID, schedule.InputMessage, nil, "")
+	if err == nil {
+		aiResponse, err = callAIChat(ctx, aiRequest)
+	}
+	execution := recordExecution(ctx, project, ownerID, repository.TriggerSchedule, &schedule.ID, schedule.InputMessage, aiResponse, err)
+	if err != nil {
+		log.Printf("[scheduler] schedule %s run failed: %v", schedule.ID, err)
+		return
+	}
+	publishDemoCompleted(project, ownerID, execution, aiResponse)
+}
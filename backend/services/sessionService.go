@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// EncryptRefreshToken encrypts a refresh token for storage and returns the key version used
+func EncryptRefreshToken(token string) (string, int, error) {
+	encrypted, err := EncryptAPIKey(token)
+	if err != nil {
+		return "", 0, err
+	}
+	return encrypted, EncryptionKeyVersion(), nil
+}
+
+// DecryptRefreshToken returns the plaintext refresh token of a session. Tokens
+// from before encryption (version 0) are returned as stored; tokens encrypted
+// with an older key are decrypted with OLD_ENCRYPTION_KEY.
+func DecryptRefreshToken(sess *repository.Session) (string, error) {
+	return decryptStoredToken(sess.RefreshToken, sess.EncryptionKeyVersion)
+}
+
+// decryptStoredToken decrypts a token stored by EncryptRefreshToken with the
+// key of keyVersion
+func decryptStoredToken(stored string, keyVersion int) (string, error) {
+	switch keyVersion {
+	case 0:
+		return stored, nil
+	case EncryptionKeyVersion():
+		return DecryptAPIKey(stored)
+	default:
+		return DecryptWithOldKey(stored)
+	}
+}
+
+// ReencryptSessionsResponse is the response of POST /admin/reencrypt-sessions
+type ReencryptSessionsResponse struct {
+	KeyVersion  int    `json:"key_version"`
+	Reencrypted int    `json:"reencrypted"`
+	Failed      int    `json:"failed"`
+	Message     string `json:"message"`
+}
+
+// ReencryptSessions re-encrypts every stored refresh token that was not
+// encrypted with the current key, after ENCRYPTION_KEY has been rotated.
+func ReencryptSessions(c *fiber.Ctx, repo *repository.SessionRepository) error {
+	current := EncryptionKeyVersion()
+	reencrypted, failed := 0, 0
+
+	err := repo.FindStaleKeyVersion(current, 100, func(batch []repository.Session) error {
+		for i := range batch {
+			sess := &batch[i]
+			plaintext, err := DecryptRefreshToken(sess)
+			if err == nil {
+				var encrypted string
+				if encrypted, err = EncryptAPIKey(plaintext); err == nil {
+					// Go through the store so a cached copy is refreshed too
+					sess.RefreshToken, sess.EncryptionKeyVersion = encrypted, current
+					err = repository.Sessions().Set(sess)
+				}
+			}
+			if err != nil {
+				log.Printf("[sessions] failed to re-encrypt session %s (key version %d): %v", sess.ID, sess.EncryptionKeyVersion, err)
+				failed++
+				continue
+			}
+			reencrypted++
+		}
+		return nil
+	})
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "session.reencrypt", "session", "", fiber.Map{"key_version": current, "reencrypted": reencrypted, "failed": failed})
+
+	return c.JSON(ReencryptSessionsResponse{
+		KeyVersion:  current,
+		Reencrypted: reencrypted,
+		Failed:      failed,
+		Message:     fmt.Sprintf("re-encrypted %d sessions", reencrypted),
+	})
+}
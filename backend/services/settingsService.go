@@ -0,0 +1,73 @@
+package services
+
+import (
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxSettingsTokens       = 32000
+	maxSettingsPromptLen    = 10000
+	maxSettingsModelNameLen = 100
+)
+
+// validateProjectSettings returns a message for every out-of-range setting
+func validateProjectSettings(s repository.ProjectSettings) []ValidationError {
+	errs := []ValidationError{}
+	if s.Temperature != nil && (*s.Temperature < 0 || *s.Temperature > 2) {
+		errs = append(errs, ValidationError{Path: "temperature", Message: "temperature must be between 0 and 2"})
+	}
+	if s.MaxTokens < 0 || s.MaxTokens > maxSettingsTokens {
+		errs = append(errs, ValidationError{Path: "max_tokens", Message: "max_tokens must be between 0 (unset) and 32000"})
+	}
+	if len(s.DefaultModel) > maxSettingsModelNameLen {
+		errs = append(errs, ValidationError{Path: "default_model", Message: "default_model is too long"})
+	}
+	if len(s.SystemPrompt) > maxSettingsPromptLen {
+		errs = append(errs, ValidationError{Path: "system_prompt", Message: "system_prompt must be at most 10000 characters"})
+	}
+	return errs
+}
+
+// GetProjectSettings returns the project-wide model defaults
+func GetProjectSettings(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo.WithContext(c.UserContext()), accessViewer)
+	if project == nil {
+		return err
+	}
+	return c.JSON(project.Settings)
+}
+
+// UpdateProjectSettings replaces the project-wide model defaults
+func UpdateProjectSettings(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	repo = repo.WithContext(c.UserContext())
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	var body repository.ProjectSettings
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	body.DefaultModel = strings.TrimSpace(body.DefaultModel)
+	if errs := validateProjectSettings(body); len(errs) > 0 {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeValidation, "invalid settings", fiber.Map{"errors": errs})
+	}
+
+	updated, err := repo.UpdateLocked(project.ID.String(), func(p *repository.Project) error {
+		p.Settings = body
+		return nil
+	})
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.settings_update", "project", project.ID.String(), fieldChange{From: project.Settings, To: updated.Settings})
+
+	return c.JSON(updated.Settings)
+}
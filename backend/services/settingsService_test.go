@@ -0,0 +1,101 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestUpdateProjectSettings(t *testing.T) {
+	owner, viewer := uuid.New(), uuid.New()
+	tests := []struct {
+		name       string
+		userID     uuid.UUID
+		body       string
+		wantStatus int
+		wantPaths  []string
+		want       string
+	}{
+		{
+			name:       "all settings",
+			userID:     owner,
+			body:       `{"default_model":" gpt-4o-mini ","temperature":0.3,"max_tokens":1024,"system_prompt":"Answer in Thai"}`,
+			wantStatus: http.StatusOK,
+			want:       `{"default_model":"gpt-4o-mini","temperature":0.3,"max_tokens":1024,"system_prompt":"Answer in Thai"}`,
+		},
+		{name: "temperature at the bounds", userID: owner, body: `{"temperature":2}`, wantStatus: http.StatusOK, want: `{"temperature":2}`},
+		{name: "zero temperature is kept", userID: owner, body: `{"temperature":0}`, wantStatus: http.StatusOK, want: `{"temperature":0}`},
+		{name: "clearing the settings", userID: owner, body: `{}`, wantStatus: http.StatusOK, want: `{}`},
+		{name: "temperature too high", userID: owner, body: `{"temperature":2.1}`, wantStatus: http.StatusUnprocessableEntity, wantPaths: []string{"temperature"}},
+		{name: "negative temperature", userID: owner, body: `{"temperature":-0.1}`, wantStatus: http.StatusUnprocessableEntity, wantPaths: []string{"temperature"}},
+		{name: "too many tokens", userID: owner, body: `{"max_tokens":32001}`, wantStatus: http.StatusUnprocessableEntity, wantPaths: []string{"max_tokens"}},
+		{name: "negative tokens", userID: owner, body: `{"max_tokens":-1}`, wantStatus: http.StatusUnprocessableEntity, wantPaths: []string{"max_tokens"}},
+		{
+			name:       "every invalid setting is listed",
+			userID:     owner,
+			body:       `{"default_model":"` + strings.Repeat("m", 101) + `","temperature":3,"max_tokens":99999,"system_prompt":"` + strings.Repeat("p", 10001) + `"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantPaths:  []string{"temperature", "max_tokens", "default_model", "system_prompt"},
+		},
+		{name: "viewer", userID: viewer, body: `{"temperature":1}`, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			project := createTestProject(t, owner, `[]`)
+			addTestMember(t, project, viewer, repository.MemberViewer)
+
+			resp := serveAs(t, tt.userID.String(), "/projects/:id/settings", func(c *fiber.Ctx) error {
+				return UpdateProjectSettings(c, repository.NewProject(db))
+			}, newRequest("PUT", "/projects/"+project.ID.String()+"/settings", "application/json", strings.NewReader(tt.body)))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			stored, err := repository.NewProject(db).GetByID(project.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved, _ := json.Marshal(stored.Settings)
+			if tt.wantStatus != http.StatusOK {
+				if string(saved) != `{}` {
+					t.Errorf("stored settings = %s after a rejected update", saved)
+				}
+			} else if string(saved) != tt.want {
+				t.Errorf("stored settings = %s, want %s", saved, tt.want)
+			}
+
+			if tt.wantStatus != http.StatusUnprocessableEntity {
+				return
+			}
+			var errResp struct {
+				Code    string `json:"code"`
+				Details struct {
+					Errors []ValidationError `json:"errors"`
+				} `json:"details"`
+			}
+			if err := json.Unmarshal(body, &errResp); err != nil {
+				t.Fatalf("response %s: %v", body, err)
+			}
+			if errResp.Code != response.ErrCodeValidation {
+				t.Errorf("code = %s, want %s", errResp.Code, response.ErrCodeValidation)
+			}
+			var paths []string
+			for _, e := range errResp.Details.Errors {
+				paths = append(paths, e.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("errors at %v, want %v", paths, tt.wantPaths)
+			}
+		})
+	}
+}
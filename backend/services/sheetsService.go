@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	sheetsapi "google.golang.org/api/sheets/v4"
+)
+
+// sheetsTimeout bounds a single call to the Sheets API
+const sheetsTimeout = 30 * time.Second
+
+// SheetsReadRequest is the body of POST /projects/:id/sheets/read
+type SheetsReadRequest struct {
+	SpreadsheetID string `json:"spreadsheet_id"`
+	Range         string `json:"range"` // A1 notation, e.g. Sheet1!A1:C10
+}
+
+// SheetsWriteRequest is the body of POST /projects/:id/sheets/write
+type SheetsWriteRequest struct {
+	SpreadsheetID string          `json:"spreadsheet_id"`
+	Range         string          `json:"range"`
+	Values        [][]interface{} `json:"values"`
+}
+
+// SheetsWriteResult reports what a write to a spreadsheet changed
+type SheetsWriteResult struct {
+	UpdatedRange   string `json:"updated_range"`
+	UpdatedRows    int    `json:"updated_rows"`
+	UpdatedColumns int    `json:"updated_columns"`
+	UpdatedCells   int    `json:"updated_cells"`
+}
+
+// errGoogleNotLinked is returned when the project owner never signed in with
+// Google, so there is no token to call the Sheets API with
+var errGoogleNotLinked = errors.New("the project owner has no linked Google account")
+
+// errSheetsNotConnected is returned when the project owner's Google token
+// doesn't carry the Sheets scope, which is only requested when they connect
+// Google Sheets
+var errSheetsNotConnected = errors.New("the project owner has not connected Google Sheets")
+
+// sheetsError is a failed Sheets API call, with the status Google answered
+type sheetsError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *sheetsError) Error() string {
+	return fmt.Sprintf("Google Sheets error (%d): %s", e.StatusCode, e.Message)
+}
+
+// GoogleSheetsService reads and writes spreadsheets on behalf of one user,
+// with the Google token stored on their UserIdentity
+type GoogleSheetsService struct {
+	api *sheetsapi.Service
+}
+
+// NewGoogleSheetsService returns a GoogleSheetsService acting as userID. An
+// expired access token is refreshed and the fresh one stored. It fails with
+// errGoogleNotLinked if the user has no Google identity.
+func NewGoogleSheetsService(ctx context.Context, userID uuid.UUID) (*GoogleSheetsService, error) {
+	identityRepo := repository.NewUserIdentity(repository.GetDB())
+	identities, err := identityRepo.ListByUser(userID.String())
+	if err != nil {
+		return nil, err
+	}
+	var identity *repository.UserIdentity
+	for i := range identities {
+		if identities[i].Provider == repository.ProviderGoogle {
+			identity = &identities[i]
+			break
+		}
+	}
+	if identity == nil {
+		return nil, errGoogleNotLinked
+	}
+
+	token, err := identityToken(identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt Google token: %w", err)
+	}
+	fresh, err := googleTokenConfig().TokenSource(ctx, token).Token()
+	if err != nil {
+		return nil, &sheetsError{StatusCode: http.StatusUnauthorized, Message: "Google authorization has expired; connect Google Sheets again"}
+	}
+	if fresh.AccessToken != token.AccessToken {
+		storeIdentityToken(identityRepo, identity, fresh)
+	}
+
+	client := oauth2.NewClient(ctx, oauth2.StaticTokenSource(fresh))
+	client.Timeout = sheetsTimeout
+	api, err := sheetsapi.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, err
+	}
+	return &GoogleSheetsService{api: api}, nil
+}
+
+// googleTokenConfig returns the OAuth config tokens of Google identities were
+// issued with, enough to refresh them
+func googleTokenConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     strings.TrimSpace(os.Getenv("CLIENT_ID")),
+		ClientSecret: strings.TrimSpace(os.Getenv("CLIENT_SECRET")),
+		Endpoint:     google.Endpoint,
+	}
+}
+
+// identityToken decrypts the tokens stored on an identity
+func identityToken(identity *repository.UserIdentity) (*oauth2.Token, error) {
+	token := &oauth2.Token{}
+	var err error
+	if token.AccessToken, err = decryptStoredToken(identity.AccessTokenEncrypted, identity.EncryptionKeyVersion); err != nil {
+		return nil, err
+	}
+	if identity.RefreshTokenEncrypted != "" {
+		if token.RefreshToken, err = decryptStoredToken(identity.RefreshTokenEncrypted, identity.EncryptionKeyVersion); err != nil {
+			return nil, err
+		}
+	}
+	if identity.ExpiresAt != nil {
+		token.Expiry = *identity.ExpiresAt
+	}
+	return token, nil
+}
+
+// storeIdentityToken saves a refreshed token on an identity. oauth2 carries
+// the refresh token over into the refreshed one, so both are re-encrypted with
+// the current key. A failure is only logged; the token is refreshed again next
+// time.
+func storeIdentityToken(repo *repository.UserIdentityRepository, identity *repository.UserIdentity, token *oauth2.Token) {
+	accessToken, keyVersion, err := EncryptRefreshToken(token.AccessToken)
+	if err != nil {
+		log.Printf("[sheets] failed to encrypt refreshed token of user %s: %v", identity.UserID, err)
+		return
+	}
+	var refreshToken string
+	if token.RefreshToken != "" {
+		if refreshToken, _, err = EncryptRefreshToken(token.RefreshToken); err != nil {
+			log.Printf("[sheets] failed to encrypt refreshed token of user %s: %v", identity.UserID, err)
+			return
+		}
+	}
+	identity.AccessTokenEncrypted = accessToken
+	identity.RefreshTokenEncrypted = refreshToken
+	identity.EncryptionKeyVersion = keyVersion
+	identity.ExpiresAt = nil
+	if !token.Expiry.IsZero() {
+		t := token.Expiry
+		identity.ExpiresAt = &t
+	}
+	if err := repo.UpdateTokens(identity); err != nil {
+		log.Printf("[sheets] failed to store refreshed token of user %s: %v", identity.UserID, err)
+	}
+}
+
+// Read returns the values of a range, row by row. Trailing empty rows and
+// cells are left out, as the Sheets API does.
+func (s *GoogleSheetsService) Read(ctx context.Context, spreadsheetID, a1Range string) ([][]interface{}, error) {
+	resp, err := s.api.Spreadsheets.Values.Get(spreadsheetID, a1Range).Context(ctx).Do()
+	if err != nil {
+		return nil, sheetsAPIError(err)
+	}
+	if resp.Values == nil {
+		return [][]interface{}{}, nil
+	}
+	return resp.Values, nil
+}
+
+// Write overwrites a range with values, parsed as if typed into the sheet
+func (s *GoogleSheetsService) Write(ctx context.Context, spreadsheetID, a1Range string, values [][]interface{}) (*SheetsWriteResult, error) {
+	resp, err := s.api.Spreadsheets.Values.Update(spreadsheetID, a1Range, &sheetsapi.ValueRange{Range: a1Range, Values: values}).
+		ValueInputOption("USER_ENTERED").Context(ctx).Do()
+	if err != nil {
+		return nil, sheetsAPIError(err)
+	}
+	return &SheetsWriteResult{
+		UpdatedRange:   resp.UpdatedRange,
+		UpdatedRows:    int(resp.UpdatedRows),
+		UpdatedColumns: int(resp.UpdatedColumns),
+		UpdatedCells:   int(resp.UpdatedCells),
+	}, nil
+}
+
+// sheetsAPIError turns an error of the Sheets client into a *sheetsError
+// carrying Google's status and message, or errSheetsNotConnected when the
+// token lacks the Sheets scope
+func sheetsAPIError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return &sheetsError{StatusCode: http.StatusBadGateway, Message: err.Error()}
+	}
+	if apiErr.Code == http.StatusForbidden {
+		for _, item := range apiErr.Errors {
+			if item.Reason == "insufficientPermissions" {
+				return errSheetsNotConnected
+			}
+		}
+		if strings.Contains(apiErr.Message, "insufficient authentication scopes") {
+			return errSheetsNotConnected
+		}
+	}
+	message := apiErr.Message
+	if message == "" {
+		message = http.StatusText(apiErr.Code)
+	}
+	return &sheetsError{StatusCode: apiErr.Code, Message: message}
+}
+
+// writeSheetsError maps a failed Sheets call to a response. Google's auth
+// failures become 403, since the caller's own session is fine; anything
+// Google doesn't blame on the request becomes 502.
+func writeSheetsError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errGoogleNotLinked) {
+		return response.Error(c, http.StatusConflict, response.ErrCodeGoogleAccountNotLinked, err.Error(), nil)
+	}
+	if errors.Is(err, errSheetsNotConnected) {
+		return response.Error(c, http.StatusConflict, response.ErrCodeGoogleSheetsNotConnected, err.Error(), nil)
+	}
+	var sheetsErr *sheetsError
+	if !errors.As(err, &sheetsErr) {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	switch sheetsErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, sheetsErr.Message, nil)
+	case http.StatusNotFound:
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, sheetsErr.Message, nil)
+	case http.StatusBadRequest:
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, sheetsErr.Message, nil)
+	default:
+		return response.Error(c, http.StatusBadGateway, response.ErrCodeUpstream, sheetsErr.Message, fiber.Map{"status": sheetsErr.StatusCode})
+	}
+}
+
+// ReadSheet returns the values of a range of a spreadsheet as a 2D array,
+// read with the project owner's Google account
+func ReadSheet(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	var body SheetsReadRequest
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if body.SpreadsheetID == "" || body.Range == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "spreadsheet_id and range are required", nil)
+	}
+
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+	sheets, err := NewGoogleSheetsService(c.UserContext(), project.UserID)
+	if err != nil {
+		return writeSheetsError(c, err)
+	}
+	values, err := sheets.Read(c.UserContext(), body.SpreadsheetID, body.Range)
+	if err != nil {
+		return writeSheetsError(c, err)
+	}
+	return c.JSON(values)
+}
+
+// WriteSheet overwrites a range of a spreadsheet with the project owner's
+// Google account
+func WriteSheet(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	var body SheetsWriteRequest
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if body.SpreadsheetID == "" || body.Range == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "spreadsheet_id and range are required", nil)
+	}
+	if len(body.Values) == 0 {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "values are required", nil)
+	}
+
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+	sheets, err := NewGoogleSheetsService(c.UserContext(), project.UserID)
+	if err != nil {
+		return writeSheetsError(c, err)
+	}
+	result, err := sheets.Write(c.UserContext(), body.SpreadsheetID, body.Range, body.Values)
+	if err != nil {
+		return writeSheetsError(c, err)
+	}
+	RecordAudit(c, "project.sheet_write", "project", project.ID.String(), fiber.Map{
+		"spreadsheet_id": body.SpreadsheetID,
+		"range":          result.UpdatedRange,
+		"updated_cells":  result.UpdatedCells,
+	})
+	return c.JSON(result)
+}
+
+// sheetNodeRange returns the range a google-sheets node reads: its range,
+// if set, within its sheet, or the whole sheet
+func sheetNodeRange(data map[string]interface{}) string {
+	sheet, _ := data["sheetName"].(string)
+	a1Range, _ := data["range"].(string)
+	sheet, a1Range = strings.TrimSpace(sheet), strings.TrimSpace(a1Range)
+	switch {
+	case a1Range == "":
+		return sheet
+	case sheet == "" || strings.Contains(a1Range, "!"):
+		return a1Range
+	default:
+		return "'" + strings.ReplaceAll(sheet, "'", "''") + "'!" + a1Range
+	}
+}
+
+// attachSheetValues reads the spreadsheet of every configured google-sheets
+// node with the project owner's Google account and stores the rows under the
+// node's "values", so the AI service gets the sheet as context without
+// calling Google itself
+func attachSheetValues(ctx context.Context, project *repository.Project, nodes []map[string]interface{}) error {
+	var sheets *GoogleSheetsService
+	for i, node := range nodes {
+		if t, _ := node["type"].(string); t != "google-sheets" {
+			continue
+		}
+		data := nodeData(node)
+		spreadsheetID, _ := data["spreadsheetId"].(string)
+		a1Range := sheetNodeRange(data)
+		if strings.TrimSpace(spreadsheetID) == "" || a1Range == "" {
+			continue
+		}
+		if sheets == nil {
+			var err error
+			if sheets, err = NewGoogleSheetsService(ctx, project.UserID); err != nil {
+				return err
+			}
+		}
+		values, err := sheets.Read(ctx, strings.TrimSpace(spreadsheetID), a1Range)
+		if err != nil {
+			return err
+		}
+		data["values"] = values
+		nodes[i]["data"] = data
+	}
+	return nil
+}
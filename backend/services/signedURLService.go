@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/storage"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Signed file URLs let the AI service download documents over HTTP when it
+// doesn't share a filesystem with the backend. A token names one document
+// and when it stops being valid, signed with HMAC-SHA256:
+//
+//	base64url("<projectID>:<documentID>:<unix expiry>") "." base64url(mac)
+//
+// /api/files/:token serves the document without a login.
+
+var (
+	errFileTokenInvalid = errors.New("invalid file token")
+	errFileTokenExpired = errors.New("file token has expired")
+)
+
+// fileURLKey returns the key file tokens are signed with: FILE_URL_SECRET,
+// or the encryption key when it is not set
+func fileURLKey() []byte {
+	if secret := os.Getenv("FILE_URL_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return encryptionKey
+}
+
+// getBackendURL returns the URL the AI service reaches the backend at
+func getBackendURL() string {
+	url := os.Getenv("BACKEND_URL")
+	if url == "" {
+		url = "http://localhost:8080"
+	}
+	return strings.TrimRight(url, "/")
+}
+
+// deliverDocumentsByURL reports whether the AI service gets documents as
+// download links even from local storage (DOCS_DELIVERY=url) instead of
+// as filesystem paths
+func deliverDocumentsByURL() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("DOCS_DELIVERY")), "url")
+}
+
+// signFileToken returns a token granting access to a document until expiry
+func signFileToken(projectID, documentID string, expiry time.Time) string {
+	payload := []byte(projectID + ":" + documentID + ":" + strconv.FormatInt(expiry.Unix(), 10))
+	mac := hmac.New(sha256.New, fileURLKey())
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyFileToken checks a token's signature and expiry and returns the
+// document it grants access to
+func verifyFileToken(token string, now time.Time) (projectID, documentID string, err error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", errFileTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", "", errFileTokenInvalid
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return "", "", errFileTokenInvalid
+	}
+	mac := hmac.New(sha256.New, fileURLKey())
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return "", "", errFileTokenInvalid
+	}
+
+	parts := strings.Split(string(payload), ":")
+	if len(parts) != 3 {
+		return "", "", errFileTokenInvalid
+	}
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", "", errFileTokenInvalid
+	}
+	if now.Unix() > expiry {
+		return "", "", errFileTokenExpired
+	}
+	return parts[0], parts[1], nil
+}
+
+// signedFileURL returns a backend URL that serves a document until expiry
+func signedFileURL(projectID, documentID string, expiry time.Time) string {
+	return getBackendURL() + "/api/files/" + signFileToken(projectID, documentID, expiry)
+}
+
+// documentDownloadURL returns a link the AI service can fetch a document
+// from for documentURLTTL: presigned by an object store, or signed by the
+// backend for local files
+func documentDownloadURL(ctx context.Context, doc *repository.Document) (string, error) {
+	if _, ok := storage.LocalPath(documentStorage, doc.StoredPath); ok {
+		return signedFileURL(doc.ProjectID.String(), doc.ID, time.Now().Add(documentURLTTL)), nil
+	}
+	url, err := documentStorage.SignedURL(ctx, doc.StoredPath, documentURLTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign document %s: %w", doc.ID, err)
+	}
+	return url, nil
+}
+
+// SignedURL is the response of GET /projects/:id/documents/:docId/signed-url
+type SignedURL struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"` // RFC 3339
+}
+
+// GetDocumentSignedURL returns a time-limited link to a document that works
+// without a login
+func GetDocumentSignedURL(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+	doc, err := loadDocument(c, documentRepo(c), project)
+	if doc == nil {
+		return err
+	}
+	if doc.DeletedAt != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document is in the trash", nil)
+	}
+
+	expiry := time.Now().Add(documentURLTTL)
+	return c.JSON(SignedURL{
+		URL:       signedFileURL(project.ID.String(), doc.ID, expiry),
+		ExpiresAt: expiry.UTC().Format(time.RFC3339),
+	})
+}
+
+// ServeSignedFile serves the document named by a file token. Tampered and
+// expired tokens are refused with 403.
+func ServeSignedFile(c *fiber.Ctx) error {
+	projectID, documentID, err := verifyFileToken(c.Params("token"), time.Now())
+	if err != nil {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, err.Error(), nil)
+	}
+	if _, err := uuid.Parse(projectID); err != nil || !documentIDPattern.MatchString(documentID) {
+		return response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, errFileTokenInvalid.Error(), nil)
+	}
+
+	doc, err := repository.NewDocument(repository.GetDB()).WithContext(c.UserContext()).Get(projectID, documentID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if doc == nil || doc.DeletedAt != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document not found", nil)
+	}
+	if contentType, ok := documentContentTypes[strings.ToLower(filepath.Ext(doc.StoredPath))]; ok {
+		c.Set(fiber.HeaderContentType, contentType)
+	} else {
+		c.Type(filepath.Ext(doc.StoredPath))
+	}
+	return sendDocumentFile(c, doc)
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"manju/backend/middleware"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// signPayload signs an arbitrary payload the way signFileToken does
+func signPayload(payload string) string {
+	mac := hmac.New(sha256.New, fileURLKey())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyFileToken(t *testing.T) {
+	t.Setenv("FILE_URL_SECRET", "test-secret")
+	projectID := uuid.NewString()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	valid := signFileToken(projectID, "doc-ab12cd34", now.Add(time.Minute))
+	payload, mac, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		now     time.Time
+		wantErr error
+	}{
+		{name: "valid", token: func(t *testing.T) string { return valid }, now: now},
+		{name: "valid until the second it expires", token: func(t *testing.T) string { return valid }, now: now.Add(time.Minute)},
+		{name: "expired", token: func(t *testing.T) string { return valid }, now: now.Add(time.Minute + time.Second), wantErr: errFileTokenExpired},
+		{
+			name: "another document with the original signature",
+			token: func(t *testing.T) string {
+				return base64.RawURLEncoding.EncodeToString([]byte(projectID+":doc-other:"+"1704110460")) + "." + mac
+			},
+			now:     now,
+			wantErr: errFileTokenInvalid,
+		},
+		{
+			name: "expiry pushed back with the original signature",
+			token: func(t *testing.T) string {
+				return base64.RawURLEncoding.EncodeToString([]byte(projectID+":doc-ab12cd34:9999999999")) + "." + mac
+			},
+			now:     now,
+			wantErr: errFileTokenInvalid,
+		},
+		{
+			name: "flipped signature bit",
+			token: func(t *testing.T) string {
+				sum, _ := base64.RawURLEncoding.DecodeString(mac)
+				sum[0] ^= 1
+				return payload + "." + base64.RawURLEncoding.EncodeToString(sum)
+			},
+			now:     now,
+			wantErr: errFileTokenInvalid,
+		},
+		{
+			name: "signed with another secret",
+			token: func(t *testing.T) string {
+				t.Setenv("FILE_URL_SECRET", "other-secret")
+				return signFileToken(projectID, "doc-ab12cd34", now.Add(time.Minute))
+			},
+			now:     now,
+			wantErr: errFileTokenInvalid,
+		},
+		{name: "no signature", token: func(t *testing.T) string { return payload }, now: now, wantErr: errFileTokenInvalid},
+		{name: "empty signature", token: func(t *testing.T) string { return payload + "." }, now: now, wantErr: errFileTokenInvalid},
+		{name: "not base64", token: func(t *testing.T) string { return "!!!." + mac }, now: now, wantErr: errFileTokenInvalid},
+		{name: "empty", token: func(t *testing.T) string { return "" }, now: now, wantErr: errFileTokenInvalid},
+		{
+			name:    "signed payload with too few parts",
+			token:   func(t *testing.T) string { return signPayload(projectID + ":1704110460") },
+			now:     now,
+			wantErr: errFileTokenInvalid,
+		},
+		{
+			name:    "signed payload with a bad expiry",
+			token:   func(t *testing.T) string { return signPayload(projectID + ":doc-ab12cd34:tomorrow") },
+			now:     now,
+			wantErr: errFileTokenInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token(t)
+			t.Setenv("FILE_URL_SECRET", "test-secret")
+			gotProject, gotDoc, err := verifyFileToken(token, tt.now)
+			if err != tt.wantErr {
+				t.Fatalf("verifyFileToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (gotProject != projectID || gotDoc != "doc-ab12cd34") {
+				t.Errorf("token grants %s %s, want %s doc-ab12cd34", gotProject, gotDoc, projectID)
+			}
+		})
+	}
+}
+
+func TestSignedFileURL(t *testing.T) {
+	t.Setenv("FILE_URL_SECRET", "test-secret")
+	t.Setenv("BACKEND_URL", "https://api.example.com/")
+	// The AI service fetches links without the API key
+	t.Setenv("MANJU_API_KEY", "manju-key")
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	doc := uploadTestDocument(t, project, "report.pdf", testPDF)
+	trashed := uploadTestDocument(t, project, "old.txt", "old")
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId", func(c *fiber.Ctx) error {
+		return DeleteDocument(c, repository.NewProject(repository.GetDB()))
+	}, newRequest("DELETE", "/projects/"+project.ID.String()+"/documents/"+trashed.ID, "", nil))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("trash: status %d", resp.StatusCode)
+	}
+
+	// getSignedURL asks for a link to docID as userID
+	getSignedURL := func(t *testing.T, userID, docID string) (int, string, time.Time) {
+		t.Helper()
+		resp := serveAs(t, userID, "/projects/:id/documents/:docId/signed-url", func(c *fiber.Ctx) error {
+			return GetDocumentSignedURL(c, repository.NewProject(repository.GetDB()))
+		}, newRequest("GET", "/projects/"+project.ID.String()+"/documents/"+docID+"/signed-url", "", nil))
+		var signed struct {
+			URL       string    `json:"url"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}
+		json.Unmarshal(readBody(t, resp), &signed)
+		return resp.StatusCode, signed.URL, signed.ExpiresAt
+	}
+	// fetch downloads a file token without logging in or an API key
+	fetch := func(t *testing.T, token string) (*http.Response, []byte) {
+		t.Helper()
+		app := fiber.New()
+		app.Use(middleware.APIKeyGuard())
+		app.Get("/api/files/:token", ServeSignedFile)
+		resp, err := app.Test(newRequest("GET", "/api/files/"+token, "", nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, readBody(t, resp)
+	}
+
+	status, url, expiresAt := getSignedURL(t, project.UserID.String(), doc.ID)
+	if status != http.StatusOK {
+		t.Fatalf("signed-url: status %d", status)
+	}
+	token, ok := strings.CutPrefix(url, "https://api.example.com/api/files/")
+	if !ok {
+		t.Fatalf("url %s, want a link to the backend's /api/files", url)
+	}
+	if ttl := time.Until(expiresAt); ttl <= documentURLTTL-time.Minute || ttl > documentURLTTL {
+		t.Errorf("link expires in %v, want %v", ttl, documentURLTTL)
+	}
+
+	// A different first letter of the payload makes another, still decodable, payload
+	tampered := "A" + token[1:]
+	if token[0] == 'A' {
+		tampered = "B" + token[1:]
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "signed link", token: token, wantStatus: http.StatusOK},
+		{name: "expired", token: signFileToken(project.ID.String(), doc.ID, time.Now().Add(-time.Second)), wantStatus: http.StatusForbidden},
+		{name: "tampered", token: tampered, wantStatus: http.StatusForbidden},
+		{name: "another project's document", token: signFileToken(uuid.NewString(), doc.ID, time.Now().Add(time.Minute)), wantStatus: http.StatusNotFound},
+		{name: "document in the trash", token: signFileToken(project.ID.String(), trashed.ID, time.Now().Add(time.Minute)), wantStatus: http.StatusNotFound},
+		{name: "signed but malformed project", token: signFileToken("../etc", doc.ID, time.Now().Add(time.Minute)), wantStatus: http.StatusForbidden},
+		{name: "signed but malformed document", token: signFileToken(project.ID.String(), "../x", time.Now().Add(time.Minute)), wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := fetch(t, tt.token)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if string(body) == testPDF {
+					t.Error("served the document with a refused token")
+				}
+				return
+			}
+			if string(body) != testPDF || resp.Header.Get(fiber.HeaderContentType) != "application/pdf" {
+				t.Errorf("served %q as %s, want the PDF", body, resp.Header.Get(fiber.HeaderContentType))
+			}
+		})
+	}
+
+	t.Run("links need access to the project", func(t *testing.T) {
+		if status, _, _ := getSignedURL(t, uuid.NewString(), doc.ID); status != http.StatusForbidden {
+			t.Errorf("status %d for a stranger, want 403", status)
+		}
+		if status, _, _ := getSignedURL(t, project.UserID.String(), trashed.ID); status != http.StatusNotFound {
+			t.Errorf("status %d for a document in the trash, want 404", status)
+		}
+	})
+
+	t.Run("embedding sends links with DOCS_DELIVERY=url", func(t *testing.T) {
+		t.Setenv("DOCS_DELIVERY", "url")
+		useEmbeddingWorkers()
+		started, release := fakeEmbeddingService(t, project.ID.String(), http.StatusOK)
+		current, _ := repository.NewProject(repository.GetDB()).GetByID(project.ID.String())
+		if resp, body := queueEmbedding(t, project, ""); resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("embed: status %d: %s", resp.StatusCode, body)
+		}
+		req := <-started
+		close(release)
+		waitForEmbedding(t, project, current.Version)
+
+		if req.DocumentsPath != "" || len(req.DocumentURLs) != 1 || req.DocumentURLs[0]["id"] != doc.ID {
+			t.Fatalf("AI service asked to embed %q %v, want a link to %s only", req.DocumentsPath, req.DocumentURLs, doc.ID)
+		}
+		token := strings.TrimPrefix(req.DocumentURLs[0]["url"], "https://api.example.com/api/files/")
+		if resp, body := fetch(t, token); resp.StatusCode != http.StatusOK || string(body) != testPDF {
+			t.Errorf("link served %d %q, want the PDF", resp.StatusCode, body)
+		}
+	})
+}
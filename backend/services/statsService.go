@@ -0,0 +1,114 @@
+package services
+
+import (
+	"manju/backend/events"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// projectStatsTTL is how long computed stats are served from cache
+const projectStatsTTL = 30 * time.Second
+
+// ProjectStats is a lightweight overview of a project for the dashboard
+type ProjectStats struct {
+	ProjectID       string         `json:"project_id"`
+	NodeCount       int            `json:"node_count"`
+	ConnectionCount int            `json:"connection_count"`
+	NodeTypes       map[string]int `json:"node_types"`
+	DocumentCount   int            `json:"document_count"`
+	DocumentBytes   int64          `json:"document_bytes"`
+	LastRunAt       *time.Time     `json:"last_run_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       *time.Time     `json:"updated_at"`
+	ComputedAt      time.Time      `json:"computed_at"`
+}
+
+// cachedStats is a ProjectStats entry with its expiry
+type cachedStats struct {
+	stats   ProjectStats
+	expires time.Time
+}
+
+// projectStatsCache holds recently computed stats by project ID
+var projectStatsCache sync.Map
+
+// invalidateProjectStats drops the cached stats of a project
+func invalidateProjectStats(projectID string) {
+	projectStatsCache.Delete(projectID)
+}
+
+// registerStatsInvalidation clears cached stats whenever a project changes
+func registerStatsInvalidation() {
+	events.Subscribe(events.Sync, "stats-project-saved", func(e events.ProjectSaved) { invalidateProjectStats(e.ProjectID) })
+	events.Subscribe(events.Sync, "stats-document-uploaded", func(e events.DocumentUploaded) { invalidateProjectStats(e.ProjectID) })
+	events.Subscribe(events.Sync, "stats-demo-completed", func(e events.DemoCompleted) { invalidateProjectStats(e.ProjectID) })
+}
+
+// GetProjectStats returns node, document and run statistics for a project
+func GetProjectStats(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+
+	projectID := project.ID.String()
+	if v, ok := projectStatsCache.Load(projectID); ok {
+		if cached := v.(cachedStats); time.Now().Before(cached.expires) {
+			return c.JSON(cached.stats)
+		}
+	}
+
+	stats, err := computeProjectStats(project)
+	if err != nil {
+		return response.Error(c, fiber.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	projectStatsCache.Store(projectID, cachedStats{stats: stats, expires: time.Now().Add(projectStatsTTL)})
+
+	return c.JSON(stats)
+}
+
+// computeProjectStats gathers the stats of a project from its graph, document
+// directory and execution history
+func computeProjectStats(project *repository.Project) (ProjectStats, error) {
+	summary := summarizeProject(project)
+	stats := ProjectStats{
+		ProjectID:       project.ID.String(),
+		NodeCount:       summary.NodeCount,
+		ConnectionCount: summary.ConnectionCount,
+		NodeTypes:       summary.NodeTypes,
+		CreatedAt:       project.CreatedAt,
+		UpdatedAt:       project.UpdatedAt,
+		ComputedAt:      time.Now(),
+	}
+
+	docs, err := repository.NewDocument(repository.GetDB()).ListByProject(project.ID.String())
+	if err != nil {
+		return stats, err
+	}
+	for _, doc := range docs {
+		if doc.DeletedAt != nil {
+			continue
+		}
+		stats.DocumentCount++
+		stats.DocumentBytes += doc.Size
+	}
+
+	last, err := repository.NewExecution(repository.GetDB()).LastByProject(project.ID.String())
+	if err != nil {
+		return stats, err
+	}
+	if last != nil {
+		stats.LastRunAt = &last.CreatedAt
+	}
+	return stats, nil
+}
+
+// CacheStats reports the hit and miss counts and size of the project cache,
+// for operators. Admin only.
+func CacheStats(c *fiber.Ctx) error {
+	return c.JSON(repository.GetProjectCacheStats())
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/storage"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/datatypes"
+)
+
+// CSV and spreadsheet documents can feed the google-sheets node. Their
+// header row is parsed on upload and stored on the document as its columns;
+// the rows are parsed again when the editor pages through them. A malformed
+// CSV row is reported with its line instead of failing the whole file.
+
+// maxStoredParseErrors caps the parse errors kept on a document
+const maxStoredParseErrors = 50
+
+// RowParseError is a row of a CSV document that could not be parsed
+type RowParseError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// tabularData is the parsed content of a CSV or spreadsheet document
+type tabularData struct {
+	Columns []string
+	Rows    [][]string
+	Errors  []RowParseError
+}
+
+// isTabularExt reports whether documents with extension ext have rows
+func isTabularExt(ext string) bool {
+	ext = strings.ToLower(ext)
+	return ext == ".csv" || ext == ".xlsx"
+}
+
+// parseTabular parses a CSV or spreadsheet document
+func parseTabular(r io.Reader, ext string) (*tabularData, error) {
+	if strings.EqualFold(ext, ".xlsx") {
+		return parseSpreadsheet(r)
+	}
+	return parseCSV(r)
+}
+
+// csvLineEndings turns CR LF and lone CR line endings into LF, which
+// encoding/csv does not treat as a line break on its own
+var csvLineEndings = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// parseCSV parses a CSV document whose first row is the header. A leading
+// byte order mark is dropped and CR, LF and CR LF line endings may be mixed.
+// Rows that can't be parsed, or have a different number of fields than the
+// header, are left out and reported in Errors.
+func parseCSV(r io.Reader) (*tabularData, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	cr := csv.NewReader(strings.NewReader(csvLineEndings.Replace(string(content))))
+
+	data := &tabularData{Columns: []string{}, Rows: [][]string{}, Errors: []RowParseError{}}
+	header := true
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			data.Errors = append(data.Errors, RowParseError{Line: parseErr.StartLine, Message: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header {
+			data.Columns, header = headerColumns(record), false
+			continue
+		}
+		data.Rows = append(data.Rows, record)
+	}
+	return data, nil
+}
+
+// parseSpreadsheet parses the first sheet of an .xlsx document, whose first
+// row is the header. Spreadsheets leave out trailing empty cells, so short
+// rows are padded to the header's width.
+func parseSpreadsheet(r io.Reader) (*tabularData, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := &tabularData{Columns: []string{}, Rows: [][]string{}, Errors: []RowParseError{}}
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return data, nil
+	}
+	rows, err := f.GetRows(sheets[0])
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		if i == 0 {
+			data.Columns = headerColumns(row)
+			continue
+		}
+		if len(row) > len(data.Columns) {
+			data.Errors = append(data.Errors, RowParseError{Line: i + 1, Message: fmt.Sprintf("row has %d cells, the header has %d", len(row), len(data.Columns))})
+			continue
+		}
+		for len(row) < len(data.Columns) {
+			row = append(row, "")
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	return data, nil
+}
+
+// headerColumns returns the column names of a header row, naming blank
+// ones after their position
+func headerColumns(record []string) []string {
+	columns := make([]string, len(record))
+	for i, name := range record {
+		columns[i] = strings.TrimSpace(name)
+		if columns[i] == "" {
+			columns[i] = fmt.Sprintf("column_%d", i+1)
+		}
+	}
+	return columns
+}
+
+// setTabularMetadata parses an uploaded CSV or spreadsheet and stores its
+// columns, row count and first parse errors on doc. A file that can't be
+// parsed at all is still accepted, without columns.
+func setTabularMetadata(doc *repository.Document, file uploadedFile, ext string) {
+	if !isTabularExt(ext) {
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	data, err := parseTabular(f, ext)
+	if err != nil {
+		log.Printf("[documents] failed to parse %s: %v", file.Name, err)
+		return
+	}
+	if len(data.Errors) > maxStoredParseErrors {
+		data.Errors = data.Errors[:maxStoredParseErrors]
+	}
+	columns, _ := json.Marshal(data.Columns)
+	parseErrors, _ := json.Marshal(data.Errors)
+	doc.Columns, doc.ParseErrors, doc.RowCount = datatypes.JSON(columns), datatypes.JSON(parseErrors), len(data.Rows)
+}
+
+// DocumentRows is a page of the rows of a CSV or spreadsheet document
+type DocumentRows struct {
+	DocumentID string          `json:"document_id"`
+	Columns    []string        `json:"columns"`
+	Rows       [][]string      `json:"rows"`
+	Total      int             `json:"total"`
+	Limit      int             `json:"limit"`
+	Offset     int             `json:"offset"`
+	Errors     []RowParseError `json:"errors"` // every row that could not be parsed
+}
+
+// maxDocumentRowsLimit is the largest page of rows that may be requested
+const maxDocumentRowsLimit = 500
+
+// GetDocumentRows returns the columns and a page of the rows (?limit=,
+// default 50, and ?offset=) of a CSV or spreadsheet document
+func GetDocumentRows(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	limit, offset := c.QueryInt("limit", 50), c.QueryInt("offset", 0)
+	if limit < 1 || limit > maxDocumentRowsLimit || offset < 0 {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, fmt.Sprintf("limit must be between 1 and %d and offset not negative", maxDocumentRowsLimit), nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+	doc, err := loadDocument(c, documentRepo(c), project)
+	if doc == nil {
+		return err
+	}
+	if doc.DeletedAt != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document is in the trash", nil)
+	}
+	ext := filepath.Ext(doc.StoredPath)
+	if !isTabularExt(ext) {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "document is not a CSV or spreadsheet", nil)
+	}
+
+	data, err := readTabularDocument(c.UserContext(), doc.StoredPath, ext)
+	if errors.Is(err, storage.ErrNotFound) {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "document file not found", nil)
+	}
+	if err != nil {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeValidation, "failed to parse document", nil)
+	}
+	rows := data.Rows[min(offset, len(data.Rows)):min(offset+limit, len(data.Rows))]
+	return c.JSON(DocumentRows{
+		DocumentID: doc.ID,
+		Columns:    data.Columns,
+		Rows:       rows,
+		Total:      len(data.Rows),
+		Limit:      limit,
+		Offset:     offset,
+		Errors:     data.Errors,
+	})
+}
+
+// readTabularDocument parses a stored CSV or spreadsheet
+func readTabularDocument(ctx context.Context, key, ext string) (*tabularData, error) {
+	f, err := documentStorage.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseTabular(f, ext)
+}
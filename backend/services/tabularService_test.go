@@ -0,0 +1,254 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantColumns []string
+		wantRows    [][]string
+		wantErrors  []int // lines of the rows that could not be parsed
+	}{
+		{
+			name:        "plain",
+			content:     "name,age\nAda,36\nAlan,41\n",
+			wantColumns: []string{"name", "age"},
+			wantRows:    [][]string{{"Ada", "36"}, {"Alan", "41"}},
+		},
+		{
+			name:        "quoted fields",
+			content:     "name,quote\n\"Lovelace, Ada\",\"She said \"\"hello\"\"\"\n\"Turing\",\"line one\nline two\"\n",
+			wantColumns: []string{"name", "quote"},
+			wantRows:    [][]string{{"Lovelace, Ada", `She said "hello"`}, {"Turing", "line one\nline two"}},
+		},
+		{
+			name:        "byte order mark",
+			content:     "\xef\xbb\xbfname,age\nAda,36\n",
+			wantColumns: []string{"name", "age"},
+			wantRows:    [][]string{{"Ada", "36"}},
+		},
+		{
+			name:        "CR LF line endings",
+			content:     "name,age\r\nAda,36\r\nAlan,41\r\n",
+			wantColumns: []string{"name", "age"},
+			wantRows:    [][]string{{"Ada", "36"}, {"Alan", "41"}},
+		},
+		{
+			name:        "mixed line endings",
+			content:     "name,age\rAda,36\r\nAlan,41\nGrace,85\r",
+			wantColumns: []string{"name", "age"},
+			wantRows:    [][]string{{"Ada", "36"}, {"Alan", "41"}, {"Grace", "85"}},
+		},
+		{
+			name:        "quoted field with CR LF inside",
+			content:     "\xef\xbb\xbfname,note\r\n\"Ada\",\"first\r\nsecond\"\r\n",
+			wantColumns: []string{"name", "note"},
+			wantRows:    [][]string{{"Ada", "first\nsecond"}},
+		},
+		{
+			name:        "blank and padded header names",
+			content:     " name ,,age\nAda,x,36\n",
+			wantColumns: []string{"name", "column_2", "age"},
+			wantRows:    [][]string{{"Ada", "x", "36"}},
+		},
+		{
+			name:        "malformed rows are reported by line",
+			content:     "name,age\nAda,36\nAlan\nGr\"ace,85\nGrace,85\n",
+			wantColumns: []string{"name", "age"},
+			wantRows:    [][]string{{"Ada", "36"}, {"Grace", "85"}},
+			wantErrors:  []int{3, 4},
+		},
+		{
+			name:        "empty",
+			content:     "",
+			wantColumns: []string{},
+			wantRows:    [][]string{},
+		},
+		{
+			name:        "header only",
+			content:     "\xef\xbb\xbfname,age\r\n",
+			wantColumns: []string{"name", "age"},
+			wantRows:    [][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := parseTabular(strings.NewReader(tt.content), ".CSV")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data.Columns, tt.wantColumns) {
+				t.Errorf("columns %q, want %q", data.Columns, tt.wantColumns)
+			}
+			if !reflect.DeepEqual(data.Rows, tt.wantRows) {
+				t.Errorf("rows %q, want %q", data.Rows, tt.wantRows)
+			}
+			lines := []int{}
+			for _, e := range data.Errors {
+				if e.Message == "" {
+					t.Errorf("error on line %d without a message", e.Line)
+				}
+				lines = append(lines, e.Line)
+			}
+			if want := append([]int{}, tt.wantErrors...); !reflect.DeepEqual(lines, want) {
+				t.Errorf("errors on lines %v, want %v", lines, want)
+			}
+		})
+	}
+}
+
+// testSpreadsheet builds an .xlsx whose first sheet holds rows
+func testSpreadsheet(t *testing.T, rows ...[]interface{}) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A second sheet is ignored
+	f.NewSheet("Notes")
+	f.SetCellValue("Notes", "A1", "ignored")
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestParseSpreadsheet(t *testing.T) {
+	content := testSpreadsheet(t,
+		[]interface{}{"name", "", "age"},
+		[]interface{}{"Ada", "x", 36},
+		[]interface{}{"Alan"},
+		[]interface{}{"Grace", "y", 85, "extra"},
+		[]interface{}{"สมชาย", "z", 40},
+	)
+	data, err := parseTabular(strings.NewReader(content), ".xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"name", "column_2", "age"}; !reflect.DeepEqual(data.Columns, want) {
+		t.Errorf("columns %q, want %q", data.Columns, want)
+	}
+	// Short rows are padded; rows wider than the header are reported
+	if want := [][]string{{"Ada", "x", "36"}, {"Alan", "", ""}, {"สมชาย", "z", "40"}}; !reflect.DeepEqual(data.Rows, want) {
+		t.Errorf("rows %q, want %q", data.Rows, want)
+	}
+	if len(data.Errors) != 1 || data.Errors[0].Line != 4 {
+		t.Errorf("errors %+v, want line 4", data.Errors)
+	}
+
+	if _, err := parseTabular(strings.NewReader("not a spreadsheet"), ".xlsx"); err == nil {
+		t.Error("parsed a file that isn't a spreadsheet")
+	}
+}
+
+func TestDocumentRows(t *testing.T) {
+	useTestDB(t, documentModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+
+	var csv strings.Builder
+	csv.WriteString("\xef\xbb\xbfid,name\r\n")
+	for i := range 120 {
+		csv.WriteString(strings.Repeat("x", i%3) + "," + "row\r\n")
+	}
+	csv.WriteString("broken\r\n")
+	doc := uploadTestDocument(t, project, "contacts.csv", csv.String())
+	sheet := uploadTestDocument(t, project, "contacts.xlsx", testSpreadsheet(t, []interface{}{"id", "name"}, []interface{}{1, "Ada"}))
+	text := uploadTestDocument(t, project, "notes.txt", "hello")
+	// A CSV that doesn't parse is still stored
+	broken := uploadTestDocument(t, project, "broken.csv", "a,b\n\"unterminated\n")
+
+	t.Run("columns are stored on upload", func(t *testing.T) {
+		docRepo := repository.NewDocument(repository.GetDB())
+		tests := []struct {
+			id          string
+			wantColumns string
+			wantRows    int
+			wantErrors  int
+		}{
+			{id: doc.ID, wantColumns: `["id","name"]`, wantRows: 120, wantErrors: 1},
+			{id: sheet.ID, wantColumns: `["id","name"]`, wantRows: 1},
+			{id: text.ID},
+			{id: broken.ID, wantColumns: `["a","b"]`, wantErrors: 1},
+		}
+		for _, tt := range tests {
+			stored, err := docRepo.Get(project.ID.String(), tt.id)
+			if err != nil || stored == nil {
+				t.Fatalf("get %s: %v", tt.id, err)
+			}
+			var parseErrors []RowParseError
+			json.Unmarshal(stored.ParseErrors, &parseErrors)
+			if columns := strings.ReplaceAll(string(stored.Columns), " ", ""); columns != tt.wantColumns || stored.RowCount != tt.wantRows || len(parseErrors) != tt.wantErrors {
+				t.Errorf("%s: columns %s, %d rows, %d errors; want %s, %d, %d", stored.Name, stored.Columns, stored.RowCount, len(parseErrors), tt.wantColumns, tt.wantRows, tt.wantErrors)
+			}
+		}
+	})
+
+	tests := []struct {
+		name       string
+		docID      string
+		query      string
+		wantStatus int
+		wantRows   int
+		wantFirst  string
+	}{
+		{name: "first page", docID: doc.ID, wantStatus: http.StatusOK, wantRows: 50, wantFirst: ""},
+		{name: "offset", docID: doc.ID, query: "?offset=100&limit=50", wantStatus: http.StatusOK, wantRows: 20, wantFirst: "x"},
+		{name: "past the end", docID: doc.ID, query: "?offset=500", wantStatus: http.StatusOK},
+		{name: "largest page", docID: doc.ID, query: "?limit=500", wantStatus: http.StatusOK, wantRows: 120, wantFirst: ""},
+		{name: "spreadsheet", docID: sheet.ID, wantStatus: http.StatusOK, wantRows: 1, wantFirst: "1"},
+		{name: "limit too large", docID: doc.ID, query: "?limit=501", wantStatus: http.StatusBadRequest},
+		{name: "zero limit", docID: doc.ID, query: "?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "negative offset", docID: doc.ID, query: "?offset=-1", wantStatus: http.StatusBadRequest},
+		{name: "not tabular", docID: text.ID, wantStatus: http.StatusBadRequest},
+		{name: "unknown document", docID: "doc-missing", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := serveAs(t, project.UserID.String(), "/projects/:id/documents/:docId/rows", func(c *fiber.Ctx) error {
+				return GetDocumentRows(c, repository.NewProject(repository.GetDB()))
+			}, newRequest("GET", "/projects/"+project.ID.String()+"/documents/"+tt.docID+"/rows"+tt.query, "", nil))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			var rows DocumentRows
+			if err := json.Unmarshal(body, &rows); err != nil {
+				t.Fatal(err)
+			}
+			if len(rows.Rows) != tt.wantRows || rows.Rows == nil {
+				t.Fatalf("%d rows, want %d", len(rows.Rows), tt.wantRows)
+			}
+			if tt.wantRows > 0 && rows.Rows[0][0] != tt.wantFirst {
+				t.Errorf("first row %q, want id %q", rows.Rows[0], tt.wantFirst)
+			}
+			if !reflect.DeepEqual(rows.Columns, []string{"id", "name"}) || rows.DocumentID != tt.docID {
+				t.Errorf("document %s columns %q", rows.DocumentID, rows.Columns)
+			}
+			if tt.docID == doc.ID && (rows.Total != 120 || len(rows.Errors) != 1 || rows.Errors[0].Line != 122) {
+				t.Errorf("total %d errors %+v, want 120 rows and line 122 malformed", rows.Total, rows.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"errors"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// TeamPayload is the request body for creating or renaming a team
+type TeamPayload struct {
+	Name string `json:"name"`
+}
+
+// AddTeamMemberPayload is the request body for adding a user to a team, by
+// email or user ID
+type AddTeamMemberPayload struct {
+	Email  string              `json:"email,omitempty"`
+	UserID string              `json:"user_id,omitempty"`
+	Role   repository.TeamRole `json:"role"`
+}
+
+// UpdateTeamMemberPayload is the request body for changing a team member's role
+type UpdateTeamMemberPayload struct {
+	Role repository.TeamRole `json:"role"`
+}
+
+// teamRoleRank orders team roles so a required role can be compared
+var teamRoleRank = map[repository.TeamRole]int{
+	repository.TeamViewer: 1,
+	repository.TeamEditor: 2,
+	repository.TeamOwner:  3,
+}
+
+// loadTeamForAccess loads the team in :id and checks the caller holds at
+// least need in it. Non-members get 404 so team IDs are not disclosed.
+func loadTeamForAccess(c *fiber.Ctx, teamRepo *repository.TeamRepository, need repository.TeamRole) (*repository.Team, error) {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok {
+		return nil, response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+	if _, err := uuid.Parse(c.Params("id")); err != nil {
+		return nil, response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid team id", nil)
+	}
+
+	team, err := teamRepo.GetByID(c.Params("id"))
+	if err != nil {
+		return nil, response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if team == nil {
+		return nil, response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "team not found", nil)
+	}
+	role, err := teamRepo.MemberRole(team.ID.String(), userIDStr)
+	if err != nil {
+		return nil, response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if role == "" {
+		return nil, response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "team not found", nil)
+	}
+	if teamRoleRank[role] < teamRoleRank[need] {
+		return nil, response.Error(c, http.StatusForbidden, response.ErrCodeForbidden, "forbidden", nil)
+	}
+	team.Role = role
+	return team, nil
+}
+
+// CreateTeam creates a team with the caller as its owner
+func CreateTeam(c *fiber.Ctx, teamRepo *repository.TeamRepository) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	var body TeamPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "name is required", nil)
+	}
+
+	team, err := teamRepo.Create(&repository.Team{Name: body.Name, CreatedBy: uuid.MustParse(userIDStr)})
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "team.create", "team", team.ID.String(), fiber.Map{"name": team.Name})
+
+	return c.Status(http.StatusCreated).JSON(team)
+}
+
+// ListTeams returns the teams the caller belongs to, with their role in each
+func ListTeams(c *fiber.Ctx, teamRepo *repository.TeamRepository) error {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	teams, err := teamRepo.ListByUser(userIDStr)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(teams)
+}
+
+// GetTeam returns a team the caller belongs to
+func GetTeam(c *fiber.Ctx, teamRepo *repository.TeamRepository) error {
+	team, err := loadTeamForAccess(c, teamRepo, repository.TeamViewer)
+	if team == nil {
+		return err
+	}
+	return c.JSON(team)
+}
+
+// UpdateTeam renames a team. Owner only.
+func UpdateTeam(c *fiber.Ctx, teamRepo *repository.TeamRepository) error {
+	team, err := loadTeamForAccess(c, teamRepo, repository.TeamOwner)
+	if team == nil {
+		return err
+	}
+
+	var body TeamPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "name is required", nil)
+	}
+
+	from := team.Name
+	if err := teamRepo.Rename(team, body.Name); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "team.update", "team", team.ID.String(), fiber.Map{"name": fieldChange{From: from, To: team.Name}})
+
+	return c.JSON(team)
+}
+
+// DeleteTeam deletes a team. Its projects stay with their owners. Owner only.
+func DeleteTeam(c *fiber.Ctx, teamRepo *repository.TeamRepository) error {
+	team, err := loadTeamForAccess(c, teamRepo, repository.TeamOwner)
+	if team == nil {
+		return err
+	}
+
+	if err := teamRepo.Delete(team.ID.String()); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "team.delete", "team", team.ID.String(), fiber.Map{"name": team.Name})
+
+	return c.JSON(response.MessageResponse{Message: "team deleted"})
+}
+
+// ListTeamMembers returns the members of a team
+func ListTeamMembers(c *fiber.Ctx, teamRepo *repository.TeamRepository) error {
+	team, err := loadTeamForAccess(c, teamRepo, repository.TeamViewer)
+	if team == nil {
+		return err
+	}
+
+	members, err := teamRepo.ListMembers(team.ID.String())
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(members)
+}
+
+// AddTeamMember adds an existing user to a team. Owner only.
+func AddTeamMember(c *fiber.Ctx, teamRepo *repository.TeamRepository, userRepo *repository.UserRepository) error {
+	team, err := loadTeamForAccess(c, teamRepo, repository.TeamOwner)
+	if team == nil {
+		return err
+	}
+
+	var body AddTeamMemberPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if body.Role == "" {
+		body.Role = repository.TeamViewer
+	}
+	if !body.Role.Valid() {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "role must be owner, editor or viewer", nil)
+	}
+
+	var user *repository.User
+	switch {
+	case strings.TrimSpace(body.Email) != "":
+		user, err = userRepo.GetByEmail(strings.TrimSpace(body.Email))
+	case body.UserID != "":
+		if _, perr := uuid.Parse(body.UserID); perr != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user_id", nil)
+		}
+		user, err = userRepo.GetByID(body.UserID)
+	default:
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "email or user_id is required", nil)
+	}
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if user == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "user not found", nil)
+	}
+
+	member, err := teamRepo.AddMember(&repository.TeamMember{TeamID: team.ID, UserID: user.ID, Role: body.Role})
+	if err != nil {
+		if errors.Is(err, repository.ErrAlreadyTeamMember) {
+			return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "already a member", nil)
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	member.Email = user.Email
+	member.Name = user.Name
+
+	RecordAudit(c, "team.member_add", "team", team.ID.String(), fiber.Map{"user_id": user.ID, "role": member.Role})
+
+	return c.Status(http.StatusCreated).JSON(member)
+}
+
+// TeamMemberRole is the response of PUT /teams/:id/members/:userId
+type TeamMemberRole struct {
+	TeamID uuid.UUID           `json:"team_id"`
+	UserID string              `json:"user_id"`
+	Role   repository.TeamRole `json:"role"`
+}
+
+// UpdateTeamMember changes a member's role. Owner only; the last owner
+// cannot be demoted.
+func UpdateTeamMember(c *fiber.Ctx, teamRepo *repository.TeamRepository) error {
+	team, err := loadTeamForAccess(c, teamRepo, repository.TeamOwner)
+	if team == nil {
+		return err
+	}
+
+	var body UpdateTeamMemberPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if !body.Role.Valid() {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "role must be owner, editor or viewer", nil)
+	}
+
+	userID := c.Params("userId")
+	from, err := teamRepo.MemberRole(team.ID.String(), userID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if from == "" {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "member not found", nil)
+	}
+	if from == repository.TeamOwner && body.Role != repository.TeamOwner {
+		owners, err := teamRepo.CountOwners(team.ID.String())
+		if err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+		}
+		if owners <= 1 {
+			return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "a team must keep at least one owner", nil)
+		}
+	}
+
+	if err := teamRepo.UpdateMemberRole(team.ID.String(), userID, body.Role); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "team.member_role_change", "team", team.ID.String(), fiber.Map{"user_id": userID, "role": fieldChange{From: from, To: body.Role}})
+
+	return c.JSON(TeamMemberRole{TeamID: team.ID, UserID: userID, Role: body.Role})
+}
+
+// RemoveTeamMember removes a member from a team. Owners can remove anyone;
+// other members can only leave. The last owner cannot leave.
+func RemoveTeamMember(c *fiber.Ctx, teamRepo *repository.TeamRepository) error {
+	userID := c.Params("userId")
+	need := repository.TeamOwner
+	if self, _ := c.Locals("userID").(string); self == userID {
+		need = repository.TeamViewer
+	}
+	team, err := loadTeamForAccess(c, teamRepo, need)
+	if team == nil {
+		return err
+	}
+
+	role, err := teamRepo.MemberRole(team.ID.String(), userID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if role == "" {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "member not found", nil)
+	}
+	if role == repository.TeamOwner {
+		owners, err := teamRepo.CountOwners(team.ID.String())
+		if err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+		}
+		if owners <= 1 {
+			return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "a team must keep at least one owner", nil)
+		}
+	}
+
+	if err := teamRepo.RemoveMember(team.ID.String(), userID); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "team.member_remove", "team", team.ID.String(), fiber.Map{"user_id": userID})
+
+	return c.JSON(response.MessageResponse{Message: "member removed"})
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"manju/backend/events"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/templates"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// builtinTemplateFile is the JSON layout of an embedded template definition
+type builtinTemplateFile struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Category    string          `json:"category"`
+	Nodes       json.RawMessage `json:"nodes"`
+	Connections json.RawMessage `json:"connections"`
+}
+
+// SeedBuiltinTemplates loads the embedded template definitions into the database
+func SeedBuiltinTemplates(repo *repository.ProjectTemplateRepository) {
+	files, err := fs.Glob(templates.Builtin, "builtin/*.json")
+	if err != nil {
+		log.Printf("[templates] failed to list builtin templates: %v", err)
+		return
+	}
+
+	for _, name := range files {
+		raw, err := templates.Builtin.ReadFile(name)
+		if err != nil {
+			log.Printf("[templates] failed to read %s: %v", name, err)
+			continue
+		}
+		var def builtinTemplateFile
+		if err := json.Unmarshal(raw, &def); err != nil {
+			log.Printf("[templates] invalid template %s: %v", name, err)
+			continue
+		}
+		t := &repository.ProjectTemplate{
+			Name:        def.Name,
+			Description: def.Description,
+			Category:    def.Category,
+			Nodes:       datatypes.JSON(def.Nodes),
+			Connections: datatypes.JSON(def.Connections),
+		}
+		if err := repo.UpsertBuiltin(t); err != nil {
+			log.Printf("[templates] failed to seed %s: %v", def.Name, err)
+		}
+	}
+}
+
+// ListTemplates returns all available project templates
+func ListTemplates(c *fiber.Ctx, repo *repository.ProjectTemplateRepository) error {
+	list, err := repo.List(c.Query("category"))
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(list)
+}
+
+// FromTemplatePayload is the optional body of POST
+// /projects/from-template/:templateId; empty fields are taken from the template
+type FromTemplatePayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// CreateProjectFromTemplate instantiates a template into a new project owned by the caller
+func CreateProjectFromTemplate(c *fiber.Ctx, repo *repository.ProjectRepository, templateRepo *repository.ProjectTemplateRepository) error {
+	userIDStr := c.Locals("userID")
+	if userIDStr == nil {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "unauthorized", nil)
+	}
+
+	userID, err := uuid.Parse(userIDStr.(string))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user id", nil)
+	}
+
+	tmpl, err := templateRepo.GetByID(c.Params("templateId"))
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "template not found", nil)
+	}
+
+	var body FromTemplatePayload
+	_ = c.BodyParser(&body)
+	if body.Name == "" {
+		body.Name = tmpl.Name
+	}
+	if body.Description == "" {
+		body.Description = tmpl.Description
+	}
+
+	project, err := instantiateTemplate(tmpl, userID, body.Name, body.Description)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	created, err := repo.Create(project)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.create", "project", created.ID.String(), fiber.Map{"name": created.Name, "template_id": tmpl.ID})
+	events.Publish(events.ProjectSaved{ProjectID: created.ID.String(), UserID: userID.String(), Created: true, At: time.Now()})
+
+	return c.Status(http.StatusCreated).JSON(created)
+}
+
+// instantiateTemplate builds a new project from a template with fresh node IDs
+func instantiateTemplate(tmpl *repository.ProjectTemplate, userID uuid.UUID, name, description string) (*repository.Project, error) {
+	var nodes []map[string]interface{}
+	var connections []map[string]interface{}
+	if err := json.Unmarshal(tmpl.Nodes, &nodes); err != nil || nodes == nil {
+		nodes = []map[string]interface{}{}
+	}
+	if err := json.Unmarshal(tmpl.Connections, &connections); err != nil || connections == nil {
+		connections = []map[string]interface{}{}
+	}
+	regenerateWorkflowIDs(nodes, connections)
+
+	nodesJSON, err := json.Marshal(nodes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template nodes: %w", err)
+	}
+	connectionsJSON, err := json.Marshal(connections)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template connections: %w", err)
+	}
+
+	return &repository.Project{
+		UserID:      userID,
+		Name:        name,
+		Description: description,
+		Nodes:       datatypes.JSON(nodesJSON),
+		Connections: datatypes.JSON(connectionsJSON),
+		Status:      repository.ProjectStatusDraft,
+	}, nil
+}
+
+// TemplatePayload is the optional body of POST
+// /admin/templates/from-project/:id; an empty name or description is taken
+// from the project
+type TemplatePayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+}
+
+// CreateTemplateFromProject lets an admin publish an existing project as a template
+func CreateTemplateFromProject(c *fiber.Ctx, repo *repository.ProjectRepository, templateRepo *repository.ProjectTemplateRepository) error {
+	project, err := repo.GetByID(c.Params("id"))
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "project not found", nil)
+	}
+
+	var body TemplatePayload
+	_ = c.BodyParser(&body)
+	if body.Name == "" {
+		body.Name = project.Name
+	}
+	if body.Description == "" {
+		body.Description = project.Description
+	}
+
+	// Strip uploaded documents: they belong to the source project
+	nodes, connections := parseWorkflow(project)
+	for _, node := range nodes {
+		if t, _ := node["type"].(string); t == "rag-documents" {
+			nodeData(node)["documents"] = []interface{}{}
+		}
+	}
+	nodesJSON, _ := json.Marshal(nodes)
+	connectionsJSON, _ := json.Marshal(connections)
+
+	tmpl := &repository.ProjectTemplate{
+		Name:        body.Name,
+		Description: body.Description,
+		Category:    body.Category,
+		Nodes:       datatypes.JSON(nodesJSON),
+		Connections: datatypes.JSON(connectionsJSON),
+	}
+	if uid, err := uuid.Parse(fmt.Sprint(c.Locals("userID"))); err == nil {
+		tmpl.CreatedBy = &uid
+	}
+
+	created, err := templateRepo.Create(tmpl)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "template.create", "template", created.ID.String(), fiber.Map{"project_id": project.ID})
+
+	return c.Status(http.StatusCreated).JSON(created)
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+func TestCreateProjectFromTemplate(t *testing.T) {
+	tmpl := repository.ProjectTemplate{
+		ID:          uuid.New(),
+		Name:        "Document Q&A",
+		Description: "Answer questions from your files",
+		Category:    "rag",
+		Nodes: datatypes.JSON(`[
+			{"id":"input","type":"text-input","position":{"x":0,"y":0},"data":{}},
+			{"id":"model","type":"ai-model","position":{"x":200,"y":0},"data":{"modelName":"gpt-4o-mini"}}
+		]`),
+		Connections: datatypes.JSON(`[{"id":"c1","sourceNodeId":"input","targetNodeId":"model"}]`),
+		IsBuiltin:   true,
+	}
+
+	tests := []struct {
+		name            string
+		userID          string
+		templateID      string
+		body            string
+		wantStatus      int
+		wantName        string
+		wantDescription string
+	}{
+		{
+			name:            "takes the template's name and description",
+			userID:          uuid.NewString(),
+			templateID:      tmpl.ID.String(),
+			wantStatus:      http.StatusCreated,
+			wantName:        "Document Q&A",
+			wantDescription: "Answer questions from your files",
+		},
+		{
+			name:            "name and description from the body",
+			userID:          uuid.NewString(),
+			templateID:      tmpl.ID.String(),
+			body:            `{"name":"HR bot","description":"Policies"}`,
+			wantStatus:      http.StatusCreated,
+			wantName:        "HR bot",
+			wantDescription: "Policies",
+		},
+		{
+			name:       "unknown template",
+			userID:     uuid.NewString(),
+			templateID: uuid.NewString(),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unauthenticated",
+			templateID: tmpl.ID.String(),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, &repository.Project{}, &repository.ProjectVersion{}, &repository.ProjectTemplate{}, &repository.AuditLog{})
+			seeded := tmpl
+			if err := db.Create(&seeded).Error; err != nil {
+				t.Fatalf("create template: %v", err)
+			}
+
+			resp := serveAs(t, tt.userID, "/projects/from-template/:templateId", func(c *fiber.Ctx) error {
+				return CreateProjectFromTemplate(c, repository.NewProject(db), repository.NewProjectTemplate(db))
+			}, newRequest("POST", "/projects/from-template/"+tt.templateID, "application/json", strings.NewReader(tt.body)))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var project repository.Project
+			if err := json.Unmarshal(body, &project); err != nil {
+				t.Fatalf("response: %v", err)
+			}
+			if project.UserID.String() != tt.userID {
+				t.Errorf("project owned by %s, want the caller %s", project.UserID, tt.userID)
+			}
+			if project.Name != tt.wantName || project.Description != tt.wantDescription {
+				t.Errorf("project %q %q, want %q %q", project.Name, project.Description, tt.wantName, tt.wantDescription)
+			}
+			if project.Status != repository.ProjectStatusDraft {
+				t.Errorf("status = %s, want draft", project.Status)
+			}
+
+			nodes, connections := parseWorkflow(&project)
+			if len(nodes) != 2 || len(connections) != 1 {
+				t.Fatalf("got %d nodes and %d connections, want 2 and 1", len(nodes), len(connections))
+			}
+			ids := map[string]bool{}
+			for _, node := range nodes {
+				id, _ := node["id"].(string)
+				if id == "input" || id == "model" || ids[id] {
+					t.Errorf("node id %q is not fresh", id)
+				}
+				ids[id] = true
+			}
+			source, target := connectionEndpoints(connections[0])
+			if source != nodes[0]["id"] || target != nodes[1]["id"] {
+				t.Errorf("connection %s -> %s, want it to follow the new node IDs %v -> %v", source, target, nodes[0]["id"], nodes[1]["id"])
+			}
+
+			// The template itself is left as it was
+			stored, err := repository.NewProjectTemplate(db).GetByID(tmpl.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(stored.Nodes), `"id":"input"`) {
+				t.Errorf("template nodes changed to %s", stored.Nodes)
+			}
+		})
+	}
+}
+
+func TestSeedBuiltinTemplates(t *testing.T) {
+	db := useTestDB(t, &repository.ProjectTemplate{})
+	repo := repository.NewProjectTemplate(db)
+
+	// Seeding again at the next startup refreshes the templates in place
+	SeedBuiltinTemplates(repo)
+	SeedBuiltinTemplates(repo)
+
+	list, err := repo.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 {
+		t.Fatal("no built-in templates seeded")
+	}
+	names := map[string]bool{}
+	for _, tmpl := range list {
+		if !tmpl.IsBuiltin {
+			t.Errorf("template %q is not marked built-in", tmpl.Name)
+		}
+		if names[tmpl.Name] {
+			t.Errorf("template %q seeded twice", tmpl.Name)
+		}
+		names[tmpl.Name] = true
+
+		var nodes, connections []map[string]interface{}
+		if err := json.Unmarshal(tmpl.Nodes, &nodes); err != nil {
+			t.Errorf("template %q nodes: %v", tmpl.Name, err)
+		}
+		if err := json.Unmarshal(tmpl.Connections, &connections); err != nil {
+			t.Errorf("template %q connections: %v", tmpl.Name, err)
+		}
+		if errs := workflowSchemaErrors(nodes, connections); len(errs) > 0 {
+			t.Errorf("template %q is not a valid workflow: %v", tmpl.Name, errs)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tenantSlugPattern matches slugs that are also valid DNS labels
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// CreateTenantPayload is the request body for creating a tenant
+type CreateTenantPayload struct {
+	Name   string `json:"name"`
+	Slug   string `json:"slug"`
+	Plan   string `json:"plan"`
+	Domain string `json:"domain"`
+}
+
+// CreateTenant creates a tenant
+func CreateTenant(c *fiber.Ctx, repo *repository.TenantRepository) error {
+	var body CreateTenantPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	body.Slug = strings.ToLower(strings.TrimSpace(body.Slug))
+	body.Domain = strings.ToLower(strings.TrimSpace(body.Domain))
+	if body.Name == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "name is required", nil)
+	}
+	if !tenantSlugPattern.MatchString(body.Slug) {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "slug must be lowercase letters, digits and dashes", nil)
+	}
+
+	tenant := repository.Tenant{Name: body.Name, Slug: body.Slug, Plan: strings.TrimSpace(body.Plan)}
+	if tenant.Plan == "" {
+		tenant.Plan = "free"
+	}
+	if body.Domain != "" {
+		tenant.Domain = &body.Domain
+	}
+
+	created, err := repo.Create(&tenant)
+	if err != nil {
+		if errors.Is(err, repository.ErrTenantSlugTaken) {
+			return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "slug or domain already in use", nil)
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "tenant.create", "tenant", created.ID.String(), fiber.Map{"slug": created.Slug, "plan": created.Plan})
+
+	return c.Status(http.StatusCreated).JSON(created)
+}
+
+// ListTenants returns every tenant
+func ListTenants(c *fiber.Ctx, repo *repository.TenantRepository) error {
+	tenants, err := repo.WithContext(c.UserContext()).List()
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(tenants)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxThumbnailBytes = 1 << 20 // 1 MB
+	thumbnailWidth    = 640
+	thumbnailHeight   = 360
+)
+
+// getThumbnailStoragePath returns the directory project thumbnails are stored in
+func getThumbnailStoragePath() string {
+	path := os.Getenv("THUMBNAIL_STORAGE_PATH")
+	if path == "" {
+		path = "./uploads/thumbnails"
+	}
+	return path
+}
+
+// thumbnailPath returns where the thumbnail of projectID is stored
+func thumbnailPath(projectID string) string {
+	return filepath.Join(getThumbnailStoragePath(), projectID+".jpg")
+}
+
+// removeThumbnail deletes the thumbnail file of a project, if any
+func removeThumbnail(projectID string) {
+	if err := os.Remove(thumbnailPath(projectID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[thumbnails] failed to remove thumbnail of project %s: %v", projectID, err)
+	}
+}
+
+// ThumbnailUploaded is the response of PUT /projects/:id/thumbnail
+type ThumbnailUploaded struct {
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// UploadThumbnail stores a JPEG or PNG preview image for a project, cropped and
+// resized to 640x360
+func UploadThumbnail(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	repo = repo.WithContext(c.UserContext())
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	file, err := c.FormFile("thumbnail")
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "no thumbnail uploaded", nil)
+	}
+	src, err := readUploadedImage(file, maxThumbnailBytes)
+	if err != nil {
+		switch {
+		case errors.Is(err, errImageTooLarge):
+			return response.Error(c, http.StatusRequestEntityTooLarge, response.ErrCodePayloadTooLarge, "thumbnail must be at most 1 MB", nil)
+		case errors.Is(err, errImageFormat):
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "thumbnail must be a JPEG or PNG image", nil)
+		}
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "failed to read thumbnail", nil)
+	}
+
+	if err := os.MkdirAll(getThumbnailStoragePath(), 0755); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	path := thumbnailPath(project.ID.String())
+	if err := saveResizedJPEG(path, src, thumbnailWidth, thumbnailHeight); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to save thumbnail", nil)
+	}
+	if err := repo.SetThumbnail(project.ID.String(), path); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "project.thumbnail_upload", "project", project.ID.String(), nil)
+
+	return c.JSON(ThumbnailUploaded{ThumbnailURL: "/api/v1/projects/" + project.ID.String() + "/thumbnail"})
+}
+
+// GetThumbnail serves the thumbnail of a project
+func GetThumbnail(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+	if project.Thumbnail == "" {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "no thumbnail", nil)
+	}
+	if _, err := os.Stat(project.Thumbnail); err != nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "no thumbnail", nil)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	c.Type("jpg")
+	return c.SendFile(project.Thumbnail)
+}
+
+// DeleteThumbnail removes the thumbnail of a project
+func DeleteThumbnail(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	repo = repo.WithContext(c.UserContext())
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+	if project.Thumbnail == "" {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "no thumbnail", nil)
+	}
+
+	if err := repo.SetThumbnail(project.ID.String(), ""); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	removeThumbnail(project.ID.String())
+
+	RecordAudit(c, "project.thumbnail_delete", "project", project.ID.String(), nil)
+
+	return c.JSON(response.MessageResponse{Message: "thumbnail deleted"})
+}
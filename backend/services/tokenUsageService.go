@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// TokenUsageDay is the tokens a project used on one day (UTC) and what they
+// cost
+type TokenUsageDay struct {
+	Date        string  `json:"date"` // YYYY-MM-DD
+	TotalTokens int64   `json:"total_tokens"`
+	TotalCost   float64 `json:"total_cost"` // USD, by the TOKEN_COST_PER_1K_USD table
+}
+
+// defaultTokenCostKey is the entry of the cost table used for models it
+// doesn't list
+const defaultTokenCostKey = "default"
+
+// getTokenCosts returns the USD cost of 1,000 tokens per model name, read
+// from TOKEN_COST_PER_1K_USD: either a JSON object such as
+// {"gpt-4o-mini": 0.0006, "default": 0.002} or the path of a file holding
+// one. Models missing from the table, with no "default" entry, cost nothing.
+func getTokenCosts() (map[string]float64, error) {
+	v := strings.TrimSpace(os.Getenv("TOKEN_COST_PER_1K_USD"))
+	if v == "" {
+		return map[string]float64{}, nil
+	}
+	data := []byte(v)
+	if !strings.HasPrefix(v, "{") {
+		var err error
+		if data, err = os.ReadFile(v); err != nil {
+			return nil, fmt.Errorf("failed to read token cost table: %w", err)
+		}
+	}
+	costs := map[string]float64{}
+	if err := json.Unmarshal(data, &costs); err != nil {
+		return nil, fmt.Errorf("invalid token cost table: %w", err)
+	}
+	return costs, nil
+}
+
+// tokenCost returns what tokens of model cost by the cost table
+func tokenCost(costs map[string]float64, model string, tokens int64) float64 {
+	perK, ok := costs[model]
+	if !ok {
+		perK = costs[defaultTokenCostKey]
+	}
+	return float64(tokens) / 1000 * perK
+}
+
+// GetTokenUsage returns the tokens a project's executions used per day
+// between ?from= and ?to= (RFC 3339 or YYYY-MM-DD; a date-only to includes
+// that day), with their cost
+func GetTokenUsage(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	var from, to *time.Time
+	if v := c.Query("from"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid from", nil)
+		}
+		from = &t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid to", nil)
+		}
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = &t
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "from must be before to", nil)
+	}
+
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+	costs, err := getTokenCosts()
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	usage, err := repository.NewExecution(repository.GetDB()).WithContext(c.UserContext()).TokenUsageByDay(project.ID.String(), from, to)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(tokenUsageDays(usage, costs))
+}
+
+// tokenUsageDays sums per-model usage into days, pricing each model's tokens
+func tokenUsageDays(usage []repository.TokenUsage, costs map[string]float64) []TokenUsageDay {
+	days := []TokenUsageDay{}
+	for _, u := range usage {
+		if len(days) == 0 || days[len(days)-1].Date != u.Day {
+			days = append(days, TokenUsageDay{Date: u.Day})
+		}
+		day := &days[len(days)-1]
+		day.TotalTokens += u.TotalTokens
+		day.TotalCost += tokenCost(costs, u.ModelUsed, u.TotalTokens)
+	}
+	return days
+}
+
+// defaultCompletionTokens is the reply length assumed when estimating a run
+// whose ai-model node doesn't set max tokens
+const defaultCompletionTokens = 1024
+
+// estimateChatTokens guesses the tokens a chat request will use: about four
+// characters per prompt token, plus the longest reply the model may give
+func estimateChatTokens(req DemoChatRequest) int64 {
+	chars := len(req.Message) + len(req.SystemPrompt)
+	for _, msg := range req.ConversationHistory {
+		if content, ok := msg["content"].(string); ok {
+			chars += len(content)
+		}
+	}
+	completion := req.MaxTokens
+	if completion == 0 {
+		completion = defaultCompletionTokens
+	}
+	return int64(chars/4 + completion)
+}
+
+// tokenBudgetError refuses a run that could take its project past its token
+// budget
+type tokenBudgetError struct {
+	used, budget, estimated int64
+}
+
+func (e *tokenBudgetError) Error() string {
+	return fmt.Sprintf("token budget exceeded: %d of %d tokens used, run needs about %d", e.used, e.budget, e.estimated)
+}
+
+// respond writes the 402 response of a refused run
+func (e *tokenBudgetError) respond(c *fiber.Ctx) error {
+	return response.Error(c, http.StatusPaymentRequired, response.ErrCodeTokenBudgetExceeded, "token budget exceeded", fiber.Map{
+		"used":      e.used,
+		"budget":    e.budget,
+		"estimated": e.estimated,
+	})
+}
+
+// checkTokenBudget returns a *tokenBudgetError when running req could take
+// project past its token budget
+func checkTokenBudget(project *repository.Project, req DemoChatRequest) error {
+	if project.TokenBudget == nil {
+		return nil
+	}
+	estimated := estimateChatTokens(req)
+	if project.TokensUsed+estimated <= *project.TokenBudget {
+		return nil
+	}
+	return &tokenBudgetError{used: project.TokensUsed, budget: *project.TokenBudget, estimated: estimated}
+}
+
+// prepareChatRun builds the AI service request for a run of project as
+// userID with the caller's conversation history, truncated to the history
+// limits, and refuses the run with a *tokenBudgetError when it could take the
+// project past its token budget. Every way of running a project goes through
+// it. It returns the request and the number of history messages dropped.
+func prepareChatRun(ctx context.Context, project *repository.Project, userID, message string, history []map[string]interface{}, sessionID string) (DemoChatRequest, int, error) {
+	aiRequest, err := buildChatRequest(ctx, project, userID, message)
+	if err != nil {
+		return aiRequest, 0, err
+	}
+	var truncated int
+	aiRequest.ConversationHistory, truncated = truncateHistory(history)
+	aiRequest.SessionID = sessionID
+	if err := checkTokenBudget(project, aiRequest); err != nil {
+		return aiRequest, truncated, err
+	}
+	return aiRequest, truncated, nil
+}
+
+// addTokensUsed counts the tokens of a run against its project's budget
+func addTokensUsed(ctx context.Context, projectID uuid.UUID, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	if err := repository.NewProject(repository.GetDB()).WithContext(ctx).AddTokensUsed(projectID.String(), int64(tokens)); err != nil {
+		log.Printf("[execution] failed to count tokens of project %s: %v", projectID, err)
+	}
+}
+
+// TokenUsageReset is the response of POST /projects/:id/reset-token-usage
+type TokenUsageReset struct {
+	TokensUsed  int64  `json:"tokens_used"`
+	TokenBudget *int64 `json:"token_budget"` // null is unlimited
+}
+
+// ResetTokenUsage zeroes the tokens a project has used against its budget
+func ResetTokenUsage(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessOwner)
+	if project == nil {
+		return err
+	}
+	if err := repo.ResetTokensUsed(project.ID.String()); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	RecordAudit(c, "project.token_usage_reset", "project", project.ID.String(), fiber.Map{"tokens_used": project.TokensUsed})
+	return c.JSON(TokenUsageReset{TokensUsed: 0, TokenBudget: project.TokenBudget})
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestTokenBudgetRefusesEveryRun(t *testing.T) {
+	var calls atomic.Int32
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewEncoder(w).Encode(DemoChatResponse{Response: "hello", TotalTokens: 50})
+	}))
+	defer ai.Close()
+	t.Setenv("AI_SERVICE_URL", ai.URL)
+
+	db := useTestDB(t, append(projectListModels, &repository.UserAPIKey{}, &repository.Execution{})...)
+	repo := repository.NewProject(db)
+	owner := uuid.New()
+	encrypted, err := EncryptAPIKey("sk-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&repository.UserAPIKey{UserID: owner, Label: "Default", EncryptedKey: encrypted, IsDefault: true}).Error; err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	project := createTestProject(t, owner, publishTestNodes("v1"))
+	// tokens_used is only written by AddTokensUsed, so set it directly
+	if err := db.Exec("UPDATE projects SET token_budget = ?, tokens_used = ? WHERE id = ?", 2000, 1990, project.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	resp := serveAs(t, owner.String(), "/projects/:id", func(c *fiber.Ctx) error {
+		return PublishProject(c, repo)
+	}, newRequest("POST", "/projects/"+project.ID.String(), "", nil))
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("publish: status %d: %s", resp.StatusCode, body)
+	}
+	var published repository.Project
+	if err := json.Unmarshal(body, &published); err != nil || published.PublicSlug == nil {
+		t.Fatalf("publish response %s: %v", body, err)
+	}
+
+	t.Run("public chat", func(t *testing.T) {
+		resp := serveAs(t, "", "/public/bots/:slug/chat", func(c *fiber.Ctx) error {
+			return PublicChat(c, repo)
+		}, newRequest("POST", "/public/bots/"+*published.PublicSlug+"/chat", "application/json", strings.NewReader(`{"message":"hi"}`)))
+		body := readBody(t, resp)
+		if resp.StatusCode != http.StatusPaymentRequired || errorCode(t, body) != response.ErrCodeTokenBudgetExceeded {
+			t.Errorf("public chat over budget: status %d: %s, want 402 %s", resp.StatusCode, body, response.ErrCodeTokenBudgetExceeded)
+		}
+	})
+
+	t.Run("schedule", func(t *testing.T) {
+		schedule := &repository.Schedule{ID: uuid.New(), ProjectID: project.ID, InputMessage: "daily report"}
+		runSchedule(repo, schedule)
+
+		var execution repository.Execution
+		if err := db.Where("schedule_id = ?", schedule.ID).First(&execution).Error; err != nil {
+			t.Fatalf("scheduled run not recorded: %v", err)
+		}
+		if execution.Status != repository.ExecutionFailed || !strings.Contains(execution.Error, "token budget exceeded") {
+			t.Errorf("scheduled run over budget recorded as %s: %q, want failed for the budget", execution.Status, execution.Error)
+		}
+	})
+
+	if n := calls.Load(); n != 0 {
+		t.Errorf("the AI service was called %d times over budget, want none", n)
+	}
+	stored, err := repo.GetByID(project.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.TokensUsed != 1990 {
+		t.Errorf("tokens used = %d after refused runs, want 1990", stored.TokensUsed)
+	}
+
+	// Once reset, the same runs go through
+	if err := repo.ResetTokensUsed(project.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	resp = serveAs(t, "", "/public/bots/:slug/chat", func(c *fiber.Ctx) error {
+		return PublicChat(c, repo)
+	}, newRequest("POST", "/public/bots/"+*published.PublicSlug+"/chat", "application/json", strings.NewReader(`{"message":"hi"}`)))
+	if body := readBody(t, resp); resp.StatusCode != http.StatusOK {
+		t.Errorf("public chat within budget: status %d: %s", resp.StatusCode, body)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("the AI service was called %d times within budget, want once", calls.Load())
+	}
+	if stored, err = repo.GetByID(project.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if stored.TokensUsed != 50 {
+		t.Errorf("tokens used = %d after a 50 token run, want 50", stored.TokensUsed)
+	}
+}
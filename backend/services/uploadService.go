@@ -0,0 +1,408 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/storage"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Resumable uploads let large documents arrive over flaky connections: the
+// client starts an upload, PUTs its chunks in any order (retrying the ones
+// that failed) and completes it, which registers the document like a normal
+// upload. Chunks are kept in document storage under the project's
+// .uploads directory until then.
+
+// documentUploadDir is the directory of a project's unfinished uploads
+const documentUploadDir = ".uploads"
+
+const (
+	defaultUploadChunkSize = 5 << 20  // 5 MB
+	minUploadChunkSize     = 64 << 10 // 64 KB
+	maxUploadChunkSize     = 16 << 20 // 16 MB
+)
+
+// getUploadSessionTTL returns how long an unfinished upload is kept
+func getUploadSessionTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("UPLOAD_SESSION_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// uploadRepo returns the upload repository bound to the request context
+func uploadRepo(c *fiber.Ctx) *repository.DocumentUploadRepository {
+	return repository.NewDocumentUpload(repository.GetDB()).WithContext(c.UserContext())
+}
+
+// uploadDir returns the storage directory of an upload's chunks
+func uploadDir(project *repository.Project, uploadID uuid.UUID) string {
+	return filepath.Join(projectDocumentDir(project), documentUploadDir, uploadID.String())
+}
+
+// uploadChunkKey returns the storage key of chunk n of an upload
+func uploadChunkKey(project *repository.Project, uploadID uuid.UUID, n int) string {
+	return filepath.Join(uploadDir(project, uploadID), strconv.Itoa(n))
+}
+
+// UploadView is the API view of an upload with the chunks still missing
+type UploadView struct {
+	*repository.DocumentUpload
+	ChunkCount int   `json:"chunk_count"`
+	Missing    []int `json:"missing_chunks"`
+}
+
+// missingChunks lists the chunks of an upload not yet stored
+func missingChunks(c *fiber.Ctx, project *repository.Project, upload *repository.DocumentUpload) ([]int, error) {
+	missing := []int{}
+	for n := 0; n < upload.ChunkCount(); n++ {
+		info, err := documentStorage.Stat(c.UserContext(), uploadChunkKey(project, upload.ID, n))
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && info.Size != upload.ChunkLength(n)) {
+			missing = append(missing, n)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// loadUpload returns the upload :uploadId of project started by the caller.
+// On failure it writes the error response and returns nil.
+func loadUpload(c *fiber.Ctx, project *repository.Project) (*repository.DocumentUpload, error) {
+	if _, err := uuid.Parse(c.Params("uploadId")); err != nil {
+		return nil, response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid upload id", nil)
+	}
+	upload, err := uploadRepo(c).Get(project.ID.String(), c.Params("uploadId"))
+	if err != nil {
+		return nil, response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if upload == nil || upload.UserID.String() != c.Locals("userID").(string) {
+		return nil, response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "upload not found", nil)
+	}
+	if !time.Now().Before(upload.ExpiresAt) {
+		return nil, response.Error(c, http.StatusGone, response.ErrCodeGone, "upload has expired", fiber.Map{"expires_at": upload.ExpiresAt})
+	}
+	return upload, nil
+}
+
+// checkUploadQuota fails when size more bytes, on top of the declared size
+// of the caller's other unfinished uploads, would take them over the storage
+// quota. exceptID is the upload being completed, so it is not counted twice.
+func checkUploadQuota(c *fiber.Ctx, size int64, exceptID string) *uploadError {
+	userID := c.Locals("userID").(string)
+	pending, err := uploadRepo(c).PendingBytesByUser(userID, exceptID)
+	if err != nil {
+		return &uploadError{http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil}
+	}
+	quotaErr := checkStorageQuota(documentRepo(c), userID, pending+size)
+	if quotaErr != nil && quotaErr.details != nil {
+		quotaErr.details["size"] = size
+		quotaErr.details["pending_bytes"] = pending
+	}
+	return quotaErr
+}
+
+// CreateUploadPayload is the body of POST /projects/:id/documents/uploads
+type CreateUploadPayload struct {
+	FileName   string `json:"file_name"`
+	Size       int64  `json:"size"`
+	ChunkSize  int64  `json:"chunk_size"`  // optional; 5 MB by default
+	SHA256     string `json:"sha256"`      // optional; checked on completion
+	DocumentID string `json:"document_id"` // optional; replaces that document
+}
+
+// UploadChunkStored is the response of PUT
+// /projects/:id/documents/uploads/:uploadId/chunks/:n
+type UploadChunkStored struct {
+	UploadID uuid.UUID `json:"upload_id"`
+	Chunk    int       `json:"chunk"`
+	Size     int       `json:"size"`
+}
+
+// CreateDocumentUpload starts a resumable upload of one document
+func CreateDocumentUpload(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	var body CreateUploadPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid request body", nil)
+	}
+
+	// Reject what a normal upload would reject before any chunk is sent
+	body.FileName = filepath.Base(strings.TrimSpace(body.FileName))
+	if body.FileName == "" || body.FileName == "." || body.FileName == string(filepath.Separator) {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "file_name is required", nil)
+	}
+	if body.Size <= 0 {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "size must be positive", nil)
+	}
+	if max := getMaxDocumentSize(); body.Size > max {
+		return response.Error(c, http.StatusRequestEntityTooLarge, response.ErrCodeFileTooLarge, "file is too large", fiber.Map{
+			"size":      body.Size,
+			"max_bytes": max,
+		})
+	}
+	if ext := strings.ToLower(filepath.Ext(body.FileName)); !allowedDocumentExt(ext) {
+		return response.Error(c, http.StatusUnsupportedMediaType, response.ErrCodeUnsupportedFileType, "unsupported file type", fiber.Map{
+			"type":          ext,
+			"allowed_types": getAllowedDocumentTypes(),
+		})
+	}
+	if body.DocumentID != "" && !documentIDPattern.MatchString(body.DocumentID) {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid document id", nil)
+	}
+	if quotaErr := checkUploadQuota(c, body.Size, ""); quotaErr != nil {
+		return quotaErr.respond(c)
+	}
+	if body.SHA256 != "" {
+		if b, err := hex.DecodeString(body.SHA256); err != nil || len(b) != sha256.Size {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "sha256 must be a hex SHA-256", nil)
+		}
+	}
+	maxChunk := int64(maxUploadChunkSize)
+	if limit := int64(MaxRequestBodyBytes()); limit < maxChunk {
+		maxChunk = limit
+	}
+	if body.ChunkSize == 0 {
+		body.ChunkSize = min(defaultUploadChunkSize, maxChunk)
+	}
+	if body.ChunkSize < minUploadChunkSize || body.ChunkSize > maxChunk {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid chunk_size", fiber.Map{
+			"min_bytes": minUploadChunkSize,
+			"max_bytes": maxChunk,
+		})
+	}
+
+	upload, err := uploadRepo(c).Create(&repository.DocumentUpload{
+		ProjectID:   project.ID,
+		UserID:      uuid.MustParse(c.Locals("userID").(string)),
+		DocumentID:  body.DocumentID,
+		FileName:    body.FileName,
+		Size:        body.Size,
+		ChunkSize:   body.ChunkSize,
+		ContentHash: strings.ToLower(body.SHA256),
+		ExpiresAt:   time.Now().Add(getUploadSessionTTL()),
+	})
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	missing := make([]int, upload.ChunkCount())
+	for n := range missing {
+		missing[n] = n
+	}
+	return c.Status(http.StatusCreated).JSON(UploadView{upload, upload.ChunkCount(), missing})
+}
+
+// GetDocumentUpload returns an upload with the chunks still missing, so an
+// interrupted client knows what to resend
+func GetDocumentUpload(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+	upload, err := loadUpload(c, project)
+	if upload == nil {
+		return err
+	}
+
+	missing, err := missingChunks(c, project, upload)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(UploadView{upload, upload.ChunkCount(), missing})
+}
+
+// PutDocumentUploadChunk stores chunk :n of an upload from the raw request
+// body. Resending a chunk replaces it. An optional X-Chunk-SHA256 header is
+// checked against the body.
+func PutDocumentUploadChunk(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+	upload, err := loadUpload(c, project)
+	if upload == nil {
+		return err
+	}
+
+	n, err := strconv.Atoi(c.Params("n"))
+	if err != nil || n < 0 || n >= upload.ChunkCount() {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid chunk number", fiber.Map{"chunk_count": upload.ChunkCount()})
+	}
+	chunk := c.Body()
+	if want := upload.ChunkLength(n); int64(len(chunk)) != want {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeChunkSizeMismatch, "chunk has the wrong size", fiber.Map{"expected_bytes": want, "received_bytes": len(chunk)})
+	}
+	if want := c.Get("X-Chunk-SHA256"); want != "" {
+		sum := sha256.Sum256(chunk)
+		if !strings.EqualFold(want, hex.EncodeToString(sum[:])) {
+			return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeChunkHashMismatch, "chunk does not match its hash", fiber.Map{"chunk": n})
+		}
+	}
+
+	if err := documentStorage.Save(c.UserContext(), uploadChunkKey(project, upload.ID, n), bytes.NewReader(chunk), int64(len(chunk))); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to save chunk", nil)
+	}
+	return c.JSON(UploadChunkStored{UploadID: upload.ID, Chunk: n, Size: len(chunk)})
+}
+
+// CompleteDocumentUpload assembles the chunks of an upload, checks its hash
+// and stores it as a document like a normal upload
+func CompleteDocumentUpload(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+	upload, err := loadUpload(c, project)
+	if upload == nil {
+		return err
+	}
+
+	missing, err := missingChunks(c, project, upload)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if len(missing) > 0 {
+		return response.Error(c, http.StatusConflict, response.ErrCodeMissingChunks, "upload is missing chunks", fiber.Map{"missing_chunks": missing})
+	}
+
+	// Assemble into a temporary file so the upload can be validated and
+	// stored like a multipart file
+	assembled, hash, err := assembleUpload(c, project, upload)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to assemble upload", nil)
+	}
+	defer os.Remove(assembled)
+	if upload.ContentHash != "" && hash != upload.ContentHash {
+		return response.Error(c, http.StatusUnprocessableEntity, response.ErrCodeHashMismatch, "upload does not match its hash", fiber.Map{"expected": upload.ContentHash, "actual": hash})
+	}
+
+	// Other uploads may have completed since this one started
+	if quotaErr := checkUploadQuota(c, upload.Size, upload.ID.String()); quotaErr != nil {
+		return quotaErr.respond(c)
+	}
+
+	file := uploadedFile{upload.FileName, upload.Size, func() (io.ReadCloser, error) { return os.Open(assembled) }}
+	userID := uuid.MustParse(c.Locals("userID").(string))
+	docRepo := documentRepo(c)
+	doc, previous, deduplicated, uploadErr := saveUploadedDocument(c, docRepo, project, userID, file, upload.DocumentID)
+	if uploadErr != nil {
+		return uploadErr.respond(c)
+	}
+	discardUpload(uploadRepo(c), project, upload)
+	return respondUploadedDocument(c, repo, docRepo, project, doc, previous, deduplicated)
+}
+
+// AbortDocumentUpload discards an upload and its chunks
+func AbortDocumentUpload(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	if msg := invalidDocumentParams(c); msg != "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, msg, nil)
+	}
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+	upload, err := loadUpload(c, project)
+	if upload == nil {
+		return err
+	}
+
+	discardUpload(uploadRepo(c), project, upload)
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// assembleUpload concatenates the chunks of an upload into a temporary file,
+// returning its path and hex SHA-256
+func assembleUpload(c *fiber.Ctx, project *repository.Project, upload *repository.DocumentUpload) (string, string, error) {
+	out, err := os.CreateTemp("", "manju-upload-*"+filepath.Ext(upload.FileName))
+	if err != nil {
+		return "", "", err
+	}
+	h := sha256.New()
+	w := io.MultiWriter(out, h)
+	for n := 0; n < upload.ChunkCount(); n++ {
+		err = func() error {
+			chunk, err := documentStorage.Open(c.UserContext(), uploadChunkKey(project, upload.ID, n))
+			if err != nil {
+				return err
+			}
+			defer chunk.Close()
+			_, err = io.Copy(w, chunk)
+			return err
+		}()
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+			return "", "", fmt.Errorf("chunk %d: %w", n, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", "", err
+	}
+	return out.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// discardUpload removes an upload and its stored chunks
+func discardUpload(uploads *repository.DocumentUploadRepository, project *repository.Project, upload *repository.DocumentUpload) {
+	if err := uploads.Delete(upload.ID.String()); err != nil {
+		log.Printf("[uploads] failed to delete upload %s: %v", upload.ID, err)
+	}
+	if err := storage.DeletePrefix(context.Background(), documentStorage, uploadDir(project, upload.ID)); err != nil {
+		log.Printf("[uploads] failed to remove chunks of upload %s: %v", upload.ID, err)
+	}
+}
+
+// purgeExpiredUploads removes uploads that were never completed
+func purgeExpiredUploads(uploads *repository.DocumentUploadRepository, projectRepo *repository.ProjectRepository) {
+	expired, err := uploads.ListExpired(time.Now())
+	if err != nil {
+		log.Printf("[uploads] failed to list expired uploads: %v", err)
+		return
+	}
+	for i := range expired {
+		project, err := projectRepo.GetByID(expired[i].ProjectID.String())
+		if err != nil {
+			// The project is gone and its documents directory with it
+			uploads.Delete(expired[i].ID.String())
+			continue
+		}
+		discardUpload(uploads, project, &expired[i])
+	}
+	if len(expired) > 0 {
+		log.Printf("[uploads] purged %d expired uploads", len(expired))
+	}
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// uploadModels are the tables resumable uploads use
+var uploadModels = append([]interface{}{&repository.DocumentUpload{}}, documentModels...)
+
+// uploadClient drives the resumable upload endpoints of a project as userID
+type uploadClient struct {
+	t       *testing.T
+	project *repository.Project
+	userID  string
+}
+
+// do sends a request to handler, mounted at route under the project's
+// uploads, and returns the status and body
+func (u uploadClient) do(method, route, path string, handler func(c *fiber.Ctx, repo *repository.ProjectRepository) error, body []byte, header map[string]string) (int, []byte) {
+	u.t.Helper()
+	req := newRequest(method, "/projects/"+u.project.ID.String()+"/documents/uploads"+path, "application/json", bytes.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp := serveAs(u.t, u.userID, "/projects/:id/documents/uploads"+route, func(c *fiber.Ctx) error {
+		return handler(c, repository.NewProject(repository.GetDB()))
+	}, req)
+	return resp.StatusCode, readBody(u.t, resp)
+}
+
+func (u uploadClient) create(body string) (int, []byte) {
+	return u.do("POST", "", "", CreateDocumentUpload, []byte(body), nil)
+}
+
+func (u uploadClient) get(id string) (int, []byte) {
+	return u.do("GET", "/:uploadId", "/"+id, GetDocumentUpload, nil, nil)
+}
+
+func (u uploadClient) put(id string, n int, chunk []byte, header map[string]string) (int, []byte) {
+	return u.do("PUT", "/:uploadId/chunks/:n", "/"+id+"/chunks/"+strconv.Itoa(n), PutDocumentUploadChunk, chunk, header)
+}
+
+func (u uploadClient) complete(id string) (int, []byte) {
+	return u.do("POST", "/:uploadId/complete", "/"+id+"/complete", CompleteDocumentUpload, nil, nil)
+}
+
+// missing returns the chunks a view of an upload lists as missing
+func missing(t *testing.T, body []byte) []int {
+	t.Helper()
+	var view struct {
+		Missing []int `json:"missing_chunks"`
+		Details struct {
+			Missing []int `json:"missing_chunks"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(body, &view); err != nil {
+		t.Fatalf("upload %s: %v", body, err)
+	}
+	if view.Missing == nil {
+		return view.Details.Missing
+	}
+	return view.Missing
+}
+
+func TestResumableUpload(t *testing.T) {
+	useTestDB(t, uploadModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	client := uploadClient{t, project, project.UserID.String()}
+
+	// Four chunks, the last one short
+	content := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 4500))
+	sum := sha256.Sum256(content)
+	chunk := func(n int) []byte {
+		end := min((n+1)*minUploadChunkSize, len(content))
+		return content[n*minUploadChunkSize : end]
+	}
+
+	status, body := client.create(`{"file_name":"handbook.txt","size":` + strconv.Itoa(len(content)) + `,"chunk_size":65536,"sha256":"` + hex.EncodeToString(sum[:]) + `"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", status, body)
+	}
+	var created struct {
+		ID         string `json:"id"`
+		ChunkCount int    `json:"chunk_count"`
+	}
+	json.Unmarshal(body, &created)
+	if created.ChunkCount != 4 || !reflect.DeepEqual(missing(t, body), []int{0, 1, 2, 3}) {
+		t.Fatalf("created %s, want 4 missing chunks", body)
+	}
+
+	// The connection drops after three chunks, sent out of order
+	for _, n := range []int{3, 1, 0} {
+		if status, body := client.put(created.ID, n, chunk(n), nil); status != http.StatusOK {
+			t.Fatalf("chunk %d: status %d: %s", n, status, body)
+		}
+	}
+
+	steps := []struct {
+		name        string
+		do          func() (int, []byte)
+		wantStatus  int
+		wantCode    string
+		wantMissing []int
+	}{
+		{name: "completing early lists the missing chunk", do: func() (int, []byte) { return client.complete(created.ID) }, wantStatus: http.StatusConflict, wantCode: response.ErrCodeMissingChunks, wantMissing: []int{2}},
+		{name: "the client asks what to resend", do: func() (int, []byte) { return client.get(created.ID) }, wantStatus: http.StatusOK, wantMissing: []int{2}},
+		{
+			name:       "a chunk of the wrong size",
+			do:         func() (int, []byte) { return client.put(created.ID, 2, chunk(2)[1:], nil) },
+			wantStatus: http.StatusBadRequest,
+			wantCode:   response.ErrCodeChunkSizeMismatch,
+		},
+		{
+			name: "a chunk that doesn't match its hash",
+			do: func() (int, []byte) {
+				return client.put(created.ID, 2, chunk(2), map[string]string{"X-Chunk-SHA256": strings.Repeat("0", 64)})
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   response.ErrCodeChunkHashMismatch,
+		},
+		{name: "a chunk past the end", do: func() (int, []byte) { return client.put(created.ID, 4, chunk(3), nil) }, wantStatus: http.StatusBadRequest, wantCode: response.ErrCodeBadRequest},
+		{name: "rejected chunks are still missing", do: func() (int, []byte) { return client.get(created.ID) }, wantStatus: http.StatusOK, wantMissing: []int{2}},
+		{
+			name: "resending the missing chunk",
+			do: func() (int, []byte) {
+				sum := sha256.Sum256(chunk(2))
+				return client.put(created.ID, 2, chunk(2), map[string]string{"X-Chunk-SHA256": hex.EncodeToString(sum[:])})
+			},
+			wantStatus: http.StatusOK,
+		},
+		{name: "resending a stored chunk replaces it", do: func() (int, []byte) { return client.put(created.ID, 1, chunk(1), nil) }, wantStatus: http.StatusOK},
+		{name: "nothing left to send", do: func() (int, []byte) { return client.get(created.ID) }, wantStatus: http.StatusOK, wantMissing: []int{}},
+		{name: "another user can't see the upload", do: func() (int, []byte) {
+			return uploadClient{t, project, uuid.NewString()}.get(created.ID)
+		}, wantStatus: http.StatusForbidden},
+		{name: "completing stores the document", do: func() (int, []byte) { return client.complete(created.ID) }, wantStatus: http.StatusCreated},
+		{name: "the upload is gone once completed", do: func() (int, []byte) { return client.get(created.ID) }, wantStatus: http.StatusNotFound},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			status, body := step.do()
+			if status != step.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, step.wantStatus, body)
+			}
+			if step.wantCode != "" {
+				if code := errorCode(t, body); code != step.wantCode {
+					t.Errorf("code = %s, want %s", code, step.wantCode)
+				}
+			}
+			if step.wantMissing != nil {
+				if got := missing(t, body); !reflect.DeepEqual(got, step.wantMissing) {
+					t.Errorf("missing chunks %v, want %v", got, step.wantMissing)
+				}
+			}
+		})
+	}
+
+	docs, err := repository.NewDocument(repository.GetDB()).ListByProject(project.ID.String())
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("documents %v, %v, want the completed upload", docs, err)
+	}
+	stored, err := os.ReadFile(docs[0].StoredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, content) || docs[0].Name != "handbook.txt" || docs[0].ContentHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("stored %s of %d bytes with hash %s, want the uploaded file", docs[0].Name, len(stored), docs[0].ContentHash)
+	}
+	if _, err := os.Stat(uploadDir(project, uuid.MustParse(created.ID))); !os.IsNotExist(err) {
+		t.Errorf("chunks left behind: %v", err)
+	}
+}
+
+func TestCreateDocumentUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "default chunk size", body: `{"file_name":"a.pdf","size":100}`, wantStatus: http.StatusCreated},
+		{name: "path in the file name is dropped", body: `{"file_name":"../../a.pdf","size":100}`, wantStatus: http.StatusCreated},
+		{name: "no file name", body: `{"size":100}`, wantStatus: http.StatusBadRequest, wantCode: response.ErrCodeBadRequest},
+		{name: "empty file", body: `{"file_name":"a.pdf","size":0}`, wantStatus: http.StatusBadRequest, wantCode: response.ErrCodeBadRequest},
+		{name: "too large", body: `{"file_name":"a.pdf","size":1073741824}`, wantStatus: http.StatusRequestEntityTooLarge, wantCode: response.ErrCodeFileTooLarge},
+		{name: "disallowed type", body: `{"file_name":"a.exe","size":100}`, wantStatus: http.StatusUnsupportedMediaType, wantCode: response.ErrCodeUnsupportedFileType},
+		{name: "chunks too small", body: `{"file_name":"a.pdf","size":100,"chunk_size":1024}`, wantStatus: http.StatusBadRequest, wantCode: response.ErrCodeBadRequest},
+		{name: "bad hash", body: `{"file_name":"a.pdf","size":100,"sha256":"abc"}`, wantStatus: http.StatusBadRequest, wantCode: response.ErrCodeBadRequest},
+		{name: "bad document id", body: `{"file_name":"a.pdf","size":100,"document_id":"../x"}`, wantStatus: http.StatusBadRequest, wantCode: response.ErrCodeBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t, uploadModels...)
+			useTestStorage(t)
+			project := createTestProject(t, uuid.New(), `[]`)
+			status, body := uploadClient{t, project, project.UserID.String()}.create(tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, tt.wantStatus, body)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, body); code != tt.wantCode {
+					t.Errorf("code = %s, want %s", code, tt.wantCode)
+				}
+				return
+			}
+			var upload repository.DocumentUpload
+			json.Unmarshal(body, &upload)
+			if upload.FileName != "a.pdf" || upload.ChunkSize != defaultUploadChunkSize {
+				t.Errorf("upload of %q in chunks of %d, want a.pdf in %d", upload.FileName, upload.ChunkSize, defaultUploadChunkSize)
+			}
+		})
+	}
+}
+
+func TestCompleteUploadHashMismatch(t *testing.T) {
+	useTestDB(t, uploadModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	client := uploadClient{t, project, project.UserID.String()}
+
+	status, body := client.create(`{"file_name":"a.txt","size":5,"chunk_size":65536,"sha256":"` + strings.Repeat("ab", 32) + `"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", status, body)
+	}
+	var upload repository.DocumentUpload
+	json.Unmarshal(body, &upload)
+	if status, body := client.put(upload.ID.String(), 0, []byte("hello"), nil); status != http.StatusOK {
+		t.Fatalf("chunk: status %d: %s", status, body)
+	}
+	status, body = client.complete(upload.ID.String())
+	if status != http.StatusUnprocessableEntity || errorCode(t, body) != response.ErrCodeHashMismatch {
+		t.Fatalf("complete: status %d: %s, want 422 %s", status, body, response.ErrCodeHashMismatch)
+	}
+	if docs, _ := repository.NewDocument(repository.GetDB()).ListByProject(project.ID.String()); len(docs) != 0 {
+		t.Errorf("%d documents stored from a corrupt upload", len(docs))
+	}
+	// The chunks stay so the client can resend the bad one
+	if status, _ := client.get(upload.ID.String()); status != http.StatusOK {
+		t.Errorf("upload after a hash mismatch: status %d, want it kept", status)
+	}
+}
+
+func TestPurgeExpiredUploads(t *testing.T) {
+	useTestDB(t, uploadModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	uploads := repository.NewDocumentUpload(repository.GetDB())
+	projectRepo := repository.NewProject(repository.GetDB())
+
+	newUpload := func(expiresAt time.Time) *repository.DocumentUpload {
+		upload, err := uploads.Create(&repository.DocumentUpload{
+			ProjectID: project.ID, UserID: project.UserID, FileName: "a.txt", Size: 5, ChunkSize: 65536, ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := uploadChunkKey(project, upload.ID, 0)
+		os.MkdirAll(uploadDir(project, upload.ID), 0o755)
+		if err := os.WriteFile(key, []byte("hello"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return upload
+	}
+	expired := newUpload(time.Now().Add(-time.Minute))
+	active := newUpload(time.Now().Add(time.Hour))
+
+	purgeExpiredUploads(uploads, projectRepo)
+
+	if got, _ := uploads.Get(project.ID.String(), expired.ID.String()); got != nil {
+		t.Error("expired upload kept")
+	}
+	if _, err := os.Stat(uploadDir(project, expired.ID)); !os.IsNotExist(err) {
+		t.Errorf("chunks of the expired upload kept: %v", err)
+	}
+	if got, _ := uploads.Get(project.ID.String(), active.ID.String()); got == nil {
+		t.Error("active upload purged")
+	}
+	if _, err := os.Stat(uploadChunkKey(project, active.ID, 0)); err != nil {
+		t.Errorf("chunks of the active upload removed: %v", err)
+	}
+}
+
+func TestExpiredUpload(t *testing.T) {
+	useTestDB(t, uploadModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	client := uploadClient{t, project, project.UserID.String()}
+
+	status, body := client.create(`{"file_name":"a.txt","size":5,"chunk_size":65536}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", status, body)
+	}
+	var upload repository.DocumentUpload
+	json.Unmarshal(body, &upload)
+	if status, body := client.put(upload.ID.String(), 0, []byte("hello"), nil); status != http.StatusOK {
+		t.Fatalf("chunk: status %d: %s", status, body)
+	}
+	err := repository.GetDB().Model(&repository.DocumentUpload{}).Where("id = ?", upload.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := map[string]func() (int, []byte){
+		"get":      func() (int, []byte) { return client.get(upload.ID.String()) },
+		"chunk":    func() (int, []byte) { return client.put(upload.ID.String(), 0, []byte("hello"), nil) },
+		"complete": func() (int, []byte) { return client.complete(upload.ID.String()) },
+	}
+	for name, do := range steps {
+		if status, body := do(); status != http.StatusGone || errorCode(t, body) != response.ErrCodeGone {
+			t.Errorf("%s: status %d: %s, want 410 %s", name, status, body, response.ErrCodeGone)
+		}
+	}
+	if docs, _ := repository.NewDocument(repository.GetDB()).ListByProject(project.ID.String()); len(docs) != 0 {
+		t.Errorf("%d documents stored from an expired upload", len(docs))
+	}
+}
+
+func TestUploadQuotaCountsPendingUploads(t *testing.T) {
+	t.Setenv("STORAGE_QUOTA_BYTES", "100")
+	useTestDB(t, uploadModels...)
+	useTestStorage(t)
+	project := createTestProject(t, uuid.New(), `[]`)
+	client := uploadClient{t, project, project.UserID.String()}
+
+	create := func(size int) string {
+		t.Helper()
+		status, body := client.create(`{"file_name":"a.txt","size":` + strconv.Itoa(size) + `,"chunk_size":65536}`)
+		if status != http.StatusCreated {
+			t.Fatalf("create %d bytes: status %d: %s", size, status, body)
+		}
+		var upload repository.DocumentUpload
+		json.Unmarshal(body, &upload)
+		return upload.ID.String()
+	}
+	first := create(60)
+	second := create(40)
+
+	// Parallel uploads each under the quota can't add up to more than it
+	status, body := client.create(`{"file_name":"b.txt","size":1,"chunk_size":65536}`)
+	if status != http.StatusRequestEntityTooLarge || errorCode(t, body) != response.ErrCodeStorageQuotaExceeded {
+		t.Fatalf("create over the pending uploads: status %d: %s, want 413", status, body)
+	}
+
+	// An upload is not counted against itself on completion
+	if status, body := client.put(second, 0, bytes.Repeat([]byte("b"), 40), nil); status != http.StatusOK {
+		t.Fatalf("chunk: status %d: %s", status, body)
+	}
+	if status, body := client.complete(second); status != http.StatusCreated {
+		t.Fatalf("complete within the quota: status %d: %s", status, body)
+	}
+
+	// Completion checks the quota again: a smaller quota refuses the rest
+	t.Setenv("STORAGE_QUOTA_BYTES", "90")
+	if status, body := client.put(first, 0, bytes.Repeat([]byte("a"), 60), nil); status != http.StatusOK {
+		t.Fatalf("chunk: status %d: %s", status, body)
+	}
+	status, body = client.complete(first)
+	if status != http.StatusRequestEntityTooLarge || errorCode(t, body) != response.ErrCodeStorageQuotaExceeded {
+		t.Fatalf("complete over the quota: status %d: %s, want 413", status, body)
+	}
+	if docs, _ := repository.NewDocument(repository.GetDB()).ListByProject(project.ID.String()); len(docs) != 1 {
+		t.Errorf("%d documents stored, want the upload within the quota only", len(docs))
+	}
+}
@@ -1,22 +1,33 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"manju/backend/events"
 	"manju/backend/models/request"
+	"manju/backend/models/response"
 	"manju/backend/repository"
+	"manju/backend/storage"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/datatypes"
 )
 
 func CreateUser(c *fiber.Ctx, repo *repository.UserRepository) error {
 	var body request.CreateUserPayload
 	if err := c.BodyParser(&body); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
 	}
 	if body.Email == "" || body.Name == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "email and name are required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "email and name are required", nil)
 	}
 
 	user := repository.User{
@@ -33,7 +44,7 @@ func CreateUser(c *fiber.Ctx, repo *repository.UserRepository) error {
 	if body.Info != nil {
 		b, err := json.Marshal(body.Info)
 		if err != nil {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid info"})
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid info", nil)
 		}
 		user.Info = datatypes.JSON(b)
 	}
@@ -41,18 +52,20 @@ func CreateUser(c *fiber.Ctx, repo *repository.UserRepository) error {
 	created, err := repo.Create(&user)
 	if err != nil {
 		if err.Error() == "email_already_registered" {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "email already registered"})
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "email already registered", nil)
 		}
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
+	RecordAudit(c, "user.create", "user", created.ID.String(), fiber.Map{"email": created.Email})
+
 	return c.Status(http.StatusCreated).JSON(created)
 }
 
 func ListUsers(c *fiber.Ctx, repo *repository.UserRepository) error {
-	users, err := repo.List()
+	users, err := repo.WithContext(c.UserContext()).List()
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 	return c.JSON(users)
 }
@@ -61,10 +74,10 @@ func GetUser(c *fiber.Ctx, repo *repository.UserRepository) error {
 	id := c.Params("id")
 	user, err := repo.GetByID(id)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 	if user == nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
 	}
 	return c.JSON(user)
 }
@@ -73,62 +86,225 @@ func UpdateUser(c *fiber.Ctx, repo *repository.UserRepository) error {
 	id := c.Params("id")
 	payload := make(map[string]interface{})
 	if err := c.BodyParser(&payload); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
 	}
 
 	// convert Info to JSON if present
 	if info, ok := payload["info"]; ok {
 		b, err := json.Marshal(info)
 		if err != nil {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid info"})
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid info", nil)
 		}
 		payload["info"] = datatypes.JSON(b)
 	}
 
+	var previous *repository.User
+	_, changesRole := payload["role"]
+	_, changesStatus := payload["status"]
+	if changesRole || changesStatus {
+		previous, _ = repo.GetByID(id)
+	}
+
 	updated, err := repo.Update(id, payload)
 	if err != nil {
 		if err.Error() == "email_already_registered" {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "email already registered"})
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "email already registered", nil)
 		}
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 	if updated == nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
+	}
+
+	fields := make([]string, 0, len(payload))
+	for k := range payload {
+		if k != "updated_at" {
+			fields = append(fields, k)
+		}
+	}
+	RecordAudit(c, "user.update", "user", id, fiber.Map{"fields": fields})
+	if previous != nil && previous.Role != updated.Role {
+		RecordAudit(c, "user.role_change", "user", id, fieldChange{From: previous.Role, To: updated.Role})
+	}
+	if previous != nil && previous.Status != updated.Status && updated.Status == repository.StatusSuspended {
+		events.Publish(events.UserSuspended{UserID: id, At: time.Now()})
 	}
+
 	return c.JSON(updated)
 }
 
+// UpdateUserStatus sets a user's status and the reason for it. Admins can't
+// change their own status, so they can't lock themselves out.
+func UpdateUserStatus(c *fiber.Ctx, repo *repository.UserRepository) error {
+	id := c.Params("id")
+	var body request.UpdateUserStatusPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if !body.Status.Valid() {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "status must be active, inactive or suspended", nil)
+	}
+	if userID, _ := c.Locals("userID").(string); userID == id {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "you can't change your own status", nil)
+	}
+	if body.Status == repository.StatusActive {
+		body.Reason = ""
+	}
+
+	previous, err := repo.GetByID(id)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if previous == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
+	}
+	updated, err := repo.Update(id, map[string]interface{}{"status": body.Status, "status_reason": body.Reason})
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if updated == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
+	}
+
+	RecordAudit(c, "user.status_change", "user", id, fiber.Map{
+		"from":   previous.Status,
+		"to":     updated.Status,
+		"reason": updated.StatusReason,
+	})
+	if previous.Status != updated.Status && updated.Status == repository.StatusSuspended {
+		events.Publish(events.UserSuspended{UserID: id, At: time.Now()})
+	}
+	return c.JSON(updated)
+}
+
+// ListUsersByStatus lists the users with the status given by ?status=
+func ListUsersByStatus(c *fiber.Ctx, repo *repository.UserRepository) error {
+	status := repository.Status(c.Query("status"))
+	if !status.Valid() {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "status must be active, inactive or suspended", nil)
+	}
+	users, err := repo.GetByStatus(status)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(users)
+}
+
 func DeleteUser(c *fiber.Ctx, repo *repository.UserRepository) error {
 	id := c.Params("id")
-	ok, err := repo.Delete(id)
+	user, err := repo.GetByID(id)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
-	if !ok {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	if user == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
 	}
+
+	deleted, err := DeleteUserWithCascade(id)
+	if err != nil {
+		details := fiber.Map{"completed": deleted, "rolled_back": true}
+		var cascadeErr *repository.CascadeError
+		if errors.As(err, &cascadeErr) {
+			details["failed_step"] = cascadeErr.Step
+		} else {
+			details["rolled_back"] = false
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), details)
+	}
+
+	RecordAudit(c, "user.delete", "user", id, fiber.Map{"email": user.Email, "deleted": deleted})
+
 	return c.SendStatus(http.StatusNoContent)
 }
 
+// DeleteUserWithCascade erases a user and all of their data: database rows are
+// removed in one transaction, then the user's document directories are wiped.
+func DeleteUserWithCascade(userID string) ([]repository.DeletedCount, error) {
+	// userID names a directory below, so make sure it can't escape the storage root
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, fmt.Errorf("invalid user id: %w", err)
+	}
+
+	// Project files and indexes are keyed by project, so collect them before the rows are gone
+	projects, err := repository.NewProject(repository.GetDB()).GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions may also be cached outside PostgreSQL; note them so they can be evicted
+	sessions, err := repository.NewSession(repository.GetDB()).ListByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := repository.New(repository.GetDB()).DeleteWithCascade(userID)
+	for _, d := range deleted {
+		log.Printf("[users] erase %s: deleted %d %s", userID, d.Count, d.Resource)
+	}
+	if err != nil {
+		log.Printf("[users] erase %s failed, rolled back: %v", userID, err)
+		return deleted, err
+	}
+
+	if err := storage.DeletePrefix(context.Background(), documentStorage, filepath.Join(getDocumentsStoragePath(), userID)); err != nil {
+		log.Printf("[users] erase %s: failed to remove documents: %v", userID, err)
+		return deleted, fmt.Errorf("database rows deleted but documents were not removed: %w", err)
+	}
+	log.Printf("[users] erase %s: removed document directories", userID)
+	if err := os.Remove(avatarPath(userID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[users] erase %s: failed to remove avatar: %v", userID, err)
+	}
+	for i := range projects {
+		cleanupProjectData(&projects[i])
+	}
+	for _, sess := range sessions {
+		if err := repository.Sessions().Delete(sess.ID.String()); err != nil {
+			log.Printf("[users] erase %s: failed to evict session %s: %v", userID, sess.ID, err)
+		}
+	}
+
+	return deleted, nil
+}
+
+// SaveAPIKeyPayload is the body of PUT /users/:id/api-key
+type SaveAPIKeyPayload struct {
+	APIKey string `json:"api_key"`
+}
+
+// SaveAPIKeyResponse is the response of PUT /users/:id/api-key
+type SaveAPIKeyResponse struct {
+	Message   string `json:"message"`
+	MaskedKey string `json:"masked_key"`
+}
+
+// APIKeyStatus is the response of GET /users/:id/api-key
+type APIKeyStatus struct {
+	HasKey    bool   `json:"has_key"`
+	MaskedKey string `json:"masked_key"`
+}
+
 // SaveAPIKey encrypts and stores a user's API key
 func SaveAPIKey(c *fiber.Ctx, repo *repository.UserRepository) error {
 	id := c.Params("id")
 
-	var body struct {
-		APIKey string `json:"api_key"`
-	}
+	var body SaveAPIKeyPayload
 	if err := c.BodyParser(&body); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
 	}
 
 	if body.APIKey == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "api_key is required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "api_key is required", nil)
+	}
+
+	// The legacy per-user key is always an OpenAI key
+	if ok, err := checkAPIKey(c, "openai", body.APIKey); !ok {
+		return err
 	}
 
 	// Encrypt the API key
 	encrypted, err := EncryptAPIKey(body.APIKey)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to encrypt key"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to encrypt key", nil)
 	}
 
 	// Update the user's encrypted API key
@@ -136,10 +312,12 @@ func SaveAPIKey(c *fiber.Ctx, repo *repository.UserRepository) error {
 		"encrypted_api_key": encrypted,
 	})
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 
-	return c.JSON(fiber.Map{"message": "API key saved successfully", "masked_key": MaskAPIKey(body.APIKey)})
+	RecordAudit(c, "api_key.save", "user", id, fiber.Map{"masked_key": MaskAPIKey(body.APIKey)})
+
+	return c.JSON(SaveAPIKeyResponse{Message: "API key saved successfully", MaskedKey: MaskAPIKey(body.APIKey)})
 }
 
 // GetAPIKey returns a masked version of the user's API key
@@ -148,21 +326,21 @@ func GetAPIKey(c *fiber.Ctx, repo *repository.UserRepository) error {
 
 	user, err := repo.GetByID(id)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 	if user == nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
 	}
 
 	if user.EncryptedAPIKey == "" {
-		return c.JSON(fiber.Map{"has_key": false, "masked_key": ""})
+		return c.JSON(APIKeyStatus{HasKey: false})
 	}
 
 	// Decrypt only to mask it
 	decrypted, err := DecryptAPIKey(user.EncryptedAPIKey)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to decrypt key"})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to decrypt key", nil)
 	}
 
-	return c.JSON(fiber.Map{"has_key": true, "masked_key": MaskAPIKey(decrypted)})
+	return c.JSON(APIKeyStatus{HasKey: true, MaskedKey: MaskAPIKey(decrypted)})
 }
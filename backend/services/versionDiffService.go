@@ -0,0 +1,193 @@
+package services
+
+import (
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WorkflowDiff is the structural difference between two versions of a
+// project's workflow. Items are matched by their "id", so a node whose label
+// changed is reported as modified (and renamed), not as removed and added.
+type WorkflowDiff struct {
+	From        int            `json:"from"`
+	To          int            `json:"to"`
+	Nodes       nodeDiff       `json:"nodes"`
+	Connections connectionDiff `json:"connections"`
+}
+
+// nodeDiff lists nodes added, removed and modified between two versions,
+// each sorted by ID
+type nodeDiff struct {
+	Added    []map[string]interface{} `json:"added"`
+	Removed  []map[string]interface{} `json:"removed"`
+	Modified []nodeChange             `json:"modified"`
+}
+
+// nodeChange is a node present in both versions with different contents
+type nodeChange struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	// OldLabel is set when the node was renamed
+	OldLabel string `json:"old_label,omitempty"`
+	// ChangedFields lists the changed top-level fields, and "data.<key>" for
+	// each changed key of the node's data
+	ChangedFields []string `json:"changed_fields"`
+}
+
+// connectionDiff lists connections added, removed and modified (same ID,
+// different endpoints or handles), each sorted by ID
+type connectionDiff struct {
+	Added    []map[string]interface{} `json:"added"`
+	Removed  []map[string]interface{} `json:"removed"`
+	Modified []connectionChange       `json:"modified"`
+}
+
+// connectionChange is a connection present in both versions with different contents
+type connectionChange struct {
+	ID     string                 `json:"id"`
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+}
+
+// DiffProjectVersions returns the structural diff between versions :a and :b
+// of a project; the current version is read from the project itself
+func DiffProjectVersions(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+
+	from, errFrom := strconv.Atoi(c.Params("a"))
+	to, errTo := strconv.Atoi(c.Params("b"))
+	if errFrom != nil || errTo != nil || from < 1 || to < 1 {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "versions must be positive integers", nil)
+	}
+
+	load := func(version int) (*repository.Project, error) {
+		if version == project.Version {
+			return project, nil
+		}
+		v, err := repo.GetVersion(project.ID.String(), version)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return &repository.Project{Nodes: v.Nodes, Connections: v.Connections}, nil
+	}
+	a, err := load(from)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	b, err := load(to)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	if a == nil || b == nil {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "version not found", nil)
+	}
+
+	diff := diffWorkflows(a, b)
+	diff.From, diff.To = from, to
+	return c.JSON(diff)
+}
+
+// diffWorkflows computes the structural diff from a's workflow to b's
+func diffWorkflows(a, b *repository.Project) WorkflowDiff {
+	aNodes, aConns := parseWorkflow(a)
+	bNodes, bConns := parseWorkflow(b)
+
+	diff := WorkflowDiff{
+		Nodes:       nodeDiff{Added: []map[string]interface{}{}, Removed: []map[string]interface{}{}, Modified: []nodeChange{}},
+		Connections: connectionDiff{Added: []map[string]interface{}{}, Removed: []map[string]interface{}{}, Modified: []connectionChange{}},
+	}
+
+	before, after := indexByID(aNodes), indexByID(bNodes)
+	for _, id := range unionIDs(before, after) {
+		old, cur := before[id], after[id]
+		switch {
+		case old == nil:
+			diff.Nodes.Added = append(diff.Nodes.Added, cur)
+		case cur == nil:
+			diff.Nodes.Removed = append(diff.Nodes.Removed, old)
+		case !sameItem(old, cur):
+			change := nodeChange{ID: id, Label: nodeLabel(cur), ChangedFields: changedNodeFields(old, cur)}
+			if oldLabel := nodeLabel(old); oldLabel != change.Label {
+				change.OldLabel = oldLabel
+			}
+			diff.Nodes.Modified = append(diff.Nodes.Modified, change)
+		}
+	}
+
+	before, after = indexByID(aConns), indexByID(bConns)
+	for _, id := range unionIDs(before, after) {
+		old, cur := before[id], after[id]
+		switch {
+		case old == nil:
+			diff.Connections.Added = append(diff.Connections.Added, cur)
+		case cur == nil:
+			diff.Connections.Removed = append(diff.Connections.Removed, old)
+		case !sameItem(old, cur):
+			diff.Connections.Modified = append(diff.Connections.Modified, connectionChange{ID: id, Before: old, After: cur})
+		}
+	}
+	return diff
+}
+
+// unionIDs returns the keys of both maps, sorted
+func unionIDs(a, b map[string]map[string]interface{}) []string {
+	ids := make([]string, 0, len(a)+len(b))
+	for id := range a {
+		ids = append(ids, id)
+	}
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// changedNodeFields lists the fields that differ between two versions of a
+// node, descending into its data map, sorted
+func changedNodeFields(old, cur map[string]interface{}) []string {
+	var fields []string
+	for _, key := range unionKeys(old, cur) {
+		if key == "data" {
+			oldData, _ := old["data"].(map[string]interface{})
+			curData, _ := cur["data"].(map[string]interface{})
+			if oldData != nil && curData != nil {
+				for _, dataKey := range unionKeys(oldData, curData) {
+					if !reflect.DeepEqual(oldData[dataKey], curData[dataKey]) {
+						fields = append(fields, "data."+dataKey)
+					}
+				}
+				continue
+			}
+		}
+		if !reflect.DeepEqual(old[key], cur[key]) {
+			fields = append(fields, key)
+		}
+	}
+	return fields
+}
+
+// unionKeys returns the keys of both maps, sorted
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
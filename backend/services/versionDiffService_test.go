@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// diffFixture is a pair of workflows in testdata/diff
+type diffFixture struct {
+	A struct {
+		Nodes       json.RawMessage `json:"nodes"`
+		Connections json.RawMessage `json:"connections"`
+	} `json:"a"`
+	B struct {
+		Nodes       json.RawMessage `json:"nodes"`
+		Connections json.RawMessage `json:"connections"`
+	} `json:"b"`
+}
+
+// TestDiffWorkflowsGolden locks the diff format: each testdata/diff/<case>.json
+// holds two workflows, and <case>.golden the diff between them. Run with
+// -update to rewrite the golden files after an intended format change.
+func TestDiffWorkflowsGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "diff", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no diff fixtures in testdata/diff")
+	}
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var f diffFixture
+			if err := json.Unmarshal(raw, &f); err != nil {
+				t.Fatalf("fixture: %v", err)
+			}
+
+			diff := diffWorkflows(
+				&repository.Project{Nodes: datatypes.JSON(f.A.Nodes), Connections: datatypes.JSON(f.A.Connections)},
+				&repository.Project{Nodes: datatypes.JSON(f.B.Nodes), Connections: datatypes.JSON(f.B.Connections)},
+			)
+			diff.From, diff.To = 1, 2
+			got, err := json.MarshalIndent(diff, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "diff", name+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("golden file: %v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("diff differs from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestDiffProjectVersions(t *testing.T) {
+	owner, stranger := uuid.New(), uuid.New()
+	tests := []struct {
+		name        string
+		userID      uuid.UUID
+		a, b        string
+		wantStatus  int
+		wantAdded   int
+		wantRemoved int
+	}{
+		{name: "two snapshots", userID: owner, a: "1", b: "2", wantStatus: http.StatusOK, wantAdded: 1},
+		{name: "a snapshot and the current version", userID: owner, a: "1", b: "3", wantStatus: http.StatusOK, wantAdded: 2},
+		{name: "backwards", userID: owner, a: "3", b: "1", wantStatus: http.StatusOK, wantRemoved: 2},
+		{name: "pruned version", userID: owner, a: "1", b: "9", wantStatus: http.StatusNotFound},
+		{name: "not a version", userID: owner, a: "1", b: "latest", wantStatus: http.StatusBadRequest},
+		{name: "version zero", userID: owner, a: "0", b: "1", wantStatus: http.StatusBadRequest},
+		{name: "someone else's project", userID: stranger, a: "1", b: "2", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useTestDB(t, projectListModels...)
+			repo := repository.NewProject(db)
+			project := createTestProject(t, owner, `[{"id":"in","type":"text-input","data":{}}]`)
+			if err := db.Create(&repository.ProjectVersion{ProjectID: project.ID, Version: 1, Nodes: project.Nodes, Connections: project.Connections}).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, nodes := range []string{
+				`[{"id":"in","type":"text-input","data":{}},{"id":"model","type":"ai-model","data":{}}]`,
+				`[{"id":"in","type":"text-input","data":{}},{"id":"model","type":"ai-model","data":{}},{"id":"out","type":"text-output","data":{}}]`,
+			} {
+				if _, err := repo.UpdateLocked(project.ID.String(), func(p *repository.Project) error {
+					p.Nodes = datatypes.JSON(nodes)
+					return nil
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			resp := serveAs(t, tt.userID.String(), "/projects/:id/versions/:a/diff/:b", func(c *fiber.Ctx) error {
+				return DiffProjectVersions(c, repo)
+			}, newRequest("GET", "/projects/"+project.ID.String()+"/versions/"+tt.a+"/diff/"+tt.b, "", nil))
+			body := readBody(t, resp)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var diff WorkflowDiff
+			if err := json.Unmarshal(body, &diff); err != nil {
+				t.Fatalf("response %s: %v", body, err)
+			}
+			if added, removed := len(diff.Nodes.Added), len(diff.Nodes.Removed); added != tt.wantAdded || removed != tt.wantRemoved {
+				t.Errorf("%d nodes added and %d removed, want %d and %d", added, removed, tt.wantAdded, tt.wantRemoved)
+			}
+		})
+	}
+}
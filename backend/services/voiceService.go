@@ -2,6 +2,7 @@ package services
 
 import (
 	"manju/backend/models/request"
+	"manju/backend/models/response"
 	"manju/backend/repository"
 	"net/http"
 
@@ -12,15 +13,15 @@ import (
 func CreateVoice(c *fiber.Ctx, repo *repository.VoiceRepository) error {
 	var body request.CreateVoicePayload
 	if err := c.BodyParser(&body); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
 	}
 	if body.VoiceName == "" || body.VoiceURL == "" || body.UserID == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "voice_name, voice_url and user_id are required"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "voice_name, voice_url and user_id are required", nil)
 	}
 
 	uid, err := uuid.Parse(body.UserID)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid user_id"})
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid user_id", nil)
 	}
 
 	v := repository.Voice{
@@ -32,24 +33,27 @@ func CreateVoice(c *fiber.Ctx, repo *repository.VoiceRepository) error {
 
 	created, err := repo.Create(&v)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
+
+	RecordAudit(c, "voice.create", "voice", created.ID.String(), fiber.Map{"voice_name": created.VoiceName})
+
 	return c.Status(http.StatusCreated).JSON(created)
 }
 
 func ListVoices(c *fiber.Ctx, repo *repository.VoiceRepository) error {
-	voices, err := repo.List()
+	voices, err := repo.WithContext(c.UserContext()).List()
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 	return c.JSON(voices)
 }
 
 func ListVoicesByUser(c *fiber.Ctx, repo *repository.VoiceRepository) error {
 	userID := c.Params("user_id")
-	voices, err := repo.ListByUser(userID)
+	voices, err := repo.WithContext(c.UserContext()).ListByUser(userID)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 	return c.JSON(voices)
 }
@@ -58,10 +62,10 @@ func GetVoice(c *fiber.Ctx, repo *repository.VoiceRepository) error {
 	id := c.Params("id")
 	v, err := repo.GetByID(id)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 	if v == nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
 	}
 	return c.JSON(v)
 }
@@ -70,10 +74,13 @@ func DeleteVoice(c *fiber.Ctx, repo *repository.VoiceRepository) error {
 	id := c.Params("id")
 	ok, err := repo.Delete(id)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
 	}
 	if !ok {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "not found", nil)
 	}
+
+	RecordAudit(c, "voice.delete", "voice", id, nil)
+
 	return c.SendStatus(http.StatusNoContent)
 }
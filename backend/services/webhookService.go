@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"manju/backend/events"
+	"manju/backend/metrics"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// WebhookEventExecutionCompleted is sent after a workflow execution succeeds
+const WebhookEventExecutionCompleted = "execution.completed"
+
+// webhookEvents lists the events a webhook can subscribe to
+var webhookEvents = map[string]bool{
+	WebhookEventExecutionCompleted: true,
+}
+
+// webhookRetryDelays are the waits before the second and third delivery attempts
+var webhookRetryDelays = []time.Duration{2 * time.Second, 4 * time.Second}
+
+// WebhookPayload is the request body for creating or updating a webhook
+type WebhookPayload struct {
+	URL     *string   `json:"url"`
+	Secret  *string   `json:"secret"`
+	Events  *[]string `json:"events"`
+	Enabled *bool     `json:"enabled"`
+}
+
+// webhookClient delivers webhooks. It only connects to public addresses, so
+// a webhook can't be pointed at the server's own network, and only follows
+// redirects to URLs a webhook could be created with.
+var webhookClient = &http.Client{
+	Timeout:       10 * time.Second,
+	Transport:     &http.Transport{DialContext: publicDialContext, Proxy: nil},
+	CheckRedirect: checkWebhookRedirect,
+}
+
+// maxWebhookRedirects is how many redirects a delivery follows
+const maxWebhookRedirects = 5
+
+// checkWebhookRedirect refuses redirects to URLs validateWebhookURL rejects
+func checkWebhookRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxWebhookRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxWebhookRedirects)
+	}
+	return validateWebhookURL(req.Context(), req.URL.String())
+}
+
+// validateWebhookURL accepts absolute http(s) URLs of public hosts. A host
+// that doesn't resolve is accepted, since it may not be set up yet;
+// deliveries only dial public addresses either way.
+func validateWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if !isPublicIP(ip) {
+			return errors.New("url must point to a public address")
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip.IP) {
+			return errors.New("url must point to a public address")
+		}
+	}
+	return nil
+}
+
+// validateWebhookEvents rejects empty or unknown event lists
+func validateWebhookEvents(list []string) error {
+	if len(list) == 0 {
+		return errors.New("events must not be empty")
+	}
+	for _, e := range list {
+		if !webhookEvents[e] {
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+	return nil
+}
+
+// generateWebhookSecret returns a random hex secret
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// signWebhookBody returns the hex HMAC-SHA256 of body keyed by secret
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookCreated is the response of POST /projects/:id/webhooks
+type WebhookCreated struct {
+	Webhook *repository.Webhook `json:"webhook"`
+	Secret  string              `json:"secret"` // only ever returned here
+}
+
+// CreateWebhook registers a webhook on a project. The signing secret is
+// returned only in this response; it is generated when not provided.
+func CreateWebhook(c *fiber.Ctx, repo *repository.ProjectRepository, webhookRepo *repository.WebhookRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	var body WebhookPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if body.URL == nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "url is required", nil)
+	}
+	if err := validateWebhookURL(c.UserContext(), *body.URL); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+	}
+	eventList := []string{WebhookEventExecutionCompleted}
+	if body.Events != nil {
+		eventList = *body.Events
+	}
+	if err := validateWebhookEvents(eventList); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+	}
+
+	secret := ""
+	if body.Secret != nil {
+		secret = *body.Secret
+	}
+	if secret == "" {
+		if secret, err = generateWebhookSecret(); err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to generate secret", nil)
+		}
+	}
+	encrypted, err := EncryptAPIKey(secret)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to encrypt secret", nil)
+	}
+
+	webhook := repository.Webhook{
+		ProjectID: project.ID,
+		URL:       *body.URL,
+		Secret:    encrypted,
+		Events:    eventList,
+		Enabled:   true,
+	}
+	if body.Enabled != nil {
+		webhook.Enabled = *body.Enabled
+	}
+
+	created, err := webhookRepo.Create(&webhook)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "webhook.create", "webhook", created.ID.String(), fiber.Map{"project_id": project.ID, "url": created.URL, "events": created.Events})
+
+	return c.Status(http.StatusCreated).JSON(WebhookCreated{Webhook: created, Secret: secret})
+}
+
+// ListWebhooks returns the webhooks of a project
+func ListWebhooks(c *fiber.Ctx, repo *repository.ProjectRepository, webhookRepo *repository.WebhookRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	webhooks, err := webhookRepo.ListByProject(project.ID.String())
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+	return c.JSON(webhooks)
+}
+
+// UpdateWebhook changes a webhook's URL, secret, events or enabled flag
+func UpdateWebhook(c *fiber.Ctx, repo *repository.ProjectRepository, webhookRepo *repository.WebhookRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	webhook, err := webhookRepo.GetByID(project.ID.String(), c.Params("webhookId"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "webhook not found", nil)
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	var body WebhookPayload
+	if err := c.BodyParser(&body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+
+	diff := map[string]fieldChange{}
+	if body.URL != nil {
+		if err := validateWebhookURL(c.UserContext(), *body.URL); err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+		}
+		diff["url"] = fieldChange{From: webhook.URL, To: *body.URL}
+		webhook.URL = *body.URL
+	}
+	if body.Events != nil {
+		if err := validateWebhookEvents(*body.Events); err != nil {
+			return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+		}
+		diff["events"] = fieldChange{From: webhook.Events, To: *body.Events}
+		webhook.Events = *body.Events
+	}
+	if body.Enabled != nil {
+		diff["enabled"] = fieldChange{From: webhook.Enabled, To: *body.Enabled}
+		webhook.Enabled = *body.Enabled
+	}
+	if body.Secret != nil && *body.Secret != "" {
+		encrypted, err := EncryptAPIKey(*body.Secret)
+		if err != nil {
+			return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to encrypt secret", nil)
+		}
+		diff["secret"] = fieldChange{From: "changed", To: "changed"}
+		webhook.Secret = encrypted
+	}
+
+	updated, err := webhookRepo.Update(webhook)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "webhook.update", "webhook", updated.ID.String(), diff)
+
+	return c.JSON(updated)
+}
+
+// DeleteWebhook removes a webhook from a project
+func DeleteWebhook(c *fiber.Ctx, repo *repository.ProjectRepository, webhookRepo *repository.WebhookRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	webhook, err := webhookRepo.GetByID(project.ID.String(), c.Params("webhookId"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "webhook not found", nil)
+		}
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	if err := webhookRepo.Delete(project.ID.String(), webhook.ID.String()); err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	RecordAudit(c, "webhook.delete", "webhook", webhook.ID.String(), fiber.Map{"project_id": project.ID, "url": webhook.URL})
+
+	return c.JSON(response.MessageResponse{Message: "webhook deleted"})
+}
+
+// dispatchExecutionWebhooks is the event consumer that notifies the project's
+// webhooks about a completed execution. Each delivery runs in its own goroutine
+// so retries never hold up the event workers.
+func dispatchExecutionWebhooks(e events.DemoCompleted) {
+	webhooks, err := repository.NewWebhook(repository.GetDB()).ListActiveByProject(e.ProjectID)
+	if err != nil {
+		log.Printf("[webhook] failed to load webhooks for project %s: %v", e.ProjectID, err)
+		return
+	}
+
+	body, err := json.Marshal(fiber.Map{
+		"event":              WebhookEventExecutionCompleted,
+		"project_id":         e.ProjectID,
+		"execution_id":       e.ExecutionID,
+		"user_id":            e.UserID,
+		"response":           e.Response,
+		"model_used":         e.ModelUsed,
+		"processing_time_ms": e.ProcessingTimeMs,
+		"nodes_executed":     e.NodesExecuted,
+		"timestamp":          e.At.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("[webhook] failed to encode payload: %v", err)
+		return
+	}
+
+	for i := range webhooks {
+		if !webhooks[i].Subscribed(WebhookEventExecutionCompleted) {
+			continue
+		}
+		go deliverWebhook(webhooks[i], WebhookEventExecutionCompleted, body)
+	}
+}
+
+// deliverWebhook POSTs a signed payload, retrying with exponential backoff
+func deliverWebhook(webhook repository.Webhook, event string, body []byte) {
+	secret, err := DecryptAPIKey(webhook.Secret)
+	if err != nil {
+		log.Printf("[webhook] failed to decrypt secret for webhook %s: %v", webhook.ID, err)
+		return
+	}
+	signature := signWebhookBody(secret, body)
+
+	for attempt := 0; ; attempt++ {
+		err := postWebhook(webhookClient, webhook.URL, event, signature, body)
+		if err == nil {
+			metrics.Inc("webhook_deliveries_succeeded")
+			return
+		}
+		if attempt >= len(webhookRetryDelays) {
+			log.Printf("[webhook] delivery to %s failed after %d attempts: %v", webhook.URL, attempt+1, err)
+			metrics.Inc("webhook_deliveries_failed")
+			return
+		}
+		metrics.Inc("webhook_delivery_retries")
+		time.Sleep(webhookRetryDelays[attempt])
+	}
+}
+
+// postWebhook sends one delivery attempt; any non-2xx status is an error
+func postWebhook(client *http.Client, target, event, signature string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Manju-Event", event)
+	req.Header.Set("X-Manju-Signature", signature)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://93.184.216.34/hook"},
+		{url: "http://93.184.216.34:8080/hook?x=1"},
+		{url: "https://[2606:4700:4700::1111]/hook"},
+		{url: "ftp://93.184.216.34/hook", wantErr: true},
+		{url: "/hook", wantErr: true},
+		{url: "http://:80/hook", wantErr: true},
+		{url: "http://127.0.0.1:8080/hook", wantErr: true},
+		{url: "http://localhost/hook", wantErr: true},
+		{url: "http://169.254.169.254/latest/meta-data/", wantErr: true},
+		{url: "http://10.0.0.5/hook", wantErr: true},
+		{url: "http://192.168.1.1/hook", wantErr: true},
+		{url: "http://100.64.0.1/hook", wantErr: true},
+		{url: "http://[::1]/hook", wantErr: true},
+		{url: "http://[fd00::1]/hook", wantErr: true},
+		{url: "http://[::ffff:127.0.0.1]/hook", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateWebhookURL(context.Background(), tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("validateWebhookURL(%s) = %v, want error %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWebhookURLMustBePublic(t *testing.T) {
+	db := useTestDB(t, append(projectListModels, &repository.Webhook{})...)
+	project := createTestProject(t, uuid.New(), `[]`)
+	repo := repository.NewProject(db)
+	webhookRepo := repository.NewWebhook(db)
+	base := "/projects/" + project.ID.String() + "/webhooks"
+
+	create := func(url string) (int, []byte) {
+		t.Helper()
+		resp := serveAs(t, project.UserID.String(), "/projects/:id/webhooks", func(c *fiber.Ctx) error {
+			return CreateWebhook(c, repo, webhookRepo)
+		}, newRequest("POST", base, "application/json", strings.NewReader(`{"url":"`+url+`"}`)))
+		return resp.StatusCode, readBody(t, resp)
+	}
+	if status, body := create("http://169.254.169.254/latest/meta-data/"); status != http.StatusBadRequest || errorCode(t, body) != response.ErrCodeBadRequest {
+		t.Errorf("create for the metadata address: status %d: %s, want 400", status, body)
+	}
+	status, body := create("https://93.184.216.34/hook")
+	if status != http.StatusCreated {
+		t.Fatalf("create for a public address: status %d: %s", status, body)
+	}
+	webhooks, err := webhookRepo.ListByProject(project.ID.String())
+	if err != nil || len(webhooks) != 1 {
+		t.Fatalf("webhooks %v: %v, want the public one only", webhooks, err)
+	}
+
+	resp := serveAs(t, project.UserID.String(), "/projects/:id/webhooks/:webhookId", func(c *fiber.Ctx) error {
+		return UpdateWebhook(c, repo, webhookRepo)
+	}, newRequest("PUT", base+"/"+webhooks[0].ID.String(), "application/json", strings.NewReader(`{"url":"http://127.0.0.1:6379/"}`)))
+	if body := readBody(t, resp); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("update to loopback: status %d: %s, want 400", resp.StatusCode, body)
+	}
+	stored, err := webhookRepo.GetByID(project.ID.String(), webhooks[0].ID.String())
+	if err != nil || stored.URL != "https://93.184.216.34/hook" {
+		t.Errorf("webhook URL %q after a refused update: %v", stored.URL, err)
+	}
+}
+
+func TestWebhookDeliveryStaysPublic(t *testing.T) {
+	prev := webhookRetryDelays
+	webhookRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	t.Cleanup(func() { webhookRetryDelays = prev })
+
+	var hits atomic.Int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer internal.Close()
+
+	// A webhook stored before its URL was checked is still not delivered
+	secret, err := EncryptAPIKey("whsec-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverWebhook(repository.Webhook{ID: uuid.New(), URL: internal.URL + "/hook", Secret: secret}, WebhookEventExecutionCompleted, []byte(`{}`))
+	if n := hits.Load(); n != 0 {
+		t.Errorf("loopback server got %d deliveries, want none", n)
+	}
+
+	// Redirects are only followed to public URLs
+	for _, target := range []string{internal.URL + "/hook", "http://169.254.169.254/latest/meta-data/", "file:///etc/passwd"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if err := checkWebhookRedirect(req, []*http.Request{{}}); err == nil {
+			t.Errorf("redirect to %s followed", target)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "https://93.184.216.34/next", nil)
+	if err := checkWebhookRedirect(req, []*http.Request{{}}); err != nil {
+		t.Errorf("redirect to a public address refused: %v", err)
+	}
+	if err := checkWebhookRedirect(req, make([]*http.Request, maxWebhookRedirects)); err == nil {
+		t.Errorf("followed more than %d redirects", maxWebhookRedirects)
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/tracing"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Inbound webhooks let another system run an active project by POSTing a
+// message to /webhooks/trigger/:projectId. The body is signed like our own
+// outgoing deliveries: X-Manju-Signature is the hex HMAC-SHA256 of the raw
+// body keyed by the project's webhook secret. The run is queued and answered
+// with its execution ID; its outcome shows up in the project's executions.
+
+// WebhookTriggerRequest is the body of an inbound webhook
+type WebhookTriggerRequest struct {
+	Message string `json:"message"`
+}
+
+// webhookTriggersPerMinute is how often a project's inbound webhook may run
+const webhookTriggersPerMinute = 10
+
+// webhookProjectKey is the Locals key of the project whose inbound webhook
+// signature VerifyProjectWebhook checked
+const webhookProjectKey = "webhookProject"
+
+// VerifyProjectWebhook checks the signature of an inbound webhook and passes
+// the request on with its project. It runs before the rate limit so that
+// unsigned calls can't use up a project's allowance.
+func VerifyProjectWebhook(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := repo.GetByID(c.Params("projectId"))
+	if err != nil || !project.WebhookEnabled || project.WebhookSecret == "" {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "webhook not found", nil)
+	}
+
+	secret, err := DecryptAPIKey(project.WebhookSecret)
+	if err != nil {
+		log.Printf("[webhook] failed to decrypt inbound secret of project %s: %v", project.ID, err)
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to verify signature", nil)
+	}
+	signature := c.Get("X-Manju-Signature")
+	if !hmac.Equal([]byte(signature), []byte(signWebhookBody(secret, c.Body()))) {
+		return response.Error(c, http.StatusUnauthorized, response.ErrCodeUnauthorized, "invalid signature", nil)
+	}
+	c.Locals(webhookProjectKey, project)
+	return c.Next()
+}
+
+// WebhookTriggerLimiter limits each project's inbound webhook to
+// webhookTriggersPerMinute runs. Mounted after VerifyProjectWebhook, it only
+// counts signed calls.
+func WebhookTriggerLimiter() fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:          webhookTriggersPerMinute,
+		Expiration:   time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string { return c.Params("projectId") },
+		LimitReached: func(c *fiber.Ctx) error {
+			return response.Error(c, http.StatusTooManyRequests, response.ErrCodeRateLimited, "too many webhook calls for this project", nil)
+		},
+	})
+}
+
+// WebhookTriggered is the response of POST /webhooks/trigger/:projectId
+type WebhookTriggered struct {
+	ExecutionID uuid.UUID `json:"execution_id"`
+	Status      string    `json:"status"`
+}
+
+// TriggerProjectWebhook starts a run of the project of an inbound webhook
+// verified by VerifyProjectWebhook with the body's message, as the project
+// owner. It answers 202 with the execution ID without waiting for the AI
+// service.
+func TriggerProjectWebhook(c *fiber.Ctx) error {
+	project, ok := c.Locals(webhookProjectKey).(*repository.Project)
+	if !ok {
+		return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "webhook not found", nil)
+	}
+
+	if project.Status != repository.ProjectStatusActive {
+		return response.Error(c, http.StatusConflict, response.ErrCodeConflict, "project is not active", fiber.Map{"status": project.Status})
+	}
+
+	var body WebhookTriggerRequest
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "invalid payload", nil)
+	}
+	if body.Message == "" {
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, "message is required", nil)
+	}
+
+	ownerID := project.UserID.String()
+	aiRequest, _, err := prepareChatRun(c.UserContext(), project, ownerID, body.Message, nil, "")
+	if err != nil {
+		var budgetErr *tokenBudgetError
+		if errors.As(err, &budgetErr) {
+			return budgetErr.respond(c)
+		}
+		return response.Error(c, http.StatusBadRequest, response.ErrCodeBadRequest, err.Error(), nil)
+	}
+
+	execution, err := repository.NewExecution(repository.GetDB()).WithContext(c.UserContext()).Create(&repository.Execution{
+		ProjectID: project.ID,
+		UserID:    project.UserID,
+		Trigger:   repository.TriggerWebhook,
+		Input:     body.Message,
+		Status:    repository.ExecutionRunning,
+	})
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, err.Error(), nil)
+	}
+
+	go runWebhookTrigger(project, execution, aiRequest)
+
+	return c.Status(http.StatusAccepted).JSON(WebhookTriggered{ExecutionID: execution.ID, Status: execution.Status})
+}
+
+// runWebhookTrigger calls the AI service for a queued webhook run and stores
+// its outcome on the execution
+func runWebhookTrigger(project *repository.Project, execution *repository.Execution, aiRequest DemoChatRequest) {
+	ctx, span := tracing.Start(context.Background(), "RunWebhookTrigger", attribute.String("execution.id", execution.ID.String()))
+	defer span.End()
+
+	aiResponse, err := callAIChat(ctx, aiRequest)
+	setExecutionOutcome(execution, aiResponse, err)
+	addTokensUsed(ctx, project.ID, execution.TotalTokens)
+	if _, updateErr := repository.NewExecution(repository.GetDB()).WithContext(ctx).Update(execution); updateErr != nil {
+		log.Printf("[webhook] failed to record execution %s: %v", execution.ID, updateErr)
+	}
+	if err != nil {
+		log.Printf("[webhook] triggered run of project %s failed: %v", project.ID, err)
+		return
+	}
+	publishDemoCompleted(project, project.UserID.String(), execution, aiResponse)
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"manju/backend/middleware"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestWebhookRateLimitCountsSignedCalls(t *testing.T) {
+	db := useTestDB(t, projectListModels...)
+	project := createTestProject(t, uuid.New(), `[]`)
+	secret := "whsec-test"
+	encrypted, err := EncryptAPIKey(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A draft project answers signed calls with 409, so they are counted
+	// without starting runs
+	if err := db.Model(project).Updates(map[string]interface{}{"webhook_enabled": true, "webhook_secret": encrypted}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	repo := repository.NewProject(db)
+	app := fiber.New()
+	app.Post("/webhooks/trigger/:projectId",
+		func(c *fiber.Ctx) error { return VerifyProjectWebhook(c, repo) },
+		WebhookTriggerLimiter(),
+		TriggerProjectWebhook,
+	)
+	call := func(signature string) (int, []byte) {
+		t.Helper()
+		body := `{"message":"hi"}`
+		req := newRequest("POST", "/webhooks/trigger/"+project.ID.String(), "application/json", strings.NewReader(body))
+		if signature != "" {
+			req.Header.Set("X-Manju-Signature", signature)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, readBody(t, resp)
+	}
+	signature := signWebhookBody(secret, []byte(`{"message":"hi"}`))
+
+	// Unsigned and badly signed calls are refused before the limit
+	for i := 0; i < 3*webhookTriggersPerMinute; i++ {
+		sig := ""
+		if i%2 == 1 {
+			sig = signWebhookBody("wrong", []byte(`{"message":"hi"}`))
+		}
+		if status, body := call(sig); status != http.StatusUnauthorized {
+			t.Fatalf("unsigned call %d: status %d: %s, want 401", i+1, status, body)
+		}
+	}
+
+	// The project's whole allowance is left for the real caller
+	for i := 0; i < webhookTriggersPerMinute; i++ {
+		if status, body := call(signature); status != http.StatusConflict {
+			t.Fatalf("signed call %d: status %d: %s, want it past the limit", i+1, status, body)
+		}
+	}
+	status, body := call(signature)
+	if status != http.StatusTooManyRequests || errorCode(t, body) != response.ErrCodeRateLimited {
+		t.Errorf("signed call over the limit: status %d: %s, want 429", status, body)
+	}
+}
+
+func TestWebhookTriggerWithAPIKey(t *testing.T) {
+	ai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(DemoChatResponse{Response: "hello", TotalTokens: 10})
+	}))
+	defer ai.Close()
+	t.Setenv("AI_SERVICE_URL", ai.URL)
+	t.Setenv("MANJU_API_KEY", "manju-key")
+
+	db := useTestDB(t, append(projectListModels, &repository.UserAPIKey{}, &repository.Execution{})...)
+	owner := uuid.New()
+	encrypted, err := EncryptAPIKey("sk-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&repository.UserAPIKey{UserID: owner, Label: "Default", EncryptedKey: encrypted, IsDefault: true}).Error; err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	project := createTestProject(t, owner, publishTestNodes("v1"))
+	secret := "whsec-test"
+	if encrypted, err = EncryptAPIKey(secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(project).Updates(map[string]interface{}{
+		"status": repository.ProjectStatusActive, "webhook_enabled": true, "webhook_secret": encrypted,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The route is mounted behind the API key guard, as in main.go
+	repo := repository.NewProject(db)
+	app := fiber.New()
+	app.Use(middleware.APIKeyGuard())
+	app.Post("/webhooks/trigger/:projectId",
+		func(c *fiber.Ctx) error { return VerifyProjectWebhook(c, repo) },
+		WebhookTriggerLimiter(),
+		TriggerProjectWebhook,
+	)
+	trigger := func(signature string) (int, []byte) {
+		t.Helper()
+		body := `{"message":"hi"}`
+		req := newRequest("POST", "/webhooks/trigger/"+project.ID.String(), "application/json", strings.NewReader(body))
+		if signature != "" {
+			req.Header.Set("X-Manju-Signature", signature)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, readBody(t, resp)
+	}
+
+	// The external caller has no API key; the signature is its credential
+	if status, body := trigger(""); status != http.StatusUnauthorized {
+		t.Fatalf("unsigned trigger: status %d: %s, want 401", status, body)
+	}
+	status, body := trigger(signWebhookBody(secret, []byte(`{"message":"hi"}`)))
+	if status != http.StatusAccepted {
+		t.Fatalf("signed trigger: status %d: %s, want 202", status, body)
+	}
+	var accepted struct {
+		ExecutionID uuid.UUID `json:"execution_id"`
+	}
+	if err := json.Unmarshal(body, &accepted); err != nil {
+		t.Fatalf("trigger response %s: %v", body, err)
+	}
+
+	// Wait for the run so it doesn't outlive the test database
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var execution repository.Execution
+		if err := db.Where("id = ?", accepted.ExecutionID).First(&execution).Error; err != nil {
+			t.Fatal(err)
+		}
+		if execution.Status != repository.ExecutionRunning {
+			if execution.Status != repository.ExecutionSucceeded {
+				t.Errorf("triggered run %s: %q", execution.Status, execution.Error)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("triggered run did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"manju/backend/repository"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// knownNodeTypes lists the node types the workflow editor and AI service understand
+var knownNodeTypes = map[string]bool{
+	"text-input":    true,
+	"voice-input":   true,
+	"ai-model":      true,
+	"rag-documents": true,
+	"google-sheets": true,
+	"if-condition":  true,
+	"text-output":   true,
+	"voice-output":  true,
+}
+
+// ValidationError describes a single invalid item in a workflow payload
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// getMaxNodes returns the maximum number of nodes a workflow may contain
+func getMaxNodes() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_NODES")); err == nil && v > 0 {
+		return v
+	}
+	return 100
+}
+
+// getMaxConnections returns the maximum number of connections a workflow may contain
+func getMaxConnections() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_CONNECTIONS")); err == nil && v > 0 {
+		return v
+	}
+	return 200
+}
+
+// getMaxWorkflowPayloadBytes returns the maximum size of the nodes or the
+// connections JSON in a single request
+func getMaxWorkflowPayloadBytes() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_WORKFLOW_PAYLOAD_BYTES")); err == nil && v > 0 {
+		return v
+	}
+	return 4 << 20 // 4 MB
+}
+
+// MaxRequestBodyBytes is the largest request body the server will read. It
+// defaults to the largest of the import bundle limit, room for a maximal
+// nodes and connections payload and room for a maximal document upload, so
+// those limits report their own errors.
+func MaxRequestBodyBytes() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_REQUEST_BODY_BYTES")); err == nil && v > 0 {
+		return v
+	}
+	limit := 2*getMaxWorkflowPayloadBytes() + 1<<20
+	if bundle := int(getMaxImportBundleBytes()); bundle > limit {
+		limit = bundle
+	}
+	// Leave room for the multipart envelope around the file
+	if upload := int(getMaxDocumentSize()) + 1<<20; upload > limit {
+		limit = upload
+	}
+	return limit
+}
+
+// checkWorkflowPayloadSize returns the details of the 413 response when the
+// raw nodes or connections JSON exceeds the payload limit, or nil when both
+// fit. It runs before the payload is stored so oversized input never reaches
+// Postgres.
+func checkWorkflowPayloadSize(nodes, connections json.RawMessage) map[string]interface{} {
+	max := getMaxWorkflowPayloadBytes()
+	for _, field := range []struct {
+		name string
+		raw  json.RawMessage
+	}{{"nodes", nodes}, {"connections", connections}} {
+		if len(field.raw) > max {
+			return map[string]interface{}{
+				"field":     field.name,
+				"size":      len(field.raw),
+				"max_bytes": max,
+			}
+		}
+	}
+	return nil
+}
+
+// hasJSON reports whether a raw JSON field was sent with a non-null value
+func hasJSON(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
+
+// workflowSizeIssues returns a message for every workflow size limit that is exceeded
+func workflowSizeIssues(nodeCount, connectionCount int) []string {
+	issues := []string{}
+	if max := getMaxNodes(); nodeCount > max {
+		issues = append(issues, fmt.Sprintf("Workflow has %d nodes (maximum is %d)", nodeCount, max))
+	}
+	if max := getMaxConnections(); connectionCount > max {
+		issues = append(issues, fmt.Sprintf("Workflow has %d connections (maximum is %d)", connectionCount, max))
+	}
+	return issues
+}
+
+// checkWorkflowSize counts a project's nodes and connections and returns the
+// details of the 422 response when either exceeds its limit, or nil when
+// within limits.
+func checkWorkflowSize(project *repository.Project) map[string]interface{} {
+	var nodes, connections []json.RawMessage
+	_ = json.Unmarshal(project.Nodes, &nodes)
+	_ = json.Unmarshal(project.Connections, &connections)
+
+	if len(workflowSizeIssues(len(nodes), len(connections))) == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"node_count":       len(nodes),
+		"max_nodes":        getMaxNodes(),
+		"connection_count": len(connections),
+		"max_connections":  getMaxConnections(),
+	}
+}
+
+// workflowSchemaErrors checks the structure of a workflow: every node needs an
+// id, a registered type, a position and a data object, node IDs must be unique
+// and every connection must reference existing nodes.
+func workflowSchemaErrors(nodes, connections []map[string]interface{}) []ValidationError {
+	errs := []ValidationError{}
+
+	nodeIDs := map[string]bool{}
+	for i, node := range nodes {
+		id, _ := node["id"].(string)
+		if id == "" {
+			errs = append(errs, ValidationError{Path: fmt.Sprintf("nodes[%d].id", i), Message: "id is required"})
+		} else if nodeIDs[id] {
+			errs = append(errs, ValidationError{Path: fmt.Sprintf("nodes[%d].id", i), Message: fmt.Sprintf("duplicate node id %q", id)})
+		}
+		nodeIDs[id] = true
+
+		nodeType, _ := node["type"].(string)
+		if !knownNodeTypes[nodeType] {
+			errs = append(errs, ValidationError{Path: fmt.Sprintf("nodes[%d].type", i), Message: fmt.Sprintf("unknown node type %q", nodeType)})
+		}
+
+		position, ok := node["position"].(map[string]interface{})
+		if !ok {
+			errs = append(errs, ValidationError{Path: fmt.Sprintf("nodes[%d].position", i), Message: "position is required"})
+		} else {
+			_, hasX := position["x"].(float64)
+			_, hasY := position["y"].(float64)
+			if !hasX || !hasY {
+				errs = append(errs, ValidationError{Path: fmt.Sprintf("nodes[%d].position", i), Message: "position needs numeric x and y"})
+			}
+		}
+
+		if _, ok := node["data"].(map[string]interface{}); !ok {
+			errs = append(errs, ValidationError{Path: fmt.Sprintf("nodes[%d].data", i), Message: "data must be an object"})
+		}
+	}
+
+	for i, conn := range connections {
+		source, target := connectionEndpoints(conn)
+		if !nodeIDs[source] || source == "" {
+			errs = append(errs, ValidationError{Path: fmt.Sprintf("connections[%d].sourceNodeId", i), Message: fmt.Sprintf("unknown node %q", source)})
+		}
+		if !nodeIDs[target] || target == "" {
+			errs = append(errs, ValidationError{Path: fmt.Sprintf("connections[%d].targetNodeId", i), Message: fmt.Sprintf("unknown node %q", target)})
+		}
+	}
+
+	return errs
+}
+
+// checkWorkflowSchema validates a project's stored nodes and connections and
+// returns the details of the 422 response when they are malformed, or nil
+// when valid.
+func checkWorkflowSchema(project *repository.Project) map[string]interface{} {
+	var nodes, connections []map[string]interface{}
+	errs := []ValidationError{}
+	if err := json.Unmarshal(project.Nodes, &nodes); err != nil {
+		errs = append(errs, ValidationError{Path: "nodes", Message: "nodes must be an array of objects"})
+	}
+	if err := json.Unmarshal(project.Connections, &connections); err != nil {
+		errs = append(errs, ValidationError{Path: "connections", Message: "connections must be an array of objects"})
+	}
+	if len(errs) == 0 {
+		errs = workflowSchemaErrors(nodes, connections)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"errors": errs,
+	}
+}
+
+// applyProjectSettings fills in the project-wide model defaults on ai-model
+// nodes that don't set a value themselves. Explicit node values always win.
+func applyProjectSettings(nodes []map[string]interface{}, settings repository.ProjectSettings) {
+	for _, node := range nodes {
+		if nodeType, _ := node["type"].(string); nodeType != "ai-model" {
+			continue
+		}
+		data := nodeData(node)
+		if settings.DefaultModel != "" && isUnset(data["modelName"]) {
+			data["modelName"] = settings.DefaultModel
+		}
+		if settings.SystemPrompt != "" && isUnset(data["systemPrompt"]) {
+			data["systemPrompt"] = settings.SystemPrompt
+		}
+		if settings.Temperature != nil && isUnset(data["temperature"]) {
+			data["temperature"] = *settings.Temperature
+		}
+		if settings.MaxTokens > 0 && isUnset(data["maxTokens"]) {
+			data["maxTokens"] = settings.MaxTokens
+		}
+	}
+}
+
+// isUnset reports whether a node data value is missing, null or an empty string
+func isUnset(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && s == ""
+}
+
+// parseWorkflow decodes a project's nodes and connections, treating invalid JSON as empty
+func parseWorkflow(project *repository.Project) ([]map[string]interface{}, []map[string]interface{}) {
+	var nodes []map[string]interface{}
+	var connections []map[string]interface{}
+
+	if err := json.Unmarshal(project.Nodes, &nodes); err != nil {
+		nodes = []map[string]interface{}{}
+	}
+	if err := json.Unmarshal(project.Connections, &connections); err != nil {
+		connections = []map[string]interface{}{}
+	}
+	return nodes, connections
+}
+
+// connectionEndpoints returns the source and target node IDs of a connection.
+// The editor stores them as sourceNodeId/targetNodeId; source/target is accepted too.
+func connectionEndpoints(conn map[string]interface{}) (string, string) {
+	source, _ := conn["sourceNodeId"].(string)
+	if source == "" {
+		source, _ = conn["source"].(string)
+	}
+	target, _ := conn["targetNodeId"].(string)
+	if target == "" {
+		target, _ = conn["target"].(string)
+	}
+	return source, target
+}
+
+// nodeData returns the data map of a node, creating it if missing
+func nodeData(node map[string]interface{}) map[string]interface{} {
+	data, ok := node["data"].(map[string]interface{})
+	if !ok {
+		data = map[string]interface{}{}
+		node["data"] = data
+	}
+	return data
+}
+
+// nodeLabel returns a human readable name for a node
+func nodeLabel(node map[string]interface{}) string {
+	if label, ok := nodeData(node)["label"].(string); ok && label != "" {
+		return label
+	}
+	if label, ok := node["label"].(string); ok && label != "" {
+		return label
+	}
+	id, _ := node["id"].(string)
+	return id
+}
+
+// regenerateWorkflowIDs assigns fresh IDs to every node and connection and
+// rewrites connection endpoints accordingly. It returns the old->new node ID map.
+func regenerateWorkflowIDs(nodes, connections []map[string]interface{}) map[string]string {
+	idMap := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		newID := fmt.Sprintf("node-%s", uuid.New().String())
+		if oldID, ok := node["id"].(string); ok {
+			idMap[oldID] = newID
+		}
+		node["id"] = newID
+	}
+
+	for _, conn := range connections {
+		conn["id"] = fmt.Sprintf("conn-%s", uuid.New().String())
+		for _, key := range []string{"sourceNodeId", "targetNodeId", "source", "target"} {
+			if oldID, ok := conn[key].(string); ok {
+				if newID, exists := idMap[oldID]; exists {
+					conn[key] = newID
+				}
+			}
+		}
+	}
+	return idMap
+}
+
+// isInputNodeType reports whether a node type starts a workflow
+func isInputNodeType(t string) bool {
+	return t == "text-input" || t == "voice-input"
+}
+
+// isOutputNodeType reports whether a node type ends a workflow
+func isOutputNodeType(t string) bool {
+	return t == "text-output" || t == "voice-output"
+}
+
+// workflowGraphIssues inspects the connection graph and returns blocking errors
+// for nodes without any edge and non-blocking warnings for nodes that are
+// reachable from an input but never lead to an output (dead-end branches).
+func workflowGraphIssues(nodes, connections []map[string]interface{}) (errs []string, warnings []string) {
+	errs, warnings = []string{}, []string{}
+
+	outgoing := map[string][]string{}
+	incoming := map[string][]string{}
+	for _, conn := range connections {
+		source, target := connectionEndpoints(conn)
+		if source == "" || target == "" {
+			continue
+		}
+		outgoing[source] = append(outgoing[source], target)
+		incoming[target] = append(incoming[target], source)
+	}
+
+	var inputs, outputs []string
+	for _, node := range nodes {
+		id, _ := node["id"].(string)
+		nodeType, _ := node["type"].(string)
+		if isInputNodeType(nodeType) {
+			inputs = append(inputs, id)
+		}
+		if isOutputNodeType(nodeType) {
+			outputs = append(outputs, id)
+		}
+	}
+
+	fromInput := reachable(inputs, outgoing)
+	toOutput := reachable(outputs, incoming)
+
+	for _, node := range nodes {
+		id, _ := node["id"].(string)
+		if len(outgoing[id]) == 0 && len(incoming[id]) == 0 {
+			// A workflow with a single node has nothing to connect it to yet
+			if len(nodes) > 1 {
+				errs = append(errs, fmt.Sprintf("Node '%s' is disconnected", nodeLabel(node)))
+			}
+			continue
+		}
+		if fromInput[id] && !toOutput[id] {
+			warnings = append(warnings, fmt.Sprintf("Node '%s' does not lead to any output", nodeLabel(node)))
+		}
+	}
+	return errs, warnings
+}
+
+// reachable returns every node ID reachable from the start nodes by following edges
+func reachable(start []string, edges map[string][]string) map[string]bool {
+	seen := map[string]bool{}
+	queue := append([]string{}, start...)
+	for _, id := range start {
+		seen[id] = true
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[id] {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return seen
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"manju/backend/models/response"
+	"manju/backend/repository"
+	"manju/backend/tracing"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	svg "github.com/ajstarks/svgo"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Workflow previews are small images of a project's graph for the project
+// list. The AI service renders them as PNG; when it can't, a plain SVG of the
+// node types and their connections is drawn here instead. A project has one
+// preview at a time, <id>.png or <id>.svg, refreshed after every save.
+
+const (
+	maxPreviewImageBytes = 2 << 20 // 2 MB
+	previewImageWidth    = 640
+	previewImageHeight   = 360
+	previewNodeWidth     = 120
+	previewNodeHeight    = 36
+	previewMargin        = 16
+)
+
+// getPreviewStoragePath returns the directory workflow previews are stored in
+func getPreviewStoragePath() string {
+	path := os.Getenv("PREVIEW_STORAGE_PATH")
+	if path == "" {
+		path = "./uploads/previews"
+	}
+	return path
+}
+
+// workflowPreviewPath returns where the preview of projectID is stored in
+// the format with extension ext (".png" or ".svg")
+func workflowPreviewPath(projectID, ext string) string {
+	return filepath.Join(getPreviewStoragePath(), projectID+ext)
+}
+
+// workflowPreviewURL returns the endpoint serving a project's preview
+func workflowPreviewURL(projectID string) string {
+	return "/api/v1/projects/" + projectID + "/preview"
+}
+
+// removeWorkflowPreview deletes the preview files of a project, if any
+func removeWorkflowPreview(projectID string) {
+	for _, ext := range []string{".png", ".svg"} {
+		if err := os.Remove(workflowPreviewPath(projectID, ext)); err != nil && !os.IsNotExist(err) {
+			log.Printf("[previews] failed to remove preview of project %s: %v", projectID, err)
+		}
+	}
+}
+
+// WorkflowPreview is the response of POST /projects/:id/preview
+type WorkflowPreview struct {
+	PreviewURL  string `json:"preview_url"`
+	ContentType string `json:"content_type"`
+}
+
+// GenerateWorkflowPreview renders the preview image of a project's workflow
+// and returns where it is served
+func GenerateWorkflowPreview(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessEditor)
+	if project == nil {
+		return err
+	}
+
+	contentType, err := renderWorkflowPreview(c.UserContext(), repo, project)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, response.ErrCodeInternal, "failed to save preview", nil)
+	}
+	return c.JSON(WorkflowPreview{PreviewURL: workflowPreviewURL(project.ID.String()), ContentType: contentType})
+}
+
+// GetWorkflowPreview serves the preview image of a project
+func GetWorkflowPreview(c *fiber.Ctx, repo *repository.ProjectRepository) error {
+	project, err := loadProjectForAccess(c, repo, accessViewer)
+	if project == nil {
+		return err
+	}
+	for _, ext := range []string{".png", ".svg"} {
+		path := workflowPreviewPath(project.ID.String(), ext)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+		c.Type(strings.TrimPrefix(ext, "."))
+		return c.SendFile(path)
+	}
+	return response.Error(c, http.StatusNotFound, response.ErrCodeNotFound, "no preview", nil)
+}
+
+// refreshWorkflowPreview re-renders a project's preview after a save,
+// through the repository of the request that saved it. It runs in the
+// background, so failures are only logged.
+func refreshWorkflowPreview(repo *repository.ProjectRepository, project *repository.Project) {
+	if _, err := renderWorkflowPreview(context.Background(), repo, project); err != nil {
+		log.Printf("[previews] failed to refresh preview of project %s: %v", project.ID, err)
+	}
+}
+
+// renderWorkflowPreview stores a preview of the project's workflow, from the
+// AI service or drawn as SVG when it is unavailable, and records its URL on
+// the project. It returns the preview's content type.
+func renderWorkflowPreview(ctx context.Context, repo *repository.ProjectRepository, project *repository.Project) (string, error) {
+	nodes, connections := parseWorkflow(project)
+
+	ext, contentType := ".png", "image/png"
+	image, err := renderPreviewWithAI(ctx, nodes, connections)
+	if err != nil {
+		log.Printf("[previews] AI preview of project %s unavailable, drawing SVG: %v", project.ID, err)
+		var buf bytes.Buffer
+		drawWorkflowSVG(&buf, nodes, connections)
+		image, ext, contentType = buf.Bytes(), ".svg", "image/svg+xml"
+	}
+
+	projectID := project.ID.String()
+	if err := writeFileAtomic(workflowPreviewPath(projectID, ext), image); err != nil {
+		return "", err
+	}
+	stale := ".svg"
+	if ext == ".svg" {
+		stale = ".png"
+	}
+	if err := os.Remove(workflowPreviewPath(projectID, stale)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[previews] failed to remove old preview of project %s: %v", projectID, err)
+	}
+
+	if project.PreviewURL != workflowPreviewURL(projectID) {
+		if err := repo.SetPreviewURL(projectID, workflowPreviewURL(projectID)); err != nil {
+			return "", err
+		}
+	}
+	return contentType, nil
+}
+
+// writeFileAtomic writes data to path through a temporary file, so a
+// concurrent reader never sees a partly written preview
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".preview-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// renderPreviewWithAI asks the AI service to render a workflow as PNG. Any
+// answer other than a PNG image is an error.
+func renderPreviewWithAI(ctx context.Context, nodes, connections []map[string]interface{}) (image []byte, err error) {
+	ctx, span := tracing.Start(ctx, "ai.render-preview")
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"nodes":       nodes,
+		"connections": connections,
+		"width":       previewImageWidth,
+		"height":      previewImageHeight,
+	})
+	req, err := http.NewRequestWithContext(ctx, "POST", getAIServiceURL()+"/render-preview", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", os.Getenv("MANJU_API_KEY"))
+	tracing.Inject(ctx, req.Header)
+
+	client := &http.Client{Timeout: aiTimeouts.Preview}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errAIUnavailable
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		svcErr := &aiServiceError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(&svcErr.Body)
+		return nil, svcErr
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/png") {
+		return nil, fmt.Errorf("unexpected content type %q", ct)
+	}
+	image, err = io.ReadAll(io.LimitReader(resp.Body, maxPreviewImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(image) > maxPreviewImageBytes {
+		return nil, fmt.Errorf("preview is larger than %d bytes", maxPreviewImageBytes)
+	}
+	return image, nil
+}
+
+// drawWorkflowSVG draws a workflow as boxes labelled with their node type,
+// joined by lines for the connections. Nodes keep their editor positions,
+// scaled to fit the image; nodes without one are laid out in a row.
+func drawWorkflowSVG(w io.Writer, nodes, connections []map[string]interface{}) {
+	type point struct{ x, y float64 }
+	positions := make(map[string]point, len(nodes))
+	var minX, minY, maxX, maxY float64
+	for i, node := range nodes {
+		id, _ := node["id"].(string)
+		p := point{float64(i) * (previewNodeWidth + previewMargin), 0}
+		if pos, ok := node["position"].(map[string]interface{}); ok {
+			x, xOK := pos["x"].(float64)
+			y, yOK := pos["y"].(float64)
+			if xOK && yOK {
+				p = point{x, y}
+			}
+		}
+		if i == 0 || p.x < minX {
+			minX = p.x
+		}
+		if i == 0 || p.y < minY {
+			minY = p.y
+		}
+		if i == 0 || p.x > maxX {
+			maxX = p.x
+		}
+		if i == 0 || p.y > maxY {
+			maxY = p.y
+		}
+		positions[id] = p
+	}
+
+	// Map the top-left corners of the nodes into the area that keeps every
+	// box inside the image
+	areaW := float64(previewImageWidth - previewNodeWidth - 2*previewMargin)
+	areaH := float64(previewImageHeight - previewNodeHeight - 2*previewMargin)
+	scale := 1.0
+	if maxX > minX {
+		scale = areaW / (maxX - minX)
+	}
+	if maxY > minY && areaH/(maxY-minY) < scale {
+		scale = areaH / (maxY - minY)
+	}
+	scale = min(scale, 1)
+	place := func(p point) (int, int) {
+		return previewMargin + int((p.x-minX)*scale), previewMargin + int((p.y-minY)*scale)
+	}
+
+	canvas := svg.New(w)
+	canvas.Start(previewImageWidth, previewImageHeight)
+	canvas.Rect(0, 0, previewImageWidth, previewImageHeight, "fill:#f8fafc")
+	for _, conn := range connections {
+		source, target := connectionEndpoints(conn)
+		from, ok1 := positions[source]
+		to, ok2 := positions[target]
+		if !ok1 || !ok2 {
+			continue
+		}
+		x1, y1 := place(from)
+		x2, y2 := place(to)
+		canvas.Line(x1+previewNodeWidth, y1+previewNodeHeight/2, x2, y2+previewNodeHeight/2, "stroke:#94a3b8;stroke-width:2")
+	}
+	for _, node := range nodes {
+		id, _ := node["id"].(string)
+		nodeType, _ := node["type"].(string)
+		x, y := place(positions[id])
+		canvas.Roundrect(x, y, previewNodeWidth, previewNodeHeight, 6, 6, "fill:#ffffff;stroke:#6366f1;stroke-width:2")
+		canvas.Text(x+previewNodeWidth/2, y+previewNodeHeight/2+4, truncateText(nodeType, 18), "text-anchor:middle;font-family:sans-serif;font-size:12px;fill:#1e293b")
+	}
+	canvas.End()
+}
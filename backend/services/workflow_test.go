@@ -0,0 +1,176 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"manju/backend/repository"
+
+	"gorm.io/datatypes"
+)
+
+func TestCheckWorkflowSchema(t *testing.T) {
+	const (
+		input  = `{"id":"in","type":"text-input","position":{"x":0,"y":0},"data":{}}`
+		output = `{"id":"out","type":"text-output","position":{"x":200,"y":0},"data":{"label":"Answer"}}`
+		link   = `{"id":"c1","sourceNodeId":"in","targetNodeId":"out"}`
+	)
+	tests := []struct {
+		name        string
+		nodes       string
+		connections string
+		// want are the paths of the reported errors, in order
+		want []string
+	}{
+		{name: "valid", nodes: `[` + input + `,` + output + `]`, connections: `[` + link + `]`},
+		{name: "empty", nodes: `[]`, connections: `[]`},
+		{name: "connection using source and target", nodes: `[` + input + `,` + output + `]`, connections: `[{"source":"in","target":"out"}]`},
+		{name: "missing id", nodes: `[{"type":"text-input","position":{"x":0,"y":0},"data":{}}]`, connections: `[]`, want: []string{"nodes[0].id"}},
+		{name: "duplicate id", nodes: `[` + input + `,` + input + `]`, connections: `[]`, want: []string{"nodes[1].id"}},
+		{name: "missing type", nodes: `[{"id":"in","position":{"x":0,"y":0},"data":{}}]`, connections: `[]`, want: []string{"nodes[0].type"}},
+		{name: "unknown type", nodes: `[{"id":"in","type":"teleporter","position":{"x":0,"y":0},"data":{}}]`, connections: `[]`, want: []string{"nodes[0].type"}},
+		{name: "missing position", nodes: `[{"id":"in","type":"text-input","data":{}}]`, connections: `[]`, want: []string{"nodes[0].position"}},
+		{name: "non-numeric position", nodes: `[{"id":"in","type":"text-input","position":{"x":"0","y":0},"data":{}}]`, connections: `[]`, want: []string{"nodes[0].position"}},
+		{name: "missing data", nodes: `[{"id":"in","type":"text-input","position":{"x":0,"y":0}}]`, connections: `[]`, want: []string{"nodes[0].data"}},
+		{name: "data not an object", nodes: `[{"id":"in","type":"text-input","position":{"x":0,"y":0},"data":"hello"}]`, connections: `[]`, want: []string{"nodes[0].data"}},
+		{name: "unknown source", nodes: `[` + output + `]`, connections: `[` + link + `]`, want: []string{"connections[0].sourceNodeId"}},
+		{name: "unknown target", nodes: `[` + input + `]`, connections: `[` + link + `]`, want: []string{"connections[0].targetNodeId"}},
+		{name: "connection without endpoints", nodes: `[` + input + `]`, connections: `[{"id":"c1"}]`, want: []string{"connections[0].sourceNodeId", "connections[0].targetNodeId"}},
+		{
+			name:        "every violation is listed",
+			nodes:       `[{"type":"teleporter"},` + input + `]`,
+			connections: `[{"sourceNodeId":"in","targetNodeId":"gone"}]`,
+			want:        []string{"nodes[0].id", "nodes[0].type", "nodes[0].position", "nodes[0].data", "connections[0].targetNodeId"},
+		},
+		{name: "nodes not an array", nodes: `{"id":"in"}`, connections: `[]`, want: []string{"nodes"}},
+		{name: "connections not an array", nodes: `[]`, connections: `"in->out"`, want: []string{"connections"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalid := checkWorkflowSchema(&repository.Project{
+				Nodes:       datatypes.JSON(tt.nodes),
+				Connections: datatypes.JSON(tt.connections),
+			})
+			if len(tt.want) == 0 {
+				if invalid != nil {
+					t.Fatalf("checkWorkflowSchema() = %v, want valid", invalid)
+				}
+				return
+			}
+			if invalid == nil {
+				t.Fatalf("checkWorkflowSchema() = valid, want errors at %v", tt.want)
+			}
+			var got []string
+			for _, err := range invalid["errors"].([]ValidationError) {
+				got = append(got, err.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyProjectSettings(t *testing.T) {
+	temperature := 0.2
+	settings := repository.ProjectSettings{
+		DefaultModel: "gpt-4o-mini",
+		Temperature:  &temperature,
+		MaxTokens:    512,
+		SystemPrompt: "Answer in Thai",
+	}
+	tests := []struct {
+		name     string
+		node     string
+		settings repository.ProjectSettings
+		want     string
+	}{
+		{
+			name:     "fills every unset value",
+			node:     `{"id":"m","type":"ai-model","data":{}}`,
+			settings: settings,
+			want:     `{"id":"m","type":"ai-model","data":{"modelName":"gpt-4o-mini","temperature":0.2,"maxTokens":512,"systemPrompt":"Answer in Thai"}}`,
+		},
+		{
+			name:     "keeps explicit node values",
+			node:     `{"id":"m","type":"ai-model","data":{"modelName":"gpt-4o","temperature":1.1,"maxTokens":64,"systemPrompt":"Be brief"}}`,
+			settings: settings,
+			want:     `{"id":"m","type":"ai-model","data":{"modelName":"gpt-4o","temperature":1.1,"maxTokens":64,"systemPrompt":"Be brief"}}`,
+		},
+		{
+			name:     "an explicit zero temperature is kept",
+			node:     `{"id":"m","type":"ai-model","data":{"temperature":0}}`,
+			settings: settings,
+			want:     `{"id":"m","type":"ai-model","data":{"modelName":"gpt-4o-mini","temperature":0,"maxTokens":512,"systemPrompt":"Answer in Thai"}}`,
+		},
+		{
+			name:     "empty and null node values count as unset",
+			node:     `{"id":"m","type":"ai-model","data":{"modelName":"","systemPrompt":null}}`,
+			settings: settings,
+			want:     `{"id":"m","type":"ai-model","data":{"modelName":"gpt-4o-mini","temperature":0.2,"maxTokens":512,"systemPrompt":"Answer in Thai"}}`,
+		},
+		{
+			name:     "a node without data gets the defaults",
+			node:     `{"id":"m","type":"ai-model"}`,
+			settings: repository.ProjectSettings{DefaultModel: "gpt-4o-mini"},
+			want:     `{"id":"m","type":"ai-model","data":{"modelName":"gpt-4o-mini"}}`,
+		},
+		{
+			name:     "unset settings change nothing",
+			node:     `{"id":"m","type":"ai-model","data":{"modelName":"gpt-4o"}}`,
+			settings: repository.ProjectSettings{},
+			want:     `{"id":"m","type":"ai-model","data":{"modelName":"gpt-4o"}}`,
+		},
+		{
+			name:     "other node types are left alone",
+			node:     `{"id":"in","type":"text-input","data":{}}`,
+			settings: settings,
+			want:     `{"id":"in","type":"text-input","data":{}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node, want map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.node), &node); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+
+			nodes := []map[string]interface{}{node}
+			applyProjectSettings(nodes, tt.settings)
+
+			// Compare as JSON so the int and float64 forms of a number match
+			got, _ := json.Marshal(nodes[0])
+			wantJSON, _ := json.Marshal(want)
+			if string(got) != string(wantJSON) {
+				t.Errorf("node = %s, want %s", got, wantJSON)
+			}
+		})
+	}
+}
+
+func TestMaxRequestBodyBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want int
+	}{
+		{name: "defaults fit the largest document upload", want: 25<<20 + 1<<20},
+		{name: "room for maximal nodes and connections", env: map[string]string{"MAX_WORKFLOW_PAYLOAD_BYTES": "20971520"}, want: 2*20<<20 + 1<<20},
+		{name: "room for the largest import bundle", env: map[string]string{"MAX_IMPORT_BUNDLE_BYTES": "104857600"}, want: 100 << 20},
+		{name: "an explicit limit wins", env: map[string]string{"MAX_REQUEST_BODY_BYTES": "1048576", "MAX_IMPORT_BUNDLE_BYTES": "104857600"}, want: 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"MAX_REQUEST_BODY_BYTES", "MAX_WORKFLOW_PAYLOAD_BYTES", "MAX_IMPORT_BUNDLE_BYTES", "MAX_DOCUMENT_SIZE"} {
+				t.Setenv(env, tt.env[env])
+			}
+			if got := MaxRequestBodyBytes(); got != tt.want {
+				t.Errorf("MaxRequestBodyBytes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Local stores objects as files; keys are filesystem paths
+type Local struct{}
+
+// NewLocal creates a local-disk backend
+func NewLocal() *Local {
+	return &Local{}
+}
+
+// Save writes r to the file key, creating its directory
+func (l *Local) Save(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(key), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(key)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(key)
+		return err
+	}
+	return f.Close()
+}
+
+// Open opens the file key
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(key)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// OpenRange opens the file key and seeks to offset
+func (l *Local) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(key)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{io.LimitReader(f, length), f}, nil
+}
+
+// Delete removes the file key
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(key); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stat returns the size and modification time of the file key
+func (l *Local) Stat(ctx context.Context, key string) (Info, error) {
+	fi, err := os.Stat(key)
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// SignedURL is not supported; files are served by the backend itself
+func (l *Local) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
+// Move renames the file src to dst, creating dst's directory
+func (l *Local) Move(ctx context.Context, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Link hard-links dst to src so both share one copy on disk
+func (l *Local) Link(ctx context.Context, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Link(src, dst)
+}
+
+// DeletePrefix removes the directory prefix and everything in it
+func (l *Local) DeletePrefix(ctx context.Context, prefix string) error {
+	return os.RemoveAll(prefix)
+}
@@ -0,0 +1,150 @@
+// Package storage keeps document files on the local disk or in an
+// S3-compatible object store (S3, MinIO), so several backend replicas can
+// share them.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a key does not exist
+	ErrNotFound = errors.New("storage: object not found")
+	// ErrNotSupported is returned by operations a backend cannot perform
+	ErrNotSupported = errors.New("storage: operation not supported")
+)
+
+// Info describes a stored object
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage stores objects under slash- or filepath-separated keys. Document
+// keys are the paths the local backend has always used, such as
+// "uploads/documents/<owner>/<project>/<file>".
+type Storage interface {
+	// Save writes r under key, replacing any existing object. size is the
+	// length of r, or -1 if unknown.
+	Save(ctx context.Context, key string, r io.Reader, size int64) error
+	// Open returns the content of key
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes key; a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// Stat returns the size and modification time of key
+	Stat(ctx context.Context, key string) (Info, error)
+	// SignedURL returns a URL that grants read access to key for expiry
+	// without credentials, or ErrNotSupported
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Mover is implemented by backends that can move an object without
+// downloading it
+type Mover interface {
+	Move(ctx context.Context, src, dst string) error
+}
+
+// Linker is implemented by backends that can store the content of one key
+// under another without a second copy
+type Linker interface {
+	Link(ctx context.Context, src, dst string) error
+}
+
+// PrefixDeleter is implemented by backends that can remove every key under
+// a prefix
+type PrefixDeleter interface {
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// RangeOpener is implemented by backends that can read part of an object
+// without fetching what comes before it
+type RangeOpener interface {
+	OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// readCloser reads from one reader and closes another
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// OpenRange returns length bytes of key starting at offset, skipping to
+// offset when s cannot read from it directly
+func OpenRange(ctx context.Context, s Storage, key string, offset, length int64) (io.ReadCloser, error) {
+	if o, ok := s.(RangeOpener); ok {
+		return o.OpenRange(ctx, key, offset, length)
+	}
+	r, err := s.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return readCloser{io.LimitReader(r, length), r}, nil
+}
+
+// Move moves src to dst, copying and deleting when s cannot move directly
+func Move(ctx context.Context, s Storage, src, dst string) error {
+	if m, ok := s.(Mover); ok {
+		return m.Move(ctx, src, dst)
+	}
+	info, err := s.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	r, err := s.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := s.Save(ctx, dst, r, info.Size); err != nil {
+		return err
+	}
+	return s.Delete(ctx, src)
+}
+
+// DeletePrefix removes every key under prefix, when s supports it
+func DeletePrefix(ctx context.Context, s Storage, prefix string) error {
+	if d, ok := s.(PrefixDeleter); ok {
+		return d.DeletePrefix(ctx, prefix)
+	}
+	return ErrNotSupported
+}
+
+// LocalPath returns the filesystem path of key when s keeps files on the
+// local disk, so callers can hand it to tools that need a path
+func LocalPath(s Storage, key string) (string, bool) {
+	if _, ok := s.(*Local); ok {
+		return key, true
+	}
+	return "", false
+}
+
+// FromEnv builds the backend selected by STORAGE_BACKEND: "local" (the
+// default) or "s3", configured by S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID,
+// S3_SECRET_ACCESS_KEY, S3_REGION and S3_USE_SSL (default true).
+func FromEnv() (Storage, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND"))); backend {
+	case "", "local":
+		return NewLocal(), nil
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        strings.TrimSpace(os.Getenv("S3_ENDPOINT")),
+			Bucket:          strings.TrimSpace(os.Getenv("S3_BUCKET")),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			Region:          strings.TrimSpace(os.Getenv("S3_REGION")),
+			UseSSL:          !strings.EqualFold(strings.TrimSpace(os.Getenv("S3_USE_SSL")), "false"),
+		})
+	default:
+		return nil, fmt.Errorf("storage: unknown STORAGE_BACKEND %q", backend)
+	}
+}
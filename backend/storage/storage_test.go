@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// plain hides the optional interfaces of a backend, so the fallbacks of the
+// package's helpers are used
+type plain struct {
+	Storage
+}
+
+// testBackend checks the behaviour every backend shares. Keys are made by
+// joining names onto root.
+func testBackend(t *testing.T, s Storage, root string) {
+	ctx := context.Background()
+	key := func(names ...string) string {
+		return filepath.Join(append([]string{root}, names...)...)
+	}
+	const content = "0123456789abcdef"
+	save := func(t *testing.T, k string) {
+		t.Helper()
+		if err := s.Save(ctx, k, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("save %s: %v", k, err)
+		}
+	}
+	// read returns the content of an opened object, or the error opening it
+	read := func(r io.ReadCloser, err error) string {
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		return string(b)
+	}
+
+	t.Run("save, open and stat", func(t *testing.T) {
+		k := key("user", "project", "doc-a_20240101120000.pdf")
+		save(t, k)
+		if got := read(s.Open(ctx, k)); got != content {
+			t.Errorf("read %q, want %q", got, content)
+		}
+		info, err := s.Stat(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size != int64(len(content)) || info.ModTime.IsZero() {
+			t.Errorf("stat %+v, want %d bytes with a modification time", info, len(content))
+		}
+
+		// Saving again replaces the object
+		if err := s.Save(ctx, k, strings.NewReader("new"), 3); err != nil {
+			t.Fatal(err)
+		}
+		if got := read(s.Open(ctx, k)); got != "new" {
+			t.Errorf("read %q after replacing, want %q", got, "new")
+		}
+	})
+
+	t.Run("missing keys", func(t *testing.T) {
+		k := key("missing", "doc.pdf")
+		if _, err := s.Open(ctx, k); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open: %v, want ErrNotFound", err)
+		}
+		if _, err := s.Stat(ctx, k); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Stat: %v, want ErrNotFound", err)
+		}
+		if err := s.Delete(ctx, k); err != nil {
+			t.Errorf("Delete: %v, want nil", err)
+		}
+		for _, backend := range []Storage{s, plain{s}} {
+			if err := Move(ctx, backend, k, key("missing", "moved.pdf")); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Move with %T: %v, want ErrNotFound", backend, err)
+			}
+		}
+	})
+
+	t.Run("ranges", func(t *testing.T) {
+		k := key("ranges", "doc.pdf")
+		save(t, k)
+		tests := []struct {
+			offset, length int64
+			want           string
+		}{
+			{offset: 0, length: 4, want: "0123"},
+			{offset: 10, length: 6, want: "abcdef"},
+			{offset: 15, length: 1, want: "f"},
+			{offset: 3, length: 0, want: ""},
+		}
+		for _, tt := range tests {
+			for _, backend := range []Storage{s, plain{s}} {
+				if got := read(OpenRange(ctx, backend, k, tt.offset, tt.length)); got != tt.want {
+					t.Errorf("OpenRange(%d, %d) with %T = %q, want %q", tt.offset, tt.length, backend, got, tt.want)
+				}
+			}
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		for _, backend := range []Storage{s, plain{s}} {
+			src, dst := key("move", "doc.pdf"), key("move", ".trash", "doc.pdf")
+			save(t, src)
+			if err := Move(ctx, backend, src, dst); err != nil {
+				t.Fatalf("Move with %T: %v", backend, err)
+			}
+			if _, err := s.Stat(ctx, src); !errors.Is(err, ErrNotFound) {
+				t.Errorf("source still there after Move with %T: %v", backend, err)
+			}
+			if got := read(s.Open(ctx, dst)); got != content {
+				t.Errorf("moved with %T: read %q, want %q", backend, got, content)
+			}
+			s.Delete(ctx, dst)
+		}
+	})
+
+	t.Run("delete prefix", func(t *testing.T) {
+		keep := key("prefix-kept", "doc.pdf")
+		save(t, keep)
+		for _, name := range []string{"a.pdf", "sub/b.pdf"} {
+			save(t, key("prefix", filepath.FromSlash(name)))
+		}
+		if err := DeletePrefix(ctx, s, key("prefix")); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"a.pdf", "sub/b.pdf"} {
+			if _, err := s.Stat(ctx, key("prefix", filepath.FromSlash(name))); !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s still there: %v", name, err)
+			}
+		}
+		// A key that merely starts with the same characters is another directory
+		if _, err := s.Stat(ctx, keep); err != nil {
+			t.Errorf("%s removed with the prefix: %v", keep, err)
+		}
+		if err := DeletePrefix(ctx, plain{s}, key("prefix")); !errors.Is(err, ErrNotSupported) {
+			t.Errorf("DeletePrefix without support: %v, want ErrNotSupported", err)
+		}
+	})
+}
+
+func TestLocal(t *testing.T) {
+	root := t.TempDir()
+	testBackend(t, NewLocal(), root)
+
+	t.Run("link shares the file", func(t *testing.T) {
+		ctx := context.Background()
+		src, dst := filepath.Join(root, "a", "doc.pdf"), filepath.Join(root, "b", "doc.pdf")
+		if err := NewLocal().Save(ctx, src, strings.NewReader("shared"), 6); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewLocal().Link(ctx, src, dst); err != nil {
+			t.Fatal(err)
+		}
+		a, _ := os.Stat(src)
+		b, _ := os.Stat(dst)
+		if a == nil || b == nil || !os.SameFile(a, b) {
+			t.Error("linked file is a separate copy")
+		}
+		// Removing one key leaves the other
+		NewLocal().Delete(ctx, src)
+		if _, err := NewLocal().Stat(ctx, dst); err != nil {
+			t.Errorf("link gone with its source: %v", err)
+		}
+	})
+
+	t.Run("no signed URLs", func(t *testing.T) {
+		if _, err := NewLocal().SignedURL(context.Background(), filepath.Join(root, "doc.pdf"), time.Minute); !errors.Is(err, ErrNotSupported) {
+			t.Errorf("SignedURL: %v, want ErrNotSupported", err)
+		}
+	})
+
+	if path, ok := LocalPath(NewLocal(), "uploads/doc.pdf"); !ok || path != "uploads/doc.pdf" {
+		t.Errorf("LocalPath = %q, %v, want the key", path, ok)
+	}
+}
+
+// TestS3 runs against an S3-compatible store such as MinIO when
+// S3_TEST_ENDPOINT and S3_TEST_BUCKET are set, e.g.
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=localhost:9000 S3_TEST_BUCKET=manju-test \
+//	S3_TEST_ACCESS_KEY_ID=minioadmin S3_TEST_SECRET_ACCESS_KEY=minioadmin go test ./storage
+func TestS3(t *testing.T) {
+	endpoint, bucket := os.Getenv("S3_TEST_ENDPOINT"), os.Getenv("S3_TEST_BUCKET")
+	if endpoint == "" || bucket == "" {
+		t.Skip("S3_TEST_ENDPOINT and S3_TEST_BUCKET not set")
+	}
+	s, err := NewS3(S3Config{
+		Endpoint:        endpoint,
+		Bucket:          bucket,
+		AccessKeyID:     os.Getenv("S3_TEST_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_TEST_SECRET_ACCESS_KEY"),
+		Region:          os.Getenv("S3_TEST_REGION"),
+		UseSSL:          os.Getenv("S3_TEST_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if ok, err := s.client.BucketExists(ctx, bucket); err != nil || !ok {
+		t.Fatalf("bucket %s: exists %v, %v", bucket, ok, err)
+	}
+	root := filepath.Join("storage-test", time.Now().Format("20060102150405.000000000"))
+	t.Cleanup(func() { s.DeletePrefix(ctx, root) })
+
+	testBackend(t, s, root)
+
+	t.Run("signed URL", func(t *testing.T) {
+		key := filepath.Join(root, "signed", "doc.pdf")
+		if err := s.Save(ctx, key, strings.NewReader("signed"), 6); err != nil {
+			t.Fatal(err)
+		}
+		url, err := s.SignedURL(ctx, key, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != "signed" {
+			t.Errorf("GET signed URL: %d %q", resp.StatusCode, body)
+		}
+	})
+}
+
+func TestObjectKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "uploads/documents/u/p/doc.pdf", want: "uploads/documents/u/p/doc.pdf"},
+		{key: "./uploads/documents/doc.pdf", want: "uploads/documents/doc.pdf"},
+		{key: "/var/data/doc.pdf", want: "var/data/doc.pdf"},
+		{key: "uploads//documents/../doc.pdf", want: "uploads/doc.pdf"},
+		{key: "../../etc/passwd", want: "etc/passwd"},
+	}
+	for _, tt := range tests {
+		if got := objectKey(tt.key); got != tt.want {
+			t.Errorf("objectKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantLocal bool
+		wantS3    bool
+		wantErr   bool
+	}{
+		{name: "local by default", wantLocal: true},
+		{name: "local", env: map[string]string{"STORAGE_BACKEND": " Local "}, wantLocal: true},
+		{name: "s3", env: map[string]string{"STORAGE_BACKEND": "s3", "S3_ENDPOINT": "minio:9000", "S3_BUCKET": "docs"}, wantS3: true},
+		{name: "s3 without a bucket", env: map[string]string{"STORAGE_BACKEND": "s3", "S3_ENDPOINT": "minio:9000"}, wantErr: true},
+		{name: "unknown backend", env: map[string]string{"STORAGE_BACKEND": "ftp"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"STORAGE_BACKEND", "S3_ENDPOINT", "S3_BUCKET"} {
+				t.Setenv(env, tt.env[env])
+			}
+			s, err := FromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromEnv() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			_, isLocal := s.(*Local)
+			_, isS3 := s.(*S3)
+			if isLocal != tt.wantLocal || isS3 != tt.wantS3 {
+				t.Errorf("FromEnv() = %T", s)
+			}
+		})
+	}
+}
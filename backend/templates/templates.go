@@ -0,0 +1,13 @@
+package templates
+
+import "embed"
+
+// Builtin holds the JSON definitions of the built-in project templates
+//
+//go:embed builtin/*.json
+var Builtin embed.FS
+
+// WelcomeEmail is the HTML body sent to users after their first login
+//
+//go:embed welcome.html
+var WelcomeEmail string
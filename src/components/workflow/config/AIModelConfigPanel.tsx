@@ -51,7 +51,7 @@ export default function AIModelConfigPanel({ data, onSave, onClose }: AIModelCon
     const fetchKeys = async () => {
       if (!user?.id) return;
       try {
-        const res = await apiFetch(`${API_BASE}/api/users/${user.id}/api-keys`, {
+        const res = await apiFetch(`${API_BASE}/api/v1/users/${user.id}/api-keys`, {
           credentials: 'include',
         });
         if (res.ok) {
@@ -78,7 +78,7 @@ export default function AIModelConfigPanel({ data, onSave, onClose }: AIModelCon
 
     setSavingKey(true);
     try {
-      const res = await apiFetch(`${API_BASE}/api/users/${user.id}/api-keys`, {
+      const res = await apiFetch(`${API_BASE}/api/v1/users/${user.id}/api-keys`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         credentials: 'include',
@@ -1,4 +1,4 @@
-import { useState, useRef, useCallback } from 'react';
+import { useState, useRef, useCallback, useEffect } from 'react';
 import { motion } from 'framer-motion';
 import { X, FileText, Upload, Trash2, File, FileIcon, Loader2, CheckCircle, AlertCircle, RefreshCw, Zap } from 'lucide-react';
 import type { RAGDocumentData, UploadedDocument } from '../../../types/workflow';
@@ -15,10 +15,40 @@ interface RAGDocumentConfigPanelProps {
 
 const fileTypeIcons: Record<string, React.ReactNode> = {
   pdf: <FileIcon className="w-8 h-8 text-red-500" />,
+  'application/pdf': <FileIcon className="w-8 h-8 text-red-500" />,
   docx: <File className="w-8 h-8 text-blue-500" />,
+  'application/vnd.openxmlformats-officedocument.wordprocessingml.document': <File className="w-8 h-8 text-blue-500" />,
+  xlsx: <File className="w-8 h-8 text-green-600" />,
+  'application/vnd.openxmlformats-officedocument.spreadsheetml.sheet': <File className="w-8 h-8 text-green-600" />,
+  csv: <File className="w-8 h-8 text-green-600" />,
+  'text/csv': <File className="w-8 h-8 text-green-600" />,
   txt: <FileText className="w-8 h-8 text-gray-500" />,
 };
 
+interface DocumentLimits {
+  max_bytes: number;
+  allowed_types: string[];
+  archive_types?: string[];
+}
+
+interface ArchiveUploadResult {
+  documents: UploadedDocument[];
+  skipped: { name: string; reason: string }[];
+}
+
+// Used until the server's limits have loaded
+const defaultLimits: DocumentLimits = {
+  max_bytes: 25 * 1024 * 1024,
+  allowed_types: ['.pdf', '.docx', '.txt', '.doc', '.md', '.csv', '.xlsx'],
+  archive_types: ['.zip'],
+};
+
+const formatFileSize = (bytes: number) => {
+  if (bytes < 1024) return `${bytes} B`;
+  if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+  return `${(bytes / (1024 * 1024)).toFixed(1)} MB`;
+};
+
 const statusIcons: Record<string, React.ReactNode> = {
   uploading: <Loader2 className="w-4 h-4 text-blue-500 animate-spin" />,
   processing: <RefreshCw className="w-4 h-4 text-yellow-500 animate-spin" />,
@@ -33,8 +63,21 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
   const [embedding, setEmbedding] = useState(false);
   const [embedStatus, setEmbedStatus] = useState<'idle' | 'success' | 'error'>('idle');
   const [embedMessage, setEmbedMessage] = useState('');
+  const [limits, setLimits] = useState<DocumentLimits>(defaultLimits);
+  const [uploadError, setUploadError] = useState('');
   const fileInputRef = useRef<HTMLInputElement>(null);
 
+  useEffect(() => {
+    apiFetch(`${API_BASE}/api/v1/projects/document-limits`, { credentials: 'include' })
+      .then(res => (res.ok ? res.json() : null))
+      .then(result => {
+        if (result) setLimits(result);
+      })
+      .catch(() => {
+        // Keep the defaults; the server still enforces its own limits
+      });
+  }, []);
+
   const embedDocuments = useCallback(async () => {
     if (!projectId || formData.documents.length === 0) return;
 
@@ -43,7 +86,7 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
     setEmbedMessage('');
 
     try {
-      const res = await apiFetch(`${API_BASE}/api/projects/${projectId}/documents/embed`, {
+      const res = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}/documents/embed`, {
         method: 'POST',
         credentials: 'include',
         headers: {
@@ -53,12 +96,31 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
 
       const result = await res.json();
 
-      if (!res.ok) {
-        throw new Error(result.error || 'Embedding failed');
+      // A job already running for this project is followed instead of starting another
+      const running = res.status === 409 ? result.details : undefined;
+      if (!res.ok && !running?.job_id) {
+        throw new Error(result.message || 'Embedding failed');
+      }
+
+      // Embedding runs in the background; poll the job until it finishes
+      const jobId = running?.job_id ?? result.job_id;
+      let job = running ?? result;
+      while (job.status === 'pending' || job.status === 'running') {
+        await new Promise(resolve => setTimeout(resolve, 2000));
+        const jobRes = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}/documents/embed/${jobId}`, {
+          credentials: 'include',
+        });
+        job = await jobRes.json();
+        if (!jobRes.ok) {
+          throw new Error(job.message || 'Failed to check embedding status');
+        }
+      }
+      if (job.status === 'failed') {
+        throw new Error(job.error || 'Embedding failed');
       }
 
       setEmbedStatus('success');
-      setEmbedMessage(result.message || 'Documents embedded successfully!');
+      setEmbedMessage('Documents embedded successfully!');
     } catch (error) {
       console.error('Embed error:', error);
       setEmbedStatus('error');
@@ -68,8 +130,54 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
     }
   }, [projectId, formData.documents.length]);
 
+  // A zip is expanded by the server into one document per file inside it
+  const uploadArchive = useCallback(async (file: File) => {
+    const formDataUpload = new FormData();
+    formDataUpload.append('file', file);
+
+    const res = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}/documents`, {
+      method: 'POST',
+      credentials: 'include',
+      body: formDataUpload,
+    });
+    const result = await res.json().catch(() => ({}));
+    const skipped: ArchiveUploadResult['skipped'] = res.ok ? result.skipped ?? [] : result.details?.skipped ?? [];
+    if (!res.ok && skipped.length === 0) {
+      setUploadError(`${file.name}: ${result.message || 'upload failed'}`);
+      return;
+    }
+    if (skipped.length > 0) {
+      setUploadError(`${file.name}: skipped ${skipped.map(s => `${s.name} (${s.reason})`).join(', ')}`);
+    }
+    if (!res.ok) return;
+
+    const { documents } = result as ArchiveUploadResult;
+    setFormData(prev => ({
+      ...prev,
+      documents: [
+        ...prev.documents,
+        ...documents.filter(d => !prev.documents.some(p => p.id === d.id)).map(d => ({ ...d, status: 'ready' as const })),
+      ],
+    }));
+  }, [projectId]);
+
   const uploadFile = useCallback(async (file: File): Promise<UploadedDocument | null> => {
-    const ext = file.name.split('.').pop()?.toLowerCase() as 'pdf' | 'docx' | 'txt';
+    const ext = file.name.split('.').pop()?.toLowerCase() ?? '';
+
+    if (limits.archive_types?.includes(`.${ext}`)) {
+      await uploadArchive(file);
+      return null;
+    }
+
+    // Check the server's limits before uploading
+    if (!limits.allowed_types.includes(`.${ext}`)) {
+      setUploadError(`${file.name}: unsupported file type. Allowed: ${limits.allowed_types.join(', ')}`);
+      return null;
+    }
+    if (file.size > limits.max_bytes) {
+      setUploadError(`${file.name} is ${formatFileSize(file.size)}; the limit is ${formatFileSize(limits.max_bytes)}`);
+      return null;
+    }
     const docId = `doc-${Date.now()}-${Math.random().toString(36).substr(2, 9)}`;
 
     // Create initial document entry with uploading status
@@ -94,24 +202,44 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
       formDataUpload.append('file', file);
       formDataUpload.append('documentId', docId);
 
-      const res = await apiFetch(`${API_BASE}/api/projects/${projectId}/documents`, {
+      const res = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}/documents`, {
         method: 'POST',
         credentials: 'include',
         body: formDataUpload,
       });
 
+      const result = await res.json().catch(() => ({}));
+
       if (!res.ok) {
+        if (res.status === 413 && result.details?.max_bytes) {
+          setUploadError(`${file.name} exceeds the ${formatFileSize(result.details.max_bytes)} upload limit`);
+        } else if (res.status === 415 && result.details?.allowed_types) {
+          setUploadError(`${file.name}: unsupported file type. Allowed: ${result.details.allowed_types.join(', ')}`);
+        }
         throw new Error('Upload failed');
       }
 
-      const result = await res.json();
+      // The same content was already uploaded; keep the existing document instead
+      if (result.status === 'deduplicated') {
+        setFormData(prev => ({
+          ...prev,
+          documents: prev.documents.some(d => d.id === result.id)
+            ? prev.documents.filter(d => d.id !== docId)
+            : prev.documents.map(d =>
+                d.id === docId
+                  ? { ...d, status: 'ready', id: result.id, name: result.name, type: result.type || d.type, contentHash: result.contentHash }
+                  : d
+              ),
+        }));
+        return { ...newDoc, status: 'ready', id: result.id };
+      }
 
       // Update document status to processing/ready
       setFormData(prev => ({
         ...prev,
         documents: prev.documents.map(d =>
           d.id === docId
-            ? { ...d, status: result.status || 'ready', id: result.id || docId }
+            ? { ...d, status: result.status || 'ready', id: result.id || docId, type: result.type || d.type, contentHash: result.contentHash }
             : d
         ),
       }));
@@ -128,12 +256,13 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
       }));
       return null;
     }
-  }, [projectId]);
+  }, [projectId, limits, uploadArchive]);
 
   const handleFileSelect = async (files: FileList | null) => {
     if (!files || files.length === 0) return;
 
     setUploading(true);
+    setUploadError('');
 
     // Upload files one by one
     for (const file of Array.from(files)) {
@@ -161,7 +290,7 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
   const handleRemoveDocument = async (docId: string) => {
     try {
       // Call backend to delete
-      await apiFetch(`${API_BASE}/api/projects/${projectId}/documents/${docId}`, {
+      await apiFetch(`${API_BASE}/api/v1/projects/${projectId}/documents/${docId}`, {
         method: 'DELETE',
         credentials: 'include',
       });
@@ -176,12 +305,6 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
     });
   };
 
-  const formatFileSize = (bytes: number) => {
-    if (bytes < 1024) return `${bytes} B`;
-    if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
-    return `${(bytes / (1024 * 1024)).toFixed(1)} MB`;
-  };
-
   return (
     <motion.div
       initial={{ opacity: 0, x: 300 }}
@@ -224,16 +347,24 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
                 browse
               </button>
             </p>
-            <p className="text-xs text-gray-400">Supports PDF, DOCX, TXT</p>
+            <p className="text-xs text-gray-400">
+              Supports {limits.allowed_types.map(t => t.slice(1).toUpperCase()).join(', ')} up to {formatFileSize(limits.max_bytes)}, or a ZIP of them
+            </p>
             <input
               ref={fileInputRef}
               type="file"
               multiple
-              accept=".pdf,.docx,.txt"
+              accept={[...limits.allowed_types, ...(limits.archive_types ?? [])].join(',')}
               onChange={(e) => handleFileSelect(e.target.files)}
               className="hidden"
             />
           </div>
+          {uploadError && (
+            <p className="mt-2 text-xs text-red-600 flex items-center gap-1">
+              <AlertCircle className="w-3 h-3" />
+              {uploadError}
+            </p>
+          )}
         </div>
 
         {/* Document List */}
@@ -260,6 +391,11 @@ export default function RAGDocumentConfigPanel({ data, projectId, onSave, onClos
                         {statusIcons[doc.status]}
                         {doc.status}
                       </span>
+                      {doc.embeddingStatus && doc.embeddingStatus !== 'embedded' && (
+                        <span className={doc.embeddingStatus === 'failed' ? 'text-red-500' : 'text-amber-600'}>
+                          • {doc.embeddingStatus === 'stale' ? 'needs re-embedding' : `embedding ${doc.embeddingStatus}`}
+                        </span>
+                      )}
                     </div>
                   </div>
                   <button
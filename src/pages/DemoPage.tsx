@@ -97,7 +97,7 @@ export default function DemoPage() {
         setLoading(true);
 
         // Load project info
-        const projectRes = await apiFetch(`${API_BASE}/api/projects/${projectId}`, {
+        const projectRes = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}`, {
           credentials: 'include',
         });
 
@@ -114,11 +114,11 @@ export default function DemoPage() {
 
         // Validate workflow and get workflow type in parallel
         const [validateRes, workflowTypeRes] = await Promise.all([
-          apiFetch(`${API_BASE}/api/projects/${projectId}/validate`, {
+          apiFetch(`${API_BASE}/api/v1/projects/${projectId}/validate`, {
             method: 'POST',
             credentials: 'include',
           }),
-          apiFetch(`${API_BASE}/api/projects/${projectId}/workflow-type`, {
+          apiFetch(`${API_BASE}/api/v1/projects/${projectId}/workflow-type`, {
             credentials: 'include',
           }),
         ]);
@@ -184,7 +184,7 @@ export default function DemoPage() {
 
       // For voice workflows, we could send the audio blob
       // For now, we'll send the transcription
-      const res = await apiFetch(`${API_BASE}/api/projects/${projectId}/demo`, {
+      const res = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}/demo`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         credentials: 'include',
@@ -198,7 +198,7 @@ export default function DemoPage() {
 
       if (!res.ok) {
         const errorData = await res.json().catch(() => ({}));
-        throw new Error(errorData.error || 'Failed to get response');
+        throw new Error(errorData.message || 'Failed to get response');
       }
 
       const data = await res.json();
@@ -453,7 +453,7 @@ export default function DemoPage() {
         audioRef.current = null;
       }
 
-      const res = await apiFetch(`${API_BASE}/api/projects/${projectId}/tts`, {
+      const res = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}/tts`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         credentials: 'include',
@@ -516,7 +516,7 @@ export default function DemoPage() {
         content: msg.content,
       }));
 
-      const res = await apiFetch(`${API_BASE}/api/projects/${projectId}/demo`, {
+      const res = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}/demo`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         credentials: 'include',
@@ -529,7 +529,7 @@ export default function DemoPage() {
 
       if (!res.ok) {
         const errorData = await res.json().catch(() => ({}));
-        throw new Error(errorData.error || 'Failed to get response');
+        throw new Error(errorData.message || 'Failed to get response');
       }
 
       const data = await res.json();
@@ -54,7 +54,7 @@ export default function ModelConfig() {
     const loadProjectData = async (id: string) => {
       try {
         setLoading(true);
-        const res = await apiFetch(`${API_BASE}/api/projects/${id}`, {
+        const res = await apiFetch(`${API_BASE}/api/v1/projects/${id}`, {
           credentials: 'include',
         });
         if (!res.ok) {
@@ -191,7 +191,7 @@ export default function ModelConfig() {
           return n;
         });
 
-        const res = await apiFetch(`${API_BASE}/api/projects/${projectId}`, {
+        const res = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}`, {
           method: 'PUT',
           headers: { 'Content-Type': 'application/json' },
           credentials: 'include',
@@ -207,7 +207,7 @@ export default function ModelConfig() {
         await Swal.fire({ icon: 'success', title: 'Saved', text: 'Project saved.' });
       } else {
         // Create new project
-        const res = await apiFetch(`${API_BASE}/api/projects`, {
+        const res = await apiFetch(`${API_BASE}/api/v1/projects`, {
           method: 'POST',
           headers: { 'Content-Type': 'application/json' },
           credentials: 'include',
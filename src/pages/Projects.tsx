@@ -48,7 +48,7 @@ export default function Projects() {
     const loadProjects = async () => {
       try {
         setLoading(true);
-        const res = await apiFetch(`${API_BASE}/api/projects`, {
+        const res = await apiFetch(`${API_BASE}/api/v1/projects`, {
           credentials: 'include',
         });
         if (!res.ok) {
@@ -88,7 +88,7 @@ export default function Projects() {
 
     try {
       setCreating(true);
-      const res = await apiFetch(`${API_BASE}/api/projects`, {
+      const res = await apiFetch(`${API_BASE}/api/v1/projects`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         credentials: 'include',
@@ -123,7 +123,7 @@ export default function Projects() {
     if (!confirm('Are you sure you want to delete this project?')) return;
 
     try {
-      const res = await apiFetch(`${API_BASE}/api/projects/${id}`, {
+      const res = await apiFetch(`${API_BASE}/api/v1/projects/${id}`, {
         method: 'DELETE',
         credentials: 'include',
       });
@@ -153,7 +153,7 @@ export default function Projects() {
     if (!editingName.trim()) return;
     try {
       setSavingEdit(true);
-      const res = await apiFetch(`${API_BASE}/api/projects/${projectId}`, {
+      const res = await apiFetch(`${API_BASE}/api/v1/projects/${projectId}`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         credentials: 'include',
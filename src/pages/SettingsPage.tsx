@@ -37,7 +37,7 @@ export default function SettingsPage() {
             if (!user?.id) return;
 
             try {
-                const res = await apiFetch(`${API_BASE}/api/users/${user.id}/api-keys`, {
+                const res = await apiFetch(`${API_BASE}/api/v1/users/${user.id}/api-keys`, {
                     credentials: 'include',
                 });
                 if (res.ok) {
@@ -69,7 +69,7 @@ export default function SettingsPage() {
 
         setSaving(true);
         try {
-            const res = await apiFetch(`${API_BASE}/api/users/${user?.id}/api-keys`, {
+            const res = await apiFetch(`${API_BASE}/api/v1/users/${user?.id}/api-keys`, {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 credentials: 'include',
@@ -80,6 +80,10 @@ export default function SettingsPage() {
                 }),
             });
 
+            if (res.status === 422) {
+                Swal.fire({ icon: 'error', title: 'Invalid API Key', text: 'OpenAI rejected this key. Check that it is correct and still active.' });
+                return;
+            }
             if (!res.ok) {
                 throw new Error('Failed to save API key');
             }
@@ -111,7 +115,7 @@ export default function SettingsPage() {
         if (!result.isConfirmed) return;
 
         try {
-            const res = await apiFetch(`${API_BASE}/api/users/${user?.id}/api-keys/${keyId}`, {
+            const res = await apiFetch(`${API_BASE}/api/v1/users/${user?.id}/api-keys/${keyId}`, {
                 method: 'DELETE',
                 credentials: 'include',
             });
@@ -127,7 +131,7 @@ export default function SettingsPage() {
 
     const handleSetDefault = async (keyId: string) => {
         try {
-            const res = await apiFetch(`${API_BASE}/api/users/${user?.id}/api-keys/${keyId}/default`, {
+            const res = await apiFetch(`${API_BASE}/api/v1/users/${user?.id}/api-keys/${keyId}/default`, {
                 method: 'PUT',
                 credentials: 'include',
             });
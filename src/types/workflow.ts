@@ -47,10 +47,12 @@ export interface RAGDocumentData {
 export interface UploadedDocument {
   id: string;
   name: string;
-  type: 'pdf' | 'docx' | 'txt';
+  type: string; // MIME type once uploaded, e.g. application/pdf
   size: number;
   uploadedAt: string;
   status: 'uploading' | 'processing' | 'ready' | 'error';
+  contentHash?: string; // SHA-256 of the file, set by the server
+  embeddingStatus?: 'pending' | 'embedded' | 'failed' | 'stale';
 }
 
 export interface GoogleSheetsData {